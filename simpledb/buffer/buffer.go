@@ -27,7 +27,7 @@ func NewBuffer(fm *file.Manager, debugName string) *Buffer {
 
 		fileManager: fm,
 		txNum:       -1,
-		contents:    file.NewPage(fm.BlockSize()),
+		contents:    fm.NewPage(),
 	}
 }
 
@@ -132,6 +132,39 @@ func (bm *Manager) FlushAll(txNum int32) {
 	}
 }
 
+// Discard filename のブロックを割り当てられたバッファを、内容を書き出さずに空にする
+// 削除したファイルのブロックが、同じ名前で作り直したファイルから読まれないようにするために使う
+func (bm *Manager) Discard(filename string) error {
+	return bm.DiscardFrom(filename, 0)
+}
+
+// DiscardFrom filename のブロック番号 blockNum 以降のブロックを割り当てられたバッファを、内容を書き出さずに空にする
+// 切り詰めたファイルのブロックが、後から書き出されてファイルが伸びないようにするために使う
+func (bm *Manager) DiscardFrom(filename string, blockNum int32) error {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	for _, buf := range bm.bufferPool {
+		if buf.block.FileName != filename || buf.block.Number < blockNum {
+			continue
+		}
+		if buf.IsPinned() {
+			return fmt.Errorf("buffer for block %+v is still pinned", buf.block)
+		}
+		buf.block = file.BlockID{}
+		buf.txNum = -1
+	}
+	return nil
+}
+
+// Latch ロックで守られていないバッファの内容を読み書きする f を、他の Latch の f やバッファの書き出しと重ならないように実行する
+func (bm *Manager) Latch(f func()) {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	f()
+}
+
 func (bm *Manager) NumAvailable() int32 {
 	bm.mux.Lock()
 	defer bm.mux.Unlock()
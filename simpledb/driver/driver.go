@@ -14,9 +14,14 @@ func init() {
 	sql.Register("simpledb", &SimpleDBDriver{})
 }
 
+// Open データソース名 name のデータベースを開く。name の形式は parseDSN を参照
 func (d SimpleDBDriver) Open(name string) (driver.Conn, error) {
+	dir, opts, err := parseDSN(name)
+	if err != nil {
+		return nil, err
+	}
 	fmt.Println("opening database")
-	db, err := server.NewSimpleDBWithMetadata(name)
+	db, err := server.NewSimpleDBWithOptions(dir, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -2,8 +2,14 @@ package driver
 
 import (
 	"database/sql"
+	"errors"
 	"path"
+	"simpledb/file"
+	"simpledb/metadata"
+	"simpledb/plan"
+	"simpledb/server"
 	"testing"
+	"time"
 	// 異なるパッケージからドライバーを利用する場合は、init()を呼び出すためにインポートする必要がある
 	// _"simpledb/driver"
 )
@@ -74,6 +80,130 @@ func TestDriver(t *testing.T) {
 	commit(t, tx6)
 }
 
+func TestDriverConstraintViolation(t *testing.T) {
+	db, err := sql.Open("simpledb", path.Join(t.TempDir(), "constraintdb"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	tx := beginTx(t, db)
+	createTable(t, tx, "create table player (player_id int primary key, name varchar(10) unique)")
+	insert(t, tx, "insert into player (player_id, name) values (1, 'Nobak')")
+	_, err = tx.Exec("insert into player (player_id, name) values (1, 'Carlos')")
+	var cve *metadata.ConstraintViolationError
+	if !errors.As(err, &cve) {
+		t.Fatalf("expected constraint violation, but got %v", err)
+	}
+	if cve.Type != metadata.ConstraintPrimaryKey || cve.Constraint != "player_pkey" {
+		t.Errorf("unexpected violation: %+v", cve)
+	}
+	if _, err := tx.Exec("update player set name = 'Nobak' where player_id = 1"); err != nil {
+		t.Errorf("updating a row to its own key should succeed: %v", err)
+	}
+	commit(t, tx)
+}
+
+func TestDriverCheckIndex(t *testing.T) {
+	db, err := sql.Open("simpledb", path.Join(t.TempDir(), "checkdb"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	// 既定の計画は索引を保守しないので、挿入したレコードのエントリは索引にない
+	tx := beginTx(t, db)
+	createTable(t, tx, "create table player (player_id int, name varchar(10))")
+	createTable(t, tx, "create index player_id_idx on player (player_id)")
+	insert(t, tx, "insert into player (player_id, name) values (1, 'Nobak')")
+	insert(t, tx, "insert into player (player_id, name) values (2, 'Carlos')")
+	_, err = tx.Exec("check table player")
+	var ice *plan.IndexCheckError
+	if !errors.As(err, &ice) {
+		t.Fatalf("expected index check error, but got %v", err)
+	}
+	if len(ice.Problems) != 2 || ice.Problems[0].Kind != plan.IndexEntryMissing {
+		t.Errorf("unexpected problems: %v", err)
+	}
+	if _, err := tx.Exec("reindex index player_id_idx"); err != nil {
+		t.Fatalf("failed to reindex: %v", err)
+	}
+	if _, err := tx.Exec("check index player_id_idx"); err != nil {
+		t.Errorf("expected no problems after reindex: %v", err)
+	}
+	commit(t, tx)
+}
+
+func TestDriverOptions(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		dir     string
+		opts    server.Options
+		wantErr bool
+	}{
+		{dsn: "db", dir: "db", opts: server.Options{Planner: server.BasicPlanner}},
+		{
+			dsn:  "path/to/db?buffers=1000&planner=heuristic&lock_timeout=2s",
+			dir:  "path/to/db",
+			opts: server.Options{BufferSize: 1000, Planner: server.HeuristicPlanner, LockTimeout: 2 * time.Second},
+		},
+		{
+			dsn:  "db?block_size=1024&encoding=utf8",
+			dir:  "db",
+			opts: server.Options{BlockSize: 1024, Encoding: file.UTF8, Planner: server.BasicPlanner},
+		},
+		{dsn: "db?buffers=0", wantErr: true},
+		{dsn: "db?planner=cost", wantErr: true},
+		{dsn: "db?lock_timeout=2", wantErr: true},
+		{dsn: "db?cache=10", wantErr: true},
+		{dsn: "?buffers=10", wantErr: true},
+	}
+	for _, tt := range tests {
+		dir, opts, err := parseDSN(tt.dsn)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDSN(%q): expected error", tt.dsn)
+			}
+			continue
+		}
+		if err != nil || dir != tt.dir || opts != tt.opts {
+			t.Errorf("parseDSN(%q) = %q, %+v, %v, want %q, %+v", tt.dsn, dir, opts, err, tt.dir, tt.opts)
+		}
+	}
+
+	dir := path.Join(t.TempDir(), "optiondb")
+	db, err := sql.Open("simpledb", dir+"?block_size=512&buffers=100&planner=heuristic&lock_timeout=2s")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	tx := beginTx(t, db)
+	createTable(t, tx, "create table player (player_id int, name varchar(10))")
+	insert(t, tx, "insert into player (player_id, name) values (1, 'Nobak')")
+	commit(t, tx)
+	if control, err := file.ReadControl(dir); err != nil || control.BlockSize != 512 {
+		t.Errorf("ReadControl: %+v, %v", control, err)
+	}
+
+	// 既存のデータベースは記録されたブロックの大きさで開き、異なる大きさを指定すればエラーになる
+	db2, err := sql.Open("simpledb", dir)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db2.Close()
+	if err := db2.Ping(); err != nil {
+		t.Errorf("failed to ping db: %v", err)
+	}
+	db3, err := sql.Open("simpledb", dir+"?block_size=400")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db3.Close()
+	if err := db3.Ping(); err == nil {
+		t.Errorf("expected error for a different block size")
+	}
+}
+
 func beginTx(t *testing.T, db *sql.DB) *sql.Tx {
 	tx, err := db.Begin()
 	if err != nil {
@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"simpledb/file"
+	"simpledb/server"
+)
+
+// parseDSN データソース名 dir?buffers=1000&planner=heuristic&lock_timeout=2s を、ディレクトリと設定に分ける
+//
+//	buffers       バッファの数
+//	block_size    ブロックの大きさ。既存のデータベースでは記録された大きさと一致しなければならない
+//	encoding      新しいデータベースの文字列の符号化方式 (utf16 か utf8)
+//	planner       basic か heuristic
+//	lock_timeout  ロックを待つ時間 (time.ParseDuration の形式)
+func parseDSN(name string) (string, server.Options, error) {
+	opts := server.Options{Planner: server.BasicPlanner}
+	dir, query, _ := strings.Cut(name, "?")
+	if dir == "" {
+		return "", opts, fmt.Errorf("no database directory in %q", name)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", opts, fmt.Errorf("invalid options in %q: %w", name, err)
+	}
+	for key, vals := range values {
+		val := vals[len(vals)-1]
+		switch key {
+		case "buffers":
+			opts.BufferSize, err = parsePositive(key, val)
+		case "block_size":
+			opts.BlockSize, err = parsePositive(key, val)
+		case "encoding":
+			opts.Encoding, err = file.ParseEncoding(val)
+		case "planner":
+			if val != server.BasicPlanner && val != server.HeuristicPlanner {
+				err = fmt.Errorf("unknown planner %q", val)
+			}
+			opts.Planner = val
+		case "lock_timeout":
+			opts.LockTimeout, err = time.ParseDuration(val)
+			if err == nil && opts.LockTimeout <= 0 {
+				err = fmt.Errorf("lock_timeout must be positive: %q", val)
+			}
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return "", opts, err
+		}
+	}
+	return dir, opts, nil
+}
+
+func parsePositive(key, val string) (int32, error) {
+	n, err := strconv.ParseInt(val, 10, 32)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer: %q", key, val)
+	}
+	return int32(n), nil
+}
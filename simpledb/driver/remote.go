@@ -0,0 +1,146 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+
+	"simpledb/network"
+)
+
+var ErrArgsNotSupported = errors.New("query arguments are not supported")
+
+// RemoteDriver network.Server に接続するドライバー。DSN にはサーバーのアドレス (host:port) を指定する
+type RemoteDriver struct{}
+
+func init() {
+	sql.Register("simpledb-remote", &RemoteDriver{})
+}
+
+func (d RemoteDriver) Open(name string) (driver.Conn, error) {
+	client, err := network.Dial(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteConnection(client), nil
+}
+
+type RemoteConnection struct {
+	client *network.Client
+}
+
+func NewRemoteConnection(client *network.Client) *RemoteConnection {
+	return &RemoteConnection{client: client}
+}
+
+func (conn *RemoteConnection) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (conn *RemoteConnection) Begin() (driver.Tx, error) {
+	return conn.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (conn *RemoteConnection) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := conn.client.Do(&network.Request{Op: network.OpBegin}); err != nil {
+		return nil, err
+	}
+	return &RemoteTransaction{conn: conn}, nil
+}
+
+func (conn *RemoteConnection) Close() error {
+	return conn.client.Close()
+}
+
+func (conn *RemoteConnection) Prepare(query string) (driver.Stmt, error) {
+	return nil, ErrArgsNotSupported
+}
+
+func (conn *RemoteConnection) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 {
+		return nil, ErrArgsNotSupported
+	}
+	res, err := conn.client.Do(&network.Request{Op: network.OpExec, SQL: query})
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(res.RowsAffected), nil
+}
+
+func (conn *RemoteConnection) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return nil, ErrArgsNotSupported
+	}
+	res, err := conn.client.Do(&network.Request{Op: network.OpQuery, SQL: query})
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteRows{conn: conn, columns: res.Columns, rows: res.Rows, done: res.Done}, nil
+}
+
+type RemoteTransaction struct {
+	conn *RemoteConnection
+}
+
+func (txc *RemoteTransaction) Commit() error {
+	_, err := txc.conn.client.Do(&network.Request{Op: network.OpCommit})
+	return err
+}
+
+func (txc *RemoteTransaction) Rollback() error {
+	_, err := txc.conn.client.Do(&network.Request{Op: network.OpRollback})
+	return err
+}
+
+// RemoteRows サーバーから network.FetchSize 行ずつ取得する結果セット
+type RemoteRows struct {
+	conn    *RemoteConnection
+	columns []network.Column
+	rows    [][]any
+	done    bool
+}
+
+func (r *RemoteRows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, col := range r.columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (r *RemoteRows) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	r.rows = nil
+	_, err := r.conn.client.Do(&network.Request{Op: network.OpClose})
+	return err
+}
+
+func (r *RemoteRows) Next(dest []driver.Value) error {
+	for len(r.rows) == 0 {
+		if r.done {
+			return io.EOF
+		}
+		res, err := r.conn.client.Do(&network.Request{Op: network.OpFetch})
+		if err != nil {
+			return err
+		}
+		r.rows = res.Rows
+		r.done = res.Done
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	for i, col := range r.columns {
+		val, err := network.DecodeValue(col, row[i])
+		if err != nil {
+			return err
+		}
+		dest[i] = val
+	}
+	return nil
+}
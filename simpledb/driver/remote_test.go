@@ -0,0 +1,179 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"testing"
+
+	"simpledb/metadata"
+	"simpledb/network"
+	"simpledb/server"
+)
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	db, err := server.NewOptimizedSimpleDB(path.Join(t.TempDir(), "remotedb"))
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := network.NewServer(db)
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String()
+}
+
+func TestRemoteDriver(t *testing.T) {
+	addr := startServer(t)
+	db, err := sql.Open("simpledb-remote", addr)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	// トランザクションなしの実行は自動コミットされる
+	if _, err := db.Exec("create table player (player_id int, name varchar(10), point int)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	// network.FetchSize を超える行数で複数回のフェッチを確認する
+	n := network.FetchSize*2 + 5
+	tx1 := beginTx(t, db)
+	for i := 0; i < n; i++ {
+		insert(t, tx1, fmt.Sprintf("insert into player (player_id, name, point) values (%d, 'p%d', %d)", i, i, i*10))
+	}
+	commit(t, tx1)
+
+	tx2 := beginTx(t, db)
+	update(t, tx2, "update player set point = 0")
+	rollback(t, tx2)
+
+	rows, err := db.Query("select player_id, name, point from player")
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	count := 0
+	for rows.Next() {
+		var id, point int
+		var name string
+		if err := rows.Scan(&id, &name, &point); err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+		if name != fmt.Sprintf("p%d", id) || point != id*10 {
+			t.Errorf("unexpected row {player_id: %d, name: %s, point: %d}", id, name, point)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows error: %v", err)
+	}
+	rows.Close()
+	if count != n {
+		t.Errorf("expected %d rows, but got %d", n, count)
+	}
+
+	// 途中で閉じた結果セットの後も同じコネクションで実行できる
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get conn: %v", err)
+	}
+	defer conn.Close()
+	rows, err = conn.QueryContext(ctx, "select player_id from player")
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	rows.Next()
+	rows.Close()
+	var id int
+	if err := conn.QueryRowContext(ctx, "select player_id from player where player_id = 3").Scan(&id); err != nil {
+		t.Fatalf("failed to query row: %v", err)
+	}
+	if id != 3 {
+		t.Errorf("expected 3, but got %d", id)
+	}
+
+	_, err = db.Exec("update player set")
+	var remoteErr *network.Error
+	if !errors.As(err, &remoteErr) || remoteErr.Code != network.CodeSyntax {
+		t.Errorf("expected syntax error, but got %v", err)
+	}
+
+	// 制約違反はクライアント側でも型で判別できる
+	if _, err := db.Exec("create table team (team_id int primary key)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := db.Exec("insert into team (team_id) values (1)"); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	_, err = db.Exec("insert into team (team_id) values (1)")
+	if !errors.As(err, &remoteErr) || remoteErr.Code != network.CodeConstraint {
+		t.Errorf("expected constraint error, but got %v", err)
+	}
+	var cve *metadata.ConstraintViolationError
+	if !errors.As(err, &cve) || cve.Constraint != "team_pkey" || cve.Value != "(1)" {
+		t.Errorf("expected violation of team_pkey, but got %v", err)
+	}
+}
+
+func TestRemoteDriverConcurrentSessions(t *testing.T) {
+	addr := startServer(t)
+	db, err := sql.Open("simpledb-remote", addr)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("create table counter (session int, value int)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	const sessions = 4
+	errs := make(chan error, sessions)
+	for s := 0; s < sessions; s++ {
+		go func(s int) {
+			tx, err := db.Begin()
+			if err != nil {
+				errs <- err
+				return
+			}
+			for v := 0; v < 5; v++ {
+				if _, err := tx.Exec(fmt.Sprintf("insert into counter (session, value) values (%d, %d)", s, v)); err != nil {
+					tx.Rollback()
+					errs <- err
+					return
+				}
+			}
+			errs <- tx.Commit()
+		}(s)
+	}
+	for s := 0; s < sessions; s++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("session failed: %v", err)
+		}
+	}
+
+	var session, value int
+	rows, err := db.Query("select session, value from counter")
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(&session, &value); err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+		count++
+	}
+	if count != sessions*5 {
+		t.Errorf("expected %d rows, but got %d", sessions*5, count)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"simpledb/util/logger"
+	"slices"
 	"strings"
 	"sync"
 	"unicode/utf16"
@@ -25,7 +26,8 @@ func NewBlockID(filename string, blockNum int32) BlockID {
 }
 
 type Page struct {
-	buffer []byte
+	buffer   []byte
+	encoding Encoding
 }
 
 const (
@@ -33,6 +35,60 @@ const (
 	utf16Size  int32 = 2
 )
 
+// Encoding ページに書き込む文字列の符号化方式
+// VARCHAR(n) の列には MaxLength(n) バイトを確保し、StringBytes がそれに収まる文字列を格納できる
+// UTF-8 なら n バイト、UTF-16 なら n 符号単位までの文字列になる
+type Encoding int32
+
+const (
+	// UTF16 文字列を UTF-16 で書き込む。ヘッダのない古いデータベースはこの方式
+	UTF16 Encoding = iota
+	// UTF8 文字列を UTF-8 でそのまま書き込む
+	UTF8
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case UTF16:
+		return "utf16"
+	case UTF8:
+		return "utf8"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int32(e))
+	}
+}
+
+func (e Encoding) valid() bool {
+	return e == UTF16 || e == UTF8
+}
+
+// ParseEncoding 符号化方式の名前 name を Encoding にする
+func ParseEncoding(name string) (Encoding, error) {
+	for _, e := range []Encoding{UTF16, UTF8} {
+		if strings.EqualFold(name, e.String()) {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown encoding %q", name)
+}
+
+// MaxLength VARCHAR(length) の列に確保するバイト数
+// UTF-16 の符号単位の数は UTF-8 のバイト数を超えないので、UTF-16 では 2 倍にし、UTF-8 で length バイトの文字列も必ず収まる
+func (e Encoding) MaxLength(length int32) int32 {
+	if e == UTF8 {
+		return Int32Bytes + length
+	}
+	return Int32Bytes + length*utf16Size
+}
+
+// StringBytes SetString で val を書き込むのに使うバイト数
+func (e Encoding) StringBytes(val string) int32 {
+	if e == UTF8 {
+		return Int32Bytes + int32(len(val))
+	}
+	return Int32Bytes + int32(len(utf16.Encode([]rune(val))))*utf16Size
+}
+
 func NewPage(blockSize int32) *Page {
 	return &Page{
 		buffer: make([]byte, blockSize),
@@ -45,6 +101,18 @@ func NewPageWith(buffer []byte) *Page {
 	}
 }
 
+// NewPageWithEncoding 文字列を encoding で読み書きするページ
+func NewPageWithEncoding(buffer []byte, encoding Encoding) *Page {
+	return &Page{
+		buffer:   buffer,
+		encoding: encoding,
+	}
+}
+
+func (p *Page) Encoding() Encoding {
+	return p.encoding
+}
+
 func (p *Page) GetInt(offset int32) int32 {
 	return int32(binary.LittleEndian.Uint32(p.buffer[offset : offset+Int32Bytes]))
 }
@@ -63,7 +131,21 @@ func (p *Page) SetBytes(offset int32, val []byte) {
 	copy(p.buffer[offset+Int32Bytes:], val)
 }
 
+// ReadBytes offset から length バイトをそのまま読む。返すスライスはページと領域を共有しない
+func (p *Page) ReadBytes(offset int32, length int32) []byte {
+	return slices.Clone(p.buffer[offset : offset+length])
+}
+
+// WriteBytes offset から val をそのまま書き込む。SetBytes と異なり長さは書き込まない
+func (p *Page) WriteBytes(offset int32, val []byte) {
+	copy(p.buffer[offset:], val)
+}
+
 func (p *Page) GetString(offset int32) string {
+	if p.encoding == UTF8 {
+		return string(p.GetBytes(offset))
+	}
+
 	length := p.GetInt(offset) / utf16Size
 
 	runes := make([]uint16, length)
@@ -75,6 +157,11 @@ func (p *Page) GetString(offset int32) string {
 }
 
 func (p *Page) SetString(offset int32, val string) {
+	if p.encoding == UTF8 {
+		p.SetBytes(offset, []byte(val))
+		return
+	}
+
 	runes := utf16.Encode([]rune(val))
 
 	p.SetInt(offset, int32(int32(len(runes))*utf16Size))
@@ -92,8 +179,76 @@ func (p *Page) setUint16(offset int32, val uint16) {
 	binary.LittleEndian.PutUint16(p.buffer[offset:offset+utf16Size], val)
 }
 
+// MaxLength UTF-16 のページに、UTF-8 で length バイトの文字列を書き込むのに必要なバイト数
 func MaxLength(length int32) int32 {
-	return Int32Bytes + length*utf16Size
+	return UTF16.MaxLength(length)
+}
+
+// StringBytes UTF-16 のページに SetString で val を書き込むのに使うバイト数
+func StringBytes(val string) int32 {
+	return UTF16.StringBytes(val)
+}
+
+// headerFile データベースの設定を記録するコントロールファイル
+//
+//	| encoding | blockSize | version |
+//
+// 版 1 のファイルは encoding しか持たず、ファイルのないデータベース (版 0) は UTF-16 で作られたものとして扱う
+const headerFile = "simpledb.header"
+
+// FormatVersion このパッケージが作るデータベースの形式の版。これより新しい版のデータベースは開けない
+//
+//   - 版 2: コントロールファイルにブロックの大きさと版を記録する
+//   - 版 3: レコードの empty/inuse フラグの上位ビットに、列ごとの NULL を記録する
+//     フラグが 0 か 1 しかない古い版のレコードはそのまま読めるが、NULL を知らないプログラムは NULL を持つレコードを読み飛ばしてしまう
+const FormatVersion int32 = 3
+
+// Control コントロールファイルに記録したデータベースの設定
+type Control struct {
+	Version  int32
+	Encoding Encoding
+	// BlockSize 版 2 より古いデータベースでは記録されておらず 0
+	BlockSize int32
+}
+
+// ReadControl ディレクトリ dbDir のデータベースのコントロールファイルを読む
+// コントロールファイルがなければ版 0 の設定を返す
+func ReadControl(dbDir string) (Control, error) {
+	headerPath := path.Join(dbDir, headerFile)
+	b, err := os.ReadFile(headerPath)
+	if os.IsNotExist(err) {
+		return Control{Encoding: UTF16}, nil
+	} else if err != nil {
+		return Control{}, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	page := NewPageWith(b)
+	var control Control
+	switch int32(len(b)) {
+	case Int32Bytes:
+		control = Control{Version: 1, Encoding: Encoding(page.GetInt(0))}
+	case 3 * Int32Bytes:
+		control = Control{Version: page.GetInt(2 * Int32Bytes), Encoding: Encoding(page.GetInt(0)), BlockSize: page.GetInt(Int32Bytes)}
+	default:
+		return Control{}, fmt.Errorf("broken header: %q", headerPath)
+	}
+	if control.Version > FormatVersion {
+		return Control{}, fmt.Errorf("database format version %d is newer than supported version %d", control.Version, FormatVersion)
+	}
+	if !control.Encoding.valid() {
+		return Control{}, fmt.Errorf("unknown encoding in header: %v", control.Encoding)
+	}
+	return control, nil
+}
+
+func writeControl(dbDir string, control Control) error {
+	page := NewPage(3 * Int32Bytes)
+	page.SetInt(0, int32(control.Encoding))
+	page.SetInt(Int32Bytes, control.BlockSize)
+	page.SetInt(2*Int32Bytes, control.Version)
+	if err := os.WriteFile(path.Join(dbDir, headerFile), page.buffer, 0o600); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+	return nil
 }
 
 type Manager struct {
@@ -101,12 +256,27 @@ type Manager struct {
 
 	dbDir     string
 	blockSize int32
+	encoding  Encoding
 	isNew     bool
 	files     map[string]*os.File
 	mux       *sync.Mutex
 }
 
 func NewManager(dbDir string, blockSize int32) (*Manager, error) {
+	return NewManagerWithEncoding(dbDir, blockSize, UTF16)
+}
+
+// NewManagerWithEncoding 新しいデータベースを文字列の符号化方式 encoding で作る
+// 既存のデータベースではヘッダに記録された符号化方式を使い、encoding は無視する
+// ヘッダに記録されたブロックの大きさが blockSize と異なれば、エラーを返す
+// 古い版のデータベースは、ブロックの大きさ blockSize と共にヘッダを FormatVersion の版に書き換える
+func NewManagerWithEncoding(dbDir string, blockSize int32, encoding Encoding) (*Manager, error) {
+	if !encoding.valid() {
+		return nil, fmt.Errorf("unknown encoding: %v", encoding)
+	}
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size: %d", blockSize)
+	}
 	isNew := false
 	// if not exists, create dbDir recursively
 	if _, err := os.Stat(dbDir); err != nil {
@@ -132,16 +302,38 @@ func NewManager(dbDir string, blockSize int32) (*Manager, error) {
 			continue
 		}
 
-		if err = os.Remove(file.Name()); err != nil {
+		if err = os.Remove(path.Join(dbDir, file.Name())); err != nil {
 			return nil, fmt.Errorf("os.Remove: %w", err)
 		}
 	}
 
+	if isNew {
+		if err := writeControl(dbDir, Control{Version: FormatVersion, Encoding: encoding, BlockSize: blockSize}); err != nil {
+			return nil, err
+		}
+	} else {
+		control, err := ReadControl(dbDir)
+		if err != nil {
+			return nil, err
+		}
+		if control.BlockSize != 0 && control.BlockSize != blockSize {
+			return nil, fmt.Errorf("block size %d does not match the database block size %d", blockSize, control.BlockSize)
+		}
+		encoding = control.Encoding
+		// 古い版のデータベースには新しい形式のレコードを書くので、古いプログラムが開かないように版を上げる
+		if control.Version < FormatVersion {
+			if err := writeControl(dbDir, Control{Version: FormatVersion, Encoding: encoding, BlockSize: blockSize}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return &Manager{
 		logger: logger.New("file.Manager", logger.Info),
 
 		dbDir:     dbDir,
 		blockSize: blockSize,
+		encoding:  encoding,
 		isNew:     isNew,
 		files:     make(map[string]*os.File),
 		mux:       &sync.Mutex{},
@@ -156,6 +348,16 @@ func (fm *Manager) BlockSize() int32 {
 	return fm.blockSize
 }
 
+// Encoding データベースの文字列の符号化方式
+func (fm *Manager) Encoding() Encoding {
+	return fm.encoding
+}
+
+// NewPage ブロックを読み込むための、データベースの符号化方式のページ
+func (fm *Manager) NewPage() *Page {
+	return NewPageWithEncoding(make([]byte, fm.blockSize), fm.encoding)
+}
+
 func (fm *Manager) Read(blk BlockID, p *Page) error {
 	fm.mux.Lock()
 	defer fm.mux.Unlock()
@@ -210,9 +412,9 @@ func (fm *Manager) Append(filename string) (BlockID, error) {
 
 	fm.logger.Tracef("(%q) Append", filename)
 
-	newBlockNum, err := fm.Length(filename)
+	newBlockNum, err := fm.length(filename)
 	if err != nil {
-		return BlockID{}, fmt.Errorf("fm.Length: %w", err)
+		return BlockID{}, fmt.Errorf("fm.length: %w", err)
 	}
 
 	blk := NewBlockID(filename, newBlockNum)
@@ -236,6 +438,13 @@ func (fm *Manager) Append(filename string) (BlockID, error) {
 }
 
 func (fm *Manager) Length(filename string) (int32, error) {
+	fm.mux.Lock()
+	defer fm.mux.Unlock()
+
+	return fm.length(filename)
+}
+
+func (fm *Manager) length(filename string) (int32, error) {
 	fm.logger.Tracef("(%q) Length(%q)", filename, path.Join(fm.dbDir, filename))
 	f, err := fm.openFile(filename)
 	if err != nil {
@@ -251,6 +460,47 @@ func (fm *Manager) Length(filename string) (int32, error) {
 	return length, nil
 }
 
+// Truncate ファイルを先頭の numBlocks 個のブロックだけにする。ファイルがそれより短ければ何もしない
+func (fm *Manager) Truncate(filename string, numBlocks int32) error {
+	fm.mux.Lock()
+	defer fm.mux.Unlock()
+
+	fm.logger.Tracef("(%q) Truncate(%d)", filename, numBlocks)
+	length, err := fm.length(filename)
+	if err != nil {
+		return fmt.Errorf("fm.length: %w", err)
+	}
+	if numBlocks >= length {
+		return nil
+	}
+	f, err := fm.openFile(filename)
+	if err != nil {
+		return fmt.Errorf("fm.openFile: %w", err)
+	}
+	if err := f.Truncate(int64(numBlocks) * int64(fm.blockSize)); err != nil {
+		return fmt.Errorf("f.Truncate: %w", err)
+	}
+	return nil
+}
+
+// Remove ファイルを閉じて削除する。ファイルが存在しなくてもエラーにはしない
+func (fm *Manager) Remove(filename string) error {
+	fm.mux.Lock()
+	defer fm.mux.Unlock()
+
+	fm.logger.Tracef("(%q) Remove", filename)
+	if f, ok := fm.files[filename]; ok {
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("f.Close: %w", err)
+		}
+		delete(fm.files, filename)
+	}
+	if err := os.Remove(path.Join(fm.dbDir, filename)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("os.Remove: %w", err)
+	}
+	return nil
+}
+
 func (fm *Manager) openFile(filename string) (*os.File, error) {
 	if f, ok := fm.files[filename]; ok {
 		return f, nil
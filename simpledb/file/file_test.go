@@ -1,6 +1,7 @@
 package file_test
 
 import (
+	"os"
 	"path"
 	"testing"
 
@@ -47,3 +48,200 @@ func TestFile(t *testing.T) {
 		t.Errorf("expected %q, got %q", strVal, p2.GetString(pos1))
 	}
 }
+
+func TestFileEncoding(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "encodingtest")
+	fm, err := file.NewManagerWithEncoding(dbDir, 400, file.UTF8)
+	if err != nil {
+		t.Fatalf("NewManagerWithEncoding: %v", err)
+	}
+	if fm.Encoding() != file.UTF8 {
+		t.Errorf("expected %v, got %v", file.UTF8, fm.Encoding())
+	}
+
+	// UTF-8 では VARCHAR(n) の文字列が n バイトに収まる
+	p1 := fm.NewPage()
+	var pos1 int32 = 88
+	strVal := "abcdé日本"
+	p1.SetString(pos1, strVal)
+	size := fm.Encoding().MaxLength(int32(len(strVal)))
+	if size != file.Int32Bytes+int32(len(strVal)) || size != fm.Encoding().StringBytes(strVal) {
+		t.Errorf("unexpected size %d", size)
+	}
+	pos2 := pos1 + size
+	intVar := int32(345)
+	p1.SetInt(pos2, intVar)
+
+	blk := file.NewBlockID("testfile", 0)
+	if err := fm.Write(blk, p1); err != nil {
+		t.Fatalf("fm.Write: %v", err)
+	}
+
+	// 既存のデータベースではヘッダに記録された符号化方式を使う
+	fm2, err := file.NewManagerWithEncoding(dbDir, 400, file.UTF16)
+	if err != nil {
+		t.Fatalf("NewManagerWithEncoding: %v", err)
+	}
+	if fm2.Encoding() != file.UTF8 {
+		t.Errorf("expected %v, got %v", file.UTF8, fm2.Encoding())
+	}
+	p2 := fm2.NewPage()
+	if err := fm2.Read(blk, p2); err != nil {
+		t.Fatalf("fm.Read: %v", err)
+	}
+	if p2.GetInt(pos2) != intVar {
+		t.Errorf("expected %d, got %d", intVar, p2.GetInt(pos2))
+	}
+	if p2.GetString(pos1) != strVal {
+		t.Errorf("expected %q, got %q", strVal, p2.GetString(pos1))
+	}
+
+	// ヘッダのない古いデータベースは UTF-16
+	oldDir := path.Join(t.TempDir(), "olddb")
+	if err := os.MkdirAll(oldDir, 0o700); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	fm3, err := file.NewManagerWithEncoding(oldDir, 400, file.UTF8)
+	if err != nil {
+		t.Fatalf("NewManagerWithEncoding: %v", err)
+	}
+	if fm3.Encoding() != file.UTF16 {
+		t.Errorf("expected %v, got %v", file.UTF16, fm3.Encoding())
+	}
+
+	if e, err := file.ParseEncoding("UTF8"); err != nil || e != file.UTF8 {
+		t.Errorf("ParseEncoding: %v, %v", e, err)
+	}
+	if _, err := file.ParseEncoding("latin1"); err == nil {
+		t.Errorf("ParseEncoding: expected error")
+	}
+}
+
+func TestFileControl(t *testing.T) {
+	t.Parallel()
+
+	// 新しいデータベースはブロックの大きさ、符号化方式、版を記録する
+	dbDir := path.Join(t.TempDir(), "controltest")
+	if _, err := file.NewManagerWithEncoding(dbDir, 512, file.UTF8); err != nil {
+		t.Fatalf("NewManagerWithEncoding: %v", err)
+	}
+	control, err := file.ReadControl(dbDir)
+	if err != nil {
+		t.Fatalf("ReadControl: %v", err)
+	}
+	if want := (file.Control{Version: file.FormatVersion, Encoding: file.UTF8, BlockSize: 512}); control != want {
+		t.Errorf("expected %+v, got %+v", want, control)
+	}
+	if _, err := file.NewManager(dbDir, 400); err == nil {
+		t.Errorf("NewManager: expected error for a different block size")
+	}
+	if fm, err := file.NewManager(dbDir, 512); err != nil || fm.Encoding() != file.UTF8 {
+		t.Errorf("NewManager: %v, %v", fm, err)
+	}
+
+	// 版 1 のヘッダはブロックの大きさを記録していないので、どの大きさでも開ける
+	oldDir := path.Join(t.TempDir(), "v1db")
+	if err := os.MkdirAll(oldDir, 0o700); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	header := file.NewPage(file.Int32Bytes)
+	header.SetInt(0, int32(file.UTF8))
+	if err := os.WriteFile(path.Join(oldDir, "simpledb.header"), header.ReadBytes(0, file.Int32Bytes), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	control, err = file.ReadControl(oldDir)
+	if err != nil {
+		t.Fatalf("ReadControl: %v", err)
+	}
+	if want := (file.Control{Version: 1, Encoding: file.UTF8}); control != want {
+		t.Errorf("expected %+v, got %+v", want, control)
+	}
+	if fm, err := file.NewManager(oldDir, 1024); err != nil || fm.Encoding() != file.UTF8 {
+		t.Errorf("NewManager: %v, %v", fm, err)
+	}
+	// 開いた古い版のデータベースは、古いプログラムが開かないように今の版に上げる
+	control, err = file.ReadControl(oldDir)
+	if err != nil {
+		t.Fatalf("ReadControl: %v", err)
+	}
+	if want := (file.Control{Version: file.FormatVersion, Encoding: file.UTF8, BlockSize: 1024}); control != want {
+		t.Errorf("expected %+v, got %+v", want, control)
+	}
+	if _, err := file.NewManager(oldDir, 400); err == nil {
+		t.Errorf("NewManager: expected error for a different block size after upgrade")
+	}
+
+	// 版 2 のデータベースも今の版に上げる
+	v2Dir := path.Join(t.TempDir(), "v2db")
+	if err := os.MkdirAll(v2Dir, 0o700); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	header = file.NewPage(3 * file.Int32Bytes)
+	header.SetInt(0, int32(file.UTF16))
+	header.SetInt(file.Int32Bytes, 400)
+	header.SetInt(2*file.Int32Bytes, 2)
+	if err := os.WriteFile(path.Join(v2Dir, "simpledb.header"), header.ReadBytes(0, 3*file.Int32Bytes), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if _, err := file.NewManager(v2Dir, 400); err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	control, err = file.ReadControl(v2Dir)
+	if err != nil {
+		t.Fatalf("ReadControl: %v", err)
+	}
+	if want := (file.Control{Version: file.FormatVersion, Encoding: file.UTF16, BlockSize: 400}); control != want {
+		t.Errorf("expected %+v, got %+v", want, control)
+	}
+
+	// 新しい版のデータベースは開けない
+	newDir := path.Join(t.TempDir(), "v99db")
+	if err := os.MkdirAll(newDir, 0o700); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	header = file.NewPage(3 * file.Int32Bytes)
+	header.SetInt(file.Int32Bytes, 400)
+	header.SetInt(2*file.Int32Bytes, 99)
+	if err := os.WriteFile(path.Join(newDir, "simpledb.header"), header.ReadBytes(0, 3*file.Int32Bytes), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if _, err := file.NewManager(newDir, 400); err == nil {
+		t.Errorf("NewManager: expected error for version 99")
+	}
+}
+
+func TestFileTruncate(t *testing.T) {
+	t.Parallel()
+
+	fm, err := file.NewManager(path.Join(t.TempDir(), "truncatetest"), 400)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := fm.Append("testfile"); err != nil {
+			t.Fatalf("fm.Append: %v", err)
+		}
+	}
+	if err := fm.Truncate("testfile", 2); err != nil {
+		t.Fatalf("fm.Truncate: %v", err)
+	}
+	if n, err := fm.Length("testfile"); err != nil || n != 2 {
+		t.Errorf("expected 2 blocks, got %d (%v)", n, err)
+	}
+	// ファイルより長くは伸ばさない
+	if err := fm.Truncate("testfile", 10); err != nil {
+		t.Fatalf("fm.Truncate: %v", err)
+	}
+	if n, err := fm.Length("testfile"); err != nil || n != 2 {
+		t.Errorf("expected 2 blocks, got %d (%v)", n, err)
+	}
+	blk, err := fm.Append("testfile")
+	if err != nil {
+		t.Fatalf("fm.Append: %v", err)
+	}
+	if blk.Number != 2 {
+		t.Errorf("expected block 2, got %d", blk.Number)
+	}
+}
@@ -2,7 +2,10 @@ module simpledb
 
 go 1.22.3
 
-require github.com/stretchr/testify v1.9.0
+require (
+	github.com/lib/pq v1.10.9
+	github.com/stretchr/testify v1.9.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,288 @@
+package btree
+
+import (
+	"fmt"
+	"simpledb/file"
+	"simpledb/index"
+	"simpledb/query"
+)
+
+// DefaultFillFactor 充填率を指定せずに索引を作る時に、葉とディレクトリに詰めるレコードの割合 (%)
+const DefaultFillFactor int32 = 90
+
+// MinFillFactor 充填率の下限。根以外のノードは半分以上のレコードを持たなければならない
+const MinFillFactor int32 = 50
+
+// BulkLoad 空の索引に、src の全てのレコードをエントリとして加える
+// src は索引のレコードと同じ列を持ち、キーの昇順に並んでいなければならない
+// 1件ずつ挿入する代わりに、葉を左から順に fillFactor % まで詰めて作り、その上にディレクトリを1段ずつ積み上げる
+// 同じキーのレコードは1つの葉とそのオーバーフローブロックに置くので、葉には fillFactor を超えて詰めることがある
+func (bi *BTreeIndex) BulkLoad(src query.Scan, fillFactor int32) error {
+	if fillFactor < MinFillFactor || fillFactor > 100 {
+		return fmt.Errorf("fill factor %d is out of range [%d, 100]", fillFactor, MinFillFactor)
+	}
+	if err := bi.Close(); err != nil {
+		return err
+	}
+	root, err := NewBTreePage(bi.tx, bi.rootblk, bi.dirLayout)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	if err := bi.checkEmpty(root); err != nil {
+		return err
+	}
+	// ノードに2つ以上のレコードを置けなければ、ディレクトリの段を積んでもエントリが減らない
+	if err := CheckLayout(bi.tx, bi.leafLayout); err != nil {
+		return fmt.Errorf("index %s: %w", bi.leaftbl, err)
+	}
+
+	entries, err := bi.loadLeaves(src, fillFactor)
+	if err != nil {
+		return err
+	}
+	// 最も左の子は、どのキーよりも小さいキーで指す
+	entries[0] = NewDirEntry(minKey(bi.dirLayout.Schema()), entries[0].block)
+	var level int32
+	for int32(len(entries)) > root.maxRecs() {
+		if entries, err = loadDirs(root, entries, level, fillFactor); err != nil {
+			return err
+		}
+		level++
+	}
+
+	// 根はブロック 0 のまま、最上段のエントリで置き換える
+	if err := root.setNumRecs(0); err != nil {
+		return err
+	}
+	if err := root.SetFlag(level); err != nil {
+		return err
+	}
+	for slot, e := range entries {
+		if err := root.InsertDir(int32(slot), e.dataval, e.block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEmpty 索引が NewBTreeIndex で作ったままの、空の葉を1つだけ持つ状態か調べる
+func (bi *BTreeIndex) checkEmpty(root *BTreePage) error {
+	leaf, err := NewBTreePage(bi.tx, file.NewBlockID(bi.leaftbl, 0), bi.leafLayout)
+	if err != nil {
+		return err
+	}
+	defer leaf.Close()
+	leafRecs, err := leaf.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	leafFlag, err := leaf.GetFlag()
+	if err != nil {
+		return err
+	}
+	rootRecs, err := root.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	rootFlag, err := root.GetFlag()
+	if err != nil {
+		return err
+	}
+	if leafRecs > 0 || leafFlag >= 0 || rootRecs > 1 || rootFlag != 0 {
+		return fmt.Errorf("index %s is not empty", bi.leaftbl)
+	}
+	return nil
+}
+
+// fillTarget fillFactor % まで詰めた時のレコード数。根以外のノードが保つべき半分を下回らない
+// ディレクトリの段ごとにエントリが減るように、minRecsPerNode 個は詰める
+func fillTarget(page *BTreePage, fillFactor int32) int32 {
+	return max(page.maxRecs()*fillFactor/100, page.maxRecs()/2, minRecsPerNode)
+}
+
+// loadLeaves src のレコードを葉 0 から順に詰め、各葉の先頭のキーとブロック番号を左から順に返す
+func (bi *BTreeIndex) loadLeaves(src query.Scan, fillFactor int32) ([]*DirEntry, error) {
+	leaf, err := NewBTreePage(bi.tx, file.NewBlockID(bi.leaftbl, 0), bi.leafLayout)
+	if err != nil {
+		return nil, err
+	}
+	// overflow 最後の葉のオーバーフローブロックのうち、最後に作ったもの
+	var overflow *BTreePage
+	defer func() {
+		leaf.Close()
+		if overflow != nil {
+			overflow.Close()
+		}
+	}()
+	// newLeaf 最後の葉の右に新しい葉を作る。古い葉は呼び出し側で閉じる
+	newLeaf := func(entries []*DirEntry, key *query.Constant) (*BTreePage, []*DirEntry, error) {
+		page, err := leaf.newPage(-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, append(entries, NewDirEntry(key, page.currentBlockID.Number)), nil
+	}
+
+	keyFields := index.KeyFields(bi.leafLayout.Schema())
+	maxRecs := leaf.maxRecs()
+	target := fillTarget(leaf, fillFactor)
+	entries := []*DirEntry{NewDirEntry(nil, leaf.currentBlockID.Number)}
+	var firstKey, lastKey *query.Constant
+	for {
+		next, err := src.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			break
+		}
+		vals := make([]*query.Constant, len(keyFields))
+		for i, fieldName := range keyFields {
+			if vals[i], err = src.GetVal(fieldName); err != nil {
+				return nil, err
+			}
+		}
+		key := index.MakeKey(vals)
+		nRecs, err := leaf.GetNumRecs()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case overflow != nil && key.Equals(firstKey):
+			// 葉の先頭のキーと同じキーは、オーバーフローブロックに続ける
+			n, err := overflow.GetNumRecs()
+			if err != nil {
+				return nil, err
+			}
+			if n >= maxRecs {
+				page, err := overflow.newPage(-1)
+				if err != nil {
+					return nil, err
+				}
+				err = overflow.SetFlag(page.currentBlockID.Number)
+				overflow.Close()
+				overflow = page
+				if err != nil {
+					return nil, err
+				}
+			}
+			if err := overflow.appendRecord(src); err != nil {
+				return nil, err
+			}
+			continue
+		case nRecs == 0:
+			firstKey = key
+		case !key.Equals(lastKey):
+			if nRecs < target {
+				break
+			}
+			page, newEntries, err := newLeaf(entries, key)
+			if err != nil {
+				return nil, err
+			}
+			leaf.Close()
+			if overflow != nil {
+				overflow.Close()
+				overflow = nil
+			}
+			leaf, entries, firstKey = page, newEntries, key
+		case nRecs < maxRecs:
+		case key.Equals(firstKey):
+			// 葉が同じキーで満杯になれば、オーバーフローブロックを作る
+			if overflow, err = leaf.newPage(-1); err != nil {
+				return nil, err
+			}
+			if err := leaf.SetFlag(overflow.currentBlockID.Number); err != nil {
+				return nil, err
+			}
+			if err := overflow.appendRecord(src); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			// 同じキーのレコードを2つの葉に分けないように、このキーのレコードを新しい葉に移す
+			start := nRecs - 1
+			for ; start > 0; start-- {
+				val, err := leaf.GetDataVal(start - 1)
+				if err != nil {
+					return nil, err
+				}
+				if !val.Equals(key) {
+					break
+				}
+			}
+			page, newEntries, err := newLeaf(entries, key)
+			if err != nil {
+				return nil, err
+			}
+			err = leaf.moveRecs(start, nRecs, page, 0)
+			leaf.Close()
+			leaf, entries, firstKey = page, newEntries, key
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := leaf.appendRecord(src); err != nil {
+			return nil, err
+		}
+		lastKey = key
+	}
+
+	// 最後の葉が半分に満たなければ、左隣の葉と併合するか、左隣の葉からレコードを移す
+	if len(entries) == 1 || overflow != nil {
+		return entries, nil
+	}
+	if underfull, err := leaf.isUnderfull(); err != nil || !underfull {
+		return entries, err
+	}
+	last := len(entries) - 1
+	prev, err := NewBTreePage(bi.tx, file.NewBlockID(bi.leaftbl, entries[last-1].block), bi.leafLayout)
+	if err != nil {
+		return nil, err
+	}
+	defer prev.Close()
+	if merged, err := prev.mergeFrom(leaf, true); err != nil {
+		return nil, err
+	} else if merged {
+		return entries[:last], newFreeList(bi.tx, bi.leaftbl).push(entries[last].block)
+	}
+	key, err := prev.redistribute(leaf, true)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		entries[last] = NewDirEntry(key, entries[last].block)
+	}
+	return entries, nil
+}
+
+// loadDirs entries を指すディレクトリを階層 level に作り、各ディレクトリの先頭のキーとブロック番号を返す
+// ディレクトリの数は fillFactor % まで詰めた時の数にし、どのディレクトリもなるべく同じ数のエントリを持つように分ける
+func loadDirs(root *BTreePage, entries []*DirEntry, level int32, fillFactor int32) ([]*DirEntry, error) {
+	n := int32(len(entries))
+	maxRecs := root.maxRecs()
+	count := max(n/fillTarget(root, fillFactor), (n+maxRecs-1)/maxRecs)
+	parents := make([]*DirEntry, 0, count)
+	var start int32
+	for i := int32(1); i <= count; i++ {
+		end := n * i / count
+		page, err := root.newPage(level)
+		if err != nil {
+			return nil, err
+		}
+		for slot, e := range entries[start:end] {
+			if err = page.InsertDir(int32(slot), e.dataval, e.block); err != nil {
+				break
+			}
+		}
+		parents = append(parents, NewDirEntry(entries[start].dataval, page.currentBlockID.Number))
+		page.Close()
+		if err != nil {
+			return nil, err
+		}
+		start = end
+	}
+	return parents, nil
+}
@@ -0,0 +1,296 @@
+package btree
+
+import (
+	"fmt"
+	"simpledb/file"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+// Check 索引の木構造の不変条件を検査し、最初に見つかった違反をエラーとして返す
+//
+//   - キーの順序: ノードのキーが整列し、親のエントリが定める範囲に収まる。オーバーフローブロックのキーは葉の先頭のキーと等しい
+//   - 充填率: どのノードも満杯でない。根以外のディレクトリは半分以上のエントリを持ち、根以外の葉とオーバーフローブロックは空でない
+//     重複するキーがなければ、根以外の葉も半分以上のレコードを持つ (重複するキーは同じ葉に置くため、葉を均等に分けられないことがある)
+//   - 親子の整合: ディレクトリの階層が子に向かって 1 ずつ減る。根以外のディレクトリの先頭のキーは親のエントリのキーと等しい
+//     どのブロックも木の中で1回だけ参照され、空きブロックのリストに含まれない
+func (bi *BTreeIndex) Check() error {
+	if err := bi.Close(); err != nil {
+		return err
+	}
+	c := &checker{
+		tx:         bi.tx,
+		dirLayout:  bi.dirLayout,
+		leafLayout: bi.leafLayout,
+		leafFile:   bi.leaftbl,
+		visited:    make(map[file.BlockID]bool),
+	}
+	if err := c.checkDir(bi.rootblk, -1, nil, nil); err != nil {
+		return err
+	}
+	if !c.hasDuplicates && len(c.underfull) > 0 {
+		return fmt.Errorf("leaf %d has fewer than half of %d records", c.underfull[0].Number, c.maxLeafRecs)
+	}
+	for _, filename := range []string{bi.rootblk.FileName, bi.leaftbl} {
+		blocks, err := newFreeList(bi.tx, filename).blocks()
+		if err != nil {
+			return err
+		}
+		size, err := bi.tx.Size(filename)
+		if err != nil {
+			return err
+		}
+		free := make(map[int32]bool)
+		for _, blockNum := range blocks {
+			switch {
+			case blockNum < 0 || blockNum >= size:
+				return fmt.Errorf("free block %d is outside %s", blockNum, filename)
+			case free[blockNum]:
+				return fmt.Errorf("free block %d of %s is listed twice", blockNum, filename)
+			case c.visited[file.NewBlockID(filename, blockNum)]:
+				return fmt.Errorf("free block %d of %s is in the tree", blockNum, filename)
+			}
+			free[blockNum] = true
+		}
+	}
+	return nil
+}
+
+type checker struct {
+	tx         *tx.Transaction
+	dirLayout  *record.Layout
+	leafLayout *record.Layout
+	leafFile   string
+	visited    map[file.BlockID]bool
+	// onlyLeaf 根が1つの葉しか指さない
+	onlyLeaf bool
+	// lastKey 葉を順に辿って最後に見たキー
+	lastKey       *query.Constant
+	hasDuplicates bool
+	underfull     []file.BlockID
+	maxLeafRecs   int32
+}
+
+// visit ブロックを辿ったことを記録する。2回目ならエラーを返す
+func (c *checker) visit(blk file.BlockID) error {
+	if c.visited[blk] {
+		return fmt.Errorf("block %d of %s is referenced twice", blk.Number, blk.FileName)
+	}
+	size, err := c.tx.Size(blk.FileName)
+	if err != nil {
+		return err
+	}
+	if blk.Number >= size {
+		return fmt.Errorf("block %d is outside %s", blk.Number, blk.FileName)
+	}
+	c.visited[blk] = true
+	return nil
+}
+
+// checkKey key が [lower, upper) に収まるか。nil の境界は検査しない
+func checkKey(key, lower, upper *query.Constant) (bool, error) {
+	if lower != nil {
+		if cmp, err := key.CompareTo(lower); err != nil || cmp < 0 {
+			return false, err
+		}
+	}
+	if upper != nil {
+		if cmp, err := key.CompareTo(upper); err != nil || cmp >= 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// checkDir ディレクトリ blk を検査する。level は期待する階層で、根では -1
+func (c *checker) checkDir(blk file.BlockID, level int32, lower, upper *query.Constant) error {
+	if err := c.visit(blk); err != nil {
+		return err
+	}
+	page, err := NewBTreePage(c.tx, blk, c.dirLayout)
+	if err != nil {
+		return err
+	}
+	defer page.Close()
+	isRoot := level < 0
+	flag, err := page.GetFlag()
+	if err != nil {
+		return err
+	}
+	nRecs, err := page.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	switch {
+	case flag < 0 || (!isRoot && flag != level):
+		return fmt.Errorf("directory %d has level %d, want %d", blk.Number, flag, level)
+	case nRecs == 0:
+		return fmt.Errorf("directory %d is empty", blk.Number)
+	case nRecs > page.maxRecs():
+		return fmt.Errorf("directory %d has %d entries, more than %d", blk.Number, nRecs, page.maxRecs())
+	case !isRoot && nRecs < page.maxRecs()/2:
+		return fmt.Errorf("directory %d has %d entries, fewer than half of %d", blk.Number, nRecs, page.maxRecs())
+	}
+	if isRoot {
+		c.onlyLeaf = flag == 0 && nRecs == 1
+	}
+
+	keys := make([]*query.Constant, nRecs)
+	for slot := range nRecs {
+		key, err := page.GetDataVal(slot)
+		if err != nil {
+			return err
+		}
+		if ok, err := checkKey(key, lower, upper); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("directory %d: key %s is out of the range of its parent entry", blk.Number, key)
+		}
+		if slot > 0 {
+			if cmp, err := keys[slot-1].CompareTo(key); err != nil {
+				return err
+			} else if cmp >= 0 {
+				return fmt.Errorf("directory %d: key %s is not greater than %s", blk.Number, key, keys[slot-1])
+			}
+		}
+		keys[slot] = key
+	}
+	if !isRoot && lower != nil && !keys[0].Equals(lower) {
+		return fmt.Errorf("directory %d starts with %s, but its parent entry has %s", blk.Number, keys[0], lower)
+	}
+
+	for slot := range nRecs {
+		childNum, err := page.GetChildNum(slot)
+		if err != nil {
+			return err
+		}
+		// 最も左の子は最初のキーより小さい NULL なども含むので、親の下限を引き継ぐ
+		childLower := lower
+		if slot > 0 {
+			childLower = keys[slot]
+		}
+		childUpper := upper
+		if slot+1 < nRecs {
+			childUpper = keys[slot+1]
+		}
+		if flag == 0 {
+			err = c.checkLeaf(file.NewBlockID(c.leafFile, childNum), childLower, childUpper)
+		} else {
+			err = c.checkDir(file.NewBlockID(blk.FileName, childNum), flag-1, childLower, childUpper)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLeaf 葉 blk とそのオーバーフローブロックを検査する
+func (c *checker) checkLeaf(blk file.BlockID, lower, upper *query.Constant) error {
+	if err := c.visit(blk); err != nil {
+		return err
+	}
+	page, err := NewBTreePage(c.tx, blk, c.leafLayout)
+	if err != nil {
+		return err
+	}
+	defer page.Close()
+	flag, err := page.GetFlag()
+	if err != nil {
+		return err
+	}
+	nRecs, err := page.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	c.maxLeafRecs = page.maxRecs()
+	switch {
+	case nRecs > page.maxRecs():
+		return fmt.Errorf("leaf %d has %d records, more than %d", blk.Number, nRecs, page.maxRecs())
+	case nRecs == 0 && (!c.onlyLeaf || flag >= 0):
+		return fmt.Errorf("leaf %d is empty", blk.Number)
+	case !c.onlyLeaf && nRecs < page.maxRecs()/2:
+		c.underfull = append(c.underfull, blk)
+	}
+
+	var first *query.Constant
+	for slot := range nRecs {
+		key, err := page.GetDataVal(slot)
+		if err != nil {
+			return err
+		}
+		if ok, err := checkKey(key, lower, upper); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("leaf %d: key %s is out of the range of its parent entry", blk.Number, key)
+		}
+		if err := c.nextKey(blk, key); err != nil {
+			return err
+		}
+		if slot == 0 {
+			first = key
+		}
+	}
+
+	for flag >= 0 {
+		c.hasDuplicates = true
+		overflowBlk := file.NewBlockID(blk.FileName, flag)
+		if err := c.visit(overflowBlk); err != nil {
+			return err
+		}
+		overflow, err := NewBTreePage(c.tx, overflowBlk, c.leafLayout)
+		if err != nil {
+			return err
+		}
+		flag, err = c.checkOverflow(overflow, blk, first)
+		overflow.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOverflow 葉 leafBlk のオーバーフローブロック page を検査し、連鎖の次のブロックを返す
+func (c *checker) checkOverflow(page *BTreePage, leafBlk file.BlockID, first *query.Constant) (int32, error) {
+	nRecs, err := page.GetNumRecs()
+	if err != nil {
+		return 0, err
+	}
+	blockNum := page.currentBlockID.Number
+	if nRecs == 0 {
+		return 0, fmt.Errorf("overflow block %d of leaf %d is empty", blockNum, leafBlk.Number)
+	}
+	if nRecs > page.maxRecs() {
+		return 0, fmt.Errorf("overflow block %d has %d records, more than %d", blockNum, nRecs, page.maxRecs())
+	}
+	for slot := range nRecs {
+		key, err := page.GetDataVal(slot)
+		if err != nil {
+			return 0, err
+		}
+		if !key.Equals(first) {
+			return 0, fmt.Errorf("overflow block %d of leaf %d has key %s, want %s", blockNum, leafBlk.Number, key, first)
+		}
+	}
+	return page.GetFlag()
+}
+
+// nextKey 葉を順に辿って見つけたキーが、直前のキー以上であることを確かめる
+func (c *checker) nextKey(blk file.BlockID, key *query.Constant) error {
+	if c.lastKey != nil {
+		cmp, err := c.lastKey.CompareTo(key)
+		if err != nil {
+			return err
+		}
+		if cmp > 0 {
+			return fmt.Errorf("leaf %d: key %s is less than the previous key %s", blk.Number, key, c.lastKey)
+		}
+		if cmp == 0 {
+			c.hasDuplicates = true
+		}
+	}
+	c.lastKey = key
+	return nil
+}
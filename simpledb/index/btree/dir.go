@@ -31,33 +31,40 @@ func (bd *BTreeDir) Close() error {
 	return bd.contents.Close()
 }
 
-func (bd *BTreeDir) Search(searchKey *query.Constant) (int32, error) {
-	childBlk, err := bd.findChildBlock(searchKey)
+// Search searchKey を含みうる葉のブロック番号を返す
+// upperBound はその葉より後ろの葉に含まれるキーの下限で、最も右の葉であれば nil になる
+func (bd *BTreeDir) Search(searchKey *query.Constant) (blkNum int32, upperBound *query.Constant, err error) {
+	childBlk, upperBound, err := bd.findChildBlock(searchKey)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	for {
 		flag, err := bd.contents.GetFlag()
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		if flag <= 0 {
 			break
 		}
 		if err := bd.contents.Close(); err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		bp, err := NewBTreePage(bd.tx, childBlk, bd.layout)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		bd.contents = bp
-		childBlk, err = bd.findChildBlock(searchKey)
+		var bound *query.Constant
+		childBlk, bound, err = bd.findChildBlock(searchKey)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
+		}
+		// 下の階層ほど範囲が狭いので、見つかった上限で置き換える
+		if bound != nil {
+			upperBound = bound
 		}
 	}
-	return childBlk.Number, nil
+	return childBlk.Number, upperBound, nil
 }
 
 func (bd *BTreeDir) MakeNewRoot(e *DirEntry) error {
@@ -94,7 +101,7 @@ func (bd *BTreeDir) Insert(e *DirEntry) (*DirEntry, error) {
 	if flag == 0 {
 		return bd.InsertEntry(e)
 	}
-	childBlk, err := bd.findChildBlock(e.dataval)
+	childBlk, _, err := bd.findChildBlock(e.dataval)
 	if err != nil {
 		return nil, err
 	}
@@ -149,22 +156,199 @@ func (bd *BTreeDir) InsertEntry(e *DirEntry) (*DirEntry, error) {
 	return NewDirEntry(splitVal, newBlk.Number), nil
 }
 
-func (bd *BTreeDir) findChildBlock(searchKey *query.Constant) (file.BlockID, error) {
-	slot, err := bd.contents.FindSlotBefore(searchKey)
+// Delete searchKey と dataRID のエントリを葉から削除する
+// 子が根以外のノードが保つべき半分のレコード数を下回れば、隣の子と併合するかレコードを再分配し、このノードが下回ったかを返す
+func (bd *BTreeDir) Delete(searchKey *query.Constant, dataRID *record.RID, leafFile string, leafLayout *record.Layout) (bool, error) {
+	flag, err := bd.contents.GetFlag()
+	if err != nil {
+		return false, err
+	}
+	slot, err := bd.findChildSlot(searchKey)
+	if err != nil {
+		return false, err
+	}
+	childNum, err := bd.contents.GetChildNum(slot)
+	if err != nil {
+		return false, err
+	}
+
+	var underfull bool
+	if flag == 0 {
+		leaf, err := NewBTreeLeaf(bd.tx, file.NewBlockID(leafFile, childNum), leafLayout, searchKey)
+		if err != nil {
+			return false, err
+		}
+		underfull, err = leaf.Delete(dataRID)
+		leaf.Close()
+		if err != nil {
+			return false, err
+		}
+		if underfull {
+			err = bd.rebalance(slot, leafFile, leafLayout, true)
+		}
+	} else {
+		child, err := NewBTreeDir(bd.tx, file.NewBlockID(bd.filename, childNum), bd.layout)
+		if err != nil {
+			return false, err
+		}
+		underfull, err = child.Delete(searchKey, dataRID, leafFile, leafLayout)
+		child.Close()
+		if err != nil {
+			return false, err
+		}
+		if underfull {
+			err = bd.rebalance(slot, bd.filename, bd.layout, false)
+		}
+	}
+	if err != nil || !underfull {
+		return false, err
+	}
+	return bd.contents.isUnderfull()
+}
+
+// rebalance スロット slot の子を、右隣 (最後の子なら左隣) の子と併合する。併合できなければレコードを再分配する
+// 併合した右の子のブロックは空きブロックのリストに戻し、そのエントリを取り除く
+func (bd *BTreeDir) rebalance(slot int32, filename string, layout *record.Layout, leaf bool) error {
+	nRecs, err := bd.contents.GetNumRecs()
+	if err != nil || nRecs < 2 {
+		return err
+	}
+	left := slot
+	if left+1 == nRecs {
+		left--
+	}
+	right := left + 1
+	leftNum, err := bd.contents.GetChildNum(left)
+	if err != nil {
+		return err
+	}
+	rightNum, err := bd.contents.GetChildNum(right)
+	if err != nil {
+		return err
+	}
+	leftPage, err := NewBTreePage(bd.tx, file.NewBlockID(filename, leftNum), layout)
+	if err != nil {
+		return err
+	}
+	defer leftPage.Close()
+	rightPage, err := NewBTreePage(bd.tx, file.NewBlockID(filename, rightNum), layout)
+	if err != nil {
+		return err
+	}
+	defer rightPage.Close()
+
+	merged, err := leftPage.mergeFrom(rightPage, leaf)
 	if err != nil {
-		return file.BlockID{}, err
+		return err
+	}
+	if merged {
+		if err := rightPage.Close(); err != nil {
+			return err
+		}
+		if err := newFreeList(bd.tx, filename).push(rightNum); err != nil {
+			return err
+		}
+		return bd.contents.Delete(right)
+	}
+	separator, err := leftPage.redistribute(rightPage, leaf)
+	if err != nil || separator == nil {
+		return err
 	}
-	val, err := bd.contents.GetDataVal(slot + 1)
+	return bd.contents.setDataVal(right, separator)
+}
+
+// CollapseRoot 根が子を1つしか持たないディレクトリなら、子の内容を根に移して木を1段低くする
+// 根は常にブロック 0 に置くので、子のブロックを空きブロックのリストに戻す
+func (bd *BTreeDir) CollapseRoot() error {
+	for {
+		flag, err := bd.contents.GetFlag()
+		if err != nil {
+			return err
+		}
+		nRecs, err := bd.contents.GetNumRecs()
+		if err != nil {
+			return err
+		}
+		if flag == 0 || nRecs != 1 {
+			return nil
+		}
+		childNum, err := bd.contents.GetChildNum(0)
+		if err != nil {
+			return err
+		}
+		child, err := NewBTreePage(bd.tx, file.NewBlockID(bd.filename, childNum), bd.layout)
+		if err != nil {
+			return err
+		}
+		// 最も左の子の先頭のキーは根の先頭のキー (最小値) と同じなので、そのまま根の先頭になる
+		err = bd.contents.Delete(0)
+		if err == nil {
+			var childRecs int32
+			if childRecs, err = child.GetNumRecs(); err == nil {
+				err = child.moveRecs(0, childRecs, bd.contents, 0)
+			}
+		}
+		if err == nil {
+			var childFlag int32
+			if childFlag, err = child.GetFlag(); err == nil {
+				err = bd.contents.SetFlag(childFlag)
+			}
+		}
+		child.Close()
+		if err != nil {
+			return err
+		}
+		if err := newFreeList(bd.tx, bd.filename).push(childNum); err != nil {
+			return err
+		}
+	}
+}
+
+// findChildBlock searchKey を含みうる子のブロックと、その右隣の子の先頭のキーを返す
+func (bd *BTreeDir) findChildBlock(searchKey *query.Constant) (file.BlockID, *query.Constant, error) {
+	slot, err := bd.findChildSlot(searchKey)
 	if err != nil {
-		return file.BlockID{}, err
+		return file.BlockID{}, nil, err
 	}
-	if val.Equals(searchKey) {
-		slot++
+	nRecs, err := bd.contents.GetNumRecs()
+	if err != nil {
+		return file.BlockID{}, nil, err
 	}
 	blkNum, err := bd.contents.GetChildNum(slot)
 	if err != nil {
-		return file.BlockID{}, err
+		return file.BlockID{}, nil, err
+	}
+
+	var upperBound *query.Constant
+	if slot+1 < nRecs {
+		upperBound, err = bd.contents.GetDataVal(slot + 1)
+		if err != nil {
+			return file.BlockID{}, nil, err
+		}
 	}
+	return file.NewBlockID(bd.filename, blkNum), upperBound, nil
+}
 
-	return file.NewBlockID(bd.filename, blkNum), nil
+// findChildSlot searchKey を含みうる子のエントリのスロット
+func (bd *BTreeDir) findChildSlot(searchKey *query.Constant) (int32, error) {
+	slot, err := bd.contents.FindSlotBefore(searchKey)
+	if err != nil {
+		return 0, err
+	}
+	// 最初のエントリ (最小値) よりも小さい NULL などのキーは、最も左の子に含まれる
+	slot = max(slot, 0)
+	nRecs, err := bd.contents.GetNumRecs()
+	if err != nil {
+		return 0, err
+	}
+	if slot+1 < nRecs {
+		val, err := bd.contents.GetDataVal(slot + 1)
+		if err != nil {
+			return 0, err
+		}
+		if val.Equals(searchKey) {
+			slot++
+		}
+	}
+	return slot, nil
 }
@@ -0,0 +1,163 @@
+package btree
+
+import (
+	"simpledb/file"
+	"simpledb/tx"
+)
+
+// freeList 索引のファイル (葉かディレクトリ) の空きブロックのリスト
+// リストの先頭はファイル名に ".free" を付けたファイルの先頭の int に、ブロック番号 + 1 で格納する (0 ならリストは空)
+// 空きブロックは先頭の int (flag の位置) に次の空きブロックを同じ形式で格納し、レコード数を 0 にする
+// リストのファイルがなければリストは空として扱うので、リストのない索引もそのまま使える
+type freeList struct {
+	tx       *tx.Transaction
+	filename string
+}
+
+// freeListFile 索引のファイル filename の空きブロックのリストの先頭を格納するファイル
+func freeListFile(filename string) string {
+	return filename + ".free"
+}
+
+func newFreeList(tx *tx.Transaction, filename string) *freeList {
+	return &freeList{tx: tx, filename: filename}
+}
+
+// push ブロック blockNum をリストの先頭に加える
+func (fl *freeList) push(blockNum int32) error {
+	header, err := fl.header(true)
+	if err != nil {
+		return err
+	}
+	if err := fl.tx.Pin(header); err != nil {
+		return err
+	}
+	defer fl.tx.Unpin(header)
+	head, err := fl.tx.GetInt(header, 0)
+	if err != nil {
+		return err
+	}
+
+	blk := file.NewBlockID(fl.filename, blockNum)
+	if err := fl.tx.Pin(blk); err != nil {
+		return err
+	}
+	defer fl.tx.Unpin(blk)
+	if err := fl.tx.SetInt(blk, 0, head, true); err != nil {
+		return err
+	}
+	if err := fl.tx.SetInt(blk, file.Int32Bytes, 0, true); err != nil {
+		return err
+	}
+	return fl.tx.SetInt(header, 0, blockNum+1, true)
+}
+
+// pop リストの先頭のブロックを取り出す。リストが空なら -1 を返す
+func (fl *freeList) pop() (int32, error) {
+	header, err := fl.header(false)
+	if err != nil || header.Number < 0 {
+		return -1, err
+	}
+	if err := fl.tx.Pin(header); err != nil {
+		return -1, err
+	}
+	defer fl.tx.Unpin(header)
+	head, err := fl.tx.GetInt(header, 0)
+	if err != nil || head == 0 {
+		return -1, err
+	}
+
+	blk := file.NewBlockID(fl.filename, head-1)
+	if err := fl.tx.Pin(blk); err != nil {
+		return -1, err
+	}
+	next, err := fl.tx.GetInt(blk, 0)
+	fl.tx.Unpin(blk)
+	if err != nil {
+		return -1, err
+	}
+	return blk.Number, fl.tx.SetInt(header, 0, next, true)
+}
+
+// reset リストをファイルのブロック 0 以外の全てのブロックにする。番号の小さいブロックから取り出される
+func (fl *freeList) reset() error {
+	header, err := fl.header(false)
+	if err != nil {
+		return err
+	}
+	if header.Number >= 0 {
+		if err := fl.tx.Pin(header); err != nil {
+			return err
+		}
+		err := fl.tx.SetInt(header, 0, 0, true)
+		fl.tx.Unpin(header)
+		if err != nil {
+			return err
+		}
+	}
+	size, err := fl.tx.Size(fl.filename)
+	if err != nil {
+		return err
+	}
+	for blockNum := size - 1; blockNum > 0; blockNum-- {
+		if err := fl.push(blockNum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blocks リストの全てのブロック
+func (fl *freeList) blocks() ([]int32, error) {
+	header, err := fl.header(false)
+	if err != nil || header.Number < 0 {
+		return nil, err
+	}
+	if err := fl.tx.Pin(header); err != nil {
+		return nil, err
+	}
+	head, err := fl.tx.GetInt(header, 0)
+	fl.tx.Unpin(header)
+	if err != nil {
+		return nil, err
+	}
+	size, err := fl.tx.Size(fl.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []int32
+	for head != 0 {
+		// 壊れたリストで無限に辿らないように、ファイルのブロック数で打ち切る
+		if head-1 >= size || int32(len(blocks)) >= size {
+			return append(blocks, head-1), nil
+		}
+		blk := file.NewBlockID(fl.filename, head-1)
+		blocks = append(blocks, blk.Number)
+		if err := fl.tx.Pin(blk); err != nil {
+			return nil, err
+		}
+		head, err = fl.tx.GetInt(blk, 0)
+		fl.tx.Unpin(blk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// header リストの先頭を格納するブロック。ファイルがなければ、create が true なら作り、false なら番号 -1 のブロックを返す
+func (fl *freeList) header(create bool) (file.BlockID, error) {
+	filename := freeListFile(fl.filename)
+	size, err := fl.tx.Size(filename)
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	if size > 0 {
+		return file.NewBlockID(filename, 0), nil
+	}
+	if !create {
+		return file.NewBlockID(filename, -1), nil
+	}
+	return fl.tx.Append(filename)
+}
@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"math"
 	"simpledb/file"
+	"simpledb/index"
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/tx"
 )
 
+var _ query.CoveringIndex = (*BTreeIndex)(nil)
+
 type BTreeIndex struct {
 	tx         *tx.Transaction
 	dirLayout  *record.Layout
@@ -16,6 +19,23 @@ type BTreeIndex struct {
 	leaftbl    string
 	leaf       *BTreeLeaf
 	rootblk    file.BlockID
+	searchKey  *query.Constant
+	// upperBound 現在の葉より後ろの葉に含まれるキーの下限。最も右の葉であれば nil
+	upperBound *query.Constant
+}
+
+func leafFileName(idxName string) string {
+	return idxName + "leaf"
+}
+
+func dirFileName(idxName string) string {
+	return idxName + "dir"
+}
+
+// FileNames 索引 idxName を格納するファイルと、その空きブロックのリスト
+func FileNames(idxName string) []string {
+	leafFile, dirFile := leafFileName(idxName), dirFileName(idxName)
+	return []string{leafFile, dirFile, freeListFile(leafFile), freeListFile(dirFile)}
 }
 
 func NewBTreeIndex(
@@ -23,7 +43,7 @@ func NewBTreeIndex(
 	idxName string,
 	leafLayout *record.Layout,
 ) (*BTreeIndex, error) {
-	leafTable := idxName + "leaf"
+	leafTable := leafFileName(idxName)
 	if size, err := tx.Size(leafTable); err != nil {
 		return nil, err
 	} else if size == 0 {
@@ -40,11 +60,9 @@ func NewBTreeIndex(
 		}
 	}
 
-	dirSchema := record.NewSchema()
-	dirSchema.Add("block", leafLayout.Schema())
-	dirSchema.Add("dataval", leafLayout.Schema())
-	dirTable := idxName + "dir"
-	dirLayout := record.NewLayoutFromSchema(dirSchema)
+	dirTable := dirFileName(idxName)
+	dirLayout := newDirLayout(tx, leafLayout)
+	dirSchema := dirLayout.Schema()
 	rootblk := file.NewBlockID(dirTable, 0)
 	if size, err := tx.Size(dirTable); err != nil {
 		return nil, err
@@ -59,17 +77,7 @@ func NewBTreeIndex(
 		if err := node.Format(rootblk, 0); err != nil {
 			return nil, err
 		}
-		fldtype := dirSchema.Type("dataval")
-		var minval *query.Constant
-		switch fldtype {
-		case record.INT:
-			minval = query.NewConstantWithInt(math.MinInt32)
-		case record.VARCHAR:
-			minval = query.NewConstantWithString("")
-		default:
-			return nil, fmt.Errorf("unexpected value type: %d", fldtype)
-		}
-		if err := node.InsertDir(0, minval, 0); err != nil {
+		if err := node.InsertDir(0, minKey(dirSchema), 0); err != nil {
 			return nil, err
 		}
 		if err := node.Close(); err != nil {
@@ -86,13 +94,54 @@ func NewBTreeIndex(
 	}, nil
 }
 
+// newDirLayout 葉のレイアウトが leafLayout である索引の、ディレクトリのレイアウト
+func newDirLayout(tx *tx.Transaction, leafLayout *record.Layout) *record.Layout {
+	dirSchema := record.NewSchema()
+	dirSchema.Add(index.FieldBlock, leafLayout.Schema())
+	for _, fieldName := range index.KeyFields(leafLayout.Schema()) {
+		dirSchema.Add(fieldName, leafLayout.Schema())
+	}
+	return record.NewLayoutFromSchemaWithEncoding(dirSchema, record.FixedFormat, tx.Encoding())
+}
+
+// CheckLayout 葉のレイアウトが leafLayout である索引の葉とディレクトリが、1つのブロックに2つ以上のレコードを持てるか調べる
+// 1つしか持てなければノードを分割できないので、キーの長い索引は作れない
+func CheckLayout(tx *tx.Transaction, leafLayout *record.Layout) error {
+	for _, layout := range []*record.Layout{leafLayout, newDirLayout(tx, leafLayout)} {
+		if err := layout.CheckFits(tx.BlockSize()); err != nil {
+			return err
+		}
+		if n := maxRecsPerBlock(layout, tx.BlockSize()); n < minRecsPerNode {
+			return fmt.Errorf("%w: a node holds %d records of %d bytes, but needs at least %d", record.ErrRecordTooLarge, max(n, 0), layout.SlotSize(), minRecsPerNode)
+		}
+	}
+	return nil
+}
+
+// minKey 根の先頭のエントリに置く、どのキー以下でもあるキー
+// NULL はどの値よりも小さいので、全ての列を NULL にする。以前の索引は空文字列や最小の整数を置いていたので、
+// それより小さい NULL のキーは最も左の子に含める (findChildSlot)
+func minKey(schema *record.Schema) *query.Constant {
+	minvals := make([]*query.Constant, len(index.KeyFields(schema)))
+	for i := range minvals {
+		minvals[i] = query.NewNullConstant()
+	}
+	return index.MakeKey(minvals)
+}
+
 func (bi *BTreeIndex) BeforeFirst(searchKey *query.Constant) error {
+	bi.searchKey = searchKey
+	return bi.moveToLeaf(searchKey)
+}
+
+// moveToLeaf key を含みうる葉に移動し、その中で searchKey の直前に位置づける
+func (bi *BTreeIndex) moveToLeaf(key *query.Constant) error {
 	bi.Close()
 	root, err := NewBTreeDir(bi.tx, bi.rootblk, bi.dirLayout)
 	if err != nil {
 		return err
 	}
-	blknum, err := root.Search(searchKey)
+	blknum, upperBound, err := root.Search(key)
 	if err != nil {
 		return err
 	}
@@ -100,27 +149,57 @@ func (bi *BTreeIndex) BeforeFirst(searchKey *query.Constant) error {
 		return err
 	}
 	blk := file.NewBlockID(bi.leaftbl, blknum)
-	leaf, err := NewBTreeLeaf(bi.tx, blk, bi.leafLayout, searchKey)
+	leaf, err := NewBTreeLeaf(bi.tx, blk, bi.leafLayout, bi.searchKey)
 	if err != nil {
 		return err
 	}
 	bi.leaf = leaf
+	bi.upperBound = upperBound
 	return nil
 }
 
 func (bi *BTreeIndex) Next() (bool, error) {
-	return bi.leaf.Next()
+	for {
+		next, err := bi.leaf.Next()
+		if err != nil || next {
+			return next, err
+		}
+		// 複合索引の前方一致検索では、一致するエントリが後ろの葉にも続いていることがある
+		if bi.upperBound == nil {
+			return false, nil
+		}
+		cmp, err := bi.upperBound.CompareTo(bi.searchKey)
+		if err != nil {
+			return false, err
+		}
+		if cmp != 0 {
+			return false, nil
+		}
+		if err := bi.moveToLeaf(bi.upperBound); err != nil {
+			return false, err
+		}
+	}
 }
 
 func (bi *BTreeIndex) GetDataRID() (*record.RID, error) {
 	return bi.leaf.GetDataRID()
 }
 
+// GetVal 現在の葉のレコードのフィールド fieldName の値。キーと包含列の値をデータレコードを読まずに返す
+func (bi *BTreeIndex) GetVal(fieldName string) (*query.Constant, error) {
+	return bi.leaf.GetVal(fieldName)
+}
+
 func (bi *BTreeIndex) Insert(dataVal *query.Constant, dataRID *record.RID) error {
+	return bi.InsertIncluding(dataVal, dataRID, nil)
+}
+
+// InsertIncluding 包含列の値 included を葉のレコードに格納して挿入する
+func (bi *BTreeIndex) InsertIncluding(dataVal *query.Constant, dataRID *record.RID, included []*query.Constant) error {
 	if err := bi.BeforeFirst(dataVal); err != nil {
 		return err
 	}
-	entry, err := bi.leaf.Insert(dataRID)
+	entry, err := bi.leaf.Insert(dataRID, included)
 	if err != nil {
 		return err
 	}
@@ -149,16 +228,151 @@ func (bi *BTreeIndex) Insert(dataVal *query.Constant, dataRID *record.RID) error
 	return nil
 }
 
+// Delete エントリを削除する。葉やディレクトリが半分のレコード数を下回れば隣のノードと併合するか再分配し、
+// 根が子を1つしか持たなくなれば木を低くする。空になったブロックは空きブロックのリストに戻し、分割で再利用する
 func (bi *BTreeIndex) Delete(dataVal *query.Constant, dataRID *record.RID) error {
-	if err := bi.BeforeFirst(dataVal); err != nil {
+	if err := bi.Close(); err != nil {
 		return err
 	}
-	if err := bi.leaf.Delete(dataRID); err != nil {
+	root, err := NewBTreeDir(bi.tx, bi.rootblk, bi.dirLayout)
+	if err != nil {
 		return err
 	}
-	if err := bi.leaf.Close(); err != nil {
+	defer root.Close()
+	if _, err := root.Delete(dataVal, dataRID, bi.leaftbl, bi.leafLayout); err != nil {
+		return err
+	}
+	return root.CollapseRoot()
+}
+
+// ForEach 根から全てのディレクトリを辿り、葉とそのオーバーフローブロックの全てのエントリについて fn を呼ぶ
+func (bi *BTreeIndex) ForEach(fn func(dataVal *query.Constant, dataRID *record.RID) error) error {
+	if err := bi.Close(); err != nil {
+		return err
+	}
+	return bi.forEachInDir(bi.rootblk, -1, fn)
+}
+
+// forEachInDir ディレクトリ blk の子を順に辿る。level は期待する階層で、根では -1
+// 壊れた索引で同じブロックを辿り続けないように、階層が子に向かって 1 ずつ減らなければエラーにする
+func (bi *BTreeIndex) forEachInDir(blk file.BlockID, level int32, fn func(*query.Constant, *record.RID) error) error {
+	page, err := NewBTreePage(bi.tx, blk, bi.dirLayout)
+	if err != nil {
+		return err
+	}
+	defer page.Close()
+	flag, err := page.GetFlag()
+	if err != nil {
+		return err
+	}
+	if flag < 0 || (level >= 0 && flag != level) {
+		return fmt.Errorf("directory %d has level %d, want %d", blk.Number, flag, level)
+	}
+	nRecs, err := page.GetNumRecs()
+	if err != nil {
 		return err
 	}
+	for slot := range nRecs {
+		childNum, err := page.GetChildNum(slot)
+		if err != nil {
+			return err
+		}
+		if flag == 0 {
+			err = bi.forEachInLeaf(file.NewBlockID(bi.leaftbl, childNum), fn)
+		} else {
+			err = bi.forEachInDir(file.NewBlockID(blk.FileName, childNum), flag-1, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachInLeaf 葉 blk とそのオーバーフローブロックのエントリを順に辿る
+func (bi *BTreeIndex) forEachInLeaf(blk file.BlockID, fn func(*query.Constant, *record.RID) error) error {
+	size, err := bi.tx.Size(bi.leaftbl)
+	if err != nil {
+		return err
+	}
+	leafNum := blk.Number
+	for n := int32(0); ; n++ {
+		// 壊れた連鎖で無限に辿らないように、ファイルのブロック数で打ち切る
+		if blk.Number >= size || n >= size {
+			return fmt.Errorf("overflow chain of leaf %d is broken at block %d", leafNum, blk.Number)
+		}
+		page, err := NewBTreePage(bi.tx, blk, bi.leafLayout)
+		if err != nil {
+			return err
+		}
+		flag, err := forEachInPage(page, fn)
+		page.Close()
+		if err != nil || flag < 0 {
+			return err
+		}
+		blk = file.NewBlockID(bi.leaftbl, flag)
+	}
+}
+
+// forEachInPage 葉かオーバーフローブロック page のエントリについて fn を呼び、ページの flag を返す
+func forEachInPage(page *BTreePage, fn func(*query.Constant, *record.RID) error) (int32, error) {
+	nRecs, err := page.GetNumRecs()
+	if err != nil {
+		return 0, err
+	}
+	for slot := range nRecs {
+		val, err := page.GetDataVal(slot)
+		if err != nil {
+			return 0, err
+		}
+		rid, err := page.GetDataRID(slot)
+		if err != nil {
+			return 0, err
+		}
+		if err := fn(val, rid); err != nil {
+			return 0, err
+		}
+	}
+	return page.GetFlag()
+}
+
+// Clear 全てのエントリを削除する。根が空の葉 0 だけを指す、NewBTreeIndex で作ったままの状態に戻し、
+// それ以外のブロックは空きブロックのリストに入れて、その後の挿入や BulkLoad で再利用する
+// 書き込みはログに残すので、ロールバックすれば元の索引に戻る
+func (bi *BTreeIndex) Clear() error {
+	if err := bi.Close(); err != nil {
+		return err
+	}
+	leaf, err := NewBTreePage(bi.tx, file.NewBlockID(bi.leaftbl, 0), bi.leafLayout)
+	if err != nil {
+		return err
+	}
+	defer leaf.Close()
+	if err := leaf.SetFlag(-1); err != nil {
+		return err
+	}
+	if err := leaf.setNumRecs(0); err != nil {
+		return err
+	}
+	root, err := NewBTreePage(bi.tx, bi.rootblk, bi.dirLayout)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	if err := root.SetFlag(0); err != nil {
+		return err
+	}
+	if err := root.setNumRecs(0); err != nil {
+		return err
+	}
+	if err := root.InsertDir(0, minKey(bi.dirLayout.Schema()), 0); err != nil {
+		return err
+	}
+	for _, filename := range []string{bi.leaftbl, bi.rootblk.FileName} {
+		if err := newFreeList(bi.tx, filename).reset(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,509 @@
+package btree_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"simpledb/index/btree"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/server"
+	"simpledb/tx"
+)
+
+// entry 索引に格納したキーと RID
+type entry struct {
+	key string
+	rid *record.RID
+}
+
+// newIndexLayout VARCHAR(20) の列の索引のレイアウト。1つの葉に 5 レコード、1つのディレクトリに 6 エントリしか入らないので、木が高くなる
+func newIndexLayout(transaction *tx.Transaction) *record.Layout {
+	schema := record.NewSchema()
+	schema.AddIntField("block")
+	schema.AddIntField("id")
+	schema.AddStringField("dataval", 20)
+	return record.NewLayoutFromSchemaWithEncoding(schema, record.FixedFormat, transaction.Encoding())
+}
+
+// checkEntries 索引を検査し、entries の全てのキーで検索して RID が一致するか調べる
+func checkEntries(t *testing.T, idx *btree.BTreeIndex, entries map[string][]*record.RID) {
+	t.Helper()
+	if err := idx.Check(); err != nil {
+		t.Fatalf("invariant violated: %v", err)
+	}
+	for key, want := range entries {
+		if err := idx.BeforeFirst(query.NewConstantWithString(key)); err != nil {
+			t.Fatalf("failed to before first: %v", err)
+		}
+		var got []*record.RID
+		for {
+			next, err := idx.Next()
+			if err != nil {
+				t.Fatalf("failed to get next: %v", err)
+			}
+			if !next {
+				break
+			}
+			rid, err := idx.GetDataRID()
+			if err != nil {
+				t.Fatalf("failed to get data rid: %v", err)
+			}
+			got = append(got, rid)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("key %q: found %d entries, want %d", key, len(got), len(want))
+		}
+		for _, rid := range want {
+			found := false
+			for _, g := range got {
+				found = found || g.Equals(rid)
+			}
+			if !found {
+				t.Fatalf("key %q: %v not found", key, rid)
+			}
+		}
+	}
+}
+
+func TestBTreeIndexDelete(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		// keyOf i 番目のエントリのキー
+		keyOf func(i int) string
+	}{
+		{name: "unique", keyOf: func(i int) string { return fmt.Sprintf("k%05d", i) }},
+		// 同じキーのエントリが葉に収まらず、オーバーフローブロックを作る
+		{name: "duplicates", keyOf: func(i int) string { return fmt.Sprintf("k%d", i%7) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "btreetest"), 400, 8)
+			if err != nil {
+				t.Fatalf("failed to create simpledb: %v", err)
+			}
+			random := rand.New(rand.NewSource(1))
+			// ロック表は全てのデータベースで共有するので、並行する他のテストと異なるファイルを使う
+			idxName := tt.name + "idx"
+			transaction, err := simpleDB.NewTx()
+			if err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			layout := newIndexLayout(transaction)
+			idx, err := btree.NewBTreeIndex(transaction, idxName, layout)
+			if err != nil {
+				t.Fatalf("failed to create index: %v", err)
+			}
+
+			const n = 600
+			entries := make(map[string][]*record.RID)
+			var all []entry
+			for _, i := range random.Perm(n) {
+				e := entry{tt.keyOf(i), record.NewRID(int32(i/10), int32(i%10))}
+				if err := idx.Insert(query.NewConstantWithString(e.key), e.rid); err != nil {
+					t.Fatalf("failed to insert: %v", err)
+				}
+				entries[e.key] = append(entries[e.key], e.rid)
+				all = append(all, e)
+			}
+			checkEntries(t, idx, entries)
+			if err := transaction.Commit(); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+			leafBlocks, err := simpleDB.FileManager().Length(idxName + "leaf")
+			if err != nil {
+				t.Fatalf("failed to get length: %v", err)
+			}
+
+			// 削除をロールバックすれば元の木に戻る
+			transaction, err = simpleDB.NewTx()
+			if err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			idx, err = btree.NewBTreeIndex(transaction, idxName, layout)
+			if err != nil {
+				t.Fatalf("failed to create index: %v", err)
+			}
+			for _, e := range all[:n/2] {
+				if err := idx.Delete(query.NewConstantWithString(e.key), e.rid); err != nil {
+					t.Fatalf("failed to delete: %v", err)
+				}
+			}
+			if err := idx.Check(); err != nil {
+				t.Fatalf("invariant violated: %v", err)
+			}
+			if err := transaction.Rollback(); err != nil {
+				t.Fatalf("failed to rollback: %v", err)
+			}
+
+			// 挿入と削除を混ぜて、途中で何度も不変条件を検査する
+			transaction, err = simpleDB.NewTx()
+			if err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			idx, err = btree.NewBTreeIndex(transaction, idxName, layout)
+			if err != nil {
+				t.Fatalf("failed to create index: %v", err)
+			}
+			checkEntries(t, idx, entries)
+			random.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+			for op := 0; len(all) > 0; op++ {
+				if op%5 == 4 {
+					i := n + op
+					e := entry{tt.keyOf(i), record.NewRID(int32(i/10), int32(i%10))}
+					if err := idx.Insert(query.NewConstantWithString(e.key), e.rid); err != nil {
+						t.Fatalf("failed to insert: %v", err)
+					}
+					entries[e.key] = append(entries[e.key], e.rid)
+					all = append(all, e)
+					continue
+				}
+				e := all[len(all)-1]
+				all = all[:len(all)-1]
+				if err := idx.Delete(query.NewConstantWithString(e.key), e.rid); err != nil {
+					t.Fatalf("failed to delete: %v", err)
+				}
+				rids := entries[e.key]
+				for i, rid := range rids {
+					if rid.Equals(e.rid) {
+						entries[e.key] = append(rids[:i], rids[i+1:]...)
+						break
+					}
+				}
+				if op%50 == 0 {
+					checkEntries(t, idx, entries)
+				}
+			}
+			checkEntries(t, idx, entries)
+			if err := transaction.Commit(); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+
+			// 空になったブロックは再利用するので、同じ数のエントリを挿入し直してもファイルは伸びない
+			transaction, err = simpleDB.NewTx()
+			if err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			idx, err = btree.NewBTreeIndex(transaction, idxName, layout)
+			if err != nil {
+				t.Fatalf("failed to create index: %v", err)
+			}
+			for _, i := range random.Perm(n) {
+				if err := idx.Insert(query.NewConstantWithString(tt.keyOf(i)), record.NewRID(int32(i/10), int32(i%10))); err != nil {
+					t.Fatalf("failed to insert: %v", err)
+				}
+			}
+			if err := idx.Check(); err != nil {
+				t.Fatalf("invariant violated: %v", err)
+			}
+			if err := transaction.Commit(); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+			if size, err := simpleDB.FileManager().Length(idxName + "leaf"); err != nil || size > leafBlocks+leafBlocks/4 {
+				t.Errorf("%sleaf has %d blocks, want at most %d (%v)", idxName, size, leafBlocks+leafBlocks/4, err)
+			}
+		})
+	}
+}
+
+func uniqueKey(i int) string {
+	return fmt.Sprintf("k%05d", i)
+}
+
+func TestBTreeIndexBulkLoad(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		// n エントリの数
+		n          int
+		keyOf      func(i int) string
+		fillFactor int32
+		// wantLeaves 葉のファイルのブロック数。0 なら検査しない
+		wantLeaves int32
+	}{
+		// 1つの葉に 5 レコード入るので、充填率 100 % なら 120 個、50 % なら 300 個の葉に分ける
+		{name: "full", n: 600, keyOf: uniqueKey, fillFactor: 100, wantLeaves: 120},
+		{name: "half", n: 600, keyOf: uniqueKey, fillFactor: 50, wantLeaves: 300},
+		{name: "default", n: 600, keyOf: uniqueKey, fillFactor: btree.DefaultFillFactor},
+		// 最後の葉が半分に満たないので、左隣の葉からレコードを移すか、左隣の葉と併合する
+		{name: "fullremainder", n: 601, keyOf: uniqueKey, fillFactor: 100},
+		{name: "halfremainder", n: 601, keyOf: uniqueKey, fillFactor: 50},
+		// 同じキーのエントリが葉に収まらず、オーバーフローブロックを作る
+		{name: "bulkduplicates", n: 600, keyOf: func(i int) string { return fmt.Sprintf("k%d", i%7) }, fillFactor: btree.DefaultFillFactor},
+		// 同じキーの短い連続が葉の境目をまたぐ
+		{name: "runs", n: 600, keyOf: func(i int) string { return fmt.Sprintf("k%05d", i/3) }, fillFactor: 100},
+		{name: "empty", n: 0, fillFactor: btree.DefaultFillFactor, wantLeaves: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "btreetest"), 400, 8)
+			if err != nil {
+				t.Fatalf("failed to create simpledb: %v", err)
+			}
+			// ロック表は全てのデータベースで共有するので、並行する他のテストと異なるファイルを使う
+			idxName := tt.name + "idx"
+			transaction, err := simpleDB.NewTx()
+			if err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			layout := newIndexLayout(transaction)
+
+			// キーの順に並べたエントリを一時表に書き込む
+			n := tt.n
+			entries := make(map[string][]*record.RID)
+			sorted := make([]entry, n)
+			for i := range n {
+				sorted[i] = entry{tt.keyOf(i), record.NewRID(int32(i/10), int32(i%10))}
+				entries[sorted[i].key] = append(entries[sorted[i].key], sorted[i].rid)
+			}
+			slices.SortStableFunc(sorted, func(a, b entry) int { return strings.Compare(a.key, b.key) })
+			temp := query.NewTempTable(transaction, layout.Schema())
+			src, err := temp.Open()
+			if err != nil {
+				t.Fatalf("failed to open temp table: %v", err)
+			}
+			for _, e := range sorted {
+				if err := src.Insert(); err != nil {
+					t.Fatalf("failed to insert: %v", err)
+				}
+				for fieldName, val := range map[string]*query.Constant{
+					"dataval": query.NewConstantWithString(e.key),
+					"block":   query.NewConstantWithInt(e.rid.BlockNumber()),
+					"id":      query.NewConstantWithInt(e.rid.Slot()),
+				} {
+					if err := src.SetVal(fieldName, val); err != nil {
+						t.Fatalf("failed to set %s: %v", fieldName, err)
+					}
+				}
+			}
+			if err := src.BeforeFirst(); err != nil {
+				t.Fatalf("failed to before first: %v", err)
+			}
+
+			idx, err := btree.NewBTreeIndex(transaction, idxName, layout)
+			if err != nil {
+				t.Fatalf("failed to create index: %v", err)
+			}
+			if err := idx.BulkLoad(src, tt.fillFactor); err != nil {
+				t.Fatalf("failed to bulk load: %v", err)
+			}
+			checkEntries(t, idx, entries)
+			// 空でない索引には一括で読み込めない
+			if err := src.BeforeFirst(); err != nil {
+				t.Fatalf("failed to before first: %v", err)
+			}
+			if err := idx.BulkLoad(src, tt.fillFactor); n > 0 && err == nil {
+				t.Errorf("bulk load into a non-empty index succeeded")
+			}
+			src.Close()
+			if err := transaction.Commit(); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+			if tt.wantLeaves > 0 {
+				if size, err := simpleDB.FileManager().Length(idxName + "leaf"); err != nil || size != tt.wantLeaves {
+					t.Errorf("%sleaf has %d blocks, want %d (%v)", idxName, size, tt.wantLeaves, err)
+				}
+			}
+
+			// 一括で読み込んだ木にも、挿入や削除ができる
+			transaction, err = simpleDB.NewTx()
+			if err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			idx, err = btree.NewBTreeIndex(transaction, idxName, layout)
+			if err != nil {
+				t.Fatalf("failed to create index: %v", err)
+			}
+			random := rand.New(rand.NewSource(1))
+			for _, i := range random.Perm(n)[:n/2] {
+				e := sorted[i]
+				if err := idx.Delete(query.NewConstantWithString(e.key), e.rid); err != nil {
+					t.Fatalf("failed to delete: %v", err)
+				}
+				rids := entries[e.key]
+				for j, rid := range rids {
+					if rid.Equals(e.rid) {
+						entries[e.key] = append(rids[:j], rids[j+1:]...)
+						break
+					}
+				}
+			}
+			for i := n; i < n+100; i++ {
+				key := uniqueKey(i)
+				rid := record.NewRID(int32(i/10), int32(i%10))
+				if err := idx.Insert(query.NewConstantWithString(key), rid); err != nil {
+					t.Fatalf("failed to insert: %v", err)
+				}
+				entries[key] = append(entries[key], rid)
+			}
+			checkEntries(t, idx, entries)
+			if err := transaction.Commit(); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+		})
+	}
+}
+
+func TestBTreeIndexKeyTooLarge(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "btreetest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	// VARCHAR(80) のキーはブロックに収まるが、1つの葉に1レコードしか入らない
+	schema := record.NewSchema()
+	schema.AddIntField("block")
+	schema.AddIntField("id")
+	schema.AddStringField("dataval", 80)
+	layout := record.NewLayoutFromSchemaWithEncoding(schema, record.FixedFormat, transaction.Encoding())
+	if err := layout.CheckFits(transaction.BlockSize()); err != nil {
+		t.Fatalf("layout should fit in a block: %v", err)
+	}
+	if err := btree.CheckLayout(transaction, layout); !errors.Is(err, record.ErrRecordTooLarge) {
+		t.Fatalf("CheckLayout() = %v, want ErrRecordTooLarge", err)
+	}
+	if err := btree.CheckLayout(transaction, newIndexLayout(transaction)); err != nil {
+		t.Fatalf("CheckLayout() = %v, want nil", err)
+	}
+
+	// ディレクトリの段を積み続けずにエラーを返す
+	idx, err := btree.NewBTreeIndex(transaction, "widekeyidx", layout)
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	src, err := query.NewTempTable(transaction, schema).Open()
+	if err != nil {
+		t.Fatalf("failed to open temp table: %v", err)
+	}
+	if err := idx.BulkLoad(src, btree.DefaultFillFactor); !errors.Is(err, record.ErrRecordTooLarge) {
+		t.Fatalf("BulkLoad() = %v, want ErrRecordTooLarge", err)
+	}
+	src.Close()
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+}
+
+func TestBTreeIndexClear(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "btreetest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	idxName := "clearidx"
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	layout := newIndexLayout(transaction)
+	idx, err := btree.NewBTreeIndex(transaction, idxName, layout)
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	// 同じキーが葉に収まらずオーバーフローブロックを作るエントリも含める
+	entries := make(map[string][]*record.RID)
+	for i := range 300 {
+		key := fmt.Sprintf("k%05d", i)
+		if i%3 == 0 {
+			key = "dup"
+		}
+		rid := record.NewRID(int32(i/10), int32(i%10))
+		if err := idx.Insert(query.NewConstantWithString(key), rid); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		entries[key] = append(entries[key], rid)
+	}
+	// countEntries ForEach で辿ったエントリの数。辿ったエントリが entries にあるかも調べる
+	countEntries := func(entries map[string][]*record.RID) int {
+		t.Helper()
+		count := 0
+		err := idx.ForEach(func(key *query.Constant, rid *record.RID) error {
+			s, err := key.AsString()
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(entries[s], rid.Equals) {
+				return fmt.Errorf("unexpected entry %s %v", s, rid)
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to iterate entries: %v", err)
+		}
+		return count
+	}
+	if got := countEntries(entries); got != 300 {
+		t.Fatalf("found %d entries, want 300", got)
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	size, err := simpleDB.FileManager().Length(idxName + "leaf")
+	if err != nil {
+		t.Fatalf("failed to get length: %v", err)
+	}
+
+	// 空にした索引は作ったままの状態になり、空いたブロックを再利用して挿入できる
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	if idx, err = btree.NewBTreeIndex(transaction, idxName, layout); err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	if err := idx.Clear(); err != nil {
+		t.Fatalf("failed to clear: %v", err)
+	}
+	if got := countEntries(nil); got != 0 {
+		t.Fatalf("found %d entries after clear, want 0", got)
+	}
+	checkEntries(t, idx, map[string][]*record.RID{"dup": nil, "k00001": nil})
+	newEntries := make(map[string][]*record.RID)
+	for i := range 100 {
+		key := fmt.Sprintf("n%05d", i)
+		rid := record.NewRID(int32(i), 0)
+		if err := idx.Insert(query.NewConstantWithString(key), rid); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		newEntries[key] = append(newEntries[key], rid)
+	}
+	checkEntries(t, idx, newEntries)
+	if got := countEntries(newEntries); got != 100 {
+		t.Fatalf("found %d entries, want 100", got)
+	}
+	if got, err := transaction.Size(idxName + "leaf"); err != nil || got != size {
+		t.Errorf("%sleaf has %d blocks, want %d (%v)", idxName, got, size, err)
+	}
+
+	// ロールバックすれば元のエントリに戻る
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	if idx, err = btree.NewBTreeIndex(transaction, idxName, layout); err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	checkEntries(t, idx, entries)
+	if got := countEntries(entries); got != 300 {
+		t.Fatalf("found %d entries after rollback, want 300", got)
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
@@ -46,7 +46,10 @@ func (bl *BTreeLeaf) Next() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	if val.Equals(bl.searchkey) {
+	// 複合キーの前方一致検索では searchkey の列数がキーより少ないため、Equals ではなく CompareTo で比較する
+	if cmp, err := val.CompareTo(bl.searchkey); err != nil {
+		return false, err
+	} else if cmp == 0 {
 		return true, nil
 	} else {
 		return bl.tryOverflow()
@@ -57,38 +60,166 @@ func (bl *BTreeLeaf) GetDataRID() (*record.RID, error) {
 	return bl.contents.GetDataRID(bl.currentslot)
 }
 
-func (bl *BTreeLeaf) Delete(dataRID *record.RID) error {
+// Delete dataRID のレコードを削除し、葉が根以外のノードが保つべき半分のレコード数を下回ったかを返す
+// レコードが見つからなければ何もしない
+func (bl *BTreeLeaf) Delete(dataRID *record.RID) (bool, error) {
+	leafBlk := bl.contents.currentBlockID
 	for {
 		ok, err := bl.Next()
 		if err != nil {
-			return err
+			return false, err
 		}
-		// break
-		// NOTE: should return error? or just break?
 		if !ok {
-			return nil
+			return false, nil
 		}
 		rid, err := bl.GetDataRID()
 		if err != nil {
-			return err
+			return false, err
 		}
 		if rid.Equals(dataRID) {
-			return bl.contents.Delete(bl.currentslot)
+			if err := bl.contents.Delete(bl.currentslot); err != nil {
+				return false, err
+			}
+			break
+		}
+	}
+	// オーバーフローブロックから削除した場合は、葉に戻る
+	if bl.contents.currentBlockID != leafBlk {
+		if err := bl.contents.Close(); err != nil {
+			return false, err
+		}
+		contents, err := NewBTreePage(bl.tx, leafBlk, bl.layout)
+		if err != nil {
+			return false, err
+		}
+		bl.contents = contents
+	}
+	if err := bl.reclaimOverflow(); err != nil {
+		return false, err
+	}
+	return bl.contents.isUnderfull()
+}
+
+// reclaimOverflow 空になったオーバーフローブロックを連鎖から外して解放し、葉に空きがあれば連鎖のレコードを葉に移す
+// 連鎖のレコードは葉の先頭のキーと同じキーを持つので、葉の先頭に移せば順序は保たれる
+func (bl *BTreeLeaf) reclaimOverflow() error {
+	freeList := newFreeList(bl.tx, bl.filename)
+	prev := bl.contents
+	closePrev := func() error {
+		if prev == bl.contents {
+			return nil
+		}
+		return prev.Close()
+	}
+	for {
+		next, err := prev.GetFlag()
+		if err != nil {
+			return err
+		}
+		if next < 0 {
+			break
+		}
+		page, err := NewBTreePage(bl.tx, file.NewBlockID(bl.filename, next), bl.layout)
+		if err != nil {
+			return err
+		}
+		nRecs, err := page.GetNumRecs()
+		if err == nil && nRecs == 0 {
+			var flag int32
+			if flag, err = page.GetFlag(); err == nil {
+				err = prev.SetFlag(flag)
+			}
+			page.Close()
+			if err == nil {
+				err = freeList.push(next)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			page.Close()
+			return err
+		}
+		if err := closePrev(); err != nil {
+			return err
+		}
+		prev = page
+	}
+	if err := closePrev(); err != nil {
+		return err
+	}
+
+	for {
+		next, err := bl.contents.GetFlag()
+		if err != nil || next < 0 {
+			return err
+		}
+		nRecs, err := bl.contents.GetNumRecs()
+		if err != nil {
+			return err
+		}
+		room := bl.contents.maxRecs() - nRecs
+		if room <= 0 {
+			return nil
+		}
+		page, err := NewBTreePage(bl.tx, file.NewBlockID(bl.filename, next), bl.layout)
+		if err != nil {
+			return err
+		}
+		overflowRecs, err := page.GetNumRecs()
+		if err != nil {
+			page.Close()
+			return err
+		}
+		count := min(room, overflowRecs)
+		if err := page.moveRecs(overflowRecs-count, overflowRecs, bl.contents, 0); err != nil {
+			page.Close()
+			return err
+		}
+		if count < overflowRecs {
+			return page.Close()
+		}
+		flag, err := page.GetFlag()
+		page.Close()
+		if err != nil {
+			return err
+		}
+		if err := bl.contents.SetFlag(flag); err != nil {
+			return err
+		}
+		if err := freeList.push(next); err != nil {
+			return err
 		}
 	}
 }
 
+// tryOverflow 葉の先頭のキーが searchkey と一致すれば、オーバーフローブロックに進む
+// 削除で空になったオーバーフローブロックは reclaimOverflow で連鎖から外すが、それ以前に作った索引には空のブロックが残っていることがあるので、
+// 空のブロックも連鎖の一部として辿る
 func (bl *BTreeLeaf) tryOverflow() (bool, error) {
-	firstVal, err := bl.contents.GetDataVal(0)
+	flag, err := bl.contents.GetFlag()
 	if err != nil {
 		return false, err
 	}
-	flag, err := bl.contents.GetFlag()
+	if flag < 0 {
+		return false, nil
+	}
+	nRecs, err := bl.contents.GetNumRecs()
 	if err != nil {
 		return false, err
 	}
-	if !firstVal.Equals(bl.searchkey) || flag < 0 {
-		return false, nil
+	if nRecs > 0 {
+		firstVal, err := bl.contents.GetDataVal(0)
+		if err != nil {
+			return false, err
+		}
+		if cmp, err := firstVal.CompareTo(bl.searchkey); err != nil {
+			return false, err
+		} else if cmp != 0 {
+			return false, nil
+		}
 	}
 	if err := bl.contents.Close(); err != nil {
 		return false, err
@@ -99,11 +230,18 @@ func (bl *BTreeLeaf) tryOverflow() (bool, error) {
 		return false, err
 	}
 	bl.contents = contents
-	bl.currentslot = 0
-	return true, nil
+	// オーバーフローブロックの先頭のレコードから読む。空のブロックなら次のブロックに進む
+	bl.currentslot = -1
+	return bl.Next()
+}
+
+// GetVal 現在のレコードのフィールド fieldName の値
+func (bl *BTreeLeaf) GetVal(fieldName string) (*query.Constant, error) {
+	return bl.contents.getVal(bl.currentslot, fieldName)
 }
 
-func (bl *BTreeLeaf) Insert(dataRID *record.RID) (*DirEntry, error) {
+// Insert dataRID を指し、包含列の値が included であるレコードを挿入する
+func (bl *BTreeLeaf) Insert(dataRID *record.RID, included []*query.Constant) (*DirEntry, error) {
 	flag, err := bl.contents.GetFlag()
 	if err != nil {
 		return nil, err
@@ -126,14 +264,14 @@ func (bl *BTreeLeaf) Insert(dataRID *record.RID) (*DirEntry, error) {
 		if err := bl.contents.SetFlag(-1); err != nil {
 			return nil, err
 		}
-		if err := bl.contents.InsertLeaf(bl.currentslot, bl.searchkey, dataRID); err != nil {
+		if err := bl.contents.InsertLeaf(bl.currentslot, bl.searchkey, dataRID, included); err != nil {
 			return nil, err
 		}
 		return NewDirEntry(firstVal, newBlk.Number), nil
 	}
 
 	bl.currentslot++
-	if err := bl.contents.InsertLeaf(bl.currentslot, bl.searchkey, dataRID); err != nil {
+	if err := bl.contents.InsertLeaf(bl.currentslot, bl.searchkey, dataRID, included); err != nil {
 		return nil, err
 	}
 	if isFull, err := bl.contents.IsFull(); err != nil {
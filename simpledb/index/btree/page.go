@@ -3,6 +3,7 @@ package btree
 import (
 	"fmt"
 	"simpledb/file"
+	"simpledb/index"
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/tx"
@@ -12,13 +13,14 @@ type BTreePage struct {
 	tx             *tx.Transaction
 	currentBlockID file.BlockID
 	layout         *record.Layout
+	keyFields      []string
 }
 
 func NewBTreePage(tx *tx.Transaction, currentBlockID file.BlockID, layout *record.Layout) (*BTreePage, error) {
 	if err := tx.Pin(currentBlockID); err != nil {
 		return nil, err
 	}
-	return &BTreePage{tx, currentBlockID, layout}, nil
+	return &BTreePage{tx, currentBlockID, layout, index.KeyFields(layout.Schema())}, nil
 }
 
 func (bp *BTreePage) FindSlotBefore(searchKey *query.Constant) (int32, error) {
@@ -65,6 +67,28 @@ func (bp *BTreePage) IsFull() (bool, error) {
 	return bp.slotPos(nRecs+1) >= bp.tx.BlockSize(), nil
 }
 
+// minRecsPerNode ノードを分割するために、1つのブロックが持てなければならないレコードの数
+const minRecsPerNode int32 = 2
+
+// maxRecs IsFull にならない最大のレコード数
+func (bp *BTreePage) maxRecs() int32 {
+	return maxRecsPerBlock(bp.layout, bp.tx.BlockSize())
+}
+
+// maxRecsPerBlock 大きさ blockSize のブロックに、レイアウトが layout のレコードを IsFull にならずに置ける最大の数
+func maxRecsPerBlock(layout *record.Layout, blockSize int32) int32 {
+	return (blockSize-2*file.Int32Bytes-1)/layout.SlotSize() - 1
+}
+
+// isUnderfull 根以外のノードが保つべき半分のレコード数を下回っているか
+func (bp *BTreePage) isUnderfull() (bool, error) {
+	nRecs, err := bp.GetNumRecs()
+	if err != nil {
+		return false, err
+	}
+	return nRecs < bp.maxRecs()/2, nil
+}
+
 func (bp *BTreePage) Split(splitPos int32, flag int32) (file.BlockID, error) {
 	newBlockID, err := bp.appendNew(flag)
 	if err != nil {
@@ -88,8 +112,30 @@ func (bp *BTreePage) GetNumRecs() (int32, error) {
 	return bp.tx.GetInt(bp.currentBlockID, file.Int32Bytes)
 }
 
+// GetDataVal slot のキー。複合索引の場合は各列の値を並べた複合キーを返す
 func (bp *BTreePage) GetDataVal(slot int32) (*query.Constant, error) {
-	return bp.getVal(slot, "dataval")
+	vals := make([]*query.Constant, len(bp.keyFields))
+	for i, fieldName := range bp.keyFields {
+		val, err := bp.getVal(slot, fieldName)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return index.MakeKey(vals), nil
+}
+
+func (bp *BTreePage) setDataVal(slot int32, val *query.Constant) error {
+	vals := index.SplitKey(val, len(bp.keyFields))
+	if len(vals) != len(bp.keyFields) {
+		return fmt.Errorf("key %s does not match the index columns", val)
+	}
+	for i, fieldName := range bp.keyFields {
+		if err := bp.setVal(slot, fieldName, vals[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (bp *BTreePage) GetFlag() (int32, error) {
@@ -101,6 +147,13 @@ func (bp *BTreePage) SetFlag(val int32) error {
 }
 
 func (bp *BTreePage) getVal(slot int32, fieldName string) (*query.Constant, error) {
+	flag, err := bp.tx.GetInt(bp.currentBlockID, bp.slotPos(slot))
+	if err != nil {
+		return nil, err
+	}
+	if flag&bp.layout.NullMask(fieldName) != 0 {
+		return query.NewNullConstant(), nil
+	}
 	valType := bp.layout.Schema().Type(fieldName)
 	switch valType {
 	case record.INT:
@@ -129,6 +182,12 @@ func (bp *BTreePage) setString(slot int32, fieldName string, val string) error {
 }
 
 func (bp *BTreePage) setVal(slot int32, fieldName string, val *query.Constant) error {
+	if err := bp.setNullFlag(slot, fieldName, val.IsNull()); err != nil {
+		return err
+	}
+	if val.IsNull() {
+		return nil
+	}
 	valType := bp.layout.Schema().Type(fieldName)
 	switch valType {
 	case record.INT:
@@ -148,6 +207,29 @@ func (bp *BTreePage) setVal(slot int32, fieldName string, val *query.Constant) e
 	}
 }
 
+// setNullFlag レコード先頭の int を、record.RecordPage と同じく列ごとの NULL フラグとして使う
+func (bp *BTreePage) setNullFlag(slot int32, fieldName string, null bool) error {
+	mask := bp.layout.NullMask(fieldName)
+	if mask == 0 {
+		if null {
+			return fmt.Errorf("field %q cannot store NULL", fieldName)
+		}
+		return nil
+	}
+	flag, err := bp.tx.GetInt(bp.currentBlockID, bp.slotPos(slot))
+	if err != nil {
+		return err
+	}
+	newFlag := flag &^ mask
+	if null {
+		newFlag |= mask
+	}
+	if newFlag == flag {
+		return nil
+	}
+	return bp.tx.SetInt(bp.currentBlockID, bp.slotPos(slot), newFlag, true)
+}
+
 func (bp *BTreePage) setNumRecs(n int32) error {
 	return bp.tx.SetInt(bp.currentBlockID, file.Int32Bytes, n, true)
 }
@@ -169,12 +251,17 @@ func (bp *BTreePage) insert(slot int32) error {
 }
 
 func (bp *BTreePage) copyRecord(from, to int32) error {
+	return bp.copyRecordTo(from, bp, to)
+}
+
+// copyRecordTo スロット from のレコードを、dest のスロット to に書き込む
+func (bp *BTreePage) copyRecordTo(from int32, dest *BTreePage, to int32) error {
 	for _, fieldName := range bp.layout.Schema().Fields() {
 		val, err := bp.getVal(from, fieldName)
 		if err != nil {
 			return err
 		}
-		if err := bp.setVal(to, fieldName, val); err != nil {
+		if err := dest.setVal(to, fieldName, val); err != nil {
 			return err
 		}
 	}
@@ -185,24 +272,54 @@ func (bp *BTreePage) fieldPos(slot int32, fieldName string) int32 {
 	return bp.slotPos(slot) + bp.layout.Offset(fieldName)
 }
 
+// slotPos ブロックの先頭には flag とレコード数の2つの int が並び、その後ろにレコードが続く
 func (bp *BTreePage) slotPos(slot int32) int32 {
-	return file.Int32Bytes + file.Int32Bytes*(slot*bp.layout.SlotSize())
+	return file.Int32Bytes + file.Int32Bytes + slot*bp.layout.SlotSize()
 }
 
+// appendNew 新しいブロックを作る。空きブロックのリストにブロックがあれば、ファイルを伸ばさずにそれを使う
 func (bp *BTreePage) appendNew(flag int32) (file.BlockID, error) {
-	newBlockID, err := bp.tx.Append((bp.currentBlockID).FileName)
+	filename := bp.currentBlockID.FileName
+	blockNum, err := newFreeList(bp.tx, filename).pop()
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	if blockNum >= 0 {
+		// ロールバックで元の内容に戻せるように、ログを残して書き込む
+		blk := file.NewBlockID(filename, blockNum)
+		if err := bp.tx.Pin(blk); err != nil {
+			return file.BlockID{}, err
+		}
+		defer bp.tx.Unpin(blk)
+		if err := bp.tx.SetInt(blk, 0, flag, true); err != nil {
+			return file.BlockID{}, err
+		}
+		return blk, bp.tx.SetInt(blk, file.Int32Bytes, 0, true)
+	}
+
+	newBlockID, err := bp.tx.Append(filename)
 	if err != nil {
 		return file.BlockID{}, err
 	}
 	if err := bp.tx.Pin(newBlockID); err != nil {
 		return file.BlockID{}, err
 	}
+	defer bp.tx.Unpin(newBlockID)
 	if err := bp.Format(newBlockID, flag); err != nil {
 		return file.BlockID{}, err
 	}
 	return newBlockID, nil
 }
 
+// newPage appendNew で作ったブロックを開く
+func (bp *BTreePage) newPage(flag int32) (*BTreePage, error) {
+	blk, err := bp.appendNew(flag)
+	if err != nil {
+		return nil, err
+	}
+	return NewBTreePage(bp.tx, blk, bp.layout)
+}
+
 func (bp *BTreePage) Format(blk file.BlockID, flag int32) error {
 	if err := bp.tx.SetInt(blk, 0, flag, false); err != nil {
 		return err
@@ -238,33 +355,145 @@ func (bp *BTreePage) makeDefaultRecord(blk file.BlockID, pos int32) error {
 }
 
 func (bp *BTreePage) transferRecs(slot int32, dest *BTreePage) error {
-	destSlot := int32(0)
-	for {
-		nRecs, err := bp.GetNumRecs()
-		if err != nil {
+	nRecs, err := bp.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	return bp.moveRecs(slot, nRecs, dest, 0)
+}
+
+// moveRecs スロット start から end の手前までのレコードを、dest のスロット destSlot 以降に挿入し、このページから取り除く
+func (bp *BTreePage) moveRecs(start, end int32, dest *BTreePage, destSlot int32) error {
+	count := end - start
+	if count <= 0 {
+		return nil
+	}
+	destRecs, err := dest.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	for i := destRecs - 1; i >= destSlot; i-- {
+		if err := dest.copyRecord(i, i+count); err != nil {
 			return err
 		}
-		if slot >= nRecs {
-			break
+	}
+	for i := int32(0); i < count; i++ {
+		if err := bp.copyRecordTo(start+i, dest, destSlot+i); err != nil {
+			return err
 		}
-		if err := dest.insert(destSlot); err != nil {
+	}
+	if err := dest.setNumRecs(destRecs + count); err != nil {
+		return err
+	}
+
+	nRecs, err := bp.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	for i := end; i < nRecs; i++ {
+		if err := bp.copyRecord(i, i-count); err != nil {
 			return err
 		}
-		for _, fieldName := range dest.layout.Schema().Fields() {
-			val, err := bp.getVal(slot, fieldName)
-			if err != nil {
-				return err
+	}
+	return bp.setNumRecs(nRecs - count)
+}
+
+// mergeFrom 右隣のノード right のレコードを全てこのノードの末尾に移す
+// 1つのブロックに収まらなければ何もせずに false を返す
+// 葉では、連鎖の先頭のキーが葉の先頭のキーでなくなるので、right がオーバーフローブロックを持てば、このノードが空の時だけ連鎖ごと移す
+func (bp *BTreePage) mergeFrom(right *BTreePage, leaf bool) (bool, error) {
+	nRecs, err := bp.GetNumRecs()
+	if err != nil {
+		return false, err
+	}
+	rightRecs, err := right.GetNumRecs()
+	if err != nil {
+		return false, err
+	}
+	if nRecs+rightRecs > bp.maxRecs() {
+		return false, nil
+	}
+	if leaf {
+		flag, err := bp.GetFlag()
+		if err != nil {
+			return false, err
+		}
+		rightFlag, err := right.GetFlag()
+		if err != nil {
+			return false, err
+		}
+		if rightFlag >= 0 {
+			if nRecs > 0 || flag >= 0 {
+				return false, nil
 			}
-			if err := dest.setVal(destSlot, fieldName, val); err != nil {
-				return err
+			if err := bp.SetFlag(rightFlag); err != nil {
+				return false, err
 			}
 		}
-		if err := bp.Delete(slot); err != nil {
-			return err
+	}
+	return true, right.moveRecs(0, rightRecs, bp, nRecs)
+}
+
+// redistribute このノードと右隣のノード right のレコードを、なるべく同じ数になるように移し、right の新しい先頭のキーを返す
+// 同じキーのレコードは分けず、少ない方のノードのレコードが増えなければ何もせずに nil を返す
+// 葉では、right がオーバーフローブロックを持てば先頭のキーを変えられないので何もしない
+func (bp *BTreePage) redistribute(right *BTreePage, leaf bool) (*query.Constant, error) {
+	if leaf {
+		if rightFlag, err := right.GetFlag(); err != nil || rightFlag >= 0 {
+			return nil, err
 		}
-		destSlot++
 	}
-	return nil
+	nRecs, err := bp.GetNumRecs()
+	if err != nil {
+		return nil, err
+	}
+	rightRecs, err := right.GetNumRecs()
+	if err != nil {
+		return nil, err
+	}
+	total := nRecs + rightRecs
+	keys := make([]*query.Constant, 0, total)
+	for _, page := range []*BTreePage{bp, right} {
+		n, err := page.GetNumRecs()
+		if err != nil {
+			return nil, err
+		}
+		for slot := int32(0); slot < n; slot++ {
+			key, err := page.GetDataVal(slot)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	// 左のノードに残すレコードの数を、キーの境目のうち半分に最も近いものにする
+	maxRecs := bp.maxRecs()
+	best := int32(-1)
+	for n := int32(1); n < total; n++ {
+		if n > maxRecs || total-n > maxRecs || keys[n-1].Equals(keys[n]) {
+			continue
+		}
+		if best < 0 || abs(n-total/2) < abs(best-total/2) {
+			best = n
+		}
+	}
+	if best < 0 || min(best, total-best) <= min(nRecs, rightRecs) {
+		return nil, nil
+	}
+	if best < nRecs {
+		err = bp.moveRecs(best, nRecs, right, 0)
+	} else {
+		err = right.moveRecs(0, best-nRecs, bp, nRecs)
+	}
+	return keys[best], err
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
 
 func (bp *BTreePage) Delete(slot int32) error {
@@ -292,7 +521,7 @@ func (bp *BTreePage) InsertDir(slot int32, val *query.Constant, blkNum int32) er
 	if err := bp.insert(slot); err != nil {
 		return err
 	}
-	if err := bp.setVal(slot, "dataval", val); err != nil {
+	if err := bp.setDataVal(slot, val); err != nil {
 		return err
 	}
 	if err := bp.setInt(slot, "block", blkNum); err != nil {
@@ -313,11 +542,12 @@ func (bp *BTreePage) GetDataRID(slot int32) (*record.RID, error) {
 	return record.NewRID(blockNum, id), nil
 }
 
-func (bp *BTreePage) InsertLeaf(slot int32, val *query.Constant, rid *record.RID) error {
+// InsertLeaf キー val と RID rid のレコードを slot に挿入する。included で値を与えなかった包含列は NULL にする
+func (bp *BTreePage) InsertLeaf(slot int32, val *query.Constant, rid *record.RID, included []*query.Constant) error {
 	if err := bp.insert(slot); err != nil {
 		return err
 	}
-	if err := bp.setVal(slot, "dataval", val); err != nil {
+	if err := bp.setDataVal(slot, val); err != nil {
 		return err
 	}
 	if err := bp.setInt(slot, "block", rid.BlockNumber()); err != nil {
@@ -326,9 +556,36 @@ func (bp *BTreePage) InsertLeaf(slot int32, val *query.Constant, rid *record.RID
 	if err := bp.setInt(slot, "id", rid.Slot()); err != nil {
 		return err
 	}
+	for i, fieldName := range index.IncludedFields(bp.layout.Schema()) {
+		val := query.NewNullConstant()
+		if i < len(included) {
+			val = included[i]
+		}
+		if err := bp.setVal(slot, fieldName, val); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// appendRecord src の現在のレコードの全ての列の値を、ページの末尾のレコードとして加える
+func (bp *BTreePage) appendRecord(src query.Scan) error {
+	nRecs, err := bp.GetNumRecs()
+	if err != nil {
+		return err
+	}
+	for _, fieldName := range bp.layout.Schema().Fields() {
+		val, err := src.GetVal(fieldName)
+		if err != nil {
+			return err
+		}
+		if err := bp.setVal(nRecs, fieldName, val); err != nil {
+			return err
+		}
+	}
+	return bp.setNumRecs(nRecs + 1)
+}
+
 func (bp *BTreePage) getInt(slot int32, fieldName string) (int32, error) {
 	pos := bp.fieldPos(slot, fieldName)
 	return bp.tx.GetInt(bp.currentBlockID, pos)
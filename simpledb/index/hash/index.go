@@ -0,0 +1,237 @@
+// Package hash は静的ハッシュ法による索引を提供する
+// 索引レコードはキーのハッシュ値によって NumBuckets 個のバケットに振り分けられ、
+// 各バケットは1つのレコードファイルとして格納される。等価検索にしか使えない
+package hash
+
+import (
+	"fmt"
+	"strconv"
+
+	"simpledb/index"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+// NumBuckets バケットの数
+const NumBuckets = 100
+
+var _ query.Index = (*HashIndex)(nil)
+
+type HashIndex struct {
+	tx        *tx.Transaction
+	idxName   string
+	layout    *record.Layout
+	keyFields []string
+	searchKey *query.Constant
+	ts        *query.TableScan
+}
+
+func NewHashIndex(tx *tx.Transaction, idxName string, layout *record.Layout) *HashIndex {
+	return &HashIndex{
+		tx:        tx,
+		idxName:   idxName,
+		layout:    layout,
+		keyFields: index.KeyFields(layout.Schema()),
+	}
+}
+
+// BeforeFirst searchKey のバケットを開き、その先頭に位置づける
+func (hi *HashIndex) BeforeFirst(searchKey *query.Constant) error {
+	if err := hi.Close(); err != nil {
+		return err
+	}
+	hi.searchKey = searchKey
+	ts, err := query.NewTableScan(hi.tx, BucketName(hi.idxName, searchKey), hi.layout)
+	if err != nil {
+		return err
+	}
+	hi.ts = ts
+	return nil
+}
+
+// Next バケットの中で searchKey と一致する次のレコードに進める
+// 複合索引では全ての列を指定したキーでしか検索できない
+func (hi *HashIndex) Next() (bool, error) {
+	for {
+		next, err := hi.ts.Next()
+		if err != nil {
+			return false, err
+		}
+		if !next {
+			return false, nil
+		}
+		val, err := hi.dataVal()
+		if err != nil {
+			return false, err
+		}
+		if val.Equals(hi.searchKey) {
+			return true, nil
+		}
+	}
+}
+
+func (hi *HashIndex) GetDataRID() (*record.RID, error) {
+	blockNum, err := hi.ts.GetInt(index.FieldBlock)
+	if err != nil {
+		return nil, err
+	}
+	id, err := hi.ts.GetInt(index.FieldID)
+	if err != nil {
+		return nil, err
+	}
+	return record.NewRID(blockNum, id), nil
+}
+
+func (hi *HashIndex) Insert(dataVal *query.Constant, dataRID *record.RID) error {
+	// 列の数が合わないキーは、バケットにレコードを作る前に断る
+	vals := index.SplitKey(dataVal, len(hi.keyFields))
+	if len(vals) != len(hi.keyFields) {
+		return fmt.Errorf("key %s does not match the index columns", dataVal)
+	}
+	if err := hi.BeforeFirst(dataVal); err != nil {
+		return err
+	}
+	if err := hi.ts.Insert(); err != nil {
+		return err
+	}
+	if err := hi.ts.SetInt(index.FieldBlock, dataRID.BlockNumber()); err != nil {
+		return err
+	}
+	if err := hi.ts.SetInt(index.FieldID, dataRID.Slot()); err != nil {
+		return err
+	}
+	for i, fieldName := range hi.keyFields {
+		if err := hi.ts.SetVal(fieldName, vals[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hi *HashIndex) dataVal() (*query.Constant, error) {
+	vals := make([]*query.Constant, len(hi.keyFields))
+	for i, fieldName := range hi.keyFields {
+		val, err := hi.ts.GetVal(fieldName)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return index.MakeKey(vals), nil
+}
+
+func (hi *HashIndex) Delete(dataVal *query.Constant, dataRID *record.RID) error {
+	if err := hi.BeforeFirst(dataVal); err != nil {
+		return err
+	}
+	for {
+		next, err := hi.Next()
+		if err != nil {
+			return err
+		}
+		if !next {
+			return nil
+		}
+		rid, err := hi.GetDataRID()
+		if err != nil {
+			return err
+		}
+		if rid.Equals(dataRID) {
+			return hi.ts.Delete()
+		}
+	}
+}
+
+// ForEach 全てのバケットのレコードについて fn を呼ぶ
+func (hi *HashIndex) ForEach(fn func(dataVal *query.Constant, dataRID *record.RID) error) error {
+	return hi.forEachRecord(func() error {
+		val, err := hi.dataVal()
+		if err != nil {
+			return err
+		}
+		rid, err := hi.GetDataRID()
+		if err != nil {
+			return err
+		}
+		return fn(val, rid)
+	})
+}
+
+// Clear 全てのバケットのレコードを削除する
+func (hi *HashIndex) Clear() error {
+	return hi.forEachRecord(func() error {
+		return hi.ts.Delete()
+	})
+}
+
+// forEachRecord 各バケットを順に開き、その全てのレコードに位置づけて fn を呼ぶ
+// まだ何も挿入していないバケットのファイルは、作らずに読み飛ばす
+func (hi *HashIndex) forEachRecord(fn func() error) error {
+	if err := hi.Close(); err != nil {
+		return err
+	}
+	defer hi.Close()
+	for bucket := range NumBuckets {
+		tableName := bucketName(hi.idxName, bucket)
+		size, err := hi.tx.Size(tableName + ".tbl")
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			continue
+		}
+		hi.Close()
+		if hi.ts, err = query.NewTableScan(hi.tx, tableName, hi.layout); err != nil {
+			return err
+		}
+		for {
+			next, err := hi.ts.Next()
+			if err != nil {
+				return err
+			}
+			if !next {
+				break
+			}
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (hi *HashIndex) Close() error {
+	if hi.ts != nil {
+		hi.ts.Close()
+		hi.ts = nil
+	}
+	return nil
+}
+
+// FileNames 索引 idxName の全てのバケットを格納するファイルと、その空き領域マップ
+func FileNames(idxName string) []string {
+	names := make([]string, 0, 2*NumBuckets)
+	for i := range NumBuckets {
+		names = append(names, bucketName(idxName, i)+".tbl", record.FreeSpaceMapFile(bucketName(idxName, i)))
+	}
+	return names
+}
+
+func bucketName(idxName string, bucket int) string {
+	return idxName + "_" + strconv.Itoa(bucket)
+}
+
+// BucketName key が格納されるバケットのテーブル名
+func BucketName(idxName string, key *query.Constant) string {
+	bucket := uint32(key.HashCode()) % NumBuckets
+	return bucketName(idxName, int(bucket))
+}
+
+// SearchCost 1つのバケットを読むのに必要なブロック数
+// 索引の numBlocks ブロック分のレコードがバケットに均等に分散していると仮定し、1つのバケットのレコードを rpb 個ずつ詰めたブロック数を返す
+// 空のバケットでも1ブロックは読む
+func SearchCost(numBlocks, rpb int32) int32 {
+	records := numBlocks * rpb / NumBuckets
+	return max((records+rpb-1)/rpb, 1)
+}
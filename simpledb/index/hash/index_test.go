@@ -0,0 +1,202 @@
+package hash_test
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"testing"
+
+	"simpledb/index"
+	"simpledb/index/hash"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/server"
+	"simpledb/tx"
+)
+
+// newIndexLayout VARCHAR(20) の列の索引のレイアウト
+func newIndexLayout(transaction *tx.Transaction) *record.Layout {
+	schema := record.NewSchema()
+	schema.AddIntField("block")
+	schema.AddIntField("id")
+	schema.AddStringField("dataval", 20)
+	return record.NewLayoutFromSchemaWithEncoding(schema, record.FixedFormat, transaction.Encoding())
+}
+
+// lookup key で検索して見つかった RID
+func lookup(t *testing.T, idx *hash.HashIndex, key string) []*record.RID {
+	t.Helper()
+	if err := idx.BeforeFirst(query.NewConstantWithString(key)); err != nil {
+		t.Fatalf("failed to before first: %v", err)
+	}
+	var rids []*record.RID
+	for {
+		next, err := idx.Next()
+		if err != nil {
+			t.Fatalf("failed to get next: %v", err)
+		}
+		if !next {
+			return rids
+		}
+		rid, err := idx.GetDataRID()
+		if err != nil {
+			t.Fatalf("failed to get data rid: %v", err)
+		}
+		rids = append(rids, rid)
+	}
+}
+
+// checkEntries entries の全てのキーで検索して RID が一致し、ForEach が entries のエントリだけを辿るか調べる
+func checkEntries(t *testing.T, idx *hash.HashIndex, entries map[string][]*record.RID) {
+	t.Helper()
+	count := 0
+	for key, want := range entries {
+		got := lookup(t, idx, key)
+		if len(got) != len(want) {
+			t.Fatalf("key %q: found %d entries, want %d", key, len(got), len(want))
+		}
+		for _, rid := range want {
+			if !slices.ContainsFunc(got, rid.Equals) {
+				t.Fatalf("key %q: %v not found", key, rid)
+			}
+		}
+		count += len(want)
+	}
+
+	visited := 0
+	err := idx.ForEach(func(key *query.Constant, rid *record.RID) error {
+		s, err := key.AsString()
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(entries[s], rid.Equals) {
+			return fmt.Errorf("unexpected entry %s %v", s, rid)
+		}
+		visited++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate entries: %v", err)
+	}
+	if visited != count {
+		t.Fatalf("ForEach visited %d entries, want %d", visited, count)
+	}
+}
+
+func TestHashIndex(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "hashtest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	idxName := "hashidx"
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	layout := newIndexLayout(transaction)
+	idx := hash.NewHashIndex(transaction, idxName, layout)
+
+	// 37 種類のキーを重複させて挿入し、複数のバケットに振り分ける
+	entries := make(map[string][]*record.RID)
+	buckets := make(map[string]bool)
+	for i := range 300 {
+		key := fmt.Sprintf("k%d", i%37)
+		rid := record.NewRID(int32(i/10), int32(i%10))
+		if err := idx.Insert(query.NewConstantWithString(key), rid); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		entries[key] = append(entries[key], rid)
+		buckets[hash.BucketName(idxName, query.NewConstantWithString(key))] = true
+	}
+	if len(buckets) < 2 {
+		t.Fatalf("keys are stored in %d buckets, want more than one", len(buckets))
+	}
+	// 列の数が合わないキーはバケットに何も残さない
+	badKey := index.MakeKey([]*query.Constant{query.NewConstantWithString("k1"), query.NewConstantWithInt(1)})
+	if err := idx.Insert(badKey, record.NewRID(999, 0)); err == nil {
+		t.Fatalf("inserting key %s into a single-column index succeeded", badKey)
+	}
+	checkEntries(t, idx, entries)
+	if got := lookup(t, idx, "absent"); len(got) != 0 {
+		t.Errorf("found %d entries for an absent key", len(got))
+	}
+
+	// 重複するキーのうち指定した RID のエントリだけを削除し、存在しないエントリの削除は何もしない
+	for key, rids := range entries {
+		var kept []*record.RID
+		for i, rid := range rids {
+			if i%2 == 0 {
+				kept = append(kept, rid)
+				continue
+			}
+			if err := idx.Delete(query.NewConstantWithString(key), rid); err != nil {
+				t.Fatalf("failed to delete: %v", err)
+			}
+		}
+		entries[key] = kept
+	}
+	if err := idx.Delete(query.NewConstantWithString("k1"), record.NewRID(999, 0)); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	checkEntries(t, idx, entries)
+	if err := idx.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// 空にした索引はどのキーでも何も見つからず、ロールバックすれば元のエントリに戻る
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	idx = hash.NewHashIndex(transaction, idxName, layout)
+	if err := idx.Clear(); err != nil {
+		t.Fatalf("failed to clear: %v", err)
+	}
+	empty := make(map[string][]*record.RID)
+	for key := range entries {
+		empty[key] = nil
+	}
+	checkEntries(t, idx, empty)
+	if err := idx.Insert(query.NewConstantWithString("k1"), record.NewRID(0, 0)); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	empty["k1"] = []*record.RID{record.NewRID(0, 0)}
+	checkEntries(t, idx, empty)
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	idx = hash.NewHashIndex(transaction, idxName, layout)
+	checkEntries(t, idx, entries)
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestSearchCost(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		numBlocks, rpb, want int32
+	}{
+		// 空の索引でもバケットの1ブロックは読む
+		{numBlocks: 0, rpb: 10, want: 1},
+		{numBlocks: 50, rpb: 10, want: 1},
+		{numBlocks: 100, rpb: 10, want: 1},
+		// 1つのバケットに 10 個を超えるレコードがあれば、2ブロック目も読む
+		{numBlocks: 150, rpb: 10, want: 2},
+		{numBlocks: 1000, rpb: 10, want: 10},
+	}
+	for _, tt := range tests {
+		if got := hash.SearchCost(tt.numBlocks, tt.rpb); got != tt.want {
+			t.Errorf("SearchCost(%d, %d) = %d, want %d", tt.numBlocks, tt.rpb, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package index は索引の実装 (btree, hash) が共有する索引レコードの形式を定義する
+package index
+
+import (
+	"strconv"
+
+	"simpledb/query"
+	"simpledb/record"
+)
+
+// 索引レコードのフィールド
+// キーは単一列の索引では dataval、複合索引では dataval0, dataval1, ... に列順に格納する
+// INCLUDE で指定した包含列は、キーの後ろの include0, include1, ... に格納する
+const (
+	FieldBlock    = "block"
+	FieldID       = "id"
+	FieldDataVal  = "dataval"
+	FieldIncluded = "include"
+)
+
+// DataValField 列数 n の索引で i 番目の列を格納するフィールド名
+func DataValField(i, n int) string {
+	if n == 1 {
+		return FieldDataVal
+	}
+	return FieldDataVal + strconv.Itoa(i)
+}
+
+// KeyFields 索引レコードのスキーマからキーを格納するフィールドを列順に返す
+func KeyFields(schema *record.Schema) []string {
+	if schema.HasField(FieldDataVal) {
+		return []string{FieldDataVal}
+	}
+	var fields []string
+	for i := 0; schema.HasField(FieldDataVal + strconv.Itoa(i)); i++ {
+		fields = append(fields, FieldDataVal+strconv.Itoa(i))
+	}
+	return fields
+}
+
+// IncludedField i 番目の包含列を格納するフィールド名
+func IncludedField(i int) string {
+	return FieldIncluded + strconv.Itoa(i)
+}
+
+// IncludedFields 索引レコードのスキーマから包含列を格納するフィールドを列順に返す
+func IncludedFields(schema *record.Schema) []string {
+	var fields []string
+	for i := 0; schema.HasField(IncludedField(i)); i++ {
+		fields = append(fields, IncludedField(i))
+	}
+	return fields
+}
+
+// MakeKey 各フィールドの値からキーを作成する。単一列の場合はその値をそのまま使う
+func MakeKey(vals []*query.Constant) *query.Constant {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return query.NewConstantWithTuple(vals...)
+}
+
+// SplitKey キーを各フィールドの値に分解する
+func SplitKey(key *query.Constant, n int) []*query.Constant {
+	if n == 1 && !key.IsTuple() {
+		return []*query.Constant{key}
+	}
+	vals, _ := key.AsTuple()
+	return vals
+}
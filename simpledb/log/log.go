@@ -113,6 +113,11 @@ func NewManager(fileManager *file.Manager, logFile string) (*Manager, error) {
 	return lm, nil
 }
 
+// Encoding ログレコードに書き込む文字列の符号化方式。データベースの符号化方式と同じ
+func (lm *Manager) Encoding() file.Encoding {
+	return lm.fileManager.Encoding()
+}
+
 func (lm *Manager) appendNewBlock() (file.BlockID, error) {
 	blk, err := lm.fileManager.Append(lm.logFile)
 	if err != nil {
@@ -0,0 +1,56 @@
+package metadata
+
+import (
+	"fmt"
+)
+
+// ConstraintType 制約の種類
+// PRIMARY KEY と UNIQUE は索引が裏付ける。制約を持たない通常の索引は ConstraintNone
+type ConstraintType string
+
+const (
+	ConstraintNone       ConstraintType = ""
+	ConstraintPrimaryKey ConstraintType = "primarykey"
+	ConstraintUnique     ConstraintType = "unique"
+	ConstraintForeignKey ConstraintType = "foreignkey"
+	ConstraintNotNull    ConstraintType = "notnull"
+	ConstraintCheck      ConstraintType = "check"
+)
+
+const maxConstraintType = 10
+
+// IsUnique キーの重複を許さない制約か
+func (c ConstraintType) IsUnique() bool {
+	return c == ConstraintPrimaryKey || c == ConstraintUnique
+}
+
+func (c ConstraintType) String() string {
+	switch c {
+	case ConstraintPrimaryKey:
+		return "PRIMARY KEY"
+	case ConstraintUnique:
+		return "UNIQUE"
+	case ConstraintForeignKey:
+		return "FOREIGN KEY"
+	case ConstraintNotNull:
+		return "NOT NULL"
+	case ConstraintCheck:
+		return "CHECK"
+	default:
+		return string(c)
+	}
+}
+
+// ConstraintViolationError 更新が制約に違反した
+type ConstraintViolationError struct {
+	Type       ConstraintType `json:"type"`
+	TableName  string         `json:"table"`
+	Constraint string         `json:"constraint"`
+	FieldNames []string       `json:"fields"`
+	Value      string         `json:"value"`
+	Detail     string         `json:"detail"`
+}
+
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf("%s constraint %q on %s violated: %s", e.Type, e.Constraint, e.TableName, e.Detail)
+}
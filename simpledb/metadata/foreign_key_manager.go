@@ -0,0 +1,262 @@
+package metadata
+
+import (
+	"fmt"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+const foreignKeyCatalogTableName = "fkcat"
+const foreignKeyCatalogFieldName = "fkname"
+const foreignKeyCatalogFieldTableName = "tablename"
+const foreignKeyCatalogFieldFieldName = "fieldname"
+const foreignKeyCatalogFieldRefTableName = "reftable"
+const foreignKeyCatalogFieldRefFieldName = "reffield"
+const foreignKeyCatalogFieldFieldPos = "fieldpos"
+const foreignKeyCatalogFieldOnDelete = "ondelete"
+const maxReferentialAction = 8
+
+// ReferentialAction 参照されている行を削除した時に、参照している行に対して行う動作
+type ReferentialAction string
+
+const (
+	ActionRestrict ReferentialAction = "restrict"
+	ActionCascade  ReferentialAction = "cascade"
+	ActionSetNull  ReferentialAction = "setnull"
+)
+
+func (a ReferentialAction) String() string {
+	switch a {
+	case ActionRestrict:
+		return "RESTRICT"
+	case ActionCascade:
+		return "CASCADE"
+	case ActionSetNull:
+		return "SET NULL"
+	default:
+		return string(a)
+	}
+}
+
+// ForeignKey 表 TableName の FieldNames が、表 RefTableName の RefFieldNames を参照する
+type ForeignKey struct {
+	Name          string
+	TableName     string
+	FieldNames    []string
+	RefTableName  string
+	RefFieldNames []string
+	OnDelete      ReferentialAction
+}
+
+// ForeignKeyManager 外部キーの定義を fkcat に格納する
+// 複数列の外部キーは列ごとに1行を持ち、fieldpos が外部キーの中での列の位置を表す
+type ForeignKeyManager struct {
+	layout *record.Layout
+}
+
+// NewForeignKeyManager fkcat を持たない既存のデータベースでは、ここで fkcat を作成する
+func NewForeignKeyManager(isNew bool, tableManager *TableManager, tx *tx.Transaction) (*ForeignKeyManager, error) {
+	layout, err := tableManager.GetLayout(foreignKeyCatalogTableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	if isNew || len(layout.Schema().Fields()) == 0 {
+		schema := record.NewSchema()
+		schema.AddStringField(foreignKeyCatalogFieldName, MaxName)
+		schema.AddStringField(foreignKeyCatalogFieldTableName, MaxName)
+		schema.AddStringField(foreignKeyCatalogFieldFieldName, MaxName)
+		schema.AddStringField(foreignKeyCatalogFieldRefTableName, MaxName)
+		schema.AddStringField(foreignKeyCatalogFieldRefFieldName, MaxName)
+		schema.AddIntField(foreignKeyCatalogFieldFieldPos)
+		schema.AddStringField(foreignKeyCatalogFieldOnDelete, maxReferentialAction)
+		if err := tableManager.CreateTable(foreignKeyCatalogTableName, schema, tx); err != nil {
+			return nil, err
+		}
+		layout = record.NewLayoutFromSchemaWithEncoding(schema, record.FixedFormat, tx.Encoding())
+	}
+	return &ForeignKeyManager{layout}, nil
+}
+
+func (fm *ForeignKeyManager) CreateForeignKey(fk *ForeignKey, tx *tx.Transaction) error {
+	if len(fk.FieldNames) == 0 || len(fk.FieldNames) != len(fk.RefFieldNames) {
+		return fmt.Errorf("foreign key %q: number of referencing and referenced columns differ", fk.Name)
+	}
+	switch fk.OnDelete {
+	case ActionRestrict, ActionCascade, ActionSetNull:
+	default:
+		return fmt.Errorf("foreign key %q: unknown referential action %q", fk.Name, fk.OnDelete)
+	}
+	fks, err := fm.readForeignKeys(tx)
+	if err != nil {
+		return err
+	}
+	for _, other := range fks {
+		if other.Name == fk.Name {
+			return fmt.Errorf("foreign key %q already exists", fk.Name)
+		}
+	}
+
+	ts, err := query.NewTableScan(tx, foreignKeyCatalogTableName, fm.layout)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+
+	for pos, fieldName := range fk.FieldNames {
+		if err := ts.Insert(); err != nil {
+			return err
+		}
+		if err := ts.SetString(foreignKeyCatalogFieldName, fk.Name); err != nil {
+			return err
+		}
+		if err := ts.SetString(foreignKeyCatalogFieldTableName, fk.TableName); err != nil {
+			return err
+		}
+		if err := ts.SetString(foreignKeyCatalogFieldFieldName, fieldName); err != nil {
+			return err
+		}
+		if err := ts.SetString(foreignKeyCatalogFieldRefTableName, fk.RefTableName); err != nil {
+			return err
+		}
+		if err := ts.SetString(foreignKeyCatalogFieldRefFieldName, fk.RefFieldNames[pos]); err != nil {
+			return err
+		}
+		if err := ts.SetInt(foreignKeyCatalogFieldFieldPos, int32(pos)); err != nil {
+			return err
+		}
+		if err := ts.SetString(foreignKeyCatalogFieldOnDelete, string(fk.OnDelete)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropForeignKeys tableName が参照する側の外部キーを削除する
+func (fm *ForeignKeyManager) DropForeignKeys(tableName string, tx *tx.Transaction) error {
+	_, err := deleteCatalogRows(tx, foreignKeyCatalogTableName, fm.layout, foreignKeyCatalogFieldTableName, tableName)
+	return err
+}
+
+// DropForeignKey 外部キー fkName を削除する
+func (fm *ForeignKeyManager) DropForeignKey(fkName string, tx *tx.Transaction) error {
+	_, err := deleteCatalogRows(tx, foreignKeyCatalogTableName, fm.layout, foreignKeyCatalogFieldName, fkName)
+	return err
+}
+
+// RenameTable 参照する側と参照される側の両方で、表 tableName を newTableName にする
+func (fm *ForeignKeyManager) RenameTable(tableName string, newTableName string, tx *tx.Transaction) error {
+	where := map[string]string{foreignKeyCatalogFieldTableName: tableName}
+	if err := updateCatalogRows(tx, foreignKeyCatalogTableName, fm.layout, where, foreignKeyCatalogFieldTableName, newTableName); err != nil {
+		return err
+	}
+	where = map[string]string{foreignKeyCatalogFieldRefTableName: tableName}
+	return updateCatalogRows(tx, foreignKeyCatalogTableName, fm.layout, where, foreignKeyCatalogFieldRefTableName, newTableName)
+}
+
+// RenameField 参照する側と参照される側の両方で、表 tableName の列 fieldName を newFieldName にする
+func (fm *ForeignKeyManager) RenameField(tableName string, fieldName string, newFieldName string, tx *tx.Transaction) error {
+	where := map[string]string{foreignKeyCatalogFieldTableName: tableName, foreignKeyCatalogFieldFieldName: fieldName}
+	if err := updateCatalogRows(tx, foreignKeyCatalogTableName, fm.layout, where, foreignKeyCatalogFieldFieldName, newFieldName); err != nil {
+		return err
+	}
+	where = map[string]string{foreignKeyCatalogFieldRefTableName: tableName, foreignKeyCatalogFieldRefFieldName: fieldName}
+	return updateCatalogRows(tx, foreignKeyCatalogTableName, fm.layout, where, foreignKeyCatalogFieldRefFieldName, newFieldName)
+}
+
+// GetForeignKeys tableName が参照する側の外部キー
+func (fm *ForeignKeyManager) GetForeignKeys(tableName string, tx *tx.Transaction) ([]*ForeignKey, error) {
+	return fm.filter(tx, func(fk *ForeignKey) bool { return fk.TableName == tableName })
+}
+
+// GetReferencingKeys tableName を参照する外部キー
+func (fm *ForeignKeyManager) GetReferencingKeys(tableName string, tx *tx.Transaction) ([]*ForeignKey, error) {
+	return fm.filter(tx, func(fk *ForeignKey) bool { return fk.RefTableName == tableName })
+}
+
+func (fm *ForeignKeyManager) filter(tx *tx.Transaction, pred func(*ForeignKey) bool) ([]*ForeignKey, error) {
+	fks, err := fm.readForeignKeys(tx)
+	if err != nil {
+		return nil, err
+	}
+	var result []*ForeignKey
+	for _, fk := range fks {
+		if pred(fk) {
+			result = append(result, fk)
+		}
+	}
+	return result, nil
+}
+
+// readForeignKeys fkcat から外部キーの定義を作成された順に読む
+func (fm *ForeignKeyManager) readForeignKeys(tx *tx.Transaction) ([]*ForeignKey, error) {
+	var fks []*ForeignKey
+	byName := make(map[string]*ForeignKey)
+	positions := make(map[string]map[int32][2]string)
+
+	ts, err := query.NewTableScan(tx, foreignKeyCatalogTableName, fm.layout)
+	if err != nil {
+		return nil, err
+	}
+	defer ts.Close()
+	for {
+		next, err := ts.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			break
+		}
+		name, err := ts.GetString(foreignKeyCatalogFieldName)
+		if err != nil {
+			return nil, err
+		}
+		tableName, err := ts.GetString(foreignKeyCatalogFieldTableName)
+		if err != nil {
+			return nil, err
+		}
+		fieldName, err := ts.GetString(foreignKeyCatalogFieldFieldName)
+		if err != nil {
+			return nil, err
+		}
+		refTableName, err := ts.GetString(foreignKeyCatalogFieldRefTableName)
+		if err != nil {
+			return nil, err
+		}
+		refFieldName, err := ts.GetString(foreignKeyCatalogFieldRefFieldName)
+		if err != nil {
+			return nil, err
+		}
+		pos, err := ts.GetInt(foreignKeyCatalogFieldFieldPos)
+		if err != nil {
+			return nil, err
+		}
+		onDelete, err := ts.GetString(foreignKeyCatalogFieldOnDelete)
+		if err != nil {
+			return nil, err
+		}
+
+		fk, ok := byName[name]
+		if !ok {
+			fk = &ForeignKey{Name: name, TableName: tableName, RefTableName: refTableName, OnDelete: ReferentialAction(onDelete)}
+			byName[name] = fk
+			positions[name] = make(map[int32][2]string)
+			fks = append(fks, fk)
+		}
+		positions[name][pos] = [2]string{fieldName, refFieldName}
+	}
+
+	for _, fk := range fks {
+		n := len(positions[fk.Name])
+		fk.FieldNames = make([]string, n)
+		fk.RefFieldNames = make([]string, n)
+		for pos, names := range positions[fk.Name] {
+			if int(pos) >= n {
+				return nil, fmt.Errorf("foreign key %q: invalid column position %d", fk.Name, pos)
+			}
+			fk.FieldNames[pos] = names[0]
+			fk.RefFieldNames[pos] = names[1]
+		}
+	}
+	return fks, nil
+}
@@ -1,74 +1,240 @@
 package metadata
 
 import (
+	"fmt"
+	"simpledb/index"
 	"simpledb/index/btree"
+	"simpledb/index/hash"
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/tx"
+	"slices"
+	"strings"
 )
 
-const indexInfoFieldBlock = "block"
-const indexInfoFieldId = "id"
-const indexInfoFieldDataVal = "dataval"
-
 const indexCatalogTableName = "idxcat"
 const indexCatalogFieldIndexName = "indexname"
 const indexCatalogFieldTableName = "tablename"
 const indexCatalogFieldFieldName = "fieldname"
+const indexCatalogFieldIndexType = "indextype"
+const indexCatalogFieldFieldPos = "fieldpos"
+const indexCatalogFieldConstraint = "constraint"
+const indexCatalogFieldIncluded = "included"
+const maxIndexType = 8
+
+// IndexType 索引の実装の種類
+type IndexType string
+
+const (
+	IndexTypeBTree IndexType = "btree"
+	IndexTypeHash  IndexType = "hash"
+)
+
+// SupportsPrefix 複合索引の先頭の一部の列だけで検索できるか。ハッシュ索引は全ての列を指定する必要がある
+func (t IndexType) SupportsPrefix() bool {
+	return t == IndexTypeBTree
+}
+
+// SupportsIndexOnly 索引のレコードから列の値を返し、データレコードを読まずに済ませられるか
+func (t IndexType) SupportsIndexOnly() bool {
+	return t == IndexTypeBTree
+}
+
+// IndexKey GetIndexInfo が返す map のキー。複合索引では列名をカンマで連結する
+func IndexKey(fieldNames []string) string {
+	return strings.Join(fieldNames, ",")
+}
 
 type IndexInfo struct {
-	indexName   string
-	fieldName   string
-	tx          *tx.Transaction
-	tableSchema *record.Schema
-	indexLayout *record.Layout
-	si          *StatInfo
+	indexName  string
+	fieldNames []string
+	// includedFields INCLUDE で指定した、キーには含めずに葉のレコードに格納する列
+	includedFields []string
+	indexType      IndexType
+	constraint     ConstraintType
+	tx             *tx.Transaction
+	tableSchema    *record.Schema
+	indexLayout    *record.Layout
+	si             *StatInfo
 }
 
-func NewIndexInfo(indexName string, fieldName string, tableSchema *record.Schema, tx *tx.Transaction, si *StatInfo) *IndexInfo {
-	ii := &IndexInfo{indexName, fieldName, tx, tableSchema, nil, si}
+func NewIndexInfo(indexName string, fieldNames []string, includedFields []string, indexType IndexType, constraint ConstraintType, tableSchema *record.Schema, tx *tx.Transaction, si *StatInfo) *IndexInfo {
+	ii := &IndexInfo{indexName, fieldNames, includedFields, indexType, constraint, tx, tableSchema, nil, si}
 	ii.indexLayout = ii.createIndexLayout()
 	return ii
 }
 
 func (ii *IndexInfo) Open() (query.Index, error) {
-	return btree.NewBTreeIndex(ii.tx, ii.indexName, ii.indexLayout)
+	switch ii.indexType {
+	case IndexTypeHash:
+		return hash.NewHashIndex(ii.tx, ii.indexName, ii.indexLayout), nil
+	default:
+		return btree.NewBTreeIndex(ii.tx, ii.indexName, ii.indexLayout)
+	}
+}
+
+func (ii *IndexInfo) IndexName() string {
+	return ii.indexName
+}
+
+func (ii *IndexInfo) IndexType() IndexType {
+	return ii.indexType
+}
+
+// Constraint 索引が裏付ける制約。通常の索引では ConstraintNone
+func (ii *IndexInfo) Constraint() ConstraintType {
+	return ii.constraint
+}
+
+// FieldNames 索引の列。複合索引では索引の列順に並ぶ
+func (ii *IndexInfo) FieldNames() []string {
+	return ii.fieldNames
+}
+
+// IncludedFieldNames INCLUDE で指定した包含列
+func (ii *IndexInfo) IncludedFieldNames() []string {
+	return ii.includedFields
+}
+
+// Covers 列 fieldName の値を索引のレコードに持つか
+func (ii *IndexInfo) Covers(fieldName string) bool {
+	_, ok := ii.EntryField(fieldName)
+	return ok
+}
+
+// EntryField 表の列 fieldName の値を格納する索引のレコードのフィールド
+func (ii *IndexInfo) EntryField(fieldName string) (string, bool) {
+	if i := slices.Index(ii.fieldNames, fieldName); i >= 0 {
+		return index.DataValField(i, len(ii.fieldNames)), true
+	}
+	if i := slices.Index(ii.includedFields, fieldName); i >= 0 {
+		return index.IncludedField(i), true
+	}
+	return "", false
+}
+
+// Layout 索引のレコードのレイアウト
+func (ii *IndexInfo) Layout() *record.Layout {
+	return ii.indexLayout
+}
+
+// KeyOf s の現在のレコードの索引キー
+func (ii *IndexInfo) KeyOf(s query.Scan) (*query.Constant, error) {
+	vals := make([]*query.Constant, len(ii.fieldNames))
+	for i, fieldName := range ii.fieldNames {
+		val, err := s.GetVal(fieldName)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return index.MakeKey(vals), nil
+}
+
+// InsertEntry s の現在のレコードを指すエントリを索引 idx に挿入する。包含列があればその値も格納する
+func (ii *IndexInfo) InsertEntry(idx query.Index, s query.Scan, rid *record.RID) error {
+	key, err := ii.KeyOf(s)
+	if err != nil {
+		return err
+	}
+	if len(ii.includedFields) == 0 {
+		return idx.Insert(key, rid)
+	}
+	ci, ok := idx.(query.CoveringIndex)
+	if !ok {
+		return fmt.Errorf("index %q cannot store included columns", ii.indexName)
+	}
+	included := make([]*query.Constant, len(ii.includedFields))
+	for i, fieldName := range ii.includedFields {
+		if included[i], err = s.GetVal(fieldName); err != nil {
+			return err
+		}
+	}
+	return ci.InsertIncluding(key, rid, included)
+}
+
+// FileNames 索引を格納するファイル
+func (ii *IndexInfo) FileNames() []string {
+	return IndexFileNames(ii.indexName, ii.indexType)
+}
+
+// IndexFileNames 種類が indexType である索引 indexName を格納するファイル
+func IndexFileNames(indexName string, indexType IndexType) []string {
+	switch indexType {
+	case IndexTypeHash:
+		return hash.FileNames(indexName)
+	default:
+		return btree.FileNames(indexName)
+	}
 }
 
 func (ii *IndexInfo) BlocksAccessed() int32 {
 	rpb := int32(ii.tx.BlockSize() / ii.indexLayout.SlotSize())
 	numblocks := ii.si.RecordsOutput() / rpb
 
-	return btree.SearchCost(numblocks, rpb)
+	switch ii.indexType {
+	case IndexTypeHash:
+		return hash.SearchCost(numblocks, rpb)
+	default:
+		return btree.SearchCost(numblocks, rpb)
+	}
 }
 
 func (ii *IndexInfo) RecordsOutput() int32 {
-	return ii.si.RecordsOutput() / ii.si.DistinctValues(ii.fieldName)
+	return ii.RecordsOutputForPrefix(len(ii.fieldNames))
+}
+
+// RecordsOutputForPrefix 先頭の n 列を等価条件で検索した時に得られるレコード数の見積もり
+func (ii *IndexInfo) RecordsOutputForPrefix(n int) int32 {
+	output := ii.si.RecordsOutput()
+	for _, fieldName := range ii.fieldNames[:n] {
+		output /= ii.si.DistinctValues(fieldName)
+	}
+	return output
 }
 
 func (ii *IndexInfo) DistinctValues(fname string) int32 {
 	var result int32
-	if ii.fieldName == fname {
+	if slices.Contains(ii.fieldNames, fname) {
 		result = 1
 	} else {
-		result = ii.si.DistinctValues(ii.fieldName)
+		result = ii.si.DistinctValues(ii.fieldNames[0])
 	}
 	return result
 }
 
+// checkLayout 索引のレコードがブロックに収まるか調べる。B-tree 索引は葉とディレクトリに2つ以上のレコードを持てなければならない
+func (ii *IndexInfo) checkLayout() error {
+	if ii.indexType == IndexTypeBTree {
+		return btree.CheckLayout(ii.tx, ii.indexLayout)
+	}
+	return ii.indexLayout.CheckFits(ii.tx.BlockSize())
+}
+
 func (ii *IndexInfo) createIndexLayout() *record.Layout {
 	schema := record.NewSchema()
-	schema.AddIntField(indexInfoFieldBlock)
-	schema.AddIntField(indexInfoFieldId)
-	if ii.tableSchema.Type(ii.fieldName) == record.INT {
-		schema.AddIntField(indexInfoFieldDataVal)
-	} else {
-		fldlen := ii.tableSchema.Length(ii.fieldName)
-		schema.AddStringField(indexInfoFieldDataVal, fldlen)
+	schema.AddIntField(index.FieldBlock)
+	schema.AddIntField(index.FieldID)
+	add := func(indexField, fieldName string) {
+		if ii.tableSchema.Type(fieldName) == record.INT {
+			schema.AddIntField(indexField)
+		} else {
+			schema.AddStringField(indexField, ii.tableSchema.Length(fieldName))
+		}
+	}
+	for i, fieldName := range ii.fieldNames {
+		add(index.DataValField(i, len(ii.fieldNames)), fieldName)
+	}
+	for i, fieldName := range ii.includedFields {
+		add(index.IncludedField(i), fieldName)
 	}
-	return record.NewLayoutFromSchema(schema)
+	return record.NewLayoutFromSchemaWithEncoding(schema, record.FixedFormat, ii.tx.Encoding())
 }
 
+// IndexManager 索引の定義を idxcat に格納する
+// 複合索引は列ごとに1行を持ち、fieldpos が索引の中での列の位置を表す
+// INCLUDE で指定した包含列も列ごとに1行を持ち、included が 1 で、fieldpos は包含列の中での位置を表す
+// PRIMARY KEY や UNIQUE 制約は B-tree 索引で実現し、constraint に制約の種類を記録する
 type IndexManager struct {
 	layout       *record.Layout
 	tableManager *TableManager
@@ -81,6 +247,10 @@ func NewIndexManager(isNew bool, tableManager *TableManager, statManager *StatMa
 		schema.AddStringField(indexCatalogFieldIndexName, MaxName)
 		schema.AddStringField(indexCatalogFieldTableName, MaxName)
 		schema.AddStringField(indexCatalogFieldFieldName, MaxName)
+		schema.AddStringField(indexCatalogFieldIndexType, maxIndexType)
+		schema.AddIntField(indexCatalogFieldFieldPos)
+		schema.AddStringField(indexCatalogFieldConstraint, maxConstraintType)
+		schema.AddIntField(indexCatalogFieldIncluded)
 		err := tableManager.CreateTable(indexCatalogTableName, schema, tx)
 		if err != nil {
 			return nil, err
@@ -93,30 +263,209 @@ func NewIndexManager(isNew bool, tableManager *TableManager, statManager *StatMa
 	return &IndexManager{layout, tableManager, statManager}, nil
 }
 
-func (im *IndexManager) CreateIndex(indexName string, tableName string, fieldName string, tx *tx.Transaction) error {
-	ts, err := query.NewTableScan(tx, indexCatalogTableName, im.layout)
+// CreateIndex 列 fieldNames をキーとする索引を作成する。includedFields の列の値も葉のレコードに格納する
+func (im *IndexManager) CreateIndex(indexName string, tableName string, fieldNames []string, includedFields []string, indexType IndexType, tx *tx.Transaction) error {
+	return im.createIndex(indexName, tableName, fieldNames, includedFields, indexType, ConstraintNone, tx)
+}
+
+// CreateKeyIndex PRIMARY KEY や UNIQUE 制約を裏付ける B-tree 索引を作成する
+func (im *IndexManager) CreateKeyIndex(indexName string, tableName string, fieldNames []string, constraint ConstraintType, tx *tx.Transaction) error {
+	if !constraint.IsUnique() {
+		return fmt.Errorf("index %q: %q is not a key constraint", indexName, constraint)
+	}
+	return im.createIndex(indexName, tableName, fieldNames, nil, IndexTypeBTree, constraint, tx)
+}
+
+func (im *IndexManager) createIndex(indexName string, tableName string, fieldNames []string, includedFields []string, indexType IndexType, constraint ConstraintType, tx *tx.Transaction) error {
+	switch indexType {
+	case IndexTypeBTree, IndexTypeHash:
+	default:
+		return fmt.Errorf("unknown index type: %q", indexType)
+	}
+	if len(fieldNames) == 0 {
+		return fmt.Errorf("index %q has no columns", indexName)
+	}
+	// indextype や fieldpos を持たない古いカタログは、単一列の B-tree 索引しか格納できない
+	if !im.layout.Schema().HasField(indexCatalogFieldIndexType) && indexType != IndexTypeBTree {
+		return fmt.Errorf("index catalog does not support index type %q", indexType)
+	}
+	if !im.layout.Schema().HasField(indexCatalogFieldFieldPos) && len(fieldNames) > 1 {
+		return fmt.Errorf("index catalog does not support composite indexes")
+	}
+	if !im.layout.Schema().HasField(indexCatalogFieldConstraint) && constraint != ConstraintNone {
+		return fmt.Errorf("index catalog does not support %s constraints", constraint)
+	}
+	if len(includedFields) > 0 {
+		if !im.layout.Schema().HasField(indexCatalogFieldIncluded) {
+			return fmt.Errorf("index catalog does not support included columns")
+		}
+		// 包含列は B-tree 索引の葉にだけ格納する
+		if indexType != IndexTypeBTree {
+			return fmt.Errorf("index %q: included columns are only supported by btree indexes", indexName)
+		}
+		for i, fieldName := range includedFields {
+			if slices.Contains(fieldNames, fieldName) || slices.Contains(includedFields[:i], fieldName) {
+				return fmt.Errorf("index %q: column %q is included more than once", indexName, fieldName)
+			}
+		}
+	}
+
+	// 索引のレコードが収まらなければ、B-tree 索引はノードを分割できず、ハッシュ索引はバケットに格納できない
+	tblLayout, err := im.tableManager.GetLayout(tableName, tx)
 	if err != nil {
 		return err
 	}
-	defer ts.Close()
+	ii := NewIndexInfo(indexName, fieldNames, includedFields, indexType, constraint, tblLayout.Schema(), tx, nil)
+	if err := ii.checkLayout(); err != nil {
+		return fmt.Errorf("index %q: %w", indexName, err)
+	}
 
-	if err := ts.Insert(); err != nil {
+	// GetIndexInfo は列の組をキーにするため、同じ列の組に2つ目の索引は作れない
+	defs, err := im.readIndexDefs("", tx)
+	if err != nil {
 		return err
 	}
-	if err := ts.SetString(indexCatalogFieldIndexName, indexName); err != nil {
-		return err
+	for _, def := range defs {
+		if def.indexName == indexName {
+			return fmt.Errorf("index %q already exists", indexName)
+		}
+		if def.tableName == tableName && slices.Equal(def.fieldNames, fieldNames) {
+			return fmt.Errorf("index %q already exists on %s (%s)", def.indexName, tableName, strings.Join(fieldNames, ", "))
+		}
 	}
-	if err := ts.SetString(indexCatalogFieldTableName, tableName); err != nil {
+
+	ts, err := query.NewTableScan(tx, indexCatalogTableName, im.layout)
+	if err != nil {
 		return err
 	}
-	if err := ts.SetString(indexCatalogFieldFieldName, fieldName); err != nil {
-		return err
+	defer ts.Close()
+
+	insert := func(pos int, fieldName string, included bool) error {
+		if err := ts.Insert(); err != nil {
+			return err
+		}
+		if err := ts.SetString(indexCatalogFieldIndexName, indexName); err != nil {
+			return err
+		}
+		if err := ts.SetString(indexCatalogFieldTableName, tableName); err != nil {
+			return err
+		}
+		if err := ts.SetString(indexCatalogFieldFieldName, fieldName); err != nil {
+			return err
+		}
+		if ts.HasField(indexCatalogFieldIndexType) {
+			if err := ts.SetString(indexCatalogFieldIndexType, string(indexType)); err != nil {
+				return err
+			}
+		}
+		if ts.HasField(indexCatalogFieldFieldPos) {
+			if err := ts.SetInt(indexCatalogFieldFieldPos, int32(pos)); err != nil {
+				return err
+			}
+		}
+		if ts.HasField(indexCatalogFieldConstraint) {
+			if err := ts.SetString(indexCatalogFieldConstraint, string(constraint)); err != nil {
+				return err
+			}
+		}
+		if ts.HasField(indexCatalogFieldIncluded) {
+			var flag int32
+			if included {
+				flag = 1
+			}
+			if err := ts.SetInt(indexCatalogFieldIncluded, flag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for pos, fieldName := range fieldNames {
+		if err := insert(pos, fieldName, false); err != nil {
+			return err
+		}
+	}
+	for pos, fieldName := range includedFields {
+		if err := insert(pos, fieldName, true); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// GetIndexInfo tableName の索引を返す
+// 単一列の索引は列名、複合索引は IndexKey で連結した列名をキーとする
 func (im *IndexManager) GetIndexInfo(tableName string, tx *tx.Transaction) (map[string]*IndexInfo, error) {
 	result := make(map[string]*IndexInfo)
+	defs, err := im.readIndexDefs(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		return result, nil
+	}
+	tblLayout, err := im.tableManager.GetLayout(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	tblsi, err := im.statManager.GetStatInfo(tableName, tblLayout, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, def := range defs {
+		ii := NewIndexInfo(def.indexName, def.fieldNames, def.includedFields, def.indexType, def.constraint, tblLayout.Schema(), tx, tblsi)
+		result[IndexKey(def.fieldNames)] = ii
+	}
+	return result, nil
+}
+
+// GetIndexTable 索引 indexName が作られた表。索引が存在しなければ空文字を返す
+func (im *IndexManager) GetIndexTable(indexName string, tx *tx.Transaction) (string, error) {
+	defs, err := im.readIndexDefs("", tx)
+	if err != nil {
+		return "", err
+	}
+	for _, def := range defs {
+		if def.indexName == indexName {
+			return def.tableName, nil
+		}
+	}
+	return "", nil
+}
+
+// DropIndex idxcat から索引の定義を削除する。索引のファイルは削除しない
+func (im *IndexManager) DropIndex(indexName string, tx *tx.Transaction) error {
+	_, err := deleteCatalogRows(tx, indexCatalogTableName, im.layout, indexCatalogFieldIndexName, indexName)
+	return err
+}
+
+// RenameTable 表 tableName の索引を、表 newTableName の索引にする
+func (im *IndexManager) RenameTable(tableName string, newTableName string, tx *tx.Transaction) error {
+	where := map[string]string{indexCatalogFieldTableName: tableName}
+	return updateCatalogRows(tx, indexCatalogTableName, im.layout, where, indexCatalogFieldTableName, newTableName)
+}
+
+// RenameField 表 tableName の索引の列 fieldName を newFieldName にする
+func (im *IndexManager) RenameField(tableName string, fieldName string, newFieldName string, tx *tx.Transaction) error {
+	where := map[string]string{indexCatalogFieldTableName: tableName, indexCatalogFieldFieldName: fieldName}
+	return updateCatalogRows(tx, indexCatalogTableName, im.layout, where, indexCatalogFieldFieldName, newFieldName)
+}
+
+type indexDef struct {
+	indexName      string
+	tableName      string
+	indexType      IndexType
+	constraint     ConstraintType
+	fieldNames     []string
+	includedFields []string
+}
+
+// readIndexDefs idxcat から索引の定義を作成された順に読む。tableName が空なら全ての表の索引を返す
+func (im *IndexManager) readIndexDefs(tableName string, tx *tx.Transaction) ([]*indexDef, error) {
+	var defs []*indexDef
+	byName := make(map[string]*indexDef)
+	positions := make(map[string]map[int32]string)
+	includedPositions := make(map[string]map[int32]string)
+
 	ts, err := query.NewTableScan(tx, indexCatalogTableName, im.layout)
 	if err != nil {
 		return nil, err
@@ -134,26 +483,84 @@ func (im *IndexManager) GetIndexInfo(tableName string, tx *tx.Transaction) (map[
 		if err != nil {
 			return nil, err
 		}
-		if tn == tableName {
-			indexName, err := ts.GetString(indexCatalogFieldIndexName)
+		if tableName != "" && tn != tableName {
+			continue
+		}
+		indexName, err := ts.GetString(indexCatalogFieldIndexName)
+		if err != nil {
+			return nil, err
+		}
+		fieldName, err := ts.GetString(indexCatalogFieldFieldName)
+		if err != nil {
+			return nil, err
+		}
+		// indextype を持たない古いカタログの索引は全て B-tree 索引
+		indexType := IndexTypeBTree
+		if ts.HasField(indexCatalogFieldIndexType) {
+			it, err := ts.GetString(indexCatalogFieldIndexType)
 			if err != nil {
 				return nil, err
 			}
-			fieldName, err := ts.GetString(indexCatalogFieldFieldName)
+			indexType = IndexType(it)
+		}
+		var pos int32
+		if ts.HasField(indexCatalogFieldFieldPos) {
+			pos, err = ts.GetInt(indexCatalogFieldFieldPos)
 			if err != nil {
 				return nil, err
 			}
-			tblLayout, err := im.tableManager.GetLayout(tableName, tx)
+		}
+		constraint := ConstraintNone
+		if ts.HasField(indexCatalogFieldConstraint) {
+			c, err := ts.GetString(indexCatalogFieldConstraint)
 			if err != nil {
 				return nil, err
 			}
-			tblsi, err := im.statManager.GetStatInfo(tableName, tblLayout, tx)
-			if err != nil {
+			constraint = ConstraintType(c)
+		}
+		var included int32
+		if ts.HasField(indexCatalogFieldIncluded) {
+			if included, err = ts.GetInt(indexCatalogFieldIncluded); err != nil {
 				return nil, err
 			}
-			ii := NewIndexInfo(indexName, fieldName, tblLayout.Schema(), tx, tblsi)
-			result[fieldName] = ii
+		}
+
+		def, ok := byName[indexName]
+		if !ok {
+			def = &indexDef{indexName: indexName, tableName: tn, indexType: indexType, constraint: constraint}
+			byName[indexName] = def
+			positions[indexName] = make(map[int32]string)
+			includedPositions[indexName] = make(map[int32]string)
+			defs = append(defs, def)
+		}
+		if included != 0 {
+			includedPositions[indexName][pos] = fieldName
+		} else {
+			positions[indexName][pos] = fieldName
 		}
 	}
-	return result, nil
+
+	// orderFields 位置から列名への対応を、位置の順に並べる
+	orderFields := func(indexName string, positions map[int32]string) ([]string, error) {
+		if len(positions) == 0 {
+			return nil, nil
+		}
+		fieldNames := make([]string, len(positions))
+		for pos, fieldName := range positions {
+			if pos < 0 || int(pos) >= len(fieldNames) {
+				return nil, fmt.Errorf("index %q: invalid column position %d", indexName, pos)
+			}
+			fieldNames[pos] = fieldName
+		}
+		return fieldNames, nil
+	}
+	for _, def := range defs {
+		if def.fieldNames, err = orderFields(def.indexName, positions[def.indexName]); err != nil {
+			return nil, err
+		}
+		if def.includedFields, err = orderFields(def.indexName, includedPositions[def.indexName]); err != nil {
+			return nil, err
+		}
+	}
+	return defs, nil
 }
@@ -11,6 +11,7 @@ type Manager struct {
 	viewManager  *ViewManager
 	statManager  *StatManager
 	indexManager *IndexManager
+	fkManager    *ForeignKeyManager
 }
 
 func NewManager(isNew bool, tx *tx.Transaction) (*Manager, error) {
@@ -39,13 +40,79 @@ func NewManager(isNew bool, tx *tx.Transaction) (*Manager, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Manager{tableManager, viewManager, statManager, indexManager}, nil
+
+	logger.Tracef("NewForeignKeyManager(isNew=%t)", isNew)
+	fkManager, err := NewForeignKeyManager(isNew, tableManager, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{tableManager, viewManager, statManager, indexManager, fkManager}, nil
 }
 
 func (mm *Manager) CreateTable(tableName string, schema *record.Schema, tx *tx.Transaction) error {
 	return mm.tableManager.CreateTable(tableName, schema, tx)
 }
 
+// CreateTableWithConstraints 格納形式 format の表を、列の NOT NULL, DEFAULT, CHECK 制約とともに作成する
+func (mm *Manager) CreateTableWithConstraints(tableName string, schema *record.Schema, format record.Format, constraints map[string]*FieldConstraint, tx *tx.Transaction) error {
+	return mm.tableManager.CreateTableWithConstraints(tableName, schema, format, constraints, tx)
+}
+
+func (mm *Manager) GetFieldConstraints(tableName string, tx *tx.Transaction) (map[string]*FieldConstraint, error) {
+	return mm.tableManager.GetFieldConstraints(tableName, tx)
+}
+
+// DropTable 表の定義と、表の外部キーの定義を削除する。表の索引や、表のファイルは削除しない
+func (mm *Manager) DropTable(tableName string, tx *tx.Transaction) error {
+	if err := mm.fkManager.DropForeignKeys(tableName, tx); err != nil {
+		return err
+	}
+	if err := mm.tableManager.DropTable(tableName, tx); err != nil {
+		return err
+	}
+	mm.statManager.Forget(tableName)
+	return nil
+}
+
+// AlterTable 表 tableName の定義を、名前 newTableName、スキーマ schema、列の制約 constraints の表の定義で置き換える
+// 表の格納形式、索引と外部キーの定義は変更しない
+func (mm *Manager) AlterTable(tableName string, newTableName string, schema *record.Schema, constraints map[string]*FieldConstraint, tx *tx.Transaction) error {
+	layout, err := mm.tableManager.GetLayout(tableName, tx)
+	if err != nil {
+		return err
+	}
+	if err := mm.tableManager.DropTable(tableName, tx); err != nil {
+		return err
+	}
+	if err := mm.tableManager.CreateTableWithConstraints(newTableName, schema, layout.Format(), constraints, tx); err != nil {
+		return err
+	}
+	mm.statManager.Forget(tableName)
+	mm.statManager.Forget(newTableName)
+	return nil
+}
+
+// RenameTable 索引と外部キーの定義の中の表 tableName を newTableName にする
+func (mm *Manager) RenameTable(tableName string, newTableName string, tx *tx.Transaction) error {
+	if err := mm.indexManager.RenameTable(tableName, newTableName, tx); err != nil {
+		return err
+	}
+	return mm.fkManager.RenameTable(tableName, newTableName, tx)
+}
+
+// RenameField 索引と外部キーの定義の中の表 tableName の列 fieldName を newFieldName にする
+func (mm *Manager) RenameField(tableName string, fieldName string, newFieldName string, tx *tx.Transaction) error {
+	if err := mm.indexManager.RenameField(tableName, fieldName, newFieldName, tx); err != nil {
+		return err
+	}
+	return mm.fkManager.RenameField(tableName, fieldName, newFieldName, tx)
+}
+
+// GetTableNames カタログを除く全ての表の名前
+func (mm *Manager) GetTableNames(tx *tx.Transaction) ([]string, error) {
+	return mm.tableManager.GetTableNames(tx)
+}
+
 func (mm *Manager) GetLayout(tableName string, tx *tx.Transaction) (*record.Layout, error) {
 	return mm.tableManager.GetLayout(tableName, tx)
 }
@@ -54,18 +121,65 @@ func (mm *Manager) CreateView(viewName string, viewDef string, tx *tx.Transactio
 	return mm.viewManager.CreateView(viewName, viewDef, tx)
 }
 
+// DropView ビューの定義を削除する。ビューが存在しなければ false を返す
+func (mm *Manager) DropView(viewName string, tx *tx.Transaction) (bool, error) {
+	return mm.viewManager.DropView(viewName, tx)
+}
+
+func (mm *Manager) ReplaceView(viewName string, viewDef string, tx *tx.Transaction) error {
+	return mm.viewManager.ReplaceView(viewName, viewDef, tx)
+}
+
+func (mm *Manager) GetViewDefs(tx *tx.Transaction) (map[string]string, error) {
+	return mm.viewManager.GetViewDefs(tx)
+}
+
 func (mm *Manager) GetViewDef(viewName string, tx *tx.Transaction) (string, error) {
 	return mm.viewManager.GetViewDef(viewName, tx)
 }
 
-func (mm *Manager) CreateIndex(indexName string, tableName string, fieldName string, tx *tx.Transaction) error {
-	return mm.indexManager.CreateIndex(indexName, tableName, fieldName, tx)
+// CreateIndex 列 fieldNames をキーとする索引を作成する。includedFields の列の値も葉のレコードに格納する
+func (mm *Manager) CreateIndex(indexName string, tableName string, fieldNames []string, includedFields []string, indexType IndexType, tx *tx.Transaction) error {
+	return mm.indexManager.CreateIndex(indexName, tableName, fieldNames, includedFields, indexType, tx)
+}
+
+// CreateKeyIndex PRIMARY KEY や UNIQUE 制約を裏付ける索引を作成する
+func (mm *Manager) CreateKeyIndex(indexName string, tableName string, fieldNames []string, constraint ConstraintType, tx *tx.Transaction) error {
+	return mm.indexManager.CreateKeyIndex(indexName, tableName, fieldNames, constraint, tx)
+}
+
+// GetIndexTable 索引 indexName が作られた表。索引が存在しなければ空文字を返す
+func (mm *Manager) GetIndexTable(indexName string, tx *tx.Transaction) (string, error) {
+	return mm.indexManager.GetIndexTable(indexName, tx)
+}
+
+// DropIndex 索引の定義を削除する。索引のファイルは削除しない
+func (mm *Manager) DropIndex(indexName string, tx *tx.Transaction) error {
+	return mm.indexManager.DropIndex(indexName, tx)
 }
 
 func (mm *Manager) GetIndexInfo(tableName string, tx *tx.Transaction) (map[string]*IndexInfo, error) {
 	return mm.indexManager.GetIndexInfo(tableName, tx)
 }
 
+func (mm *Manager) CreateForeignKey(fk *ForeignKey, tx *tx.Transaction) error {
+	return mm.fkManager.CreateForeignKey(fk, tx)
+}
+
+// GetForeignKeys tableName が参照する側の外部キー
+func (mm *Manager) GetForeignKeys(tableName string, tx *tx.Transaction) ([]*ForeignKey, error) {
+	return mm.fkManager.GetForeignKeys(tableName, tx)
+}
+
+// GetReferencingKeys tableName を参照する外部キー
+func (mm *Manager) DropForeignKey(fkName string, tx *tx.Transaction) error {
+	return mm.fkManager.DropForeignKey(fkName, tx)
+}
+
+func (mm *Manager) GetReferencingKeys(tableName string, tx *tx.Transaction) ([]*ForeignKey, error) {
+	return mm.fkManager.GetReferencingKeys(tableName, tx)
+}
+
 func (mm *Manager) GetStatInfo(tableName string, layout *record.Layout, tx *tx.Transaction) (*StatInfo, error) {
 	return mm.statManager.GetStatInfo(tableName, layout, tx)
 }
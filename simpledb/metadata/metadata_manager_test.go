@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"path"
+	"simpledb/metadata"
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/server"
@@ -88,11 +89,11 @@ func TestMetadataManager(t *testing.T) {
 	fmt.Printf("View def = %s\n", v)
 
 	// Part 4: Index Metadata
-	err = mdm.CreateIndex("indexA", "MyTable", "A", tx)
+	err = mdm.CreateIndex("indexA", "MyTable", []string{"A"}, nil, metadata.IndexTypeBTree, tx)
 	if err != nil {
 		t.Fatalf("failed to create indexA: %v", err)
 	}
-	err = mdm.CreateIndex("indexB", "MyTable", "B", tx)
+	err = mdm.CreateIndex("indexB", "MyTable", []string{"B"}, nil, metadata.IndexTypeHash, tx)
 	if err != nil {
 		t.Fatalf("failed to create indexB: %v", err)
 	}
@@ -108,8 +109,7 @@ func TestMetadataManager(t *testing.T) {
 	fmt.Printf("V(indexA,B) = %d\n", ii.DistinctValues("B"))
 
 	ii = indexMap["B"]
-	// TODO: HashIndex が実装されたら確認できる
-	// fmt.Printf("B(indexB) = %d\n", ii.BlocksAccessed())
+	fmt.Printf("B(indexB) = %d\n", ii.BlocksAccessed())
 	fmt.Printf("R(indexB) = %d\n", ii.RecordsOutput())
 	fmt.Printf("V(indexB,A) = %d\n", ii.DistinctValues("A"))
 	fmt.Printf("V(indexB,B) = %d\n", ii.DistinctValues("B"))
@@ -77,6 +77,14 @@ func (sm *StatManager) GetStatInfo(tableName string, layout *record.Layout, tx *
 	return sm.tableStats[tableName], nil
 }
 
+// Forget 削除した表の統計情報を捨てる
+func (sm *StatManager) Forget(tableName string) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	delete(sm.tableStats, tableName)
+}
+
 func (sm *StatManager) ForceRefreshStatistics(tx *tx.Transaction) error {
 	return sm.refreshStatistics(tx)
 }
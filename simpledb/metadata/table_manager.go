@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"fmt"
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/tx"
@@ -11,12 +12,29 @@ const MaxName = 16
 const tableCatalogTableName = "tblcat"
 const tableCatalogFieldTableName = "tblname"
 const tableCatalogFieldSlotSize = "slotsize"
+const tableCatalogFieldFormat = "format"
 const fieldCatalogTableName = "fldcat"
 const fieldCatalogFieldTableName = "tblname"
 const fieldCatalogFieldFieldName = "fldname"
 const fieldCatalogFieldType = "type"
 const fieldCatalogFieldLength = "length"
 const fieldCatalogFieldOffset = "offset"
+const fieldCatalogFieldNotNull = "notnull"
+const fieldCatalogFieldDefault = "defaultval"
+const fieldCatalogFieldCheck = "checkpred"
+
+// 既定値と CHECK 制約は、構文解析できる文字列として fldcat に格納する
+const MaxDefault = 20
+const MaxCheck = 60
+
+// FieldConstraint 列の NOT NULL, DEFAULT, CHECK 制約
+type FieldConstraint struct {
+	NotNull bool
+	// Default 既定値の定数の文字列表現。既定値がなければ空
+	Default string
+	// Check CHECK 制約の述語の文字列表現。制約がなければ空
+	Check string
+}
 
 type TableManager struct {
 	logger *logger.Logger
@@ -31,7 +49,9 @@ func NewTableManager(isNew bool, tx *tx.Transaction) (*TableManager, error) {
 	tableCatalogSchema := record.NewSchema()
 	tableCatalogSchema.AddStringField(tableCatalogFieldTableName, MaxName)
 	tableCatalogSchema.AddIntField(tableCatalogFieldSlotSize)
-	tableCatalogLayout := record.NewLayoutFromSchema(tableCatalogSchema)
+	legacyTableCatalogLayout := record.NewLayoutFromSchemaWithEncoding(tableCatalogSchema, record.FixedFormat, tx.Encoding())
+	tableCatalogSchema.AddIntField(tableCatalogFieldFormat)
+	tableCatalogLayout := record.NewLayoutFromSchemaWithEncoding(tableCatalogSchema, record.FixedFormat, tx.Encoding())
 
 	fieldCatalogSchema := record.NewSchema()
 	fieldCatalogSchema.AddStringField(fieldCatalogFieldTableName, MaxName)
@@ -39,9 +59,32 @@ func NewTableManager(isNew bool, tx *tx.Transaction) (*TableManager, error) {
 	fieldCatalogSchema.AddIntField(fieldCatalogFieldType)
 	fieldCatalogSchema.AddIntField(fieldCatalogFieldLength)
 	fieldCatalogSchema.AddIntField(fieldCatalogFieldOffset)
-	fieldCatalogLayout := record.NewLayoutFromSchema(fieldCatalogSchema)
+	legacyFieldCatalogLayout := record.NewLayoutFromSchemaWithEncoding(fieldCatalogSchema, record.FixedFormat, tx.Encoding())
+	fieldCatalogSchema.AddIntField(fieldCatalogFieldNotNull)
+	fieldCatalogSchema.AddStringField(fieldCatalogFieldDefault, MaxDefault)
+	fieldCatalogSchema.AddStringField(fieldCatalogFieldCheck, MaxCheck)
+	fieldCatalogLayout := record.NewLayoutFromSchemaWithEncoding(fieldCatalogSchema, record.FixedFormat, tx.Encoding())
 
 	tableManager := &TableManager{logger, tableCatalogLayout, fieldCatalogLayout}
+	if !isNew {
+		// 格納形式を持たない古い tblcat は、最初のレコード (tblcat 自身) に記録されたスロットの大きさで見分ける
+		// 最初のレコードの位置と、スロットの大きさまでの列の位置は、どちらのレイアウトでも変わらない
+		legacy, err := isLegacyTableCatalog(legacyTableCatalogLayout, tx)
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			tableManager.tableCatalogLayout = legacyTableCatalogLayout
+		}
+		// 列の制約を持たない古い fldcat は、tblcat に記録されたスロットの大きさで見分ける
+		size, err := tableManager.slotSize(fieldCatalogTableName, tx)
+		if err != nil {
+			return nil, err
+		}
+		if size == legacyFieldCatalogLayout.SlotSize() {
+			tableManager.fieldCatalogLayout = legacyFieldCatalogLayout
+		}
+	}
 	if isNew {
 		logger.Tracef("(%q) NewTableManager(): CreateTable", tableCatalogTableName)
 		if err := tableManager.CreateTable(tableCatalogTableName, tableCatalogSchema, tx); err != nil {
@@ -55,10 +98,59 @@ func NewTableManager(isNew bool, tx *tx.Transaction) (*TableManager, error) {
 	return tableManager, nil
 }
 
+// isLegacyTableCatalog tblcat が格納形式の列を持たない古いレイアウト legacyLayout で書かれているか
+func isLegacyTableCatalog(legacyLayout *record.Layout, tx *tx.Transaction) (bool, error) {
+	tableCatalog, err := query.NewTableScan(tx, tableCatalogTableName, legacyLayout)
+	if err != nil {
+		return false, err
+	}
+	defer tableCatalog.Close()
+
+	if next, err := tableCatalog.Next(); err != nil || !next {
+		return false, err
+	}
+	t, err := tableCatalog.GetString(tableCatalogFieldTableName)
+	if err != nil {
+		return false, err
+	}
+	size, err := tableCatalog.GetInt(tableCatalogFieldSlotSize)
+	if err != nil {
+		return false, err
+	}
+	return t == tableCatalogTableName && size == legacyLayout.SlotSize(), nil
+}
+
 func (tm *TableManager) CreateTable(tableName string, schema *record.Schema, tx *tx.Transaction) error {
+	return tm.CreateTableWithConstraints(tableName, schema, record.FixedFormat, nil, tx)
+}
+
+// CreateTableWithConstraints 格納形式 format の表を、列の制約 constraints とともに作成する。制約のない列は constraints に含めなくてよい
+func (tm *TableManager) CreateTableWithConstraints(tableName string, schema *record.Schema, format record.Format, constraints map[string]*FieldConstraint, tx *tx.Transaction) error {
 	tm.logger.Tracef("(%q) CreateTable", tableName)
 
-	layout := record.NewLayoutFromSchema(schema)
+	if format != record.FixedFormat && !tm.tableCatalogLayout.Schema().HasField(tableCatalogFieldFormat) {
+		return fmt.Errorf("table catalog does not support %s tables", format)
+	}
+
+	for fieldName, c := range constraints {
+		if c == nil {
+			continue
+		}
+		if !tm.fieldCatalogLayout.Schema().HasField(fieldCatalogFieldNotNull) && *c != (FieldConstraint{}) {
+			return fmt.Errorf("field catalog does not support column constraints")
+		}
+		if len(c.Default) > MaxDefault {
+			return fmt.Errorf("default value of %q is too long: %s", fieldName, c.Default)
+		}
+		if len(c.Check) > MaxCheck {
+			return fmt.Errorf("check constraint of %q is too long: %s", fieldName, c.Check)
+		}
+	}
+
+	layout := record.NewLayoutFromSchemaWithEncoding(schema, format, tx.Encoding())
+	if err := layout.CheckFits(tx.BlockSize()); err != nil {
+		return fmt.Errorf("table %s: %w", tableName, err)
+	}
 	tableCatalog, err := query.NewTableScan(tx, tableCatalogTableName, tm.tableCatalogLayout)
 	if err != nil {
 		return err
@@ -75,6 +167,11 @@ func (tm *TableManager) CreateTable(tableName string, schema *record.Schema, tx
 	if err := tableCatalog.SetInt(tableCatalogFieldSlotSize, layout.SlotSize()); err != nil {
 		return err
 	}
+	if tableCatalog.HasField(tableCatalogFieldFormat) {
+		if err := tableCatalog.SetInt(tableCatalogFieldFormat, int32(format)); err != nil {
+			return err
+		}
+	}
 
 	fieldCatalog, err := query.NewTableScan(tx, fieldCatalogTableName, tm.fieldCatalogLayout)
 	if err != nil {
@@ -102,10 +199,216 @@ func (tm *TableManager) CreateTable(tableName string, schema *record.Schema, tx
 		if err := fieldCatalog.SetInt(fieldCatalogFieldOffset, layout.Offset(fieldName)); err != nil {
 			return err
 		}
+		c, ok := constraints[fieldName]
+		if !ok || c == nil || !fieldCatalog.HasField(fieldCatalogFieldNotNull) {
+			continue
+		}
+		notNull := int32(0)
+		if c.NotNull {
+			notNull = 1
+		}
+		if err := fieldCatalog.SetInt(fieldCatalogFieldNotNull, notNull); err != nil {
+			return err
+		}
+		if err := fieldCatalog.SetString(fieldCatalogFieldDefault, c.Default); err != nil {
+			return err
+		}
+		if err := fieldCatalog.SetString(fieldCatalogFieldCheck, c.Check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropTable tblcat と fldcat から表の定義を削除する。表のファイルは削除しない
+func (tm *TableManager) DropTable(tableName string, tx *tx.Transaction) error {
+	tm.logger.Tracef("(%q) DropTable", tableName)
+	if _, err := deleteCatalogRows(tx, tableCatalogTableName, tm.tableCatalogLayout, tableCatalogFieldTableName, tableName); err != nil {
+		return err
+	}
+	if _, err := deleteCatalogRows(tx, fieldCatalogTableName, tm.fieldCatalogLayout, fieldCatalogFieldTableName, tableName); err != nil {
+		return err
 	}
 	return nil
 }
 
+// deleteCatalogRows カタログ表 catalogName のうち、列 fieldName の値が val である行を削除し、削除した行数を返す
+func deleteCatalogRows(tx *tx.Transaction, catalogName string, layout *record.Layout, fieldName string, val string) (int, error) {
+	ts, err := query.NewTableScan(tx, catalogName, layout)
+	if err != nil {
+		return 0, err
+	}
+	defer ts.Close()
+
+	count := 0
+	for {
+		next, err := ts.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !next {
+			return count, nil
+		}
+		v, err := ts.GetString(fieldName)
+		if err != nil {
+			return 0, err
+		}
+		if v != val {
+			continue
+		}
+		if err := ts.Delete(); err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
+
+// updateCatalogRows カタログ表 catalogName のうち、where の全ての列の値が一致する行について、列 fieldName の値を val に書き換える
+func updateCatalogRows(tx *tx.Transaction, catalogName string, layout *record.Layout, where map[string]string, fieldName string, val string) error {
+	ts, err := query.NewTableScan(tx, catalogName, layout)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+
+	for {
+		next, err := ts.Next()
+		if err != nil {
+			return err
+		}
+		if !next {
+			return nil
+		}
+		match := true
+		for whereField, whereVal := range where {
+			v, err := ts.GetString(whereField)
+			if err != nil {
+				return err
+			}
+			if v != whereVal {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if err := ts.SetString(fieldName, val); err != nil {
+			return err
+		}
+	}
+}
+
+// slotSize tblcat に記録された表のスロットの大きさ。表がなければ -1
+func (tm *TableManager) slotSize(tableName string, tx *tx.Transaction) (int32, error) {
+	tableCatalog, err := query.NewTableScan(tx, tableCatalogTableName, tm.tableCatalogLayout)
+	if err != nil {
+		return 0, err
+	}
+	defer tableCatalog.Close()
+
+	for {
+		next, err := tableCatalog.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !next {
+			return -1, nil
+		}
+		t, err := tableCatalog.GetString(tableCatalogFieldTableName)
+		if err != nil {
+			return 0, err
+		}
+		if t == tableName {
+			return tableCatalog.GetInt(tableCatalogFieldSlotSize)
+		}
+	}
+}
+
+// GetFieldConstraints 表の列の制約。制約のない列は含まない
+func (tm *TableManager) GetFieldConstraints(tableName string, tx *tx.Transaction) (map[string]*FieldConstraint, error) {
+	result := make(map[string]*FieldConstraint)
+	if !tm.fieldCatalogLayout.Schema().HasField(fieldCatalogFieldNotNull) {
+		return result, nil
+	}
+	fieldCatalog, err := query.NewTableScan(tx, fieldCatalogTableName, tm.fieldCatalogLayout)
+	if err != nil {
+		return nil, err
+	}
+	defer fieldCatalog.Close()
+
+	for {
+		next, err := fieldCatalog.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			return result, nil
+		}
+		t, err := fieldCatalog.GetString(fieldCatalogFieldTableName)
+		if err != nil {
+			return nil, err
+		}
+		if t != tableName {
+			continue
+		}
+		fldname, err := fieldCatalog.GetString(fieldCatalogFieldFieldName)
+		if err != nil {
+			return nil, err
+		}
+		notNull, err := fieldCatalog.GetInt(fieldCatalogFieldNotNull)
+		if err != nil {
+			return nil, err
+		}
+		defaultVal, err := fieldCatalog.GetString(fieldCatalogFieldDefault)
+		if err != nil {
+			return nil, err
+		}
+		check, err := fieldCatalog.GetString(fieldCatalogFieldCheck)
+		if err != nil {
+			return nil, err
+		}
+		c := FieldConstraint{NotNull: notNull != 0, Default: defaultVal, Check: check}
+		if c != (FieldConstraint{}) {
+			result[fldname] = &c
+		}
+	}
+}
+
+// GetTableNames カタログを除く全ての表の名前
+func (tm *TableManager) GetTableNames(tx *tx.Transaction) ([]string, error) {
+	catalogs := map[string]bool{
+		tableCatalogTableName:      true,
+		fieldCatalogTableName:      true,
+		viewCatalogTableName:       true,
+		indexCatalogTableName:      true,
+		foreignKeyCatalogTableName: true,
+	}
+	tableCatalog, err := query.NewTableScan(tx, tableCatalogTableName, tm.tableCatalogLayout)
+	if err != nil {
+		return nil, err
+	}
+	defer tableCatalog.Close()
+
+	var tableNames []string
+	for {
+		next, err := tableCatalog.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			return tableNames, nil
+		}
+		t, err := tableCatalog.GetString(tableCatalogFieldTableName)
+		if err != nil {
+			return nil, err
+		}
+		if !catalogs[t] {
+			tableNames = append(tableNames, t)
+		}
+	}
+}
+
 func (tm *TableManager) GetLayout(tableName string, tx *tx.Transaction) (*record.Layout, error) {
 	tm.logger.Tracef("(%q) GetLayout", tableName)
 	defer func() {
@@ -113,6 +416,7 @@ func (tm *TableManager) GetLayout(tableName string, tx *tx.Transaction) (*record
 	}()
 
 	var size int32 = -1
+	format := record.FixedFormat
 	tableCatalog, err := query.NewTableScan(tx, tableCatalogTableName, tm.tableCatalogLayout)
 	if err != nil {
 		return nil, err
@@ -137,7 +441,14 @@ func (tm *TableManager) GetLayout(tableName string, tx *tx.Transaction) (*record
 			if err != nil {
 				return nil, err
 			}
-			tm.logger.Tracef("(%q) GetLayout: tableCatalog.Next(): size=%d", tableName, size)
+			if tableCatalog.HasField(tableCatalogFieldFormat) {
+				f, err := tableCatalog.GetInt(tableCatalogFieldFormat)
+				if err != nil {
+					return nil, err
+				}
+				format = record.Format(f)
+			}
+			tm.logger.Tracef("(%q) GetLayout: tableCatalog.Next(): size=%d, format=%s", tableName, size, format)
 			break
 		}
 	}
@@ -185,5 +496,5 @@ func (tm *TableManager) GetLayout(tableName string, tx *tx.Transaction) (*record
 			schema.AddField(fldname, record.FieldType(fldtype), fldlen)
 		}
 	}
-	return record.NewLayout(schema, offsets, size), nil
+	return record.NewLayoutWithFormat(schema, offsets, size, format), nil
 }
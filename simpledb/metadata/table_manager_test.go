@@ -1,6 +1,7 @@
 package metadata_test
 
 import (
+	"errors"
 	"fmt"
 	"path"
 	"simpledb/metadata"
@@ -53,3 +54,65 @@ func TestTableManager(t *testing.T) {
 		t.Fatalf("failed to commit: %v", err)
 	}
 }
+
+func TestTableManagerFormat(t *testing.T) {
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "formattest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableManager, err := metadata.NewTableManager(true, transaction)
+	if err != nil {
+		t.Fatalf("failed to create table manager: %v", err)
+	}
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 300)
+	if err := tableManager.CreateTableWithConstraints("Slotted", schema, record.SlottedFormat, nil, transaction); err != nil {
+		t.Fatalf("failed to create Slotted: %v", err)
+	}
+	// 固定長形式では、VARCHAR(300) のスロットが1ブロックに収まらない
+	if err := tableManager.CreateTable("Fixed", schema, transaction); !errors.Is(err, record.ErrRecordTooLarge) {
+		t.Fatalf("CreateTable(Fixed) = %v, want ErrRecordTooLarge", err)
+	}
+	fixedSchema := record.NewSchema()
+	fixedSchema.AddIntField("A")
+	fixedSchema.AddStringField("B", 100)
+	if err := tableManager.CreateTable("Fixed", fixedSchema, transaction); err != nil {
+		t.Fatalf("failed to create Fixed: %v", err)
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// 格納形式はカタログに記録され、作り直した TableManager からも読める
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableManager, err = metadata.NewTableManager(false, transaction)
+	if err != nil {
+		t.Fatalf("failed to create table manager: %v", err)
+	}
+	for tableName, want := range map[string]record.Format{"Slotted": record.SlottedFormat, "Fixed": record.FixedFormat} {
+		layout, err := tableManager.GetLayout(tableName, transaction)
+		if err != nil {
+			t.Fatalf("failed to GetLayout: %v", err)
+		}
+		if layout.Format() != want {
+			t.Errorf("%s has format %s, want %s", tableName, layout.Format(), want)
+		}
+	}
+	if layout, err := tableManager.GetLayout("Slotted", transaction); err != nil {
+		t.Fatalf("failed to GetLayout: %v", err)
+	} else if layout.SlotSize() != 12 {
+		t.Errorf("Slotted has slot size %d", layout.SlotSize())
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"fmt"
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/tx"
@@ -30,6 +31,9 @@ func NewViewManager(isNew bool, tableManager *TableManager, tx *tx.Transaction)
 }
 
 func (vm *ViewManager) CreateView(viewName string, viewDef string, tx *tx.Transaction) error {
+	if len(viewDef) > maxViewDef {
+		return fmt.Errorf("definition of view %q is too long: %s", viewName, viewDef)
+	}
 	layout, err := vm.tableManager.GetLayout(viewCatalogTableName, tx)
 	if err != nil {
 		return err
@@ -52,6 +56,65 @@ func (vm *ViewManager) CreateView(viewName string, viewDef string, tx *tx.Transa
 	return nil
 }
 
+// DropView ビューの定義を削除する。ビューが存在しなければ false を返す
+func (vm *ViewManager) DropView(viewName string, tx *tx.Transaction) (bool, error) {
+	layout, err := vm.tableManager.GetLayout(viewCatalogTableName, tx)
+	if err != nil {
+		return false, err
+	}
+	count, err := deleteCatalogRows(tx, viewCatalogTableName, layout, viewCatalogFieldViewName, viewName)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ReplaceView ビュー viewName の定義を viewDef に置き換える
+func (vm *ViewManager) ReplaceView(viewName string, viewDef string, tx *tx.Transaction) error {
+	if len(viewDef) > maxViewDef {
+		return fmt.Errorf("definition of view %q is too long: %s", viewName, viewDef)
+	}
+	layout, err := vm.tableManager.GetLayout(viewCatalogTableName, tx)
+	if err != nil {
+		return err
+	}
+	where := map[string]string{viewCatalogFieldViewName: viewName}
+	return updateCatalogRows(tx, viewCatalogTableName, layout, where, viewCatalogFieldViewDef, viewDef)
+}
+
+// GetViewDefs 全てのビューの定義をビュー名をキーにして返す
+func (vm *ViewManager) GetViewDefs(tx *tx.Transaction) (map[string]string, error) {
+	result := make(map[string]string)
+	layout, err := vm.tableManager.GetLayout(viewCatalogTableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := query.NewTableScan(tx, viewCatalogTableName, layout)
+	if err != nil {
+		return nil, err
+	}
+	defer ts.Close()
+
+	for {
+		next, err := ts.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			return result, nil
+		}
+		viewName, err := ts.GetString(viewCatalogFieldViewName)
+		if err != nil {
+			return nil, err
+		}
+		viewDef, err := ts.GetString(viewCatalogFieldViewDef)
+		if err != nil {
+			return nil, err
+		}
+		result[viewName] = viewDef
+	}
+}
+
 // 書籍と異なり見つからない場合は nil ではなく空文字を返す
 func (vm *ViewManager) GetViewDef(viewName string, tx *tx.Transaction) (string, error) {
 	result := ""
@@ -0,0 +1,46 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+)
+
+// Client Server に接続するクライアント。1つの Client が1つの Session に対応する
+// goroutine safe ではない
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("net.Dial: %w", err)
+	}
+	return &Client{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}, nil
+}
+
+// Do リクエストを送信してレスポンスを受け取る。サーバー側のエラーは *Error として返す
+func (c *Client) Do(req *Request) (*Response, error) {
+	if err := writeFrame(c.w, req); err != nil {
+		return nil, fmt.Errorf("writeFrame: %w", err)
+	}
+	var res Response
+	if err := readFrame(c.r, &res); err != nil {
+		return nil, fmt.Errorf("readFrame: %w", err)
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &res, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
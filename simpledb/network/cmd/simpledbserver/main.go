@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"simpledb/file"
+	"simpledb/network"
+	"simpledb/network/pgwire"
+	"simpledb/server"
+)
+
+func main() {
+	dir := flag.String("dir", "simpledb-data", "database directory")
+	addr := flag.String("addr", "127.0.0.1:1099", "address to listen on")
+	pgAddr := flag.String("pgaddr", "", "address to listen on for PostgreSQL clients (disabled if empty)")
+	encodingName := flag.String("encoding", "utf16", "string encoding of a new database (utf16 or utf8)")
+	blockSize := flag.Int("blocksize", 0, "block size (defaults to the size recorded in an existing database, or 400)")
+	buffers := flag.Int("buffers", 10000, "number of buffers")
+	lockTimeout := flag.Duration("lock-timeout", 0, "how long to wait for a lock (defaults to 10s)")
+	flag.Parse()
+
+	encoding, err := file.ParseEncoding(*encodingName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	db, err := server.NewSimpleDBWithOptions(*dir, server.Options{
+		BlockSize:   int32(*blockSize),
+		BufferSize:  int32(*buffers),
+		Encoding:    encoding,
+		Planner:     server.HeuristicPlanner,
+		LockTimeout: *lockTimeout,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	srv := network.NewServer(db)
+	var pgSrv *network.Server
+	if *pgAddr != "" {
+		pgSrv = pgwire.NewServer(db)
+		go func() {
+			if err := pgSrv.ListenAndServe(*pgAddr); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if pgSrv != nil {
+			pgSrv.Close()
+		}
+		srv.Close()
+	}()
+
+	if err := srv.ListenAndServe(*addr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
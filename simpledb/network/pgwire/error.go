@@ -0,0 +1,65 @@
+package pgwire
+
+import (
+	"errors"
+
+	"simpledb/metadata"
+	"simpledb/network"
+)
+
+// SQLSTATE
+const (
+	codeSyntaxError               = "42601"
+	codeUniqueViolation           = "23505"
+	codeForeignKeyViolation       = "23503"
+	codeNotNullViolation          = "23502"
+	codeCheckViolation            = "23514"
+	codeFeatureNotSupported       = "0A000"
+	codeProtocolViolation         = "08P01"
+	codeInvalidTextRepresentation = "22P02"
+	codeNumericValueOutOfRange    = "22003"
+	codeInvalidSQLStatementName   = "26000"
+	codeInvalidCursorName         = "34000"
+	codeInFailedSQLTransaction    = "25P02"
+	codeInternalError             = "XX000"
+)
+
+// pgError ErrorResponse としてクライアントに返すエラー
+type pgError struct {
+	code    string
+	message string
+}
+
+func (e *pgError) Error() string {
+	return e.message
+}
+
+func newPgError(err error) *pgError {
+	var pgErr *pgError
+	if errors.As(err, &pgErr) {
+		return pgErr
+	}
+	switch network.CodeOf(err) {
+	case network.CodeSyntax:
+		return &pgError{code: codeSyntaxError, message: err.Error()}
+	case network.CodeConstraint:
+		var cve *metadata.ConstraintViolationError
+		if errors.As(err, &cve) {
+			switch cve.Type {
+			case metadata.ConstraintForeignKey:
+				return &pgError{code: codeForeignKeyViolation, message: err.Error()}
+			case metadata.ConstraintNotNull:
+				return &pgError{code: codeNotNullViolation, message: err.Error()}
+			case metadata.ConstraintCheck:
+				return &pgError{code: codeCheckViolation, message: err.Error()}
+			}
+		}
+		return &pgError{code: codeUniqueViolation, message: err.Error()}
+	default:
+		return &pgError{code: codeInternalError, message: err.Error()}
+	}
+}
+
+func protocolError(err error) *pgError {
+	return &pgError{code: codeProtocolViolation, message: err.Error()}
+}
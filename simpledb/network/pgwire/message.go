@@ -0,0 +1,202 @@
+package pgwire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxMessageSize 1メッセージの最大サイズ
+const maxMessageSize = 16 << 20
+
+const (
+	protocolVersion3 = 196608
+	sslRequestCode   = 80877103
+	gssRequestCode   = 80877104
+	cancelRequest    = 80877102
+)
+
+// フロントエンドから送られるメッセージの種類
+const (
+	msgQuery     = 'Q'
+	msgParse     = 'P'
+	msgBind      = 'B'
+	msgDescribe  = 'D'
+	msgExecute   = 'E'
+	msgClose     = 'C'
+	msgSync      = 'S'
+	msgFlush     = 'H'
+	msgTerminate = 'X'
+)
+
+// バックエンドが返すメッセージの種類
+const (
+	msgAuthentication       = 'R'
+	msgParameterStatus      = 'S'
+	msgBackendKeyData       = 'K'
+	msgReadyForQuery        = 'Z'
+	msgRowDescription       = 'T'
+	msgDataRow              = 'D'
+	msgCommandComplete      = 'C'
+	msgEmptyQueryResponse   = 'I'
+	msgErrorResponse        = 'E'
+	msgParseComplete        = '1'
+	msgBindComplete         = '2'
+	msgCloseComplete        = '3'
+	msgParameterDescription = 't'
+	msgNoData               = 'n'
+	msgPortalSuspended      = 's'
+)
+
+var errMalformedMessage = errors.New("malformed message")
+
+// message 送信するメッセージを組み立てる
+type message struct {
+	typ byte
+	buf []byte
+}
+
+func newMessage(typ byte) *message {
+	return &message{typ: typ}
+}
+
+func (m *message) byte(b byte) {
+	m.buf = append(m.buf, b)
+}
+
+func (m *message) int16(v int16) {
+	m.buf = binary.BigEndian.AppendUint16(m.buf, uint16(v))
+}
+
+func (m *message) int32(v int32) {
+	m.buf = binary.BigEndian.AppendUint32(m.buf, uint32(v))
+}
+
+// string NUL 終端の文字列
+func (m *message) string(s string) {
+	m.buf = append(m.buf, s...)
+	m.buf = append(m.buf, 0)
+}
+
+func (m *message) bytes(b []byte) {
+	m.buf = append(m.buf, b...)
+}
+
+func writeMessage(w *bufio.Writer, m *message) error {
+	if err := w.WriteByte(m.typ); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(m.buf)+4))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(m.buf)
+	return err
+}
+
+// readStartupMessage 種類を持たない最初のメッセージを読み、プロトコルバージョン (またはリクエストコード) と本体を返す
+func readStartupMessage(r io.Reader) (int32, *reader, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	rd := &reader{buf: body}
+	code := rd.int32()
+	if rd.err != nil {
+		return 0, nil, rd.err
+	}
+	return code, rd, nil
+}
+
+func readMessage(r *bufio.Reader) (byte, *reader, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return typ, &reader{buf: body}, nil
+}
+
+func readBody(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(length[:])) - 4
+	if size < 0 || size > maxMessageSize {
+		return nil, fmt.Errorf("invalid message length: %d", size+4)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// reader 受信したメッセージの本体を読む。途中で不足した場合は err に errMalformedMessage が設定される
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = errMalformedMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) int16() int16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *reader) int32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = errMalformedMessage
+	return ""
+}
+
+func (r *reader) bytes(n int) []byte {
+	return r.next(n)
+}
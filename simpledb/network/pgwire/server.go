@@ -0,0 +1,632 @@
+// Package pgwire は PostgreSQL の frontend/backend プロトコル (v3) を話すサーバーを提供する
+// 既存の PostgreSQL クライアントから SimpleDB に接続できるようにするための互換レイヤーで、
+// 認証は trust のみ、単純問い合わせと拡張問い合わせ (Parse/Bind/Describe/Execute/Sync) に対応する
+package pgwire
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"simpledb/network"
+	"simpledb/server"
+)
+
+// serverVersion クライアントに通知するバージョン
+const serverVersion = "14.0"
+
+// NewServer PostgreSQL のプロトコルを話すサーバーを作成する
+func NewServer(db *server.SimpleDB) *network.Server {
+	return network.NewServerWithHandler("pgwire.Server", db, serveConn)
+}
+
+// statement Parse で作成された準備済み文
+type statement struct {
+	sql       string
+	paramOIDs []int32
+}
+
+// portal Bind で作成された、パラメータを埋め込んだ実行可能な文
+type portal struct {
+	sql           string
+	resultFormats []int16
+
+	// 開かれた結果セット。Execute の行数制限で中断された場合に次の Execute で続きを返す
+	open    bool
+	columns []network.Column
+	rows    int
+}
+
+type conn struct {
+	r       *bufio.Reader
+	w       *bufio.Writer
+	session *network.Session
+
+	// 明示的なトランザクションの中でエラーが発生した。COMMIT/ROLLBACK まで他の文は拒否される
+	failed bool
+
+	statements map[string]*statement
+	portals    map[string]*portal
+}
+
+func serveConn(nc net.Conn, session *network.Session) error {
+	c := &conn{
+		r:          bufio.NewReader(nc),
+		w:          bufio.NewWriter(nc),
+		session:    session,
+		statements: make(map[string]*statement),
+		portals:    make(map[string]*portal),
+	}
+	if ok, err := c.startup(); !ok || err != nil {
+		return err
+	}
+	return c.serve()
+}
+
+func (c *conn) startup() (bool, error) {
+	for {
+		code, _, err := readStartupMessage(c.r)
+		if err != nil {
+			return false, fmt.Errorf("readStartupMessage: %w", err)
+		}
+		switch code {
+		case sslRequestCode, gssRequestCode:
+			// 暗号化はサポートしない
+			if err := c.w.WriteByte('N'); err != nil {
+				return false, err
+			}
+			if err := c.w.Flush(); err != nil {
+				return false, err
+			}
+		case cancelRequest:
+			return false, nil
+		case protocolVersion3:
+			// user や database などのパラメータは使わない (trust 認証)
+			return true, c.sendStartupResponse()
+		default:
+			err := &pgError{code: codeProtocolViolation, message: fmt.Sprintf("unsupported frontend protocol %d", code)}
+			if sendErr := c.sendError(err); sendErr != nil {
+				return false, sendErr
+			}
+			return false, c.w.Flush()
+		}
+	}
+}
+
+func (c *conn) sendStartupResponse() error {
+	auth := newMessage(msgAuthentication)
+	auth.int32(0) // AuthenticationOk
+	if err := c.send(auth); err != nil {
+		return err
+	}
+	for _, kv := range [][2]string{
+		{"server_version", serverVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		m := newMessage(msgParameterStatus)
+		m.string(kv[0])
+		m.string(kv[1])
+		if err := c.send(m); err != nil {
+			return err
+		}
+	}
+	key := newMessage(msgBackendKeyData)
+	key.int32(0)
+	key.int32(0)
+	if err := c.send(key); err != nil {
+		return err
+	}
+	return c.readyForQuery()
+}
+
+func (c *conn) serve() error {
+	// 拡張問い合わせでエラーが発生したら Sync まで読み飛ばす
+	skipUntilSync := false
+	for {
+		typ, rd, err := readMessage(c.r)
+		if err != nil {
+			return fmt.Errorf("readMessage: %w", err)
+		}
+		if typ == msgTerminate {
+			return nil
+		}
+		if skipUntilSync && typ != msgSync {
+			continue
+		}
+
+		switch typ {
+		case msgQuery:
+			err = c.handleQuery(rd)
+		case msgParse:
+			err = c.handleParse(rd)
+		case msgBind:
+			err = c.handleBind(rd)
+		case msgDescribe:
+			err = c.handleDescribe(rd)
+		case msgExecute:
+			err = c.handleExecute(rd)
+		case msgClose:
+			err = c.handleClose(rd)
+		case msgSync:
+			skipUntilSync = false
+			err = c.handleSync()
+		case msgFlush:
+			err = c.w.Flush()
+		default:
+			err = &pgError{code: codeProtocolViolation, message: fmt.Sprintf("unsupported message type %q", typ)}
+		}
+		if err == nil {
+			continue
+		}
+
+		var pgErr *pgError
+		if !errors.As(err, &pgErr) {
+			// 通信エラー
+			return err
+		}
+		if err := c.sendError(pgErr); err != nil {
+			return err
+		}
+		if typ == msgQuery {
+			if err := c.readyForQuery(); err != nil {
+				return err
+			}
+		} else {
+			skipUntilSync = true
+		}
+	}
+}
+
+// handleQuery 単純問い合わせ。; で区切られた複数の文を順に実行する
+func (c *conn) handleQuery(rd *reader) error {
+	sql := rd.string()
+	if rd.err != nil {
+		return protocolError(rd.err)
+	}
+
+	stmts := splitStatements(sql)
+	if len(stmts) == 0 {
+		if err := c.send(newMessage(msgEmptyQueryResponse)); err != nil {
+			return err
+		}
+		return c.readyForQuery()
+	}
+	for _, stmt := range stmts {
+		p := &portal{sql: stmt}
+		if isQuery(stmt) {
+			columns, err := c.openPortal(p)
+			if err != nil {
+				return err
+			}
+			if err := c.send(rowDescription(columns, nil)); err != nil {
+				return err
+			}
+		}
+		if _, err := c.execute(p, 0); err != nil {
+			return err
+		}
+	}
+	return c.readyForQuery()
+}
+
+func (c *conn) handleParse(rd *reader) error {
+	name := rd.string()
+	sql := rd.string()
+	n := rd.int16()
+	oids := make([]int32, 0, max(n, 0))
+	for i := 0; i < int(n); i++ {
+		oids = append(oids, rd.int32())
+	}
+	if rd.err != nil {
+		return protocolError(rd.err)
+	}
+
+	stmts := splitStatements(sql)
+	if len(stmts) > 1 {
+		return &pgError{code: codeSyntaxError, message: "cannot insert multiple commands into a prepared statement"}
+	}
+	if len(stmts) == 1 {
+		sql = stmts[0]
+	}
+	// 型が指定されていないパラメータは unknown として扱う
+	for len(oids) < countParams(sql) {
+		oids = append(oids, 0)
+	}
+	for i, oid := range oids {
+		if oid == 0 {
+			oids[i] = oidUnknown
+		}
+	}
+
+	c.statements[name] = &statement{sql: sql, paramOIDs: oids}
+	return c.send(newMessage(msgParseComplete))
+}
+
+func (c *conn) handleBind(rd *reader) error {
+	portalName := rd.string()
+	stmtName := rd.string()
+	paramFormats := make([]int16, max(rd.int16(), 0))
+	for i := range paramFormats {
+		paramFormats[i] = rd.int16()
+	}
+	params := make([]parameter, max(rd.int16(), 0))
+	for i := range params {
+		params[i].format = formatOf(paramFormats, i)
+		if size := rd.int32(); size >= 0 {
+			params[i].value = rd.bytes(int(size))
+		}
+	}
+	resultFormats := make([]int16, max(rd.int16(), 0))
+	for i := range resultFormats {
+		resultFormats[i] = rd.int16()
+	}
+	if rd.err != nil {
+		return protocolError(rd.err)
+	}
+
+	stmt, ok := c.statements[stmtName]
+	if !ok {
+		return &pgError{code: codeInvalidSQLStatementName, message: fmt.Sprintf("prepared statement %q does not exist", stmtName)}
+	}
+	if len(params) != len(stmt.paramOIDs) {
+		return &pgError{code: codeProtocolViolation, message: fmt.Sprintf("bind message supplies %d parameters, but prepared statement %q requires %d", len(params), stmtName, len(stmt.paramOIDs))}
+	}
+	for i := range params {
+		params[i].oid = stmt.paramOIDs[i]
+	}
+	sql, err := bindParams(stmt.sql, params)
+	if err != nil {
+		return err
+	}
+
+	c.closePortal(portalName)
+	c.portals[portalName] = &portal{sql: sql, resultFormats: resultFormats}
+	return c.send(newMessage(msgBindComplete))
+}
+
+func (c *conn) handleDescribe(rd *reader) error {
+	kind := rd.byte()
+	name := rd.string()
+	if rd.err != nil {
+		return protocolError(rd.err)
+	}
+
+	switch kind {
+	case 'S':
+		stmt, ok := c.statements[name]
+		if !ok {
+			return &pgError{code: codeInvalidSQLStatementName, message: fmt.Sprintf("prepared statement %q does not exist", name)}
+		}
+		m := newMessage(msgParameterDescription)
+		m.int16(int16(len(stmt.paramOIDs)))
+		for _, oid := range stmt.paramOIDs {
+			m.int32(oid)
+		}
+		if err := c.send(m); err != nil {
+			return err
+		}
+		if !isQuery(stmt.sql) {
+			return c.send(newMessage(msgNoData))
+		}
+		if err := c.checkFailed(); err != nil {
+			return err
+		}
+		columns, err := c.session.Describe(placeholderParams(stmt.sql, stmt.paramOIDs))
+		if err != nil {
+			return c.statementError(err)
+		}
+		return c.send(rowDescription(columns, nil))
+	case 'P':
+		p, ok := c.portals[name]
+		if !ok {
+			return &pgError{code: codeInvalidCursorName, message: fmt.Sprintf("portal %q does not exist", name)}
+		}
+		if !isQuery(p.sql) {
+			return c.send(newMessage(msgNoData))
+		}
+		columns, err := c.openPortal(p)
+		if err != nil {
+			return err
+		}
+		return c.send(rowDescription(columns, p.resultFormats))
+	default:
+		return &pgError{code: codeProtocolViolation, message: fmt.Sprintf("invalid describe kind %q", kind)}
+	}
+}
+
+func (c *conn) handleExecute(rd *reader) error {
+	name := rd.string()
+	maxRows := rd.int32()
+	if rd.err != nil {
+		return protocolError(rd.err)
+	}
+
+	p, ok := c.portals[name]
+	if !ok {
+		return &pgError{code: codeInvalidCursorName, message: fmt.Sprintf("portal %q does not exist", name)}
+	}
+	if isQuery(p.sql) {
+		if _, err := c.openPortal(p); err != nil {
+			return err
+		}
+	}
+	done, err := c.execute(p, int(maxRows))
+	if err != nil {
+		return err
+	}
+	if done {
+		delete(c.portals, name)
+	}
+	return nil
+}
+
+func (c *conn) handleClose(rd *reader) error {
+	kind := rd.byte()
+	name := rd.string()
+	if rd.err != nil {
+		return protocolError(rd.err)
+	}
+
+	switch kind {
+	case 'S':
+		delete(c.statements, name)
+	case 'P':
+		c.closePortal(name)
+	default:
+		return &pgError{code: codeProtocolViolation, message: fmt.Sprintf("invalid close kind %q", kind)}
+	}
+	return c.send(newMessage(msgCloseComplete))
+}
+
+// handleSync 明示的なトランザクションの外では、開いたままのポータルを閉じて暗黙のトランザクションを終える
+func (c *conn) handleSync() error {
+	if !c.session.InTransaction() {
+		for name := range c.portals {
+			c.closePortal(name)
+		}
+		if err := c.session.CloseRows(); err != nil {
+			return err
+		}
+	}
+	return c.readyForQuery()
+}
+
+// openPortal SELECT 文のポータルの結果セットを開く。既に開いていれば何もしない
+func (c *conn) openPortal(p *portal) ([]network.Column, error) {
+	if p.open {
+		return p.columns, nil
+	}
+	if err := c.checkFailed(); err != nil {
+		return nil, err
+	}
+	// 1つのセッションで同時に開ける結果セットは1つだけなので、他のポータルの結果セットは閉じる
+	for name, other := range c.portals {
+		if other != p && other.open {
+			c.closePortal(name)
+		}
+	}
+	columns, err := c.session.Query(p.sql)
+	if err != nil {
+		return nil, c.statementError(err)
+	}
+	p.open = true
+	p.columns = columns
+	return columns, nil
+}
+
+func (c *conn) closePortal(name string) {
+	p, ok := c.portals[name]
+	if !ok {
+		return
+	}
+	delete(c.portals, name)
+	if p.open {
+		_ = c.session.CloseRows()
+	}
+}
+
+// execute ポータルを実行する。maxRows が正の場合はその行数で中断し、結果を返し切ったかを done で返す
+func (c *conn) execute(p *portal, maxRows int) (done bool, err error) {
+	if p.open {
+		return c.fetch(p, maxRows)
+	}
+
+	sql := p.sql
+	if strings.TrimSpace(sql) == "" {
+		return true, c.send(newMessage(msgEmptyQueryResponse))
+	}
+	switch transactionCommand(sql) {
+	case "begin":
+		if !c.session.InTransaction() {
+			if err := c.session.Begin(); err != nil {
+				return false, c.statementError(err)
+			}
+		}
+		return true, c.complete("BEGIN")
+	case "commit":
+		tag := "COMMIT"
+		if c.failed {
+			// 失敗したトランザクションはロールバック済み
+			tag = "ROLLBACK"
+			c.failed = false
+		} else if c.session.InTransaction() {
+			if err := c.session.Commit(); err != nil {
+				return false, c.statementError(err)
+			}
+		}
+		return true, c.complete(tag)
+	case "rollback":
+		c.failed = false
+		if c.session.InTransaction() {
+			if err := c.session.Rollback(); err != nil {
+				return false, c.statementError(err)
+			}
+		}
+		return true, c.complete("ROLLBACK")
+	}
+
+	if err := c.checkFailed(); err != nil {
+		return false, err
+	}
+	n, err := c.session.Exec(sql)
+	if err != nil {
+		return false, c.statementError(err)
+	}
+	return true, c.complete(commandTag(sql, n))
+}
+
+func (c *conn) fetch(p *portal, maxRows int) (bool, error) {
+	for {
+		n := network.FetchSize
+		if maxRows > 0 {
+			n = min(n, maxRows)
+		}
+		rows, done, err := c.session.Fetch(n)
+		if err != nil {
+			p.open = false
+			return false, c.statementError(err)
+		}
+		for _, row := range rows {
+			if err := c.send(dataRow(row, p.resultFormats)); err != nil {
+				return false, err
+			}
+		}
+		p.rows += len(rows)
+		if done {
+			p.open = false
+			return true, c.complete("SELECT " + strconv.Itoa(p.rows))
+		}
+		if maxRows > 0 {
+			maxRows -= len(rows)
+			if maxRows == 0 {
+				return false, c.send(newMessage(msgPortalSuspended))
+			}
+		}
+	}
+}
+
+func (c *conn) checkFailed() error {
+	if c.failed {
+		return &pgError{code: codeInFailedSQLTransaction, message: "current transaction is aborted, commands ignored until end of transaction block"}
+	}
+	return nil
+}
+
+// statementError 文の実行中のエラーを ErrorResponse に変換する
+// 明示的なトランザクションの中であれば、トランザクションをロールバックして失敗状態にする
+func (c *conn) statementError(err error) error {
+	if c.session.InTransaction() {
+		_ = c.session.Rollback()
+		c.failed = true
+	}
+	return newPgError(err)
+}
+
+func (c *conn) complete(tag string) error {
+	m := newMessage(msgCommandComplete)
+	m.string(tag)
+	return c.send(m)
+}
+
+func (c *conn) readyForQuery() error {
+	m := newMessage(msgReadyForQuery)
+	switch {
+	case c.failed:
+		m.byte('E')
+	case c.session.InTransaction():
+		m.byte('T')
+	default:
+		m.byte('I')
+	}
+	if err := c.send(m); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *conn) sendError(err *pgError) error {
+	m := newMessage(msgErrorResponse)
+	m.byte('S')
+	m.string("ERROR")
+	m.byte('V')
+	m.string("ERROR")
+	m.byte('C')
+	m.string(err.code)
+	m.byte('M')
+	m.string(err.message)
+	m.byte(0)
+	return c.send(m)
+}
+
+func (c *conn) send(m *message) error {
+	return writeMessage(c.w, m)
+}
+
+// splitStatements 文字列リテラルの外にある ; で SQL を分割し、空の文を取り除く
+func splitStatements(sql string) []string {
+	var stmts []string
+	inString := false
+	start := 0
+	for i := 0; i <= len(sql); i++ {
+		if i < len(sql) {
+			if sql[i] == '\'' {
+				inString = !inString
+			}
+			if inString || sql[i] != ';' {
+				continue
+			}
+		}
+		if stmt := strings.TrimSpace(sql[start:i]); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		start = i + 1
+	}
+	return stmts
+}
+
+func firstWords(sql string, n int) []string {
+	words := strings.Fields(strings.ToLower(sql))
+	return words[:min(n, len(words))]
+}
+
+func isQuery(sql string) bool {
+	words := firstWords(sql, 1)
+	return len(words) == 1 && words[0] == "select"
+}
+
+// transactionCommand トランザクション制御文であれば begin/commit/rollback のいずれかを返す
+func transactionCommand(sql string) string {
+	words := firstWords(sql, 1)
+	if len(words) == 0 {
+		return ""
+	}
+	switch words[0] {
+	case "begin", "start":
+		return "begin"
+	case "commit", "end":
+		return "commit"
+	case "rollback", "abort":
+		return "rollback"
+	}
+	return ""
+}
+
+// commandTag CommandComplete で返すタグ
+func commandTag(sql string, n int) string {
+	words := firstWords(sql, 2)
+	switch words[0] {
+	case "insert":
+		return "INSERT 0 " + strconv.Itoa(n)
+	case "update", "delete":
+		return strings.ToUpper(words[0]) + " " + strconv.Itoa(n)
+	default:
+		return strings.ToUpper(strings.Join(words, " "))
+	}
+}
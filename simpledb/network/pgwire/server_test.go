@@ -0,0 +1,150 @@
+package pgwire_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"simpledb/network/pgwire"
+	"simpledb/server"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	simpleDB, err := server.NewOptimizedSimpleDB(path.Join(t.TempDir(), "pgwiredb"))
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := pgwire.NewServer(simpleDB)
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	addr := l.Addr().(*net.TCPAddr)
+	db, err := sql.Open("postgres", fmt.Sprintf("host=127.0.0.1 port=%d user=simpledb dbname=simpledb sslmode=disable", addr.Port))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPgwire(t *testing.T) {
+	db := openDB(t)
+
+	// 単純問い合わせ
+	_, err := db.Exec("create table player (player_id int, name varchar(10), point int)")
+	require.NoError(t, err)
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		_, err := tx.Exec(fmt.Sprintf("insert into player (player_id, name, point) values (%d, 'p%d', %d)", i, i, i*100))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+
+	// 拡張問い合わせ
+	res, err := db.Exec("update player set point = $1 where name = $2", 0, "p2")
+	require.NoError(t, err)
+	n, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var name string
+	var point int
+	require.NoError(t, db.QueryRow("select name, point from player where player_id = $1", 2).Scan(&name, &point))
+	assert.Equal(t, "p2", name)
+	assert.Equal(t, 0, point)
+
+	// ロールバック
+	tx, err = db.Begin()
+	require.NoError(t, err)
+	res, err = tx.Exec("delete from player")
+	require.NoError(t, err)
+	n, err = res.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	require.NoError(t, tx.Rollback())
+
+	rows, err := db.Query("select player_id, point from player")
+	require.NoError(t, err)
+	columns, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	assert.Equal(t, "INT4", columns[0].DatabaseTypeName())
+	got := map[int]int{}
+	for rows.Next() {
+		var id int
+		require.NoError(t, rows.Scan(&id, &point))
+		got[id] = point
+	}
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, map[int]int{1: 100, 2: 0, 3: 300, 4: 400}, got)
+}
+
+func TestPgwireError(t *testing.T) {
+	db := openDB(t)
+
+	_, err := db.Exec("create table t (a int)")
+	require.NoError(t, err)
+
+	_, err = db.Exec("select from t")
+	var pqErr *pq.Error
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("42601"), pqErr.Code)
+
+	// 明示的なトランザクションの中でエラーが発生すると、ロールバックされるまで他の文は拒否される
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("insert into t (a) values (1)")
+	require.NoError(t, err)
+	_, err = tx.Exec("insert into t (a values (2)")
+	require.Error(t, err)
+	_, err = tx.Exec("insert into t (a) values (3)")
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("25P02"), pqErr.Code)
+	require.NoError(t, tx.Rollback())
+
+	var count int
+	rows, err := db.Query("select a from t")
+	require.NoError(t, err)
+	for rows.Next() {
+		count++
+	}
+	require.NoError(t, rows.Close())
+	assert.Equal(t, 0, count)
+
+	_, err = db.Exec("insert into t (a) values ($1)", "it's")
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("0A000"), pqErr.Code)
+
+	_, err = db.Exec("create table u (id int primary key)")
+	require.NoError(t, err)
+	_, err = db.Exec("insert into u (id) values (1)")
+	require.NoError(t, err)
+	_, err = db.Exec("insert into u (id) values (1)")
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("23505"), pqErr.Code)
+
+	_, err = db.Exec("create table v (uid int references u)")
+	require.NoError(t, err)
+	_, err = db.Exec("insert into v (uid) values (2)")
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("23503"), pqErr.Code)
+	_, err = db.Exec("insert into v (uid) values ($1)", nil)
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table w (a int not null, b int check (b = 1))")
+	require.NoError(t, err)
+	_, err = db.Exec("insert into w (b) values (1)")
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("23502"), pqErr.Code)
+	_, err = db.Exec("insert into w (a, b) values (1, 2)")
+	require.True(t, errors.As(err, &pqErr))
+	assert.Equal(t, pq.ErrorCode("23514"), pqErr.Code)
+}
@@ -0,0 +1,226 @@
+package pgwire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"simpledb/network"
+	"simpledb/record"
+)
+
+// PostgreSQL の型 OID
+const (
+	oidInt2    = 21
+	oidInt4    = 23
+	oidInt8    = 20
+	oidText    = 25
+	oidName    = 19
+	oidBpchar  = 1042
+	oidVarchar = 1043
+	oidUnknown = 705
+)
+
+const (
+	formatText   = 0
+	formatBinary = 1
+)
+
+// typeOID record.FieldType を対応する PostgreSQL の型 OID と型の長さに変換する
+func typeOID(t record.FieldType) (oid int32, size int16) {
+	switch t {
+	case record.INT:
+		return oidInt4, 4
+	default:
+		return oidVarchar, -1
+	}
+}
+
+func rowDescription(columns []network.Column, formats []int16) *message {
+	m := newMessage(msgRowDescription)
+	m.int16(int16(len(columns)))
+	for i, col := range columns {
+		oid, size := typeOID(col.Type)
+		m.string(col.Name)
+		m.int32(0) // table OID
+		m.int16(0) // column attribute number
+		m.int32(oid)
+		m.int16(size)
+		m.int32(-1) // type modifier
+		m.int16(formatOf(formats, i))
+	}
+	return m
+}
+
+func dataRow(row []any, formats []int16) *message {
+	m := newMessage(msgDataRow)
+	m.int16(int16(len(row)))
+	for i, v := range row {
+		b := encodeValue(v, formatOf(formats, i))
+		if b == nil {
+			m.int32(-1)
+			continue
+		}
+		m.int32(int32(len(b)))
+		m.bytes(b)
+	}
+	return m
+}
+
+func encodeValue(v any, format int16) []byte {
+	switch v := v.(type) {
+	case int32:
+		if format == formatBinary {
+			return binary.BigEndian.AppendUint32(nil, uint32(v))
+		}
+		return []byte(strconv.Itoa(int(v)))
+	case string:
+		return []byte(v)
+	default:
+		return nil
+	}
+}
+
+// formatOf Bind で指定されたフォーマットコードのうち i 番目の列のものを返す
+// 0個なら全てテキスト、1個なら全ての列に同じフォーマットを使う
+func formatOf(formats []int16, i int) int16 {
+	switch len(formats) {
+	case 0:
+		return formatText
+	case 1:
+		return formats[0]
+	default:
+		return formats[i]
+	}
+}
+
+// parameter Bind で受け取ったパラメータ
+type parameter struct {
+	oid    int32
+	format int16
+	value  []byte // nil は NULL
+}
+
+// literal パラメータを SimpleDB の SQL リテラルに変換する
+// 型が宣言されていない場合は、整数として解釈できれば INT、そうでなければ VARCHAR として扱う
+func (p parameter) literal() (string, error) {
+	if p.value == nil {
+		return "NULL", nil
+	}
+
+	switch p.oid {
+	case oidInt2, oidInt4, oidInt8:
+		if p.format == formatBinary {
+			var v int64
+			switch len(p.value) {
+			case 2:
+				v = int64(int16(binary.BigEndian.Uint16(p.value)))
+			case 4:
+				v = int64(int32(binary.BigEndian.Uint32(p.value)))
+			case 8:
+				v = int64(binary.BigEndian.Uint64(p.value))
+			default:
+				return "", &pgError{code: codeProtocolViolation, message: "invalid binary integer parameter"}
+			}
+			return formatInt(v)
+		}
+		v, err := strconv.ParseInt(string(p.value), 10, 64)
+		if err != nil {
+			return "", &pgError{code: codeInvalidTextRepresentation, message: fmt.Sprintf("invalid input syntax for type integer: %q", p.value)}
+		}
+		return formatInt(v)
+	case oidText, oidVarchar, oidBpchar, oidName:
+		return quote(string(p.value))
+	default:
+		if p.format == formatText {
+			if v, err := strconv.ParseInt(string(p.value), 10, 32); err == nil {
+				return strconv.FormatInt(v, 10), nil
+			}
+		}
+		return quote(string(p.value))
+	}
+}
+
+func formatInt(v int64) (string, error) {
+	if int64(int32(v)) != v {
+		return "", &pgError{code: codeNumericValueOutOfRange, message: fmt.Sprintf("value %d is out of range for type integer", v)}
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+// quote SimpleDB の文字列リテラルはエスケープをサポートしないため、' を含む値は扱えない
+func quote(s string) (string, error) {
+	if strings.ContainsRune(s, '\'') {
+		return "", &pgError{code: codeFeatureNotSupported, message: "string parameters containing a single quote are not supported"}
+	}
+	return "'" + s + "'", nil
+}
+
+// countParams SQL 中の $n プレースホルダーの最大の番号を返す
+func countParams(sql string) int {
+	n := 0
+	_, _ = substitute(sql, func(i int) (string, error) {
+		n = max(n, i)
+		return "", nil
+	})
+	return n
+}
+
+// bindParams $n プレースホルダーをパラメータのリテラルで置き換える
+func bindParams(sql string, params []parameter) (string, error) {
+	return substitute(sql, func(i int) (string, error) {
+		if i < 1 || i > len(params) {
+			return "", &pgError{code: codeProtocolViolation, message: fmt.Sprintf("there is no parameter $%d", i)}
+		}
+		return params[i-1].literal()
+	})
+}
+
+// placeholderParams 値を持たないまま文を計画するために、$n プレースホルダーを宣言された型のダミー値で置き換える
+func placeholderParams(sql string, oids []int32) string {
+	s, _ := substitute(sql, func(i int) (string, error) {
+		if 1 <= i && i <= len(oids) {
+			switch oids[i-1] {
+			case oidText, oidVarchar, oidBpchar, oidName:
+				return "''", nil
+			}
+		}
+		return "0", nil
+	})
+	return s
+}
+
+func substitute(sql string, replace func(i int) (string, error)) (string, error) {
+	var sb strings.Builder
+	inString := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if c == '\'' {
+			inString = !inString
+		}
+		if inString || c != '$' {
+			sb.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(sql) && '0' <= sql[j] && sql[j] <= '9' {
+			j++
+		}
+		if j == i+1 {
+			sb.WriteByte(c)
+			continue
+		}
+		n, err := strconv.Atoi(sql[i+1 : j])
+		if err != nil {
+			return "", err
+		}
+		lit, err := replace(n)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(lit)
+		i = j - 1
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,41 @@
+package pgwire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindParams(t *testing.T) {
+	t.Parallel()
+
+	sql := "select a from t where a = $1 and b = $2 and c = '$1'"
+	assert.Equal(t, 2, countParams(sql))
+
+	got, err := bindParams(sql, []parameter{
+		{oid: oidUnknown, value: []byte("10")},
+		{oid: oidUnknown, value: []byte("abc")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "select a from t where a = 10 and b = 'abc' and c = '$1'", got)
+
+	got, err = bindParams("select a from t where b = $1", []parameter{{oid: oidVarchar, value: []byte("10")}})
+	require.NoError(t, err)
+	assert.Equal(t, "select a from t where b = '10'", got)
+
+	got, err = bindParams("select a from t where a = $1", []parameter{{oid: oidInt4, format: formatBinary, value: []byte{0, 0, 1, 0}}})
+	require.NoError(t, err)
+	assert.Equal(t, "select a from t where a = 256", got)
+
+	_, err = bindParams("select a from t where a = $2", []parameter{{oid: oidInt4, value: []byte("1")}})
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"select a from t", "insert into t (b) values ('x;y')"},
+		splitStatements("select a from t; insert into t (b) values ('x;y');  ;"))
+	assert.Empty(t, splitStatements(" ; "))
+}
@@ -0,0 +1,166 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+)
+
+// maxFrameSize 1フレームの最大サイズ。壊れた長さを受け取った時に巨大なバッファを確保しないための上限
+const maxFrameSize = 16 << 20
+
+// FetchSize 1回の fetch で返す最大行数
+const FetchSize = 100
+
+// Op クライアントからのリクエストの種類
+type Op string
+
+const (
+	OpBegin    Op = "begin"
+	OpCommit   Op = "commit"
+	OpRollback Op = "rollback"
+	OpExec     Op = "exec"
+	OpQuery    Op = "query"
+	OpFetch    Op = "fetch"
+	OpClose    Op = "close"
+)
+
+// Request クライアントから送られる1フレーム
+type Request struct {
+	Op  Op     `json:"op"`
+	SQL string `json:"sql,omitempty"`
+}
+
+// Column 結果セットの列
+type Column struct {
+	Name string           `json:"name"`
+	Type record.FieldType `json:"type"`
+}
+
+// Response サーバーから返される1フレーム
+// Rows の各値は INT なら数値、VARCHAR なら文字列として JSON にエンコードされる
+type Response struct {
+	Err          *Error   `json:"err,omitempty"`
+	RowsAffected int      `json:"rows_affected,omitempty"`
+	Columns      []Column `json:"columns,omitempty"`
+	Rows         [][]any  `json:"rows,omitempty"`
+	Done         bool     `json:"done,omitempty"`
+}
+
+// ErrorCode エラーの分類。クライアント側で元のエラーの種類を判別するために使う
+type ErrorCode string
+
+const (
+	CodeSyntax     ErrorCode = "syntax"
+	CodeConstraint ErrorCode = "constraint"
+	CodeProtocol   ErrorCode = "protocol"
+	CodeInternal   ErrorCode = "internal"
+)
+
+// Error サーバー側で発生したエラー
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Constraint 制約違反の詳細。Code が CodeConstraint の時だけ設定される
+	Constraint *metadata.ConstraintViolationError `json:"constraint,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap クライアント側でも errors.As で制約違反を取り出せるようにする
+func (e *Error) Unwrap() error {
+	if e.Constraint == nil {
+		return nil
+	}
+	return e.Constraint
+}
+
+// CodeOf err に対応する ErrorCode
+func CodeOf(err error) ErrorCode {
+	return newError(err).Code
+}
+
+func newError(err error) *Error {
+	var remoteErr *Error
+	if errors.As(err, &remoteErr) {
+		return remoteErr
+	}
+	var syntaxErr *parse.BadSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &Error{Code: CodeSyntax, Message: err.Error()}
+	}
+	var constraintErr *metadata.ConstraintViolationError
+	if errors.As(err, &constraintErr) {
+		return &Error{Code: CodeConstraint, Message: err.Error(), Constraint: constraintErr}
+	}
+	return &Error{Code: CodeInternal, Message: err.Error()}
+}
+
+// フレームは 4byte (big endian) の長さと、その長さ分の JSON で構成される
+func writeFrame(w *bufio.Writer, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func readFrame(r io.Reader, v any) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return fmt.Errorf("frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return nil
+}
+
+// DecodeValue JSON から復元した値を列の型に合わせて変換する
+func DecodeValue(col Column, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch col.Type {
+	case record.INT:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("column %s: expected number, but got %T", col.Name, v)
+		}
+		return int32(f), nil
+	case record.VARCHAR:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("column %s: expected string, but got %T", col.Name, v)
+		}
+		return s, nil
+	default:
+		return nil, query.ErrUnkownFieldType
+	}
+}
@@ -0,0 +1,174 @@
+package network
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"simpledb/server"
+	"simpledb/util/logger"
+)
+
+// ConnHandler 1つの接続上でプロトコルを処理する。戻り値のエラーはログに出力される
+type ConnHandler func(conn net.Conn, session *Session) error
+
+// Server SimpleDB を TCP 経由で複数のクライアントに提供する
+// 接続ごとに Session を作成し、各 Session がそれぞれのトランザクションを持つ
+type Server struct {
+	logger *logger.Logger
+
+	db      *server.SimpleDB
+	handler ConnHandler
+
+	mux      sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+// NewServer フレーム化した独自プロトコルを話すサーバーを作成する
+func NewServer(db *server.SimpleDB) *Server {
+	return NewServerWithHandler("network.Server", db, serveFrames)
+}
+
+// NewServerWithHandler 任意のプロトコルを話すサーバーを作成する
+func NewServerWithHandler(name string, db *server.SimpleDB, handler ConnHandler) *Server {
+	return &Server{
+		logger: logger.New(name, logger.Info),
+
+		db:      db,
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("net.Listen: %w", err)
+	}
+	return s.Serve(l)
+}
+
+// Serve l で接続を受け付ける。Close されるまで戻らない
+func (s *Server) Serve(l net.Listener) error {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return net.ErrClosed
+	}
+	s.listener = l
+	s.mux.Unlock()
+
+	s.logger.Infof("listening on %s", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mux.Lock()
+			closed := s.closed
+			s.mux.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("l.Accept: %w", err)
+		}
+
+		s.mux.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mux.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close リスナーと全ての接続を閉じ、セッションの終了を待つ
+func (s *Server) Close() error {
+	s.mux.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mux.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		s.mux.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	s.logger.Debugf("(%s) session started", conn.RemoteAddr())
+	session := NewSession(s.db)
+	defer func() {
+		if err := session.Close(); err != nil {
+			s.logger.Infof("(%s) session.Close: %v", conn.RemoteAddr(), err)
+		}
+		s.logger.Debugf("(%s) session finished", conn.RemoteAddr())
+	}()
+
+	if err := s.handler(conn, session); err != nil &&
+		!errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		s.logger.Infof("(%s) %v", conn.RemoteAddr(), err)
+	}
+}
+
+func serveFrames(conn net.Conn, session *Session) error {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		var req Request
+		if err := readFrame(r, &req); err != nil {
+			return fmt.Errorf("readFrame: %w", err)
+		}
+
+		res := handle(session, &req)
+		if err := writeFrame(w, res); err != nil {
+			return fmt.Errorf("writeFrame: %w", err)
+		}
+	}
+}
+
+func handle(session *Session, req *Request) *Response {
+	res := &Response{}
+	var err error
+	switch req.Op {
+	case OpBegin:
+		err = session.Begin()
+	case OpCommit:
+		err = session.Commit()
+	case OpRollback:
+		err = session.Rollback()
+	case OpExec:
+		res.RowsAffected, err = session.Exec(req.SQL)
+	case OpQuery:
+		res.Columns, err = session.Query(req.SQL)
+		if err == nil {
+			res.Rows, res.Done, err = session.Fetch(FetchSize)
+		}
+	case OpFetch:
+		res.Rows, res.Done, err = session.Fetch(FetchSize)
+	case OpClose:
+		err = session.CloseRows()
+	default:
+		err = &Error{Code: CodeProtocol, Message: fmt.Sprintf("unknown op: %q", req.Op)}
+	}
+	if err != nil {
+		return &Response{Err: newError(err)}
+	}
+	return res
+}
@@ -0,0 +1,232 @@
+package network
+
+import (
+	"errors"
+
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/server"
+	"simpledb/tx"
+)
+
+var (
+	ErrNoTransaction      = errors.New("no transaction in progress")
+	ErrAlreadyInTx        = errors.New("transaction already in progress")
+	ErrNoResultSet        = errors.New("no result set is open")
+	ErrResultSetStillOpen = errors.New("result set is still open")
+)
+
+// Session 1つのクライアント接続に対応するサーバー側の状態
+// 明示的に Begin されていない場合は、文ごとにトランザクションを開始してコミットする (autocommit)
+type Session struct {
+	db *server.SimpleDB
+
+	tx         *tx.Transaction
+	autoCommit bool
+
+	scan    query.Scan
+	columns []Column
+	// fetchErr 結果セットの読み込みで起きたエラー。autocommit のトランザクションはコミットせずにロールバックする
+	fetchErr error
+}
+
+func NewSession(db *server.SimpleDB) *Session {
+	return &Session{db: db}
+}
+
+// InTransaction 明示的に開始されたトランザクションがあるか
+func (s *Session) InTransaction() bool {
+	return s.tx != nil && !s.autoCommit
+}
+
+func (s *Session) Begin() error {
+	if s.scan != nil {
+		return ErrResultSetStillOpen
+	}
+	if s.tx != nil {
+		return ErrAlreadyInTx
+	}
+	tx, err := s.db.NewTx()
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	s.autoCommit = false
+	return nil
+}
+
+func (s *Session) Commit() error {
+	if !s.InTransaction() {
+		return ErrNoTransaction
+	}
+	s.closeScan()
+	return s.finish(true)
+}
+
+func (s *Session) Rollback() error {
+	if !s.InTransaction() {
+		return ErrNoTransaction
+	}
+	s.closeScan()
+	return s.finish(false)
+}
+
+// Exec 更新系の SQL を実行し、影響を受けた行数を返す
+func (s *Session) Exec(sql string) (int, error) {
+	if s.scan != nil {
+		return 0, ErrResultSetStillOpen
+	}
+	if err := s.ensureTx(); err != nil {
+		return 0, err
+	}
+	n, err := s.db.Planner().ExecuteUpdate(sql, s.tx)
+	if s.autoCommit {
+		if finishErr := s.finish(err == nil); err == nil {
+			err = finishErr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Query SELECT 文を実行して結果セットを開く。行は Fetch で取得する
+func (s *Session) Query(sql string) ([]Column, error) {
+	if s.scan != nil {
+		return nil, ErrResultSetStillOpen
+	}
+	if err := s.ensureTx(); err != nil {
+		return nil, err
+	}
+	p, err := s.db.Planner().CreateQueryPlan(sql, s.tx)
+	if err == nil {
+		s.scan, err = p.Open()
+	}
+	if err != nil {
+		if s.autoCommit {
+			_ = s.finish(false)
+		}
+		return nil, err
+	}
+
+	s.columns = columnsOf(p.Schema())
+	return s.columns, nil
+}
+
+// Describe SELECT 文の結果セットの列を、実行せずに返す
+func (s *Session) Describe(sql string) ([]Column, error) {
+	if err := s.ensureTx(); err != nil {
+		return nil, err
+	}
+	autoCommit := s.autoCommit && s.scan == nil
+	p, err := s.db.Planner().CreateQueryPlan(sql, s.tx)
+	if autoCommit {
+		if finishErr := s.finish(err == nil); err == nil {
+			err = finishErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return columnsOf(p.Schema()), nil
+}
+
+// Fetch 開いている結果セットから最大 n 行を取得する。結果セットを読み切ると done が true になり自動的に閉じられる
+func (s *Session) Fetch(n int) (rows [][]any, done bool, err error) {
+	if s.scan == nil {
+		return nil, false, ErrNoResultSet
+	}
+	for len(rows) < n {
+		next, err := s.scan.Next()
+		if err != nil {
+			s.fetchErr = err
+			_ = s.CloseRows()
+			return nil, false, err
+		}
+		if !next {
+			return rows, true, s.CloseRows()
+		}
+		row := make([]any, len(s.columns))
+		for i, col := range s.columns {
+			val, err := s.scan.GetVal(col.Name)
+			if err != nil {
+				s.fetchErr = err
+				_ = s.CloseRows()
+				return nil, false, err
+			}
+			row[i] = val.AnyValue()
+		}
+		rows = append(rows, row)
+	}
+	return rows, false, nil
+}
+
+// Columns 開いている結果セットの列
+func (s *Session) Columns() []Column {
+	return s.columns
+}
+
+// CloseRows 結果セットを閉じる。autocommit のトランザクションであればここでコミットする
+// 読み込みに失敗した結果セットのトランザクションはロールバックする
+func (s *Session) CloseRows() error {
+	if s.scan == nil {
+		return nil
+	}
+	failed := s.fetchErr != nil
+	s.closeScan()
+	if s.autoCommit {
+		return s.finish(!failed)
+	}
+	return nil
+}
+
+// Close 接続の終了時に呼ばれる。コミットされていないトランザクションはロールバックする
+func (s *Session) Close() error {
+	s.closeScan()
+	if s.tx == nil {
+		return nil
+	}
+	return s.finish(false)
+}
+
+func (s *Session) ensureTx() error {
+	if s.tx != nil {
+		return nil
+	}
+	tx, err := s.db.NewTx()
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	s.autoCommit = true
+	return nil
+}
+
+func (s *Session) finish(commit bool) error {
+	tx := s.tx
+	s.tx = nil
+	s.autoCommit = false
+	if commit {
+		return tx.Commit()
+	}
+	return tx.Rollback()
+}
+
+func (s *Session) closeScan() {
+	if s.scan == nil {
+		return
+	}
+	s.scan.Close()
+	s.scan = nil
+	s.columns = nil
+	s.fetchErr = nil
+}
+
+func columnsOf(schema *record.Schema) []Column {
+	columns := make([]Column, 0, len(schema.Fields()))
+	for _, fieldName := range schema.Fields() {
+		columns = append(columns, Column{Name: fieldName, Type: schema.Type(fieldName)})
+	}
+	return columns
+}
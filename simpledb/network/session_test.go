@@ -0,0 +1,87 @@
+package network_test
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"simpledb/file"
+	"simpledb/network"
+	"simpledb/query"
+	"simpledb/server"
+	"simpledb/tx/recovery"
+)
+
+// lastLogOp ログの最後のレコードの種類
+func lastLogOp(t *testing.T, db *server.SimpleDB) recovery.LogRecordType {
+	t.Helper()
+	iter, err := db.LogManager().Iterator()
+	if err != nil {
+		t.Fatalf("failed to iterate log: %v", err)
+	}
+	if !iter.HasNext() {
+		t.Fatalf("log is empty")
+	}
+	rec, err := iter.Next()
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	return recovery.LogRecordType(file.NewPageWith(rec).GetInt(0))
+}
+
+func TestSessionAutoCommitFetchError(t *testing.T) {
+	db, err := server.NewOptimizedSimpleDB(path.Join(t.TempDir(), "sessiondb"))
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	s := network.NewSession(db)
+	defer s.Close()
+	for _, cmd := range []string{
+		"create table item (id int)",
+		"insert into item (id) values (1)",
+		"insert into item (id) values (2)",
+	} {
+		if _, err := s.Exec(cmd); err != nil {
+			t.Fatalf("failed to exec %q: %v", cmd, err)
+		}
+	}
+
+	// 読み切った結果セットの文はコミットする
+	if _, err := s.Query("select id from item"); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if _, done, err := s.Fetch(10); err != nil || !done {
+		t.Fatalf("failed to fetch: done=%v, err=%v", done, err)
+	}
+	if op := lastLogOp(t, db); op != recovery.Commit {
+		t.Errorf("last log record is %d, want commit", op)
+	}
+
+	// 読み込みに失敗した結果セットの文はロールバックする
+	if _, err := s.Query("select id from item where id = (select id from item)"); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if _, _, err := s.Fetch(10); !errors.Is(err, query.ErrMultipleRows) {
+		t.Fatalf("fetch returned %v, want %v", err, query.ErrMultipleRows)
+	}
+	if err := s.CloseRows(); err != nil {
+		t.Fatalf("failed to close rows: %v", err)
+	}
+	if op := lastLogOp(t, db); op != recovery.Rollback {
+		t.Errorf("last log record is %d, want rollback", op)
+	}
+	if s.InTransaction() {
+		t.Errorf("session is still in a transaction")
+	}
+
+	// 次の文は新しいトランザクションで実行し、コミットする
+	if _, err := s.Query("select id from item"); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if err := s.CloseRows(); err != nil {
+		t.Fatalf("failed to close rows: %v", err)
+	}
+	if op := lastLogOp(t, db); op != recovery.Commit {
+		t.Errorf("last log record is %d, want commit", op)
+	}
+}
@@ -12,6 +12,142 @@ type QueryData struct {
 	Fields []string
 	Tables []string
 	Pred   *query.Predicate
+	// Exprs 選択リストで AS を付けた列を計算する式。キーは Fields に含まれる列名
+	Exprs map[string]*query.Expression
+	// Windows 選択リストのウィンドウ関数。キーは Fields に含まれる列名
+	Windows map[string]*WindowData
+	// Derived FROM句の導出表の問合せ。キーは Tables に含まれる別名
+	Derived map[string]*QueryData
+	// Aliases 別名を付けた表とビューの名前。キーは Tables に含まれる別名
+	Aliases map[string]string
+	// Joins 外部結合。Tables に含まれる表を、Tables の順に左から結合する
+	Joins []*JoinData
+	// SetOp 集合演算。nil でなければ、この問合せは Lhs と Rhs の集合演算で、Fields は Lhs の列名
+	SetOp *SetOpData
+	// Distinct 重複したレコードを除く
+	Distinct bool
+	// OrderBy 並べる列。選択リストの列名か、FROM句の参照の列
+	OrderBy []string
+	// Descending OrderBy の同じ位置の列を降順に並べるか
+	Descending []bool
+	// Limit 返すレコードの最大数。NoLimit なら制限しない
+	Limit int32
+	// Offset 返す前に読み飛ばすレコードの数
+	Offset int32
+}
+
+// WindowData ウィンドウ関数。PartitionBy の値が等しいレコードごとに、OrderBy の順に並べて計算する
+type WindowData struct {
+	// Func query.WindowRowNumber などの関数の名前
+	Func string
+	// Field 引数の列。引数のない関数と count(*) では空
+	Field string
+	// Offset lag と lead で何件前か後のレコードの値を返すか
+	Offset      int32
+	PartitionBy []string
+	OrderBy     []string
+	// Descending OrderBy の同じ位置の列を降順に並べるか
+	Descending []bool
+}
+
+func NewWindowData(fn string, field string, offset int32, partitionBy []string, orderBy []string, descending []bool) *WindowData {
+	return &WindowData{
+		Func:        fn,
+		Field:       field,
+		Offset:      offset,
+		PartitionBy: partitionBy,
+		OrderBy:     orderBy,
+		Descending:  descending,
+	}
+}
+
+// WindowFn 列 fieldName を出力するウィンドウ関数
+func (w *WindowData) WindowFn(fieldName string) *query.WindowFn {
+	return query.NewWindowFn(fieldName, w.Func, w.Field, w.Offset)
+}
+
+func (w *WindowData) String() string {
+	var over []string
+	if len(w.PartitionBy) > 0 {
+		over = append(over, "partition by "+strings.Join(w.PartitionBy, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		over = append(over, "order by "+orderByString(w.OrderBy, w.Descending))
+	}
+	return fmt.Sprintf("%s over (%s)", w.WindowFn(""), strings.Join(over, " "))
+}
+
+// orderByString ORDER BY の列のリスト。降順の列には DESC を付ける
+func orderByString(orderBy []string, descending []bool) string {
+	items := make([]string, len(orderBy))
+	for i, fieldName := range orderBy {
+		items[i] = fieldName
+		if i < len(descending) && descending[i] {
+			items[i] += " desc"
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// NoLimit LIMIT が指定されていないことを表す QueryData.Limit の値
+const NoLimit = -1
+
+// AllColumns 選択リストの * を表す列名。t.* は query.QualifiedFieldName(t, AllColumns) で表す
+const AllColumns = "*"
+
+// IsAllColumns 選択リストの列 fieldName が * か t.* か。t.* であれば参照名 t も返す
+func IsAllColumns(fieldName string) (qualifier string, ok bool) {
+	qualifier, name := query.SplitFieldName(fieldName)
+	return qualifier, name == AllColumns
+}
+
+// 集合演算の種類
+const (
+	SetUnion     = "union"
+	SetIntersect = "intersect"
+	SetExcept    = "except"
+)
+
+// SetOpData 2つの問合せ Lhs と Rhs の集合演算。列は位置で対応させる
+type SetOpData struct {
+	Op string
+	// All 重複を除かない (UNION ALL)
+	All      bool
+	Lhs, Rhs *QueryData
+}
+
+// NewSetOpQueryData 問合せ lhs と rhs を集合演算 op で組み合わせた問合せ
+func NewSetOpQueryData(op string, all bool, lhs, rhs *QueryData) *QueryData {
+	data := NewQueryData(lhs.Fields, nil, query.NewPredicate())
+	data.SetOp = &SetOpData{
+		Op:  op,
+		All: all,
+		Lhs: lhs,
+		Rhs: rhs,
+	}
+	return data
+}
+
+// 外部結合の種類
+const (
+	JoinLeft  = "left"
+	JoinRight = "right"
+	JoinFull  = "full"
+)
+
+// JoinData 外部結合。Tables の中で Table より前にある表を左側、Table を右側として、述語 On で結合する
+type JoinData struct {
+	Type  string
+	Table string
+	On    *query.Predicate
+}
+
+func NewJoinData(joinType string, table string, on *query.Predicate) *JoinData {
+	return &JoinData{
+		Type:  joinType,
+		Table: table,
+		On:    on,
+	}
 }
 
 func NewQueryData(fields, tables []string, pred *query.Predicate) *QueryData {
@@ -19,12 +155,115 @@ func NewQueryData(fields, tables []string, pred *query.Predicate) *QueryData {
 		Fields: fields,
 		Tables: tables,
 		Pred:   pred,
+		Limit:  NoLimit,
+	}
+}
+
+// HasAllColumns 選択リストに * か t.* があるか
+func (q *QueryData) HasAllColumns() bool {
+	for _, fieldName := range q.Fields {
+		if _, ok := IsAllColumns(fieldName); ok {
+			return true
+		}
 	}
+	return false
+}
+
+// TableName FROM句で ref として参照する表かビューの名前
+func (q *QueryData) TableName(ref string) string {
+	if tableName, ok := q.Aliases[ref]; ok {
+		return tableName
+	}
+	return ref
+}
+
+// Join ref を右側とする外部結合。なければ nil
+func (q *QueryData) Join(ref string) *JoinData {
+	for _, j := range q.Joins {
+		if j.Table == ref {
+			return j
+		}
+	}
+	return nil
+}
+
+// Subqueries 選択リスト、外部結合の述語と述語に含まれる副問合せ。導出表は含まない
+// 集合演算では両側の問合せの副問合せ
+func (q *QueryData) Subqueries() []*query.Subquery {
+	if q.SetOp != nil {
+		return append(q.SetOp.Lhs.Subqueries(), q.SetOp.Rhs.Subqueries()...)
+	}
+	var result []*query.Subquery
+	for _, fieldName := range q.Fields {
+		if e, ok := q.Exprs[fieldName]; ok && e.IsSubquery() {
+			result = append(result, e.AsSubquery())
+		}
+	}
+	for _, j := range q.Joins {
+		result = append(result, j.On.Subqueries()...)
+	}
+	return append(result, q.Pred.Subqueries()...)
 }
 
 func (q *QueryData) String() string {
 	var sb strings.Builder
-	fmt.Fprintf(&sb, "select %s from %s", strings.Join(q.Fields, ", "), strings.Join(q.Tables, ", "))
+	if q.SetOp != nil {
+		op := q.SetOp.Op
+		if q.SetOp.All {
+			op += " all"
+		}
+		fmt.Fprintf(&sb, "%s %s %s", q.SetOp.Lhs, op, q.SetOp.Rhs)
+	} else {
+		sb.WriteString(q.selectString())
+	}
+
+	if len(q.OrderBy) > 0 {
+		fmt.Fprintf(&sb, " order by %s", orderByString(q.OrderBy, q.Descending))
+	}
+	if q.Limit != NoLimit {
+		fmt.Fprintf(&sb, " limit %d", q.Limit)
+	}
+	if q.Offset > 0 {
+		fmt.Fprintf(&sb, " offset %d", q.Offset)
+	}
+	return sb.String()
+}
+
+// selectString ORDER BY と LIMIT を除いた SELECT文
+func (q *QueryData) selectString() string {
+	fields := make([]string, 0, len(q.Fields))
+	for _, fieldName := range q.Fields {
+		if e, ok := q.Exprs[fieldName]; ok {
+			fields = append(fields, fmt.Sprintf("%s as %s", e, fieldName))
+		} else if w, ok := q.Windows[fieldName]; ok {
+			fields = append(fields, fmt.Sprintf("%s as %s", w, fieldName))
+		} else {
+			fields = append(fields, fieldName)
+		}
+	}
+	var tables strings.Builder
+	for i, ref := range q.Tables {
+		table := ref
+		if d, ok := q.Derived[ref]; ok {
+			table = fmt.Sprintf("(%s) as %s", d, ref)
+		} else if tableName, ok := q.Aliases[ref]; ok {
+			table = fmt.Sprintf("%s %s", tableName, ref)
+		}
+		if j := q.Join(ref); j != nil {
+			fmt.Fprintf(&tables, " %s join %s on %s", j.Type, table, j.On)
+		} else if i > 0 {
+			fmt.Fprintf(&tables, ", %s", table)
+		} else {
+			tables.WriteString(table)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("select ")
+	if q.Distinct {
+		sb.WriteString("distinct ")
+	}
+	fmt.Fprintf(&sb, "%s from %s", strings.Join(fields, ", "), tables.String())
 
 	if pred := q.Pred.String(); pred != "" {
 		fmt.Fprintf(&sb, " where %s", pred)
@@ -45,6 +284,13 @@ func (*DeleteData) updateCmd()      {}
 func (*CreateTableData) updateCmd() {}
 func (*CreateViewData) updateCmd()  {}
 func (*CreateIndexData) updateCmd() {}
+func (*DropTableData) updateCmd()   {}
+func (*DropViewData) updateCmd()    {}
+func (*DropIndexData) updateCmd()   {}
+func (*AlterTableData) updateCmd()  {}
+func (*VacuumData) updateCmd()      {}
+func (*ReindexData) updateCmd()     {}
+func (*CheckIndexData) updateCmd()  {}
 
 // InsertData INSERT文
 type InsertData struct {
@@ -95,12 +341,92 @@ func NewDeleteData(tableName string, pred *query.Predicate) *DeleteData {
 type CreateTableData struct {
 	TableName string
 	NewSchema *record.Schema
+	// Keys 列または表に付けられた PRIMARY KEY と UNIQUE 制約
+	Keys []*KeyConstraint
+	// ForeignKeys 列または表に付けられた外部キー制約
+	ForeignKeys []*ForeignKeyConstraint
+	// Columns 列名ごとの NOT NULL, DEFAULT, CHECK 制約。制約のない列は含まない
+	Columns map[string]*ColumnConstraint
+	// Format USING で指定されたレコードの格納形式
+	Format record.Format
 }
 
-func NewCreateTableData(tableName string, newSchema *record.Schema) *CreateTableData {
+func NewCreateTableData(tableName string, newSchema *record.Schema, keys []*KeyConstraint, foreignKeys []*ForeignKeyConstraint, columns map[string]*ColumnConstraint) *CreateTableData {
 	return &CreateTableData{
-		TableName: tableName,
-		NewSchema: newSchema,
+		TableName:   tableName,
+		NewSchema:   newSchema,
+		Keys:        keys,
+		ForeignKeys: foreignKeys,
+		Columns:     columns,
+	}
+}
+
+// column 列 fieldName の制約。なければ作る
+func (d *CreateTableData) column(fieldName string) *ColumnConstraint {
+	if d.Columns == nil {
+		d.Columns = make(map[string]*ColumnConstraint)
+	}
+	c, ok := d.Columns[fieldName]
+	if !ok {
+		c = &ColumnConstraint{}
+		d.Columns[fieldName] = c
+	}
+	return c
+}
+
+// ColumnConstraint 列に付けられた NOT NULL, DEFAULT, CHECK 制約
+type ColumnConstraint struct {
+	NotNull bool
+	// Default INSERT文で列が省略された時の値。nil なら NULL
+	Default *query.Constant
+	// Check 挿入・更新した行が満たすべき述語。nil なら制約なし
+	Check *query.Predicate
+}
+
+func NewColumnConstraint(notNull bool, defaultVal *query.Constant, check *query.Predicate) *ColumnConstraint {
+	return &ColumnConstraint{
+		NotNull: notNull,
+		Default: defaultVal,
+		Check:   check,
+	}
+}
+
+// KeyConstraint PRIMARY KEY または UNIQUE 制約
+type KeyConstraint struct {
+	FieldNames []string
+	PrimaryKey bool
+}
+
+func NewKeyConstraint(fieldNames []string, primaryKey bool) *KeyConstraint {
+	return &KeyConstraint{
+		FieldNames: fieldNames,
+		PrimaryKey: primaryKey,
+	}
+}
+
+// ON DELETE に指定できる参照動作
+const (
+	OnDeleteRestrict = "restrict"
+	OnDeleteCascade  = "cascade"
+	OnDeleteSetNull  = "setnull"
+)
+
+// ForeignKeyConstraint FieldNames が表 RefTableName の RefFieldNames を参照する外部キー制約
+type ForeignKeyConstraint struct {
+	FieldNames   []string
+	RefTableName string
+	// RefFieldNames 省略された場合は nil で、参照先の主キーを参照する
+	RefFieldNames []string
+	// OnDelete 参照先の行を削除した時の動作。省略された場合は OnDeleteRestrict
+	OnDelete string
+}
+
+func NewForeignKeyConstraint(fieldNames []string, refTableName string, refFieldNames []string, onDelete string) *ForeignKeyConstraint {
+	return &ForeignKeyConstraint{
+		FieldNames:    fieldNames,
+		RefTableName:  refTableName,
+		RefFieldNames: refFieldNames,
+		OnDelete:      onDelete,
 	}
 }
 
@@ -108,12 +434,15 @@ func NewCreateTableData(tableName string, newSchema *record.Schema) *CreateTable
 type CreateViewData struct {
 	ViewName  string
 	QueryData *QueryData
+	// OrReplace 同じ名前のビューがあれば定義を置き換える
+	OrReplace bool
 }
 
-func NewCreateViewData(viewName string, queryData *QueryData) *CreateViewData {
+func NewCreateViewData(viewName string, queryData *QueryData, orReplace bool) *CreateViewData {
 	return &CreateViewData{
 		ViewName:  viewName,
 		QueryData: queryData,
+		OrReplace: orReplace,
 	}
 }
 
@@ -123,15 +452,170 @@ func (cv *CreateViewData) ViewDef() string {
 
 // CreateIndexData CREATE INDEX文
 type CreateIndexData struct {
+	IndexName  string
+	TableName  string
+	FieldNames []string
+	// IncludedFields INCLUDE で指定された、キーには含めずに索引のレコードに格納する列
+	IncludedFields []string
+	// IndexType USING で指定された索引の種類 (btree または hash)
+	IndexType string
+	// FillFactor WITH (FILLFACTOR = n) で指定された、索引を作る時に葉とディレクトリに詰めるレコードの割合 (%)。指定がなければ 0
+	FillFactor int32
+}
+
+func NewCreateIndexData(indexName string, tableName string, fieldNames []string, includedFields []string, indexType string, fillFactor int32) *CreateIndexData {
+	return &CreateIndexData{
+		IndexName:      indexName,
+		TableName:      tableName,
+		FieldNames:     fieldNames,
+		IncludedFields: includedFields,
+		IndexType:      indexType,
+		FillFactor:     fillFactor,
+	}
+}
+
+// DropTableData DROP TABLE文
+type DropTableData struct {
+	TableName string
+	// IfExists 表が存在しなくてもエラーにしない
+	IfExists bool
+}
+
+func NewDropTableData(tableName string, ifExists bool) *DropTableData {
+	return &DropTableData{
+		TableName: tableName,
+		IfExists:  ifExists,
+	}
+}
+
+// DropViewData DROP VIEW文
+type DropViewData struct {
+	ViewName string
+	IfExists bool
+}
+
+func NewDropViewData(viewName string, ifExists bool) *DropViewData {
+	return &DropViewData{
+		ViewName: viewName,
+		IfExists: ifExists,
+	}
+}
+
+// DropIndexData DROP INDEX文
+type DropIndexData struct {
 	IndexName string
+	IfExists  bool
+}
+
+func NewDropIndexData(indexName string, ifExists bool) *DropIndexData {
+	return &DropIndexData{
+		IndexName: indexName,
+		IfExists:  ifExists,
+	}
+}
+
+// ALTER TABLE文で行う変更の種類
+const (
+	AlterAddColumn    = "addcolumn"
+	AlterDropColumn   = "dropcolumn"
+	AlterRenameColumn = "renamecolumn"
+	AlterRenameTable  = "renametable"
+)
+
+// AlterTableData ALTER TABLE文
+type AlterTableData struct {
 	TableName string
+	// Action 変更の種類。AlterAddColumn などのいずれか
+	Action string
+	// Column ADD COLUMN で追加する列。列を1つだけ持つ CREATE TABLE文として表す
+	Column *CreateTableData
+	// FieldName DROP COLUMN, RENAME COLUMN の対象の列
 	FieldName string
+	// NewName RENAME COLUMN の新しい列名、または RENAME TO の新しい表名
+	NewName string
 }
 
-func NewCreateIndexData(indexName string, tableName string, fieldName string) *CreateIndexData {
-	return &CreateIndexData{
-		IndexName: indexName,
+func NewAddColumnData(tableName string, column *CreateTableData) *AlterTableData {
+	return &AlterTableData{
 		TableName: tableName,
+		Action:    AlterAddColumn,
+		Column:    column,
+	}
+}
+
+func NewDropColumnData(tableName string, fieldName string) *AlterTableData {
+	return &AlterTableData{
+		TableName: tableName,
+		Action:    AlterDropColumn,
 		FieldName: fieldName,
 	}
 }
+
+func NewRenameColumnData(tableName string, fieldName string, newFieldName string) *AlterTableData {
+	return &AlterTableData{
+		TableName: tableName,
+		Action:    AlterRenameColumn,
+		FieldName: fieldName,
+		NewName:   newFieldName,
+	}
+}
+
+func NewRenameTableData(tableName string, newTableName string) *AlterTableData {
+	return &AlterTableData{
+		TableName: tableName,
+		Action:    AlterRenameTable,
+		NewName:   newTableName,
+	}
+}
+
+// VacuumData VACUUM文
+type VacuumData struct {
+	// TableName 詰め直す表。空ならカタログを除く全ての表
+	TableName string
+}
+
+func NewVacuumData(tableName string) *VacuumData {
+	return &VacuumData{
+		TableName: tableName,
+	}
+}
+
+// ReindexData REINDEX文。IndexName と TableName のどちらか一方を指定する
+type ReindexData struct {
+	// IndexName 作り直す索引
+	IndexName string
+	// TableName 全ての索引を作り直す表
+	TableName string
+}
+
+func NewReindexIndexData(indexName string) *ReindexData {
+	return &ReindexData{
+		IndexName: indexName,
+	}
+}
+
+func NewReindexTableData(tableName string) *ReindexData {
+	return &ReindexData{
+		TableName: tableName,
+	}
+}
+
+// CheckIndexData CHECK INDEX文と CHECK TABLE文。IndexName と TableName のどちらか一方を指定する
+type CheckIndexData struct {
+	// IndexName 検査する索引
+	IndexName string
+	// TableName 全ての索引を検査する表
+	TableName string
+}
+
+func NewCheckIndexData(indexName string) *CheckIndexData {
+	return &CheckIndexData{
+		IndexName: indexName,
+	}
+}
+
+func NewCheckTableData(tableName string) *CheckIndexData {
+	return &CheckIndexData{
+		TableName: tableName,
+	}
+}
@@ -15,6 +15,7 @@ type lexer interface {
 	MatchStringConstant() bool
 	MatchKeyword(word string) bool
 	MatchIdentifier() bool
+	MatchEOF() bool
 
 	// トークンを読み進めるメソッド郡
 	// 一致しないトークンを読み進めようとした場合 BadSyntaxError を返す
@@ -46,24 +47,71 @@ const whiteSpaces string = " \t\r\n"
 
 // 予約語
 var keywords = map[string]struct{}{
-	"select":  {},
-	"from":    {},
-	"where":   {},
-	"and":     {},
-	"insert":  {},
-	"into":    {},
-	"values":  {},
-	"delete":  {},
-	"update":  {},
-	"set":     {},
-	"create":  {},
-	"table":   {},
-	"int":     {},
-	"varchar": {},
-	"view":    {},
-	"as":      {},
-	"index":   {},
-	"on":      {},
+	"select":     {},
+	"from":       {},
+	"where":      {},
+	"and":        {},
+	"insert":     {},
+	"into":       {},
+	"values":     {},
+	"delete":     {},
+	"update":     {},
+	"set":        {},
+	"create":     {},
+	"table":      {},
+	"int":        {},
+	"varchar":    {},
+	"view":       {},
+	"as":         {},
+	"index":      {},
+	"on":         {},
+	"using":      {},
+	"primary":    {},
+	"key":        {},
+	"unique":     {},
+	"null":       {},
+	"foreign":    {},
+	"references": {},
+	"cascade":    {},
+	"restrict":   {},
+	"not":        {},
+	"default":    {},
+	"check":      {},
+	"drop":       {},
+	"if":         {},
+	"exists":     {},
+	"alter":      {},
+	"add":        {},
+	"column":     {},
+	"rename":     {},
+	"to":         {},
+	"or":         {},
+	"replace":    {},
+	"in":         {},
+	"join":       {},
+	"inner":      {},
+	"left":       {},
+	"right":      {},
+	"full":       {},
+	"outer":      {},
+	"cross":      {},
+	"union":      {},
+	"all":        {},
+	"intersect":  {},
+	"except":     {},
+	"distinct":   {},
+	"order":      {},
+	"by":         {},
+	"limit":      {},
+	"offset":     {},
+	"over":       {},
+	"partition":  {},
+	"vacuum":     {},
+	"reindex":    {},
+	"with":       {},
+	"include":    {},
+	"asc":        {},
+	"desc":       {},
 }
 
 var _ lexer = (*Lexer)(nil)
@@ -117,6 +165,11 @@ func (l *Lexer) MatchIdentifier() bool {
 	return l.token.kind == tokenKindIdentifier
 }
 
+// MatchEOF 入力の終わりに達したか
+func (l *Lexer) MatchEOF() bool {
+	return l.token.kind == tokenKindEOF
+}
+
 // EatDelim 現在のトークンが指定されたデリミタであれば次のトークンを読み進める
 func (l *Lexer) EatDelim(d rune) error {
 	if !l.MatchDelim(d) {
@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"fmt"
 	"simpledb/query"
 	"simpledb/record"
 )
@@ -20,6 +21,14 @@ func NewParser(input string) (*Parser, error) {
 	}, nil
 }
 
+// eatEOF 文の終わりであることを確かめる
+func (p *Parser) eatEOF() error {
+	if !p.lex.MatchEOF() {
+		return NewBadSyntaxError(fmt.Sprintf("unexpected %q after end of statement", p.lex.token.value))
+	}
+	return nil
+}
+
 // 述語の構文解析
 
 // <Field> := IdTok
@@ -33,9 +42,77 @@ func (p *Parser) Field() (string, error) {
 	return fieldName, nil
 }
 
-// <Constant> := StrTok | IntTok
+// <ColumnRef> := IdTok [ . IdTok ]
+// 表名か別名で修飾された列は、query.QualifiedFieldName の名前 (s.sid) で表す
+func (p *Parser) columnRef() (string, error) {
+	// IdTok
+	name, err := p.lex.EatIdentifier()
+	if err != nil {
+		return "", err
+	}
+
+	// [ . IdTok ]
+	if !p.lex.MatchDelim('.') {
+		return name, nil
+	}
+	if err := p.lex.EatDelim('.'); err != nil {
+		return "", err
+	}
+	fieldName, err := p.lex.EatIdentifier()
+	if err != nil {
+		return "", err
+	}
+
+	return query.QualifiedFieldName(name, fieldName), nil
+}
+
+// <SelectColumn> := * | IdTok . * | <ColumnRef>
+func (p *Parser) selectColumn() (string, error) {
+	if p.lex.MatchDelim('*') {
+		// *
+		if err := p.lex.EatDelim('*'); err != nil {
+			return "", err
+		}
+		return AllColumns, nil
+	}
+
+	// IdTok
+	name, err := p.lex.EatIdentifier()
+	if err != nil {
+		return "", err
+	}
+
+	// [ . ( * | IdTok ) ]
+	if !p.lex.MatchDelim('.') {
+		return name, nil
+	}
+	if err := p.lex.EatDelim('.'); err != nil {
+		return "", err
+	}
+	if p.lex.MatchDelim('*') {
+		if err := p.lex.EatDelim('*'); err != nil {
+			return "", err
+		}
+		return query.QualifiedFieldName(name, AllColumns), nil
+	}
+	fieldName, err := p.lex.EatIdentifier()
+	if err != nil {
+		return "", err
+	}
+
+	return query.QualifiedFieldName(name, fieldName), nil
+}
+
+// <Constant> := StrTok | IntTok | NULL
 func (p *Parser) Constant() (*query.Constant, error) {
-	if p.lex.MatchStringConstant() {
+	if p.lex.MatchKeyword("null") {
+		// NULL
+		if err := p.lex.EatKeyword("null"); err != nil {
+			return nil, err
+		}
+
+		return query.NewNullConstant(), nil
+	} else if p.lex.MatchStringConstant() {
 		// StrTok
 		value, err := p.lex.EatStringConstant()
 		if err != nil {
@@ -54,16 +131,24 @@ func (p *Parser) Constant() (*query.Constant, error) {
 	}
 }
 
-// <Expression> := <Field> | <Constant>
+// <Expression> := <ColumnRef> | <Constant> | <Subquery>
 func (p *Parser) Expression() (*query.Expression, error) {
 	if p.lex.MatchIdentifier() {
-		// <Field>
-		fieldName, err := p.Field()
+		// <ColumnRef>
+		fieldName, err := p.columnRef()
 		if err != nil {
 			return nil, err
 		}
 
 		return query.NewExpressionWithField(fieldName), nil
+	} else if p.lex.MatchDelim('(') {
+		// <Subquery>
+		sq, err := p.subquery()
+		if err != nil {
+			return nil, err
+		}
+
+		return query.NewExpressionWithSubquery(sq), nil
 	} else {
 		// Constant
 		value, err := p.Constant()
@@ -75,14 +160,65 @@ func (p *Parser) Expression() (*query.Expression, error) {
 	}
 }
 
-// <Term> := <Expression> = <Expression>
+// <Subquery> := ( <Query> )
+func (p *Parser) subquery() (*query.Subquery, error) {
+	// (
+	if err := p.lex.EatDelim('('); err != nil {
+		return nil, err
+	}
+
+	// <Query>
+	data, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+
+	// )
+	if err := p.lex.EatDelim(')'); err != nil {
+		return nil, err
+	}
+
+	return query.NewSubquery(data), nil
+}
+
+// <Term> := <Expression> = <Expression> | <Expression> IN <Subquery> | EXISTS <Subquery>
 func (p *Parser) Term() (*query.Term, error) {
+	if p.lex.MatchKeyword("exists") {
+		// EXISTS
+		if err := p.lex.EatKeyword("exists"); err != nil {
+			return nil, err
+		}
+
+		// <Subquery>
+		sq, err := p.subquery()
+		if err != nil {
+			return nil, err
+		}
+
+		return query.NewExistsTerm(sq), nil
+	}
+
 	// <Expression>
 	lhs, err := p.Expression()
 	if err != nil {
 		return nil, err
 	}
 
+	if p.lex.MatchKeyword("in") {
+		// IN
+		if err := p.lex.EatKeyword("in"); err != nil {
+			return nil, err
+		}
+
+		// <Subquery>
+		sq, err := p.subquery()
+		if err != nil {
+			return nil, err
+		}
+
+		return query.NewInTerm(lhs, sq), nil
+	}
+
 	// =
 	if err := p.lex.EatDelim('='); err != nil {
 		return nil, err
@@ -128,163 +264,920 @@ func (p *Parser) Predicate() (*query.Predicate, error) {
 
 // クエリの構文解析
 
-// <Query> := SELECT <SelectList> FROM <TableList> [ WHERE <Predicate> ]
+// Query 文全体が1つの問合せであるものとして構文解析する。問合せの後にトークンが残っていればエラーを返す
 func (p *Parser) Query() (*QueryData, error) {
+	data, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.eatEOF(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// <Query> := <SetOpQuery> [ ORDER BY <OrderByList> ] [ LIMIT IntTok ] [ OFFSET IntTok ]
+// ORDER BY と LIMIT は集合演算の結果に適用する
+func (p *Parser) query() (*QueryData, error) {
+	// <SetOpQuery>
+	data, err := p.setOpQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	// [ ORDER BY <OrderByList> ]
+	if p.lex.MatchKeyword("order") {
+		// ORDER BY
+		if err := p.lex.EatKeyword("order"); err != nil {
+			return nil, err
+		}
+		if err := p.lex.EatKeyword("by"); err != nil {
+			return nil, err
+		}
+
+		// <OrderByList>
+		if data.OrderBy, data.Descending, err = p.orderByList(); err != nil {
+			return nil, err
+		}
+	}
+
+	// [ LIMIT IntTok ]
+	if p.lex.MatchKeyword("limit") {
+		// LIMIT
+		if err := p.lex.EatKeyword("limit"); err != nil {
+			return nil, err
+		}
+
+		// IntTok
+		if data.Limit, err = p.lex.EatIntConstant(); err != nil {
+			return nil, err
+		}
+	}
+
+	// [ OFFSET IntTok ]
+	if p.lex.MatchKeyword("offset") {
+		// OFFSET
+		if err := p.lex.EatKeyword("offset"); err != nil {
+			return nil, err
+		}
+
+		// IntTok
+		if data.Offset, err = p.lex.EatIntConstant(); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// <SetOpQuery> := <IntersectQuery> { ( UNION [ ALL ] | EXCEPT ) <IntersectQuery> }
+// 集合演算は左から順に適用する
+func (p *Parser) setOpQuery() (*QueryData, error) {
+	// <IntersectQuery>
+	data, err := p.intersectQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var op string
+		switch {
+		case p.lex.MatchKeyword("union"):
+			op = SetUnion
+		case p.lex.MatchKeyword("except"):
+			op = SetExcept
+		default:
+			return data, nil
+		}
+		// UNION | EXCEPT
+		if err := p.lex.EatKeyword(op); err != nil {
+			return nil, err
+		}
+
+		// [ ALL ]
+		all := false
+		if op == SetUnion && p.lex.MatchKeyword("all") {
+			if err := p.lex.EatKeyword("all"); err != nil {
+				return nil, err
+			}
+			all = true
+		}
+
+		// <IntersectQuery>
+		rhs, err := p.intersectQuery()
+		if err != nil {
+			return nil, err
+		}
+		data = NewSetOpQueryData(op, all, data, rhs)
+	}
+}
+
+// <IntersectQuery> := <Select> { INTERSECT <Select> }
+// INTERSECT は UNION と EXCEPT より先に適用する
+func (p *Parser) intersectQuery() (*QueryData, error) {
+	// <Select>
+	data, err := p.selectQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.lex.MatchKeyword("intersect") {
+		// INTERSECT
+		if err := p.lex.EatKeyword("intersect"); err != nil {
+			return nil, err
+		}
+
+		// <Select>
+		rhs, err := p.selectQuery()
+		if err != nil {
+			return nil, err
+		}
+		data = NewSetOpQueryData(SetIntersect, false, data, rhs)
+	}
+	return data, nil
+}
+
+// <Select> := SELECT [ DISTINCT ] <SelectList> FROM <TableList> [ WHERE <Predicate> ]
+// 内部結合の ON の述語は WHERE の述語に加える
+func (p *Parser) selectQuery() (*QueryData, error) {
+	data := NewQueryData(nil, nil, query.NewPredicate())
+
 	// SELECT
 	if err := p.lex.EatKeyword("select"); err != nil {
 		return nil, err
 	}
 
-	// <SelectList>
-	fields, err := p.selectList()
-	if err != nil {
+	// [ DISTINCT ]
+	if p.lex.MatchKeyword("distinct") {
+		if err := p.lex.EatKeyword("distinct"); err != nil {
+			return nil, err
+		}
+		data.Distinct = true
+	}
+
+	// <SelectList>
+	if err := p.selectList(data); err != nil {
+		return nil, err
+	}
+	NameColumns(data)
+
+	// FROM
+	if err := p.lex.EatKeyword("from"); err != nil {
+		return nil, err
+	}
+
+	// <TableList>
+	if err := p.tableList(data); err != nil {
+		return nil, err
+	}
+
+	// [ WHERE <Predicate> ]
+	pred, err := p.whereOpt()
+	if err != nil {
+		return nil, err
+	}
+	data.Pred.ConjoinWith(pred)
+
+	return data, nil
+}
+
+// NameColumns 選択リストの修飾された列 (s.sid) に、AS を付けたのと同じように列名 (sid) を名前として付ける
+// 同じ列名の列が選択リストに複数あれば、修飾された名前のままにする。t.* はそのままにし、展開した後に改めて名前を付ける
+func NameColumns(data *QueryData) {
+	names := make(map[string]int)
+	for _, name := range data.Fields {
+		if _, ok := data.Exprs[name]; !ok {
+			_, name = query.SplitFieldName(name)
+		}
+		names[name]++
+	}
+	for i, name := range data.Fields {
+		if _, ok := data.Exprs[name]; ok {
+			continue
+		}
+		qualifier, fieldName := query.SplitFieldName(name)
+		if qualifier == "" || names[fieldName] > 1 || fieldName == AllColumns {
+			continue
+		}
+		data.Fields[i] = fieldName
+		if data.Exprs == nil {
+			data.Exprs = make(map[string]*query.Expression)
+		}
+		data.Exprs[fieldName] = query.NewExpressionWithField(name)
+	}
+}
+
+// [ WHERE <Predicate> ]
+func (p *Parser) whereOpt() (*query.Predicate, error) {
+	if p.lex.MatchKeyword("where") {
+		// WHERE
+		if err := p.lex.EatKeyword("where"); err != nil {
+			return nil, err
+		}
+
+		// <Predicate>
+		pred, err := p.Predicate()
+		if err != nil {
+			return nil, err
+		}
+
+		return pred, nil
+	} else {
+		return query.NewPredicate(), nil
+	}
+}
+
+// <SelectList> := <SelectItem> [ , <SelectList> ] [ , ]
+func (p *Parser) selectList(data *QueryData) error {
+	// <SelectItem>
+	if err := p.selectItem(data); err != nil {
+		return err
+	}
+
+	// [ , <SelectList> ]
+	if p.lex.MatchDelim(',') {
+		// ,
+		if err := p.lex.EatDelim(','); err != nil {
+			return err
+		}
+
+		// Exit if trailing comma
+		if !p.lex.MatchIdentifier() && !p.lex.MatchDelim('(') && !p.lex.MatchDelim('*') {
+			return nil
+		}
+
+		// <SelectList>
+		if err := p.selectList(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// <SelectItem> := * | IdTok . * | <ColumnRef> [ AS IdTok ] | <Subquery> AS IdTok | <WindowFn> AS IdTok
+// * と t.* は AllColumns で表し、計画を作成する時に参照の列に展開する
+func (p *Parser) selectItem(data *QueryData) error {
+	var expr *query.Expression
+	if p.lex.MatchDelim('(') {
+		// <Subquery>
+		sq, err := p.subquery()
+		if err != nil {
+			return err
+		}
+		expr = query.NewExpressionWithSubquery(sq)
+	} else {
+		// * | IdTok . * | <ColumnRef>
+		field, err := p.selectColumn()
+		if err != nil {
+			return err
+		}
+		if p.lex.MatchDelim('(') {
+			// <WindowFn>
+			return p.windowItem(data, field)
+		}
+		if _, ok := IsAllColumns(field); ok || !p.lex.MatchKeyword("as") {
+			data.Fields = append(data.Fields, field)
+			return nil
+		}
+		expr = query.NewExpressionWithField(field)
+	}
+
+	// AS
+	if err := p.lex.EatKeyword("as"); err != nil {
+		return err
+	}
+
+	// IdTok
+	name, err := p.lex.EatIdentifier()
+	if err != nil {
+		return err
+	}
+
+	data.Fields = append(data.Fields, name)
+	if data.Exprs == nil {
+		data.Exprs = make(map[string]*query.Expression)
+	}
+	data.Exprs[name] = expr
+	return nil
+}
+
+// <WindowFn> := IdTok ( [ <ColumnRef> [ , IntTok ] | * ] ) OVER ( [ PARTITION BY <ColumnList> ] [ ORDER BY <ColumnList> ] )
+// 関数の名前 fn は読み終えている。ウィンドウ関数の列には AS で名前を付けなければならない
+func (p *Parser) windowItem(data *QueryData, fn string) error {
+	takesField, ok := query.WindowFuncs[fn]
+	if !ok {
+		return NewBadSyntaxError(fmt.Sprintf("unknown window function %q", fn))
+	}
+
+	// (
+	if err := p.lex.EatDelim('('); err != nil {
+		return err
+	}
+
+	// [ <ColumnRef> [ , IntTok ] | * ]
+	var field string
+	offset := int32(1)
+	switch {
+	case fn == query.WindowCount && p.lex.MatchDelim('*'):
+		if err := p.lex.EatDelim('*'); err != nil {
+			return err
+		}
+	case takesField:
+		var err error
+		if field, err = p.columnRef(); err != nil {
+			return err
+		}
+		if (fn == query.WindowLag || fn == query.WindowLead) && p.lex.MatchDelim(',') {
+			if err := p.lex.EatDelim(','); err != nil {
+				return err
+			}
+			if offset, err = p.lex.EatIntConstant(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// )
+	if err := p.lex.EatDelim(')'); err != nil {
+		return err
+	}
+
+	// OVER (
+	if err := p.lex.EatKeyword("over"); err != nil {
+		return err
+	}
+	if err := p.lex.EatDelim('('); err != nil {
+		return err
+	}
+
+	// [ PARTITION BY <ColumnList> ]
+	var partitionBy []string
+	if p.lex.MatchKeyword("partition") {
+		if err := p.lex.EatKeyword("partition"); err != nil {
+			return err
+		}
+		if err := p.lex.EatKeyword("by"); err != nil {
+			return err
+		}
+		var err error
+		if partitionBy, err = p.columnList(); err != nil {
+			return err
+		}
+	}
+
+	// [ ORDER BY <OrderByList> ]
+	var orderBy []string
+	var descending []bool
+	if p.lex.MatchKeyword("order") {
+		if err := p.lex.EatKeyword("order"); err != nil {
+			return err
+		}
+		if err := p.lex.EatKeyword("by"); err != nil {
+			return err
+		}
+		var err error
+		if orderBy, descending, err = p.orderByList(); err != nil {
+			return err
+		}
+	}
+
+	// )
+	if err := p.lex.EatDelim(')'); err != nil {
+		return err
+	}
+
+	// AS IdTok
+	if err := p.lex.EatKeyword("as"); err != nil {
+		return err
+	}
+	name, err := p.lex.EatIdentifier()
+	if err != nil {
+		return err
+	}
+
+	data.Fields = append(data.Fields, name)
+	if data.Windows == nil {
+		data.Windows = make(map[string]*WindowData)
+	}
+	data.Windows[name] = NewWindowData(fn, field, offset, partitionBy, orderBy, descending)
+	return nil
+}
+
+// <OrderByList> := <ColumnRef> [ ASC | DESC ] { , <ColumnRef> [ ASC | DESC ] }
+// descending[i] は fields[i] を降順に並べるか
+func (p *Parser) orderByList() (fields []string, descending []bool, err error) {
+	for {
+		// <ColumnRef>
+		field, err := p.columnRef()
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, field)
+
+		// [ ASC | DESC ]
+		desc := false
+		if p.lex.MatchKeyword("asc") {
+			if err := p.lex.EatKeyword("asc"); err != nil {
+				return nil, nil, err
+			}
+		} else if p.lex.MatchKeyword("desc") {
+			if err := p.lex.EatKeyword("desc"); err != nil {
+				return nil, nil, err
+			}
+			desc = true
+		}
+		descending = append(descending, desc)
+
+		if !p.lex.MatchDelim(',') {
+			return fields, descending, nil
+		}
+		// ,
+		if err := p.lex.EatDelim(','); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// <ColumnList> := <ColumnRef> { , <ColumnRef> }
+func (p *Parser) columnList() ([]string, error) {
+	var fields []string
+	for {
+		// <ColumnRef>
+		field, err := p.columnRef()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+
+		if !p.lex.MatchDelim(',') {
+			return fields, nil
+		}
+		// ,
+		if err := p.lex.EatDelim(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// <TableList> := <JoinedTable> [ , <TableList> ] [ , ]
+func (p *Parser) tableList(data *QueryData) error {
+	// <JoinedTable>
+	if err := p.joinedTable(data); err != nil {
+		return err
+	}
+
+	// [ , <TableList> ]
+	if p.lex.MatchDelim(',') {
+		// ,
+		if err := p.lex.EatDelim(','); err != nil {
+			return err
+		}
+
+		// Exit if trailing comma
+		if !p.lex.MatchIdentifier() && !p.lex.MatchDelim('(') {
+			return nil
+		}
+
+		// <TableList>
+		if err := p.tableList(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// <JoinedTable> := <TableRef> { <Join> }
+// <Join> := [ INNER ] JOIN <TableRef> ON <Predicate>
+//
+//	| ( LEFT | RIGHT | FULL ) [ OUTER ] JOIN <TableRef> ON <Predicate>
+//	| CROSS JOIN <TableRef>
+func (p *Parser) joinedTable(data *QueryData) error {
+	// <TableRef>
+	if err := p.tableRef(data); err != nil {
+		return err
+	}
+
+	for {
+		joinType := ""
+		switch {
+		case p.lex.MatchKeyword("cross"):
+			// CROSS JOIN <TableRef>
+			if err := p.lex.EatKeyword("cross"); err != nil {
+				return err
+			}
+			if err := p.lex.EatKeyword("join"); err != nil {
+				return err
+			}
+			if err := p.tableRef(data); err != nil {
+				return err
+			}
+			continue
+		case p.lex.MatchKeyword("inner"):
+			if err := p.lex.EatKeyword("inner"); err != nil {
+				return err
+			}
+		case p.lex.MatchKeyword("join"):
+		case p.lex.MatchKeyword(JoinLeft):
+			joinType = JoinLeft
+		case p.lex.MatchKeyword(JoinRight):
+			joinType = JoinRight
+		case p.lex.MatchKeyword(JoinFull):
+			joinType = JoinFull
+		default:
+			return nil
+		}
+
+		if joinType != "" {
+			// LEFT | RIGHT | FULL
+			if err := p.lex.EatKeyword(joinType); err != nil {
+				return err
+			}
+			// [ OUTER ]
+			if p.lex.MatchKeyword("outer") {
+				if err := p.lex.EatKeyword("outer"); err != nil {
+					return err
+				}
+			}
+		}
+
+		// JOIN
+		if err := p.lex.EatKeyword("join"); err != nil {
+			return err
+		}
+
+		// <TableRef>
+		if err := p.tableRef(data); err != nil {
+			return err
+		}
+
+		// ON
+		if err := p.lex.EatKeyword("on"); err != nil {
+			return err
+		}
+
+		// <Predicate>
+		on, err := p.Predicate()
+		if err != nil {
+			return err
+		}
+
+		if joinType == "" {
+			data.Pred.ConjoinWith(on)
+		} else {
+			table := data.Tables[len(data.Tables)-1]
+			data.Joins = append(data.Joins, NewJoinData(joinType, table, on))
+		}
+	}
+}
+
+// <TableRef> := IdTok [ [ AS ] IdTok ] | ( <Query> ) [ AS ] IdTok
+func (p *Parser) tableRef(data *QueryData) error {
+	if !p.lex.MatchDelim('(') {
+		// IdTok
+		table, err := p.lex.EatIdentifier()
+		if err != nil {
+			return err
+		}
+
+		// [ [ AS ] IdTok ]
+		if p.lex.MatchKeyword("as") {
+			if err := p.lex.EatKeyword("as"); err != nil {
+				return err
+			}
+		} else if !p.lex.MatchIdentifier() {
+			data.Tables = append(data.Tables, table)
+			return nil
+		}
+		alias, err := p.lex.EatIdentifier()
+		if err != nil {
+			return err
+		}
+
+		data.Tables = append(data.Tables, alias)
+		if data.Aliases == nil {
+			data.Aliases = make(map[string]string)
+		}
+		data.Aliases[alias] = table
+		return nil
+	}
+
+	// (
+	if err := p.lex.EatDelim('('); err != nil {
+		return err
+	}
+
+	// <Query>
+	derived, err := p.query()
+	if err != nil {
+		return err
+	}
+
+	// )
+	if err := p.lex.EatDelim(')'); err != nil {
+		return err
+	}
+
+	// [ AS ]
+	if p.lex.MatchKeyword("as") {
+		if err := p.lex.EatKeyword("as"); err != nil {
+			return err
+		}
+	}
+
+	// IdTok
+	alias, err := p.lex.EatIdentifier()
+	if err != nil {
+		return err
+	}
+
+	data.Tables = append(data.Tables, alias)
+	if data.Derived == nil {
+		data.Derived = make(map[string]*QueryData)
+	}
+	data.Derived[alias] = derived
+	return nil
+}
+
+// 更新コマンドの構文解析
+
+// UpdateCmd 文全体が1つの更新コマンドであるものとして構文解析する。コマンドの後にトークンが残っていればエラーを返す
+func (p *Parser) UpdateCmd() (UpdateCmd, error) {
+	cmd, err := p.updateCmd()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.eatEOF(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// <UpdateCmd> := <Insert> | <Delete> | <Modify> | <Create> | <Drop> | <AlterTable> | <Vacuum> | <Reindex> | <Check>
+func (p *Parser) updateCmd() (UpdateCmd, error) {
+	if p.lex.MatchKeyword("insert") {
+		// <Insert>
+		return p.Insert()
+	} else if p.lex.MatchKeyword("delete") {
+		// <Delete>
+		return p.Delete()
+	} else if p.lex.MatchKeyword("update") {
+		// <Modify>
+		return p.Modify()
+	} else if p.lex.MatchKeyword("drop") {
+		// <Drop>
+		return p.Drop()
+	} else if p.lex.MatchKeyword("alter") {
+		// <AlterTable>
+		return p.AlterTable()
+	} else if p.lex.MatchKeyword("vacuum") {
+		// <Vacuum>
+		return p.Vacuum()
+	} else if p.lex.MatchKeyword("reindex") {
+		// <Reindex>
+		return p.Reindex()
+	} else if p.lex.MatchKeyword("check") {
+		// <Check>
+		return p.Check()
+	} else {
+		// <Create>
+		return p.create()
+	}
+}
+
+// <Create> := <CreateTable> | <CreateView> | <CreateIndex>
+func (p *Parser) create() (UpdateCmd, error) {
+	// CREATE
+	if err := p.lex.EatKeyword("create"); err != nil {
+		return nil, err
+	}
+
+	if p.lex.MatchKeyword("table") {
+		// <CreateTable>
+		return p.CreateTable()
+	} else if p.lex.MatchKeyword("view") || p.lex.MatchKeyword("or") {
+		// <CreateView>
+		return p.CreateView()
+	} else {
+		// <CreateIndex>
+		return p.CreateIndex()
+	}
+}
+
+// DROP文の構文解析
+
+// <Drop> := DROP ( TABLE | VIEW | INDEX ) [ IF EXISTS ] IdTok
+func (p *Parser) Drop() (UpdateCmd, error) {
+	// DROP
+	if err := p.lex.EatKeyword("drop"); err != nil {
+		return nil, err
+	}
+
+	// TABLE | VIEW | INDEX
+	kind := "index"
+	if p.lex.MatchKeyword("table") {
+		kind = "table"
+	} else if p.lex.MatchKeyword("view") {
+		kind = "view"
+	}
+	if err := p.lex.EatKeyword(kind); err != nil {
+		return nil, err
+	}
+
+	// [ IF EXISTS ]
+	ifExists := false
+	if p.lex.MatchKeyword("if") {
+		if err := p.lex.EatKeyword("if"); err != nil {
+			return nil, err
+		}
+		if err := p.lex.EatKeyword("exists"); err != nil {
+			return nil, err
+		}
+		ifExists = true
+	}
+
+	// IdTok
+	name, err := p.lex.EatIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "table":
+		return NewDropTableData(name, ifExists), nil
+	case "view":
+		return NewDropViewData(name, ifExists), nil
+	default:
+		return NewDropIndexData(name, ifExists), nil
+	}
+}
+
+// ALTER TABLE文の構文解析
+
+// <AlterTable> := ALTER TABLE IdTok <AlterAction>
+// <AlterAction> := ADD [ COLUMN ] <FieldDef> | DROP [ COLUMN ] IdTok | RENAME [ COLUMN ] IdTok TO IdTok | RENAME TO IdTok
+func (p *Parser) AlterTable() (*AlterTableData, error) {
+	// ALTER TABLE
+	if err := p.lex.EatKeyword("alter"); err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("table"); err != nil {
+		return nil, err
+	}
+
+	// IdTok
+	tableName, err := p.lex.EatIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.lex.MatchKeyword("add") {
+		// ADD [ COLUMN ] <FieldDef>
+		if err := p.lex.EatKeyword("add"); err != nil {
+			return nil, err
+		}
+		if err := p.columnOpt(); err != nil {
+			return nil, err
+		}
+		column := NewCreateTableData(tableName, record.NewSchema(), nil, nil, nil)
+		if err := p.fieldDef(column); err != nil {
+			return nil, err
+		}
+		return NewAddColumnData(tableName, column), nil
+	} else if p.lex.MatchKeyword("drop") {
+		// DROP [ COLUMN ] IdTok
+		if err := p.lex.EatKeyword("drop"); err != nil {
+			return nil, err
+		}
+		if err := p.columnOpt(); err != nil {
+			return nil, err
+		}
+		fieldName, err := p.lex.EatIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		return NewDropColumnData(tableName, fieldName), nil
+	}
+
+	// RENAME
+	if err := p.lex.EatKeyword("rename"); err != nil {
 		return nil, err
 	}
+	if p.lex.MatchKeyword("to") {
+		// TO IdTok
+		if err := p.lex.EatKeyword("to"); err != nil {
+			return nil, err
+		}
+		newTableName, err := p.lex.EatIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		return NewRenameTableData(tableName, newTableName), nil
+	}
 
-	// FROM
-	if err := p.lex.EatKeyword("from"); err != nil {
+	// [ COLUMN ] IdTok TO IdTok
+	if err := p.columnOpt(); err != nil {
 		return nil, err
 	}
-
-	// <TableList>
-	tables, err := p.tableList()
+	fieldName, err := p.lex.EatIdentifier()
 	if err != nil {
 		return nil, err
 	}
-
-	// [ WHERE <Predicate> ]
-	pred, err := p.whereOpt()
+	if err := p.lex.EatKeyword("to"); err != nil {
+		return nil, err
+	}
+	newFieldName, err := p.lex.EatIdentifier()
 	if err != nil {
 		return nil, err
 	}
-
-	return NewQueryData(fields, tables, pred), nil
+	return NewRenameColumnData(tableName, fieldName, newFieldName), nil
 }
 
-// [ WHERE <Predicate> ]
-func (p *Parser) whereOpt() (*query.Predicate, error) {
-	if p.lex.MatchKeyword("where") {
-		// WHERE
-		if err := p.lex.EatKeyword("where"); err != nil {
-			return nil, err
-		}
+// [ COLUMN ]
+func (p *Parser) columnOpt() error {
+	if p.lex.MatchKeyword("column") {
+		return p.lex.EatKeyword("column")
+	}
+	return nil
+}
 
-		// <Predicate>
-		pred, err := p.Predicate()
-		if err != nil {
-			return nil, err
-		}
+// VACUUM文の構文解析
 
-		return pred, nil
-	} else {
-		return query.NewPredicate(), nil
+// <Vacuum> := VACUUM [ IdTok ]
+func (p *Parser) Vacuum() (*VacuumData, error) {
+	// VACUUM
+	if err := p.lex.EatKeyword("vacuum"); err != nil {
+		return nil, err
 	}
-}
 
-// <SelectList> := <Field> [ , <SelectList> ] [ , ]
-func (p *Parser) selectList() ([]string, error) {
-	// <Field>
-	field, err := p.Field()
+	// [ IdTok ]
+	if !p.lex.MatchIdentifier() {
+		return NewVacuumData(""), nil
+	}
+	tableName, err := p.lex.EatIdentifier()
 	if err != nil {
 		return nil, err
 	}
+	return NewVacuumData(tableName), nil
+}
 
-	fields := []string{field}
-
-	// [ , <SelectList> ]
-	if p.lex.MatchDelim(',') {
-		// ,
-		if err := p.lex.EatDelim(','); err != nil {
-			return nil, err
-		}
-
-		// Exit if trailing comma
-		if !p.lex.MatchIdentifier() {
-			return fields, nil
-		}
-
-		// <SelectList>
-		rest, err := p.selectList()
-		if err != nil {
-			return nil, err
-		}
+// REINDEX文の構文解析
 
-		fields = append(fields, rest...)
+// <Reindex> := REINDEX ( INDEX | TABLE ) IdTok
+func (p *Parser) Reindex() (*ReindexData, error) {
+	// REINDEX
+	if err := p.lex.EatKeyword("reindex"); err != nil {
+		return nil, err
 	}
 
-	return fields, nil
-}
+	// INDEX | TABLE
+	kind := "index"
+	if p.lex.MatchKeyword("table") {
+		kind = "table"
+	}
+	if err := p.lex.EatKeyword(kind); err != nil {
+		return nil, err
+	}
 
-// <TableList> := IdTok [ , <TableList> ] [ , ]
-func (p *Parser) tableList() ([]string, error) {
 	// IdTok
-	table, err := p.lex.EatIdentifier()
+	name, err := p.lex.EatIdentifier()
 	if err != nil {
 		return nil, err
 	}
-
-	tables := []string{table}
-
-	// [ , <TableList> ]
-	if p.lex.MatchDelim(',') {
-		// ,
-		if err := p.lex.EatDelim(','); err != nil {
-			return nil, err
-		}
-
-		// Exit if trailing comma
-		if !p.lex.MatchIdentifier() {
-			return tables, nil
-		}
-
-		// <TableList>
-		rest, err := p.tableList()
-		if err != nil {
-			return nil, err
-		}
-
-		tables = append(tables, rest...)
+	if kind == "table" {
+		return NewReindexTableData(name), nil
 	}
-
-	return tables, nil
+	return NewReindexIndexData(name), nil
 }
 
-// 更新コマンドの構文解析
+// CHECK文の構文解析
 
-// <UpdateCmd> := <Insert> | <Delete> | <Modify> | <Create>
-func (p *Parser) UpdateCmd() (UpdateCmd, error) {
-	if p.lex.MatchKeyword("insert") {
-		// <Insert>
-		return p.Insert()
-	} else if p.lex.MatchKeyword("delete") {
-		// <Delete>
-		return p.Delete()
-	} else if p.lex.MatchKeyword("update") {
-		// <Modify>
-		return p.Modify()
-	} else {
-		// <Create>
-		return p.create()
+// <Check> := CHECK ( INDEX | TABLE ) IdTok
+func (p *Parser) Check() (*CheckIndexData, error) {
+	// CHECK
+	if err := p.lex.EatKeyword("check"); err != nil {
+		return nil, err
 	}
-}
 
-// <Create> := <CreateTable> | <CreateView> | <CreateIndex>
-func (p *Parser) create() (UpdateCmd, error) {
-	// CREATE
-	if err := p.lex.EatKeyword("create"); err != nil {
+	// INDEX | TABLE
+	kind := "index"
+	if p.lex.MatchKeyword("table") {
+		kind = "table"
+	}
+	if err := p.lex.EatKeyword(kind); err != nil {
 		return nil, err
 	}
 
-	if p.lex.MatchKeyword("table") {
-		// <CreateTable>
-		return p.CreateTable()
-	} else if p.lex.MatchKeyword("view") {
-		// <CreateView>
-		return p.CreateView()
-	} else {
-		// <CreateIndex>
-		return p.CreateIndex()
+	// IdTok
+	name, err := p.lex.EatIdentifier()
+	if err != nil {
+		return nil, err
 	}
+	if kind == "table" {
+		return NewCheckTableData(name), nil
+	}
+	return NewCheckIndexData(name), nil
 }
 
 // DELETE文の構文解析
@@ -482,7 +1375,7 @@ func (p *Parser) Modify() (*ModifyData, error) {
 
 // CREATE TABLE文の構文解析
 
-// <CreateTable> := CREATE TABLE IdTok ( <FieldDefs> )
+// <CreateTable> := CREATE TABLE IdTok ( <FieldDefs> ) [ USING ( FIXED | SLOTTED ) ]
 func (p *Parser) CreateTable() (*CreateTableData, error) {
 	// TABLE
 	if err := p.lex.EatKeyword("table"); err != nil {
@@ -501,8 +1394,8 @@ func (p *Parser) CreateTable() (*CreateTableData, error) {
 	}
 
 	// <FieldDefs>
-	schema, err := p.fieldDefs()
-	if err != nil {
+	data := NewCreateTableData(tableName, record.NewSchema(), nil, nil, nil)
+	if err := p.fieldDefs(data); err != nil {
 		return nil, err
 	}
 
@@ -511,51 +1404,257 @@ func (p *Parser) CreateTable() (*CreateTableData, error) {
 		return nil, err
 	}
 
-	return NewCreateTableData(tableName, schema), nil
+	// [ USING ( FIXED | SLOTTED ) ]
+	if p.lex.MatchKeyword("using") {
+		if err := p.lex.EatKeyword("using"); err != nil {
+			return nil, err
+		}
+		// fixed や slotted は列名などにも使えるよう予約語にはしない
+		format, err := p.lex.EatIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		switch format {
+		case record.FixedFormat.String():
+			data.Format = record.FixedFormat
+		case record.SlottedFormat.String():
+			data.Format = record.SlottedFormat
+		default:
+			return nil, NewBadSyntaxError(fmt.Sprintf("unknown table format %q", format))
+		}
+	}
+
+	return data, nil
 }
 
-// <FieldDefs> := <FieldDef> [ , <FieldDefs> ]
-func (p *Parser) fieldDefs() (*record.Schema, error) {
-	// <FieldDef>
-	schema, err := p.fieldDef()
-	if err != nil {
-		return nil, err
+// <FieldDefs> := ( <FieldDef> | <KeyDef> ) [ , <FieldDefs> ]
+func (p *Parser) fieldDefs(data *CreateTableData) error {
+	if p.lex.MatchKeyword("primary") || p.lex.MatchKeyword("unique") || p.lex.MatchKeyword("foreign") {
+		// <KeyDef>
+		if err := p.keyDef(data); err != nil {
+			return err
+		}
+	} else {
+		// <FieldDef>
+		if err := p.fieldDef(data); err != nil {
+			return err
+		}
 	}
 
 	// [ , <FieldDefs> ]
 	if p.lex.MatchDelim(',') {
 		// ,
 		if err := p.lex.EatDelim(','); err != nil {
-			return nil, err
+			return err
 		}
 
 		// <FieldDefs>
-		rest, err := p.fieldDefs()
-		if err != nil {
-			return nil, err
-		}
-
-		schema.AddAll(rest)
+		return p.fieldDefs(data)
 	}
 
-	return schema, nil
+	return nil
 }
 
-// <FieldDef> := IdTok <TypeDef>
-func (p *Parser) fieldDef() (*record.Schema, error) {
+// <FieldDef> := IdTok <TypeDef> { <ColumnConstraint> }
+// <ColumnConstraint> := PRIMARY KEY | UNIQUE | <References> | NOT NULL | NULL | DEFAULT <Constant> | CHECK ( <Predicate> )
+func (p *Parser) fieldDef(data *CreateTableData) error {
 	// IdTok
 	fieldName, err := p.lex.EatIdentifier()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// <TypeDef>
 	schema, err := p.fieldType(fieldName)
+	if err != nil {
+		return err
+	}
+	data.NewSchema.AddAll(schema)
+
+	// { <ColumnConstraint> }
+	for {
+		switch {
+		case p.lex.MatchKeyword("primary"):
+			if err := p.primaryKey(); err != nil {
+				return err
+			}
+			data.Keys = append(data.Keys, NewKeyConstraint([]string{fieldName}, true))
+		case p.lex.MatchKeyword("unique"):
+			if err := p.lex.EatKeyword("unique"); err != nil {
+				return err
+			}
+			data.Keys = append(data.Keys, NewKeyConstraint([]string{fieldName}, false))
+		case p.lex.MatchKeyword("references"):
+			fk, err := p.references([]string{fieldName})
+			if err != nil {
+				return err
+			}
+			data.ForeignKeys = append(data.ForeignKeys, fk)
+		case p.lex.MatchKeyword("not"):
+			if err := p.lex.EatKeyword("not"); err != nil {
+				return err
+			}
+			if err := p.lex.EatKeyword("null"); err != nil {
+				return err
+			}
+			data.column(fieldName).NotNull = true
+		case p.lex.MatchKeyword("null"):
+			// NULL を許すことを明示するだけで、制約にはならない
+			if err := p.lex.EatKeyword("null"); err != nil {
+				return err
+			}
+		case p.lex.MatchKeyword("default"):
+			if err := p.lex.EatKeyword("default"); err != nil {
+				return err
+			}
+			val, err := p.Constant()
+			if err != nil {
+				return err
+			}
+			data.column(fieldName).Default = val
+		case p.lex.MatchKeyword("check"):
+			if err := p.lex.EatKeyword("check"); err != nil {
+				return err
+			}
+			if err := p.lex.EatDelim('('); err != nil {
+				return err
+			}
+			pred, err := p.Predicate()
+			if err != nil {
+				return err
+			}
+			if err := p.lex.EatDelim(')'); err != nil {
+				return err
+			}
+			data.column(fieldName).Check = pred
+		default:
+			return nil
+		}
+	}
+}
+
+// <KeyDef> := ( PRIMARY KEY | UNIQUE ) ( <FieldList> ) | FOREIGN KEY ( <FieldList> ) <References>
+func (p *Parser) keyDef(data *CreateTableData) error {
+	foreignKey := p.lex.MatchKeyword("foreign")
+	primaryKey := p.lex.MatchKeyword("primary")
+	if foreignKey {
+		// FOREIGN KEY
+		if err := p.lex.EatKeyword("foreign"); err != nil {
+			return err
+		}
+		if err := p.lex.EatKeyword("key"); err != nil {
+			return err
+		}
+	} else if primaryKey {
+		// PRIMARY KEY
+		if err := p.primaryKey(); err != nil {
+			return err
+		}
+	} else if err := p.lex.EatKeyword("unique"); err != nil {
+		// UNIQUE
+		return err
+	}
+
+	// ( <FieldList> )
+	fieldNames, err := p.parenthesizedFieldList()
+	if err != nil {
+		return err
+	}
+
+	if !foreignKey {
+		data.Keys = append(data.Keys, NewKeyConstraint(fieldNames, primaryKey))
+		return nil
+	}
+
+	// <References>
+	fk, err := p.references(fieldNames)
+	if err != nil {
+		return err
+	}
+	data.ForeignKeys = append(data.ForeignKeys, fk)
+	return nil
+}
+
+// PRIMARY KEY
+func (p *Parser) primaryKey() error {
+	if err := p.lex.EatKeyword("primary"); err != nil {
+		return err
+	}
+	return p.lex.EatKeyword("key")
+}
+
+// <References> := REFERENCES IdTok [ ( <FieldList> ) ] [ ON DELETE ( CASCADE | RESTRICT | SET NULL ) ]
+func (p *Parser) references(fieldNames []string) (*ForeignKeyConstraint, error) {
+	// REFERENCES
+	if err := p.lex.EatKeyword("references"); err != nil {
+		return nil, err
+	}
+
+	// IdTok
+	refTableName, err := p.lex.EatIdentifier()
 	if err != nil {
 		return nil, err
 	}
 
-	return schema, nil
+	// [ ( <FieldList> ) ]
+	var refFieldNames []string
+	if p.lex.MatchDelim('(') {
+		if refFieldNames, err = p.parenthesizedFieldList(); err != nil {
+			return nil, err
+		}
+	}
+
+	// [ ON DELETE ( CASCADE | RESTRICT | SET NULL ) ]
+	onDelete := OnDeleteRestrict
+	if p.lex.MatchKeyword("on") {
+		if err := p.lex.EatKeyword("on"); err != nil {
+			return nil, err
+		}
+		if err := p.lex.EatKeyword("delete"); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.lex.MatchKeyword("cascade"):
+			if err := p.lex.EatKeyword("cascade"); err != nil {
+				return nil, err
+			}
+			onDelete = OnDeleteCascade
+		case p.lex.MatchKeyword("restrict"):
+			if err := p.lex.EatKeyword("restrict"); err != nil {
+				return nil, err
+			}
+		default:
+			if err := p.lex.EatKeyword("set"); err != nil {
+				return nil, err
+			}
+			if err := p.lex.EatKeyword("null"); err != nil {
+				return nil, err
+			}
+			onDelete = OnDeleteSetNull
+		}
+	}
+
+	return NewForeignKeyConstraint(fieldNames, refTableName, refFieldNames, onDelete), nil
+}
+
+// ( <FieldList> )
+func (p *Parser) parenthesizedFieldList() ([]string, error) {
+	// (
+	if err := p.lex.EatDelim('('); err != nil {
+		return nil, err
+	}
+
+	// <FieldList>
+	fieldNames, err := p.fieldList()
+	if err != nil {
+		return nil, err
+	}
+
+	// )
+	if err := p.lex.EatDelim(')'); err != nil {
+		return nil, err
+	}
+	return fieldNames, nil
 }
 
 // <TypeDef> := INT | VARCHAR ( IntTok )
@@ -599,8 +1698,20 @@ func (p *Parser) fieldType(fieldName string) (*record.Schema, error) {
 
 // CREATE VIEW文の構文解析
 
-// <CreateView> := CREATE VIEW IdTok AS <Query>
+// <CreateView> := CREATE [ OR REPLACE ] VIEW IdTok AS <Query>
 func (p *Parser) CreateView() (*CreateViewData, error) {
+	// [ OR REPLACE ]
+	orReplace := false
+	if p.lex.MatchKeyword("or") {
+		if err := p.lex.EatKeyword("or"); err != nil {
+			return nil, err
+		}
+		if err := p.lex.EatKeyword("replace"); err != nil {
+			return nil, err
+		}
+		orReplace = true
+	}
+
 	// VIEW
 	if err := p.lex.EatKeyword("view"); err != nil {
 		return nil, err
@@ -618,17 +1729,17 @@ func (p *Parser) CreateView() (*CreateViewData, error) {
 	}
 
 	// <Query>
-	query, err := p.Query()
+	query, err := p.query()
 	if err != nil {
 		return nil, err
 	}
 
-	return NewCreateViewData(viewName, query), nil
+	return NewCreateViewData(viewName, query, orReplace), nil
 }
 
 // CREATE INDEX文の構文解析
 
-// <CreateIndex> := CREATE INDEX IdTok ON IdTok ( <Field> )
+// <CreateIndex> := CREATE INDEX IdTok ON IdTok [ <Using> ] ( <FieldList> ) [ <Using> ] [ INCLUDE ( <FieldList> ) ] [ WITH ( FILLFACTOR = IntTok ) ]
 func (p *Parser) CreateIndex() (*CreateIndexData, error) {
 	// INDEX
 	if err := p.lex.EatKeyword("index"); err != nil {
@@ -652,13 +1763,19 @@ func (p *Parser) CreateIndex() (*CreateIndexData, error) {
 		return nil, err
 	}
 
+	// [ <Using> ]
+	indexType, err := p.using(defaultIndexType)
+	if err != nil {
+		return nil, err
+	}
+
 	// (
 	if err := p.lex.EatDelim('('); err != nil {
 		return nil, err
 	}
 
-	// <Field>
-	fieldName, err := p.Field()
+	// <FieldList>
+	fieldNames, err := p.fieldList()
 	if err != nil {
 		return nil, err
 	}
@@ -668,5 +1785,90 @@ func (p *Parser) CreateIndex() (*CreateIndexData, error) {
 		return nil, err
 	}
 
-	return NewCreateIndexData(indexName, tableName, fieldName), nil
+	// [ <Using> ]
+	indexType, err = p.using(indexType)
+	if err != nil {
+		return nil, err
+	}
+
+	// [ INCLUDE ( <FieldList> ) ]
+	var includedFields []string
+	if p.lex.MatchKeyword("include") {
+		if err := p.lex.EatKeyword("include"); err != nil {
+			return nil, err
+		}
+		if err := p.lex.EatDelim('('); err != nil {
+			return nil, err
+		}
+		if includedFields, err = p.fieldList(); err != nil {
+			return nil, err
+		}
+		if err := p.lex.EatDelim(')'); err != nil {
+			return nil, err
+		}
+	}
+
+	// [ WITH ( FILLFACTOR = IntTok ) ]
+	var fillFactor int32
+	if p.lex.MatchKeyword("with") {
+		if fillFactor, err = p.fillFactor(); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewCreateIndexData(indexName, tableName, fieldNames, includedFields, indexType, fillFactor), nil
+}
+
+// WITH ( FILLFACTOR = IntTok )
+func (p *Parser) fillFactor() (int32, error) {
+	if err := p.lex.EatKeyword("with"); err != nil {
+		return 0, err
+	}
+	if err := p.lex.EatDelim('('); err != nil {
+		return 0, err
+	}
+	// fillfactor は列名などにも使えるよう予約語にはしない
+	param, err := p.lex.EatIdentifier()
+	if err != nil {
+		return 0, err
+	}
+	if param != "fillfactor" {
+		return 0, NewBadSyntaxError(fmt.Sprintf("unknown index parameter %q", param))
+	}
+	if err := p.lex.EatDelim('='); err != nil {
+		return 0, err
+	}
+	fillFactor, err := p.lex.EatIntConstant()
+	if err != nil {
+		return 0, err
+	}
+	if err := p.lex.EatDelim(')'); err != nil {
+		return 0, err
+	}
+	return fillFactor, nil
+}
+
+const defaultIndexType = "btree"
+
+// <Using> := USING ( BTREE | HASH )
+// USING がなければ indexType をそのまま返す
+func (p *Parser) using(indexType string) (string, error) {
+	if !p.lex.MatchKeyword("using") {
+		return indexType, nil
+	}
+	if err := p.lex.EatKeyword("using"); err != nil {
+		return "", err
+	}
+
+	// btree や hash は列名などにも使えるよう予約語にはしない
+	method, err := p.lex.EatIdentifier()
+	if err != nil {
+		return "", err
+	}
+	switch method {
+	case "btree", "hash":
+		return method, nil
+	default:
+		return "", NewBadSyntaxError(fmt.Sprintf("unknown index method %q", method))
+	}
 }
@@ -44,7 +44,195 @@ func TestParserQuery(t *testing.T) {
 			wantError: false,
 		},
 		{
-			input:     "SELECT * FROM STUDENT", // * は未対応
+			input:     "select sname from student where majorid in (select did from dept where dname = 'math')",
+			wantQuery: "select sname from student where majorid in (select did from dept where dname = 'math')",
+			wantError: false,
+		},
+		{
+			input:     "select sname from student where exists (select eid from enroll where studentid = sid) and gradyear = 2020",
+			wantQuery: "select sname from student where exists (select eid from enroll where studentid = sid) and gradyear = 2020",
+			wantError: false,
+		},
+		{
+			input:     "select sname, (select dname from dept where did = majorid) as dname from student where sid = (select studentid from enroll where eid = 1)",
+			wantQuery: "select sname, (select dname from dept where did = majorid) as dname from student where sid = (select studentid from enroll where eid = 1)",
+			wantError: false,
+		},
+		{
+			input:     "select n from (select sname as n from student) as t, (select did from dept) d",
+			wantQuery: "select n from (select sname as n from student) as t, (select did from dept) as d",
+			wantError: false,
+		},
+		{
+			input:     "select s.sname, d.dname from student s, dept as d where s.majorid = d.did",
+			wantQuery: "select s.sname as sname, d.dname as dname from student s, dept d where s.majorid = d.did",
+			wantError: false,
+		},
+		{
+			input:     "select s1.sid, s2.sid from student s1, student s2 where s1.majorid = s2.majorid",
+			wantQuery: "select s1.sid, s2.sid from student s1, student s2 where s1.majorid = s2.majorid",
+			wantError: false,
+		},
+		{
+			input:     "select sname, dname from student join dept on majorid = did where gradyear = 2020",
+			wantQuery: "select sname, dname from student, dept where majorid = did and gradyear = 2020",
+			wantError: false,
+		},
+		{
+			input:     "select sname, dname from student inner join dept on majorid = did cross join enroll",
+			wantQuery: "select sname, dname from student, dept, enroll where majorid = did",
+			wantError: false,
+		},
+		{
+			input:     "select sname, dname from student s left outer join dept d on s.majorid = d.did right join enroll on sid = studentid full join section on sectid = sectionid",
+			wantQuery: "select sname, dname from student s left join dept d on s.majorid = d.did right join enroll on sid = studentid full join section on sectid = sectionid",
+			wantError: false,
+		},
+		{
+			input:     "select n from student left join (select did as n from dept) as t on majorid = n",
+			wantQuery: "select n from student left join (select did as n from dept) as t on majorid = n",
+			wantError: false,
+		},
+		{
+			input:     "select sid from student union select studentid from enroll",
+			wantQuery: "select sid from student union select studentid from enroll",
+			wantError: false,
+		},
+		{
+			input:     "SELECT sid FROM student UNION ALL SELECT studentid FROM enroll EXCEPT SELECT sid FROM alumni INTERSECT SELECT sid FROM staff",
+			wantQuery: "select sid from student union all select studentid from enroll except select sid from alumni intersect select sid from staff",
+			wantError: false,
+		},
+		{
+			input:     "select n from (select did as n from dept intersect select majorid from student) as t where n in (select sid from student except select studentid from enroll)",
+			wantQuery: "select n from (select did as n from dept intersect select majorid from student) as t where n in (select sid from student except select studentid from enroll)",
+			wantError: false,
+		},
+		{
+			input:     "select sid from student union", // 集合演算の右側が必要
+			wantError: true,
+		},
+		{
+			input:     "select sid from student intersect all select sid from alumni", // ALL は UNION だけ
+			wantError: true,
+		},
+		{
+			input:     "select sname from student left join dept", // 外部結合には ON が必要
+			wantError: true,
+		},
+		{
+			input:     "select sname from student left dept on majorid = did",
+			wantError: true,
+		},
+		{
+			input:     "select sname from student where majorid in select did from dept",
+			wantError: true,
+		},
+		{
+			input:     "select (select did from dept) from student", // スカラ副問合せには別名が必要
+			wantError: true,
+		},
+		{
+			input:     "select sid from (select sid from student)", // 導出表には別名が必要
+			wantError: true,
+		},
+		{
+			input:     "SELECT * FROM STUDENT",
+			wantQuery: "select * from student",
+			wantError: false,
+		},
+		{
+			input:     "select distinct s.*, d.dname, from student s, dept d where s.majorid = d.did",
+			wantQuery: "select distinct s.*, d.dname as dname from student s, dept d where s.majorid = d.did",
+			wantError: false,
+		},
+		{
+			input:     "select sid, sname from student order by gradyear, s.sid limit 10 offset 20",
+			wantQuery: "select sid, sname from student order by gradyear, s.sid limit 10 offset 20",
+			wantError: false,
+		},
+		{
+			input:     "select sname from student order by sid DESC limit 2",
+			wantQuery: "select sname from student order by sid desc limit 2",
+			wantError: false,
+		},
+		{
+			input:     "select sid from student order by majorid asc, s.sid desc, sname",
+			wantQuery: "select sid from student order by majorid, s.sid desc, sname",
+			wantError: false,
+		},
+		{
+			input:     "select sid from student offset 5",
+			wantQuery: "select sid from student offset 5",
+			wantError: false,
+		},
+		{
+			input:     "select sid from student union select studentid from enroll order by sid limit 3",
+			wantQuery: "select sid from student union select studentid from enroll order by sid limit 3",
+			wantError: false,
+		},
+		{
+			input:     "select n from (select distinct sid as n from student order by n limit 0) as t",
+			wantQuery: "select n from (select distinct sid as n from student order by n limit 0) as t",
+			wantError: false,
+		},
+		{
+			input:     "select sid, RANK() OVER (PARTITION BY majorid, gradyear ORDER BY sid) as r, row_number() over () as n from student",
+			wantQuery: "select sid, rank() over (partition by majorid, gradyear order by sid) as r, row_number() over () as n from student",
+			wantError: false,
+		},
+		{
+			input:     "select lag(sname) over (order by sid) as prev, lead(s.sname, 2) over (order by s.sid) as next, count(*) over (partition by majorid) as c from student s",
+			wantQuery: "select lag(sname) over (order by sid) as prev, lead(s.sname, 2) over (order by s.sid) as next, count(*) over (partition by majorid) as c from student s",
+			wantError: false,
+		},
+		{
+			input:     "select sid, rank() over (partition by majorid order by grade desc, sid asc) as r from student",
+			wantQuery: "select sid, rank() over (partition by majorid order by grade desc, sid) as r from student",
+			wantError: false,
+		},
+		{
+			input:     "select rank() over (order by sid) from student", // ウィンドウ関数の列には AS が必要
+			wantError: true,
+		},
+		{
+			input:     "select median(sid) over () as m from student",
+			wantError: true,
+		},
+		{
+			input:     "select sum(*) over () as s from student",
+			wantError: true,
+		},
+		{
+			input:     "select * as x from student", // * には AS を付けられない
+			wantError: true,
+		},
+		{
+			input:     "select sid from student limit n",
+			wantError: true,
+		},
+		{
+			input:     "select sid from student order sid",
+			wantError: true,
+		},
+		{
+			input:     "select sid from student order by sid desc asc",
+			wantError: true,
+		},
+		{
+			input:     "select sid from student order by sid descending", // 文の後にトークンが残っている
+			wantError: true,
+		},
+		{
+			input:     "select sid from student where sid = 1 sname",
+			wantError: true,
+		},
+		{
+			input:     "select sid from student limit 1 offset 2 3",
+			wantError: true,
+		},
+		{
+			input:     "select sid from (select sid from student) as t)",
 			wantError: true,
 		},
 		{
@@ -75,6 +263,28 @@ func TestParserQuery(t *testing.T) {
 	}
 }
 
+func TestParserQuerySetOp(t *testing.T) {
+	t.Parallel()
+
+	// INTERSECT は UNION と EXCEPT より先に、UNION と EXCEPT は左から順に適用する
+	p, err := parse.NewParser("select a from x union select b from y intersect select c from z except select d from w")
+	require.NoError(t, err)
+	data, err := p.Query()
+	require.NoError(t, err)
+
+	require.NotNil(t, data.SetOp)
+	assert.Equal(t, parse.SetExcept, data.SetOp.Op)
+	assert.Equal(t, []string{"a"}, data.Fields)
+	union := data.SetOp.Lhs
+	require.NotNil(t, union.SetOp)
+	assert.Equal(t, parse.SetUnion, union.SetOp.Op)
+	assert.False(t, union.SetOp.All)
+	assert.Equal(t, []string{"x"}, union.SetOp.Lhs.Tables)
+	require.NotNil(t, union.SetOp.Rhs.SetOp)
+	assert.Equal(t, parse.SetIntersect, union.SetOp.Rhs.SetOp.Op)
+	assert.Equal(t, []string{"w"}, data.SetOp.Rhs.Tables)
+}
+
 func TestParserUpdateCmd(t *testing.T) {
 	t.Parallel()
 
@@ -130,9 +340,160 @@ func TestParserUpdateCmd(t *testing.T) {
 					schema.AddIntField("age")
 					return schema
 				}(),
+				nil,
+				nil,
+				nil,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE TABLE NOTE(id INT, body VARCHAR(300)) USING slotted",
+			wantCmd: func() *parse.CreateTableData {
+				schema := record.NewSchema()
+				schema.AddIntField("id")
+				schema.AddStringField("body", 300)
+				data := parse.NewCreateTableData("note", schema, nil, nil, nil)
+				data.Format = record.SlottedFormat
+				return data
+			}(),
+			wantError: false,
+		},
+		{
+			input:     "CREATE TABLE NOTE(id INT) USING heap",
+			wantCmd:   nil,
+			wantError: true,
+		},
+		{
+			input: "CREATE TABLE STUDENT(sid INT PRIMARY KEY, sname VARCHAR(20) UNIQUE, age INT)",
+			wantCmd: parse.NewCreateTableData(
+				"student",
+				func() *record.Schema {
+					schema := record.NewSchema()
+					schema.AddIntField("sid")
+					schema.AddStringField("sname", 20)
+					schema.AddIntField("age")
+					return schema
+				}(),
+				[]*parse.KeyConstraint{
+					parse.NewKeyConstraint([]string{"sid"}, true),
+					parse.NewKeyConstraint([]string{"sname"}, false),
+				},
+				nil,
+				nil,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE TABLE ENROLL(studentid INT, sectionid INT, PRIMARY KEY (studentid, sectionid), UNIQUE (sectionid))",
+			wantCmd: parse.NewCreateTableData(
+				"enroll",
+				func() *record.Schema {
+					schema := record.NewSchema()
+					schema.AddIntField("studentid")
+					schema.AddIntField("sectionid")
+					return schema
+				}(),
+				[]*parse.KeyConstraint{
+					parse.NewKeyConstraint([]string{"studentid", "sectionid"}, true),
+					parse.NewKeyConstraint([]string{"sectionid"}, false),
+				},
+				nil,
+				nil,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE TABLE ENROLL(eid INT PRIMARY KEY, studentid INT REFERENCES student ON DELETE CASCADE, sectionid INT REFERENCES section(sectid), grade VARCHAR(2))",
+			wantCmd: parse.NewCreateTableData(
+				"enroll",
+				func() *record.Schema {
+					schema := record.NewSchema()
+					schema.AddIntField("eid")
+					schema.AddIntField("studentid")
+					schema.AddIntField("sectionid")
+					schema.AddStringField("grade", 2)
+					return schema
+				}(),
+				[]*parse.KeyConstraint{
+					parse.NewKeyConstraint([]string{"eid"}, true),
+				},
+				[]*parse.ForeignKeyConstraint{
+					parse.NewForeignKeyConstraint([]string{"studentid"}, "student", nil, parse.OnDeleteCascade),
+					parse.NewForeignKeyConstraint([]string{"sectionid"}, "section", []string{"sectid"}, parse.OnDeleteRestrict),
+				},
+				nil,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE TABLE GRADE(studentid INT, sectionid INT, advisor INT, FOREIGN KEY (studentid, sectionid) REFERENCES enroll (studentid, sectionid) ON DELETE RESTRICT, FOREIGN KEY (advisor) REFERENCES prof ON DELETE SET NULL)",
+			wantCmd: parse.NewCreateTableData(
+				"grade",
+				func() *record.Schema {
+					schema := record.NewSchema()
+					schema.AddIntField("studentid")
+					schema.AddIntField("sectionid")
+					schema.AddIntField("advisor")
+					return schema
+				}(),
+				nil,
+				[]*parse.ForeignKeyConstraint{
+					parse.NewForeignKeyConstraint([]string{"studentid", "sectionid"}, "enroll", []string{"studentid", "sectionid"}, parse.OnDeleteRestrict),
+					parse.NewForeignKeyConstraint([]string{"advisor"}, "prof", nil, parse.OnDeleteSetNull),
+				},
+				nil,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE TABLE STUDENT(sid INT NOT NULL PRIMARY KEY, sname VARCHAR(20) NOT NULL DEFAULT 'anonymous', gradyear INT NULL CHECK (gradyear = 2024), majorid INT DEFAULT NULL)",
+			wantCmd: parse.NewCreateTableData(
+				"student",
+				func() *record.Schema {
+					schema := record.NewSchema()
+					schema.AddIntField("sid")
+					schema.AddStringField("sname", 20)
+					schema.AddIntField("gradyear")
+					schema.AddIntField("majorid")
+					return schema
+				}(),
+				[]*parse.KeyConstraint{
+					parse.NewKeyConstraint([]string{"sid"}, true),
+				},
+				nil,
+				map[string]*parse.ColumnConstraint{
+					"sid":      parse.NewColumnConstraint(true, nil, nil),
+					"sname":    parse.NewColumnConstraint(true, query.NewConstantWithString("anonymous"), nil),
+					"gradyear": parse.NewColumnConstraint(false, nil, query.NewPredicateWithTerm(query.NewTerm(query.NewExpressionWithField("gradyear"), query.NewExpressionWithConstant(query.NewConstantWithInt(2024))))),
+					"majorid":  parse.NewColumnConstraint(false, query.NewNullConstant(), nil),
+				},
 			),
 			wantError: false,
 		},
+		{
+			input:     "CREATE TABLE STUDENT(sid INT NOT, sname VARCHAR(20))", // NOT の後に NULL が必要
+			wantError: true,
+		},
+		{
+			input:     "CREATE TABLE STUDENT(sid INT CHECK sid = 1)", // CHECK には括弧が必要
+			wantError: true,
+		},
+		{
+			input:     "CREATE TABLE ENROLL(studentid INT REFERENCES student ON DELETE NOTHING)", // 未知の参照動作
+			wantError: true,
+		},
+		{
+			input:     "CREATE TABLE ENROLL(studentid INT, FOREIGN KEY studentid REFERENCES student)", // 表制約には括弧が必要
+			wantError: true,
+		},
+		{
+			input:     "CREATE TABLE STUDENT(sid INT PRIMARY, sname VARCHAR(20))", // PRIMARY の後に KEY が必要
+			wantError: true,
+		},
+		{
+			input:     "CREATE TABLE STUDENT(sid INT, PRIMARY KEY)", // 表制約には列の指定が必要
+			wantError: true,
+		},
 		{
 			input:     "CREATE TABLE STUDENT(sid INT, sname VARCHAR, age INT)", // VARCHARは長さ指定が必要
 			wantError: true,
@@ -146,18 +507,287 @@ func TestParserUpdateCmd(t *testing.T) {
 					[]string{"student"},
 					query.NewPredicate(),
 				),
+				false,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE OR REPLACE VIEW tmp AS SELECT sname FROM STUDENT",
+			wantCmd: parse.NewCreateViewData(
+				"tmp",
+				parse.NewQueryData(
+					[]string{"sname"},
+					[]string{"student"},
+					query.NewPredicate(),
+				),
+				true,
 			),
 			wantError: false,
 		},
+		{
+			input:     "CREATE OR VIEW tmp AS SELECT sname FROM STUDENT",
+			wantError: true,
+		},
 		{
 			input: "CREATE INDEX student_sname_idx ON STUDENT(sname)",
 			wantCmd: parse.NewCreateIndexData(
 				"student_sname_idx",
 				"student",
-				"sname",
+				[]string{"sname"},
+				nil,
+				"btree",
+				0,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE INDEX student_sid_idx ON STUDENT(sid) USING HASH",
+			wantCmd: parse.NewCreateIndexData(
+				"student_sid_idx",
+				"student",
+				[]string{"sid"},
+				nil,
+				"hash",
+				0,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE INDEX student_sid_idx ON STUDENT USING btree (sid)",
+			wantCmd: parse.NewCreateIndexData(
+				"student_sid_idx",
+				"student",
+				[]string{"sid"},
+				nil,
+				"btree",
+				0,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE INDEX enroll_idx ON enroll (studentid, sectionid)",
+			wantCmd: parse.NewCreateIndexData(
+				"enroll_idx",
+				"enroll",
+				[]string{"studentid", "sectionid"},
+				nil,
+				"btree",
+				0,
+			),
+			wantError: false,
+		},
+		{
+			input:     "CREATE INDEX student_sid_idx ON STUDENT(sid) USING gist",
+			wantError: true,
+		},
+		{
+			input: "CREATE INDEX student_sname_idx ON STUDENT(sname) WITH (FILLFACTOR = 70)",
+			wantCmd: parse.NewCreateIndexData(
+				"student_sname_idx",
+				"student",
+				[]string{"sname"},
+				nil,
+				"btree",
+				70,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE INDEX student_sid_idx ON STUDENT(sid) USING btree WITH (fillfactor = 100)",
+			wantCmd: parse.NewCreateIndexData(
+				"student_sid_idx",
+				"student",
+				[]string{"sid"},
+				nil,
+				"btree",
+				100,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE INDEX enroll_idx ON enroll (studentid) INCLUDE (sectionid, grade)",
+			wantCmd: parse.NewCreateIndexData(
+				"enroll_idx",
+				"enroll",
+				[]string{"studentid"},
+				[]string{"sectionid", "grade"},
+				"btree",
+				0,
+			),
+			wantError: false,
+		},
+		{
+			input: "CREATE INDEX enroll_idx ON enroll (studentid) USING btree INCLUDE (grade) WITH (FILLFACTOR = 80)",
+			wantCmd: parse.NewCreateIndexData(
+				"enroll_idx",
+				"enroll",
+				[]string{"studentid"},
+				[]string{"grade"},
+				"btree",
+				80,
+			),
+			wantError: false,
+		},
+		{
+			input:     "CREATE INDEX enroll_idx ON enroll (studentid) INCLUDE grade",
+			wantError: true,
+		},
+		{
+			input:     "CREATE INDEX enroll_idx ON enroll (studentid) INCLUDE ()",
+			wantError: true,
+		},
+		{
+			input:     "CREATE INDEX student_sid_idx ON STUDENT(sid) WITH (pages_per_range = 4)",
+			wantError: true,
+		},
+		{
+			input:     "CREATE INDEX student_sid_idx ON STUDENT(sid) WITH FILLFACTOR = 70",
+			wantError: true,
+		},
+		{
+			input:     "DROP TABLE STUDENT",
+			wantCmd:   parse.NewDropTableData("student", false),
+			wantError: false,
+		},
+		{
+			input:     "DROP TABLE IF EXISTS student",
+			wantCmd:   parse.NewDropTableData("student", true),
+			wantError: false,
+		},
+		{
+			input:     "DROP VIEW student_view",
+			wantCmd:   parse.NewDropViewData("student_view", false),
+			wantError: false,
+		},
+		{
+			input:     "DROP INDEX IF EXISTS student_sid_idx",
+			wantCmd:   parse.NewDropIndexData("student_sid_idx", true),
+			wantError: false,
+		},
+		{
+			input:     "DROP SEQUENCE student_seq",
+			wantError: true,
+		},
+		{
+			input:     "DROP TABLE IF student",
+			wantError: true,
+		},
+		{
+			input: "ALTER TABLE student ADD COLUMN gradyear INT NOT NULL DEFAULT 2020",
+			wantCmd: parse.NewAddColumnData(
+				"student",
+				parse.NewCreateTableData(
+					"student",
+					func() *record.Schema {
+						schema := record.NewSchema()
+						schema.AddIntField("gradyear")
+						return schema
+					}(),
+					nil,
+					nil,
+					map[string]*parse.ColumnConstraint{
+						"gradyear": parse.NewColumnConstraint(true, query.NewConstantWithInt(2020), nil),
+					},
+				),
+			),
+			wantError: false,
+		},
+		{
+			input: "ALTER TABLE student ADD sname VARCHAR(10)",
+			wantCmd: parse.NewAddColumnData(
+				"student",
+				parse.NewCreateTableData(
+					"student",
+					func() *record.Schema {
+						schema := record.NewSchema()
+						schema.AddStringField("sname", 10)
+						return schema
+					}(),
+					nil,
+					nil,
+					nil,
+				),
 			),
 			wantError: false,
 		},
+		{
+			input:     "ALTER TABLE student DROP COLUMN gradyear",
+			wantCmd:   parse.NewDropColumnData("student", "gradyear"),
+			wantError: false,
+		},
+		{
+			input:     "ALTER TABLE student DROP gradyear",
+			wantCmd:   parse.NewDropColumnData("student", "gradyear"),
+			wantError: false,
+		},
+		{
+			input:     "ALTER TABLE student RENAME COLUMN sname TO name",
+			wantCmd:   parse.NewRenameColumnData("student", "sname", "name"),
+			wantError: false,
+		},
+		{
+			input:     "ALTER TABLE student RENAME TO pupil",
+			wantCmd:   parse.NewRenameTableData("student", "pupil"),
+			wantError: false,
+		},
+		{
+			input:     "ALTER TABLE student RENAME sname",
+			wantError: true,
+		},
+		{
+			input:     "VACUUM student",
+			wantCmd:   parse.NewVacuumData("student"),
+			wantError: false,
+		},
+		{
+			input:     "VACUUM",
+			wantCmd:   parse.NewVacuumData(""),
+			wantError: false,
+		},
+		{
+			input:     "REINDEX INDEX sid_idx",
+			wantCmd:   parse.NewReindexIndexData("sid_idx"),
+			wantError: false,
+		},
+		{
+			input:     "REINDEX TABLE student",
+			wantCmd:   parse.NewReindexTableData("student"),
+			wantError: false,
+		},
+		{
+			input:     "REINDEX student",
+			wantError: true,
+		},
+		{
+			input:     "CHECK INDEX sid_idx",
+			wantCmd:   parse.NewCheckIndexData("sid_idx"),
+			wantError: false,
+		},
+		{
+			input:     "check table student",
+			wantCmd:   parse.NewCheckTableData("student"),
+			wantError: false,
+		},
+		{
+			input:     "CHECK student",
+			wantError: true,
+		},
+		{
+			input:     "ALTER TABLE student MODIFY sname INT",
+			wantError: true,
+		},
+		{
+			input:     "DELETE FROM student WHERE sid = 1 sname", // 文の後にトークンが残っている
+			wantError: true,
+		},
+		{
+			input:     "DROP TABLE student enroll",
+			wantError: true,
+		},
+		{
+			input:     "CREATE VIEW v AS SELECT sid FROM student ORDER BY sid DESC LIMIT 1 2",
+			wantError: true,
+		},
 	} {
 		t.Run(tt.input, func(t *testing.T) {
 			t.Parallel()
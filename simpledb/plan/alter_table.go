@@ -0,0 +1,686 @@
+package plan
+
+import (
+	"fmt"
+	"maps"
+	"simpledb/file"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+)
+
+// tableAlteration ALTER TABLE文で変更する表
+// 列の追加と削除、表の名前の変更では、同じトランザクションの中で表のファイルを新しいレイアウトで書き直すので、ロールバックすれば元に戻る
+type tableAlteration struct {
+	mdm         *metadata.Manager
+	tx          *tx.Transaction
+	tableName   string
+	layout      *record.Layout
+	constraints map[string]*metadata.FieldConstraint
+	// useIndex 書き直したレコードの RID で索引のエントリを作り直すか
+	useIndex bool
+}
+
+func alterTable(mdm *metadata.Manager, data *parse.AlterTableData, tx *tx.Transaction, useIndex bool) error {
+	layout, err := mdm.GetLayout(data.TableName, tx)
+	if err != nil {
+		return err
+	}
+	if len(layout.Schema().Fields()) == 0 {
+		return fmt.Errorf("table %q does not exist", data.TableName)
+	}
+	constraints, err := mdm.GetFieldConstraints(data.TableName, tx)
+	if err != nil {
+		return err
+	}
+	ta := &tableAlteration{mdm, tx, data.TableName, layout, constraints, useIndex}
+
+	switch data.Action {
+	case parse.AlterAddColumn:
+		return ta.addColumn(data.Column)
+	case parse.AlterDropColumn:
+		return ta.dropColumn(data.FieldName)
+	case parse.AlterRenameColumn:
+		return ta.renameColumn(data.FieldName, data.NewName)
+	case parse.AlterRenameTable:
+		return ta.renameTable(data.NewName)
+	default:
+		return fmt.Errorf("unknown ALTER TABLE action %q", data.Action)
+	}
+}
+
+// addColumn 列を追加する。既存のレコードの列の値は既定値、既定値がなければ NULL になる
+func (ta *tableAlteration) addColumn(column *parse.CreateTableData) error {
+	if len(column.Keys) > 0 || len(column.ForeignKeys) > 0 {
+		return fmt.Errorf("ALTER TABLE ADD COLUMN does not support PRIMARY KEY, UNIQUE or REFERENCES")
+	}
+	fieldName := column.NewSchema.Fields()[0]
+	schema := ta.layout.Schema()
+	if schema.HasField(fieldName) {
+		return fmt.Errorf("column %q already exists in %s", fieldName, ta.tableName)
+	}
+
+	newSchema := record.NewSchema()
+	newSchema.AddAll(schema)
+	newSchema.AddAll(column.NewSchema)
+	defs, err := fieldConstraintDefs(parse.NewCreateTableData(ta.tableName, newSchema, nil, nil, column.Columns))
+	if err != nil {
+		return err
+	}
+	newConstraints := maps.Clone(ta.constraints)
+	if newConstraints == nil {
+		newConstraints = make(map[string]*metadata.FieldConstraint)
+	}
+	if def, ok := defs[fieldName]; ok {
+		newConstraints[fieldName] = def
+	}
+
+	val := query.NewNullConstant()
+	cc := &columnConstraints{tableName: ta.tableName, layout: record.NewLayoutFromSchemaWithEncoding(newSchema, ta.layout.Format(), ta.tx.Encoding())}
+	if c, ok := column.Columns[fieldName]; ok {
+		if c.Default != nil {
+			val = c.Default
+		}
+		if c.NotNull {
+			cc.notNull = append(cc.notNull, fieldName)
+		}
+		if c.Check != nil {
+			cc.checks = append(cc.checks, columnCheck{fieldName, c.Check})
+		}
+	}
+
+	// 既存のレコードが新しい列の制約を満たすか、書き直す前に調べる
+	if len(cc.notNull) > 0 || len(cc.checks) > 0 {
+		if err := ta.checkRows(cc, fieldName, val); err != nil {
+			return err
+		}
+	}
+
+	value := func(s query.Scan, f string) (*query.Constant, error) {
+		if f == fieldName {
+			return val, nil
+		}
+		return s.GetVal(f)
+	}
+	return ta.rewrite(ta.tableName, newSchema, value, func() error {
+		return ta.mdm.AlterTable(ta.tableName, ta.tableName, newSchema, newConstraints, ta.tx)
+	})
+}
+
+// checkRows 全てのレコードについて、列 fieldName の値を val にしても制約 cc を満たすか調べる
+func (ta *tableAlteration) checkRows(cc *columnConstraints, fieldName string, val *query.Constant) error {
+	ts, err := query.NewTableScan(ta.tx, ta.tableName, ta.layout)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+	for {
+		if next, err := ts.Next(); err != nil {
+			return err
+		} else if !next {
+			return nil
+		}
+		if err := cc.check(&modifiedScan{ts, fieldName, val}); err != nil {
+			return err
+		}
+	}
+}
+
+// dropColumn 列を削除する。列を含む索引と外部キー、列を参照する CHECK 制約も削除する
+// 他の表から参照されている列や、ビューが参照している列は削除できない
+func (ta *tableAlteration) dropColumn(fieldName string) error {
+	schema := ta.layout.Schema()
+	if !schema.HasField(fieldName) {
+		return fmt.Errorf("column %q does not exist in %s", fieldName, ta.tableName)
+	}
+	if len(schema.Fields()) == 1 {
+		return fmt.Errorf("cannot drop the only column of %s", ta.tableName)
+	}
+
+	referencing, err := ta.mdm.GetReferencingKeys(ta.tableName, ta.tx)
+	if err != nil {
+		return err
+	}
+	for _, fk := range referencing {
+		if slices.Contains(fk.RefFieldNames, fieldName) {
+			return fmt.Errorf("cannot drop column %s of %s because foreign key %q on %s references it", fieldName, ta.tableName, fk.Name, fk.TableName)
+		}
+	}
+	if err := ta.renameInViews(fieldName, ""); err != nil {
+		return err
+	}
+
+	newSchema := record.NewSchema()
+	for _, f := range schema.Fields() {
+		if f != fieldName {
+			newSchema.Add(f, schema)
+		}
+	}
+	newConstraints := make(map[string]*metadata.FieldConstraint)
+	for f, c := range ta.constraints {
+		if f == fieldName {
+			continue
+		}
+		newC := *c
+		if c.Check != "" {
+			pred, err := parseCheck(f, c.Check)
+			if err != nil {
+				return err
+			}
+			if pred.Mentions(fieldName) {
+				newC.Check = ""
+			}
+		}
+		newConstraints[f] = &newC
+	}
+
+	value := func(s query.Scan, f string) (*query.Constant, error) {
+		return s.GetVal(f)
+	}
+	return ta.rewrite(ta.tableName, newSchema, value, func() error {
+		fks, err := ta.mdm.GetForeignKeys(ta.tableName, ta.tx)
+		if err != nil {
+			return err
+		}
+		for _, fk := range fks {
+			if slices.Contains(fk.FieldNames, fieldName) {
+				if err := ta.mdm.DropForeignKey(fk.Name, ta.tx); err != nil {
+					return err
+				}
+			}
+		}
+		indexes, err := ta.mdm.GetIndexInfo(ta.tableName, ta.tx)
+		if err != nil {
+			return err
+		}
+		for _, ii := range indexes {
+			if ii.Covers(fieldName) {
+				if err := removeIndex(ta.mdm, ii, ta.tx); err != nil {
+					return err
+				}
+			}
+		}
+		return ta.mdm.AlterTable(ta.tableName, ta.tableName, newSchema, newConstraints, ta.tx)
+	})
+}
+
+// renameColumn 列の名前を変更する。レイアウトは変わらないので、表のファイルは書き直さない
+func (ta *tableAlteration) renameColumn(fieldName string, newFieldName string) error {
+	schema := ta.layout.Schema()
+	if !schema.HasField(fieldName) {
+		return fmt.Errorf("column %q does not exist in %s", fieldName, ta.tableName)
+	}
+	if schema.HasField(newFieldName) {
+		return fmt.Errorf("column %q already exists in %s", newFieldName, ta.tableName)
+	}
+
+	newSchema := record.NewSchema()
+	for _, f := range schema.Fields() {
+		if f != fieldName {
+			newSchema.Add(f, schema)
+		} else if schema.Type(f) == record.INT {
+			newSchema.AddIntField(newFieldName)
+		} else {
+			newSchema.AddStringField(newFieldName, schema.Length(f))
+		}
+	}
+	newConstraints := make(map[string]*metadata.FieldConstraint)
+	for f, c := range ta.constraints {
+		newC := *c
+		if c.Check != "" {
+			pred, err := parseCheck(f, c.Check)
+			if err != nil {
+				return err
+			}
+			newC.Check = pred.RenameField(fieldName, newFieldName).String()
+		}
+		if f == fieldName {
+			f = newFieldName
+		}
+		newConstraints[f] = &newC
+	}
+
+	if err := ta.mdm.AlterTable(ta.tableName, ta.tableName, newSchema, newConstraints, ta.tx); err != nil {
+		return err
+	}
+	if err := ta.mdm.RenameField(ta.tableName, fieldName, newFieldName, ta.tx); err != nil {
+		return err
+	}
+	return ta.renameInViews(fieldName, newFieldName)
+}
+
+// renameTable 表の名前を変更する。レコードは新しい名前のファイルに書き直し、元のファイルはコミットした時に削除する
+func (ta *tableAlteration) renameTable(newTableName string) error {
+	layout, err := ta.mdm.GetLayout(newTableName, ta.tx)
+	if err != nil {
+		return err
+	}
+	if len(layout.Schema().Fields()) > 0 {
+		return fmt.Errorf("table %q already exists", newTableName)
+	}
+	viewDef, err := ta.mdm.GetViewDef(newTableName, ta.tx)
+	if err != nil {
+		return err
+	}
+	if viewDef != "" {
+		return fmt.Errorf("view %q already exists", newTableName)
+	}
+	if err := checkNotRemoved(ta.tx, newTableName+".tbl"); err != nil {
+		return err
+	}
+
+	value := func(s query.Scan, f string) (*query.Constant, error) {
+		return s.GetVal(f)
+	}
+	err = ta.rewrite(newTableName, ta.layout.Schema(), value, func() error {
+		if err := ta.mdm.AlterTable(ta.tableName, newTableName, ta.layout.Schema(), ta.constraints, ta.tx); err != nil {
+			return err
+		}
+		return ta.mdm.RenameTable(ta.tableName, newTableName, ta.tx)
+	})
+	if err != nil {
+		return err
+	}
+	if err := ta.tx.RemoveOnCommit(ta.tableName + ".tbl"); err != nil {
+		return err
+	}
+	if err := ta.tx.RemoveOnCommit(record.FreeSpaceMapFile(ta.tableName)); err != nil {
+		return err
+	}
+	if err := ta.tx.RemoveOnCommit(record.OverflowFile(ta.tableName)); err != nil {
+		return err
+	}
+
+	defs, err := ta.mdm.GetViewDefs(ta.tx)
+	if err != nil {
+		return err
+	}
+	for viewName, viewDef := range defs {
+		data, err := parseViewDef(viewName, viewDef)
+		if err != nil {
+			return err
+		}
+		data, renamed, err := renameTableIn(data, ta.tableName, newTableName)
+		if err != nil {
+			return err
+		}
+		if !renamed {
+			continue
+		}
+		if err := ta.mdm.ReplaceView(viewName, data.String(), ta.tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite 表のレコードを一時表に退避し、表 newTableName のファイルに新しいスキーマで書き直す
+// value は書き直すレコードの列の値を、元のレコードから求める
+// alterCatalog はレコードを退避した後、書き直す前にカタログを変更する
+func (ta *tableAlteration) rewrite(newTableName string, newSchema *record.Schema, value func(s query.Scan, fieldName string) (*query.Constant, error), alterCatalog func() error) error {
+	indexes, err := ta.mdm.GetIndexInfo(ta.tableName, ta.tx)
+	if err != nil {
+		return err
+	}
+	temp := query.NewTempTable(ta.tx, newSchema)
+	if err := ta.copyOut(temp, value, indexes); err != nil {
+		return err
+	}
+
+	if err := alterCatalog(); err != nil {
+		return err
+	}
+
+	newLayout, err := ta.mdm.GetLayout(newTableName, ta.tx)
+	if err != nil {
+		return err
+	}
+	// 元のレイアウトのレコードが残らないよう、既存のブロックを全て空にしてから書き直す
+	filename := newTableName + ".tbl"
+	size, err := ta.tx.Size(filename)
+	if err != nil {
+		return err
+	}
+	fsm := record.NewFreeSpaceMap(ta.tx, newTableName)
+	for blockNum := int32(0); blockNum < size; blockNum++ {
+		blk := file.NewBlockID(filename, blockNum)
+		if err := ta.tx.Pin(blk); err != nil {
+			return err
+		}
+		err := record.ClearBlock(ta.tx, blk)
+		ta.tx.Unpin(blk)
+		if err != nil {
+			return err
+		}
+		if err := fsm.SetFull(blockNum, false); err != nil {
+			return err
+		}
+	}
+	// 元のレコードの大きな文字列は一時表に写したので、オーバーフローファイルのブロックはまとめて空きにする
+	if err := record.NewOverflow(ta.tx, newTableName).Reset(); err != nil {
+		return err
+	}
+
+	var newIndexes map[string]*metadata.IndexInfo
+	if ta.useIndex {
+		newIndexes, err = ta.mdm.GetIndexInfo(newTableName, ta.tx)
+		if err != nil {
+			return err
+		}
+	}
+	return copyIn(temp, newTableName, newLayout, newIndexes, ta.tx)
+}
+
+// copyOut 表のレコードを一時表 temp に写し、索引からレコードのエントリを削除する
+func (ta *tableAlteration) copyOut(temp *query.TempTable, value func(s query.Scan, fieldName string) (*query.Constant, error), indexes map[string]*metadata.IndexInfo) error {
+	ts, err := query.NewTableScan(ta.tx, ta.tableName, ta.layout)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+	tempScan, err := temp.Open()
+	if err != nil {
+		return err
+	}
+	defer tempScan.Close()
+
+	for {
+		if next, err := ts.Next(); err != nil {
+			return err
+		} else if !next {
+			return nil
+		}
+		if err := tempScan.Insert(); err != nil {
+			return err
+		}
+		for _, fieldName := range temp.Layout().Schema().Fields() {
+			val, err := value(ts, fieldName)
+			if err != nil {
+				return err
+			}
+			if err := setVal(tempScan, temp.Layout(), fieldName, val); err != nil {
+				return err
+			}
+		}
+
+		if !ta.useIndex {
+			continue
+		}
+		rid, err := ts.GetRID()
+		if err != nil {
+			return err
+		}
+		for _, ii := range indexes {
+			key, err := ii.KeyOf(ts)
+			if err != nil {
+				return err
+			}
+			idx, err := ii.Open()
+			if err != nil {
+				return err
+			}
+			err = idx.Delete(key, rid)
+			idx.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// copyIn 一時表 temp のレコードを表 tableName に挿入し、索引 indexes にエントリを作る
+func copyIn(temp *query.TempTable, tableName string, layout *record.Layout, indexes map[string]*metadata.IndexInfo, tx *tx.Transaction) error {
+	tempScan, err := temp.Open()
+	if err != nil {
+		return err
+	}
+	defer tempScan.Close()
+	ts, err := query.NewTableScan(tx, tableName, layout)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+
+	for {
+		if next, err := tempScan.Next(); err != nil {
+			return err
+		} else if !next {
+			return nil
+		}
+		if err := ts.Insert(); err != nil {
+			return err
+		}
+		for _, fieldName := range layout.Schema().Fields() {
+			val, err := tempScan.GetVal(fieldName)
+			if err != nil {
+				return err
+			}
+			if err := setVal(ts, layout, fieldName, val); err != nil {
+				return err
+			}
+		}
+
+		rid, err := ts.GetRID()
+		if err != nil {
+			return err
+		}
+		for _, ii := range indexes {
+			idx, err := ii.Open()
+			if err != nil {
+				return err
+			}
+			err = ii.InsertEntry(idx, ts, rid)
+			idx.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setVal NULL を格納できない列には NULL を設定せず、ゼロ値のままにする
+func setVal(s query.UpdateScan, layout *record.Layout, fieldName string, val *query.Constant) error {
+	if val.IsNull() && layout.NullMask(fieldName) == 0 {
+		return nil
+	}
+	return s.SetVal(fieldName, val)
+}
+
+// renameInViews ビューの定義の中の、表の列 fieldName を newFieldName にする
+// 列を出力するビューを参照するビューも書き換える。newFieldName が空なら、列を参照するビューがあればエラーを返す
+func (ta *tableAlteration) renameInViews(fieldName string, newFieldName string) error {
+	defs, err := ta.mdm.GetViewDefs(ta.tx)
+	if err != nil {
+		return err
+	}
+	// 列 fieldName を出力する表とビュー
+	relations := []string{ta.tableName}
+	done := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for viewName, viewDef := range defs {
+			if done[viewName] {
+				continue
+			}
+			data, err := parseViewDef(viewName, viewDef)
+			if err != nil {
+				return err
+			}
+			data, uses, outputs, err := renameColumnIn(data, relations, fieldName, newFieldName)
+			if err != nil {
+				return err
+			}
+			if !uses {
+				continue
+			}
+			if newFieldName == "" {
+				return fmt.Errorf("cannot drop column %s of %s because view %q uses it", fieldName, ta.tableName, viewName)
+			}
+
+			if err := ta.mdm.ReplaceView(viewName, data.String(), ta.tx); err != nil {
+				return err
+			}
+			done[viewName] = true
+			if outputs {
+				relations = append(relations, viewName)
+				changed = true
+			}
+		}
+	}
+	return nil
+}
+
+// renameTableIn 問合せ data の FROM句で参照する表 tableName を newTableName にした問合せを返す。参照していれば true を返す
+// 別名のない参照は参照名も newTableName にして、表名で修飾した列も書き換える
+func renameTableIn(data *parse.QueryData, tableName string, newTableName string) (*parse.QueryData, bool, error) {
+	if data.SetOp != nil {
+		lhs, lRenamed, err := renameTableIn(data.SetOp.Lhs, tableName, newTableName)
+		if err != nil {
+			return nil, false, err
+		}
+		rhs, rRenamed, err := renameTableIn(data.SetOp.Rhs, tableName, newTableName)
+		if err != nil {
+			return nil, false, err
+		}
+		return parse.NewSetOpQueryData(data.SetOp.Op, data.SetOp.All, lhs, rhs), lRenamed || rRenamed, nil
+	}
+	renamed := false
+	for _, ref := range data.Tables {
+		if d, ok := data.Derived[ref]; ok {
+			d, dRenamed, err := renameTableIn(d, tableName, newTableName)
+			if err != nil {
+				return nil, false, err
+			}
+			data.Derived[ref] = d
+			renamed = renamed || dRenamed
+		} else if ref != tableName && data.TableName(ref) == tableName {
+			data.Aliases[ref] = newTableName
+			renamed = true
+		}
+	}
+	if !slices.Contains(data.Tables, tableName) || data.Derived[tableName] != nil || data.TableName(tableName) != tableName {
+		return data, renamed, nil
+	}
+
+	result, err := mapNames(data, func(name string) (*query.Expression, error) {
+		if qualifier, fieldName := query.SplitFieldName(name); qualifier == tableName {
+			return query.NewExpressionWithQualifiedField(newTableName, fieldName), nil
+		}
+		return query.NewExpressionWithField(name), nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	result.Tables = slices.Clone(result.Tables)
+	result.Tables[slices.Index(result.Tables, tableName)] = newTableName
+	for _, j := range result.Joins {
+		if j.Table == tableName {
+			j.Table = newTableName
+		}
+	}
+	return result, true, nil
+}
+
+// renameColumnIn 問合せ data の中の、表かビュー relations の列 fieldName を newFieldName にした問合せを返す
+// uses は data が列を参照しているか、outputs は data が AS を付けずに列を出力しているか
+// 集合演算の列名は左側の問合せのものなので、outputs は左側の問合せで決まる
+func renameColumnIn(data *parse.QueryData, relations []string, fieldName string, newFieldName string) (result *parse.QueryData, uses bool, outputs bool, err error) {
+	if data.SetOp != nil {
+		lhs, lUses, lOutputs, err := renameColumnIn(data.SetOp.Lhs, relations, fieldName, newFieldName)
+		if err != nil {
+			return nil, false, false, err
+		}
+		rhs, rUses, _, err := renameColumnIn(data.SetOp.Rhs, relations, fieldName, newFieldName)
+		if err != nil {
+			return nil, false, false, err
+		}
+		return parse.NewSetOpQueryData(data.SetOp.Op, data.SetOp.All, lhs, rhs), lUses || rUses, lOutputs, nil
+	}
+	// refs 列 fieldName を出力する参照
+	var refs []string
+	derived := make(map[string]*parse.QueryData)
+	for _, ref := range data.Tables {
+		if d, ok := data.Derived[ref]; ok {
+			d, dUses, dOutputs, err := renameColumnIn(d, relations, fieldName, newFieldName)
+			if err != nil {
+				return nil, false, false, err
+			}
+			uses = uses || dUses
+			derived[ref] = d
+			if dOutputs {
+				refs = append(refs, ref)
+			}
+		} else if slices.Contains(relations, data.TableName(ref)) {
+			refs = append(refs, ref)
+		}
+	}
+	// * と t.* で参照の列を出力していれば、新しい列名で出力する
+	for _, f := range data.Fields {
+		if qualifier, ok := parse.IsAllColumns(f); ok && len(refs) > 0 && (qualifier == "" || slices.Contains(refs, qualifier)) {
+			uses, outputs = true, true
+		}
+	}
+	if len(refs) == 0 {
+		if !uses {
+			return data, false, false, nil
+		}
+		copied := *data
+		copied.Derived = derived
+		return &copied, true, false, nil
+	}
+
+	result, err = mapNames(data, func(name string) (*query.Expression, error) {
+		qualifier, f := query.SplitFieldName(name)
+		if f != fieldName || (qualifier != "" && !slices.Contains(refs, qualifier)) {
+			return query.NewExpressionWithField(name), nil
+		}
+		uses = true
+		if qualifier == "" {
+			return query.NewExpressionWithField(newFieldName), nil
+		}
+		return query.NewExpressionWithQualifiedField(qualifier, newFieldName), nil
+	})
+	if err != nil {
+		return nil, false, false, err
+	}
+	if len(derived) > 0 {
+		result.Derived = derived
+	}
+	result.Fields = slices.Clone(result.Fields)
+	for i, f := range result.Fields {
+		e, ok := result.Exprs[f]
+		if f != fieldName || !ok || !e.IsFieldName() {
+			continue
+		}
+		if _, c := query.SplitFieldName(e.AsFieldName()); c != newFieldName {
+			continue
+		}
+		// AS を付けずに出力していた列は、新しい列名で出力する
+		result.Fields[i] = newFieldName
+		if j := slices.Index(result.OrderBy, f); j >= 0 {
+			result.OrderBy = slices.Clone(result.OrderBy)
+			result.OrderBy[j] = newFieldName
+		}
+		delete(result.Exprs, f)
+		if e.AsFieldName() != newFieldName {
+			result.Exprs[newFieldName] = e
+		}
+		outputs = true
+	}
+	return result, uses, outputs, nil
+}
+
+func parseCheck(fieldName string, check string) (*query.Predicate, error) {
+	parser, err := parse.NewParser(check)
+	if err != nil {
+		return nil, err
+	}
+	pred, err := parser.Predicate()
+	if err != nil {
+		return nil, fmt.Errorf("check constraint of %q: %w", fieldName, err)
+	}
+	return pred, nil
+}
@@ -0,0 +1,127 @@
+package plan_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"simpledb/metadata"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlterTable(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			dir := path.Join(t.TempDir(), "alter_table_test")
+			simpleDB, err := newDB(dir)
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			mdm := simpleDB.MetadataManager()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			fields := func(tableName string) []string {
+				layout, err := mdm.GetLayout(tableName, tx)
+				require.NoError(t, err)
+				return layout.Schema().Fields()
+			}
+
+			require.NoError(t, exec("create table student (sid int primary key, sname varchar(10), majorid int check (majorid = 10))"))
+			require.NoError(t, exec("create table enroll (eid int, studentid int references student)"))
+			require.NoError(t, exec("create view math as select sid, sname from student where majorid = 10"))
+			require.NoError(t, exec("create view mathnames as select sname from math"))
+			var all []int32
+			for i := int32(1); i <= 30; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid) values (%d, 'name%d', 10)", i, i)))
+				all = append(all, i)
+			}
+			require.NoError(t, exec("insert into enroll (eid, studentid) values (100, 7)"))
+			require.NoError(t, tx.Commit())
+
+			// ロールバックすれば表は元に戻る
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec("alter table student add column gradyear int default 2020"))
+			assert.Equal(t, []string{"sid", "sname", "majorid", "gradyear"}, fields("student"))
+			require.NoError(t, tx.Rollback())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"sid", "sname", "majorid"}, fields("student"))
+			assert.ElementsMatch(t, all, queryInts(t, planner, tx, "select sid from student"))
+
+			// ADD COLUMN: 既存のレコードは既定値になる
+			require.NoError(t, exec("alter table student add column gradyear int default 2020"))
+			assert.ElementsMatch(t, all, queryInts(t, planner, tx, "select sid from student where gradyear = 2020"))
+			assert.Equal(t, []int32{2020}, queryInts(t, planner, tx, "select gradyear from student where sid = 17"))
+			require.NoError(t, exec("insert into student (sid, sname, majorid) values (31, 'new', 10)"))
+			assert.Equal(t, []int32{2020}, queryInts(t, planner, tx, "select gradyear from student where sid = 31"))
+			require.NoError(t, exec("delete from student where sid = 31"))
+
+			// 既存のレコードが制約を満たさなければ列を追加できない
+			var cve *metadata.ConstraintViolationError
+			assert.True(t, errors.As(exec("alter table student add column status int not null"), &cve))
+			assert.True(t, errors.As(exec("alter table student add column status int default 1 check (status = 2)"), &cve))
+			assert.Error(t, exec("alter table student add column sname int"))
+			assert.Error(t, exec("alter table student add column email varchar(20) unique"))
+			assert.Equal(t, []string{"sid", "sname", "majorid", "gradyear"}, fields("student"))
+
+			// RENAME COLUMN: 制約とビューも追従する
+			require.NoError(t, exec("alter table student rename column majorid to major"))
+			constraints, err := mdm.GetFieldConstraints("student", tx)
+			require.NoError(t, err)
+			assert.Equal(t, "major = 10", constraints["major"].Check)
+			viewDef, err := mdm.GetViewDef("math", tx)
+			require.NoError(t, err)
+			assert.Equal(t, "select sid, sname from student where major = 10", viewDef)
+			require.NoError(t, exec("alter table student rename sname to name"))
+			viewDef, err = mdm.GetViewDef("mathnames", tx)
+			require.NoError(t, err)
+			assert.Equal(t, "select name from math", viewDef)
+
+			// DROP COLUMN: ビューや他の表が参照している列は削除できない
+			assert.Error(t, exec("alter table student drop column name"))
+			assert.Error(t, exec("alter table student drop column sid"))
+			assert.Error(t, exec("alter table student drop column nosuch"))
+			require.NoError(t, exec("alter table student drop column gradyear"))
+			assert.Equal(t, []string{"sid", "name", "major"}, fields("student"))
+			assert.Equal(t, []int32{12}, queryInts(t, planner, tx, "select sid from student where sid = 12"))
+			assert.Len(t, queryInts(t, planner, tx, "select major from student where major = 10"), len(all))
+
+			// RENAME TO: 索引と外部キーも新しい表のものになる
+			require.NoError(t, exec("alter table student rename to pupil"))
+			assert.Empty(t, fields("student"))
+			assert.Equal(t, []int32{12}, queryInts(t, planner, tx, "select sid from pupil where sid = 12"))
+			fks, err := mdm.GetForeignKeys("enroll", tx)
+			require.NoError(t, err)
+			require.Len(t, fks, 1)
+			assert.Equal(t, "pupil", fks[0].RefTableName)
+			assert.Error(t, exec("delete from pupil where sid = 7"))
+			assert.Error(t, exec("insert into enroll (eid, studentid) values (101, 99)"))
+			viewDef, err = mdm.GetViewDef("math", tx)
+			require.NoError(t, err)
+			assert.Equal(t, "select sid, name from pupil where major = 10", viewDef)
+			assert.Error(t, exec("alter table pupil rename to enroll"))
+			require.NoError(t, tx.Commit())
+			_, err = os.Stat(path.Join(dir, "student.tbl"))
+			assert.True(t, os.IsNotExist(err))
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, all, queryInts(t, planner, tx, "select sid from pupil"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
@@ -3,6 +3,8 @@ package plan
 import (
 	"simpledb/metadata"
 	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
 	"simpledb/tx"
 )
 
@@ -18,46 +20,48 @@ func NewBasicQueryPlanner(mdm *metadata.Manager) *BasicQueryPlanner {
 
 func (qp *BasicQueryPlanner) CreatePlan(querydata *parse.QueryData, tx *tx.Transaction) (Plan, error) {
 	var result Plan
-	var err error
 
-	plans := make([]Plan, 0, 5)
+	// 集合演算は左右の問合せの計画を組み合わせる
+	if querydata.SetOp != nil {
+		return createSetOpPlan(qp, querydata, tx)
+	}
 
-	// Step 1: テーブル・ビューに対するPlanの作成
+	// ビューはビューの定義に展開する
+	querydata, err := expandViews(qp.mdm, querydata, tx)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, tableName := range querydata.Tables {
-		viewDef, err := qp.mdm.GetViewDef(tableName, tx)
-		if err != nil {
-			return nil, err
-		}
-		// View定義が存在しない場合空文字列
-		if err == nil && viewDef != "" {
-			// Viewの場合再帰的にPlanを作成
-			parser, err := parse.NewParser(viewDef)
-			if err != nil {
-				return nil, err
-			}
-			viewdata, err := parser.Query()
-			if err != nil {
-				return nil, err
-			}
-			plan, err := qp.CreatePlan(viewdata, tx)
-			if err != nil {
-				return nil, err
-			}
-			plans = append(plans, plan)
-			continue
-		}
-		// テーブルの場合
-		plan, err := NewTablePlan(tx, tableName, qp.mdm)
+	refs, err := tableRefs(qp.mdm, querydata, tx)
+	if err != nil {
+		return nil, err
+	}
+	names := exposedNames(refs)
+
+	plans := make([]Plan, 0, 5)
+
+	// Step 1: テーブルに対するPlanの作成。別名を付けた表と導出表の列は、問合せの中での列名で出力する
+	schema := record.NewSchema()
+	for _, ref := range refs {
+		plan, err := refPlan(qp, qp.mdm, ref, names, tx)
 		if err != nil {
 			return nil, err
 		}
 		plans = append(plans, plan)
+		schema.AddAll(plan.Schema())
+	}
+
+	// 副問合せの計画を作成し、等号だけで相関する IN と EXISTS は準結合にする
+	if err := planSubqueries(qp, qp.mdm, querydata, schema, names, tx); err != nil {
+		return nil, err
 	}
+	pred, semiJoin := decorrelate(tx, querydata.Pred, schema)
 
 	// Step 2: Step1のPlansに対するProduct Planを生成
+	// 外部結合があれば、最初の外部結合より前の表の積をとり、残りの表は FROM句の順に1つずつ結合する
+	first := firstOuterJoin(querydata)
 	result = plans[0]
-	for _, plan := range plans[1:] {
+	for _, plan := range plans[1:first] {
 		result, err = NewProductPlan(result, plan)
 		if err != nil {
 			return nil, err
@@ -65,13 +69,51 @@ func (qp *BasicQueryPlanner) CreatePlan(querydata *parse.QueryData, tx *tx.Trans
 	}
 
 	// Step 3: Step2の結果に Pred を適用したSelect Planを生成
-	result, err = NewSelectPlan(result, querydata.Pred)
+	if first == len(plans) {
+		result, err = NewSelectPlan(result, pred)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result, err = qp.joinOuter(querydata, plans, first, pred, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result = semiJoin(result)
+
+	// Step 4: AS を付けた列を計算し、指定フィールドを取り出すProjection Planを生成
+	// DISTINCT, ORDER BY と LIMIT もここで適用する
+	return projectPlan(tx, result, querydata)
+}
+
+// joinOuter 最初の外部結合より前の表の積 result に、残りの表を FROM句の順に入れ子ループ結合する
+// 述語 pred の項は、参照する列が揃った段で適用する
+func (qp *BasicQueryPlanner) joinOuter(querydata *parse.QueryData, plans []Plan, first int, pred *query.Predicate, result Plan) (Plan, error) {
+	schemas := make([]*record.Schema, len(plans))
+	for i, plan := range plans {
+		schemas[i] = plan.Schema()
+	}
+	steps, rest := placeTerms(querydata, pred, schemas)
+	firstPred := query.NewPredicate()
+	for _, step := range steps[:first] {
+		firstPred.ConjoinWith(step)
+	}
+	result, err := addSelect(result, firstPred)
 	if err != nil {
 		return nil, err
 	}
 
-	// Step 4: 指定フィールドを取り出すProjection Planを生成
-	result, err = NewProjectPlan(result, querydata.Fields)
-
-	return result, err
+	for i := first; i < len(plans); i++ {
+		if j := querydata.Join(querydata.Tables[i]); j != nil {
+			lhs, rhs, joinType := outerJoinSides(result, plans[i], j)
+			result = NewNestedLoopJoinPlan(lhs, rhs, j.On, joinType)
+		} else if result, err = NewProductPlan(result, plans[i]); err != nil {
+			return nil, err
+		}
+		if result, err = addSelect(result, steps[i]); err != nil {
+			return nil, err
+		}
+	}
+	return addSelect(result, rest)
 }
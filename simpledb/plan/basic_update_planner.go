@@ -19,6 +19,10 @@ func NewBasicUpdatePlanner(mdm *metadata.Manager) *BasicUpdatePlanner {
 }
 
 func (up *BasicUpdatePlanner) ExecuteInsert(data *parse.InsertData, tx *tx.Transaction) (int, error) {
+	data, err := insertOnView(up.mdm, data, tx)
+	if err != nil {
+		return 0, err
+	}
 	tablePlan, err := NewTablePlan(tx, data.TableName, up.mdm)
 	if err != nil {
 		return 0, err
@@ -33,31 +37,65 @@ func (up *BasicUpdatePlanner) ExecuteInsert(data *parse.InsertData, tx *tx.Trans
 	if !ok {
 		return 0, errors.New("ExecuteInsert: plan is not a table plan")
 	}
+	cc, err := loadColumnConstraints(up.mdm, tablePlan, tx)
+	if err != nil {
+		return 0, err
+	}
 	if err := updateScan.Insert(); err != nil {
 		return 0, err
 	}
+	if err := cc.setInsertValues(updateScan, data); err != nil {
+		return 0, err
+	}
+	if err := cc.checkInsert(updateScan); err != nil {
+		return 0, err
+	}
 
-	for i, field := range data.Fields {
-		val := data.Values[i]
-		if err := updateScan.SetVal(field, val); err != nil {
-			return 0, err
-		}
+	indexes, err := up.mdm.GetIndexInfo(data.TableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkInsert(data.TableName, updateScan, uniqueIndexes(indexes, ""), scanKeyFinder(tablePlan)); err != nil {
+		return 0, err
+	}
+	ri, err := newReferentialIntegrity(up, up.mdm, data.TableName, tx, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := ri.checkInsert(updateScan); err != nil {
+		return 0, err
 	}
 	return 1, nil
 }
 
 func (up *BasicUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Transaction) (int, error) {
+	data, err := deleteOnView(up.mdm, data, tx)
+	if err != nil {
+		return 0, err
+	}
 	tableName := data.TableName
 	tablePlan, err := NewTablePlan(tx, tableName, up.mdm)
 	if err != nil {
 		return 0, err
 	}
+	// 副問合せは表のレコードごとに評価する
+	if err := bindSubqueries(NewBasicQueryPlanner(up.mdm), up.mdm, data.Pred, nil, tablePlan.Schema(), tableNames(data.TableName, tablePlan.Schema()), tx); err != nil {
+		return 0, err
+	}
 
 	selectPlan, err := NewSelectPlan(tablePlan, data.Pred)
 	if err != nil {
 		return 0, err
 	}
 
+	ri, err := newReferentialIntegrity(up, up.mdm, tableName, tx, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := ri.checkDelete(selectPlan); err != nil {
+		return 0, err
+	}
+
 	scan, err := selectPlan.Open()
 	if err != nil {
 		return 0, err
@@ -76,25 +114,63 @@ func (up *BasicUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Trans
 			break
 		}
 
+		// 参照動作は削除した後に行うため、参照されている値を先に読んでおく
+		keys, err := ri.referencedKeys(scan)
+		if err != nil {
+			return 0, err
+		}
 		if err := updateScan.Delete(); err != nil {
 			return 0, err
 		}
+		if err := ri.onDelete(keys); err != nil {
+			return 0, err
+		}
 		count++
 	}
 	return count, nil
 }
 
 func (up *BasicUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Transaction) (int, error) {
+	data, err := modifyOnView(up.mdm, data, tx)
+	if err != nil {
+		return 0, err
+	}
 	tablePlan, err := NewTablePlan(tx, data.TableName, up.mdm)
 	if err != nil {
 		return 0, err
 	}
+	// 副問合せは表のレコードごとに評価する
+	if err := bindSubqueries(NewBasicQueryPlanner(up.mdm), up.mdm, data.Pred, []*query.Expression{data.NewValue}, tablePlan.Schema(), tableNames(data.TableName, tablePlan.Schema()), tx); err != nil {
+		return 0, err
+	}
 
 	selectPlan, err := NewSelectPlan(tablePlan, data.Pred)
 	if err != nil {
 		return 0, err
 	}
 
+	indexes, err := up.mdm.GetIndexInfo(data.TableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	cc, err := loadColumnConstraints(up.mdm, tablePlan, tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := cc.checkModify(data, selectPlan); err != nil {
+		return 0, err
+	}
+	if err := checkModify(data, selectPlan, uniqueIndexes(indexes, data.TargetField), scanKeyFinder(tablePlan)); err != nil {
+		return 0, err
+	}
+	ri, err := newReferentialIntegrity(up, up.mdm, data.TableName, tx, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := ri.checkModify(data, selectPlan); err != nil {
+		return 0, err
+	}
+
 	scan, err := selectPlan.Open()
 	if err != nil {
 		return 0, err
@@ -128,23 +204,51 @@ func (up *BasicUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Trans
 }
 
 func (up *BasicUpdatePlanner) ExecuteCreateTable(data *parse.CreateTableData, tx *tx.Transaction) (int, error) {
-	tableName := data.TableName
-	schema := data.NewSchema
-	err := up.mdm.CreateTable(tableName, schema, tx)
+	err := createTable(up.mdm, data, tx)
 	return 0, err
 }
 
 func (up *BasicUpdatePlanner) ExecuteCreateView(data *parse.CreateViewData, tx *tx.Transaction) (int, error) {
-	viewName := data.ViewName
-	viewDef := data.ViewDef()
-	err := up.mdm.CreateView(viewName, viewDef, tx)
+	err := createView(up.mdm, data, tx)
 	return 0, err
 }
 
 func (up *BasicUpdatePlanner) ExecuteCreateIndex(data *parse.CreateIndexData, tx *tx.Transaction) (int, error) {
-	indexName := data.IndexName
-	tableName := data.TableName
-	fieldName := data.FieldName
-	err := up.mdm.CreateIndex(indexName, tableName, fieldName, tx)
+	err := createIndex(up.mdm, data, tx, false)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteDropTable(data *parse.DropTableData, tx *tx.Transaction) (int, error) {
+	err := dropTable(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteDropView(data *parse.DropViewData, tx *tx.Transaction) (int, error) {
+	err := dropView(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteDropIndex(data *parse.DropIndexData, tx *tx.Transaction) (int, error) {
+	err := dropIndex(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteAlterTable(data *parse.AlterTableData, tx *tx.Transaction) (int, error) {
+	err := alterTable(up.mdm, data, tx, false)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteVacuum(data *parse.VacuumData, tx *tx.Transaction) (int, error) {
+	err := vacuum(up.mdm, data, tx, false)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteReindex(data *parse.ReindexData, tx *tx.Transaction) (int, error) {
+	err := reindex(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *BasicUpdatePlanner) ExecuteCheckIndex(data *parse.CheckIndexData, tx *tx.Transaction) (int, error) {
+	err := checkIndexes(up.mdm, data, tx)
 	return 0, err
 }
@@ -0,0 +1,165 @@
+package plan
+
+import (
+	"cmp"
+	"fmt"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+	"strings"
+)
+
+// IndexProblemKind 表と索引の不整合の種類
+type IndexProblemKind string
+
+const (
+	// IndexEntryMissing 表のレコードを指すエントリが索引にない
+	IndexEntryMissing IndexProblemKind = "missing"
+	// IndexEntryDuplicated 表のレコードを指すエントリが索引に2つ以上ある
+	IndexEntryDuplicated IndexProblemKind = "duplicated"
+	// IndexEntryDangling 索引のエントリが表にないレコードを指すか、指すレコードと異なるキーを持つ
+	IndexEntryDangling IndexProblemKind = "dangling"
+)
+
+// IndexProblem 索引で見つかった不整合。Key は missing と duplicated ではレコードのキー、dangling ではエントリのキー
+type IndexProblem struct {
+	IndexName string
+	Kind      IndexProblemKind
+	RID       *record.RID
+	Key       *query.Constant
+}
+
+func (p *IndexProblem) String() string {
+	return fmt.Sprintf("index %s: %s entry with key %s for %s", p.IndexName, p.Kind, p.Key, p.RID)
+}
+
+// IndexCheckError CHECK INDEX文と CHECK TABLE文で、索引に不整合が見つかったことを表すエラー
+type IndexCheckError struct {
+	Problems []*IndexProblem
+}
+
+func (e *IndexCheckError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return fmt.Sprintf("found %d index problems; run REINDEX to rebuild the index:\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+// CheckIndexes 表 tableName の全ての索引を checkIndex で検査し、見つかった不整合を索引の名前の順に返す
+func CheckIndexes(mdm *metadata.Manager, tableName string, tx *tx.Transaction) ([]*IndexProblem, error) {
+	return findIndexProblems(mdm, "", tableName, tx)
+}
+
+// checkIndexes CHECK文で指定された索引、または表の全ての索引を検査し、不整合があれば IndexCheckError を返す
+func checkIndexes(mdm *metadata.Manager, data *parse.CheckIndexData, tx *tx.Transaction) error {
+	problems, err := findIndexProblems(mdm, data.IndexName, data.TableName, tx)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return &IndexCheckError{Problems: problems}
+	}
+	return nil
+}
+
+// findIndexProblems 索引 indexName、indexName が空なら表 tableName の全ての索引を、名前の順に checkIndex で検査する
+func findIndexProblems(mdm *metadata.Manager, indexName string, tableName string, tx *tx.Transaction) ([]*IndexProblem, error) {
+	tableName, indexes, err := targetIndexes(mdm, indexName, tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := mdm.GetLayout(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	var problems []*IndexProblem
+	for _, ii := range indexes {
+		found, err := checkIndex(tableName, layout, ii, tx)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, found...)
+	}
+	return problems, nil
+}
+
+// checkIndex 表の各レコードを、そのキーで指すエントリが索引 ii にちょうど1つずつあり、それ以外のエントリがないことを検査する
+// 索引の全てのエントリを RID ごとにまとめてから表を走査し、レコードごとにエントリと突き合わせる
+// 見つかった不整合は、表のレコードの順に missing と duplicated を、その後に残ったエントリを RID の順に返す
+func checkIndex(tableName string, layout *record.Layout, ii *metadata.IndexInfo, tx *tx.Transaction) ([]*IndexProblem, error) {
+	idx, err := ii.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+	// entries レコードの RID ごとに、そのレコードを指すエントリのキー
+	entries := make(map[record.RID][]*query.Constant)
+	err = idx.ForEach(func(key *query.Constant, rid *record.RID) error {
+		entries[*rid] = append(entries[*rid], key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []*IndexProblem
+	report := func(kind IndexProblemKind, rid *record.RID, key *query.Constant) {
+		problems = append(problems, &IndexProblem{IndexName: ii.IndexName(), Kind: kind, RID: rid, Key: key})
+	}
+	ts, err := query.NewTableScan(tx, tableName, layout)
+	if err != nil {
+		return nil, err
+	}
+	defer ts.Close()
+	for {
+		next, err := ts.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			break
+		}
+		rid, err := ts.GetRID()
+		if err != nil {
+			return nil, err
+		}
+		key, err := ii.KeyOf(ts)
+		if err != nil {
+			return nil, err
+		}
+		matched := 0
+		for _, entryKey := range entries[*rid] {
+			if entryKey.Equals(key) {
+				matched++
+			} else {
+				report(IndexEntryDangling, rid, entryKey)
+			}
+		}
+		switch {
+		case matched == 0:
+			report(IndexEntryMissing, rid, key)
+		case matched > 1:
+			report(IndexEntryDuplicated, rid, key)
+		}
+		delete(entries, *rid)
+	}
+
+	// 残ったエントリは、表にないレコードを指す
+	rids := make([]record.RID, 0, len(entries))
+	for rid := range entries {
+		rids = append(rids, rid)
+	}
+	slices.SortFunc(rids, func(a, b record.RID) int {
+		return cmp.Or(cmp.Compare(a.BlockNumber(), b.BlockNumber()), cmp.Compare(a.Slot(), b.Slot()))
+	})
+	for _, rid := range rids {
+		for _, key := range entries[rid] {
+			report(IndexEntryDangling, &rid, key)
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,286 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+)
+
+// fieldConstraintDefs CREATE TABLE文の NOT NULL, DEFAULT, CHECK 制約を検証し、fldcat に格納する形にする
+// PRIMARY KEY の列は暗黙に NOT NULL になる
+func fieldConstraintDefs(data *parse.CreateTableData) (map[string]*metadata.FieldConstraint, error) {
+	result := make(map[string]*metadata.FieldConstraint)
+	def := func(fieldName string) *metadata.FieldConstraint {
+		if _, ok := result[fieldName]; !ok {
+			result[fieldName] = &metadata.FieldConstraint{}
+		}
+		return result[fieldName]
+	}
+
+	for _, fieldName := range data.NewSchema.Fields() {
+		c, ok := data.Columns[fieldName]
+		if !ok {
+			continue
+		}
+		if c.NotNull {
+			def(fieldName).NotNull = true
+		}
+		if c.Default != nil && !c.Default.IsNull() {
+			if err := checkFieldValue(data.NewSchema, fieldName, c.Default); err != nil {
+				return nil, fmt.Errorf("invalid default value for %q: %w", fieldName, err)
+			}
+			def(fieldName).Default = c.Default.String()
+		}
+		if c.Check != nil {
+			if len(c.Check.Subqueries()) > 0 {
+				return nil, fmt.Errorf("check constraint of %q cannot contain a subquery: %s", fieldName, c.Check)
+			}
+			if !c.Check.AppliesTo(data.NewSchema) {
+				return nil, fmt.Errorf("check constraint of %q refers to a column not in %s: %s", fieldName, data.TableName, c.Check)
+			}
+			def(fieldName).Check = c.Check.String()
+		}
+	}
+	for fieldName := range data.Columns {
+		if !data.NewSchema.HasField(fieldName) {
+			return nil, fmt.Errorf("column %q does not exist in %s", fieldName, data.TableName)
+		}
+	}
+	for _, key := range data.Keys {
+		if !key.PrimaryKey {
+			continue
+		}
+		for _, fieldName := range key.FieldNames {
+			def(fieldName).NotNull = true
+		}
+	}
+	return result, nil
+}
+
+// checkFieldValue val を列 fieldName に格納できるか
+func checkFieldValue(schema *record.Schema, fieldName string, val *query.Constant) error {
+	switch schema.Type(fieldName) {
+	case record.INT:
+		if _, err := val.AsInt(); err != nil {
+			return fmt.Errorf("%s is not an integer", val)
+		}
+	case record.VARCHAR:
+		sval, err := val.AsString()
+		if err != nil {
+			return fmt.Errorf("%s is not a string", val)
+		}
+		if int32(len(sval)) > schema.Length(fieldName) {
+			return fmt.Errorf("%s is longer than %d", val, schema.Length(fieldName))
+		}
+	}
+	return nil
+}
+
+// columnConstraints 表の列の NOT NULL, DEFAULT, CHECK 制約
+type columnConstraints struct {
+	tableName string
+	layout    *record.Layout
+	notNull   []string
+	defaults  map[string]*query.Constant
+	checks    []columnCheck
+}
+
+type columnCheck struct {
+	fieldName string
+	pred      *query.Predicate
+}
+
+// loadColumnConstraints fldcat に文字列で格納された制約を構文解析する
+func loadColumnConstraints(mdm *metadata.Manager, tablePlan *TablePlan, tx *tx.Transaction) (*columnConstraints, error) {
+	defs, err := mdm.GetFieldConstraints(tablePlan.tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	cc := &columnConstraints{
+		tableName: tablePlan.tableName,
+		layout:    tablePlan.layout,
+		defaults:  make(map[string]*query.Constant),
+	}
+	for _, fieldName := range tablePlan.Schema().Fields() {
+		def, ok := defs[fieldName]
+		if !ok {
+			continue
+		}
+		if def.NotNull {
+			cc.notNull = append(cc.notNull, fieldName)
+		}
+		if def.Default != "" {
+			parser, err := parse.NewParser(def.Default)
+			if err != nil {
+				return nil, err
+			}
+			val, err := parser.Constant()
+			if err != nil {
+				return nil, fmt.Errorf("default value of %q: %w", fieldName, err)
+			}
+			cc.defaults[fieldName] = val
+		}
+		if def.Check != "" {
+			pred, err := parseCheck(fieldName, def.Check)
+			if err != nil {
+				return nil, err
+			}
+			cc.checks = append(cc.checks, columnCheck{fieldName, pred})
+		}
+	}
+	return cc, nil
+}
+
+// setInsertValues 挿入したばかりのレコードに INSERT文の値と省略された列の既定値を設定する
+// 値を設定できなければ (長すぎる文字列や型の違いなど)、途中まで設定したレコードを削除する
+func (cc *columnConstraints) setInsertValues(updateScan query.UpdateScan, data *parse.InsertData) error {
+	var err error
+	for i := 0; err == nil && i < len(data.Fields); i++ {
+		err = updateScan.SetVal(data.Fields[i], data.Values[i])
+	}
+	if err == nil {
+		err = cc.fillDefaults(updateScan, data)
+	}
+	if err != nil {
+		if delErr := updateScan.Delete(); delErr != nil {
+			return delErr
+		}
+		return err
+	}
+	return nil
+}
+
+// fillDefaults INSERT文で省略された列に既定値を設定する。既定値がなければ NULL になる
+func (cc *columnConstraints) fillDefaults(updateScan query.UpdateScan, data *parse.InsertData) error {
+	for _, fieldName := range cc.layout.Schema().Fields() {
+		if slices.Contains(data.Fields, fieldName) {
+			continue
+		}
+		val, ok := cc.defaults[fieldName]
+		if !ok {
+			// NULL を格納できない列はゼロ値のままにする
+			if cc.layout.NullMask(fieldName) == 0 {
+				continue
+			}
+			val = query.NewNullConstant()
+		}
+		if err := updateScan.SetVal(fieldName, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check s の現在のレコードが NOT NULL と CHECK 制約を満たすか
+// CHECK 制約の述語が NULL との比較によって真偽不明になる場合は、制約を満たすものとみなす
+func (cc *columnConstraints) check(s query.Scan) error {
+	for _, fieldName := range cc.notNull {
+		val, err := s.GetVal(fieldName)
+		if err != nil {
+			return err
+		}
+		if val.IsNull() {
+			return &metadata.ConstraintViolationError{
+				Type:       metadata.ConstraintNotNull,
+				TableName:  cc.tableName,
+				Constraint: fmt.Sprintf("%s_%s_not_null", cc.tableName, fieldName),
+				FieldNames: []string{fieldName},
+				Value:      val.String(),
+				Detail:     fmt.Sprintf("null value in column %q", fieldName),
+			}
+		}
+	}
+	for _, c := range cc.checks {
+		ok, err := c.pred.IsNotFalse(s)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		val, err := s.GetVal(c.fieldName)
+		if err != nil {
+			return err
+		}
+		return &metadata.ConstraintViolationError{
+			Type:       metadata.ConstraintCheck,
+			TableName:  cc.tableName,
+			Constraint: fmt.Sprintf("%s_%s_check", cc.tableName, c.fieldName),
+			FieldNames: []string{c.fieldName},
+			Value:      val.String(),
+			Detail:     fmt.Sprintf("value %s of column %q fails CHECK (%s)", val, c.fieldName, c.pred),
+		}
+	}
+	return nil
+}
+
+// checkInsert 挿入したばかりのレコードが制約に違反しないか調べ、違反していればレコードを削除する
+func (cc *columnConstraints) checkInsert(updateScan query.UpdateScan) error {
+	if err := cc.check(updateScan); err != nil {
+		if delErr := updateScan.Delete(); delErr != nil {
+			return delErr
+		}
+		return err
+	}
+	return nil
+}
+
+// checkModify UPDATE文が制約に違反しないか、レコードを更新する前に調べる
+func (cc *columnConstraints) checkModify(data *parse.ModifyData, selectPlan Plan) error {
+	if !slices.Contains(cc.notNull, data.TargetField) && len(cc.checks) == 0 {
+		return nil
+	}
+	scan, err := selectPlan.Open()
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+	for {
+		if hasNext, err := scan.Next(); err != nil {
+			return err
+		} else if !hasNext {
+			break
+		}
+
+		newVal, err := data.NewValue.Evaluate(scan)
+		if err != nil {
+			return err
+		}
+		if err := cc.check(&modifiedScan{scan, data.TargetField, newVal}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modifiedScan 列 fieldName の値が val に更新された後のレコードとして振る舞う
+type modifiedScan struct {
+	query.Scan
+	fieldName string
+	val       *query.Constant
+}
+
+func (s *modifiedScan) GetVal(fieldName string) (*query.Constant, error) {
+	if fieldName == s.fieldName {
+		return s.val, nil
+	}
+	return s.Scan.GetVal(fieldName)
+}
+
+func (s *modifiedScan) GetInt(fieldName string) (int32, error) {
+	if fieldName == s.fieldName {
+		return s.val.AsInt()
+	}
+	return s.Scan.GetInt(fieldName)
+}
+
+func (s *modifiedScan) GetString(fieldName string) (string, error) {
+	if fieldName == s.fieldName {
+		return s.val.AsString()
+	}
+	return s.Scan.GetString(fieldName)
+}
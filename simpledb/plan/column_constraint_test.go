@@ -0,0 +1,141 @@
+package plan_test
+
+import (
+	"errors"
+	"path"
+	"simpledb/metadata"
+	"simpledb/plan"
+	"simpledb/record"
+	"simpledb/server"
+	"simpledb/tx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnConstraints(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "column_constraint_test"))
+			require.NoError(t, err)
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			testColumnConstraints(t, simpleDB.Planner(), simpleDB.MetadataManager(), tx)
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+func TestInsertInvalidValue(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "insert_invalid_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			require.NoError(t, exec("create table gadget (gid int primary key, label varchar(5) not null, qty int default 1)"))
+			require.NoError(t, exec("insert into gadget (gid, label, qty) values (1, 'ok', 2)"))
+			require.NoError(t, tx.Commit())
+
+			// 値を設定できなかったレコードは、明示的なトランザクションをコミットしても残らない
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.ErrorIs(t, exec("insert into gadget (gid, label, qty) values (2, 'toolong', 3)"), record.ErrStringTooLong)
+			assert.Error(t, exec("insert into gadget (gid, label, qty) values ('x', 'ok', 3)"))
+			assert.Error(t, exec("insert into gadget (gid, label) values (3, 4)"))
+			require.NoError(t, exec("insert into gadget (gid, label) values (2, 'two')"))
+			require.NoError(t, tx.Commit())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, []int32{1, 2}, queryInts(t, planner, tx, "select gid from gadget order by gid"))
+			assert.Equal(t, []int32{2, 1}, queryInts(t, planner, tx, "select qty from gadget order by gid"))
+			require.NoError(t, exec("reindex table gadget"))
+			require.NoError(t, exec("check table gadget"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+func testColumnConstraints(t *testing.T, planner *plan.Planner, mdm *metadata.Manager, tx *tx.Transaction) {
+	exec := func(cmd string) error {
+		_, err := planner.ExecuteUpdate(cmd, tx)
+		return err
+	}
+	assertViolation := func(err error, wantType metadata.ConstraintType, wantConstraint string) {
+		t.Helper()
+		var cve *metadata.ConstraintViolationError
+		if assert.True(t, errors.As(err, &cve), "expected constraint violation, but got %v", err) {
+			assert.Equal(t, wantType, cve.Type)
+			assert.Equal(t, wantConstraint, cve.Constraint)
+		}
+	}
+	queryRow := func(q string, fields ...string) []string {
+		t.Helper()
+		p, err := planner.CreateQueryPlan(q, tx)
+		require.NoError(t, err)
+		s, err := p.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		next, err := s.Next()
+		require.NoError(t, err)
+		require.True(t, next, "no rows for %q", q)
+		var vals []string
+		for _, fieldName := range fields {
+			val, err := s.GetVal(fieldName)
+			require.NoError(t, err)
+			vals = append(vals, val.String())
+		}
+		return vals
+	}
+
+	require.NoError(t, exec("create table student (sid int primary key, sname varchar(10) not null default 'anon', status varchar(8) default 'active' check (status = 'active'), gradyear int null)"))
+
+	// 制約は fldcat に記録される
+	constraints, err := mdm.GetFieldConstraints("student", tx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*metadata.FieldConstraint{
+		"sid":    {NotNull: true},
+		"sname":  {NotNull: true, Default: "'anon'"},
+		"status": {Default: "'active'", Check: "status = 'active'"},
+	}, constraints)
+
+	// 省略した列は既定値、既定値がなければ NULL になる
+	require.NoError(t, exec("insert into student (sid) values (1)"))
+	assert.Equal(t, []string{"'anon'", "'active'", "NULL"}, queryRow("select sname, status, gradyear from student where sid = 1", "sname", "status", "gradyear"))
+	require.NoError(t, exec("insert into student (sid, sname, gradyear) values (2, 'joe', 2020)"))
+	assert.Equal(t, []string{"'joe'", "'active'", "2020"}, queryRow("select sname, status, gradyear from student where sid = 2", "sname", "status", "gradyear"))
+	// CHECK 制約は NULL を許す
+	require.NoError(t, exec("insert into student (sid, status) values (3, NULL)"))
+
+	assertViolation(exec("insert into student (sid, sname) values (4, NULL)"), metadata.ConstraintNotNull, "student_sname_not_null")
+	assertViolation(exec("insert into student (sname) values ('amy')"), metadata.ConstraintNotNull, "student_sid_not_null")
+	assertViolation(exec("insert into student (sid, status) values (4, 'retired')"), metadata.ConstraintCheck, "student_status_check")
+	// 違反したレコードは残らない
+	assert.Empty(t, queryInts(t, planner, tx, "select sid from student where sid = 4"))
+
+	assertViolation(exec("update student set sname = NULL where sid = 2"), metadata.ConstraintNotNull, "student_sname_not_null")
+	assertViolation(exec("update student set status = 'retired'"), metadata.ConstraintCheck, "student_status_check")
+	// 違反した文はどの行も更新しない
+	assert.Equal(t, []string{"'active'"}, queryRow("select status from student where sid = 1", "status"))
+	require.NoError(t, exec("update student set gradyear = NULL where sid = 2"))
+	require.NoError(t, exec("update student set status = NULL where sid = 1"))
+
+	assert.Error(t, exec("create table bad (a int default 'x')"))
+	assert.Error(t, exec("create table bad (a varchar(2) default 'long')"))
+	assert.Error(t, exec("create table bad (a int check (b = 1))"))
+}
@@ -0,0 +1,309 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"simpledb/index"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+	"strings"
+)
+
+// createTable 表と、PRIMARY KEY や UNIQUE 制約を裏付ける索引を作成し、列の制約と外部キーをカタログに記録する
+func createTable(mdm *metadata.Manager, data *parse.CreateTableData, tx *tx.Transaction) error {
+	primaryKeys := 0
+	for _, key := range data.Keys {
+		if key.PrimaryKey {
+			primaryKeys++
+		}
+		for i, fieldName := range key.FieldNames {
+			if !data.NewSchema.HasField(fieldName) {
+				return fmt.Errorf("key column %q does not exist in %s", fieldName, data.TableName)
+			}
+			if slices.Contains(key.FieldNames[:i], fieldName) {
+				return fmt.Errorf("key column %q appears twice", fieldName)
+			}
+		}
+	}
+	if primaryKeys > 1 {
+		return fmt.Errorf("multiple primary keys for table %s are not allowed", data.TableName)
+	}
+	if err := checkNotRemoved(tx, data.TableName+".tbl"); err != nil {
+		return err
+	}
+	fieldConstraints, err := fieldConstraintDefs(data)
+	if err != nil {
+		return err
+	}
+	fks, err := foreignKeyDefs(mdm, data, tx)
+	if err != nil {
+		return err
+	}
+
+	if err := mdm.CreateTableWithConstraints(data.TableName, data.NewSchema, data.Format, fieldConstraints, tx); err != nil {
+		return err
+	}
+	uniques := 0
+	for _, key := range data.Keys {
+		constraint := metadata.ConstraintPrimaryKey
+		suffix := "pkey"
+		if !key.PrimaryKey {
+			constraint = metadata.ConstraintUnique
+			uniques++
+			suffix = fmt.Sprintf("key%d", uniques)
+		}
+		indexName := keyIndexName(data.TableName, suffix)
+		if err := checkNotRemoved(tx, metadata.IndexFileNames(indexName, metadata.IndexTypeBTree)...); err != nil {
+			return err
+		}
+		if err := mdm.CreateKeyIndex(indexName, data.TableName, key.FieldNames, constraint, tx); err != nil {
+			return err
+		}
+	}
+	for _, fk := range fks {
+		if err := mdm.CreateForeignKey(fk, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyIndexName 制約を裏付ける索引の名前。カタログに収まるよう表名を切り詰める
+func keyIndexName(tableName string, suffix string) string {
+	if n := metadata.MaxName - len(suffix) - 1; len(tableName) > n {
+		tableName = tableName[:n]
+	}
+	return tableName + "_" + suffix
+}
+
+// uniqueIndexes 一意性制約を裏付ける索引のうち fieldName を含むもの。fieldName が空なら全て返す
+func uniqueIndexes(indexes map[string]*metadata.IndexInfo, fieldName string) []*metadata.IndexInfo {
+	var result []*metadata.IndexInfo
+	for _, ii := range indexes {
+		if !ii.Constraint().IsUnique() {
+			continue
+		}
+		if fieldName != "" && !slices.Contains(ii.FieldNames(), fieldName) {
+			continue
+		}
+		result = append(result, ii)
+	}
+	slices.SortFunc(result, func(a, b *metadata.IndexInfo) int {
+		return strings.Compare(a.IndexName(), b.IndexName())
+	})
+	return result
+}
+
+// keyedRecord 挿入・更新した後のレコードのキー
+type keyedRecord struct {
+	rid *record.RID
+	key *query.Constant
+}
+
+// keyFinder 索引 ii のキーが key である既存のレコードを探す
+type keyFinder func(ii *metadata.IndexInfo, key *query.Constant) ([]*record.RID, error)
+
+// indexKeyFinder 索引を引いてキーを探す
+func indexKeyFinder(ii *metadata.IndexInfo, key *query.Constant) ([]*record.RID, error) {
+	idx, err := ii.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	if err := idx.BeforeFirst(key); err != nil {
+		return nil, err
+	}
+	var rids []*record.RID
+	for {
+		next, err := idx.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			break
+		}
+		rid, err := idx.GetDataRID()
+		if err != nil {
+			return nil, err
+		}
+		rids = append(rids, rid)
+	}
+	return rids, nil
+}
+
+// scanKeyFinder 表を走査してキーを探す
+// BasicUpdatePlanner は索引を更新しないため、索引の内容は使えない
+// 走査は索引ごとに1度だけ行い、キーのハッシュ値で引けるようにしておく
+func scanKeyFinder(tablePlan Plan) keyFinder {
+	records := make(map[string]map[int32][]keyedRecord)
+	return func(ii *metadata.IndexInfo, key *query.Constant) ([]*record.RID, error) {
+		byHash, ok := records[ii.IndexName()]
+		if !ok {
+			byHash = make(map[int32][]keyedRecord)
+			scan, err := tablePlan.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer scan.Close()
+			updateScan, ok := scan.(query.UpdateScan)
+			if !ok {
+				return nil, errors.New("scanKeyFinder: plan is not a table plan")
+			}
+			for {
+				next, err := scan.Next()
+				if err != nil {
+					return nil, err
+				}
+				if !next {
+					break
+				}
+				k, err := ii.KeyOf(scan)
+				if err != nil {
+					return nil, err
+				}
+				rid, err := updateScan.GetRID()
+				if err != nil {
+					return nil, err
+				}
+				byHash[k.HashCode()] = append(byHash[k.HashCode()], keyedRecord{rid, k})
+			}
+			records[ii.IndexName()] = byHash
+		}
+
+		var rids []*record.RID
+		for _, r := range byHash[key.HashCode()] {
+			if r.key.Equals(key) {
+				rids = append(rids, r.rid)
+			}
+		}
+		return rids, nil
+	}
+}
+
+// checkUnique records のキーが互いに重複せず、records 以外の既存のレコードのキーとも重複しないか調べる
+// records に含まれるレコードの既存のキーは、更新によって置き換わるため重複とはみなさない
+func checkUnique(tableName string, ii *metadata.IndexInfo, records []keyedRecord, find keyFinder) error {
+	updating := make(map[record.RID]struct{}, len(records))
+	for _, r := range records {
+		updating[*r.rid] = struct{}{}
+	}
+	seen := make(map[int32][]*query.Constant, len(records))
+	for _, r := range records {
+		// NULL を含むキーは互いに等しいとはみなさない
+		if r.key.HasNull() {
+			continue
+		}
+		h := r.key.HashCode()
+		for _, k := range seen[h] {
+			if k.Equals(r.key) {
+				return newUniqueViolation(tableName, ii, r.key)
+			}
+		}
+		seen[h] = append(seen[h], r.key)
+
+		rids, err := find(ii, r.key)
+		if err != nil {
+			return err
+		}
+		for _, rid := range rids {
+			if _, ok := updating[*rid]; !ok {
+				return newUniqueViolation(tableName, ii, r.key)
+			}
+		}
+	}
+	return nil
+}
+
+func newUniqueViolation(tableName string, ii *metadata.IndexInfo, key *query.Constant) error {
+	value := key.String()
+	if !key.IsTuple() {
+		value = "(" + value + ")"
+	}
+	return &metadata.ConstraintViolationError{
+		Type:       ii.Constraint(),
+		TableName:  tableName,
+		Constraint: ii.IndexName(),
+		FieldNames: ii.FieldNames(),
+		Value:      value,
+		Detail:     fmt.Sprintf("duplicate key (%s)=%s", strings.Join(ii.FieldNames(), ", "), value),
+	}
+}
+
+// checkInsert 挿入したばかりのレコードが一意性制約に違反しないか調べ、違反していればレコードを削除する
+func checkInsert(tableName string, updateScan query.UpdateScan, uniques []*metadata.IndexInfo, find keyFinder) error {
+	rid, err := updateScan.GetRID()
+	if err != nil {
+		return err
+	}
+	for _, ii := range uniques {
+		key, err := ii.KeyOf(updateScan)
+		if err != nil {
+			return err
+		}
+		if err := checkUnique(tableName, ii, []keyedRecord{{rid, key}}, find); err != nil {
+			if delErr := updateScan.Delete(); delErr != nil {
+				return delErr
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkModify UPDATE文が一意性制約に違反しないか、レコードを更新する前に調べる
+// 文の途中で一時的に重複するだけの更新 (例: set id = id + 1) は違反とはみなさない
+func checkModify(data *parse.ModifyData, selectPlan Plan, uniques []*metadata.IndexInfo, find keyFinder) error {
+	if len(uniques) == 0 {
+		return nil
+	}
+	scan, err := selectPlan.Open()
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+
+	updateScan, ok := scan.(query.UpdateScan)
+	if !ok {
+		return errors.New("checkModify: plan is not a table plan")
+	}
+	records := make([][]keyedRecord, len(uniques))
+	for {
+		if hasNext, err := scan.Next(); err != nil {
+			return err
+		} else if !hasNext {
+			break
+		}
+
+		newVal, err := data.NewValue.Evaluate(scan)
+		if err != nil {
+			return err
+		}
+		rid, err := updateScan.GetRID()
+		if err != nil {
+			return err
+		}
+		for i, ii := range uniques {
+			vals := make([]*query.Constant, len(ii.FieldNames()))
+			for j, fieldName := range ii.FieldNames() {
+				if fieldName == data.TargetField {
+					vals[j] = newVal
+				} else if vals[j], err = scan.GetVal(fieldName); err != nil {
+					return err
+				}
+			}
+			records[i] = append(records[i], keyedRecord{rid, index.MakeKey(vals)})
+		}
+	}
+
+	for i, ii := range uniques {
+		if err := checkUnique(data.TableName, ii, records[i], find); err != nil {
+			return err
+		}
+	}
+	return nil
+}
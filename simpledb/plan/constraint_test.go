@@ -0,0 +1,106 @@
+package plan_test
+
+import (
+	"errors"
+	"path"
+	"simpledb/metadata"
+	"simpledb/plan"
+	"simpledb/server"
+	"simpledb/tx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyConstraints(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "key_constraint_test"))
+			require.NoError(t, err)
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			testKeyConstraints(t, simpleDB.Planner(), simpleDB.MetadataManager(), tx)
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+func testKeyConstraints(t *testing.T, planner *plan.Planner, mdm *metadata.Manager, tx *tx.Transaction) {
+	exec := func(cmd string) error {
+		_, err := planner.ExecuteUpdate(cmd, tx)
+		return err
+	}
+	assertViolation := func(err error, wantType metadata.ConstraintType, wantConstraint string) {
+		t.Helper()
+		var cve *metadata.ConstraintViolationError
+		if assert.True(t, errors.As(err, &cve), "expected constraint violation, but got %v", err) {
+			assert.Equal(t, wantType, cve.Type)
+			assert.Equal(t, wantConstraint, cve.Constraint)
+		}
+	}
+	count := func() int {
+		t.Helper()
+		p, err := planner.CreateQueryPlan("select sid from student", tx)
+		require.NoError(t, err)
+		s, err := p.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		n := 0
+		for {
+			next, err := s.Next()
+			require.NoError(t, err)
+			if !next {
+				return n
+			}
+			n++
+		}
+	}
+
+	require.NoError(t, exec("create table student (sid int primary key, email varchar(20) unique, deptid int, seat int, unique (deptid, seat))"))
+
+	// 制約はカタログに記録される
+	indexes, err := mdm.GetIndexInfo("student", tx)
+	require.NoError(t, err)
+	require.Contains(t, indexes, "sid")
+	assert.Equal(t, "student_pkey", indexes["sid"].IndexName())
+	assert.Equal(t, metadata.ConstraintPrimaryKey, indexes["sid"].Constraint())
+	require.Contains(t, indexes, "email")
+	assert.Equal(t, metadata.ConstraintUnique, indexes["email"].Constraint())
+	require.Contains(t, indexes, metadata.IndexKey([]string{"deptid", "seat"}))
+	assert.Equal(t, metadata.ConstraintUnique, indexes[metadata.IndexKey([]string{"deptid", "seat"})].Constraint())
+
+	require.NoError(t, exec("insert into student (sid, email, deptid, seat) values (1, 'a@example.com', 10, 1)"))
+	require.NoError(t, exec("insert into student (sid, email, deptid, seat) values (2, 'b@example.com', 10, 2)"))
+	require.NoError(t, exec("insert into student (sid, email, deptid, seat) values (3, 'c@example.com', 20, 1)"))
+
+	assertViolation(exec("insert into student (sid, email, deptid, seat) values (1, 'd@example.com', 30, 1)"), metadata.ConstraintPrimaryKey, "student_pkey")
+	assertViolation(exec("insert into student (sid, email, deptid, seat) values (4, 'a@example.com', 30, 1)"), metadata.ConstraintUnique, "student_key1")
+	assertViolation(exec("insert into student (sid, email, deptid, seat) values (4, 'd@example.com', 10, 2)"), metadata.ConstraintUnique, "student_key2")
+	// 違反したレコードは残らない
+	assert.Equal(t, 3, count())
+
+	assertViolation(exec("update student set sid = 2 where sid = 1"), metadata.ConstraintPrimaryKey, "student_pkey")
+	assertViolation(exec("update student set seat = 1 where sid = 2"), metadata.ConstraintUnique, "student_key2")
+	assertViolation(exec("update student set deptid = 10"), metadata.ConstraintUnique, "student_key2")
+	require.NoError(t, exec("update student set seat = 3 where sid = 2"))
+
+	// 削除したキーは再び使える
+	require.NoError(t, exec("delete from student where sid = 1"))
+	require.NoError(t, exec("insert into student (sid, email, deptid, seat) values (1, 'a@example.com', 10, 2)"))
+	assert.Equal(t, 3, count())
+
+	// 文の途中で一時的に重複するだけなら違反ではない
+	require.NoError(t, exec("create table pair (a int unique, b int)"))
+	require.NoError(t, exec("insert into pair (a, b) values (1, 2)"))
+	require.NoError(t, exec("insert into pair (a, b) values (2, 1)"))
+	require.NoError(t, exec("update pair set a = b"))
+	assertViolation(exec("update pair set a = 1"), metadata.ConstraintUnique, "pair_key1")
+
+	assert.Error(t, exec("create table dup (a int primary key, b int, primary key (b))"))
+	assert.Error(t, exec("create table nokey (a int, unique (b))"))
+}
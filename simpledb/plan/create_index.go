@@ -0,0 +1,215 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/index"
+	"simpledb/index/btree"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+)
+
+// createIndex 索引をカタログに登録する。useIndex なら表の既存のレコードから索引のエントリを作る
+func createIndex(mdm *metadata.Manager, data *parse.CreateIndexData, tx *tx.Transaction, useIndex bool) error {
+	indexType := metadata.IndexType(data.IndexType)
+	if err := checkNotRemoved(tx, metadata.IndexFileNames(data.IndexName, indexType)...); err != nil {
+		return err
+	}
+	fillFactor := data.FillFactor
+	switch {
+	case fillFactor == 0:
+		fillFactor = btree.DefaultFillFactor
+	case indexType != metadata.IndexTypeBTree:
+		return fmt.Errorf("index %q: fill factor is only supported by btree indexes", data.IndexName)
+	case fillFactor < btree.MinFillFactor || fillFactor > 100:
+		return fmt.Errorf("index %q: fill factor %d is out of range [%d, 100]", data.IndexName, fillFactor, btree.MinFillFactor)
+	}
+	layout, err := mdm.GetLayout(data.TableName, tx)
+	if err != nil {
+		return err
+	}
+	for _, fieldName := range slices.Concat(data.FieldNames, data.IncludedFields) {
+		if !layout.Schema().HasField(fieldName) {
+			return fmt.Errorf("column %q does not exist in %s", fieldName, data.TableName)
+		}
+	}
+	if err := mdm.CreateIndex(data.IndexName, data.TableName, data.FieldNames, data.IncludedFields, indexType, tx); err != nil {
+		return err
+	}
+	if !useIndex {
+		return nil
+	}
+	indexes, err := mdm.GetIndexInfo(data.TableName, tx)
+	if err != nil {
+		return err
+	}
+	return buildIndex(mdm, data.TableName, indexes[metadata.IndexKey(data.FieldNames)], fillFactor, tx)
+}
+
+// buildIndex 空の索引 ii に、表 tableName の全てのレコードのエントリを作る
+// B-tree 索引はエントリをキーの順に整列してから、葉から順に fillFactor % まで詰めて作る。ハッシュ索引は1件ずつ挿入する
+func buildIndex(mdm *metadata.Manager, tableName string, ii *metadata.IndexInfo, fillFactor int32, tx *tx.Transaction) error {
+	tp, err := NewTablePlan(tx, tableName, mdm)
+	if err != nil {
+		return err
+	}
+	var src Plan = newIndexEntryPlan(tp, ii)
+	if ii.IndexType() == metadata.IndexTypeBTree {
+		if src, err = NewSortPlan(tx, src, index.KeyFields(ii.Layout().Schema())); err != nil {
+			return err
+		}
+	}
+	s, err := src.Open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	idx, err := ii.Open()
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	if bi, ok := idx.(*btree.BTreeIndex); ok {
+		return bi.BulkLoad(s, fillFactor)
+	}
+	keyFields := index.KeyFields(ii.Layout().Schema())
+	for {
+		next, err := s.Next()
+		if err != nil || !next {
+			return err
+		}
+		vals := make([]*query.Constant, len(keyFields))
+		for i, fieldName := range keyFields {
+			if vals[i], err = s.GetVal(fieldName); err != nil {
+				return err
+			}
+		}
+		blockNum, err := s.GetInt(index.FieldBlock)
+		if err != nil {
+			return err
+		}
+		id, err := s.GetInt(index.FieldID)
+		if err != nil {
+			return err
+		}
+		if err := idx.Insert(index.MakeKey(vals), record.NewRID(blockNum, id)); err != nil {
+			return err
+		}
+	}
+}
+
+var _ Plan = (*indexEntryPlan)(nil)
+
+// indexEntryPlan 表の各レコードに対する索引のエントリを、索引のレコードと同じ列で出力する
+// block と id はレコードの RID、dataval の列は索引の列、include の列は包含列の値になる
+type indexEntryPlan struct {
+	plan   *TablePlan
+	schema *record.Schema
+	// fields 出力する列から、表の列への対応。block と id は含まない
+	fields map[string]string
+}
+
+func newIndexEntryPlan(plan *TablePlan, ii *metadata.IndexInfo) *indexEntryPlan {
+	schema := ii.Layout().Schema()
+	fields := make(map[string]string)
+	for i, fieldName := range index.KeyFields(schema) {
+		fields[fieldName] = ii.FieldNames()[i]
+	}
+	for i, fieldName := range index.IncludedFields(schema) {
+		fields[fieldName] = ii.IncludedFieldNames()[i]
+	}
+	return &indexEntryPlan{plan: plan, schema: schema, fields: fields}
+}
+
+func (p *indexEntryPlan) Open() (query.Scan, error) {
+	s, err := p.plan.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &indexEntryScan{ts: s.(*query.TableScan), fields: p.fields}, nil
+}
+
+func (p *indexEntryPlan) BlocksAccessed() int32 {
+	return p.plan.BlocksAccessed()
+}
+
+func (p *indexEntryPlan) RecordsOutput() int32 {
+	return p.plan.RecordsOutput()
+}
+
+func (p *indexEntryPlan) DistinctValues(fieldName string) int32 {
+	if tableField, ok := p.fields[fieldName]; ok {
+		return p.plan.DistinctValues(tableField)
+	}
+	return p.plan.RecordsOutput()
+}
+
+func (p *indexEntryPlan) Schema() *record.Schema {
+	return p.schema
+}
+
+func (p *indexEntryPlan) Tree() *PlanNode {
+	return NewPlanNode("IndexEntry", p, []*PlanNode{p.plan.Tree()})
+}
+
+// indexEntryScan 表のレコードを索引のエントリとして読む
+type indexEntryScan struct {
+	ts     *query.TableScan
+	fields map[string]string
+}
+
+func (s *indexEntryScan) BeforeFirst() error {
+	return s.ts.BeforeFirst()
+}
+
+func (s *indexEntryScan) Next() (bool, error) {
+	return s.ts.Next()
+}
+
+func (s *indexEntryScan) GetInt(fieldName string) (int32, error) {
+	val, err := s.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (s *indexEntryScan) GetString(fieldName string) (string, error) {
+	val, err := s.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (s *indexEntryScan) GetVal(fieldName string) (*query.Constant, error) {
+	switch fieldName {
+	case index.FieldBlock, index.FieldID:
+		rid, err := s.ts.GetRID()
+		if err != nil {
+			return nil, err
+		}
+		if fieldName == index.FieldBlock {
+			return query.NewConstantWithInt(rid.BlockNumber()), nil
+		}
+		return query.NewConstantWithInt(rid.Slot()), nil
+	}
+	tableField, ok := s.fields[fieldName]
+	if !ok {
+		return nil, fmt.Errorf("field %s not found in index entries", fieldName)
+	}
+	return s.ts.GetVal(tableField)
+}
+
+func (s *indexEntryScan) HasField(fieldName string) bool {
+	_, ok := s.fields[fieldName]
+	return ok || fieldName == index.FieldBlock || fieldName == index.FieldID
+}
+
+func (s *indexEntryScan) Close() {
+	s.ts.Close()
+}
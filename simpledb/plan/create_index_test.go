@@ -0,0 +1,114 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/index/btree"
+	"simpledb/record"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateIndexOnPopulatedTable(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "create_index_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			// checkIndexes 最適化する計画では索引を使い、B-tree 索引の木構造が壊れていない
+			checkIndexes := func(q string, wantNode string) {
+				t.Helper()
+				if name != "optimized" {
+					return
+				}
+				assert.Contains(t, planTree(t, planner, tx, q), wantNode)
+				indexes, err := simpleDB.MetadataManager().GetIndexInfo("player", tx)
+				require.NoError(t, err)
+				for _, ii := range indexes {
+					idx, err := ii.Open()
+					require.NoError(t, err)
+					if bi, ok := idx.(*btree.BTreeIndex); ok {
+						assert.NoError(t, bi.Check(), ii.IndexName())
+					}
+					idx.Close()
+				}
+			}
+
+			require.NoError(t, exec("create table player (pid int, team varchar(10), score int)"))
+			for i := 0; i < 300; i++ {
+				team := fmt.Sprintf("'team%02d'", i%20)
+				if i%50 == 0 {
+					team = "null"
+				}
+				require.NoError(t, exec(fmt.Sprintf("insert into player (pid, team, score) values (%d, %s, %d)", i, team, i%7)))
+			}
+			require.NoError(t, tx.Commit())
+
+			// 作成した索引にはロールバックで何も残らず、同じ名前で作り直せる
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec("create index player_pid_idx on player (pid)"))
+			require.NoError(t, tx.Rollback())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec("create index player_pid_idx on player (pid) with (fillfactor = 100)"))
+			require.NoError(t, exec("create index player_team_idx on player (team, score) with (fillfactor = 70)"))
+			require.NoError(t, exec("create index player_score_idx on player (score) using hash"))
+			assert.Error(t, exec("create index player_bad_idx on player (pid, score) using hash with (fillfactor = 70)"))
+			assert.Error(t, exec("create index player_bad_idx on player (score, pid) with (fillfactor = 30)"))
+			require.NoError(t, tx.Commit())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			q := "select pid from player where pid = 123"
+			checkIndexes(q, "\"IndexOnlySelect\"")
+			assert.Equal(t, []int32{123}, queryInts(t, planner, tx, q))
+			q = "select pid from player where team = 'team07'"
+			checkIndexes(q, "\"IndexSelect\"")
+			assert.ElementsMatch(t, []int32{7, 27, 47, 67, 87, 107, 127, 147, 167, 187, 207, 227, 247, 267, 287}, queryInts(t, planner, tx, q))
+			q = "select pid from player where team = 'team07' and score = 2"
+			checkIndexes(q, "IndexSelect")
+			assert.ElementsMatch(t, []int32{107, 247}, queryInts(t, planner, tx, q))
+			q = "select pid from player where score = 6"
+			checkIndexes(q, "\"HashIndexSelect\"")
+			assert.Len(t, queryInts(t, planner, tx, q), 42)
+
+			// 一括で作った索引も、その後の更新で保守される
+			require.NoError(t, exec("delete from player where score = 2"))
+			require.NoError(t, exec("delete from player where pid = 123"))
+			require.NoError(t, exec("insert into player (pid, team, score) values (1000, 'team07', 2)"))
+			checkIndexes(q, "\"HashIndexSelect\"")
+			assert.Len(t, queryInts(t, planner, tx, q), 42)
+			q = "select pid from player where team = 'team07' and score = 2"
+			checkIndexes(q, "IndexSelect")
+			assert.Equal(t, []int32{1000}, queryInts(t, planner, tx, q))
+			assert.Empty(t, queryInts(t, planner, tx, "select pid from player where pid = 123"))
+			require.NoError(t, tx.Commit())
+
+			// ノードに2つ以上のレコードを置けない長いキーの B-tree 索引は作れない
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec("create table doc (did int, body varchar(150))"))
+			require.NoError(t, exec("insert into doc (did, body) values (1, 'hello')"))
+			assert.ErrorIs(t, exec("create index doc_body_idx on doc (body)"), record.ErrRecordTooLarge)
+			assert.ErrorIs(t, exec("create index doc_pair_idx on doc (did) include (body)"), record.ErrRecordTooLarge)
+			require.NoError(t, exec("create index doc_did_idx on doc (did)"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
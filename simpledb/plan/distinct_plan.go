@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+)
+
+var _ Plan = (*DistinctPlan)(nil)
+
+// DistinctPlan p を全ての列でソートし、重複したレコードを除いて返す
+// ソートする列の順は sortFields を先にするので、ORDER BY の順にも並ぶ
+type DistinctPlan struct {
+	p      Plan
+	sp     *SortPlan
+	fields []string
+}
+
+// NewDistinctPlan sortFields は p の列で、残りの列はその後に昇順に並べる。descending[i] が true の列 sortFields[i] は降順に並べる
+func NewDistinctPlan(tx *tx.Transaction, p Plan, sortFields []string, descending []bool) (*DistinctPlan, error) {
+	fields := slices.Clone(sortFields)
+	for _, fieldName := range p.Schema().Fields() {
+		if !slices.Contains(fields, fieldName) {
+			fields = append(fields, fieldName)
+		}
+	}
+	sp, err := NewSortPlanWithOrder(tx, p, fields, descending)
+	if err != nil {
+		return nil, err
+	}
+	return &DistinctPlan{p, sp, fields}, nil
+}
+
+func (dp *DistinctPlan) Open() (query.Scan, error) {
+	s, err := dp.sp.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewDistinctScan(s, dp.fields), nil
+}
+
+func (dp *DistinctPlan) BlocksAccessed() int32 {
+	return dp.sp.BlocksAccessed()
+}
+
+// RecordsOutput 重複がどれだけあるかは分からないので、p のレコード数を上限として見積もる
+func (dp *DistinctPlan) RecordsOutput() int32 {
+	return dp.p.RecordsOutput()
+}
+
+func (dp *DistinctPlan) DistinctValues(fieldName string) int32 {
+	return dp.p.DistinctValues(fieldName)
+}
+
+func (dp *DistinctPlan) Schema() *record.Schema {
+	return dp.p.Schema()
+}
+
+func (dp *DistinctPlan) Tree() *PlanNode {
+	return NewPlanNode("Distinct", dp, []*PlanNode{dp.sp.Tree()})
+}
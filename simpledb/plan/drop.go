@@ -0,0 +1,156 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+// dropTable 表と表の索引、表の外部キーを削除する
+// カタログからはすぐに取り除き、ファイルはコミットした時に削除するので、ロールバックすれば元に戻る
+func dropTable(mdm *metadata.Manager, data *parse.DropTableData, tx *tx.Transaction) error {
+	tableName := data.TableName
+	layout, err := mdm.GetLayout(tableName, tx)
+	if err != nil {
+		return err
+	}
+	if len(layout.Schema().Fields()) == 0 {
+		if data.IfExists {
+			return nil
+		}
+		return fmt.Errorf("table %q does not exist", tableName)
+	}
+
+	// 他の表から参照されている表は削除できない
+	fks, err := mdm.GetReferencingKeys(tableName, tx)
+	if err != nil {
+		return err
+	}
+	for _, fk := range fks {
+		if fk.TableName != tableName {
+			return fmt.Errorf("cannot drop table %s because foreign key %q on %s references it", tableName, fk.Name, fk.TableName)
+		}
+	}
+	// ビューから参照されている表も削除できない
+	defs, err := mdm.GetViewDefs(tx)
+	if err != nil {
+		return err
+	}
+	for viewName, viewDef := range defs {
+		view, err := parseViewDef(viewName, viewDef)
+		if err != nil {
+			return err
+		}
+		if referencesRelation(view, tableName) {
+			return fmt.Errorf("cannot drop table %s because view %q depends on it", tableName, viewName)
+		}
+	}
+
+	indexes, err := mdm.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return err
+	}
+	for _, ii := range indexes {
+		if err := removeIndex(mdm, ii, tx); err != nil {
+			return err
+		}
+	}
+	if err := mdm.DropTable(tableName, tx); err != nil {
+		return err
+	}
+	if err := tx.RemoveOnCommit(tableName + ".tbl"); err != nil {
+		return err
+	}
+	if err := tx.RemoveOnCommit(record.FreeSpaceMapFile(tableName)); err != nil {
+		return err
+	}
+	return tx.RemoveOnCommit(record.OverflowFile(tableName))
+}
+
+// referencesRelation 問合せ data が、導出表や副問合せの中も含めて表かビュー name を参照しているか
+func referencesRelation(data *parse.QueryData, name string) bool {
+	if data.SetOp != nil {
+		return referencesRelation(data.SetOp.Lhs, name) || referencesRelation(data.SetOp.Rhs, name)
+	}
+	for _, ref := range data.Tables {
+		if d, ok := data.Derived[ref]; ok {
+			if referencesRelation(d, name) {
+				return true
+			}
+		} else if data.TableName(ref) == name {
+			return true
+		}
+	}
+	for _, sq := range data.Subqueries() {
+		if referencesRelation(sq.Query.(*parse.QueryData), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropIndex 索引を削除する。制約を裏付ける索引は削除できない
+func dropIndex(mdm *metadata.Manager, data *parse.DropIndexData, tx *tx.Transaction) error {
+	indexName := data.IndexName
+	tableName, err := mdm.GetIndexTable(indexName, tx)
+	if err != nil {
+		return err
+	}
+	if tableName == "" {
+		if data.IfExists {
+			return nil
+		}
+		return fmt.Errorf("index %q does not exist", indexName)
+	}
+
+	indexes, err := mdm.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return err
+	}
+	for _, ii := range indexes {
+		if ii.IndexName() != indexName {
+			continue
+		}
+		if ii.Constraint() != metadata.ConstraintNone {
+			return fmt.Errorf("cannot drop index %s because %s constraint on %s requires it", indexName, ii.Constraint(), tableName)
+		}
+		return removeIndex(mdm, ii, tx)
+	}
+	return fmt.Errorf("index %q does not exist", indexName)
+}
+
+// removeIndex 索引をカタログから取り除き、コミットした時に索引のファイルを削除する
+func removeIndex(mdm *metadata.Manager, ii *metadata.IndexInfo, tx *tx.Transaction) error {
+	if err := mdm.DropIndex(ii.IndexName(), tx); err != nil {
+		return err
+	}
+	for _, filename := range ii.FileNames() {
+		if err := tx.RemoveOnCommit(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropView(mdm *metadata.Manager, data *parse.DropViewData, tx *tx.Transaction) error {
+	dropped, err := mdm.DropView(data.ViewName, tx)
+	if err != nil {
+		return err
+	}
+	if !dropped && !data.IfExists {
+		return fmt.Errorf("view %q does not exist", data.ViewName)
+	}
+	return nil
+}
+
+// checkNotRemoved 同じトランザクションで削除した表や索引と同じ名前のファイルは、コミットすると消えてしまうので作れない
+func checkNotRemoved(tx *tx.Transaction, filenames ...string) error {
+	for _, filename := range filenames {
+		if tx.IsRemovedOnCommit(filename) {
+			return fmt.Errorf("file %s is dropped in this transaction; commit before creating it again", filename)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package plan_test
+
+import (
+	"os"
+	"path"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrop(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			dir := path.Join(t.TempDir(), "drop_test")
+			simpleDB, err := newDB(dir)
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			mdm := simpleDB.MetadataManager()
+			exists := func(filename string) bool {
+				_, err := os.Stat(path.Join(dir, filename))
+				return err == nil
+			}
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			require.NoError(t, exec("create table dept (did int primary key, dname varchar(10))"))
+			require.NoError(t, exec("create table student (sid int primary key, majorid int references dept)"))
+			require.NoError(t, exec("create index student_major on student (majorid)"))
+			require.NoError(t, exec("create view math as select sid from student where majorid = 10"))
+			require.NoError(t, exec("create view major as select dname from dept where did in (select majorid from student)"))
+			require.NoError(t, exec("insert into dept (did, dname) values (10, 'math')"))
+			require.NoError(t, exec("insert into student (sid, majorid) values (1, 10)"))
+			require.NoError(t, tx.Commit())
+
+			// ロールバックすればカタログもファイルも元に戻る
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec("drop view major"))
+			require.NoError(t, exec("drop view math"))
+			require.NoError(t, exec("drop table student"))
+			layout, err := mdm.GetLayout("student", tx)
+			require.NoError(t, err)
+			assert.Empty(t, layout.Schema().Fields())
+			require.NoError(t, tx.Rollback())
+			assert.True(t, exists("student.tbl"))
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, []int32{1}, queryInts(t, planner, tx, "select sid from student"))
+			indexes, err := mdm.GetIndexInfo("student", tx)
+			require.NoError(t, err)
+			assert.Len(t, indexes, 2)
+			viewDef, err := mdm.GetViewDef("math", tx)
+			require.NoError(t, err)
+			assert.NotEmpty(t, viewDef)
+
+			// 参照されている表と、制約を裏付ける索引は削除できない
+			assert.Error(t, exec("drop table dept"))
+			assert.Error(t, exec("drop index student_pkey"))
+			assert.Error(t, exec("drop table nosuch"))
+			assert.Error(t, exec("drop index nosuch"))
+			assert.Error(t, exec("drop view nosuch"))
+			require.NoError(t, exec("drop table if exists nosuch"))
+			require.NoError(t, exec("drop index if exists nosuch"))
+			require.NoError(t, exec("drop view if exists nosuch"))
+
+			// ビューから参照されている表は削除できない。副問合せで参照していても同じ
+			assert.ErrorContains(t, exec("drop table student"), `view "`)
+			require.NoError(t, exec("drop view major"))
+			assert.ErrorContains(t, exec("drop table student"), `view "math"`)
+			require.NoError(t, exec("drop view math"))
+			viewDef, err = mdm.GetViewDef("math", tx)
+			require.NoError(t, err)
+			assert.Empty(t, viewDef)
+
+			require.NoError(t, exec("drop index student_major"))
+			indexes, err = mdm.GetIndexInfo("student", tx)
+			require.NoError(t, err)
+			assert.Len(t, indexes, 1)
+
+			// ファイルはコミットするまで削除されない
+			require.NoError(t, exec("drop table student"))
+			assert.True(t, exists("student.tbl"))
+			// 同じトランザクションでは同じ名前の表を作れない
+			assert.Error(t, exec("create table student (sid int)"))
+			require.NoError(t, tx.Commit())
+			assert.False(t, exists("student.tbl"))
+			assert.False(t, exists("student_pkeyleaf"))
+			assert.False(t, exists("student_pkeydir"))
+			assert.False(t, exists("student_majorleaf"))
+
+			// 参照していた表がなくなれば削除できる
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			fks, err := mdm.GetReferencingKeys("dept", tx)
+			require.NoError(t, err)
+			assert.Empty(t, fks)
+			require.NoError(t, exec("drop table dept"))
+			require.NoError(t, exec("create table student (sid int, sname varchar(10))"))
+			require.NoError(t, exec("insert into student (sid, sname) values (2, 'amy')"))
+			assert.Equal(t, []int32{2}, queryInts(t, planner, tx, "select sid from student"))
+			require.NoError(t, tx.Commit())
+			assert.False(t, exists("dept.tbl"))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package plan_test
+
+import (
+	"path"
+	"simpledb/file"
+	"simpledb/record"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTF8Database(t *testing.T) {
+	dirname := path.Join(t.TempDir(), "utf8_test")
+	simpleDB, err := server.NewOptimizedSimpleDBWithEncoding(dirname, file.UTF8)
+	require.NoError(t, err)
+	planner := simpleDB.Planner()
+
+	tx, err := simpleDB.NewTx()
+	require.NoError(t, err)
+	exec := func(cmd string) error {
+		_, err := planner.ExecuteUpdate(cmd, tx)
+		return err
+	}
+
+	require.NoError(t, exec("create table city (cid int, cname varchar(9), note varchar(100)) using slotted"))
+	require.NoError(t, exec("create table country (cid int, name varchar(9))"))
+	require.NoError(t, exec("create index country_name_idx on country (name)"))
+	require.NoError(t, exec("insert into country (cid, name) values (1, 'Japan')"))
+	// VARCHAR(n) の n は UTF-8 のバイト数
+	require.NoError(t, exec("insert into country (cid, name) values (2, '日本国')"))
+	assert.Error(t, exec("insert into country (cid, name) values (3, '日本国です')"))
+	require.NoError(t, exec("insert into city (cid, cname, note) values (2, '東京', 'とても大きな都市')"))
+
+	// 固定長の VARCHAR(9) は長さと文字列の 13 バイトを使う
+	layout, err := simpleDB.MetadataManager().GetLayout("country", tx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(4+4+13), layout.SlotSize())
+
+	assert.Equal(t, []string{"2"}, queryRows(t, planner, tx, "select cid from country where name = '日本国'"))
+	assert.Equal(t, []string{"'東京'|'とても大きな都市'"}, queryRows(t, planner, tx, "select cname, note from city where cid = 2"))
+	require.NoError(t, tx.Commit())
+
+	// ロールバックすると UTF-8 の文字列も元に戻る
+	tx, err = simpleDB.NewTx()
+	require.NoError(t, err)
+	require.NoError(t, exec("update country set name = 'にほん' where cid = 2"))
+	assert.Equal(t, []string{"'にほん'"}, queryRows(t, planner, tx, "select name from country where cid = 2"))
+	require.NoError(t, tx.Rollback())
+
+	// 開き直しても符号化方式はヘッダから読む
+	simpleDB, err = server.NewOptimizedSimpleDBWithEncoding(dirname, file.UTF16)
+	require.NoError(t, err)
+	assert.Equal(t, file.UTF8, simpleDB.FileManager().Encoding())
+	planner = simpleDB.Planner()
+	tx, err = simpleDB.NewTx()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"'日本国'"}, queryRows(t, planner, tx, "select name from country where cid = 2"))
+	assert.Equal(t, []string{"2"}, queryRows(t, planner, tx, "select cid from country where name = '日本国'"))
+	assert.Equal(t, []string{"'東京'|'とても大きな都市'"}, queryRows(t, planner, tx, "select cname, note from city where cid = 2"))
+	require.NoError(t, tx.Commit())
+}
+
+func TestUTF16Database(t *testing.T) {
+	simpleDB, err := server.NewOptimizedSimpleDBWithEncoding(path.Join(t.TempDir(), "utf16_test"), file.UTF16)
+	require.NoError(t, err)
+	planner := simpleDB.Planner()
+
+	tx, err := simpleDB.NewTx()
+	require.NoError(t, err)
+	exec := func(cmd string) error {
+		_, err := planner.ExecuteUpdate(cmd, tx)
+		return err
+	}
+
+	require.NoError(t, exec("create table town (tid int, tname varchar(3), note varchar(4)) using slotted"))
+	require.NoError(t, exec("create table region (rid int, name varchar(3))"))
+	// VARCHAR(n) の n は UTF-16 の符号単位の数で、UTF-8 で n バイトを超える文字列も確保した大きさに収まれば格納できる
+	require.NoError(t, exec("insert into region (rid, name) values (1, '北海道')"))
+	require.NoError(t, exec("insert into town (tid, tname, note) values (1, '札幌市', '😀😀')"))
+	assert.ErrorIs(t, exec("insert into region (rid, name) values (2, '北海道庁')"), record.ErrStringTooLong)
+	assert.ErrorIs(t, exec("insert into town (tid, tname, note) values (2, '札幌', '😀😀😀')"), record.ErrStringTooLong)
+	assert.ErrorIs(t, exec("update region set name = 'ほっかいどう' where rid = 1"), record.ErrStringTooLong)
+
+	// 固定長の VARCHAR(3) は長さと 3 符号単位の 10 バイトを使う
+	layout, err := simpleDB.MetadataManager().GetLayout("region", tx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(4+4+10), layout.SlotSize())
+
+	assert.Equal(t, []string{"'北海道'"}, queryRows(t, planner, tx, "select name from region"))
+	assert.Equal(t, []string{"'札幌市'|'😀😀'"}, queryRows(t, planner, tx, "select tname, note from town"))
+	require.NoError(t, tx.Commit())
+}
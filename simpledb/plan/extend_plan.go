@@ -0,0 +1,87 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/query"
+	"simpledb/record"
+)
+
+var _ Plan = (*ExtendPlan)(nil)
+
+// ExtendPlan 式 expr で計算する列 fieldName を加える
+type ExtendPlan struct {
+	plan      Plan
+	fieldName string
+	expr      *query.Expression
+	schema    *record.Schema
+}
+
+func NewExtendPlan(p Plan, fieldName string, expr *query.Expression) (*ExtendPlan, error) {
+	schema := record.NewSchema()
+	for _, f := range p.Schema().Fields() {
+		if f != fieldName {
+			schema.Add(f, p.Schema())
+		}
+	}
+	switch {
+	case expr.IsFieldName():
+		if !p.Schema().HasField(expr.AsFieldName()) {
+			return nil, fmt.Errorf("field %q not found", expr.AsFieldName())
+		}
+		schema.AddField(fieldName, p.Schema().Type(expr.AsFieldName()), p.Schema().Length(expr.AsFieldName()))
+	case expr.IsSubquery():
+		sp, ok := expr.AsSubquery().Plan().(*subqueryPlan)
+		if !ok {
+			return nil, fmt.Errorf("subquery is not planned: %s", expr)
+		}
+		subSchema := sp.plan.Schema()
+		schema.AddField(fieldName, subSchema.Type(sp.field), subSchema.Length(sp.field))
+	default:
+		val := expr.AsConstant()
+		if s, err := val.AsString(); err == nil {
+			schema.AddStringField(fieldName, int32(len(s)))
+		} else {
+			schema.AddIntField(fieldName)
+		}
+	}
+	return &ExtendPlan{
+		plan:      p,
+		fieldName: fieldName,
+		expr:      expr,
+		schema:    schema,
+	}, nil
+}
+
+func (p *ExtendPlan) Open() (query.Scan, error) {
+	s, err := p.plan.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewExtendScan(s, p.fieldName, p.expr), nil
+}
+
+func (p *ExtendPlan) BlocksAccessed() int32 {
+	return p.plan.BlocksAccessed()
+}
+
+func (p *ExtendPlan) RecordsOutput() int32 {
+	return p.plan.RecordsOutput()
+}
+
+func (p *ExtendPlan) DistinctValues(fieldName string) int32 {
+	if fieldName == p.fieldName {
+		if p.expr.IsFieldName() {
+			return p.plan.DistinctValues(p.expr.AsFieldName())
+		}
+		return p.plan.RecordsOutput()
+	}
+	return p.plan.DistinctValues(fieldName)
+}
+
+func (p *ExtendPlan) Schema() *record.Schema {
+	return p.schema
+}
+
+func (p *ExtendPlan) Tree() *PlanNode {
+	return NewPlanNode(fmt.Sprintf("Extend(%s as %s)", p.expr, p.fieldName), p, []*PlanNode{p.plan.Tree()})
+}
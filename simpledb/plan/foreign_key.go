@@ -0,0 +1,397 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"simpledb/index"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+	"strings"
+)
+
+// foreignKeyDefs CREATE TABLE文の外部キー制約を検証し、カタログに記録する定義を作る
+// 参照先の列は、参照先の表の PRIMARY KEY または UNIQUE 制約の列と一致しなければならない
+func foreignKeyDefs(mdm *metadata.Manager, data *parse.CreateTableData, tx *tx.Transaction) ([]*metadata.ForeignKey, error) {
+	var fks []*metadata.ForeignKey
+	for i, c := range data.ForeignKeys {
+		for j, fieldName := range c.FieldNames {
+			if !data.NewSchema.HasField(fieldName) {
+				return nil, fmt.Errorf("foreign key column %q does not exist in %s", fieldName, data.TableName)
+			}
+			if slices.Contains(c.FieldNames[:j], fieldName) {
+				return nil, fmt.Errorf("foreign key column %q appears twice", fieldName)
+			}
+		}
+
+		// 自身を参照する場合は、これから作る表の定義を使う
+		var refSchema *record.Schema
+		var refKeys []*parse.KeyConstraint
+		if c.RefTableName == data.TableName {
+			refSchema = data.NewSchema
+			refKeys = data.Keys
+		} else {
+			layout, err := mdm.GetLayout(c.RefTableName, tx)
+			if err != nil {
+				return nil, err
+			}
+			if len(layout.Schema().Fields()) == 0 {
+				return nil, fmt.Errorf("referenced table %q does not exist", c.RefTableName)
+			}
+			refSchema = layout.Schema()
+			indexes, err := mdm.GetIndexInfo(c.RefTableName, tx)
+			if err != nil {
+				return nil, err
+			}
+			for _, ii := range uniqueIndexes(indexes, "") {
+				refKeys = append(refKeys, parse.NewKeyConstraint(ii.FieldNames(), ii.Constraint() == metadata.ConstraintPrimaryKey))
+			}
+		}
+
+		refFieldNames := c.RefFieldNames
+		if refFieldNames == nil {
+			for _, key := range refKeys {
+				if key.PrimaryKey {
+					refFieldNames = key.FieldNames
+				}
+			}
+			if refFieldNames == nil {
+				return nil, fmt.Errorf("referenced table %q has no primary key", c.RefTableName)
+			}
+		} else if !slices.ContainsFunc(refKeys, func(key *parse.KeyConstraint) bool {
+			return slices.Equal(key.FieldNames, refFieldNames)
+		}) {
+			return nil, fmt.Errorf("no PRIMARY KEY or UNIQUE constraint on %s (%s)", c.RefTableName, strings.Join(refFieldNames, ", "))
+		}
+
+		if len(c.FieldNames) != len(refFieldNames) {
+			return nil, fmt.Errorf("foreign key (%s) does not match the referenced columns (%s)",
+				strings.Join(c.FieldNames, ", "), strings.Join(refFieldNames, ", "))
+		}
+		for j, fieldName := range c.FieldNames {
+			if data.NewSchema.Type(fieldName) != refSchema.Type(refFieldNames[j]) {
+				return nil, fmt.Errorf("foreign key column %q and referenced column %q have different types", fieldName, refFieldNames[j])
+			}
+		}
+
+		onDelete := metadata.ReferentialAction(c.OnDelete)
+		// SET NULL は1列ずつ UPDATE するため、複数列の外部キーには使えない
+		if onDelete == metadata.ActionSetNull && len(c.FieldNames) > 1 {
+			return nil, errors.New("ON DELETE SET NULL is not supported for multi-column foreign keys")
+		}
+
+		fks = append(fks, &metadata.ForeignKey{
+			Name:          keyIndexName(data.TableName, fmt.Sprintf("fkey%d", i+1)),
+			TableName:     data.TableName,
+			FieldNames:    c.FieldNames,
+			RefTableName:  c.RefTableName,
+			RefFieldNames: refFieldNames,
+			OnDelete:      onDelete,
+		})
+	}
+	return fks, nil
+}
+
+// referentialIntegrity 表 tableName に関わる外部キー制約を検査し、参照動作を行う
+// 参照動作は up を通して同じトランザクションの中で行うため、ロールバックすれば取り消される
+type referentialIntegrity struct {
+	up        UpdatePlanner
+	mdm       *metadata.Manager
+	tx        *tx.Transaction
+	tableName string
+	// outgoing tableName が参照する側の外部キー
+	outgoing []*metadata.ForeignKey
+	// incoming tableName を参照する外部キー
+	incoming []*metadata.ForeignKey
+	// useIndex 索引があれば索引を引いて探す。BasicUpdatePlanner は索引を更新しないため使えない
+	useIndex bool
+}
+
+func newReferentialIntegrity(up UpdatePlanner, mdm *metadata.Manager, tableName string, tx *tx.Transaction, useIndex bool) (*referentialIntegrity, error) {
+	outgoing, err := mdm.GetForeignKeys(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err := mdm.GetReferencingKeys(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &referentialIntegrity{up, mdm, tx, tableName, outgoing, incoming, useIndex}, nil
+}
+
+// checkInsert 挿入したばかりのレコードが参照する行が存在するか調べ、存在しなければレコードを削除する
+func (ri *referentialIntegrity) checkInsert(updateScan query.UpdateScan) error {
+	for _, fk := range ri.outgoing {
+		key, err := keyOf(updateScan, fk.FieldNames, "", nil)
+		if err != nil {
+			return err
+		}
+		if err := ri.checkReferenced(fk, updateScan, key); err != nil {
+			if delErr := updateScan.Delete(); delErr != nil {
+				return delErr
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkModify UPDATE文が外部キー制約に違反しないか、レコードを更新する前に調べる
+// 参照されている値を変更することはできない (ON UPDATE RESTRICT)
+func (ri *referentialIntegrity) checkModify(data *parse.ModifyData, selectPlan Plan) error {
+	var outgoing, incoming []*metadata.ForeignKey
+	for _, fk := range ri.outgoing {
+		if slices.Contains(fk.FieldNames, data.TargetField) {
+			outgoing = append(outgoing, fk)
+		}
+	}
+	for _, fk := range ri.incoming {
+		if slices.Contains(fk.RefFieldNames, data.TargetField) {
+			incoming = append(incoming, fk)
+		}
+	}
+	if len(outgoing) == 0 && len(incoming) == 0 {
+		return nil
+	}
+
+	scan, err := selectPlan.Open()
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+	for {
+		if hasNext, err := scan.Next(); err != nil {
+			return err
+		} else if !hasNext {
+			break
+		}
+
+		newVal, err := data.NewValue.Evaluate(scan)
+		if err != nil {
+			return err
+		}
+		for _, fk := range outgoing {
+			key, err := keyOf(scan, fk.FieldNames, data.TargetField, newVal)
+			if err != nil {
+				return err
+			}
+			if err := ri.checkReferenced(fk, nil, key); err != nil {
+				return err
+			}
+		}
+		for _, fk := range incoming {
+			oldKey, err := keyOf(scan, fk.RefFieldNames, "", nil)
+			if err != nil {
+				return err
+			}
+			newKey, err := keyOf(scan, fk.RefFieldNames, data.TargetField, newVal)
+			if err != nil {
+				return err
+			}
+			if oldKey.Equals(newKey) {
+				continue
+			}
+			if err := ri.checkNotReferenced(fk, oldKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkDelete DELETE文が ON DELETE RESTRICT の外部キーに違反しないか、レコードを削除する前に調べる
+func (ri *referentialIntegrity) checkDelete(selectPlan Plan) error {
+	var restricts []*metadata.ForeignKey
+	for _, fk := range ri.incoming {
+		if fk.OnDelete == metadata.ActionRestrict {
+			restricts = append(restricts, fk)
+		}
+	}
+	if len(restricts) == 0 {
+		return nil
+	}
+
+	scan, err := selectPlan.Open()
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+	for {
+		if hasNext, err := scan.Next(); err != nil {
+			return err
+		} else if !hasNext {
+			break
+		}
+
+		for _, fk := range restricts {
+			key, err := keyOf(scan, fk.RefFieldNames, "", nil)
+			if err != nil {
+				return err
+			}
+			if err := ri.checkNotReferenced(fk, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// referencedKeys 削除するレコードのうち、CASCADE や SET NULL の外部キーが参照する値
+// レコードを削除する前に読んでおき、削除した後に onDelete に渡す
+func (ri *referentialIntegrity) referencedKeys(s query.Scan) ([]*query.Constant, error) {
+	keys := make([]*query.Constant, len(ri.incoming))
+	for i, fk := range ri.incoming {
+		if fk.OnDelete == metadata.ActionRestrict {
+			continue
+		}
+		key, err := keyOf(s, fk.RefFieldNames, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// onDelete 削除したレコードを参照していた行に参照動作を行う
+func (ri *referentialIntegrity) onDelete(keys []*query.Constant) error {
+	for i, fk := range ri.incoming {
+		key := keys[i]
+		if key == nil || key.HasNull() {
+			continue
+		}
+		pred := keyPredicate(fk.FieldNames, key)
+		switch fk.OnDelete {
+		case metadata.ActionCascade:
+			if _, err := ri.up.ExecuteDelete(parse.NewDeleteData(fk.TableName, pred), ri.tx); err != nil {
+				return err
+			}
+		case metadata.ActionSetNull:
+			null := query.NewExpressionWithConstant(query.NewNullConstant())
+			if _, err := ri.up.ExecuteModify(parse.NewModifyData(fk.TableName, fk.FieldNames[0], null, pred), ri.tx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkReferenced key を参照先の表に探す。NULL を含むキーは何も参照しない
+// self は参照元のレコードで、自身を参照する外部キーでは自身の値も参照先になり得る
+func (ri *referentialIntegrity) checkReferenced(fk *metadata.ForeignKey, self query.Scan, key *query.Constant) error {
+	if key.HasNull() {
+		return nil
+	}
+	if self != nil && fk.RefTableName == fk.TableName {
+		own, err := keyOf(self, fk.RefFieldNames, "", nil)
+		if err != nil {
+			return err
+		}
+		if own.Equals(key) {
+			return nil
+		}
+	}
+	found, err := ri.exists(fk.RefTableName, fk.RefFieldNames, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return newForeignKeyViolation(fk, fk.FieldNames, key, fmt.Sprintf("is not present in table %q", fk.RefTableName))
+	}
+	return nil
+}
+
+// checkNotReferenced key を参照している行がないか調べる
+func (ri *referentialIntegrity) checkNotReferenced(fk *metadata.ForeignKey, key *query.Constant) error {
+	if key.HasNull() {
+		return nil
+	}
+	found, err := ri.exists(fk.TableName, fk.FieldNames, key)
+	if err != nil {
+		return err
+	}
+	if found {
+		return newForeignKeyViolation(fk, fk.RefFieldNames, key, fmt.Sprintf("is still referenced from table %q", fk.TableName))
+	}
+	return nil
+}
+
+// exists 表 tableName に、fieldNames の値が key である行があるか
+// 参照動作によって表が変わるため、scanKeyFinder のように結果を使い回すことはしない
+func (ri *referentialIntegrity) exists(tableName string, fieldNames []string, key *query.Constant) (bool, error) {
+	if ri.useIndex {
+		indexes, err := ri.mdm.GetIndexInfo(tableName, ri.tx)
+		if err != nil {
+			return false, err
+		}
+		if ii, ok := indexes[metadata.IndexKey(fieldNames)]; ok {
+			rids, err := indexKeyFinder(ii, key)
+			if err != nil {
+				return false, err
+			}
+			return len(rids) > 0, nil
+		}
+	}
+
+	tablePlan, err := NewTablePlan(ri.tx, tableName, ri.mdm)
+	if err != nil {
+		return false, err
+	}
+	selectPlan, err := NewSelectPlan(tablePlan, keyPredicate(fieldNames, key))
+	if err != nil {
+		return false, err
+	}
+	scan, err := selectPlan.Open()
+	if err != nil {
+		return false, err
+	}
+	defer scan.Close()
+	return scan.Next()
+}
+
+// keyOf s の現在のレコードの fieldNames の値。targetField があれば、その列の値を newVal に置き換える
+func keyOf(s query.Scan, fieldNames []string, targetField string, newVal *query.Constant) (*query.Constant, error) {
+	vals := make([]*query.Constant, len(fieldNames))
+	for i, fieldName := range fieldNames {
+		if fieldName == targetField {
+			vals[i] = newVal
+			continue
+		}
+		val, err := s.GetVal(fieldName)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return index.MakeKey(vals), nil
+}
+
+// keyPredicate fieldNames の値が key と等しい行を選ぶ述語
+func keyPredicate(fieldNames []string, key *query.Constant) *query.Predicate {
+	vals := index.SplitKey(key, len(fieldNames))
+	pred := query.NewPredicate()
+	for i, fieldName := range fieldNames {
+		term := query.NewTerm(query.NewExpressionWithField(fieldName), query.NewExpressionWithConstant(vals[i]))
+		pred.ConjoinWith(query.NewPredicateWithTerm(term))
+	}
+	return pred
+}
+
+// newForeignKeyViolation fieldNames は key の列で、参照元と参照先のどちらの値かを表す
+func newForeignKeyViolation(fk *metadata.ForeignKey, fieldNames []string, key *query.Constant, reason string) error {
+	value := key.String()
+	if !key.IsTuple() {
+		value = "(" + value + ")"
+	}
+	return &metadata.ConstraintViolationError{
+		Type:       metadata.ConstraintForeignKey,
+		TableName:  fk.TableName,
+		Constraint: fk.Name,
+		FieldNames: fk.FieldNames,
+		Value:      value,
+		Detail:     fmt.Sprintf("key (%s)=%s %s", strings.Join(fieldNames, ", "), value, reason),
+	}
+}
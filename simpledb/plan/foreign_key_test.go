@@ -0,0 +1,168 @@
+package plan_test
+
+import (
+	"errors"
+	"path"
+	"simpledb/metadata"
+	"simpledb/plan"
+	"simpledb/server"
+	"simpledb/tx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeignKeys(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "foreign_key_test"))
+			require.NoError(t, err)
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			testForeignKeys(t, simpleDB.Planner(), simpleDB.MetadataManager(), tx)
+			require.NoError(t, tx.Commit())
+
+			// 参照動作はトランザクションのロールバックで取り消される
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			before := queryInts(t, simpleDB.Planner(), tx, "select eid from enroll")
+			_, err = simpleDB.Planner().ExecuteUpdate("delete from student where sid = 2", tx)
+			require.NoError(t, err)
+			assert.Empty(t, queryInts(t, simpleDB.Planner(), tx, "select eid from enroll where studentid = 2"))
+			require.NoError(t, tx.Rollback())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, before, queryInts(t, simpleDB.Planner(), tx, "select eid from enroll"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+func testForeignKeys(t *testing.T, planner *plan.Planner, mdm *metadata.Manager, tx *tx.Transaction) {
+	exec := func(cmd string) error {
+		_, err := planner.ExecuteUpdate(cmd, tx)
+		return err
+	}
+	assertViolation := func(err error, wantConstraint string) {
+		t.Helper()
+		var cve *metadata.ConstraintViolationError
+		if assert.True(t, errors.As(err, &cve), "expected constraint violation, but got %v", err) {
+			assert.Equal(t, metadata.ConstraintForeignKey, cve.Type)
+			assert.Equal(t, wantConstraint, cve.Constraint)
+		}
+	}
+
+	require.NoError(t, exec("create table dept (did int primary key, dname varchar(10) unique)"))
+	require.NoError(t, exec("create table student (sid int primary key, majorid int references dept on delete set null)"))
+	require.NoError(t, exec("create table enroll (eid int primary key, studentid int references student (sid) on delete cascade, grade varchar(2))"))
+	require.NoError(t, exec("create table tutor (tid int, studentid int, foreign key (studentid) references student on delete restrict)"))
+
+	// 外部キーはカタログに記録される
+	fks, err := mdm.GetForeignKeys("enroll", tx)
+	require.NoError(t, err)
+	require.Len(t, fks, 1)
+	assert.Equal(t, &metadata.ForeignKey{
+		Name:          "enroll_fkey1",
+		TableName:     "enroll",
+		FieldNames:    []string{"studentid"},
+		RefTableName:  "student",
+		RefFieldNames: []string{"sid"},
+		OnDelete:      metadata.ActionCascade,
+	}, fks[0])
+	fks, err = mdm.GetReferencingKeys("student", tx)
+	require.NoError(t, err)
+	assert.Len(t, fks, 2)
+
+	require.NoError(t, exec("insert into dept (did, dname) values (10, 'math')"))
+	require.NoError(t, exec("insert into dept (did, dname) values (20, 'physics')"))
+	require.NoError(t, exec("insert into student (sid, majorid) values (1, 10)"))
+	require.NoError(t, exec("insert into student (sid, majorid) values (2, 20)"))
+	require.NoError(t, exec("insert into student (sid, majorid) values (3, 20)"))
+	require.NoError(t, exec("insert into student (sid, majorid) values (4, NULL)"))
+	require.NoError(t, exec("insert into enroll (eid, studentid, grade) values (100, 1, 'A')"))
+	require.NoError(t, exec("insert into enroll (eid, studentid, grade) values (101, 2, 'B')"))
+	require.NoError(t, exec("insert into enroll (eid, studentid, grade) values (102, 2, 'C')"))
+	require.NoError(t, exec("insert into tutor (tid, studentid) values (1000, 3)"))
+
+	// 参照先のない値は挿入も更新もできない。違反したレコードは残らない
+	assertViolation(exec("insert into enroll (eid, studentid, grade) values (103, 9, 'A')"), "enroll_fkey1")
+	assert.Empty(t, queryInts(t, planner, tx, "select eid from enroll where eid = 103"))
+	assertViolation(exec("update enroll set studentid = 9 where eid = 100"), "enroll_fkey1")
+	assert.Equal(t, []int32{100}, queryInts(t, planner, tx, "select eid from enroll where studentid = 1"))
+	// NULL は何も参照しない
+	require.NoError(t, exec("insert into enroll (eid, studentid, grade) values (103, NULL, 'A')"))
+	assert.Empty(t, queryInts(t, planner, tx, "select eid from enroll where studentid = NULL"))
+
+	// 参照されている値は変更できない
+	assertViolation(exec("update student set sid = 5 where sid = 3"), "tutor_fkey1")
+	require.NoError(t, exec("update student set sid = 5 where sid = 4"))
+
+	// RESTRICT
+	assertViolation(exec("delete from student where sid = 3"), "tutor_fkey1")
+	assert.Equal(t, []int32{3}, queryInts(t, planner, tx, "select sid from student where sid = 3"))
+
+	// CASCADE
+	require.NoError(t, exec("delete from student where sid = 2"))
+	assert.Empty(t, queryInts(t, planner, tx, "select eid from enroll where studentid = 2"))
+	assert.ElementsMatch(t, []int32{100, 103}, queryInts(t, planner, tx, "select eid from enroll"))
+
+	// SET NULL
+	require.NoError(t, exec("delete from dept where did = 20"))
+	p, err := planner.CreateQueryPlan("select sid, majorid from student where sid = 3", tx)
+	require.NoError(t, err)
+	s, err := p.Open()
+	require.NoError(t, err)
+	next, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, next)
+	majorid, err := s.GetVal("majorid")
+	require.NoError(t, err)
+	assert.True(t, majorid.IsNull())
+	s.Close()
+	assert.Equal(t, []int32{1}, queryInts(t, planner, tx, "select sid from student where majorid = 10"))
+
+	// 自身を参照する外部キー
+	require.NoError(t, exec("create table emp (id int primary key, boss int references emp on delete cascade)"))
+	require.NoError(t, exec("insert into emp (id, boss) values (1, 1)"))
+	require.NoError(t, exec("insert into emp (id, boss) values (2, 1)"))
+	require.NoError(t, exec("insert into emp (id, boss) values (3, 2)"))
+	assertViolation(exec("insert into emp (id, boss) values (4, 5)"), "emp_fkey1")
+	require.NoError(t, exec("delete from emp where id = 2"))
+	assert.Equal(t, []int32{1}, queryInts(t, planner, tx, "select id from emp"))
+
+	assert.Error(t, exec("create table bad (a int references nosuch)"))
+	assert.Error(t, exec("create table bad (a int references tutor)"))                     // tutor には主キーがない
+	assert.Error(t, exec("create table bad (a int references dept (dname))"))              // 型が一致しない
+	assert.Error(t, exec("create table bad (a varchar(10) references student (majorid))")) // 一意性制約がない
+}
+
+// queryInts 最初の列の値を全て返す
+func queryInts(t *testing.T, planner *plan.Planner, tx *tx.Transaction, q string) []int32 {
+	t.Helper()
+	p, err := planner.CreateQueryPlan(q, tx)
+	require.NoError(t, err)
+	s, err := p.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	fieldName := p.Schema().Fields()[0]
+	var result []int32
+	for {
+		next, err := s.Next()
+		require.NoError(t, err)
+		if !next {
+			return result
+		}
+		val, err := s.GetVal(fieldName)
+		require.NoError(t, err)
+		require.False(t, val.IsNull())
+		i, err := val.AsInt()
+		require.NoError(t, err)
+		result = append(result, i)
+	}
+}
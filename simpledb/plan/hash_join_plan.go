@@ -17,6 +17,9 @@ type HashJoinPlan struct {
 	tx                 *tx.Transaction
 	fldName1, fldName2 string
 	schema             *record.Schema
+	joinType           query.JoinType
+	// pred 結合キーの等号の他に、レコードの組が満たすべき結合条件
+	pred *query.Predicate
 }
 
 func NewHashJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string) (*HashJoinPlan, error) {
@@ -26,7 +29,17 @@ func NewHashJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string)
 		p2, p1 = p1, p2
 		fldName2, fldName1 = fldName1, fldName2
 	}
+	return newHashJoinPlan(logger, tx, p1, p2, fldName1, fldName2, query.InnerJoin, query.NewPredicate()), nil
+}
+
+// NewOuterHashJoinPlan 結合の種類 joinType と残りの結合条件 pred を指定してハッシュ結合する
+// 外部結合では左右の意味が変わるので、p1 と p2 を入れ替えない
+func NewOuterHashJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string, joinType query.JoinType, pred *query.Predicate) (*HashJoinPlan, error) {
+	logger := logger.New("plan.HashJoinPlan", logger.Trace)
+	return newHashJoinPlan(logger, tx, p1, p2, fldName1, fldName2, joinType, pred), nil
+}
 
+func newHashJoinPlan(logger *logger.Logger, tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string, joinType query.JoinType, pred *query.Predicate) *HashJoinPlan {
 	schema := record.NewSchema()
 	schema.AddAll(p1.Schema())
 	schema.AddAll(p2.Schema())
@@ -40,12 +53,15 @@ func NewHashJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string)
 		fldName1: fldName1,
 		fldName2: fldName2,
 		schema:   schema,
-	}, nil
+		joinType: joinType,
+		pred:     pred,
+	}
 }
 
 func (hjp *HashJoinPlan) Open() (query.Scan, error) {
 	available := hjp.tx.AvailableBuffers()
-	numBuffs := query.BufferNeedsBestFactor(available, hjp.p2.BlocksAccessed())
+	// 右側の見積もりが 0 ブロック以下でも、少なくとも1つのバケットに分ける
+	numBuffs := max(query.BufferNeedsBestFactor(available, hjp.p2.BlocksAccessed()), 1)
 
 	t1, err := hjp.copyToTemp(hjp.p1)
 	if err != nil {
@@ -63,15 +79,23 @@ func (hjp *HashJoinPlan) Open() (query.Scan, error) {
 	}
 
 	hjp.logger.Tracef("Open(): splitted into %d buckets", len(buckets1))
-	return query.NewSelectScan(
-		query.NewHashJoinScan(hjp.tx, buckets1, buckets2),
-		query.NewPredicateWithTerm(
-			query.NewTerm(
-				query.NewExpressionWithField(hjp.fldName1),
-				query.NewExpressionWithField(hjp.fldName2),
-			),
+	joinPred := query.NewPredicateWithTerm(
+		query.NewTerm(
+			query.NewExpressionWithField(hjp.fldName1),
+			query.NewExpressionWithField(hjp.fldName2),
 		),
-	), nil
+	)
+	if hjp.joinType == query.InnerJoin {
+		return query.NewSelectScan(query.NewHashJoinScan(hjp.tx, buckets1, buckets2), joinPred), nil
+	}
+
+	// 外部結合では、バケットごとに結合条件で結合しなければ、結合しないレコードがわからない
+	joinPred.ConjoinWith(hjp.pred)
+	s := query.NewOuterHashJoinScan(hjp.tx, buckets1, buckets2, hjp.joinType, joinPred)
+	if err := s.BeforeFirst(); err != nil {
+		return nil, fmt.Errorf("s.BeforeFirst: %w", err)
+	}
+	return s, nil
 }
 
 func (hjp *HashJoinPlan) BlocksAccessed() int32 {
@@ -91,7 +115,7 @@ func (hjp *HashJoinPlan) Schema() *record.Schema {
 }
 
 func (hjp *HashJoinPlan) Tree() *PlanNode {
-	return NewPlanNode("HashJoin", hjp, []*PlanNode{hjp.p1.Tree(), hjp.p2.Tree()})
+	return NewPlanNode(joinName("HashJoin", hjp.joinType), hjp, []*PlanNode{hjp.p1.Tree(), hjp.p2.Tree()})
 }
 
 func (hjp *HashJoinPlan) recursiveSplitIntoBucket(p1, p2 *query.TempTable, numBuffs, mod int32) ([]*query.TempTable, []*query.TempTable, error) {
@@ -11,9 +11,12 @@ import (
 )
 
 type TablePlanner struct {
-	myPlan   *TablePlan
+	myPlan   Plan
+	myTable  *TablePlan
 	myPred   *query.Predicate
 	mySchema *record.Schema
+	// The fields mentioned anywhere in the query, or nil when they are unknown.
+	referenced []string
 
 	indexes map[string]*metadata.IndexInfo
 	tx      *tx.Transaction
@@ -29,19 +32,103 @@ func NewTablePlanner(tblName string, pred *query.Predicate, tx *tx.Transaction,
 	if err != nil {
 		return nil, fmt.Errorf("NewTablePlan: %w", err)
 	}
-	mySchema := myPlan.Schema()
-	indexes, err := mdm.GetIndexInfo(tblName, tx)
-	if err != nil {
-		return nil, fmt.Errorf("mdm.GetIndexInfo: %w", err)
+	return newTablePlanner(myPlan, pred, nil, tx, mdm)
+}
+
+// Creates a table planner for the plan of a table reference.
+// Indexes are available only when the plan is a table plan; derived tables have none.
+// An index holding all the referenced fields of the table is read without fetching the data records.
+func newTablePlanner(myPlan Plan, pred *query.Predicate, referenced []string, tx *tx.Transaction, mdm *metadata.Manager) (*TablePlanner, error) {
+	tp := &TablePlanner{
+		myPlan:     myPlan,
+		myPred:     pred,
+		mySchema:   myPlan.Schema(),
+		referenced: referenced,
+		tx:         tx,
+	}
+	if table, ok := myPlan.(*TablePlan); ok {
+		indexes, err := mdm.GetIndexInfo(table.tableName, tx)
+		if err != nil {
+			return nil, fmt.Errorf("mdm.GetIndexInfo: %w", err)
+		}
+		tp.myTable = table
+		tp.indexes = indexes
 	}
+	return tp, nil
+}
+
+// The name of an indexed field in the query, which differs when the table has an alias.
+func (tp *TablePlanner) fieldName(fldName string) string {
+	if tp.myTable == nil {
+		return fldName
+	}
+	return tp.myTable.exposedName(fldName)
+}
+
+// Returns the index record fields holding the values of the fields of the table referenced by the query,
+// keyed by the field names in the query, or nil when the index does not cover all of them.
+func (tp *TablePlanner) coveredFields(ii *metadata.IndexInfo) map[string]string {
+	return coveredFields(tp.myTable, ii, tp.referenced)
+}
 
-	return &TablePlanner{
-		myPlan:   myPlan,
-		myPred:   pred,
-		mySchema: mySchema,
-		indexes:  indexes,
-		tx:       tx,
-	}, nil
+func coveredFields(table *TablePlan, ii *metadata.IndexInfo, referenced []string) map[string]string {
+	if table == nil || referenced == nil || !ii.IndexType().SupportsIndexOnly() {
+		return nil
+	}
+	fields := make(map[string]string)
+	for _, fldName := range table.Schema().Fields() {
+		if !slices.Contains(referenced, fldName) {
+			continue
+		}
+		indexField, ok := ii.EntryField(table.rawName(fldName))
+		if !ok {
+			return nil
+		}
+		fields[fldName] = indexField
+	}
+	return fields
+}
+
+// Collects the fields mentioned by the select list, the predicates, the outer joins, the windows and ORDER BY,
+// including the outer fields referenced by the subqueries, which must already be planned.
+// The names of computed fields may be included as well, which only makes the result more conservative.
+func referencedFields(data *parse.QueryData) []string {
+	result := []string{}
+	add := func(fldNames ...string) {
+		for _, fldName := range fldNames {
+			if !slices.Contains(result, fldName) {
+				result = append(result, fldName)
+			}
+		}
+	}
+	addPred := func(pred *query.Predicate) {
+		add(pred.FieldNames()...)
+		for _, sq := range pred.Subqueries() {
+			add(sq.OuterFields()...)
+		}
+	}
+	add(data.Fields...)
+	for _, e := range data.Exprs {
+		switch {
+		case e.IsFieldName():
+			add(e.AsFieldName())
+		case e.IsSubquery():
+			add(e.AsSubquery().OuterFields()...)
+		}
+	}
+	for _, w := range data.Windows {
+		if w.Field != "" {
+			add(w.Field)
+		}
+		add(w.PartitionBy...)
+		add(w.OrderBy...)
+	}
+	addPred(data.Pred)
+	for _, j := range data.Joins {
+		addPred(j.On)
+	}
+	add(data.OrderBy...)
+	return result
 }
 
 // Constructs a select plan for the table.
@@ -101,39 +188,85 @@ func (tp *TablePlanner) makeProductPlan(current Plan) (Plan, error) {
 	return NewMultibufferProductPlan(tp.tx, current, p), nil
 }
 
+// Chooses the cheapest index whose leading fields are equated with constants.
+// A composite B-tree index can be used when the predicate equates a prefix of its fields,
+// whereas a hash index needs all of its fields (see metadata.IndexType.SupportsPrefix).
+// An index covering the referenced fields is read alone, which makes it cheaper than the others.
 func (tp *TablePlanner) makeIndexSelect() Plan {
-	for fldName := range tp.indexes {
-		val := tp.myPred.EquatesWithConstant(fldName)
-		if val == nil {
+	var best *IndexSelectPlan
+	var bestIndex string
+	for _, ii := range tp.indexes {
+		fieldNames := ii.FieldNames()
+		vals := make([]*query.Constant, 0, len(fieldNames))
+		for _, fldName := range fieldNames {
+			val := tp.myPred.EquatesWithConstant(tp.fieldName(fldName))
+			if val == nil {
+				break
+			}
+			vals = append(vals, val)
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		if len(vals) < len(fieldNames) && !ii.IndexType().SupportsPrefix() {
 			continue
 		}
 
-		ii := tp.indexes[fldName]
-		fmt.Println("index on", fldName, "used")
-		return NewIndexSelectPlan(tp.myPlan, ii, val)
+		key := vals[0]
+		if len(fieldNames) > 1 {
+			key = query.NewConstantWithTuple(vals...)
+		}
+		p := NewIndexSelectPlan(tp.myPlan, ii, key)
+		if fields := tp.coveredFields(ii); fields != nil {
+			p = NewIndexOnlySelectPlan(tp.myPlan, ii, key, fields)
+		}
+		if best != nil && (p.BlocksAccessed() > best.BlocksAccessed() ||
+			p.BlocksAccessed() == best.BlocksAccessed() && ii.IndexName() > bestIndex) {
+			continue
+		}
+		best = p
+		bestIndex = ii.IndexName()
 	}
 
-	return nil
+	if best == nil {
+		return nil
+	}
+	fmt.Println("index", bestIndex, "used")
+	return best
 }
 
+// Only single-field indexes are used for index joins.
+// An index covering the referenced fields is preferred, so that the data records need not be fetched.
 func (tp *TablePlanner) makeIndexJoin(current Plan, currSch *record.Schema) (Plan, error) {
-	for fldName := range tp.indexes {
+	var best *IndexJoinPlan
+	for _, ii := range tp.indexes {
+		if len(ii.FieldNames()) != 1 {
+			continue
+		}
+		fldName := tp.fieldName(ii.FieldNames()[0])
 		outerField := tp.myPred.EquatesWithField(fldName)
 		if outerField == "" || !currSch.HasField(outerField) {
 			continue
 		}
 
-		var p Plan = NewIndexJoinPlan(current, tp.myPlan, tp.indexes[fldName], outerField)
-
-		p, err := tp.addSelectPred(p)
-		if err != nil {
-			return nil, fmt.Errorf("tp.addSelectPred: %w", err)
+		if fields := tp.coveredFields(ii); fields != nil {
+			best = NewIndexOnlyJoinPlan(current, tp.myPlan, ii, outerField, fields, query.InnerJoin, query.NewPredicate())
+			break
+		}
+		if best == nil {
+			best = NewIndexJoinPlan(current, tp.myPlan, ii, outerField)
 		}
+	}
+	if best == nil {
+		return nil, nil
+	}
 
-		return p, nil
+	p, err := tp.addSelectPred(best)
+	if err != nil {
+		return nil, fmt.Errorf("tp.addSelectPred: %w", err)
 	}
 
-	return nil, nil
+	return p, nil
 }
 
 func (tp *TablePlanner) makeProductJoin(current Plan, currSch *record.Schema) (Plan, error) {
@@ -183,6 +316,8 @@ var _ QueryPlanner = (*HeuristicQueryPlanner)(nil)
 type HeuristicQueryPlanner struct {
 	tablePlanners []*TablePlanner
 	mdm           *metadata.Manager
+	// The fields mentioned anywhere in the query being planned.
+	referenced []string
 }
 
 func NewHeuristicQueryPlanner(mdm *metadata.Manager) *HeuristicQueryPlanner {
@@ -195,12 +330,69 @@ func NewHeuristicQueryPlanner(mdm *metadata.Manager) *HeuristicQueryPlanner {
 //   - H1. Choose the smallest table (considering selection predicates) to be first in the join order.
 //   - H2. Add the table to the join order which results in the smallest output.
 func (h *HeuristicQueryPlanner) CreatePlan(data *parse.QueryData, tx *tx.Transaction) (Plan, error) {
+	// CreatePlan may be called concurrently from multiple sessions,
+	// so keep the per-query state in a planner of its own.
+	h = NewHeuristicQueryPlanner(h.mdm)
+
+	// A set operation combines the plans of its operands, each planned on its own.
+	if data.SetOp != nil {
+		return createSetOpPlan(h, data, tx)
+	}
+
+	// Views are expanded into their definitions, so that the predicate applies to the underlying tables.
+	data, err := expandViews(h.mdm, data, tx)
+	if err != nil {
+		return nil, fmt.Errorf("expandViews: %w", err)
+	}
+
+	refs, err := tableRefs(h.mdm, data, tx)
+	if err != nil {
+		return nil, fmt.Errorf("tableRefs: %w", err)
+	}
+	names := exposedNames(refs)
+	plans := make([]Plan, 0, len(refs))
+	schema := record.NewSchema()
+	for _, ref := range refs {
+		p, err := refPlan(h, h.mdm, ref, names, tx)
+		if err != nil {
+			return nil, fmt.Errorf("refPlan: %w", err)
+		}
+		plans = append(plans, p)
+		schema.AddAll(p.Schema())
+	}
+
+	// Subqueries are planned on their own. IN and EXISTS subqueries correlated only by equalities
+	// are turned into semi-joins; the others are evaluated for each record.
+	if err := planSubqueries(h, h.mdm, data, schema, names, tx); err != nil {
+		return nil, fmt.Errorf("planSubqueries: %w", err)
+	}
+	pred, semiJoin := decorrelate(tx, data.Pred, schema)
+	h.referenced = referencedFields(data)
+
+	// The tables before the first outer join may be joined in any order.
+	// The others are joined one by one in the order of the FROM clause,
+	// and each term of the predicate is applied once the fields it mentions are available.
+	first := firstOuterJoin(data)
+	var steps []*query.Predicate
+	rest := query.NewPredicate()
+	if first < len(plans) {
+		schemas := make([]*record.Schema, len(plans))
+		for i, p := range plans {
+			schemas[i] = p.Schema()
+		}
+		steps, rest = placeTerms(data, pred, schemas)
+		pred = query.NewPredicate()
+		for _, step := range steps[:first] {
+			pred.ConjoinWith(step)
+		}
+	}
+
 	// Step 1: Create a TablePlanner object for each mentioned table
-	tablePlanners := make([]*TablePlanner, 0, len(data.Tables))
-	for _, tblName := range data.Tables {
-		tp, err := NewTablePlanner(tblName, data.Pred, tx, h.mdm)
+	tablePlanners := make([]*TablePlanner, 0, first)
+	for _, p := range plans[:first] {
+		tp, err := newTablePlanner(p, pred, h.referenced, tx, h.mdm)
 		if err != nil {
-			return nil, fmt.Errorf("NewTablePlanner: %w", err)
+			return nil, fmt.Errorf("newTablePlanner: %w", err)
 		}
 		tablePlanners = append(tablePlanners, tp)
 	}
@@ -231,15 +423,98 @@ func (h *HeuristicQueryPlanner) CreatePlan(data *parse.QueryData, tx *tx.Transac
 		currentPlan = p
 	}
 
-	// Step 4. Project on the field names and return
-	p, err := NewProjectPlan(currentPlan, data.Fields)
+	// Step 3': Join the tables after the first outer join in order
+	for i := first; i < len(plans); i++ {
+		if j := data.Join(data.Tables[i]); j != nil {
+			currentPlan, err = h.makeOuterJoinPlan(currentPlan, plans[i], j, tx)
+			if err != nil {
+				return nil, fmt.Errorf("h.makeOuterJoinPlan: %w", err)
+			}
+			if currentPlan, err = addSelect(currentPlan, steps[i]); err != nil {
+				return nil, fmt.Errorf("addSelect: %w", err)
+			}
+			continue
+		}
+
+		tp, err := newTablePlanner(plans[i], steps[i], h.referenced, tx, h.mdm)
+		if err != nil {
+			return nil, fmt.Errorf("newTablePlanner: %w", err)
+		}
+		p, err := tp.MakeJoinPlan(currentPlan)
+		if err != nil {
+			return nil, fmt.Errorf("tp.MakeJoinPlan: %w", err)
+		}
+		if p == nil {
+			if p, err = tp.makeProductPlan(currentPlan); err != nil {
+				return nil, fmt.Errorf("tp.makeProductPlan: %w", err)
+			}
+		}
+		currentPlan = p
+	}
+	if currentPlan, err = addSelect(currentPlan, rest); err != nil {
+		return nil, fmt.Errorf("addSelect: %w", err)
+	}
+
+	currentPlan = semiJoin(currentPlan)
+
+	// Step 4. Compute the fields named with AS, project on the field names and return.
+	// DISTINCT, ORDER BY and LIMIT are applied here as well.
+	p, err := projectPlan(tx, currentPlan, data)
 	if err != nil {
-		return nil, fmt.Errorf("plan.NewProjectPlan: %w", err)
+		return nil, fmt.Errorf("projectPlan: %w", err)
 	}
 
 	return p, nil
 }
 
+// Creates an outer join of the current plan and the plan of the table joined by j.
+//   - A left outer join uses an index join when the right side is a table with an index on the join field,
+//     a hash join when the join condition has an equality, and a nested loop join otherwise.
+//     The terms mentioning only the right side are applied to it before the join.
+//   - A right outer join is a left outer join with the sides swapped.
+//   - A full outer join uses a merge join when the join condition is a single equality,
+//     a hash join when it has an equality, and a nested loop join otherwise.
+func (h *HeuristicQueryPlanner) makeOuterJoinPlan(current, p Plan, j *parse.JoinData, tx *tx.Transaction) (Plan, error) {
+	lhs, rhs, joinType := outerJoinSides(current, p, j)
+	fldName1, fldName2, rest, ok := equiJoinKey(j.On, lhs.Schema(), rhs.Schema())
+
+	if joinType == query.FullOuterJoin {
+		switch {
+		case !ok:
+			return NewNestedLoopJoinPlan(lhs, rhs, j.On, joinType), nil
+		case len(rest.Terms()) == 0:
+			return NewOuterMergeJoinPlan(tx, lhs, rhs, fldName1, fldName2, joinType)
+		}
+		return NewOuterHashJoinPlan(tx, lhs, rhs, fldName1, fldName2, joinType, rest)
+	}
+
+	if table, isTable := rhs.(*TablePlan); isTable && ok {
+		indexes, err := h.mdm.GetIndexInfo(table.tableName, tx)
+		if err != nil {
+			return nil, fmt.Errorf("mdm.GetIndexInfo: %w", err)
+		}
+		for _, ii := range indexes {
+			if len(ii.FieldNames()) != 1 || table.exposedName(ii.FieldNames()[0]) != fldName2 {
+				continue
+			}
+			if fields := coveredFields(table, ii, h.referenced); fields != nil {
+				return NewIndexOnlyJoinPlan(lhs, rhs, ii, fldName1, fields, joinType, rest), nil
+			}
+			return NewOuterIndexJoinPlan(lhs, rhs, ii, fldName1, joinType, rest), nil
+		}
+	}
+
+	rhsPred, residual := splitTerms(rest, rhs.Schema())
+	rhs, err := addSelect(rhs, rhsPred)
+	if err != nil {
+		return nil, fmt.Errorf("addSelect: %w", err)
+	}
+	if ok {
+		return NewOuterHashJoinPlan(tx, lhs, rhs, fldName1, fldName2, joinType, residual)
+	}
+	return NewNestedLoopJoinPlan(lhs, rhs, residual, joinType), nil
+}
+
 func (h *HeuristicQueryPlanner) getLowestSelectPlan() (Plan, error) {
 	bestIndex := -1
 	var bestPlan Plan
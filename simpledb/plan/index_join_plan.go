@@ -15,17 +15,51 @@ type IndexJoinPlan struct {
 	indexInfo *metadata.IndexInfo
 	joinField string
 	schema    *record.Schema
+	joinType  query.JoinType
+	// pred 索引で結合したレコードの組が満たすべき残りの結合条件
+	pred *query.Predicate
+	// fields 右側を索引だけで読む場合に、右側の列から索引のレコードのフィールドへの対応。データレコードを読む場合は nil
+	fields map[string]string
 }
 
 func NewIndexJoinPlan(plan1 Plan, plan2 Plan, indexInfo *metadata.IndexInfo, joinField string) *IndexJoinPlan {
+	return NewOuterIndexJoinPlan(plan1, plan2, indexInfo, joinField, query.InnerJoin, query.NewPredicate())
+}
+
+// NewOuterIndexJoinPlan 結合の種類 joinType と残りの結合条件 pred を指定して索引結合する
+func NewOuterIndexJoinPlan(plan1 Plan, plan2 Plan, indexInfo *metadata.IndexInfo, joinField string, joinType query.JoinType, pred *query.Predicate) *IndexJoinPlan {
+	return newIndexJoinPlan(plan1, plan2, indexInfo, joinField, joinType, pred, nil)
+}
+
+// NewIndexOnlyJoinPlan 問合せが参照する右側の列を全て索引のレコードに持つ時に、右側のデータレコードを読まずに索引結合する
+func NewIndexOnlyJoinPlan(plan1 Plan, plan2 Plan, indexInfo *metadata.IndexInfo, joinField string, fields map[string]string, joinType query.JoinType, pred *query.Predicate) *IndexJoinPlan {
+	return newIndexJoinPlan(plan1, plan2, indexInfo, joinField, joinType, pred, fields)
+}
+
+func newIndexJoinPlan(plan1 Plan, plan2 Plan, indexInfo *metadata.IndexInfo, joinField string, joinType query.JoinType, pred *query.Predicate, fields map[string]string) *IndexJoinPlan {
 	sch := record.NewSchema()
 	sch.AddAll(plan1.Schema())
-	sch.AddAll(plan2.Schema())
-	return &IndexJoinPlan{plan1, plan2, indexInfo, joinField, sch}
+	if fields != nil {
+		sch.AddAll(coveredSchema(plan2.Schema(), fields))
+	} else {
+		sch.AddAll(plan2.Schema())
+	}
+	return &IndexJoinPlan{plan1, plan2, indexInfo, joinField, sch, joinType, pred, fields}
 }
 
 func (p *IndexJoinPlan) Open() (query.Scan, error) {
-	scan, err := p.plan1.Open()
+	lhs, err := p.plan1.Open()
+	if err != nil {
+		return nil, err
+	}
+	if p.fields != nil {
+		idx, err := openCoveringIndex(p.indexInfo)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewIndexOnlyJoinScan(lhs, idx, p.joinField, p.fields, p.joinType, p.pred)
+	}
+	scan, err := p.plan2.Open()
 	if err != nil {
 		return nil, err
 	}
@@ -37,15 +71,24 @@ func (p *IndexJoinPlan) Open() (query.Scan, error) {
 	if err != nil {
 		return nil, err
 	}
-	return query.NewIndexJoinScan(scan, idx, p.joinField, ts)
+	return query.NewOuterIndexJoinScan(lhs, idx, p.joinField, ts, p.joinType, p.pred)
 }
 
+// BlocksAccessed 右側を索引だけで読む場合は、右側のデータレコードのブロックを読まない
 func (p *IndexJoinPlan) BlocksAccessed() int32 {
-	return p.plan1.BlocksAccessed() + (p.plan1.RecordsOutput() * p.indexInfo.BlocksAccessed()) + p.RecordsOutput()
+	blocks := p.plan1.BlocksAccessed() + (p.plan1.RecordsOutput() * p.indexInfo.BlocksAccessed())
+	if p.fields != nil {
+		return blocks
+	}
+	return blocks + p.RecordsOutput()
 }
 
 func (p *IndexJoinPlan) RecordsOutput() int32 {
-	return p.plan1.RecordsOutput() * p.indexInfo.RecordsOutput()
+	output := p.plan1.RecordsOutput() * p.indexInfo.RecordsOutput()
+	if p.joinType != query.InnerJoin {
+		output = max(output, p.plan1.RecordsOutput())
+	}
+	return output
 }
 
 func (p *IndexJoinPlan) DistinctValues(fieldName string) int32 {
@@ -60,5 +103,9 @@ func (p *IndexJoinPlan) Schema() *record.Schema {
 }
 
 func (p *IndexJoinPlan) Tree() *PlanNode {
-	return NewPlanNode("IndexJoin", p, []*PlanNode{p.plan1.Tree(), p.plan2.Tree()})
+	name := "IndexJoin"
+	if p.fields != nil {
+		name = "IndexOnlyJoin"
+	}
+	return NewPlanNode(joinName(name, p.joinType), p, []*PlanNode{p.plan1.Tree(), p.plan2.Tree()})
 }
@@ -0,0 +1,126 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/index/btree"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexOnlyScan(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "index_only_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			// query 最適化する計画では node の計画を使い、B-tree 索引の木構造が壊れていない
+			query := func(q string, node string) []string {
+				t.Helper()
+				if name == "optimized" {
+					assert.Contains(t, planTree(t, planner, tx, q), node, q)
+					indexes, err := simpleDB.MetadataManager().GetIndexInfo("enroll", tx)
+					require.NoError(t, err)
+					for _, ii := range indexes {
+						idx, err := ii.Open()
+						require.NoError(t, err)
+						assert.NoError(t, idx.(*btree.BTreeIndex).Check(), ii.IndexName())
+						idx.Close()
+					}
+				}
+				return queryRows(t, planner, tx, q)
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10))"))
+			require.NoError(t, exec("create table enroll (eid int, studentid int, sectionid int, grade varchar(2))"))
+			// 空の表に作った索引は挿入で、データのある表に作った索引は一括で包含列の値を格納する
+			require.NoError(t, exec("create index enroll_sid_idx on enroll (studentid) include (grade)"))
+			// grades 受講 eid の成績を、問合せの結果と同じ形式で表したもの
+			grades := map[int]string{}
+			for i := 0; i < 12; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname) values (%d, 'name%d')", i, i)))
+			}
+			for i := 0; i < 60; i++ {
+				grade := "NULL"
+				if i%15 != 0 {
+					grade = fmt.Sprintf("'%c'", 'A'+i%4)
+				}
+				grades[i] = grade
+				require.NoError(t, exec(fmt.Sprintf("insert into enroll (eid, studentid, sectionid, grade) values (%d, %d, %d, %s)", i, i%10, i%6, grade)))
+			}
+			require.NoError(t, exec("create index enroll_sect_idx on enroll (sectionid) include (eid, studentid)"))
+			require.NoError(t, tx.Commit())
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+
+			// gradesOf 学生 sid の成績を format で整形する
+			gradesOf := func(sid int, format string) []string {
+				var result []string
+				for i := sid; i < 60; i += 10 {
+					if _, ok := grades[i]; ok {
+						result = append(result, fmt.Sprintf(format, grades[i]))
+					}
+				}
+				return result
+			}
+
+			// 参照する列を全て持つ索引は、データレコードを読まずに葉のレコードから値を返す
+			assert.ElementsMatch(t, gradesOf(3, "3|%s"), query("select studentid, grade from enroll where studentid = 3", "\"IndexOnlySelect\""))
+			assert.ElementsMatch(t, gradesOf(3, "%s"), query("select e.grade from enroll e where e.studentid = 3", "\"IndexOnlySelect\""))
+			assert.ElementsMatch(t, []string{"4|4", "10|0", "16|6", "22|2", "28|8", "34|4", "40|0", "46|6", "52|2", "58|8"},
+				query("select eid, studentid from enroll where sectionid = 4", "\"IndexOnlySelect\""))
+			// 索引にない列を参照すれば、データレコードを読む
+			assert.Len(t, query("select eid, grade from enroll where studentid = 3", "\"IndexSelect\""), 6)
+			assert.Len(t, query("select grade from enroll where studentid = 3 order by eid", "\"IndexSelect\""), 6)
+			assert.Equal(t, []string{"3"}, queryRows(t, planner, tx, "select sid from student where exists (select eid from enroll where studentid = sid and sectionid = 3) and sid = 3"))
+
+			// 結合でも、参照する右側の列を全て持つ索引だけを読む
+			assert.ElementsMatch(t, gradesOf(3, "'name3'|%s"), query("select sname, grade from student, enroll where sid = studentid and sname = 'name3'", "\"IndexOnlyJoin\""))
+			want := []string{"10|NULL", "11|NULL"}
+			for sid := 0; sid < 10; sid++ {
+				want = append(want, gradesOf(sid, fmt.Sprintf("%d|%%s", sid))...)
+			}
+			assert.ElementsMatch(t, want, query("select sid, grade from student left join enroll on sid = studentid", "IndexOnlyJoin(left outer)"))
+			assert.Len(t, query("select sname, eid from student, enroll where sid = studentid and sname = 'name3'", "\"IndexJoin\""), 6)
+
+			// 包含列の更新も索引に反映する
+			require.NoError(t, exec("update enroll set grade = 'Z' where eid = 13"))
+			require.NoError(t, exec("delete from enroll where eid = 23"))
+			require.NoError(t, exec("insert into enroll (eid, studentid, sectionid, grade) values (63, 3, 3, 'Y')"))
+			grades[13] = "'Z'"
+			delete(grades, 23)
+			assert.ElementsMatch(t, append(gradesOf(3, "3|%s"), "3|'Y'"), query("select studentid, grade from enroll where studentid = 3", "\"IndexOnlySelect\""))
+			require.NoError(t, exec("update enroll set studentid = 4 where eid = 63"))
+			assert.Len(t, query("select studentid, grade from enroll where studentid = 3", "\"IndexOnlySelect\""), 5)
+			assert.Contains(t, query("select eid, studentid from enroll where sectionid = 3", "\"IndexOnlySelect\""), "63|4")
+
+			// 包含列の名前を変えても索引を使い、包含列を削除すれば索引も削除する
+			require.NoError(t, exec("alter table enroll rename column grade to mark"))
+			assert.Len(t, query("select mark from enroll where studentid = 3", "\"IndexOnlySelect\""), 5)
+			require.NoError(t, exec("alter table enroll drop column mark"))
+			indexes, err := simpleDB.MetadataManager().GetIndexInfo("enroll", tx)
+			require.NoError(t, err)
+			assert.NotContains(t, indexes, "studentid")
+			assert.Contains(t, indexes, "sectionid")
+
+			assert.Error(t, exec("create index enroll_bad_idx on enroll (eid) using hash include (studentid)"))
+			assert.Error(t, exec("create index enroll_bad_idx on enroll (eid) include (eid)"))
+			assert.Error(t, exec("create index enroll_bad_idx on enroll (eid) include (studentid, studentid)"))
+			assert.Error(t, exec("create index enroll_bad_idx on enroll (eid) include (grade)"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
@@ -2,6 +2,7 @@ package plan
 
 import (
 	"errors"
+	"fmt"
 	"simpledb/metadata"
 	"simpledb/query"
 	"simpledb/record"
@@ -13,13 +14,27 @@ type IndexSelectPlan struct {
 	plan      Plan
 	indexInfo *metadata.IndexInfo
 	val       *query.Constant
+	// fields 索引だけで読む場合に、出力する列から索引のレコードのフィールドへの対応。データレコードを読む場合は nil
+	fields map[string]string
 }
 
 func NewIndexSelectPlan(p Plan, indexInfo *metadata.IndexInfo, val *query.Constant) *IndexSelectPlan {
-	return &IndexSelectPlan{p, indexInfo, val}
+	return &IndexSelectPlan{p, indexInfo, val, nil}
+}
+
+// NewIndexOnlySelectPlan 問合せが参照する列を全て索引のレコードに持つ時に、データレコードを読まずに索引から値を返す
+func NewIndexOnlySelectPlan(p Plan, indexInfo *metadata.IndexInfo, val *query.Constant, fields map[string]string) *IndexSelectPlan {
+	return &IndexSelectPlan{p, indexInfo, val, fields}
 }
 
 func (p *IndexSelectPlan) Open() (query.Scan, error) {
+	if p.fields != nil {
+		idx, err := openCoveringIndex(p.indexInfo)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewIndexOnlyScan(idx, p.val, p.fields)
+	}
 	scan, err := p.plan.Open()
 	if err != nil {
 		return nil, err
@@ -32,14 +47,22 @@ func (p *IndexSelectPlan) Open() (query.Scan, error) {
 	if err != nil {
 		return nil, err
 	}
-	return query.NewIndexSelectScan(tableScan, idx, p.val), nil
+	return query.NewIndexSelectScan(tableScan, idx, p.val)
 }
 
+// BlocksAccessed 索引だけで読む場合は、データレコードのブロックを読まない
 func (p *IndexSelectPlan) BlocksAccessed() int32 {
+	if p.fields != nil {
+		return p.indexInfo.BlocksAccessed()
+	}
 	return p.indexInfo.BlocksAccessed() + p.RecordsOutput()
 }
 
+// RecordsOutput 複合索引を先頭の一部の列で検索する場合は、指定した列数から見積もる
 func (p *IndexSelectPlan) RecordsOutput() int32 {
+	if vals, err := p.val.AsTuple(); err == nil {
+		return p.indexInfo.RecordsOutputForPrefix(len(vals))
+	}
 	return p.indexInfo.RecordsOutput()
 }
 
@@ -48,9 +71,44 @@ func (p *IndexSelectPlan) DistinctValues(fieldName string) int32 {
 }
 
 func (p *IndexSelectPlan) Schema() *record.Schema {
+	if p.fields != nil {
+		return coveredSchema(p.plan.Schema(), p.fields)
+	}
 	return p.plan.Schema()
 }
 
 func (p *IndexSelectPlan) Tree() *PlanNode {
-	return NewPlanNode("IndexSelect", p, []*PlanNode{p.plan.Tree()})
+	name := "IndexSelect"
+	switch {
+	case p.fields != nil:
+		name = "IndexOnlySelect"
+	case p.indexInfo.IndexType() == metadata.IndexTypeHash:
+		name = "HashIndexSelect"
+	}
+	return NewPlanNode(name, p, []*PlanNode{p.plan.Tree()})
+}
+
+// openCoveringIndex 索引を開く。索引のレコードから列の値を返せなければエラーを返す
+func openCoveringIndex(ii *metadata.IndexInfo) (query.CoveringIndex, error) {
+	idx, err := ii.Open()
+	if err != nil {
+		return nil, err
+	}
+	ci, ok := idx.(query.CoveringIndex)
+	if !ok {
+		idx.Close()
+		return nil, fmt.Errorf("index %q cannot return column values", ii.IndexName())
+	}
+	return ci, nil
+}
+
+// coveredSchema schema のうち、索引のレコードに値を持つ列 fields だけのスキーマ
+func coveredSchema(schema *record.Schema, fields map[string]string) *record.Schema {
+	result := record.NewSchema()
+	for _, fieldName := range schema.Fields() {
+		if _, ok := fields[fieldName]; ok {
+			result.Add(fieldName, schema)
+		}
+	}
+	return result
 }
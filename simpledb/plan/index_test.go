@@ -1,6 +1,7 @@
 package plan_test
 
 import (
+	"fmt"
 	"path"
 	"simpledb/plan"
 	"simpledb/query"
@@ -254,3 +255,177 @@ func TestIndexUpdate(t *testing.T) {
 	}
 
 }
+
+func TestIndexSelectByType(t *testing.T) {
+	for _, tt := range []struct {
+		indexType string
+		wantNode  string
+	}{
+		{"btree", "\"IndexSelect\""},
+		{"hash", "\"HashIndexSelect\""},
+	} {
+		t.Run(tt.indexType, func(t *testing.T) {
+			testIndexSelect(t, tt.indexType, tt.wantNode)
+		})
+	}
+}
+
+func testIndexSelect(t *testing.T, indexType string, wantNode string) {
+	simpleDB, err := server.NewOptimizedSimpleDB(path.Join(t.TempDir(), "hash_index_test"))
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	tx, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create tx: %v", err)
+	}
+	planner := simpleDB.Planner()
+
+	for _, cmd := range []string{
+		"create table player (pid int, team varchar(10))",
+		"create index player_team_idx on player (team) using " + indexType,
+	} {
+		if _, err := planner.ExecuteUpdate(cmd, tx); err != nil {
+			t.Fatalf("failed to execute %q: %v", cmd, err)
+		}
+	}
+	for i := 0; i < 40; i++ {
+		cmd := fmt.Sprintf("insert into player (pid, team) values (%d, 'team%d')", i, i%4)
+		if _, err := planner.ExecuteUpdate(cmd, tx); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+	}
+
+	selectPids := func() []int32 {
+		p, err := planner.CreateQueryPlan("select pid from player where team = 'team1'", tx)
+		if err != nil {
+			t.Fatalf("failed to create plan: %v", err)
+		}
+		assert.Contains(t, p.Tree().String(), wantNode)
+		s, err := p.Open()
+		if err != nil {
+			t.Fatalf("failed to open scan: %v", err)
+		}
+		defer s.Close()
+		pids := []int32{}
+		for {
+			next, err := s.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !next {
+				break
+			}
+			pid, err := s.GetInt("pid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pids = append(pids, pid)
+		}
+		return pids
+	}
+
+	assert.ElementsMatch(t, []int32{1, 5, 9, 13, 17, 21, 25, 29, 33, 37}, selectPids())
+
+	if _, err := planner.ExecuteUpdate("update player set team = 'team0' where pid = 5", tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := planner.ExecuteUpdate("delete from player where pid = 9", tx); err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []int32{1, 13, 17, 21, 25, 29, 33, 37}, selectPids())
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompositeIndexSelect(t *testing.T) {
+	simpleDB, err := server.NewOptimizedSimpleDB(path.Join(t.TempDir(), "composite_index_test"))
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	tx, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create tx: %v", err)
+	}
+	planner := simpleDB.Planner()
+
+	for _, cmd := range []string{
+		"create table enroll (eid int, studentid int, sectionid int)",
+		"create index enroll_idx on enroll (studentid, sectionid)",
+		"create index enroll_hash_idx on enroll (sectionid, eid) using hash",
+	} {
+		if _, err := planner.ExecuteUpdate(cmd, tx); err != nil {
+			t.Fatalf("failed to execute %q: %v", cmd, err)
+		}
+	}
+	// 同じ studentid のエントリが複数の葉にまたがるように、挿入順を混ぜる
+	eid := 0
+	for sectionid := 0; sectionid < 6; sectionid++ {
+		for studentid := 0; studentid < 10; studentid++ {
+			cmd := fmt.Sprintf("insert into enroll (eid, studentid, sectionid) values (%d, %d, %d)", eid, studentid, sectionid)
+			if _, err := planner.ExecuteUpdate(cmd, tx); err != nil {
+				t.Fatalf("failed to insert: %v", err)
+			}
+			eid++
+		}
+	}
+
+	selectEids := func(query string, wantNode string) []int32 {
+		t.Helper()
+		p, err := planner.CreateQueryPlan(query, tx)
+		if err != nil {
+			t.Fatalf("failed to create plan: %v", err)
+		}
+		tree := p.Tree().String()
+		if wantNode != "" {
+			assert.Contains(t, tree, wantNode)
+		} else {
+			assert.NotContains(t, tree, "IndexSelect")
+		}
+		s, err := p.Open()
+		if err != nil {
+			t.Fatalf("failed to open scan: %v", err)
+		}
+		defer s.Close()
+		eids := []int32{}
+		for {
+			next, err := s.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !next {
+				break
+			}
+			eid, err := s.GetInt("eid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			eids = append(eids, eid)
+		}
+		return eids
+	}
+
+	// 先頭の列だけを指定した前方一致検索
+	assert.ElementsMatch(t, []int32{3, 13, 23, 33, 43, 53}, selectEids("select eid from enroll where studentid = 3", "\"IndexSelect\""))
+	// 全ての列を指定した検索
+	assert.ElementsMatch(t, []int32{43}, selectEids("select eid from enroll where sectionid = 4 and studentid = 3", "\"IndexSelect\""))
+	// 2番目の列だけでは B-tree 索引は使えず、ハッシュ索引は全ての列が必要
+	assert.ElementsMatch(t, []int32{40, 41, 42, 43, 44, 45, 46, 47, 48, 49}, selectEids("select eid from enroll where sectionid = 4", ""))
+	assert.ElementsMatch(t, []int32{41}, selectEids("select eid from enroll where sectionid = 4 and eid = 41", "\"HashIndexSelect\""))
+
+	if _, err := planner.ExecuteUpdate("update enroll set sectionid = 9 where eid = 23", tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := planner.ExecuteUpdate("delete from enroll where eid = 33", tx); err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []int32{3, 13, 23, 43, 53}, selectEids("select eid from enroll where studentid = 3", "\"IndexSelect\""))
+	assert.ElementsMatch(t, []int32{23}, selectEids("select eid from enroll where studentid = 3 and sectionid = 9", "\"IndexSelect\""))
+	assert.ElementsMatch(t, []int32{23}, selectEids("select eid from enroll where sectionid = 9 and eid = 23", "\"HashIndexSelect\""))
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -19,6 +19,10 @@ func NewIndexUpdatePlanner(mdm *metadata.Manager) *IndexUpdatePlanner {
 }
 
 func (up *IndexUpdatePlanner) ExecuteInsert(data *parse.InsertData, tx *tx.Transaction) (int, error) {
+	data, err := insertOnView(up.mdm, data, tx)
+	if err != nil {
+		return 0, err
+	}
 	tablePlan, err := NewTablePlan(tx, data.TableName, up.mdm)
 	if err != nil {
 		return 0, err
@@ -33,35 +37,45 @@ func (up *IndexUpdatePlanner) ExecuteInsert(data *parse.InsertData, tx *tx.Trans
 	if !ok {
 		return 0, errors.New("ExecuteInsert: plan is not a table plan")
 	}
+	indexes, err := up.mdm.GetIndexInfo(data.TableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	cc, err := loadColumnConstraints(up.mdm, tablePlan, tx)
+	if err != nil {
+		return 0, err
+	}
 	if err := updateScan.Insert(); err != nil {
 		return 0, err
 	}
-
 	rid, err := updateScan.GetRID()
 	if err != nil {
 		return 0, err
 	}
-	indexes, err := up.mdm.GetIndexInfo(data.TableName, tx)
+	if err := cc.setInsertValues(updateScan, data); err != nil {
+		return 0, err
+	}
+	if err := cc.checkInsert(updateScan); err != nil {
+		return 0, err
+	}
+	if err := checkInsert(data.TableName, updateScan, uniqueIndexes(indexes, ""), indexKeyFinder); err != nil {
+		return 0, err
+	}
+	ri, err := newReferentialIntegrity(up, up.mdm, data.TableName, tx, true)
 	if err != nil {
 		return 0, err
 	}
+	if err := ri.checkInsert(updateScan); err != nil {
+		return 0, err
+	}
 
-	for i, field := range data.Fields {
-		val := data.Values[i]
-		if err := updateScan.SetVal(field, val); err != nil {
-			return 0, err
-		}
-
-		ii, ok := indexes[field]
-		if !ok {
-			continue
-		}
-
+	// 複合索引のキーは全ての列の値が揃ってから作る
+	for _, ii := range indexes {
 		idx, err := ii.Open()
 		if err != nil {
 			return 0, err
 		}
-		if err := idx.Insert(val, rid); err != nil {
+		if err := ii.InsertEntry(idx, updateScan, rid); err != nil {
 			return 0, err
 		}
 		idx.Close()
@@ -70,11 +84,19 @@ func (up *IndexUpdatePlanner) ExecuteInsert(data *parse.InsertData, tx *tx.Trans
 }
 
 func (up *IndexUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Transaction) (int, error) {
+	data, err := deleteOnView(up.mdm, data, tx)
+	if err != nil {
+		return 0, err
+	}
 	tableName := data.TableName
 	tablePlan, err := NewTablePlan(tx, tableName, up.mdm)
 	if err != nil {
 		return 0, err
 	}
+	// 副問合せは表のレコードごとに評価する
+	if err := bindSubqueries(NewHeuristicQueryPlanner(up.mdm), up.mdm, data.Pred, nil, tablePlan.Schema(), tableNames(data.TableName, tablePlan.Schema()), tx); err != nil {
+		return 0, err
+	}
 
 	selectPlan, err := NewSelectPlan(tablePlan, data.Pred)
 	if err != nil {
@@ -86,6 +108,14 @@ func (up *IndexUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Trans
 		return 0, err
 	}
 
+	ri, err := newReferentialIntegrity(up, up.mdm, tableName, tx, true)
+	if err != nil {
+		return 0, err
+	}
+	if err := ri.checkDelete(selectPlan); err != nil {
+		return 0, err
+	}
+
 	scan, err := selectPlan.Open()
 	if err != nil {
 		return 0, err
@@ -108,8 +138,8 @@ func (up *IndexUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Trans
 		if err != nil {
 			return 0, err
 		}
-		for fieldName, ii := range indexes {
-			val, err := scan.GetVal(fieldName)
+		for _, ii := range indexes {
+			key, err := ii.KeyOf(scan)
 			if err != nil {
 				return 0, err
 			}
@@ -117,25 +147,41 @@ func (up *IndexUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Trans
 			if err != nil {
 				return 0, err
 			}
-			if err := idx.Delete(val, rid); err != nil {
+			if err := idx.Delete(key, rid); err != nil {
 				return 0, err
 			}
 			idx.Close()
 		}
 
+		// 参照動作は削除した後に行うため、参照されている値を先に読んでおく
+		keys, err := ri.referencedKeys(scan)
+		if err != nil {
+			return 0, err
+		}
 		if err := updateScan.Delete(); err != nil {
 			return 0, err
 		}
+		if err := ri.onDelete(keys); err != nil {
+			return 0, err
+		}
 		count++
 	}
 	return count, nil
 }
 
 func (up *IndexUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Transaction) (int, error) {
+	data, err := modifyOnView(up.mdm, data, tx)
+	if err != nil {
+		return 0, err
+	}
 	tablePlan, err := NewTablePlan(tx, data.TableName, up.mdm)
 	if err != nil {
 		return 0, err
 	}
+	// 副問合せは表のレコードごとに評価する
+	if err := bindSubqueries(NewHeuristicQueryPlanner(up.mdm), up.mdm, data.Pred, []*query.Expression{data.NewValue}, tablePlan.Schema(), tableNames(data.TableName, tablePlan.Schema()), tx); err != nil {
+		return 0, err
+	}
 
 	selectPlan, err := NewSelectPlan(tablePlan, data.Pred)
 	if err != nil {
@@ -146,12 +192,41 @@ func (up *IndexUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Trans
 	if err != nil {
 		return 0, err
 	}
-	var idx query.Index
-	if indexInfo, ok := indexInfoMap[data.TargetField]; ok {
-		idx, err = indexInfo.Open()
+	// 更新する列を含む索引 (複合索引や、包含列に含む索引を含む) を全て更新する
+	var indexInfos []*metadata.IndexInfo
+	var indexes []query.Index
+	defer func() {
+		for _, idx := range indexes {
+			idx.Close()
+		}
+	}()
+	for _, ii := range indexInfoMap {
+		if !ii.Covers(data.TargetField) {
+			continue
+		}
+		idx, err := ii.Open()
 		if err != nil {
 			return 0, err
 		}
+		indexInfos = append(indexInfos, ii)
+		indexes = append(indexes, idx)
+	}
+	cc, err := loadColumnConstraints(up.mdm, tablePlan, tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := cc.checkModify(data, selectPlan); err != nil {
+		return 0, err
+	}
+	if err := checkModify(data, selectPlan, uniqueIndexes(indexInfoMap, data.TargetField), indexKeyFinder); err != nil {
+		return 0, err
+	}
+	ri, err := newReferentialIntegrity(up, up.mdm, data.TableName, tx, true)
+	if err != nil {
+		return 0, err
+	}
+	if err := ri.checkModify(data, selectPlan); err != nil {
+		return 0, err
 	}
 
 	scan, err := selectPlan.Open()
@@ -176,9 +251,11 @@ func (up *IndexUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Trans
 		if err != nil {
 			return 0, err
 		}
-		oldVal, err := scan.GetVal(data.TargetField)
-		if err != nil {
-			return 0, err
+		oldKeys := make([]*query.Constant, len(indexInfos))
+		for i, ii := range indexInfos {
+			if oldKeys[i], err = ii.KeyOf(scan); err != nil {
+				return 0, err
+			}
 		}
 		if err := updateScan.SetVal(data.TargetField, newVal); err != nil {
 			return 0, err
@@ -186,7 +263,7 @@ func (up *IndexUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Trans
 
 		count++
 
-		if idx == nil {
+		if len(indexes) == 0 {
 			continue
 		}
 
@@ -194,39 +271,65 @@ func (up *IndexUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Trans
 		if err != nil {
 			return 0, err
 		}
-		if err := idx.Delete(oldVal, rid); err != nil {
-			return 0, err
-		}
-		if err := idx.Insert(newVal, rid); err != nil {
-			return 0, err
+		for i, ii := range indexInfos {
+			if err := indexes[i].Delete(oldKeys[i], rid); err != nil {
+				return 0, err
+			}
+			if err := ii.InsertEntry(indexes[i], scan, rid); err != nil {
+				return 0, err
+			}
 		}
 	}
 
-	if idx != nil {
-		idx.Close()
-	}
-
 	return count, nil
 }
 
 func (up *IndexUpdatePlanner) ExecuteCreateTable(data *parse.CreateTableData, tx *tx.Transaction) (int, error) {
-	tableName := data.TableName
-	schema := data.NewSchema
-	err := up.mdm.CreateTable(tableName, schema, tx)
+	err := createTable(up.mdm, data, tx)
 	return 0, err
 }
 
 func (up *IndexUpdatePlanner) ExecuteCreateView(data *parse.CreateViewData, tx *tx.Transaction) (int, error) {
-	viewName := data.ViewName
-	viewDef := data.ViewDef()
-	err := up.mdm.CreateView(viewName, viewDef, tx)
+	err := createView(up.mdm, data, tx)
 	return 0, err
 }
 
 func (up *IndexUpdatePlanner) ExecuteCreateIndex(data *parse.CreateIndexData, tx *tx.Transaction) (int, error) {
-	indexName := data.IndexName
-	tableName := data.TableName
-	fieldName := data.FieldName
-	err := up.mdm.CreateIndex(indexName, tableName, fieldName, tx)
+	err := createIndex(up.mdm, data, tx, true)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteDropTable(data *parse.DropTableData, tx *tx.Transaction) (int, error) {
+	err := dropTable(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteDropView(data *parse.DropViewData, tx *tx.Transaction) (int, error) {
+	err := dropView(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteDropIndex(data *parse.DropIndexData, tx *tx.Transaction) (int, error) {
+	err := dropIndex(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteAlterTable(data *parse.AlterTableData, tx *tx.Transaction) (int, error) {
+	err := alterTable(up.mdm, data, tx, true)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteVacuum(data *parse.VacuumData, tx *tx.Transaction) (int, error) {
+	err := vacuum(up.mdm, data, tx, true)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteReindex(data *parse.ReindexData, tx *tx.Transaction) (int, error) {
+	err := reindex(up.mdm, data, tx)
+	return 0, err
+}
+
+func (up *IndexUpdatePlanner) ExecuteCheckIndex(data *parse.CheckIndexData, tx *tx.Transaction) (int, error) {
+	err := checkIndexes(up.mdm, data, tx)
 	return 0, err
 }
@@ -0,0 +1,128 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/plan"
+	"simpledb/server"
+	"simpledb/tx"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoin(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "join_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10), majorid int)"))
+			require.NoError(t, exec("create table dept (did int, dname varchar(10))"))
+			require.NoError(t, exec("create table enroll (eid int, studentid int)"))
+			require.NoError(t, exec("create index dept_did_idx on dept (did)"))
+			for i, majorid := range []string{"10", "20", "10", "40", "null"} {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid) values (%d, 'name%d', %s)", i+1, i+1, majorid)))
+			}
+			require.NoError(t, exec("insert into dept (did, dname) values (10, 'compsci')"))
+			require.NoError(t, exec("insert into dept (did, dname) values (20, 'math')"))
+			require.NoError(t, exec("insert into dept (did, dname) values (30, 'drama')"))
+			for i, sid := range []int{1, 1, 3, 9} {
+				require.NoError(t, exec(fmt.Sprintf("insert into enroll (eid, studentid) values (%d, %d)", 100+i, sid)))
+			}
+
+			// JOIN ... ON と CROSS JOIN は内部結合
+			assert.ElementsMatch(t, []string{"1|'compsci'", "2|'math'", "3|'compsci'"}, queryRows(t, planner, tx, "select sid, dname from student join dept on majorid = did"))
+			assert.ElementsMatch(t, []string{"2|'math'"}, queryRows(t, planner, tx, "select sid, dname from student inner join dept on majorid = did where dname = 'math'"))
+			assert.Len(t, queryRows(t, planner, tx, "select sid, did from student cross join dept"), 15)
+
+			// 外部結合: 結合しないレコードの相手側の列は NULL になる
+			q := "select sid, dname from student left join dept on majorid = did"
+			assert.ElementsMatch(t, []string{"1|'compsci'", "2|'math'", "3|'compsci'", "4|NULL", "5|NULL"}, queryRows(t, planner, tx, q))
+			assert.ElementsMatch(t, []string{"1|'compsci'", "2|'math'", "3|'compsci'", "NULL|'drama'"}, queryRows(t, planner, tx, "select sid, dname from student right outer join dept on majorid = did"))
+			q2 := "select sid, dname from student full join dept on majorid = did"
+			assert.ElementsMatch(t, []string{"1|'compsci'", "2|'math'", "3|'compsci'", "4|NULL", "5|NULL", "NULL|'drama'"}, queryRows(t, planner, tx, q2))
+			assert.ElementsMatch(t, []string{"1|NULL", "2|'math'", "3|NULL", "4|NULL", "5|NULL"}, queryRows(t, planner, tx, "select sid, dname from student left join dept on majorid = did and dname = 'math'"))
+			assert.ElementsMatch(t, []string{"1|'compsci'", "2|NULL", "3|'compsci'", "4|NULL", "5|NULL", "NULL|'math'", "NULL|'drama'"}, queryRows(t, planner, tx, "select sid, dname from student full join dept on majorid = did and dname = 'compsci'"))
+			if name == "optimized" {
+				assert.Contains(t, planTree(t, planner, tx, q), "IndexJoin(left outer)")
+				assert.Contains(t, planTree(t, planner, tx, q2), "MergeJoin(full outer)")
+			} else {
+				assert.Contains(t, planTree(t, planner, tx, q), "NestedLoopJoin(left outer)")
+			}
+
+			// WHERE は結合した後に適用する
+			assert.ElementsMatch(t, []string{"1|'compsci'", "3|'compsci'"}, queryRows(t, planner, tx, "select sid, dname from student left join dept on majorid = did where dname = 'compsci'"))
+			assert.ElementsMatch(t, []string{"NULL|'drama'"}, queryRows(t, planner, tx, "select sid, dname from student right join dept on majorid = did where did = 30"))
+
+			// 外部結合を続けると、左から順に結合する
+			assert.ElementsMatch(t, []string{"1|100|'compsci'", "1|101|'compsci'", "2|NULL|'math'", "3|102|'compsci'", "4|NULL|NULL", "5|NULL|NULL"},
+				queryRows(t, planner, tx, "select sid, eid, dname from student left join enroll on sid = studentid left join dept on majorid = did"))
+			assert.ElementsMatch(t, []string{"1|100", "1|101", "3|102", "NULL|103"},
+				queryRows(t, planner, tx, "select sid, eid from student right join enroll on sid = studentid"))
+
+			// 外部結合する導出表とビュー
+			assert.ElementsMatch(t, []string{"1|NULL", "2|'math'", "3|NULL", "4|NULL", "5|NULL"}, queryRows(t, planner, tx, "select sid, n from student left join (select did as d, dname as n from dept where dname = 'math') as t on majorid = d"))
+			require.NoError(t, exec("create view compsci as select did, dname from dept where did = 10"))
+			assert.ElementsMatch(t, []string{"1|'compsci'", "2|NULL", "3|'compsci'", "4|NULL", "5|NULL"}, queryRows(t, planner, tx, "select sid, dname from student left join compsci on majorid = did"))
+
+			// 別名と修飾した列名
+			assert.Equal(t, []string{"'name2'"}, queryStrings(t, planner, tx, "select s.sname from student s where s.sid = 2"))
+			assert.ElementsMatch(t, []string{"1|1", "1|3", "3|1", "3|3"}, queryRows(t, planner, tx, "select s1.sid, s2.sid from student s1, student s2 where s1.majorid = s2.majorid and s1.majorid = 10"))
+			assert.ElementsMatch(t, []string{"1|'compsci'", "3|'compsci'"}, queryRows(t, planner, tx, "select s.sid, d.dname from student as s join dept d on s.majorid = d.did where d.did = 10"))
+			assert.ElementsMatch(t, []int32{1, 3}, queryInts(t, planner, tx, "select s.sid from student s where exists (select e.eid from enroll e where e.studentid = s.sid)"))
+			assert.ElementsMatch(t, []int32{1, 3}, queryInts(t, planner, tx, "select s1.sid from student s1 where exists (select s2.sid from student s2 where s2.majorid = s1.majorid and s2.sid = 3)"))
+			assert.Error(t, queryError(planner, tx, "select sid from student s1, student s2"))
+			assert.Error(t, queryError(planner, tx, "select s.nosuch from student s"))
+			assert.Error(t, queryError(planner, tx, "select sid from student s, dept s"))
+			assert.Error(t, queryError(planner, tx, "select sid from student left join nosuch on sid = x"))
+
+			// ビューの定義の別名と外部結合は、表の名前と列の名前を変えても使える
+			require.NoError(t, exec("create view majors as select s.sname, d.dname from student s left join dept d on s.majorid = d.did"))
+			assert.Len(t, queryRows(t, planner, tx, "select sname, dname from majors"), 5)
+			require.NoError(t, exec("alter table dept rename to department"))
+			require.NoError(t, exec("alter table student rename column sname to name"))
+			assert.ElementsMatch(t, []string{"'name2'|'math'"}, queryRows(t, planner, tx, "select name, dname from majors where dname = 'math'"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+// queryRows 全ての列の値を | で区切った文字列にして返す
+func queryRows(t *testing.T, planner *plan.Planner, tx *tx.Transaction, q string) []string {
+	t.Helper()
+	p, err := planner.CreateQueryPlan(q, tx)
+	require.NoError(t, err)
+	s, err := p.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	var result []string
+	for {
+		next, err := s.Next()
+		require.NoError(t, err)
+		if !next {
+			return result
+		}
+		var vals []string
+		for _, fieldName := range p.Schema().Fields() {
+			val, err := s.GetVal(fieldName)
+			require.NoError(t, err)
+			vals = append(vals, val.String())
+		}
+		result = append(result, strings.Join(vals, "|"))
+	}
+}
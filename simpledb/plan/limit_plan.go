@@ -0,0 +1,51 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/query"
+	"simpledb/record"
+)
+
+var _ Plan = (*LimitPlan)(nil)
+
+// LimitPlan p の先頭の offset 件を読み飛ばし、続く最大 limit 件のレコードを返す。limit が負であれば制限しない
+type LimitPlan struct {
+	p             Plan
+	limit, offset int32
+}
+
+func NewLimitPlan(p Plan, limit, offset int32) *LimitPlan {
+	return &LimitPlan{p, limit, offset}
+}
+
+func (lp *LimitPlan) Open() (query.Scan, error) {
+	s, err := lp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewLimitScan(s, lp.limit, lp.offset), nil
+}
+
+func (lp *LimitPlan) BlocksAccessed() int32 {
+	return lp.p.BlocksAccessed()
+}
+
+func (lp *LimitPlan) RecordsOutput() int32 {
+	output := max(lp.p.RecordsOutput()-lp.offset, 0)
+	if lp.limit >= 0 {
+		output = min(output, lp.limit)
+	}
+	return output
+}
+
+func (lp *LimitPlan) DistinctValues(fieldName string) int32 {
+	return min(lp.p.DistinctValues(fieldName), lp.RecordsOutput())
+}
+
+func (lp *LimitPlan) Schema() *record.Schema {
+	return lp.p.Schema()
+}
+
+func (lp *LimitPlan) Tree() *PlanNode {
+	return NewPlanNode(fmt.Sprintf("Limit(%d offset %d)", lp.limit, lp.offset), lp, []*PlanNode{lp.p.Tree()})
+}
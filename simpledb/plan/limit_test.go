@@ -0,0 +1,98 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistinctLimitAndAllColumns(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "limit_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10), majorid int)"))
+			require.NoError(t, exec("create table dept (did int, dname varchar(10))"))
+			for i, majorid := range []string{"20", "10", "20", "null", "10", "30"} {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid) values (%d, 'name%d', %s)", 6-i, 6-i, majorid)))
+			}
+			require.NoError(t, exec("insert into dept (did, dname) values (10, 'compsci')"))
+			require.NoError(t, exec("insert into dept (did, dname) values (20, 'math')"))
+
+			// * は全ての参照の列、t.* は参照 t の列に展開する
+			p, err := planner.CreateQueryPlan("select * from student, dept", tx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"sid", "sname", "majorid", "did", "dname"}, p.Schema().Fields())
+			assert.ElementsMatch(t, []string{"5|'name5'|10", "2|'name2'|10"}, queryRows(t, planner, tx, "select * from student where majorid = 10"))
+			assert.ElementsMatch(t, []string{"'math'|6|'name6'|20", "'math'|4|'name4'|20"}, queryRows(t, planner, tx, "select d.dname, s.* from student s join dept d on s.majorid = d.did where d.did = 20"))
+			p, err = planner.CreateQueryPlan("select * from student s1, student s2", tx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"s1.sid", "s1.sname", "s1.majorid", "s2.sid", "s2.sname", "s2.majorid"}, p.Schema().Fields())
+			assert.Error(t, queryError(planner, tx, "select x.* from student"))
+
+			// DISTINCT は重複を除く。NULL 同士は重複とみなす
+			assert.ElementsMatch(t, []string{"10", "20", "30", "NULL"}, queryRows(t, planner, tx, "select distinct majorid from student"))
+			assert.Len(t, queryRows(t, planner, tx, "select distinct majorid, sname from student"), 6)
+
+			// ORDER BY は昇順に、DESC を付けた列は降順に並べ、選択リストにない列でも並べられる
+			assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, queryRows(t, planner, tx, "select sid from student order by sid"))
+			assert.Equal(t, []string{"'name3'", "'name2'", "'name5'", "'name4'", "'name6'", "'name1'"}, queryRows(t, planner, tx, "select sname from student order by majorid, sid"))
+			assert.Equal(t, []string{"NULL", "10", "20", "30"}, queryRows(t, planner, tx, "select distinct majorid from student order by majorid"))
+			assert.Equal(t, []string{"6", "5", "4", "3", "2", "1"}, queryRows(t, planner, tx, "select sid from student order by sid desc"))
+			assert.Equal(t, []string{"'name1'", "'name4'", "'name6'", "'name2'", "'name5'", "'name3'"}, queryRows(t, planner, tx, "select sname from student order by majorid desc, sid asc"))
+			assert.Equal(t, []string{"30", "20", "10", "NULL"}, queryRows(t, planner, tx, "select distinct majorid from student order by majorid desc"))
+			assert.Error(t, queryError(planner, tx, "select distinct majorid from student order by sid"))
+			assert.Error(t, queryError(planner, tx, "select sid from student order by nosuch"))
+
+			// LIMIT と OFFSET
+			assert.Equal(t, []string{"1", "2"}, queryRows(t, planner, tx, "select sid from student order by sid limit 2"))
+			assert.Equal(t, []string{"3", "4"}, queryRows(t, planner, tx, "select sid from student order by sid limit 2 offset 2"))
+			assert.Equal(t, []string{"5", "6"}, queryRows(t, planner, tx, "select sid from student order by sid offset 4"))
+			assert.Empty(t, queryRows(t, planner, tx, "select sid from student order by sid limit 0"))
+			assert.Empty(t, queryRows(t, planner, tx, "select sid from student limit 3 offset 10"))
+			assert.Len(t, queryRows(t, planner, tx, "select sid from student limit 4"), 4)
+			assert.Equal(t, []string{"NULL", "10"}, queryRows(t, planner, tx, "select distinct majorid from student order by majorid limit 2"))
+			assert.Equal(t, []string{"'name6'", "'name5'"}, queryRows(t, planner, tx, "select sname from student order by sid desc limit 2"))
+			assert.Equal(t, []string{"4", "3"}, queryRows(t, planner, tx, "select sid from student order by sid desc limit 2 offset 2"))
+			assert.Equal(t, []string{"30"}, queryRows(t, planner, tx, "select distinct majorid from student order by majorid desc limit 1"))
+			assert.Contains(t, planTree(t, planner, tx, "select sid from student order by sid limit 2"), "TopN")
+			assert.Contains(t, planTree(t, planner, tx, "select sid from student order by sid limit 2"), "Limit")
+
+			// 集合演算、導出表、ビューと副問合せ
+			assert.Equal(t, []string{"NULL", "10", "20"}, queryRows(t, planner, tx, "select majorid from student union select did from dept order by majorid limit 3"))
+			assert.Equal(t, []string{"30", "20"}, queryRows(t, planner, tx, "select majorid from student union select did from dept order by majorid desc limit 2"))
+			assert.ElementsMatch(t, []string{"1", "2"}, queryRows(t, planner, tx, "select n from (select sid as n from student order by sid limit 2) as t"))
+			assert.ElementsMatch(t, []string{"5", "6"}, queryRows(t, planner, tx, "select n from (select sid as n from student order by sid desc limit 2) as t"))
+			require.NoError(t, exec("create view oldest as select * from student order by sid limit 3"))
+			assert.ElementsMatch(t, []string{"2|'name2'"}, queryRows(t, planner, tx, "select sid, sname from oldest where majorid = 10"))
+			require.NoError(t, exec("create view newest as select sid from student order by sid desc limit 2"))
+			assert.ElementsMatch(t, []int32{5, 6}, queryInts(t, planner, tx, "select sid from newest"))
+			assert.ElementsMatch(t, []int32{6}, queryInts(t, planner, tx, "select sid from student where sid in (select sid from student order by sid offset 5)"))
+
+			// * で列を出力するビューは、列の名前を変えても使え、更新もできる
+			require.NoError(t, exec("create view all_students as select * from student"))
+			require.NoError(t, exec("alter table student rename column sname to name"))
+			assert.ElementsMatch(t, []string{"'name1'"}, queryRows(t, planner, tx, "select name from all_students where sid = 1"))
+			require.NoError(t, exec("insert into all_students (sid, name, majorid) values (7, 'name7', 30)"))
+			assert.Equal(t, []string{"7|'name7'|30"}, queryRows(t, planner, tx, "select * from all_students order by sid offset 6"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
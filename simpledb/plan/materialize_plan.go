@@ -79,7 +79,7 @@ func (p *MaterializePlan) Open() (query.Scan, error) {
 
 func (p *MaterializePlan) BlocksAccessed() int32 {
 	// create a dummy Layout object to calculate slot size
-	layout := record.NewLayoutFromSchema(p.srcPlan.Schema())
+	layout := record.NewLayoutFromSchemaWithEncoding(p.srcPlan.Schema(), record.FixedFormat, p.tx.Encoding())
 	rpb := float64(p.tx.BlockSize()) / float64(layout.SlotSize())
 	blocksAccessed := int32(math.Ceil(float64(p.srcPlan.RecordsOutput()) / rpb))
 
@@ -14,9 +14,15 @@ type MergeJoinPlan struct {
 	p1, p2             *SortPlan
 	fldName1, fldName2 string
 	sch                *record.Schema
+	joinType           query.JoinType
 }
 
 func NewMergeJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string) (*MergeJoinPlan, error) {
+	return NewOuterMergeJoinPlan(tx, p1, p2, fldName1, fldName2, query.InnerJoin)
+}
+
+// NewOuterMergeJoinPlan 結合の種類 joinType を指定してマージ結合する
+func NewOuterMergeJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string, joinType query.JoinType) (*MergeJoinPlan, error) {
 	sortPlan1, err := NewSortPlan(tx, p1, []string{fldName1})
 	if err != nil {
 		return nil, fmt.Errorf("NewSortPlan for p1: %w", err)
@@ -35,6 +41,7 @@ func NewMergeJoinPlan(tx *tx.Transaction, p1, p2 Plan, fldName1, fldName2 string
 		fldName1: fldName1,
 		fldName2: fldName2,
 		sch:      sch,
+		joinType: joinType,
 	}, nil
 }
 
@@ -55,7 +62,7 @@ func (mjp *MergeJoinPlan) Open() (query.Scan, error) {
 	if !ok {
 		return nil, errors.New("s2 is not a SortScan")
 	}
-	return query.NewMergeJoinScan(ss1, ss2, mjp.fldName1, mjp.fldName2), nil
+	return query.NewMergeJoinScan(ss1, ss2, mjp.fldName1, mjp.fldName2, mjp.p1.Schema(), mjp.p2.Schema(), mjp.joinType)
 }
 
 func (mjp *MergeJoinPlan) BlocksAccessed() int32 {
@@ -65,7 +72,13 @@ func (mjp *MergeJoinPlan) BlocksAccessed() int32 {
 func (mjp *MergeJoinPlan) RecordsOutput() int32 {
 	maxVals := max(mjp.p1.DistinctValues(mjp.fldName1),
 		mjp.p2.DistinctValues(mjp.fldName2))
-	return mjp.p1.RecordsOutput() * mjp.p2.RecordsOutput() / maxVals
+	output := mjp.p1.RecordsOutput() * mjp.p2.RecordsOutput() / maxVals
+	if mjp.joinType == query.FullOuterJoin {
+		output = max(output, mjp.p1.RecordsOutput()+mjp.p2.RecordsOutput())
+	} else if mjp.joinType == query.LeftOuterJoin {
+		output = max(output, mjp.p1.RecordsOutput())
+	}
+	return output
 }
 
 func (mjp *MergeJoinPlan) DistinctValues(fieldName string) int32 {
@@ -84,5 +97,5 @@ func (mjp *MergeJoinPlan) Schema() *record.Schema {
 }
 
 func (mjp *MergeJoinPlan) Tree() *PlanNode {
-	return NewPlanNode("MergeJoin", mjp, []*PlanNode{mjp.p1.Tree(), mjp.p2.Tree()})
+	return NewPlanNode(joinName("MergeJoin", mjp.joinType), mjp, []*PlanNode{mjp.p1.Tree(), mjp.p2.Tree()})
 }
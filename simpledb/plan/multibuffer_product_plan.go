@@ -55,7 +55,14 @@ func (p *MultibufferProductPlan) Open() (query.Scan, error) {
 		return nil, fmt.Errorf("p.copyRecordsFrom: %w", err)
 	}
 
-	return query.NewMultibufferProductScan(p.tx, leftscan, tt.TableName, tt.Layout())
+	s, err := query.NewMultibufferProductScan(p.tx, leftscan, tt.TableName, tt.Layout())
+	if err != nil {
+		return nil, fmt.Errorf("query.NewMultibufferProductScan: %w", err)
+	}
+	if err := s.BeforeFirst(); err != nil {
+		return nil, fmt.Errorf("s.BeforeFirst: %w", err)
+	}
+	return s, nil
 }
 
 func (p *MultibufferProductPlan) BlocksAccessed() int32 {
@@ -0,0 +1,75 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/query"
+	"simpledb/record"
+)
+
+var _ Plan = (*NestedLoopJoinPlan)(nil)
+
+// NestedLoopJoinPlan 左側のレコードごとに右側を全て読み、結合条件を満たす組を返す
+// 結合条件に等号がなくても、どんな結合の種類でも使える
+type NestedLoopJoinPlan struct {
+	p1, p2   Plan
+	pred     *query.Predicate
+	joinType query.JoinType
+	schema   *record.Schema
+}
+
+func NewNestedLoopJoinPlan(p1, p2 Plan, pred *query.Predicate, joinType query.JoinType) *NestedLoopJoinPlan {
+	schema := record.NewSchema()
+	schema.AddAll(p1.Schema())
+	schema.AddAll(p2.Schema())
+	return &NestedLoopJoinPlan{p1, p2, pred, joinType, schema}
+}
+
+func (p *NestedLoopJoinPlan) Open() (query.Scan, error) {
+	s1, err := p.p1.Open()
+	if err != nil {
+		return nil, err
+	}
+	s2, err := p.p2.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewNestedLoopJoinScan(s1, s2, p.pred, p.joinType)
+}
+
+func (p *NestedLoopJoinPlan) BlocksAccessed() int32 {
+	return p.p1.BlocksAccessed() + (p.p1.RecordsOutput() * p.p2.BlocksAccessed())
+}
+
+func (p *NestedLoopJoinPlan) RecordsOutput() int32 {
+	output := p.p1.RecordsOutput() * p.p2.RecordsOutput() / p.pred.ReductionFactor(p)
+	switch p.joinType {
+	case query.LeftOuterJoin:
+		output = max(output, p.p1.RecordsOutput())
+	case query.FullOuterJoin:
+		output = max(output, p.p1.RecordsOutput()+p.p2.RecordsOutput())
+	}
+	return output
+}
+
+func (p *NestedLoopJoinPlan) DistinctValues(fieldName string) int32 {
+	if p.p1.Schema().HasField(fieldName) {
+		return p.p1.DistinctValues(fieldName)
+	}
+	return p.p2.DistinctValues(fieldName)
+}
+
+func (p *NestedLoopJoinPlan) Schema() *record.Schema {
+	return p.schema
+}
+
+func (p *NestedLoopJoinPlan) Tree() *PlanNode {
+	return NewPlanNode(joinName("NestedLoopJoin", p.joinType), p, []*PlanNode{p.p1.Tree(), p.p2.Tree()})
+}
+
+// joinName 計画の木に表示する結合の名前。外部結合には種類を付ける
+func joinName(name string, joinType query.JoinType) string {
+	if joinType == query.InnerJoin {
+		return name
+	}
+	return fmt.Sprintf("%s(%s)", name, joinType)
+}
@@ -0,0 +1,61 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/parse"
+	"simpledb/tx"
+	"slices"
+)
+
+// projectPlan AS を付けた列とウィンドウ関数を計算し、選択リストの列を取り出す。DISTINCT, ORDER BY と LIMIT もここで適用する
+// ORDER BY は列を取り出す前に並べるので、選択リストにない列でも並べられる
+// DISTINCT は取り出した後に重複を除くので、ORDER BY の列は選択リストになければならない
+func projectPlan(tx *tx.Transaction, p Plan, data *parse.QueryData) (Plan, error) {
+	p, err := extendPlan(p, data)
+	if err != nil {
+		return nil, err
+	}
+	if p, err = windowPlans(tx, p, data); err != nil {
+		return nil, err
+	}
+	if !data.Distinct && len(data.OrderBy) > 0 {
+		if p, err = orderPlan(tx, p, data); err != nil {
+			return nil, err
+		}
+	}
+	if p, err = NewProjectPlan(p, data.Fields); err != nil {
+		return nil, err
+	}
+	if data.Distinct {
+		for _, fieldName := range data.OrderBy {
+			if !slices.Contains(data.Fields, fieldName) {
+				return nil, fmt.Errorf("field %q of ORDER BY must be in the select list of SELECT DISTINCT", fieldName)
+			}
+		}
+		if p, err = NewDistinctPlan(tx, p, data.OrderBy, data.Descending); err != nil {
+			return nil, err
+		}
+	}
+	return limitPlan(p, data), nil
+}
+
+// orderPlan p を ORDER BY の列で並べる。LIMIT があれば、並べた先頭の LIMIT + OFFSET 件だけを保持する
+func orderPlan(tx *tx.Transaction, p Plan, data *parse.QueryData) (Plan, error) {
+	for _, fieldName := range data.OrderBy {
+		if !p.Schema().HasField(fieldName) {
+			return nil, fmt.Errorf("field %q of ORDER BY not found", fieldName)
+		}
+	}
+	if data.Limit != parse.NoLimit {
+		return NewTopNPlan(p, data.OrderBy, data.Descending, data.Limit+data.Offset), nil
+	}
+	return NewSortPlanWithOrder(tx, p, data.OrderBy, data.Descending)
+}
+
+// limitPlan LIMIT と OFFSET を適用する
+func limitPlan(p Plan, data *parse.QueryData) Plan {
+	if data.Limit == parse.NoLimit && data.Offset == 0 {
+		return p
+	}
+	return NewLimitPlan(p, data.Limit, data.Offset)
+}
@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+)
+
+// firstOuterJoin FROM句で最初に外部結合する表の位置。外部結合がなければ表の数
+// それより前の表は内部結合なので、結合の順序を変えられる
+func firstOuterJoin(data *parse.QueryData) int {
+	for i, ref := range data.Tables {
+		if data.Join(ref) != nil {
+			return i
+		}
+	}
+	return len(data.Tables)
+}
+
+// placeTerms 述語 pred の項を、FROM句の i 番目の表を結合した後に適用する項 steps[i] に分ける
+// 項は参照する列が揃った段で適用するが、後の右外部結合か完全外部結合で NULL になりうる列を参照する項は、その結合の後で適用する
+// どの段でも評価できない項は rest になる
+func placeTerms(data *parse.QueryData, pred *query.Predicate, schemas []*record.Schema) (steps []*query.Predicate, rest *query.Predicate) {
+	lastNull := -1
+	for i, ref := range data.Tables {
+		if j := data.Join(ref); j != nil && j.Type != parse.JoinLeft {
+			lastNull = i
+		}
+	}
+
+	steps = make([]*query.Predicate, len(schemas))
+	for i := range steps {
+		steps[i] = query.NewPredicate()
+	}
+	rest = query.NewPredicate()
+	for _, term := range pred.Terms() {
+		schema := record.NewSchema()
+		placed := false
+		for i, sch := range schemas {
+			schema.AddAll(sch)
+			if term.AppliesTo(schema) {
+				steps[max(i, lastNull)].ConjoinWith(query.NewPredicateWithTerm(term))
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			rest.ConjoinWith(query.NewPredicateWithTerm(term))
+		}
+	}
+	return steps, rest
+}
+
+// outerJoinSides 結合済みの計画 current と、外部結合 j の右側の表の計画 p を結合する左右の計画と結合の種類
+// 右外部結合は左右を入れ替えて左外部結合にする
+func outerJoinSides(current, p Plan, j *parse.JoinData) (lhs, rhs Plan, joinType query.JoinType) {
+	switch j.Type {
+	case parse.JoinRight:
+		return p, current, query.LeftOuterJoin
+	case parse.JoinFull:
+		return current, p, query.FullOuterJoin
+	}
+	return current, p, query.LeftOuterJoin
+}
+
+// equiJoinKey 結合条件 on の項のうち、左側 sch1 の列と右側 sch2 の列の等号を1つ選び、その列と残りの項を返す
+// そのような項がなければ ok が false になる
+func equiJoinKey(on *query.Predicate, sch1, sch2 *record.Schema) (fldName1, fldName2 string, rest *query.Predicate, ok bool) {
+	rest = query.NewPredicate()
+	for _, term := range on.Terms() {
+		if !ok && term.Op() == query.OpEquals && term.Lhs().IsFieldName() && term.Rhs().IsFieldName() {
+			lhs, rhs := term.Lhs().AsFieldName(), term.Rhs().AsFieldName()
+			switch {
+			case sch1.HasField(lhs) && sch2.HasField(rhs):
+				fldName1, fldName2, ok = lhs, rhs, true
+				continue
+			case sch1.HasField(rhs) && sch2.HasField(lhs):
+				fldName1, fldName2, ok = rhs, lhs, true
+				continue
+			}
+		}
+		rest.ConjoinWith(query.NewPredicateWithTerm(term))
+	}
+	return fldName1, fldName2, rest, ok
+}
+
+// splitTerms 述語 pred を、schema の列だけで評価できる項とそれ以外の項に分ける
+func splitTerms(pred *query.Predicate, schema *record.Schema) (applies, rest *query.Predicate) {
+	applies, rest = query.NewPredicate(), query.NewPredicate()
+	for _, term := range pred.Terms() {
+		if term.AppliesTo(schema) {
+			applies.ConjoinWith(query.NewPredicateWithTerm(term))
+		} else {
+			rest.ConjoinWith(query.NewPredicateWithTerm(term))
+		}
+	}
+	return applies, rest
+}
+
+// addSelect 述語 pred に項があれば、計画 p に適用する
+func addSelect(p Plan, pred *query.Predicate) (Plan, error) {
+	if len(pred.Terms()) == 0 {
+		return p, nil
+	}
+	return NewSelectPlan(p, pred)
+}
@@ -0,0 +1,101 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/record"
+	"simpledb/server"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverflow(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "overflow_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			fm := simpleDB.FileManager()
+			length := func(filename string) int32 {
+				n, err := fm.Length(filename)
+				require.NoError(t, err)
+				return n
+			}
+			big := func(i int) string {
+				return strings.Repeat(string(rune('a'+i%26)), 600+i)
+			}
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			require.NoError(t, exec("create table doc (id int, body varchar(1000)) using slotted"))
+			require.NoError(t, exec("create index doc_id_idx on doc (id)"))
+			for i := 1; i <= 10; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into doc (id, body) values (%d, '%s')", i, big(i))))
+			}
+			require.NoError(t, tx.Commit())
+			// 大きな文字列はオーバーフローファイルに格納し、レコードは1ブロックに収まる
+			assert.Equal(t, int32(1), length("doc.tbl"))
+			ovfBlocks := length(record.OverflowFile("doc"))
+			assert.Greater(t, ovfBlocks, int32(10))
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"'" + big(3) + "'"}, queryRows(t, planner, tx, "select body from doc where id = 3"))
+			assert.Equal(t, []int32{4}, queryInts(t, planner, tx, fmt.Sprintf("select id from doc where body = '%s'", big(4))))
+
+			// 小さな文字列に更新すればレコードに格納し、削除した文字列のブロックは再利用する
+			require.NoError(t, exec("update doc set body = 'small' where id = 5"))
+			require.NoError(t, exec("delete from doc where id = 6"))
+			require.NoError(t, exec(fmt.Sprintf("insert into doc (id, body) values (11, '%s')", big(11))))
+			require.NoError(t, exec(fmt.Sprintf("update doc set body = '%s' where id = 7", big(17))))
+			assert.Equal(t, []string{"'small'"}, queryRows(t, planner, tx, "select body from doc where id = 5"))
+			assert.Equal(t, []string{"'" + big(11) + "'"}, queryRows(t, planner, tx, "select body from doc where id = 11"))
+			assert.Equal(t, []string{"'" + big(17) + "'"}, queryRows(t, planner, tx, "select body from doc where id = 7"))
+			require.NoError(t, tx.Commit())
+			assert.Equal(t, ovfBlocks, length(record.OverflowFile("doc")))
+
+			// ロールバックすれば元の文字列に戻る
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec(fmt.Sprintf("update doc set body = '%s'", big(20))))
+			require.NoError(t, exec("delete from doc where id = 8"))
+			require.NoError(t, tx.Rollback())
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"'" + big(8) + "'"}, queryRows(t, planner, tx, "select body from doc where id = 8"))
+
+			// 表を書き直しても文字列は引き継ぎ、削除した文字列のブロックは切り詰める
+			require.NoError(t, exec("alter table doc add column note varchar(10)"))
+			for _, id := range []int{9, 10, 11} {
+				require.NoError(t, exec(fmt.Sprintf("delete from doc where id = %d", id)))
+			}
+			require.NoError(t, exec("vacuum doc"))
+			require.NoError(t, tx.Commit())
+			assert.Less(t, length(record.OverflowFile("doc")), ovfBlocks)
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []int32{1, 2, 3, 4, 5, 7, 8}, queryInts(t, planner, tx, "select id from doc"))
+			for _, i := range []int{1, 2, 3, 4, 8} {
+				assert.Equal(t, []string{fmt.Sprintf("'%s'|NULL", big(i))}, queryRows(t, planner, tx, fmt.Sprintf("select body, note from doc where id = %d", i)))
+			}
+			assert.Equal(t, []string{"'" + big(17) + "'"}, queryRows(t, planner, tx, "select body from doc where id = 7"))
+
+			// 表を削除すればオーバーフローファイルも削除する
+			require.NoError(t, exec("drop table doc"))
+			require.NoError(t, tx.Commit())
+			assert.Equal(t, int32(0), length(record.OverflowFile("doc")))
+		})
+	}
+}
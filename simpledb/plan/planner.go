@@ -17,6 +17,13 @@ type UpdatePlanner interface {
 	ExecuteCreateTable(createtabledata *parse.CreateTableData, tx *tx.Transaction) (int, error)
 	ExecuteCreateView(createviewdata *parse.CreateViewData, tx *tx.Transaction) (int, error)
 	ExecuteCreateIndex(createindexdata *parse.CreateIndexData, tx *tx.Transaction) (int, error)
+	ExecuteDropTable(droptabledata *parse.DropTableData, tx *tx.Transaction) (int, error)
+	ExecuteDropView(dropviewdata *parse.DropViewData, tx *tx.Transaction) (int, error)
+	ExecuteDropIndex(dropindexdata *parse.DropIndexData, tx *tx.Transaction) (int, error)
+	ExecuteAlterTable(altertabledata *parse.AlterTableData, tx *tx.Transaction) (int, error)
+	ExecuteVacuum(vacuumdata *parse.VacuumData, tx *tx.Transaction) (int, error)
+	ExecuteReindex(reindexdata *parse.ReindexData, tx *tx.Transaction) (int, error)
+	ExecuteCheckIndex(checkindexdata *parse.CheckIndexData, tx *tx.Transaction) (int, error)
 }
 
 type Planner struct {
@@ -78,17 +85,57 @@ func (p *Planner) ExecuteUpdate(cmd string, tx *tx.Transaction) (int, error) {
 		return p.updatePlanner.ExecuteCreateView(cmd, tx)
 	case *parse.CreateIndexData:
 		return p.updatePlanner.ExecuteCreateIndex(cmd, tx)
+	case *parse.DropTableData:
+		return p.updatePlanner.ExecuteDropTable(cmd, tx)
+	case *parse.DropViewData:
+		return p.updatePlanner.ExecuteDropView(cmd, tx)
+	case *parse.DropIndexData:
+		return p.updatePlanner.ExecuteDropIndex(cmd, tx)
+	case *parse.AlterTableData:
+		return p.updatePlanner.ExecuteAlterTable(cmd, tx)
+	case *parse.VacuumData:
+		return p.updatePlanner.ExecuteVacuum(cmd, tx)
+	case *parse.ReindexData:
+		return p.updatePlanner.ExecuteReindex(cmd, tx)
+	case *parse.CheckIndexData:
+		return p.updatePlanner.ExecuteCheckIndex(cmd, tx)
 	default:
 		return 0, fmt.Errorf("unexpected update command: %v", cmd)
 	}
 }
 
+// verifyQuery 集合演算の両側の問合せが同じ数の列を出力するかを確かめる。導出表と副問合せの中も確かめる
+// 列の型は計画を作成する時に確かめる
+// TODO 表と列が存在するかの確認も行う
 func (p *Planner) verifyQuery(queryData *parse.QueryData) error {
-	// TODO implement
+	if op := queryData.SetOp; op != nil {
+		// * と t.* の列の数は、計画を作成する時に確かめる
+		if !op.Lhs.HasAllColumns() && !op.Rhs.HasAllColumns() && len(op.Lhs.Fields) != len(op.Rhs.Fields) {
+			return fmt.Errorf("each side of %s must have the same number of columns: %d and %d", op.Op, len(op.Lhs.Fields), len(op.Rhs.Fields))
+		}
+		if err := p.verifyQuery(op.Lhs); err != nil {
+			return err
+		}
+		return p.verifyQuery(op.Rhs)
+	}
+	for _, d := range queryData.Derived {
+		if err := p.verifyQuery(d); err != nil {
+			return err
+		}
+	}
+	for _, sq := range queryData.Subqueries() {
+		if err := p.verifyQuery(sq.Query.(*parse.QueryData)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// verifyUpdate ビューの定義の問合せを verifyQuery で確かめる
+// TODO 他のコマンドの確認も行う
 func (p *Planner) verifyUpdate(updateCmd parse.UpdateCmd) error {
-	// TODO implement
+	if cmd, ok := updateCmd.(*parse.CreateViewData); ok {
+		return p.verifyQuery(cmd.QueryData)
+	}
 	return nil
 }
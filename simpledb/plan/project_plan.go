@@ -16,7 +16,9 @@ type ProjectPlan struct {
 func NewProjectPlan(p Plan, fieldList []string) (*ProjectPlan, error) {
 	sch := record.NewSchema()
 	for _, field := range fieldList {
-		// TODO check if the field exists in the underlying Schema
+		if !p.Schema().HasField(field) {
+			return nil, fmt.Errorf("field %q not found", field)
+		}
 		sch.Add(field, p.Schema())
 	}
 	return &ProjectPlan{p, sch}, nil
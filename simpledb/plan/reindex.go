@@ -0,0 +1,81 @@
+package plan
+
+import (
+	"cmp"
+	"fmt"
+	"simpledb/index/btree"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/tx"
+	"slices"
+)
+
+// reindex REINDEX文で指定された索引、または表の全ての索引を空にして、表のレコードから作り直す
+// 空にするのも作り直すのも同じトランザクションの中で行うので、ロールバックすれば元の索引に戻る
+// 索引を保守しない計画でも作り直すが、その後の更新は索引に反映されない
+func reindex(mdm *metadata.Manager, data *parse.ReindexData, tx *tx.Transaction) error {
+	tableName, indexes, err := targetIndexes(mdm, data.IndexName, data.TableName, tx)
+	if err != nil {
+		return err
+	}
+	for _, ii := range indexes {
+		if err := rebuildIndex(mdm, tableName, ii, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetIndexes 索引 indexName、indexName が空なら表 tableName の全ての索引を名前の順に返す。索引の表の名前も返す
+func targetIndexes(mdm *metadata.Manager, indexName string, tableName string, tx *tx.Transaction) (string, []*metadata.IndexInfo, error) {
+	if indexName != "" {
+		var err error
+		if tableName, err = mdm.GetIndexTable(indexName, tx); err != nil {
+			return "", nil, err
+		}
+		if tableName == "" {
+			return "", nil, fmt.Errorf("index %q does not exist", indexName)
+		}
+	} else {
+		layout, err := mdm.GetLayout(tableName, tx)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(layout.Schema().Fields()) == 0 {
+			return "", nil, fmt.Errorf("table %q does not exist", tableName)
+		}
+	}
+
+	indexes, err := mdm.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return "", nil, err
+	}
+	var result []*metadata.IndexInfo
+	for _, ii := range indexes {
+		if indexName == "" || ii.IndexName() == indexName {
+			result = append(result, ii)
+		}
+	}
+	if len(result) == 0 && indexName != "" {
+		return "", nil, fmt.Errorf("index %q does not exist", indexName)
+	}
+	slices.SortFunc(result, func(a, b *metadata.IndexInfo) int {
+		return cmp.Compare(a.IndexName(), b.IndexName())
+	})
+	return tableName, result, nil
+}
+
+// rebuildIndex 索引の全てのエントリを削除し、表 tableName の全てのレコードのエントリを作り直す
+// B-tree 索引は作った時の充填率を記録していないので、既定の充填率で詰める
+func rebuildIndex(mdm *metadata.Manager, tableName string, ii *metadata.IndexInfo, tx *tx.Transaction) error {
+	idx, err := ii.Open()
+	if err != nil {
+		return err
+	}
+	err = idx.Clear()
+	idx.Close()
+	if err != nil {
+		return err
+	}
+	return buildIndex(mdm, tableName, ii, btree.DefaultFillFactor, tx)
+}
@@ -0,0 +1,174 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/index/btree"
+	"simpledb/plan"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReindex(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "reindex_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			mdm := simpleDB.MetadataManager()
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			// problems 表 item の索引の不整合を、索引の名前、種類、キー、RID で表したもの
+			problems := func() []string {
+				t.Helper()
+				found, err := plan.CheckIndexes(mdm, "item", tx)
+				require.NoError(t, err)
+				result := make([]string, len(found))
+				for i, p := range found {
+					result[i] = fmt.Sprintf("%s %s %s %s", p.IndexName, p.Kind, p.Key, p.RID)
+				}
+				return result
+			}
+
+			require.NoError(t, exec("create table item (id int, name varchar(10))"))
+			require.NoError(t, exec("create index item_id_idx on item (id) include (name)"))
+			require.NoError(t, exec("create index item_name_idx on item (name) using hash"))
+			for i := 1; i <= 100; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into item (id, name) values (%d, 'item%d')", i, i)))
+			}
+			require.NoError(t, exec("delete from item where id = 10"))
+			require.NoError(t, exec("create index item_pair_idx on item (name, id)"))
+			require.NoError(t, tx.Commit())
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+
+			assert.Error(t, exec("reindex index item_bad_idx"))
+			assert.Error(t, exec("reindex table bad"))
+			assert.Error(t, exec("check index item_bad_idx"))
+			assert.Error(t, exec("check table bad"))
+			_, err = plan.CheckIndexes(mdm, "bad", tx)
+			assert.Error(t, err)
+
+			if name == "basic" {
+				// 索引を保守しない計画では、表のどのレコードのエントリもないが、REINDEX で作り直せる
+				found := problems()
+				assert.Len(t, found, 3*99)
+				for _, p := range found {
+					assert.Contains(t, p, " missing ")
+				}
+				var checkErr *plan.IndexCheckError
+				require.ErrorAs(t, exec("check table item"), &checkErr)
+				assert.Len(t, checkErr.Problems, 3*99)
+				require.NoError(t, exec("reindex index item_id_idx"))
+				require.NoError(t, exec("check index item_id_idx"))
+				assert.Error(t, exec("check table item"))
+				require.NoError(t, exec("reindex table item"))
+				require.NoError(t, exec("check table item"))
+				assert.Empty(t, problems())
+				assert.Equal(t, []string{"'item5'"}, queryRows(t, planner, tx, "select name from item where id = 5"))
+				require.NoError(t, tx.Commit())
+				return
+			}
+			assert.Empty(t, problems())
+			require.NoError(t, exec("check table item"))
+
+			// 索引のエントリを直接書き換えて、表と食い違わせる
+			indexes, err := mdm.GetIndexInfo("item", tx)
+			require.NoError(t, err)
+			idIdx, err := indexes["id"].Open()
+			require.NoError(t, err)
+			ridOf := func(id int32) *record.RID {
+				require.NoError(t, idIdx.BeforeFirst(query.NewConstantWithInt(id)))
+				next, err := idIdx.Next()
+				require.NoError(t, err)
+				require.True(t, next)
+				rid, err := idIdx.GetDataRID()
+				require.NoError(t, err)
+				return rid
+			}
+			rid5, rid7, rid8 := ridOf(5), ridOf(7), ridOf(8)
+			require.NoError(t, idIdx.Delete(query.NewConstantWithInt(5), rid5))
+			require.NoError(t, idIdx.Insert(query.NewConstantWithInt(7), rid7))
+			require.NoError(t, idIdx.Insert(query.NewConstantWithInt(1000), rid8))
+			require.NoError(t, idIdx.Close())
+			nameIdx, err := indexes["name"].Open()
+			require.NoError(t, err)
+			ghost := record.NewRID(500, 0)
+			require.NoError(t, nameIdx.Insert(query.NewConstantWithString("ghost"), ghost))
+			require.NoError(t, nameIdx.Close())
+			require.NoError(t, tx.Commit())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			corrupted := []string{
+				fmt.Sprintf("item_id_idx missing 5 %s", rid5),
+				fmt.Sprintf("item_id_idx duplicated 7 %s", rid7),
+				fmt.Sprintf("item_id_idx dangling 1000 %s", rid8),
+				fmt.Sprintf("item_name_idx dangling 'ghost' %s", ghost),
+			}
+			assert.Equal(t, corrupted, problems())
+			assert.Empty(t, queryRows(t, planner, tx, "select name from item where id = 5"))
+			// CHECK文は不整合を全て挙げたエラーを返す
+			var checkErr *plan.IndexCheckError
+			require.ErrorAs(t, exec("check table item"), &checkErr)
+			assert.Len(t, checkErr.Problems, 4)
+			assert.ErrorContains(t, checkErr, fmt.Sprintf("index item_id_idx: missing entry with key 5 for %s", rid5))
+			assert.ErrorContains(t, checkErr, fmt.Sprintf("index item_name_idx: dangling entry with key 'ghost' for %s", ghost))
+			require.ErrorAs(t, exec("check index item_name_idx"), &checkErr)
+			assert.Len(t, checkErr.Problems, 1)
+			require.NoError(t, exec("check index item_pair_idx"))
+
+			// 作り直した索引はロールバックで元に戻る
+			require.NoError(t, exec("reindex table item"))
+			assert.Empty(t, problems())
+			require.NoError(t, tx.Rollback())
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, corrupted, problems())
+
+			require.NoError(t, exec("reindex index item_id_idx"))
+			assert.Equal(t, corrupted[3:], problems())
+			require.NoError(t, exec("check index item_id_idx"))
+			require.NoError(t, exec("reindex index item_name_idx"))
+			require.NoError(t, tx.Commit())
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Empty(t, problems())
+			require.NoError(t, exec("check table item"))
+			indexes, err = mdm.GetIndexInfo("item", tx)
+			require.NoError(t, err)
+			for _, ii := range indexes {
+				idx, err := ii.Open()
+				require.NoError(t, err)
+				if bi, ok := idx.(*btree.BTreeIndex); ok {
+					assert.NoError(t, bi.Check(), ii.IndexName())
+				}
+				require.NoError(t, idx.Close())
+			}
+			assert.Equal(t, []string{"'item5'"}, queryRows(t, planner, tx, "select name from item where id = 5"))
+			assert.Equal(t, []string{"7"}, queryRows(t, planner, tx, "select id from item where name = 'item7'"))
+			assert.Empty(t, queryRows(t, planner, tx, "select id from item where id = 1000"))
+
+			// 作り直した索引も、その後の更新で保守される
+			require.NoError(t, exec("update item set name = 'renamed' where id = 8"))
+			require.NoError(t, exec("delete from item where id = 9"))
+			require.NoError(t, exec("insert into item (id, name) values (200, 'item200')"))
+			assert.Empty(t, problems())
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
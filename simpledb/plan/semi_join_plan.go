@@ -0,0 +1,80 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+var _ Plan = (*SemiJoinPlan)(nil)
+
+// SemiJoinPlan p のレコードのうち、列 fields の値の組が sub の列 subFields の値の組と一致するものを返す
+// IN と EXISTS の副問合せを、外側のレコードごとに実行せずに済ませるために使う
+// sub の結合キーはメモリ上の集合に読み込む
+type SemiJoinPlan struct {
+	tx        *tx.Transaction
+	p, sub    Plan
+	fields    []string
+	subFields []string
+}
+
+func NewSemiJoinPlan(tx *tx.Transaction, p, sub Plan, fields, subFields []string) *SemiJoinPlan {
+	return &SemiJoinPlan{
+		tx:        tx,
+		p:         p,
+		sub:       sub,
+		fields:    fields,
+		subFields: subFields,
+	}
+}
+
+func (sjp *SemiJoinPlan) Open() (query.Scan, error) {
+	keys := query.NewValueSet()
+	subScan, err := sjp.sub.Open()
+	if err != nil {
+		return nil, fmt.Errorf("sjp.sub.Open: %w", err)
+	}
+	defer subScan.Close()
+	for {
+		next, err := subScan.Next()
+		if err != nil {
+			return nil, fmt.Errorf("subScan.Next: %w", err)
+		}
+		if !next {
+			break
+		}
+		key, err := query.JoinKey(subScan, sjp.subFields)
+		if err != nil {
+			return nil, fmt.Errorf("query.JoinKey: %w", err)
+		}
+		keys.Add(key)
+	}
+
+	s, err := sjp.p.Open()
+	if err != nil {
+		return nil, fmt.Errorf("sjp.p.Open: %w", err)
+	}
+	return query.NewSemiJoinScan(s, sjp.fields, keys), nil
+}
+
+func (sjp *SemiJoinPlan) BlocksAccessed() int32 {
+	return sjp.p.BlocksAccessed() + sjp.sub.BlocksAccessed()
+}
+
+// RecordsOutput 準結合はレコードを増やさないので、p のレコード数を上限として見積もる
+func (sjp *SemiJoinPlan) RecordsOutput() int32 {
+	return sjp.p.RecordsOutput()
+}
+
+func (sjp *SemiJoinPlan) DistinctValues(fieldName string) int32 {
+	return sjp.p.DistinctValues(fieldName)
+}
+
+func (sjp *SemiJoinPlan) Schema() *record.Schema {
+	return sjp.p.Schema()
+}
+
+func (sjp *SemiJoinPlan) Tree() *PlanNode {
+	return NewPlanNode(fmt.Sprintf("SemiJoin(%v = %v)", sjp.fields, sjp.subFields), sjp, []*PlanNode{sjp.p.Tree(), sjp.sub.Tree()})
+}
@@ -0,0 +1,156 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+var _ Plan = (*SetOpPlan)(nil)
+
+// SetOpPlan 左右の計画を全ての列でソートして併合し、重複を除いた UNION, INTERSECT, EXCEPT の結果を返す
+type SetOpPlan struct {
+	p1, p2 Plan
+	s1, s2 *SortPlan
+	op     query.SetOp
+	schema *record.Schema
+}
+
+func NewSetOpPlan(tx *tx.Transaction, p1, p2 Plan, op query.SetOp) (*SetOpPlan, error) {
+	schema, err := setOpSchema(p1, p2)
+	if err != nil {
+		return nil, err
+	}
+	s1, err := NewSortPlan(tx, p1, p1.Schema().Fields())
+	if err != nil {
+		return nil, err
+	}
+	s2, err := NewSortPlan(tx, p2, p2.Schema().Fields())
+	if err != nil {
+		return nil, err
+	}
+	return &SetOpPlan{
+		p1:     p1,
+		p2:     p2,
+		s1:     s1,
+		s2:     s2,
+		op:     op,
+		schema: schema,
+	}, nil
+}
+
+// createSetOpPlan 集合演算の問合せ data の計画を作成する。左右の問合せの計画は qp で作成する
+// ORDER BY と LIMIT は集合演算の結果に適用する
+func createSetOpPlan(qp QueryPlanner, data *parse.QueryData, tx *tx.Transaction) (Plan, error) {
+	p, err := setOpPlan(qp, data, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.OrderBy) > 0 {
+		if p, err = orderPlan(tx, p, data); err != nil {
+			return nil, err
+		}
+	}
+	return limitPlan(p, data), nil
+}
+
+func setOpPlan(qp QueryPlanner, data *parse.QueryData, tx *tx.Transaction) (Plan, error) {
+	p1, err := qp.CreatePlan(data.SetOp.Lhs, tx)
+	if err != nil {
+		return nil, err
+	}
+	p2, err := qp.CreatePlan(data.SetOp.Rhs, tx)
+	if err != nil {
+		return nil, err
+	}
+	switch data.SetOp.Op {
+	case parse.SetUnion:
+		if data.SetOp.All {
+			return NewUnionPlan(p1, p2)
+		}
+		return NewSetOpPlan(tx, p1, p2, query.Union)
+	case parse.SetIntersect:
+		return NewSetOpPlan(tx, p1, p2, query.Intersect)
+	case parse.SetExcept:
+		return NewSetOpPlan(tx, p1, p2, query.Except)
+	}
+	return nil, fmt.Errorf("unexpected set operation: %s", data.SetOp.Op)
+}
+
+// setOpSchema 集合演算の結果のスキーマ。列名は左側のものを使う
+// 左右の列は位置で対応させるので、列の数と型が一致しなければならない。文字列の長さは長い方に合わせる
+func setOpSchema(p1, p2 Plan) (*record.Schema, error) {
+	sch1, sch2 := p1.Schema(), p2.Schema()
+	fields1, fields2 := sch1.Fields(), sch2.Fields()
+	if len(fields1) != len(fields2) {
+		return nil, fmt.Errorf("each side of a set operation must have the same number of columns: %d and %d", len(fields1), len(fields2))
+	}
+	schema := record.NewSchema()
+	for i, f1 := range fields1 {
+		f2 := fields2[i]
+		if sch1.Type(f1) != sch2.Type(f2) {
+			return nil, fmt.Errorf("column %d of a set operation has different types: %q and %q", i+1, f1, f2)
+		}
+		schema.AddField(f1, sch1.Type(f1), max(sch1.Length(f1), sch2.Length(f2)))
+	}
+	return schema, nil
+}
+
+func (p *SetOpPlan) Open() (query.Scan, error) {
+	s1, err := p.s1.Open()
+	if err != nil {
+		return nil, err
+	}
+	s2, err := p.s2.Open()
+	if err != nil {
+		s1.Close()
+		return nil, err
+	}
+	return query.NewSetOpScan(s1, s2, p.p1.Schema().Fields(), p.p2.Schema().Fields(), p.op)
+}
+
+func (p *SetOpPlan) BlocksAccessed() int32 {
+	return p.s1.BlocksAccessed() + p.s2.BlocksAccessed()
+}
+
+func (p *SetOpPlan) RecordsOutput() int32 {
+	switch p.op {
+	case query.Intersect:
+		return min(p.p1.RecordsOutput(), p.p2.RecordsOutput())
+	case query.Except:
+		return p.p1.RecordsOutput()
+	}
+	return p.p1.RecordsOutput() + p.p2.RecordsOutput()
+}
+
+func (p *SetOpPlan) DistinctValues(fieldName string) int32 {
+	d1 := p.p1.DistinctValues(fieldName)
+	d2 := p.p2.DistinctValues(rhsField(p.p1, p.p2, fieldName))
+	switch p.op {
+	case query.Intersect:
+		return min(d1, d2)
+	case query.Except:
+		return d1
+	}
+	return d1 + d2
+}
+
+// rhsField 左側の列 fieldName に位置で対応する右側の列
+func rhsField(p1, p2 Plan, fieldName string) string {
+	for i, f := range p1.Schema().Fields() {
+		if f == fieldName {
+			return p2.Schema().Fields()[i]
+		}
+	}
+	return fieldName
+}
+
+func (p *SetOpPlan) Schema() *record.Schema {
+	return p.schema
+}
+
+func (p *SetOpPlan) Tree() *PlanNode {
+	return NewPlanNode(fmt.Sprintf("SetOp(%s)", p.op), p, []*PlanNode{p.s1.Tree(), p.s2.Tree()})
+}
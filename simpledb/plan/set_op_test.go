@@ -0,0 +1,80 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetOp(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "set_op_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10), majorid int)"))
+			require.NoError(t, exec("create table alumni (aid int, aname varchar(20), majorid int)"))
+			for i, majorid := range []string{"10", "20", "10", "null", "null"} {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid) values (%d, 'name%d', %s)", i+1, i+1, majorid)))
+			}
+			for i, majorid := range []string{"20", "30", "30", "null"} {
+				require.NoError(t, exec(fmt.Sprintf("insert into alumni (aid, aname, majorid) values (%d, 'alumnus%d', %s)", i+3, i+3, majorid)))
+			}
+
+			// UNION は重複を除き、UNION ALL は除かない。NULL 同士は重複とみなす
+			assert.ElementsMatch(t, []string{"10", "20", "30", "NULL"}, queryRows(t, planner, tx, "select majorid from student union select majorid from alumni"))
+			assert.Len(t, queryRows(t, planner, tx, "select majorid from student union all select majorid from alumni"), 9)
+			assert.ElementsMatch(t, []string{"20", "NULL"}, queryRows(t, planner, tx, "select majorid from student intersect select majorid from alumni"))
+			assert.ElementsMatch(t, []string{"10"}, queryRows(t, planner, tx, "select majorid from student except select majorid from alumni"))
+			assert.ElementsMatch(t, []string{"30"}, queryRows(t, planner, tx, "select majorid from alumni except select majorid from student"))
+
+			// 列は位置で対応させ、列名は左側のものを使う
+			p, err := planner.CreateQueryPlan("select sid, sname from student where sid = 3 union select aid, aname from alumni where aid = 3", tx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"sid", "sname"}, p.Schema().Fields())
+			assert.ElementsMatch(t, []string{"3|'name3'", "3|'alumnus3'"}, queryRows(t, planner, tx, "select sid, sname from student where sid = 3 union select aid, aname from alumni where aid = 3"))
+			assert.ElementsMatch(t, []string{"3|'name3'", "3|'alumnus3'"}, queryRows(t, planner, tx, "select sid, sname from student where sid = 3 union all select aid, aname from alumni where aid = 3"))
+
+			// INTERSECT は UNION と EXCEPT より先に適用する
+			assert.ElementsMatch(t, []string{"10", "20"}, queryRows(t, planner, tx, "select majorid from student where sid = 1 union select majorid from student intersect select majorid from alumni where aid = 3"))
+			assert.ElementsMatch(t, []string{"20"}, queryRows(t, planner, tx, "select majorid from student except select majorid from student where sid = 1 except select majorid from alumni where aid = 6"))
+
+			// 導出表、ビューと副問合せに使える
+			assert.ElementsMatch(t, []string{"10", "20", "30"}, queryRows(t, planner, tx, "select m from (select majorid as m from student union select majorid from alumni) as t where m in (select majorid from student union select majorid from alumni)"))
+			require.NoError(t, exec("create view majors as select majorid from student union select majorid from alumni"))
+			assert.ElementsMatch(t, []string{"10", "20", "30", "NULL"}, queryRows(t, planner, tx, "select majorid from majors"))
+			assert.ElementsMatch(t, []string{"'name2'"}, queryRows(t, planner, tx, "select sname from student s, majors m where s.majorid = m.majorid and m.majorid = 20"))
+			assert.ElementsMatch(t, []string{"1", "3"}, queryRows(t, planner, tx, "select sid from student where majorid in (select majorid from student except select majorid from alumni)"))
+			assert.Error(t, exec("insert into majors (majorid) values (40)"))
+			assert.Error(t, exec("create view broken as select sid from student union select nosuch from alumni"))
+
+			// 列の数と型が一致しなければエラー
+			assert.Error(t, queryError(planner, tx, "select sid, sname from student union select aid from alumni"))
+			assert.Error(t, exec("create view broken as select sid from student except select aid, aname from alumni"))
+			assert.Error(t, queryError(planner, tx, "select sid from student intersect select aname from alumni"))
+
+			if name == "optimized" {
+				tree := planTree(t, planner, tx, "select majorid from student union select majorid from alumni")
+				assert.Contains(t, tree, "SetOp(union)")
+				assert.Contains(t, tree, "Sort")
+			}
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/server"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlottedTable(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "slotted_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			// 1ブロックに収まらない長さの列も宣言できる
+			require.NoError(t, exec("create table note (id int, body varchar(300), tag varchar(10)) using slotted"))
+			require.NoError(t, exec("create index note_id_idx on note (id)"))
+			for i := 1; i <= 30; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into note (id, body, tag) values (%d, 'note%d', 't%d')", i, i, i%3)))
+			}
+
+			// 伸びたレコードは別のブロックに移るが、索引からも辿れる
+			long := strings.Repeat("x", 150)
+			require.NoError(t, exec(fmt.Sprintf("update note set body = '%s' where tag = 't1'", long)))
+			require.NoError(t, exec("insert into note (id, body, tag) values (31, '"+long+"', 't2')"))
+			assert.Equal(t, []string{"'" + long + "'"}, queryRows(t, planner, tx, "select body from note where id = 4"))
+			assert.Equal(t, []string{"'" + long + "'"}, queryRows(t, planner, tx, "select body from note where id = 31"))
+			assert.Equal(t, []string{"'note3'"}, queryRows(t, planner, tx, "select body from note where id = 3"))
+			assert.Len(t, queryInts(t, planner, tx, "select id from note"), 31)
+
+			// 移したレコードを縮めたり削除したりしても、件数は変わらない
+			require.NoError(t, exec("update note set body = 'short' where id = 7"))
+			assert.Equal(t, []string{"'short'|'t1'"}, queryRows(t, planner, tx, "select body, tag from note where id = 7"))
+			require.NoError(t, exec("delete from note where tag = 't1'"))
+			assert.Len(t, queryInts(t, planner, tx, "select id from note"), 21)
+			assert.Empty(t, queryRows(t, planner, tx, "select id from note where id = 4"))
+
+			// ALTER TABLE で作り直しても形式は変わらない
+			require.NoError(t, exec("alter table note add column extra varchar(200)"))
+			require.NoError(t, exec(fmt.Sprintf("update note set extra = '%s' where id = 2", strings.Repeat("y", 100))))
+			assert.Equal(t, []string{"'note2'|'" + strings.Repeat("y", 100) + "'"}, queryRows(t, planner, tx, "select body, extra from note where id = 2"))
+			assert.Len(t, queryInts(t, planner, tx, "select id from note"), 21)
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
@@ -20,13 +20,18 @@ type SortPlan struct {
 }
 
 func NewSortPlan(tx *tx.Transaction, plan Plan, sortFields []string) (*SortPlan, error) {
+	return NewSortPlanWithOrder(tx, plan, sortFields, nil)
+}
+
+// NewSortPlanWithOrder descending[i] が true の列 sortFields[i] を降順に並べる
+func NewSortPlanWithOrder(tx *tx.Transaction, plan Plan, sortFields []string, descending []bool) (*SortPlan, error) {
 	return &SortPlan{
 		logger: logger.New("plan.SortPlan", logger.Trace),
 
 		plan:   plan,
 		tx:     tx,
 		schema: plan.Schema(),
-		comp:   query.NewRecordComparator(sortFields),
+		comp:   query.NewRecordComparatorWithOrder(sortFields, descending),
 	}, nil
 }
 
@@ -86,8 +91,9 @@ func (sp *SortPlan) splitIntoRuns(src query.Scan) ([]*query.TempTable, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 空の入力は、空の run を1つ返す
 	if !next {
-		return temps, nil
+		return append(temps, query.NewTempTable(sp.tx, sp.schema)), nil
 	}
 
 	currentTemp := query.NewTempTable(sp.tx, sp.schema)
@@ -0,0 +1,289 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+)
+
+var _ query.SubqueryPlan = (*subqueryPlan)(nil)
+
+// subqueryPlan 副問合せの計画
+// 副問合せの述語のうち、副問合せの表だけで評価できる項は plan に含める
+// 外側の問合せの列を参照する項 correlated は、外側の問合せのレコードごとに評価する
+type subqueryPlan struct {
+	plan        Plan
+	correlated  *query.Predicate
+	field       string
+	outerFields []string
+	// outerNames 副問合せの中で書かれた外側の列名から、外側の問合せでの列名への対応。名前が同じ列は含まない
+	outerNames map[string]string
+}
+
+func (sp *subqueryPlan) Open(outer query.Scan) (query.Scan, error) {
+	s, err := sp.plan.Open()
+	if err != nil {
+		return nil, err
+	}
+	if len(sp.correlated.Terms()) == 0 {
+		return s, nil
+	}
+	return query.NewSelectScan(query.NewCorrelatedScan(s, outer, sp.outerNames), sp.correlated), nil
+}
+
+func (sp *subqueryPlan) Field() string {
+	return sp.field
+}
+
+func (sp *subqueryPlan) OuterFields() []string {
+	return sp.outerFields
+}
+
+// semiJoinKeys 副問合せが外側の問合せと等号だけで相関していれば、結合する外側の列と副問合せの列の組を返す
+// そうでなければ ok が false になる
+func (sp *subqueryPlan) semiJoinKeys() (outerKeys []string, innerKeys []string, ok bool) {
+	schema := sp.plan.Schema()
+	for _, term := range sp.correlated.Terms() {
+		if term.Op() != query.OpEquals || !term.Lhs().IsFieldName() || !term.Rhs().IsFieldName() {
+			return nil, nil, false
+		}
+		lhs, rhs := term.Lhs().AsFieldName(), term.Rhs().AsFieldName()
+		switch {
+		case schema.HasField(lhs) && !schema.HasField(rhs):
+			outerKeys, innerKeys = append(outerKeys, sp.outerName(rhs)), append(innerKeys, lhs)
+		case schema.HasField(rhs) && !schema.HasField(lhs):
+			outerKeys, innerKeys = append(outerKeys, sp.outerName(lhs)), append(innerKeys, rhs)
+		default:
+			return nil, nil, false
+		}
+	}
+	return outerKeys, innerKeys, true
+}
+
+// outerName 副問合せの中で書かれた外側の列 fieldName の、外側の問合せでの列名
+func (sp *subqueryPlan) outerName(fieldName string) string {
+	if name, ok := sp.outerNames[fieldName]; ok {
+		return name
+	}
+	return fieldName
+}
+
+// planSubqueries 問合せ data の選択リスト、外部結合の述語と述語に含まれる副問合せの計画を作成する
+// schema は data の表の列で、副問合せが参照する外側の列は schema になければならない
+// names は参照で修飾した data の列名 (s.sid) から、data の中での列名への対応
+func planSubqueries(qp QueryPlanner, mdm *metadata.Manager, data *parse.QueryData, schema *record.Schema, names map[string]string, tx *tx.Transaction) error {
+	var exprs []*query.Expression
+	for _, fieldName := range data.Fields {
+		if e, ok := data.Exprs[fieldName]; ok {
+			exprs = append(exprs, e)
+		}
+	}
+	for _, j := range data.Joins {
+		if err := bindSubqueries(qp, mdm, j.On, nil, schema, names, tx); err != nil {
+			return err
+		}
+	}
+	return bindSubqueries(qp, mdm, data.Pred, exprs, schema, names, tx)
+}
+
+// bindSubqueries 述語 pred と式 exprs に含まれる副問合せの計画を作成する
+// 副問合せが表名か別名で修飾して参照する外側の列は、names で外側の問合せでの列名にする
+func bindSubqueries(qp QueryPlanner, mdm *metadata.Manager, pred *query.Predicate, exprs []*query.Expression, schema *record.Schema, names map[string]string, tx *tx.Transaction) error {
+	// 値として使う副問合せは1つの列を出力しなければならない
+	var scalars []*query.Expression
+	for _, term := range pred.Terms() {
+		if term.Op() == query.OpEquals {
+			scalars = append(scalars, term.Lhs())
+		}
+		if term.Op() != query.OpExists {
+			scalars = append(scalars, term.Rhs())
+		}
+	}
+	for _, e := range slices.Concat(exprs, scalars) {
+		if !e.IsSubquery() {
+			continue
+		}
+		data := e.AsSubquery().Query.(*parse.QueryData)
+		if len(data.Fields) != 1 {
+			return fmt.Errorf("subquery must return only one column: %s", e)
+		}
+	}
+
+	var subqueries []*query.Subquery
+	for _, e := range exprs {
+		if e.IsSubquery() {
+			subqueries = append(subqueries, e.AsSubquery())
+		}
+	}
+	subqueries = append(subqueries, pred.Subqueries()...)
+	for _, sq := range subqueries {
+		if sq.Plan() != nil {
+			continue
+		}
+		sp, err := newSubqueryPlan(qp, mdm, sq.Query.(*parse.QueryData), tx)
+		if err != nil {
+			return err
+		}
+		for i, fieldName := range sp.outerFields {
+			if name, ok := names[fieldName]; ok && name != fieldName {
+				sp.outerNames[fieldName] = name
+				sp.outerFields[i] = name
+			}
+		}
+		sq.Bind(sp)
+		for _, fieldName := range sp.outerFields {
+			if schema != nil && !schema.HasField(fieldName) {
+				return fmt.Errorf("field %q not found in subquery %s", fieldName, sq)
+			}
+		}
+	}
+	return nil
+}
+
+// newSubqueryPlan 副問合せ data の計画を作成する
+// 集合演算、LIMIT とウィンドウ関数のある副問合せは、外側の問合せと相関しないものとして計画する
+func newSubqueryPlan(qp QueryPlanner, mdm *metadata.Manager, data *parse.QueryData, tx *tx.Transaction) (*subqueryPlan, error) {
+	if data.SetOp != nil || data.Limit != parse.NoLimit || data.Offset > 0 || len(data.Windows) > 0 {
+		p, err := qp.CreatePlan(data, tx)
+		if err != nil {
+			return nil, err
+		}
+		return &subqueryPlan{
+			plan:       p,
+			correlated: query.NewPredicate(),
+			field:      p.Schema().Fields()[0],
+			outerNames: make(map[string]string),
+		}, nil
+	}
+	expanded, err := expandViews(mdm, data, tx)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := tableRefs(mdm, expanded, tx)
+	if err != nil {
+		return nil, err
+	}
+	names := exposedNames(refs)
+	schema, err := refsSchema(mdm, refs, names, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 入れ子の副問合せが参照する列は、この副問合せか、さらに外側の問合せにある
+	if err := planSubqueries(qp, mdm, expanded, nil, names, tx); err != nil {
+		return nil, err
+	}
+	for _, e := range expanded.Exprs {
+		if !e.AppliesTo(schema) {
+			return nil, fmt.Errorf("column %s of a subquery cannot refer to an outer query", e)
+		}
+	}
+
+	local := query.NewPredicate()
+	correlated := query.NewPredicate()
+	for _, term := range expanded.Pred.Terms() {
+		if term.AppliesTo(schema) {
+			local.ConjoinWith(query.NewPredicateWithTerm(term))
+		} else {
+			correlated.ConjoinWith(query.NewPredicateWithTerm(term))
+		}
+	}
+	// 相関のある項が参照する列のうち、副問合せの表にないものが外側の問合せの列
+	fields := slices.Clone(expanded.Fields)
+	var outerFields []string
+	referenced := correlated.FieldNames()
+	for _, sq := range correlated.Subqueries() {
+		referenced = append(referenced, sq.OuterFields()...)
+	}
+	for _, fieldName := range referenced {
+		if schema.HasField(fieldName) {
+			if !slices.Contains(fields, fieldName) {
+				fields = append(fields, fieldName)
+			}
+		} else if !slices.Contains(outerFields, fieldName) {
+			outerFields = append(outerFields, fieldName)
+		}
+	}
+
+	localData := *expanded
+	localData.Fields = fields
+	localData.Pred = local
+	p, err := qp.CreatePlan(&localData, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &subqueryPlan{
+		plan:        p,
+		correlated:  correlated,
+		field:       expanded.Fields[0],
+		outerFields: outerFields,
+		outerNames:  make(map[string]string),
+	}, nil
+}
+
+// decorrelate 述語の IN と EXISTS の項のうち、等号だけで相関する副問合せを準結合に書き換える
+// 準結合にした項を除いた述語と、準結合を適用する関数を返す
+func decorrelate(tx *tx.Transaction, pred *query.Predicate, schema *record.Schema) (*query.Predicate, func(Plan) Plan) {
+	rest := query.NewPredicate()
+	var joins []func(Plan) Plan
+	for _, term := range pred.Terms() {
+		if term.Op() == query.OpEquals {
+			rest.ConjoinWith(query.NewPredicateWithTerm(term))
+			continue
+		}
+		sp, ok := term.Rhs().AsSubquery().Plan().(*subqueryPlan)
+		if !ok {
+			rest.ConjoinWith(query.NewPredicateWithTerm(term))
+			continue
+		}
+		outerKeys, innerKeys, ok := sp.semiJoinKeys()
+		if term.Op() == query.OpIn {
+			if !term.Lhs().IsFieldName() {
+				ok = false
+			}
+			if ok {
+				outerKeys = append(outerKeys, term.Lhs().AsFieldName())
+				innerKeys = append(innerKeys, sp.field)
+			}
+		}
+		for _, fieldName := range outerKeys {
+			if !schema.HasField(fieldName) {
+				ok = false
+			}
+		}
+		// 相関のない EXISTS は一度だけ評価すればよいので、そのまま残す
+		if !ok || len(outerKeys) == 0 {
+			rest.ConjoinWith(query.NewPredicateWithTerm(term))
+			continue
+		}
+		joins = append(joins, func(p Plan) Plan {
+			return NewSemiJoinPlan(tx, p, sp.plan, outerKeys, innerKeys)
+		})
+	}
+	return rest, func(p Plan) Plan {
+		for _, join := range joins {
+			p = join(p)
+		}
+		return p
+	}
+}
+
+// extendPlan 選択リストで AS を付けた列を計算する
+func extendPlan(p Plan, data *parse.QueryData) (Plan, error) {
+	for _, fieldName := range data.Fields {
+		e, ok := data.Exprs[fieldName]
+		if !ok {
+			continue
+		}
+		var err error
+		p, err = NewExtendPlan(p, fieldName, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,155 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/plan"
+	"simpledb/query"
+	"simpledb/server"
+	"simpledb/tx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubquery(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "subquery_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10), majorid int, gradyear int)"))
+			require.NoError(t, exec("create table dept (did int, dname varchar(10))"))
+			require.NoError(t, exec("create table enroll (eid int, studentid int, grade varchar(2))"))
+			for i := 1; i <= 9; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid, gradyear) values (%d, 'name%d', %d, %d)", i, i, 10*(i%3+1), 2020+i%2)))
+			}
+			require.NoError(t, exec("insert into student (sid, sname, majorid, gradyear) values (10, 'name10', null, 2020)"))
+			require.NoError(t, exec("insert into dept (did, dname) values (10, 'compsci')"))
+			require.NoError(t, exec("insert into dept (did, dname) values (20, 'math')"))
+			require.NoError(t, exec("insert into dept (did, dname) values (30, 'drama')"))
+			for i, sid := range []int{1, 1, 4, 5, 8} {
+				grade := "B"
+				if sid%2 == 0 {
+					grade = "A"
+				}
+				require.NoError(t, exec(fmt.Sprintf("insert into enroll (eid, studentid, grade) values (%d, %d, '%s')", 100+i, sid, grade)))
+			}
+
+			// IN: NULL はどの値とも一致しない
+			q := "select sid from student where majorid in (select did from dept where dname = 'math')"
+			assert.ElementsMatch(t, []int32{1, 4, 7}, queryInts(t, planner, tx, q))
+			assert.Contains(t, planTree(t, planner, tx, q), "SemiJoin")
+			assert.Len(t, queryInts(t, planner, tx, "select sid from student where majorid in (select majorid from student where gradyear = 2020)"), 9)
+
+			// EXISTS: 相関副問合せは準結合になる
+			q = "select sid from student where exists (select eid from enroll where studentid = sid)"
+			assert.ElementsMatch(t, []int32{1, 4, 5, 8}, queryInts(t, planner, tx, q))
+			assert.Contains(t, planTree(t, planner, tx, q), "SemiJoin")
+			assert.ElementsMatch(t, []int32{4, 8}, queryInts(t, planner, tx, "select sid from student where exists (select eid from enroll where studentid = sid and grade = 'A')"))
+			assert.Len(t, queryInts(t, planner, tx, "select sid from student where exists (select did from dept where dname = 'math')"), 10)
+			assert.Empty(t, queryInts(t, planner, tx, "select sid from student where exists (select did from dept where dname = 'art')"))
+
+			// 2段外側の列を参照する副問合せは、レコードごとに評価する
+			q = "select sid from student where exists (select did from dept where did = majorid and exists (select eid from enroll where studentid = sid))"
+			assert.ElementsMatch(t, []int32{1, 4, 5, 8}, queryInts(t, planner, tx, q))
+			assert.ElementsMatch(t, []int32{4, 8}, queryInts(t, planner, tx, "select sid from student where sid in (select studentid from enroll where eid in (select eid from enroll where grade = 'A'))"))
+
+			// スカラ副問合せ
+			assert.ElementsMatch(t, []int32{1, 4, 7}, queryInts(t, planner, tx, "select sid from student where majorid = (select did from dept where dname = 'math')"))
+			assert.Equal(t, []string{"'math'"}, queryStrings(t, planner, tx, "select (select dname from dept where did = majorid) as dname, sid from student where sid = 4"))
+			assert.Equal(t, []string{"NULL"}, queryStrings(t, planner, tx, "select (select dname from dept where did = majorid) as dname from student where sid = 10"))
+			assert.ErrorIs(t, queryError(planner, tx, "select (select eid from enroll where studentid = sid) as eid from student where sid = 1"), query.ErrMultipleRows)
+			assert.Error(t, queryError(planner, tx, "select sid from student where majorid in (select did, dname from dept)"))
+			assert.Error(t, queryError(planner, tx, "select sid from student where exists (select eid from enroll where studentid = nosuch)"))
+
+			// 導出表
+			assert.ElementsMatch(t, []int32{3, 9}, queryInts(t, planner, tx, "select n from (select sid as n, majorid from student where gradyear = 2021) as t where majorid = 10"))
+			assert.ElementsMatch(t, []int32{1, 7}, queryInts(t, planner, tx, "select n from (select sid as n, majorid from student where gradyear = 2021) t, dept where majorid = did and dname = 'math'"))
+			assert.Error(t, queryError(planner, tx, "select sid from (select sname from student) as t"))
+
+			// ビューの定義の副問合せ
+			require.NoError(t, exec("create view mathstudent as select sid from student where majorid in (select did from dept where dname = 'math')"))
+			assert.ElementsMatch(t, []int32{1, 4}, queryInts(t, planner, tx, "select sid from mathstudent where sid in (select studentid from enroll)"))
+
+			// UPDATE文と DELETE文の副問合せ
+			require.NoError(t, exec("update student set majorid = (select did from dept where dname = 'drama') where sid = 1"))
+			assert.Equal(t, []int32{30}, queryInts(t, planner, tx, "select majorid from student where sid = 1"))
+			require.NoError(t, exec("delete from enroll where studentid in (select sid from student where gradyear = 2021)"))
+			assert.ElementsMatch(t, []int32{4, 8}, queryInts(t, planner, tx, "select studentid from enroll"))
+			require.NoError(t, exec("delete from student where exists (select eid from enroll where studentid = sid)"))
+			assert.Len(t, queryInts(t, planner, tx, "select sid from student"), 8)
+
+			// CHECK 制約には副問合せを使えない
+			assert.Error(t, exec("create table bad (a int check (a in (select did from dept)))"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
+
+// planTree 問合せの計画の木
+func planTree(t *testing.T, planner *plan.Planner, tx *tx.Transaction, q string) string {
+	t.Helper()
+	p, err := planner.CreateQueryPlan(q, tx)
+	require.NoError(t, err)
+	return p.Tree().String()
+}
+
+// queryStrings 最初の列の値を全て文字列にして返す
+func queryStrings(t *testing.T, planner *plan.Planner, tx *tx.Transaction, q string) []string {
+	t.Helper()
+	p, err := planner.CreateQueryPlan(q, tx)
+	require.NoError(t, err)
+	s, err := p.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	fieldName := p.Schema().Fields()[0]
+	var result []string
+	for {
+		next, err := s.Next()
+		require.NoError(t, err)
+		if !next {
+			return result
+		}
+		val, err := s.GetVal(fieldName)
+		require.NoError(t, err)
+		result = append(result, val.String())
+	}
+}
+
+// queryError 問合せの計画の作成か実行で起きたエラー
+func queryError(planner *plan.Planner, tx *tx.Transaction, q string) error {
+	p, err := planner.CreateQueryPlan(q, tx)
+	if err != nil {
+		return err
+	}
+	s, err := p.Open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for {
+		next, err := s.Next()
+		if err != nil || !next {
+			return err
+		}
+		for _, fieldName := range p.Schema().Fields() {
+			if _, err := s.GetVal(fieldName); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -16,9 +16,18 @@ type TablePlan struct {
 	tx        *tx.Transaction
 	layout    *record.Layout
 	statInfo  *metadata.StatInfo
+	// alias FROM句で表を参照する名前
+	alias string
+	// rawNames 問合せの中での列名から、表の列名への対応。名前を変えない列は含まない
+	rawNames map[string]string
 }
 
 func NewTablePlan(tx *tx.Transaction, tableName string, md *metadata.Manager) (*TablePlan, error) {
+	return NewAliasTablePlan(tx, tableName, tableName, nil, md)
+}
+
+// NewAliasTablePlan FROM句で alias として参照する表の計画。表の列 c は、問合せの中で renames[c] として出力する
+func NewAliasTablePlan(tx *tx.Transaction, tableName string, alias string, renames map[string]string, md *metadata.Manager) (*TablePlan, error) {
 	logger := logger.New("plan.TablePlan", logger.Info)
 	logger.Tracef("(%q) NewTablePlan", tableName)
 
@@ -30,7 +39,14 @@ func NewTablePlan(tx *tx.Transaction, tableName string, md *metadata.Manager) (*
 	if err != nil {
 		return nil, err
 	}
-	return &TablePlan{tableName, tx, layout, statInfo}, nil
+	rawNames := make(map[string]string, len(renames))
+	for raw, name := range renames {
+		rawNames[name] = raw
+	}
+	if len(renames) > 0 {
+		layout = layout.Rename(renames)
+	}
+	return &TablePlan{tableName, tx, layout, statInfo, alias, rawNames}, nil
 }
 
 func (p *TablePlan) Open() (query.Scan, error) {
@@ -46,7 +62,25 @@ func (p *TablePlan) RecordsOutput() int32 {
 }
 
 func (p *TablePlan) DistinctValues(fieldName string) int32 {
-	return p.statInfo.DistinctValues(fieldName)
+	return p.statInfo.DistinctValues(p.rawName(fieldName))
+}
+
+// rawName 問合せの中での列名 fieldName の、表の列名
+func (p *TablePlan) rawName(fieldName string) string {
+	if raw, ok := p.rawNames[fieldName]; ok {
+		return raw
+	}
+	return fieldName
+}
+
+// exposedName 表の列 fieldName の、問合せの中での列名
+func (p *TablePlan) exposedName(fieldName string) string {
+	for name, raw := range p.rawNames {
+		if raw == fieldName {
+			return name
+		}
+	}
+	return fieldName
 }
 
 func (p *TablePlan) Schema() *record.Schema {
@@ -54,5 +88,8 @@ func (p *TablePlan) Schema() *record.Schema {
 }
 
 func (p *TablePlan) Tree() *PlanNode {
+	if p.alias != p.tableName {
+		return NewPlanNode(fmt.Sprintf("Table(%s %s)", p.tableName, p.alias), p, nil)
+	}
 	return NewPlanNode(fmt.Sprintf("Table(%s)", p.tableName), p, nil)
 }
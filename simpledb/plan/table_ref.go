@@ -0,0 +1,376 @@
+package plan
+
+import (
+	"fmt"
+	"maps"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+)
+
+// tableRef FROM句で参照する表、ビューか導出表
+type tableRef struct {
+	// name 問合せの中で参照する名前。別名がなければ表かビューの名前
+	name string
+	// tableName 表かビューの名前。導出表では空
+	tableName string
+	// query ビューか導出表の問合せ。表では nil
+	query *parse.QueryData
+	// columns 参照が出力する列
+	columns []string
+}
+
+// tableRefs 問合せ data の FROM句の参照。ビューは定義を構文解析する
+func tableRefs(mdm *metadata.Manager, data *parse.QueryData, tx *tx.Transaction) ([]*tableRef, error) {
+	refs := make([]*tableRef, 0, len(data.Tables))
+	for _, name := range data.Tables {
+		if slices.ContainsFunc(refs, func(ref *tableRef) bool { return ref.name == name }) {
+			return nil, fmt.Errorf("table name %q specified more than once", name)
+		}
+		if d, ok := data.Derived[name]; ok {
+			columns, err := queryColumns(mdm, d, tx)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, &tableRef{name: name, query: d, columns: columns})
+			continue
+		}
+		tableName := data.TableName(name)
+		viewDef, err := mdm.GetViewDef(tableName, tx)
+		if err != nil {
+			return nil, err
+		}
+		if viewDef != "" {
+			viewData, err := parseViewDef(tableName, viewDef)
+			if err != nil {
+				return nil, err
+			}
+			columns, err := queryColumns(mdm, viewData, tx)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, &tableRef{name: name, tableName: tableName, query: viewData, columns: columns})
+			continue
+		}
+		layout, err := mdm.GetLayout(tableName, tx)
+		if err != nil {
+			return nil, err
+		}
+		if len(layout.Schema().Fields()) == 0 {
+			return nil, fmt.Errorf("table %q does not exist", tableName)
+		}
+		refs = append(refs, &tableRef{name: name, tableName: tableName, columns: layout.Schema().Fields()})
+	}
+	return refs, nil
+}
+
+// queryColumns 問合せ data が出力する列。* と t.* は参照の列に展開する
+func queryColumns(mdm *metadata.Manager, data *parse.QueryData, tx *tx.Transaction) ([]string, error) {
+	if data.SetOp != nil {
+		return queryColumns(mdm, data.SetOp.Lhs, tx)
+	}
+	if !data.HasAllColumns() {
+		return data.Fields, nil
+	}
+	refs, err := tableRefs(mdm, data, tx)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expandAllColumns(data, refs)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.Fields, nil
+}
+
+// expandAllColumns 選択リストの * を全ての参照の列に、t.* を参照 t の列に展開する
+// 展開した列は参照で修飾し、選択リストの中で列名が重ならなければ列名を名前として付ける
+func expandAllColumns(data *parse.QueryData, refs []*tableRef) (*parse.QueryData, error) {
+	if !data.HasAllColumns() {
+		return data, nil
+	}
+	result := *data
+	result.Fields = nil
+	result.Exprs = maps.Clone(data.Exprs)
+	for _, fieldName := range data.Fields {
+		qualifier, ok := parse.IsAllColumns(fieldName)
+		if !ok {
+			result.Fields = append(result.Fields, fieldName)
+			continue
+		}
+		found := false
+		for _, ref := range refs {
+			if qualifier != "" && ref.name != qualifier {
+				continue
+			}
+			found = true
+			for _, c := range ref.columns {
+				result.Fields = append(result.Fields, query.QualifiedFieldName(ref.name, c))
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("table %q not found for %s", qualifier, fieldName)
+		}
+	}
+	parse.NameColumns(&result)
+	return &result, nil
+}
+
+// exposedNames 参照で修飾した列名 (s.sid) から、問合せの中での列名への対応
+// 列名がどの参照の間でも重ならなければ修飾せず、重なれば参照で修飾した名前のままにする
+func exposedNames(refs []*tableRef) map[string]string {
+	count := make(map[string]int)
+	for _, ref := range refs {
+		for _, c := range ref.columns {
+			count[c]++
+		}
+	}
+	names := make(map[string]string)
+	for _, ref := range refs {
+		for _, c := range ref.columns {
+			qualified := query.QualifiedFieldName(ref.name, c)
+			if count[c] == 1 {
+				names[qualified] = c
+			} else {
+				names[qualified] = qualified
+			}
+		}
+	}
+	return names
+}
+
+// qualifyNames 問合せ data の列を、FROM句の参照で修飾した名前 (s.sid) にする
+// どの参照の列でもない列は外側の問合せの列として、そのままにする
+func qualifyNames(data *parse.QueryData, refs []*tableRef) (*parse.QueryData, error) {
+	columns := make(map[string][]string, len(refs))
+	for _, ref := range refs {
+		columns[ref.name] = ref.columns
+	}
+	return mapNames(data, func(name string) (*query.Expression, error) {
+		qualifier, fieldName := query.SplitFieldName(name)
+		if qualifier != "" {
+			if cols, ok := columns[qualifier]; ok && !slices.Contains(cols, fieldName) {
+				return nil, fmt.Errorf("field %q not found in %s", fieldName, qualifier)
+			}
+			return query.NewExpressionWithField(name), nil
+		}
+		var found []string
+		for _, ref := range refs {
+			if slices.Contains(ref.columns, name) {
+				found = append(found, ref.name)
+			}
+		}
+		switch len(found) {
+		case 0:
+			return query.NewExpressionWithField(name), nil
+		case 1:
+			return query.NewExpressionWithQualifiedField(found[0], name), nil
+		}
+		return nil, fmt.Errorf("field %q is ambiguous: found in %v", name, found)
+	})
+}
+
+// exposeNames 参照で修飾した列を、問合せの中での列名 names にする
+// 修飾されていない列が、修飾せずに参照できる列と同じ名前であれば、その列はどの参照にもない
+func exposeNames(data *parse.QueryData, names map[string]string) (*parse.QueryData, error) {
+	exposed := make(map[string]bool, len(names))
+	for _, name := range names {
+		exposed[name] = true
+	}
+	return mapNames(data, func(name string) (*query.Expression, error) {
+		if n, ok := names[name]; ok {
+			return query.NewExpressionWithField(n), nil
+		}
+		if qualifier, _ := query.SplitFieldName(name); qualifier == "" && exposed[name] {
+			return nil, fmt.Errorf("field %q not found", name)
+		}
+		return query.NewExpressionWithField(name), nil
+	})
+}
+
+// mapNames 問合せ data の選択リスト、ウィンドウ関数、述語、外部結合の述語と ORDER BY の列を f で置き換えた問合せ
+// 導出表と副問合せの中の列は置き換えない
+func mapNames(data *parse.QueryData, f func(string) (*query.Expression, error)) (*parse.QueryData, error) {
+	result := *data
+	result.Exprs = nil
+	result.Windows = nil
+	for _, fieldName := range data.Fields {
+		if w, ok := data.Windows[fieldName]; ok {
+			mapped, err := mapWindow(w, f)
+			if err != nil {
+				return nil, err
+			}
+			result.Windows = setEntry(result.Windows, fieldName, mapped)
+			continue
+		}
+		e, ok := data.Exprs[fieldName]
+		if !ok {
+			e = query.NewExpressionWithField(fieldName)
+		}
+		if e.IsFieldName() {
+			var err error
+			if e, err = f(e.AsFieldName()); err != nil {
+				return nil, err
+			}
+		}
+		if e.IsFieldName() && e.AsFieldName() == fieldName {
+			continue
+		}
+		if result.Exprs == nil {
+			result.Exprs = make(map[string]*query.Expression)
+		}
+		result.Exprs[fieldName] = e
+	}
+
+	// ORDER BY の選択リストの列名はそのままにする
+	result.OrderBy = nil
+	for _, fieldName := range data.OrderBy {
+		if !slices.Contains(data.Fields, fieldName) {
+			e, err := f(fieldName)
+			if err != nil {
+				return nil, err
+			}
+			if !e.IsFieldName() {
+				return nil, fmt.Errorf("cannot order by %s", e)
+			}
+			fieldName = e.AsFieldName()
+		}
+		result.OrderBy = append(result.OrderBy, fieldName)
+	}
+
+	var err error
+	if result.Pred, err = mapPredicate(data.Pred, f); err != nil {
+		return nil, err
+	}
+	result.Joins = nil
+	for _, j := range data.Joins {
+		on, err := mapPredicate(j.On, f)
+		if err != nil {
+			return nil, err
+		}
+		result.Joins = append(result.Joins, parse.NewJoinData(j.Type, j.Table, on))
+	}
+	return &result, nil
+}
+
+// mapWindow ウィンドウ関数 w の引数、区画と並びの列を f で置き換える
+func mapWindow(w *parse.WindowData, f func(string) (*query.Expression, error)) (*parse.WindowData, error) {
+	mapField := func(fieldName string) (string, error) {
+		e, err := f(fieldName)
+		if err != nil {
+			return "", err
+		}
+		if !e.IsFieldName() {
+			return "", fmt.Errorf("cannot use %s in window function %s", e, w)
+		}
+		return e.AsFieldName(), nil
+	}
+	mapFields := func(fields []string) ([]string, error) {
+		var result []string
+		for _, fieldName := range fields {
+			name, err := mapField(fieldName)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, name)
+		}
+		return result, nil
+	}
+
+	field := w.Field
+	if field != "" {
+		var err error
+		if field, err = mapField(field); err != nil {
+			return nil, err
+		}
+	}
+	partitionBy, err := mapFields(w.PartitionBy)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := mapFields(w.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	return parse.NewWindowData(w.Func, field, w.Offset, partitionBy, orderBy, w.Descending), nil
+}
+
+func mapPredicate(pred *query.Predicate, f func(string) (*query.Expression, error)) (*query.Predicate, error) {
+	result := pred
+	for _, fieldName := range pred.FieldNames() {
+		e, err := f(fieldName)
+		if err != nil {
+			return nil, err
+		}
+		if e.IsFieldName() && e.AsFieldName() == fieldName {
+			continue
+		}
+		result = result.Substitute(fieldName, e)
+	}
+	return result, nil
+}
+
+// refPlan 参照 ref の計画。列は問合せの中での列名 names で出力する
+func refPlan(qp QueryPlanner, mdm *metadata.Manager, ref *tableRef, names map[string]string, tx *tx.Transaction) (Plan, error) {
+	renames := make(map[string]string)
+	fields := make([]string, 0, len(ref.columns))
+	for _, c := range ref.columns {
+		name := names[query.QualifiedFieldName(ref.name, c)]
+		if name != c {
+			renames[c] = name
+		}
+		fields = append(fields, name)
+	}
+	if ref.query == nil {
+		return NewAliasTablePlan(tx, ref.tableName, ref.name, renames, mdm)
+	}
+
+	p, err := qp.CreatePlan(ref.query, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(renames) == 0 {
+		return p, nil
+	}
+	for _, c := range ref.columns {
+		if name, ok := renames[c]; ok {
+			if p, err = NewExtendPlan(p, name, query.NewExpressionWithField(c)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return NewProjectPlan(p, fields)
+}
+
+// refsSchema FROM句の参照の列を、問合せの中での列名 names で並べたスキーマ
+// 表の列は型と長さを持つが、ビューと導出表の列は型を調べないので、存在することだけを表す
+func refsSchema(mdm *metadata.Manager, refs []*tableRef, names map[string]string, tx *tx.Transaction) (*record.Schema, error) {
+	schema := record.NewSchema()
+	for _, ref := range refs {
+		var tableSchema *record.Schema
+		if ref.query == nil {
+			layout, err := mdm.GetLayout(ref.tableName, tx)
+			if err != nil {
+				return nil, err
+			}
+			tableSchema = layout.Schema()
+		}
+		for _, c := range ref.columns {
+			name := names[query.QualifiedFieldName(ref.name, c)]
+			if tableSchema != nil {
+				schema.AddField(name, tableSchema.Type(c), tableSchema.Length(c))
+			} else {
+				schema.AddIntField(name)
+			}
+		}
+	}
+	return schema, nil
+}
+
+// tableNames 更新する表 tableName の列を表名で修飾した名前 (student.sid) から、列名への対応
+func tableNames(tableName string, schema *record.Schema) map[string]string {
+	return exposedNames([]*tableRef{{name: tableName, tableName: tableName, columns: schema.Fields()}})
+}
@@ -0,0 +1,55 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/query"
+	"simpledb/record"
+)
+
+var _ Plan = (*TopNPlan)(nil)
+
+// TopNPlan p のレコードを sortFields の順に並べた時の、先頭の n 件を返す。descending[i] が true の列 sortFields[i] は降順に並べる
+// ORDER BY と LIMIT の組み合わせで、全てをソートする代わりに n 件だけをメモリ上のヒープに保持する
+type TopNPlan struct {
+	p          Plan
+	sortFields []string
+	descending []bool
+	n          int32
+}
+
+func NewTopNPlan(p Plan, sortFields []string, descending []bool, n int32) *TopNPlan {
+	return &TopNPlan{p, sortFields, descending, n}
+}
+
+func (tp *TopNPlan) Open() (query.Scan, error) {
+	s, err := tp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	ts, err := query.NewTopNScan(s, tp.p.Schema().Fields(), query.NewRecordComparatorWithOrder(tp.sortFields, tp.descending), tp.n)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (tp *TopNPlan) BlocksAccessed() int32 {
+	return tp.p.BlocksAccessed()
+}
+
+func (tp *TopNPlan) RecordsOutput() int32 {
+	return min(tp.p.RecordsOutput(), tp.n)
+}
+
+func (tp *TopNPlan) DistinctValues(fieldName string) int32 {
+	return min(tp.p.DistinctValues(fieldName), tp.RecordsOutput())
+}
+
+func (tp *TopNPlan) Schema() *record.Schema {
+	return tp.p.Schema()
+}
+
+func (tp *TopNPlan) Tree() *PlanNode {
+	return NewPlanNode(fmt.Sprintf("TopN(%v, %v, %d)", tp.sortFields, tp.descending, tp.n), tp, []*PlanNode{tp.p.Tree()})
+}
@@ -0,0 +1,55 @@
+package plan
+
+import (
+	"simpledb/query"
+	"simpledb/record"
+)
+
+var _ Plan = (*UnionPlan)(nil)
+
+// UnionPlan 左右の計画のレコードを、重複を除かずに続けて返す (UNION ALL)
+type UnionPlan struct {
+	p1, p2 Plan
+	schema *record.Schema
+}
+
+func NewUnionPlan(p1, p2 Plan) (*UnionPlan, error) {
+	schema, err := setOpSchema(p1, p2)
+	if err != nil {
+		return nil, err
+	}
+	return &UnionPlan{p1, p2, schema}, nil
+}
+
+func (p *UnionPlan) Open() (query.Scan, error) {
+	s1, err := p.p1.Open()
+	if err != nil {
+		return nil, err
+	}
+	s2, err := p.p2.Open()
+	if err != nil {
+		s1.Close()
+		return nil, err
+	}
+	return query.NewUnionScan(s1, s2, p.p1.Schema().Fields(), p.p2.Schema().Fields()), nil
+}
+
+func (p *UnionPlan) BlocksAccessed() int32 {
+	return p.p1.BlocksAccessed() + p.p2.BlocksAccessed()
+}
+
+func (p *UnionPlan) RecordsOutput() int32 {
+	return p.p1.RecordsOutput() + p.p2.RecordsOutput()
+}
+
+func (p *UnionPlan) DistinctValues(fieldName string) int32 {
+	return p.p1.DistinctValues(fieldName) + p.p2.DistinctValues(rhsField(p.p1, p.p2, fieldName))
+}
+
+func (p *UnionPlan) Schema() *record.Schema {
+	return p.schema
+}
+
+func (p *UnionPlan) Tree() *PlanNode {
+	return NewPlanNode("SetOp(union all)", p, []*PlanNode{p.p1.Tree(), p.p2.Tree()})
+}
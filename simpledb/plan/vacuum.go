@@ -0,0 +1,83 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/file"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+)
+
+// vacuum VACUUM文で指定された表、指定がなければカタログを除く全ての表を詰め直す
+func vacuum(mdm *metadata.Manager, data *parse.VacuumData, tx *tx.Transaction, useIndex bool) error {
+	tableNames := []string{data.TableName}
+	if data.TableName == "" {
+		var err error
+		if tableNames, err = mdm.GetTableNames(tx); err != nil {
+			return err
+		}
+	}
+	for _, tableName := range tableNames {
+		if err := vacuumTable(mdm, tableName, tx, useIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vacuumTable 表のレコードを先頭のブロックから詰めて書き直し、空になった末尾のブロックをコミットした時に切り詰める
+// レコードの RID が変わるので、useIndex なら索引のエントリも作り直す
+// 書き直しは同じトランザクションの中で行うので、ロールバックすれば元に戻り、ファイルも切り詰めない
+func vacuumTable(mdm *metadata.Manager, tableName string, tx *tx.Transaction, useIndex bool) error {
+	layout, err := mdm.GetLayout(tableName, tx)
+	if err != nil {
+		return err
+	}
+	if len(layout.Schema().Fields()) == 0 {
+		return fmt.Errorf("table %q does not exist", tableName)
+	}
+
+	// 詰め直している間に他のトランザクションがブロックを追加しないよう、先にファイルの末尾に排他ロックを取る
+	filename := tableName + ".tbl"
+	size, err := tx.Size(filename)
+	if err != nil {
+		return err
+	}
+	if err := tx.TruncateOnCommit(filename, size); err != nil {
+		return err
+	}
+
+	ta := &tableAlteration{mdm: mdm, tx: tx, tableName: tableName, layout: layout, useIndex: useIndex}
+	value := func(s query.Scan, f string) (*query.Constant, error) {
+		return s.GetVal(f)
+	}
+	if err := ta.rewrite(tableName, layout.Schema(), value, func() error { return nil }); err != nil {
+		return err
+	}
+
+	// 書き直したレコードの後ろに残った空のブロックを切り詰める
+	newSize := size
+	for ; newSize > 0; newSize-- {
+		rp, err := record.NewRecordPage(tx, file.NewBlockID(filename, newSize-1), layout)
+		if err != nil {
+			return err
+		}
+		empty, err := rp.IsEmpty()
+		tx.Unpin(rp.Block())
+		if err != nil {
+			return err
+		}
+		if !empty {
+			break
+		}
+	}
+	if err := tx.TruncateOnCommit(filename, newSize); err != nil {
+		return err
+	}
+	if err := record.NewFreeSpaceMap(tx, tableName).TruncateOnCommit(newSize); err != nil {
+		return err
+	}
+	return record.NewOverflow(tx, tableName).TruncateOnCommit()
+}
@@ -0,0 +1,98 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVacuum(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "vacuum_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+			fm := simpleDB.FileManager()
+			length := func(filename string) int32 {
+				n, err := fm.Length(filename)
+				require.NoError(t, err)
+				return n
+			}
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+			require.NoError(t, exec("create table item (id int, name varchar(10), keep int)"))
+			require.NoError(t, exec("create index item_id_idx on item (id)"))
+			require.NoError(t, exec("create table note (id int, body varchar(100), keep int) using slotted"))
+			for i := 1; i <= 100; i++ {
+				keep := 0
+				if i <= 5 || i > 95 {
+					keep = 1
+				}
+				require.NoError(t, exec(fmt.Sprintf("insert into item (id, name, keep) values (%d, 'item%d', %d)", i, i, keep)))
+				keep = 0
+				if i <= 5 {
+					keep = 1
+				}
+				require.NoError(t, exec(fmt.Sprintf("insert into note (id, body, keep) values (%d, 'note%d', %d)", i, i, keep)))
+			}
+			require.NoError(t, exec("delete from item where keep = 0"))
+			require.NoError(t, exec("delete from note where keep = 0"))
+			require.NoError(t, tx.Commit())
+			itemBlocks := length("item.tbl")
+			noteBlocks := length("note.tbl")
+
+			// ロールバックすればレコードは元の位置に戻り、ファイルも切り詰めない
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			require.NoError(t, exec("vacuum item"))
+			require.NoError(t, tx.Rollback())
+			assert.Equal(t, itemBlocks, length("item.tbl"))
+
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"'item96'"}, queryRows(t, planner, tx, "select name from item where id = 96"))
+			require.NoError(t, exec("vacuum item"))
+			require.NoError(t, tx.Commit())
+			assert.Equal(t, int32(1), length("item.tbl"))
+			assert.Equal(t, noteBlocks, length("note.tbl"))
+
+			// 書き直したレコードの RID で索引からも辿れる
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []int32{1, 2, 3, 4, 5, 96, 97, 98, 99, 100}, queryInts(t, planner, tx, "select id from item"))
+			assert.Equal(t, []string{"'item96'"}, queryRows(t, planner, tx, "select name from item where id = 96"))
+			assert.Empty(t, queryRows(t, planner, tx, "select name from item where id = 50"))
+
+			// 表を指定しなければ全ての表を詰め直す
+			require.NoError(t, exec("vacuum"))
+			require.NoError(t, tx.Commit())
+			assert.Equal(t, int32(1), length("note.tbl"))
+
+			// 切り詰めた後も挿入できる
+			tx, err = simpleDB.NewTx()
+			require.NoError(t, err)
+			for i := 101; i <= 130; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into item (id, name, keep) values (%d, 'item%d', 1)", i, i)))
+			}
+			assert.Len(t, queryInts(t, planner, tx, "select id from item"), 40)
+			assert.Equal(t, []string{"'item120'"}, queryRows(t, planner, tx, "select name from item where id = 120"))
+			assert.ElementsMatch(t, []int32{1, 2, 3, 4, 5}, queryInts(t, planner, tx, "select id from note"))
+
+			assert.Error(t, exec("vacuum nosuch"))
+			require.NoError(t, tx.Rollback())
+		})
+	}
+}
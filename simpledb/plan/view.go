@@ -0,0 +1,396 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/metadata"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/tx"
+	"slices"
+	"strings"
+)
+
+// expandViews FROM句のビューと導出表を、その問合せで置き換えた問合せを返す
+// ビューの表は問合せの表に、ビューの述語は問合せの述語に加わるので、問合せの述語はビューの表に直接適用され、
+// ビューを表や他のビューと結合することもできる。問合せはビューが出力する列しか参照できない
+// ビューが出力する列は、問合せの中でその式に置き換える。外部結合で NULL になりうるビューは置き換えず、導出表として残す
+// 返す問合せの列名は、どの参照の間でも重ならなければ修飾せず、重なれば参照で修飾する (s.sid)
+func expandViews(mdm *metadata.Manager, data *parse.QueryData, tx *tx.Transaction) (*parse.QueryData, error) {
+	expanded, err := expandViewsIn(mdm, data, tx, nil)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := tableRefs(mdm, expanded, tx)
+	if err != nil {
+		return nil, err
+	}
+	return exposeNames(expanded, exposedNames(refs))
+}
+
+// expandViewsIn expanding は展開中のビューで、自身を参照するビューを検出するために使う
+// 返す問合せの列は、参照で修飾した名前 (s.sid) になる
+// 集合演算は置き換えずにそのまま返すが、両側の問合せが自身を参照しないことは確かめる
+func expandViewsIn(mdm *metadata.Manager, data *parse.QueryData, tx *tx.Transaction, expanding []string) (*parse.QueryData, error) {
+	if data.SetOp != nil {
+		for _, q := range []*parse.QueryData{data.SetOp.Lhs, data.SetOp.Rhs} {
+			if _, err := expandViewsIn(mdm, q, tx, expanding); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+	refs, err := tableRefs(mdm, data, tx)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = expandAllColumns(data, refs); err != nil {
+		return nil, err
+	}
+	data, err = qualifyNames(data, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := *data
+	result.Tables, result.Aliases, result.Derived, result.Joins = nil, nil, nil, nil
+	pred := query.NewPredicate()
+	var joins []*parse.JoinData
+	// used 問合せの参照名。ビューの参照名と重なれば、ビューの参照名を修飾する
+	used := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		used[ref.name] = true
+	}
+	// columns 置き換えたビューが出力する列の式
+	columns := make(map[string]*query.Expression)
+	for i, ref := range refs {
+		if ref.query == nil {
+			result.Tables = append(result.Tables, ref.name)
+			if ref.name != ref.tableName {
+				result.Aliases = setEntry(result.Aliases, ref.name, ref.tableName)
+			}
+			continue
+		}
+
+		inner := expanding
+		if ref.tableName != "" {
+			if slices.Contains(expanding, ref.tableName) {
+				return nil, fmt.Errorf("view %q refers to itself", ref.tableName)
+			}
+			inner = append(slices.Clone(expanding), ref.tableName)
+		}
+		view, err := expandViewsIn(mdm, ref.query, tx, inner)
+		if err != nil {
+			return nil, err
+		}
+		if !mergeable(data, i, view) {
+			result.Tables = append(result.Tables, ref.name)
+			result.Derived = setEntry(result.Derived, ref.name, ref.query)
+			continue
+		}
+
+		view, err = renameRefs(view, used, ref.name)
+		if err != nil {
+			return nil, err
+		}
+		result.Tables = append(result.Tables, view.Tables...)
+		for r, tableName := range view.Aliases {
+			result.Aliases = setEntry(result.Aliases, r, tableName)
+		}
+		for r, d := range view.Derived {
+			result.Derived = setEntry(result.Derived, r, d)
+		}
+		joins = append(joins, view.Joins...)
+		pred.ConjoinWith(view.Pred)
+		for _, fieldName := range view.Fields {
+			e, ok := view.Exprs[fieldName]
+			if !ok {
+				e = query.NewExpressionWithField(fieldName)
+			}
+			columns[query.QualifiedFieldName(ref.name, fieldName)] = e
+		}
+	}
+
+	data, err = mapNames(data, func(name string) (*query.Expression, error) {
+		if e, ok := columns[name]; ok {
+			return e, nil
+		}
+		return query.NewExpressionWithField(name), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Exprs = data.Exprs
+	result.OrderBy = data.OrderBy
+	pred.ConjoinWith(data.Pred)
+	result.Pred = pred
+	result.Joins = append(data.Joins, joins...)
+	return &result, nil
+}
+
+// mergeable FROM句の i 番目のビューか導出表 view を、問合せの表に置き換えられるか
+// 外部結合で NULL になりうるものと、前に表があるときに右外部結合か完全外部結合を含むもの、
+// 集合演算と、DISTINCT か LIMIT でレコードを減らすものは置き換えられない
+func mergeable(data *parse.QueryData, i int, view *parse.QueryData) bool {
+	if view.SetOp != nil || view.Distinct || view.Limit != parse.NoLimit || view.Offset > 0 || len(view.Windows) > 0 {
+		return false
+	}
+	if data.Join(data.Tables[i]) != nil {
+		return false
+	}
+	for _, ref := range data.Tables[i+1:] {
+		if j := data.Join(ref); j != nil && j.Type != parse.JoinLeft {
+			return false
+		}
+	}
+	if i > 0 {
+		for _, j := range view.Joins {
+			if j.Type != parse.JoinLeft {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// renameRefs ビュー view の参照名のうち used と重なるものを、ビューの参照名 viewRef で修飾した名前にする
+func renameRefs(view *parse.QueryData, used map[string]bool, viewRef string) (*parse.QueryData, error) {
+	renames := make(map[string]string)
+	for _, r := range view.Tables {
+		name := r
+		if used[r] {
+			name = query.QualifiedFieldName(viewRef, r)
+			renames[r] = name
+		}
+		used[name] = true
+	}
+	if len(renames) == 0 {
+		return view, nil
+	}
+	rename := func(r string) string {
+		if name, ok := renames[r]; ok {
+			return name
+		}
+		return r
+	}
+
+	result, err := mapNames(view, func(name string) (*query.Expression, error) {
+		qualifier, fieldName := query.SplitFieldName(name)
+		if newName, ok := renames[qualifier]; ok {
+			return query.NewExpressionWithQualifiedField(newName, fieldName), nil
+		}
+		return query.NewExpressionWithField(name), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Tables, result.Aliases, result.Derived = nil, nil, nil
+	for _, r := range view.Tables {
+		result.Tables = append(result.Tables, rename(r))
+		if d, ok := view.Derived[r]; ok {
+			result.Derived = setEntry(result.Derived, rename(r), d)
+		} else if rename(r) != view.TableName(r) {
+			result.Aliases = setEntry(result.Aliases, rename(r), view.TableName(r))
+		}
+	}
+	for _, j := range result.Joins {
+		j.Table = rename(j.Table)
+	}
+	return result, nil
+}
+
+// setEntry m が nil であれば作成して、key に value を設定する
+func setEntry[V any](m map[string]V, key string, value V) map[string]V {
+	if m == nil {
+		m = make(map[string]V)
+	}
+	m[key] = value
+	return m
+}
+
+// selectedFields 選択リストが読む列。AS を付けた列は元の列を、ウィンドウ関数は引数と OVER の列を読む
+func selectedFields(data *parse.QueryData) []string {
+	var result []string
+	for _, fieldName := range data.Fields {
+		if w, ok := data.Windows[fieldName]; ok {
+			if w.Field != "" {
+				result = append(result, w.Field)
+			}
+			result = append(result, slices.Concat(w.PartitionBy, w.OrderBy)...)
+		} else if e, ok := data.Exprs[fieldName]; !ok {
+			result = append(result, fieldName)
+		} else if e.IsFieldName() {
+			result = append(result, e.AsFieldName())
+		}
+	}
+	return result
+}
+
+// checkVisible fields と pred が visible の列だけを参照しているか
+func checkVisible(fields []string, pred *query.Predicate, visible []string, tables []string) error {
+	for _, fieldName := range slices.Concat(fields, pred.FieldNames()) {
+		if !slices.Contains(visible, fieldName) {
+			return fmt.Errorf("field %q not found in %s", fieldName, strings.Join(tables, ", "))
+		}
+	}
+	return nil
+}
+
+// createView ビューを作成する。OR REPLACE が指定されていれば、同じ名前のビューの定義を置き換える
+func createView(mdm *metadata.Manager, data *parse.CreateViewData, tx *tx.Transaction) error {
+	viewName := data.ViewName
+	layout, err := mdm.GetLayout(viewName, tx)
+	if err != nil {
+		return err
+	}
+	if len(layout.Schema().Fields()) > 0 {
+		return fmt.Errorf("table %q already exists", viewName)
+	}
+	viewDef, err := mdm.GetViewDef(viewName, tx)
+	if err != nil {
+		return err
+	}
+	if viewDef != "" && !data.OrReplace {
+		return fmt.Errorf("view %q already exists", viewName)
+	}
+
+	// ビューの定義が存在する表と列だけを参照し、自身を参照しないことを確かめる
+	if err := checkViewQuery(mdm, viewName, data.QueryData, tx); err != nil {
+		return err
+	}
+
+	if viewDef != "" {
+		return mdm.ReplaceView(viewName, data.ViewDef(), tx)
+	}
+	return mdm.CreateView(viewName, data.ViewDef(), tx)
+}
+
+// checkViewQuery ビュー viewName の定義の問合せ data が、存在する表と列だけを参照し、自身を参照しないかを確かめる
+// 集合演算は両側の問合せを確かめる
+func checkViewQuery(mdm *metadata.Manager, viewName string, data *parse.QueryData, tx *tx.Transaction) error {
+	if data.SetOp != nil {
+		if err := checkViewQuery(mdm, viewName, data.SetOp.Lhs, tx); err != nil {
+			return err
+		}
+		return checkViewQuery(mdm, viewName, data.SetOp.Rhs, tx)
+	}
+	expanded, err := expandViewsIn(mdm, data, tx, []string{viewName})
+	if err != nil {
+		return err
+	}
+	refs, err := tableRefs(mdm, expanded, tx)
+	if err != nil {
+		return err
+	}
+	names := exposedNames(refs)
+	if expanded, err = exposeNames(expanded, names); err != nil {
+		return err
+	}
+	var visible []string
+	for _, name := range names {
+		visible = append(visible, name)
+	}
+	pred := query.NewPredicate()
+	pred.ConjoinWith(expanded.Pred)
+	for _, j := range expanded.Joins {
+		pred.ConjoinWith(j.On)
+	}
+	return checkVisible(selectedFields(expanded), pred, visible, expanded.Tables)
+}
+
+// updatableView tableName がビューであれば、展開したビューの定義を返す。ビューでなければ nil を返す
+// 更新できるのは、展開すると1つの表だけを参照し、AS を付けた列のないビュー
+func updatableView(mdm *metadata.Manager, tableName string, tx *tx.Transaction) (*parse.QueryData, error) {
+	viewDef, err := mdm.GetViewDef(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	if viewDef == "" {
+		return nil, nil
+	}
+	viewData, err := parseViewDef(tableName, viewDef)
+	if err != nil {
+		return nil, err
+	}
+	viewData, err = expandViewsIn(mdm, viewData, tx, []string{tableName})
+	if err != nil {
+		return nil, err
+	}
+	if viewData.SetOp != nil {
+		return nil, fmt.Errorf("view %q is not updatable because it has a set operation", tableName)
+	}
+	if len(viewData.Tables) != 1 {
+		return nil, fmt.Errorf("view %q is not updatable because it refers to more than one table", tableName)
+	}
+	if len(viewData.Derived) > 0 {
+		return nil, fmt.Errorf("view %q is not updatable because it refers to a derived table", tableName)
+	}
+	refs, err := tableRefs(mdm, viewData, tx)
+	if err != nil {
+		return nil, err
+	}
+	if viewData, err = exposeNames(viewData, exposedNames(refs)); err != nil {
+		return nil, err
+	}
+	if len(viewData.Exprs) > 0 || len(viewData.Windows) > 0 {
+		return nil, fmt.Errorf("view %q is not updatable because it has columns with AS", tableName)
+	}
+	return viewData, nil
+}
+
+// insertOnView ビューへの挿入を、ビューの表への挿入に書き換える。ビューにない列には既定値が入る
+func insertOnView(mdm *metadata.Manager, data *parse.InsertData, tx *tx.Transaction) (*parse.InsertData, error) {
+	view, err := updatableView(mdm, data.TableName, tx)
+	if err != nil || view == nil {
+		return data, err
+	}
+	if err := checkVisible(data.Fields, query.NewPredicate(), view.Fields, []string{data.TableName}); err != nil {
+		return nil, err
+	}
+	return parse.NewInsertData(view.TableName(view.Tables[0]), data.Fields, data.Values), nil
+}
+
+// modifyOnView ビューの更新を、ビューの述語を満たすビューの表のレコードの更新に書き換える
+func modifyOnView(mdm *metadata.Manager, data *parse.ModifyData, tx *tx.Transaction) (*parse.ModifyData, error) {
+	view, err := updatableView(mdm, data.TableName, tx)
+	if err != nil || view == nil {
+		return data, err
+	}
+	fields := []string{data.TargetField}
+	if data.NewValue.IsFieldName() {
+		fields = append(fields, data.NewValue.AsFieldName())
+	}
+	if err := checkVisible(fields, data.Pred, view.Fields, []string{data.TableName}); err != nil {
+		return nil, err
+	}
+	pred := query.NewPredicate()
+	pred.ConjoinWith(data.Pred)
+	pred.ConjoinWith(view.Pred)
+	return parse.NewModifyData(view.TableName(view.Tables[0]), data.TargetField, data.NewValue, pred), nil
+}
+
+// deleteOnView ビューからの削除を、ビューの述語を満たすビューの表のレコードの削除に書き換える
+func deleteOnView(mdm *metadata.Manager, data *parse.DeleteData, tx *tx.Transaction) (*parse.DeleteData, error) {
+	view, err := updatableView(mdm, data.TableName, tx)
+	if err != nil || view == nil {
+		return data, err
+	}
+	if err := checkVisible(nil, data.Pred, view.Fields, []string{data.TableName}); err != nil {
+		return nil, err
+	}
+	pred := query.NewPredicate()
+	pred.ConjoinWith(data.Pred)
+	pred.ConjoinWith(view.Pred)
+	return parse.NewDeleteData(view.TableName(view.Tables[0]), pred), nil
+}
+
+func parseViewDef(viewName string, viewDef string) (*parse.QueryData, error) {
+	parser, err := parse.NewParser(viewDef)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parser.Query()
+	if err != nil {
+		return nil, fmt.Errorf("definition of view %q: %w", viewName, err)
+	}
+	return data, nil
+}
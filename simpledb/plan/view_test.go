@@ -0,0 +1,81 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/server"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestView(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "view_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10), majorid int, gradyear int)"))
+			require.NoError(t, exec("create table dept (did int, dname varchar(10))"))
+			for i := 1; i <= 20; i++ {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid, gradyear) values (%d, 'name%d', %d, %d)", i, i, 10+i%2*10, 2020+i%3)))
+			}
+			require.NoError(t, exec("insert into dept (did, dname) values (10, 'compsci')"))
+			require.NoError(t, exec("insert into dept (did, dname) values (20, 'math')"))
+			require.NoError(t, exec("create view compsci as select sid, sname, majorid, gradyear from student where majorid = 10"))
+
+			// ビューに述語をつけて問い合わせる
+			assert.ElementsMatch(t, []int32{6, 12, 18}, queryInts(t, planner, tx, "select sid from compsci where gradyear = 2020"))
+			// ビューと表を結合する
+			assert.Len(t, queryInts(t, planner, tx, "select sid from compsci, dept where majorid = did"), 10)
+			// ビューの上のビュー
+			require.NoError(t, exec("create view compsci2020 as select sid, sname from compsci where gradyear = 2020"))
+			assert.ElementsMatch(t, []int32{6, 12, 18}, queryInts(t, planner, tx, "select sid from compsci2020"))
+			assert.Equal(t, []int32{12}, queryInts(t, planner, tx, "select sid from compsci2020 where sid = 12"))
+			// ビューが出力しない列は参照できない
+			_, err = planner.CreateQueryPlan("select sid from compsci2020 where gradyear = 2020", tx)
+			assert.Error(t, err)
+
+			// CREATE OR REPLACE VIEW
+			assert.Error(t, exec("create view compsci as select sid from student"))
+			assert.Error(t, exec("create view student as select sid from dept"))
+			assert.Error(t, exec("create view bad as select sid from nosuch"))
+			assert.Error(t, exec("create view bad as select nosuch from student"))
+			assert.Error(t, exec("create or replace view compsci as select sid, sname, majorid, gradyear from compsci2020"))
+			require.NoError(t, exec("create or replace view compsci as select sid, sname, majorid, gradyear from student where majorid = 20"))
+			assert.Len(t, queryInts(t, planner, tx, "select sid from compsci"), 10)
+			assert.ElementsMatch(t, []int32{3, 9, 15}, queryInts(t, planner, tx, "select sid from compsci2020"))
+
+			// 1つの表だけを参照するビューは更新できる。更新と削除はビューの述語を満たすレコードだけに及ぶ
+			require.NoError(t, exec("insert into compsci (sid, sname, majorid, gradyear) values (21, 'name21', 20, 2020)"))
+			assert.ElementsMatch(t, []int32{3, 9, 15, 21}, queryInts(t, planner, tx, "select sid from compsci2020"))
+			require.NoError(t, exec("update compsci set gradyear = 2030 where gradyear = 2021"))
+			assert.Empty(t, queryInts(t, planner, tx, "select sid from student where majorid = 20 and gradyear = 2021"))
+			assert.Len(t, queryInts(t, planner, tx, "select sid from student where gradyear = 2021"), 3)
+			require.NoError(t, exec("delete from compsci2020 where sid = 21"))
+			require.NoError(t, exec("delete from compsci where gradyear = 2030"))
+			assert.Len(t, queryInts(t, planner, tx, "select sid from student"), 16)
+			assert.Len(t, queryInts(t, planner, tx, "select sid from compsci"), 6)
+
+			// ビューが出力しない列は更新できず、複数の表を参照するビューは更新できない
+			assert.Error(t, exec("update compsci2020 set gradyear = 2030"))
+			assert.Error(t, exec("insert into compsci2020 (sid, gradyear) values (30, 2030)"))
+			require.NoError(t, exec("create view studentdept as select sid, dname from student, dept where majorid = did"))
+			assert.Error(t, exec("delete from studentdept where sid = 1"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
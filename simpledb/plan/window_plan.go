@@ -0,0 +1,140 @@
+package plan
+
+import (
+	"fmt"
+	"simpledb/parse"
+	"simpledb/query"
+	"simpledb/record"
+	"simpledb/tx"
+	"slices"
+	"strings"
+)
+
+var _ Plan = (*WindowPlan)(nil)
+
+// WindowPlan p を区画の列 partitionBy と並びの列 orderBy で一度だけソートし、
+// 区画ごとにウィンドウ関数 fns を計算した列を加える。descending[i] が true の列 orderBy[i] は降順に並べる
+type WindowPlan struct {
+	p           Plan
+	sorted      Plan
+	partitionBy []string
+	orderBy     []string
+	descending  []bool
+	fns         []*query.WindowFn
+	schema      *record.Schema
+}
+
+func NewWindowPlan(tx *tx.Transaction, p Plan, partitionBy []string, orderBy []string, descending []bool, fns []*query.WindowFn) (*WindowPlan, error) {
+	for _, fieldName := range slices.Concat(partitionBy, orderBy) {
+		if !p.Schema().HasField(fieldName) {
+			return nil, fmt.Errorf("field %q not found", fieldName)
+		}
+	}
+	schema := record.NewSchema()
+	schema.AddAll(p.Schema())
+	for _, fn := range fns {
+		field := fn.Field()
+		if field != "" && !p.Schema().HasField(field) {
+			return nil, fmt.Errorf("field %q not found", field)
+		}
+		switch fn.Name() {
+		case query.WindowLag, query.WindowLead, query.WindowMin, query.WindowMax:
+			schema.AddField(fn.FieldName(), p.Schema().Type(field), p.Schema().Length(field))
+		case query.WindowSum:
+			if p.Schema().Type(field) != record.INT {
+				return nil, fmt.Errorf("%s: field %q is not an integer", fn, field)
+			}
+			schema.AddIntField(fn.FieldName())
+		default:
+			schema.AddIntField(fn.FieldName())
+		}
+	}
+
+	sorted := p
+	if sortFields := slices.Concat(partitionBy, orderBy); len(sortFields) > 0 {
+		var err error
+		// 区画の列は昇順に並べる
+		desc := slices.Concat(make([]bool, len(partitionBy)), descending)
+		if sorted, err = NewSortPlanWithOrder(tx, p, sortFields, desc); err != nil {
+			return nil, err
+		}
+	}
+	return &WindowPlan{
+		p:           p,
+		sorted:      sorted,
+		partitionBy: partitionBy,
+		orderBy:     orderBy,
+		descending:  descending,
+		fns:         fns,
+		schema:      schema,
+	}, nil
+}
+
+// windowPlans 選択リストのウィンドウ関数の列を p に加える。区画と並びの列が同じ関数は、まとめて1回のソートで計算する
+func windowPlans(tx *tx.Transaction, p Plan, data *parse.QueryData) (Plan, error) {
+	var keys []string
+	windows := make(map[string][]string)
+	for _, fieldName := range data.Fields {
+		w, ok := data.Windows[fieldName]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%v %v %v", w.PartitionBy, w.OrderBy, w.Descending)
+		if _, ok := windows[key]; !ok {
+			keys = append(keys, key)
+		}
+		windows[key] = append(windows[key], fieldName)
+	}
+	for _, key := range keys {
+		w := data.Windows[windows[key][0]]
+		var fns []*query.WindowFn
+		for _, fieldName := range windows[key] {
+			fns = append(fns, data.Windows[fieldName].WindowFn(fieldName))
+		}
+		var err error
+		if p, err = NewWindowPlan(tx, p, w.PartitionBy, w.OrderBy, w.Descending, fns); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (wp *WindowPlan) Open() (query.Scan, error) {
+	s, err := wp.sorted.Open()
+	if err != nil {
+		return nil, err
+	}
+	ws, err := query.NewWindowScan(s, wp.p.Schema().Fields(), wp.partitionBy, wp.orderBy, wp.fns)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (wp *WindowPlan) BlocksAccessed() int32 {
+	return wp.sorted.BlocksAccessed()
+}
+
+func (wp *WindowPlan) RecordsOutput() int32 {
+	return wp.p.RecordsOutput()
+}
+
+func (wp *WindowPlan) DistinctValues(fieldName string) int32 {
+	if wp.p.Schema().HasField(fieldName) {
+		return wp.p.DistinctValues(fieldName)
+	}
+	return wp.p.RecordsOutput()
+}
+
+func (wp *WindowPlan) Schema() *record.Schema {
+	return wp.schema
+}
+
+func (wp *WindowPlan) Tree() *PlanNode {
+	fns := make([]string, 0, len(wp.fns))
+	for _, fn := range wp.fns {
+		fns = append(fns, fn.String())
+	}
+	return NewPlanNode(fmt.Sprintf("Window(%s partition by %v order by %v)", strings.Join(fns, ", "), wp.partitionBy, wp.orderBy), wp, []*PlanNode{wp.sorted.Tree()})
+}
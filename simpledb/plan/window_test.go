@@ -0,0 +1,79 @@
+package plan_test
+
+import (
+	"fmt"
+	"path"
+	"simpledb/server"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowFunctions(t *testing.T) {
+	newDBs := map[string]func(string) (*server.SimpleDB, error){
+		"basic":     server.NewSimpleDBWithMetadata,
+		"optimized": server.NewOptimizedSimpleDB,
+	}
+	for name, newDB := range newDBs {
+		t.Run(name, func(t *testing.T) {
+			simpleDB, err := newDB(path.Join(t.TempDir(), "window_test"))
+			require.NoError(t, err)
+			planner := simpleDB.Planner()
+
+			tx, err := simpleDB.NewTx()
+			require.NoError(t, err)
+			exec := func(cmd string) error {
+				_, err := planner.ExecuteUpdate(cmd, tx)
+				return err
+			}
+
+			require.NoError(t, exec("create table student (sid int, sname varchar(10), majorid int, grade int)"))
+			for i, row := range []string{"10, 90", "10, 80", "10, 90", "20, 70", "20, null", "null, 60"} {
+				require.NoError(t, exec(fmt.Sprintf("insert into student (sid, sname, majorid, grade) values (%d, 'name%d', %s)", i+1, i+1, row)))
+			}
+
+			// 順位は区画ごとに振り直す。NULL は先頭に並ぶ
+			assert.Equal(t, []string{"1|2", "2|1", "3|3", "4|2", "5|1", "6|1"}, queryRows(t, planner, tx, "select sid, row_number() over (partition by majorid order by grade, sid) as rn from student order by sid"))
+			assert.Equal(t, []string{"1|2|2", "2|2|2", "3|2|2", "4|5|3", "5|5|3", "6|1|1"}, queryRows(t, planner, tx, "select sid, rank() over (order by majorid) as r, dense_rank() over (order by majorid) as dr from student order by sid"))
+			// DESC を付けた並びの列は降順に並べ、NULL は末尾に並ぶ
+			assert.Equal(t, []string{"1|1", "2|3", "3|2", "4|4", "5|6", "6|5"}, queryRows(t, planner, tx, "select sid, row_number() over (order by grade desc, sid) as rn from student order by sid"))
+			assert.Equal(t, []string{"1|5|1", "2|4|3", "3|5|1", "4|3|4", "5|1|6", "6|2|5"}, queryRows(t, planner, tx, "select sid, rank() over (order by grade) as r, rank() over (order by grade desc) as d from student order by sid"))
+
+			// lag と lead は区画の外では NULL
+			assert.Equal(t, []string{"1|NULL|90", "2|90|70", "3|80|NULL", "4|90|60", "5|70|NULL", "6|NULL|NULL"}, queryRows(t, planner, tx, "select sid, lag(grade) over (order by sid) as prev, lead(grade, 2) over (order by sid) as next2 from student order by sid"))
+			assert.Equal(t, []string{"1|NULL", "2|'name1'", "3|'name2'", "4|NULL", "5|'name4'", "6|NULL"}, queryRows(t, planner, tx, "select sid, lag(sname) over (partition by majorid order by sid) as prev from student order by sid"))
+
+			// 集約は区画の先頭から、並びの値が等しいレコードまでを集約する。NULL は集約しない
+			assert.Equal(t, []string{"1|90|1|1|90", "2|170|2|2|90", "3|260|3|3|90", "4|70|1|1|70", "5|70|1|2|70", "6|60|1|1|60"}, queryRows(t, planner, tx, "select sid, sum(grade) over (partition by majorid order by sid) as s, count(grade) over (partition by majorid order by sid) as c, count(*) over (partition by majorid order by sid) as n, max(grade) over (partition by majorid order by sid) as m from student order by sid"))
+			assert.Equal(t, []string{"1|390", "2|210", "3|390", "4|130", "5|NULL", "6|60"}, queryRows(t, planner, tx, "select sid, sum(grade) over (order by grade) as s from student order by sid"))
+			assert.Equal(t, []string{"1|80|260", "2|80|260", "3|80|260", "4|70|70", "5|70|70", "6|60|60"}, queryRows(t, planner, tx, "select sid, min(grade) over (partition by majorid) as lo, sum(grade) over (partition by majorid) as total from student order by sid"))
+
+			// 区画と並びが同じウィンドウ関数は1回のソートで計算する
+			tree := planTree(t, planner, tx, "select sid, rank() over (partition by majorid order by grade) as r, count(*) over (partition by majorid order by grade) as c from student")
+			assert.Equal(t, 1, strings.Count(tree, "Window("))
+			tree = planTree(t, planner, tx, "select sid, rank() over (partition by majorid order by grade) as r, count(*) over (partition by majorid) as c from student")
+			assert.Equal(t, 2, strings.Count(tree, "Window("))
+
+			// ウィンドウ関数は WHERE の後に計算し、その列で ORDER BY できる
+			assert.Equal(t, []string{"1|1", "2|2", "3|3"}, queryRows(t, planner, tx, "select sid, row_number() over (order by sid) as rn from student where majorid = 10 order by sid"))
+			assert.Equal(t, []string{"5|1", "6|2", "4|3", "2|4", "1|5", "3|5"}, queryRows(t, planner, tx, "select sid, rank() over (order by grade) as r from student order by r, sid"))
+			assert.Equal(t, []string{"5|1", "6|2"}, queryRows(t, planner, tx, "select sid, rank() over (order by grade) as r from student order by r, sid limit 2"))
+
+			// 導出表、ビューと副問合せ
+			assert.Equal(t, []string{"5"}, queryRows(t, planner, tx, "select n from (select row_number() over (order by sid) as n from student) as t where n = 5"))
+			require.NoError(t, exec("create view ranked as select sid, majorid, rank() over (partition by majorid order by grade) as r from student"))
+			assert.Equal(t, []string{"2", "5", "6"}, queryRows(t, planner, tx, "select sid from ranked where r = 1 order by sid"))
+			assert.ElementsMatch(t, []int32{2, 5, 6}, queryInts(t, planner, tx, "select sid from student where sid in (select sid from ranked where r = 1)"))
+			assert.Error(t, exec("update ranked set majorid = 30 where sid = 1"))
+			require.NoError(t, exec("alter table student rename column grade to score"))
+			assert.Equal(t, []string{"2", "5", "6"}, queryRows(t, planner, tx, "select sid from ranked where r = 1 order by sid"))
+
+			assert.Error(t, queryError(planner, tx, "select sid, rank() over (order by nosuch) as r from student"))
+			assert.Error(t, queryError(planner, tx, "select sid, sum(sname) over () as s from student"))
+			assert.Error(t, exec("create view broken as select sid, max(nosuch) over () as m from student"))
+			require.NoError(t, tx.Commit())
+		})
+	}
+}
@@ -86,6 +86,11 @@ func (s *ChunkScan) GetString(fldname string) (string, error) {
 }
 
 func (s *ChunkScan) GetVal(fldname string) (*Constant, error) {
+	if null, err := s.rp.IsNull(s.currentSlot, fldname); err != nil {
+		return nil, fmt.Errorf("s.rp.IsNull: %w", err)
+	} else if null {
+		return NewNullConstant(), nil
+	}
 	if s.layout.Schema().Type(fldname) == record.INT {
 		i, err := s.GetInt(fldname)
 		if err != nil {
@@ -8,9 +8,16 @@ import (
 
 var ErrInvalidConstantType = fmt.Errorf("invalid constant type")
 
+// Constant 値。ival, sval, tval のいずれも持たないものは NULL を表す
 type Constant struct {
 	ival *int32
 	sval *string
+	// tval 複合索引のキー。各列の値を索引の列順に並べたもの
+	tval []*Constant
+}
+
+func NewNullConstant() *Constant {
+	return &Constant{}
 }
 
 func NewConstantWithInt(ival int32) *Constant {
@@ -21,6 +28,37 @@ func NewConstantWithString(sval string) *Constant {
 	return &Constant{sval: &sval}
 }
 
+// NewConstantWithTuple 複合索引のキーを作成する
+// 索引の先頭の一部の列だけを指定したキーは、前方一致検索に使うことができる
+func NewConstantWithTuple(vals ...*Constant) *Constant {
+	return &Constant{tval: vals}
+}
+
+func (c *Constant) IsNull() bool {
+	return c.ival == nil && c.sval == nil && c.tval == nil
+}
+
+// HasNull NULL であるか、NULL を含む複合キーであるか
+func (c *Constant) HasNull() bool {
+	for _, v := range c.tval {
+		if v.HasNull() {
+			return true
+		}
+	}
+	return c.IsNull()
+}
+
+func (c *Constant) IsTuple() bool {
+	return c.tval != nil
+}
+
+func (c *Constant) AsTuple() ([]*Constant, error) {
+	if c.tval == nil {
+		return nil, ErrInvalidConstantType
+	}
+	return c.tval, nil
+}
+
 func (c *Constant) AsInt() (int32, error) {
 	if c.ival == nil {
 		return 0, ErrInvalidConstantType
@@ -35,7 +73,23 @@ func (c *Constant) AsString() (string, error) {
 	return *c.sval, nil
 }
 
+// Equals 値として等しいか。NULL 同士は等しいとみなす
+// SQL の比較としての意味 (NULL との比較は成り立たない) は Term で扱う
 func (c *Constant) Equals(other *Constant) bool {
+	if c.IsNull() || other.IsNull() {
+		return c.IsNull() && other.IsNull()
+	}
+	if c.tval != nil {
+		if len(c.tval) != len(other.tval) {
+			return false
+		}
+		for i, v := range c.tval {
+			if !v.Equals(other.tval[i]) {
+				return false
+			}
+		}
+		return true
+	}
 	if c.ival != nil {
 		if other.ival == nil {
 			return false
@@ -49,7 +103,32 @@ func (c *Constant) Equals(other *Constant) bool {
 	}
 }
 
+// CompareTo 複合キー同士は辞書式に比較する
+// 長さが異なる場合は共通する先頭の列だけを比較するため、前方一致するキーとは 0 を返す
+// NULL は他のどの値よりも小さいとみなす
 func (c *Constant) CompareTo(other *Constant) (int, error) {
+	if c.IsNull() || other.IsNull() {
+		switch {
+		case c.IsNull() && other.IsNull():
+			return 0, nil
+		case c.IsNull():
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+	if c.tval != nil && other.tval != nil {
+		for i := 0; i < len(c.tval) && i < len(other.tval); i++ {
+			cmp, err := c.tval[i].CompareTo(other.tval[i])
+			if err != nil {
+				return 0, err
+			}
+			if cmp != 0 {
+				return cmp, nil
+			}
+		}
+		return 0, nil
+	}
 	if c.ival != nil && other.ival != nil {
 		if *c.ival > *other.ival {
 			return 1, nil
@@ -65,6 +144,13 @@ func (c *Constant) CompareTo(other *Constant) (int, error) {
 }
 
 func (c *Constant) HashCode() int32 {
+	if c.tval != nil {
+		var h int32 = 17
+		for _, v := range c.tval {
+			h = 31*h + v.HashCode()
+		}
+		return h
+	}
 	if c.ival != nil {
 		return *c.ival
 	}
@@ -77,13 +163,30 @@ func (c *Constant) HashCode() int32 {
 }
 
 func (c *Constant) String() string {
+	if c.tval != nil {
+		vals := make([]string, len(c.tval))
+		for i, v := range c.tval {
+			vals[i] = v.String()
+		}
+		return "(" + strings.Join(vals, ", ") + ")"
+	}
 	if c.ival != nil {
 		return fmt.Sprint(*c.ival)
 	}
-	return fmt.Sprintf("'%s'", *c.sval)
+	if c.sval != nil {
+		return fmt.Sprintf("'%s'", *c.sval)
+	}
+	return "NULL"
 }
 
 func (c *Constant) AnyValue() any {
+	if c.tval != nil {
+		vals := make([]any, len(c.tval))
+		for i, v := range c.tval {
+			vals[i] = v.AnyValue()
+		}
+		return vals
+	}
 	if c.ival != nil {
 		return *c.ival
 	}
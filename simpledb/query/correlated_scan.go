@@ -0,0 +1,64 @@
+package query
+
+var _ Scan = (*CorrelatedScan)(nil)
+
+// CorrelatedScan 相関副問合せのスキャン。副問合せのスキャンにない列は、外側の問合せの現在のレコードから読む
+// outerNames は副問合せの中で別名で修飾して書かれた外側の列 (s.sid) の、外側の問合せでの列名
+type CorrelatedScan struct {
+	scan       Scan
+	outer      Scan
+	outerNames map[string]string
+}
+
+func NewCorrelatedScan(scan Scan, outer Scan, outerNames map[string]string) *CorrelatedScan {
+	return &CorrelatedScan{
+		scan:       scan,
+		outer:      outer,
+		outerNames: outerNames,
+	}
+}
+
+func (cs *CorrelatedScan) outerName(fieldName string) string {
+	if name, ok := cs.outerNames[fieldName]; ok {
+		return name
+	}
+	return fieldName
+}
+
+func (cs *CorrelatedScan) BeforeFirst() error {
+	return cs.scan.BeforeFirst()
+}
+
+func (cs *CorrelatedScan) Next() (bool, error) {
+	return cs.scan.Next()
+}
+
+func (cs *CorrelatedScan) GetInt(fieldName string) (int32, error) {
+	if cs.scan.HasField(fieldName) {
+		return cs.scan.GetInt(fieldName)
+	}
+	return cs.outer.GetInt(cs.outerName(fieldName))
+}
+
+func (cs *CorrelatedScan) GetString(fieldName string) (string, error) {
+	if cs.scan.HasField(fieldName) {
+		return cs.scan.GetString(fieldName)
+	}
+	return cs.outer.GetString(cs.outerName(fieldName))
+}
+
+func (cs *CorrelatedScan) GetVal(fieldName string) (*Constant, error) {
+	if cs.scan.HasField(fieldName) {
+		return cs.scan.GetVal(fieldName)
+	}
+	return cs.outer.GetVal(cs.outerName(fieldName))
+}
+
+func (cs *CorrelatedScan) HasField(fieldName string) bool {
+	return cs.scan.HasField(fieldName) || cs.outer.HasField(cs.outerName(fieldName))
+}
+
+// Close 外側のスキャンは外側の問合せが閉じる
+func (cs *CorrelatedScan) Close() {
+	cs.scan.Close()
+}
@@ -0,0 +1,67 @@
+package query
+
+var _ Scan = (*DistinctScan)(nil)
+
+// DistinctScan 列 fields でソートされた scan のレコードのうち、直前のレコードと全ての列が等しいものを除いて返す
+type DistinctScan struct {
+	scan   Scan
+	fields []string
+	// last 最後に返したレコードの値
+	last *Constant
+}
+
+func NewDistinctScan(scan Scan, fields []string) *DistinctScan {
+	return &DistinctScan{
+		scan:   scan,
+		fields: fields,
+	}
+}
+
+func (ds *DistinctScan) BeforeFirst() error {
+	ds.last = nil
+	return ds.scan.BeforeFirst()
+}
+
+func (ds *DistinctScan) Next() (bool, error) {
+	for {
+		next, err := ds.scan.Next()
+		if err != nil || !next {
+			return false, err
+		}
+		vals := make([]*Constant, 0, len(ds.fields))
+		for _, fieldName := range ds.fields {
+			val, err := ds.scan.GetVal(fieldName)
+			if err != nil {
+				return false, err
+			}
+			vals = append(vals, val)
+		}
+		// NULL 同士は重複とみなす
+		key := NewConstantWithTuple(vals...)
+		if ds.last != nil && ds.last.Equals(key) {
+			continue
+		}
+		ds.last = key
+		return true, nil
+	}
+}
+
+func (ds *DistinctScan) GetInt(fieldName string) (int32, error) {
+	return ds.scan.GetInt(fieldName)
+}
+
+func (ds *DistinctScan) GetString(fieldName string) (string, error) {
+	return ds.scan.GetString(fieldName)
+}
+
+func (ds *DistinctScan) GetVal(fieldName string) (*Constant, error) {
+	return ds.scan.GetVal(fieldName)
+}
+
+func (ds *DistinctScan) HasField(fieldName string) bool {
+	return ds.scan.HasField(fieldName)
+}
+
+func (ds *DistinctScan) Close() {
+	ds.scan.Close()
+}
@@ -1,10 +1,15 @@
 package query
 
-import "simpledb/record"
+import (
+	"simpledb/record"
+	"strings"
+)
 
+// Expression 定数、列、またはスカラ副問合せ
 type Expression struct {
 	val       *Constant
 	fieldName *string
+	subquery  *Subquery
 }
 
 func NewExpressionWithConstant(val *Constant) *Expression {
@@ -15,10 +20,37 @@ func NewExpressionWithField(fieldName string) *Expression {
 	return &Expression{fieldName: &fieldName}
 }
 
+// NewExpressionWithQualifiedField 表名か別名 qualifier で修飾した列 (s.sid)
+func NewExpressionWithQualifiedField(qualifier, fieldName string) *Expression {
+	return NewExpressionWithField(QualifiedFieldName(qualifier, fieldName))
+}
+
+// QualifiedFieldName 表名か別名 qualifier で修飾した列名
+func QualifiedFieldName(qualifier, fieldName string) string {
+	return qualifier + "." + fieldName
+}
+
+// SplitFieldName 修飾された列名を、修飾する表名か別名と列名に分ける。修飾されていなければ qualifier は空
+func SplitFieldName(name string) (qualifier, fieldName string) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// NewExpressionWithSubquery 1つの値を返す副問合せ
+func NewExpressionWithSubquery(sq *Subquery) *Expression {
+	return &Expression{subquery: sq}
+}
+
 func (e *Expression) Evaluate(scan Scan) (*Constant, error) {
 	if e.val != nil {
 		return e.val, nil
 	}
+	if e.subquery != nil {
+		return e.subquery.Scalar(scan)
+	}
 	return scan.GetVal(*e.fieldName)
 }
 
@@ -26,6 +58,18 @@ func (e *Expression) IsFieldName() bool {
 	return e.fieldName != nil
 }
 
+func (e *Expression) IsConstant() bool {
+	return e.val != nil
+}
+
+func (e *Expression) IsSubquery() bool {
+	return e.subquery != nil
+}
+
+func (e *Expression) AsSubquery() *Subquery {
+	return e.subquery
+}
+
 func (e *Expression) AsConstant() *Constant {
 	return e.val
 }
@@ -34,16 +78,43 @@ func (e *Expression) AsFieldName() string {
 	return *e.fieldName
 }
 
+// AppliesTo 式が schema の列だけで評価できるか。副問合せは、参照する外側の列が schema にあれば評価できる
 func (e *Expression) AppliesTo(schema *record.Schema) bool {
 	if e.val != nil {
 		return true
 	}
+	if e.subquery != nil {
+		if e.subquery.Plan() == nil {
+			return false
+		}
+		for _, fieldName := range e.subquery.OuterFields() {
+			if !schema.HasField(fieldName) {
+				return false
+			}
+		}
+		return true
+	}
 	return schema.HasField(*e.fieldName)
 }
 
+// Substitute 列 fieldName であれば式 expr に置き換える
+func (e *Expression) Substitute(fieldName string, expr *Expression) *Expression {
+	if e.mentions(fieldName) {
+		return expr
+	}
+	return e
+}
+
+func (e *Expression) mentions(fieldName string) bool {
+	return e.fieldName != nil && *e.fieldName == fieldName
+}
+
 func (e *Expression) String() string {
 	if e.val != nil {
 		return e.val.String()
 	}
+	if e.subquery != nil {
+		return e.subquery.String()
+	}
 	return *e.fieldName
 }
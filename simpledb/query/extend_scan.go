@@ -0,0 +1,74 @@
+package query
+
+var _ Scan = (*ExtendScan)(nil)
+
+// ExtendScan 式 expr で計算する列 fieldName を加えたスキャン
+// 副問合せを何度も実行しないように、値はレコードごとに一度だけ計算する
+type ExtendScan struct {
+	scan      Scan
+	fieldName string
+	expr      *Expression
+	val       *Constant
+}
+
+func NewExtendScan(scan Scan, fieldName string, expr *Expression) *ExtendScan {
+	return &ExtendScan{
+		scan:      scan,
+		fieldName: fieldName,
+		expr:      expr,
+	}
+}
+
+func (es *ExtendScan) BeforeFirst() error {
+	es.val = nil
+	return es.scan.BeforeFirst()
+}
+
+func (es *ExtendScan) Next() (bool, error) {
+	es.val = nil
+	return es.scan.Next()
+}
+
+func (es *ExtendScan) GetInt(fieldName string) (int32, error) {
+	if fieldName != es.fieldName {
+		return es.scan.GetInt(fieldName)
+	}
+	val, err := es.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (es *ExtendScan) GetString(fieldName string) (string, error) {
+	if fieldName != es.fieldName {
+		return es.scan.GetString(fieldName)
+	}
+	val, err := es.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (es *ExtendScan) GetVal(fieldName string) (*Constant, error) {
+	if fieldName != es.fieldName {
+		return es.scan.GetVal(fieldName)
+	}
+	if es.val == nil {
+		val, err := es.expr.Evaluate(es.scan)
+		if err != nil {
+			return nil, err
+		}
+		es.val = val
+	}
+	return es.val, nil
+}
+
+func (es *ExtendScan) HasField(fieldName string) bool {
+	return fieldName == es.fieldName || es.scan.HasField(fieldName)
+}
+
+func (es *ExtendScan) Close() {
+	es.scan.Close()
+}
@@ -18,27 +18,53 @@ type HashJoinScan struct {
 	tx                 *tx.Transaction
 	buckets1, buckets2 []*TempTable
 	currentBucket      int
-	currentScan        *MultibufferProductScan
+	currentScan        Scan
+	// joinType 外部結合では、バケットごとに pred で入れ子ループ結合する
+	joinType JoinType
+	pred     *Predicate
 }
 
 func NewHashJoinScan(tx *tx.Transaction, buckets1, buckets2 []*TempTable) *HashJoinScan {
+	return NewOuterHashJoinScan(tx, buckets1, buckets2, InnerJoin, NewPredicate())
+}
+
+// NewOuterHashJoinScan 同じ番号のバケットのレコードを、結合条件 pred で joinType の結合をする
+func NewOuterHashJoinScan(tx *tx.Transaction, buckets1, buckets2 []*TempTable, joinType JoinType, pred *Predicate) *HashJoinScan {
 	return &HashJoinScan{
 		logger: logger.New("query.HashJoinScan", logger.Trace),
 
 		tx:       tx,
 		buckets1: buckets1,
 		buckets2: buckets2,
+		joinType: joinType,
+		pred:     pred,
 	}
 }
 
 func (hjs *HashJoinScan) BeforeFirst() error {
+	if hjs.currentScan != nil {
+		hjs.currentScan.Close()
+	}
 	hjs.currentBucket = 0
+	return hjs.openBucket()
+}
 
+// openBucket 現在のバケットの組を結合するスキャンを開く
+func (hjs *HashJoinScan) openBucket() error {
 	leftscan, err := hjs.buckets1[hjs.currentBucket].Open()
 	if err != nil {
 		return err
 	}
 
+	if hjs.joinType != InnerJoin {
+		rightscan, err := hjs.buckets2[hjs.currentBucket].Open()
+		if err != nil {
+			return err
+		}
+		hjs.currentScan, err = NewNestedLoopJoinScan(leftscan, rightscan, hjs.pred, hjs.joinType)
+		return err
+	}
+
 	hjs.currentScan, err = NewMultibufferProductScan(hjs.tx, leftscan, hjs.buckets2[hjs.currentBucket].TableName, hjs.buckets2[hjs.currentBucket].Layout())
 	if err != nil {
 		return err
@@ -68,18 +94,7 @@ func (hjs *HashJoinScan) Next() (bool, error) {
 		}
 
 		hjs.currentScan.Close()
-		leftscan, err := hjs.buckets1[hjs.currentBucket].Open()
-		if err != nil {
-			return false, err
-		}
-
-		hjs.currentScan, err = NewMultibufferProductScan(hjs.tx, leftscan, hjs.buckets2[hjs.currentBucket].TableName, hjs.buckets2[hjs.currentBucket].Layout())
-		if err != nil {
-			return false, err
-		}
-
-		err = hjs.currentScan.BeforeFirst()
-		if err != nil {
+		if err := hjs.openBucket(); err != nil {
 			return false, err
 		}
 
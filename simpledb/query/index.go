@@ -13,5 +13,18 @@ type Index interface {
 	GetDataRID() (*record.RID, error)
 	Insert(dataval *Constant, datarid *record.RID) error
 	Delete(dataval *Constant, datarid *record.RID) error
+	// ForEach 全てのエントリについて、そのキーとデータの位置で fn を呼ぶ。検索の位置は失われる
+	ForEach(fn func(dataval *Constant, datarid *record.RID) error) error
+	// Clear 全てのエントリを削除し、作ったばかりの空の索引に戻す
+	Clear() error
 	Close() error
 }
+
+// CoveringIndex 索引のレコードに列の値を持ち、データレコードを読まずに値を返せる索引
+type CoveringIndex interface {
+	Index
+	// GetVal Index が指し示す索引のレコードのフィールド fieldName の値
+	GetVal(fieldName string) (*Constant, error)
+	// InsertIncluding 包含列の値 included を索引のレコードに格納して挿入する
+	InsertIncluding(dataval *Constant, datarid *record.RID, included []*Constant) error
+}
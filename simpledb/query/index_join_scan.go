@@ -4,11 +4,39 @@ type IndexJoinScan struct {
 	lhs       Scan
 	idx       Index
 	joinField string
-	rhs       *TableScan
+	// rhs 右側のレコードを読むスキャン。索引だけで読む場合は索引のレコードから値を返す
+	rhs Scan
+	// ts 索引のエントリが指すデータレコードに移動する表のスキャン。索引だけで読む場合は nil
+	ts *TableScan
+	// joinType 左外部結合では、結合しない左側のレコードを右側の列を NULL にして返す
+	joinType JoinType
+	// pred 索引で引いた右側のレコードが満たすべき結合条件の残り
+	pred *Predicate
+	// lhsValid 左側が現在のレコードを指している
+	lhsValid bool
+	// idxDone 左側の現在のレコードについて索引を引き終えた
+	idxDone bool
+	matched bool
+	nullRhs bool
 }
 
 func NewIndexJoinScan(lhs Scan, idx Index, joinField string, rhs *TableScan) (*IndexJoinScan, error) {
-	s := &IndexJoinScan{lhs, idx, joinField, rhs}
+	return NewOuterIndexJoinScan(lhs, idx, joinField, rhs, InnerJoin, NewPredicate())
+}
+
+// NewOuterIndexJoinScan 索引で引いた右側のレコードのうち pred を満たすものと結合する。joinType は InnerJoin か LeftOuterJoin
+func NewOuterIndexJoinScan(lhs Scan, idx Index, joinField string, rhs *TableScan, joinType JoinType, pred *Predicate) (*IndexJoinScan, error) {
+	return newIndexJoinScan(&IndexJoinScan{lhs: lhs, idx: idx, joinField: joinField, rhs: rhs, ts: rhs, joinType: joinType, pred: pred})
+}
+
+// NewIndexOnlyJoinScan 右側の列の値を、データレコードを読まずに索引のレコードから返す索引結合
+// fields は右側の列から、その値を格納する索引のレコードのフィールドへの対応
+func NewIndexOnlyJoinScan(lhs Scan, idx CoveringIndex, joinField string, fields map[string]string, joinType JoinType, pred *Predicate) (*IndexJoinScan, error) {
+	rhs := &IndexOnlyScan{idx: idx, fields: fields}
+	return newIndexJoinScan(&IndexJoinScan{lhs: lhs, idx: idx, joinField: joinField, rhs: rhs, joinType: joinType, pred: pred})
+}
+
+func newIndexJoinScan(s *IndexJoinScan) (*IndexJoinScan, error) {
 	if err := s.BeforeFirst(); err != nil {
 		return nil, err
 	}
@@ -19,40 +47,68 @@ func (s *IndexJoinScan) BeforeFirst() error {
 	if err := s.lhs.BeforeFirst(); err != nil {
 		return err
 	}
-	if _, err := s.lhs.Next(); err != nil {
+	return s.nextLhs()
+}
+
+// nextLhs 次の左側のレコードに進み、その結合キーで索引を引く
+func (s *IndexJoinScan) nextLhs() error {
+	ok, err := s.lhs.Next()
+	if err != nil {
 		return err
 	}
+	s.lhsValid = ok
+	if !ok {
+		return nil
+	}
 	return s.resetIndex()
 }
 
 func (s *IndexJoinScan) Next() (bool, error) {
-	for {
-		if ok, err := s.idx.Next(); err != nil {
-			return false, err
-		} else if ok {
-			rid, err := s.idx.GetDataRID()
+	s.nullRhs = false
+	for s.lhsValid {
+		for !s.idxDone {
+			ok, err := s.idx.Next()
 			if err != nil {
 				return false, err
 			}
-			if err := s.rhs.MoveToRID(rid); err != nil {
+			if !ok {
+				s.idxDone = true
+				break
+			}
+			if s.ts != nil {
+				rid, err := s.idx.GetDataRID()
+				if err != nil {
+					return false, err
+				}
+				if err := s.ts.MoveToRID(rid); err != nil {
+					return false, err
+				}
+			}
+			if ok, err := s.pred.IsSatisfied(s); err != nil {
 				return false, err
+			} else if ok {
+				s.matched = true
+				return true, nil
 			}
-			return true, nil
 		}
 
-		if ok, err := s.lhs.Next(); err != nil {
-			return false, err
-		} else if !ok {
-			return false, nil
+		if s.joinType == LeftOuterJoin && !s.matched {
+			s.matched = true
+			s.nullRhs = true
+			return true, nil
 		}
-		if err := s.resetIndex(); err != nil {
+		if err := s.nextLhs(); err != nil {
 			return false, err
 		}
 	}
+	return false, nil
 }
 
 func (s *IndexJoinScan) GetInt(fieldName string) (int32, error) {
 	if s.rhs.HasField(fieldName) {
+		if s.nullRhs {
+			return 0, ErrInvalidConstantType
+		}
 		return s.rhs.GetInt(fieldName)
 	} else {
 		return s.lhs.GetInt(fieldName)
@@ -61,6 +117,9 @@ func (s *IndexJoinScan) GetInt(fieldName string) (int32, error) {
 
 func (s *IndexJoinScan) GetString(fieldName string) (string, error) {
 	if s.rhs.HasField(fieldName) {
+		if s.nullRhs {
+			return "", ErrInvalidConstantType
+		}
 		return s.rhs.GetString(fieldName)
 	} else {
 		return s.lhs.GetString(fieldName)
@@ -69,6 +128,9 @@ func (s *IndexJoinScan) GetString(fieldName string) (string, error) {
 
 func (s *IndexJoinScan) GetVal(fieldName string) (*Constant, error) {
 	if s.rhs.HasField(fieldName) {
+		if s.nullRhs {
+			return NewNullConstant(), nil
+		}
 		return s.rhs.GetVal(fieldName)
 	} else {
 		return s.lhs.GetVal(fieldName)
@@ -82,13 +144,21 @@ func (s *IndexJoinScan) HasField(fieldName string) bool {
 func (s *IndexJoinScan) Close() {
 	s.lhs.Close()
 	s.idx.Close()
-	s.rhs.Close()
+	if s.ts != nil {
+		s.ts.Close()
+	}
 }
 
 func (s *IndexJoinScan) resetIndex() error {
+	s.matched = false
 	searchKey, err := s.lhs.GetVal(s.joinField)
 	if err != nil {
 		return err
 	}
+	// 左側のレコードの結合キーが NULL であれば、どのレコードとも結合しないので索引を引かない
+	s.idxDone = searchKey.IsNull()
+	if s.idxDone {
+		return nil
+	}
 	return s.idx.BeforeFirst(searchKey)
 }
@@ -0,0 +1,60 @@
+package query
+
+import "fmt"
+
+// IndexOnlyScan 索引で検索したエントリの値を、データレコードを読まずに索引のレコードから返す
+// fields は出力する列から、その値を格納する索引のレコードのフィールドへの対応
+type IndexOnlyScan struct {
+	idx    CoveringIndex
+	val    *Constant
+	fields map[string]string
+}
+
+func NewIndexOnlyScan(idx CoveringIndex, val *Constant, fields map[string]string) (*IndexOnlyScan, error) {
+	s := &IndexOnlyScan{idx, val, fields}
+	if err := s.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *IndexOnlyScan) BeforeFirst() error {
+	return s.idx.BeforeFirst(s.val)
+}
+
+func (s *IndexOnlyScan) Next() (bool, error) {
+	return s.idx.Next()
+}
+
+func (s *IndexOnlyScan) GetInt(fieldName string) (int32, error) {
+	val, err := s.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (s *IndexOnlyScan) GetString(fieldName string) (string, error) {
+	val, err := s.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (s *IndexOnlyScan) GetVal(fieldName string) (*Constant, error) {
+	indexField, ok := s.fields[fieldName]
+	if !ok {
+		return nil, fmt.Errorf("field %s is not covered by the index", fieldName)
+	}
+	return s.idx.GetVal(indexField)
+}
+
+func (s *IndexOnlyScan) HasField(fieldName string) bool {
+	_, ok := s.fields[fieldName]
+	return ok
+}
+
+func (s *IndexOnlyScan) Close() {
+	s.idx.Close()
+}
@@ -6,8 +6,12 @@ type IndexSelectScan struct {
 	val       *Constant
 }
 
-func NewIndexSelectScan(tableScan *TableScan, idx Index, val *Constant) *IndexSelectScan {
-	return &IndexSelectScan{tableScan, idx, val}
+func NewIndexSelectScan(tableScan *TableScan, idx Index, val *Constant) (*IndexSelectScan, error) {
+	s := &IndexSelectScan{tableScan, idx, val}
+	if err := s.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 func (p *IndexSelectScan) BeforeFirst() error {
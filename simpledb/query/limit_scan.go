@@ -0,0 +1,70 @@
+package query
+
+var _ Scan = (*LimitScan)(nil)
+
+// LimitScan scan の先頭の offset 件を読み飛ばし、続く最大 limit 件のレコードを返す
+// limit 件を返した後は scan を読み進めない
+type LimitScan struct {
+	scan          Scan
+	limit, offset int32
+	// count 返したレコードの数
+	count int32
+	// skipped offset 件を読み飛ばした
+	skipped bool
+}
+
+// NewLimitScan limit が負であれば件数を制限しない
+func NewLimitScan(scan Scan, limit, offset int32) *LimitScan {
+	return &LimitScan{
+		scan:   scan,
+		limit:  limit,
+		offset: offset,
+	}
+}
+
+func (ls *LimitScan) BeforeFirst() error {
+	ls.count = 0
+	ls.skipped = false
+	return ls.scan.BeforeFirst()
+}
+
+func (ls *LimitScan) Next() (bool, error) {
+	if ls.limit >= 0 && ls.count >= ls.limit {
+		return false, nil
+	}
+	if !ls.skipped {
+		for range ls.offset {
+			next, err := ls.scan.Next()
+			if err != nil || !next {
+				return false, err
+			}
+		}
+		ls.skipped = true
+	}
+	next, err := ls.scan.Next()
+	if err != nil || !next {
+		return false, err
+	}
+	ls.count++
+	return true, nil
+}
+
+func (ls *LimitScan) GetInt(fieldName string) (int32, error) {
+	return ls.scan.GetInt(fieldName)
+}
+
+func (ls *LimitScan) GetString(fieldName string) (string, error) {
+	return ls.scan.GetString(fieldName)
+}
+
+func (ls *LimitScan) GetVal(fieldName string) (*Constant, error) {
+	return ls.scan.GetVal(fieldName)
+}
+
+func (ls *LimitScan) HasField(fieldName string) bool {
+	return ls.scan.HasField(fieldName)
+}
+
+func (ls *LimitScan) Close() {
+	ls.scan.Close()
+}
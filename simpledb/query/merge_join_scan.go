@@ -2,24 +2,45 @@ package query
 
 import (
 	"fmt"
-	"strings"
+	"simpledb/record"
 )
 
 var _ Scan = (*MergeJoinScan)(nil)
 
+// MergeJoinScan 結合キーで整列した s1 と s2 を併合して結合する
+// s2 のうち結合キーが同じレコードの組はメモリに読み込み、同じキーを持つ s1 のレコードごとに繰り返し返す
 type MergeJoinScan struct {
 	s1, s2                 *SortScan
 	fieldName1, fieldName2 string
-	joinVal                *Constant
+	sch1, sch2             *record.Schema
+	joinType               JoinType
+
+	hasMore1, hasMore2 bool
+	// group 結合キーが joinVal の s2 のレコードの列の値
+	joinVal *Constant
+	group   []map[string]*Constant
+	// groupPos s1 の現在のレコードと結合している group のレコード。結合していなければ -1
+	groupPos int
+	// nullLhs, nullRhs 現在のレコードの s1、s2 の列が NULL
+	nullLhs, nullRhs bool
+	// advance1, advance2 次の Next で s1、s2 を読み進める
+	advance1, advance2 bool
 }
 
-func NewMergeJoinScan(s1, s2 *SortScan, fieldName1, fieldName2 string) *MergeJoinScan {
-	return &MergeJoinScan{
+func NewMergeJoinScan(s1, s2 *SortScan, fieldName1, fieldName2 string, sch1, sch2 *record.Schema, joinType JoinType) (*MergeJoinScan, error) {
+	mjs := &MergeJoinScan{
 		s1:         s1,
 		s2:         s2,
 		fieldName1: fieldName1,
 		fieldName2: fieldName2,
+		sch1:       sch1,
+		sch2:       sch2,
+		joinType:   joinType,
+	}
+	if err := mjs.BeforeFirst(); err != nil {
+		return nil, err
 	}
+	return mjs, nil
 }
 
 func (mjs *MergeJoinScan) Close() {
@@ -36,102 +57,185 @@ func (mjs *MergeJoinScan) BeforeFirst() error {
 	if err != nil {
 		return fmt.Errorf("mjs.s2.BeforeFirst(): %v", err)
 	}
+	if mjs.hasMore1, err = mjs.s1.Next(); err != nil {
+		return fmt.Errorf("mjs.s1.Next(): %v", err)
+	}
+	if mjs.hasMore2, err = mjs.s2.Next(); err != nil {
+		return fmt.Errorf("mjs.s2.Next(): %v", err)
+	}
+	mjs.joinVal, mjs.group, mjs.groupPos = nil, nil, -1
+	mjs.nullLhs, mjs.nullRhs = false, false
+	mjs.advance1, mjs.advance2 = false, false
 	return nil
 }
 
 func (mjs *MergeJoinScan) Next() (bool, error) {
-	var v1, v2 *Constant
-	hasMore2, err := mjs.s2.Next()
-	if err != nil {
-		return false, fmt.Errorf("mjs.s2.Next(): %v", err)
-	}
-	if hasMore2 {
-		v2, err = mjs.s2.GetVal(mjs.fieldName2)
-		if err != nil {
-			return false, fmt.Errorf("mjs.s2.GetVal(%s): %v", mjs.fieldName2, err)
+	var err error
+	mjs.nullLhs, mjs.nullRhs = false, false
+	if mjs.advance1 {
+		mjs.advance1 = false
+		if mjs.hasMore1, err = mjs.s1.Next(); err != nil {
+			return false, fmt.Errorf("mjs.s1.Next(): %v", err)
 		}
-		if mjs.joinVal != nil && v2.Equals(mjs.joinVal) {
-			return true, nil
+	}
+	if mjs.advance2 {
+		mjs.advance2 = false
+		if mjs.hasMore2, err = mjs.s2.Next(); err != nil {
+			return false, fmt.Errorf("mjs.s2.Next(): %v", err)
 		}
 	}
 
-	hasMore1, err := mjs.s1.Next()
-	if err != nil {
-		return false, fmt.Errorf("mjs.s1.Next(): %v", err)
-	}
-	if hasMore1 {
-		v1, err = mjs.s1.GetVal(mjs.fieldName1)
-		if err != nil {
-			return false, fmt.Errorf("mjs.s1.GetVal(%s): %v", mjs.fieldName1, err)
-		}
-		if mjs.joinVal != nil && v1.Equals(mjs.joinVal) {
-			err := mjs.s2.RestorePosition()
-			if err != nil {
-				return false, fmt.Errorf("mjs.s2.RestorePosition(): %v", err)
+	for {
+		if mjs.groupPos >= 0 {
+			mjs.groupPos++
+			if mjs.groupPos < len(mjs.group) {
+				return true, nil
+			}
+			mjs.groupPos = -1
+			if mjs.hasMore1, err = mjs.s1.Next(); err != nil {
+				return false, fmt.Errorf("mjs.s1.Next(): %v", err)
 			}
-			return true, nil
+			continue
 		}
-	}
 
-	for hasMore1 && hasMore2 {
-		v1, err = mjs.s1.GetVal(mjs.fieldName1)
-		if err != nil {
-			return false, fmt.Errorf("mjs.s1.GetVal(%s): %v", mjs.fieldName1, err)
+		var v1, v2 *Constant
+		if mjs.hasMore1 {
+			if v1, err = mjs.s1.GetVal(mjs.fieldName1); err != nil {
+				return false, fmt.Errorf("mjs.s1.GetVal(%s): %v", mjs.fieldName1, err)
+			}
+			if mjs.group != nil && !v1.IsNull() && v1.Equals(mjs.joinVal) {
+				mjs.groupPos = 0
+				return true, nil
+			}
 		}
-		v2, err = mjs.s2.GetVal(mjs.fieldName2)
-		if err != nil {
-			return false, fmt.Errorf("mjs.s2.GetVal(%s): %v", mjs.fieldName2, err)
+		mjs.group = nil
+		if mjs.hasMore2 {
+			if v2, err = mjs.s2.GetVal(mjs.fieldName2); err != nil {
+				return false, fmt.Errorf("mjs.s2.GetVal(%s): %v", mjs.fieldName2, err)
+			}
+		}
+
+		switch {
+		case !mjs.hasMore1 && !mjs.hasMore2:
+			return false, nil
+		case !mjs.hasMore1:
+			return mjs.rhsOnly()
+		case !mjs.hasMore2:
+			if mjs.joinType == InnerJoin {
+				return false, nil
+			}
+			return mjs.lhsOnly()
 		}
 
-		cmp := strings.Compare(v1.String(), v2.String())
+		// NULL はどの値とも結合しない
+		cmp := 0
+		if v1.IsNull() {
+			cmp = -1
+		} else if v2.IsNull() {
+			cmp = 1
+		} else if cmp, err = v1.CompareTo(v2); err != nil {
+			return false, err
+		}
 		if cmp < 0 {
-			hasMore1, err = mjs.s1.Next()
-			if err != nil {
-				return false, fmt.Errorf("mjs.s1.Next(): %v", err)
+			if mjs.joinType != InnerJoin {
+				return mjs.lhsOnly()
 			}
-		} else if cmp > 0 {
-			hasMore2, err = mjs.s2.Next()
-			if err != nil {
-				return false, fmt.Errorf("mjs.s2.Next(): %v", err)
+			if mjs.hasMore1, err = mjs.s1.Next(); err != nil {
+				return false, fmt.Errorf("mjs.s1.Next(): %v", err)
 			}
-		} else {
-			err := mjs.s2.SavePosition()
-			if err != nil {
-				return false, fmt.Errorf("mjs.s2.SavePosition(): %v", err)
+			continue
+		}
+		if cmp > 0 {
+			if mjs.joinType == FullOuterJoin {
+				return mjs.rhsOnly()
 			}
-			val, err := mjs.s2.GetVal(mjs.fieldName2)
-			if err != nil {
-				return false, fmt.Errorf("mjs.s2.GetVal(%s): %v", mjs.fieldName2, err)
+			if mjs.hasMore2, err = mjs.s2.Next(); err != nil {
+				return false, fmt.Errorf("mjs.s2.Next(): %v", err)
 			}
-			mjs.joinVal = val
-			return true, nil
+			continue
+		}
+
+		if err := mjs.readGroup(v2); err != nil {
+			return false, err
 		}
 	}
+}
+
+// lhsOnly s1 の現在のレコードを、s2 の列を NULL にして返す
+func (mjs *MergeJoinScan) lhsOnly() (bool, error) {
+	mjs.nullRhs = true
+	mjs.advance1 = true
+	return true, nil
+}
+
+// rhsOnly 完全外部結合であれば、s2 の現在のレコードを s1 の列を NULL にして返す
+func (mjs *MergeJoinScan) rhsOnly() (bool, error) {
+	if mjs.joinType != FullOuterJoin {
+		return false, nil
+	}
+	mjs.nullLhs = true
+	mjs.advance2 = true
+	return true, nil
+}
 
-	return false, nil
+// readGroup 結合キーが joinVal の s2 のレコードを全て読み込む
+func (mjs *MergeJoinScan) readGroup(joinVal *Constant) error {
+	mjs.joinVal = joinVal
+	mjs.group = []map[string]*Constant{}
+	for mjs.hasMore2 {
+		v2, err := mjs.s2.GetVal(mjs.fieldName2)
+		if err != nil {
+			return fmt.Errorf("mjs.s2.GetVal(%s): %v", mjs.fieldName2, err)
+		}
+		if !v2.Equals(joinVal) {
+			return nil
+		}
+		row := make(map[string]*Constant, len(mjs.sch2.Fields()))
+		for _, fieldName := range mjs.sch2.Fields() {
+			if row[fieldName], err = mjs.s2.GetVal(fieldName); err != nil {
+				return fmt.Errorf("mjs.s2.GetVal(%s): %v", fieldName, err)
+			}
+		}
+		mjs.group = append(mjs.group, row)
+		if mjs.hasMore2, err = mjs.s2.Next(); err != nil {
+			return fmt.Errorf("mjs.s2.Next(): %v", err)
+		}
+	}
+	return nil
 }
 
 func (mjs *MergeJoinScan) GetInt(fieldName string) (int32, error) {
-	if mjs.s1.HasField(fieldName) {
-		return mjs.s1.GetInt(fieldName)
+	val, err := mjs.GetVal(fieldName)
+	if err != nil {
+		return 0, err
 	}
-	return mjs.s2.GetInt(fieldName)
+	return val.AsInt()
 }
 
 func (mjs *MergeJoinScan) GetString(fieldName string) (string, error) {
-	if mjs.s1.HasField(fieldName) {
-		return mjs.s1.GetString(fieldName)
+	val, err := mjs.GetVal(fieldName)
+	if err != nil {
+		return "", err
 	}
-	return mjs.s2.GetString(fieldName)
+	return val.AsString()
 }
 
 func (mjs *MergeJoinScan) GetVal(fieldName string) (*Constant, error) {
-	if mjs.s1.HasField(fieldName) {
+	if mjs.sch1.HasField(fieldName) {
+		if mjs.nullLhs {
+			return NewNullConstant(), nil
+		}
 		return mjs.s1.GetVal(fieldName)
 	}
+	if mjs.nullRhs {
+		return NewNullConstant(), nil
+	}
+	if mjs.groupPos >= 0 {
+		return mjs.group[mjs.groupPos][fieldName], nil
+	}
 	return mjs.s2.GetVal(fieldName)
 }
 
 func (mjs *MergeJoinScan) HasField(fieldName string) bool {
-	return mjs.s1.HasField(fieldName) || mjs.s2.HasField(fieldName)
+	return mjs.sch1.HasField(fieldName) || mjs.sch2.HasField(fieldName)
 }
@@ -29,6 +29,14 @@ func (mf *MinFn) ProcessNext(scan Scan) error {
 	if err != nil {
 		return fmt.Errorf("scan.GetVal(): %v", err)
 	}
+	// NULL は最小値に含めない
+	if val.IsNull() {
+		return nil
+	}
+	if mf.val.IsNull() {
+		mf.val = val
+		return nil
+	}
 	cmp, err := val.CompareTo(mf.val)
 	if err != nil {
 		return fmt.Errorf("val.CompareTo(): %v", err)
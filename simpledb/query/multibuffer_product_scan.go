@@ -37,7 +37,7 @@ func NewMultibufferProductScan(tx *tx.Transaction, lhs Scan, tableName string, l
 	chunkSize := BufferNeedsBestFactor(available, fileSize)
 	logger.Tracef("NewMultibufferProductScan(): chunkSize=BufferNeedsBestFactor(available=%d, fileSize=%d)=%d", available, fileSize, chunkSize)
 
-	return &MultibufferProductScan{
+	s := &MultibufferProductScan{
 		logger: logger,
 
 		tx:        tx,
@@ -46,7 +46,8 @@ func NewMultibufferProductScan(tx *tx.Transaction, lhs Scan, tableName string, l
 		layout:    layout,
 		fileSize:  fileSize,
 		chunkSize: chunkSize,
-	}, nil
+	}
+	return s, nil
 }
 
 func (s *MultibufferProductScan) BeforeFirst() error {
@@ -68,6 +69,10 @@ func (s *MultibufferProductScan) BeforeFirst() error {
  * @see simpledb.query.Scan#next()
  */
 func (s *MultibufferProductScan) Next() (bool, error) {
+	// 右側が空であればチャンクは1つもない
+	if s.prod == nil {
+		return false, nil
+	}
 	for {
 		next, err := s.prod.Next()
 		if err != nil {
@@ -90,7 +95,11 @@ func (s *MultibufferProductScan) Next() (bool, error) {
 }
 
 func (s *MultibufferProductScan) Close() {
-	s.prod.Close()
+	if s.prod != nil {
+		s.prod.Close()
+	} else {
+		s.lhs.Close()
+	}
 }
 
 func (s *MultibufferProductScan) GetVal(fldname string) (*Constant, error) {
@@ -133,6 +142,7 @@ func (s *MultibufferProductScan) useNextChunk() (bool, error) {
 		return false, fmt.Errorf("s.lhs.BeforeFirst: %w", err)
 	}
 
+	s.rhs = rhs
 	s.prod, err = NewProductScan(s.lhs, rhs)
 	if err != nil {
 		return false, fmt.Errorf("NewProductScan: %w", err)
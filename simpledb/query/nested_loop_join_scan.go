@@ -0,0 +1,171 @@
+package query
+
+// JoinType 結合の種類
+type JoinType int
+
+const (
+	// InnerJoin 結合条件を満たすレコードの組だけを返す
+	InnerJoin JoinType = iota
+	// LeftOuterJoin 右側のどのレコードとも結合しない左側のレコードは、右側の列を NULL にして返す
+	LeftOuterJoin
+	// FullOuterJoin 左右どちらの結合しないレコードも、相手側の列を NULL にして返す
+	FullOuterJoin
+)
+
+func (jt JoinType) String() string {
+	switch jt {
+	case LeftOuterJoin:
+		return "left outer"
+	case FullOuterJoin:
+		return "full outer"
+	}
+	return "inner"
+}
+
+var _ Scan = (*NestedLoopJoinScan)(nil)
+
+// NestedLoopJoinScan 左側のレコードごとに右側を全て読み、結合条件 pred を満たす組を返す
+// 完全外部結合では、右側の何番目のレコードが結合したかを覚えておき、左側を読み終えた後に結合しなかったものを返す
+type NestedLoopJoinScan struct {
+	lhs, rhs Scan
+	pred     *Predicate
+	joinType JoinType
+
+	// lhsDone 左側の現在のレコードについて右側を読み終えた
+	lhsDone bool
+	// lhsEnd 左側を読み終えた
+	lhsEnd bool
+	// matched 左側の現在のレコードが右側のいずれかと結合した
+	matched bool
+	// rhsPos 右側の現在のレコードの位置
+	rhsPos     int
+	rhsMatched []bool
+	// nullLhs, nullRhs 現在のレコードの左側、右側の列が NULL
+	nullLhs, nullRhs bool
+}
+
+func NewNestedLoopJoinScan(lhs, rhs Scan, pred *Predicate, joinType JoinType) (*NestedLoopJoinScan, error) {
+	s := &NestedLoopJoinScan{lhs: lhs, rhs: rhs, pred: pred, joinType: joinType}
+	if err := s.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *NestedLoopJoinScan) BeforeFirst() error {
+	s.lhsDone, s.lhsEnd, s.matched = true, false, false
+	s.rhsMatched = nil
+	s.nullLhs, s.nullRhs = false, false
+	return s.lhs.BeforeFirst()
+}
+
+func (s *NestedLoopJoinScan) Next() (bool, error) {
+	s.nullLhs, s.nullRhs = false, false
+	for !s.lhsEnd {
+		if s.lhsDone {
+			next, err := s.lhs.Next()
+			if err != nil {
+				return false, err
+			}
+			if !next {
+				s.lhsEnd = true
+				if err := s.rhs.BeforeFirst(); err != nil {
+					return false, err
+				}
+				s.rhsPos = -1
+				break
+			}
+			if err := s.rhs.BeforeFirst(); err != nil {
+				return false, err
+			}
+			s.lhsDone, s.matched, s.rhsPos = false, false, -1
+		}
+
+		next, err := s.rhs.Next()
+		if err != nil {
+			return false, err
+		}
+		if next {
+			s.rhsPos++
+			ok, err := s.pred.IsSatisfied(s)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				s.matched = true
+				s.markMatched()
+				return true, nil
+			}
+			continue
+		}
+
+		s.lhsDone = true
+		if s.joinType != InnerJoin && !s.matched {
+			s.nullRhs = true
+			return true, nil
+		}
+	}
+
+	if s.joinType != FullOuterJoin {
+		return false, nil
+	}
+	for {
+		next, err := s.rhs.Next()
+		if err != nil || !next {
+			return false, err
+		}
+		s.rhsPos++
+		if s.rhsPos >= len(s.rhsMatched) || !s.rhsMatched[s.rhsPos] {
+			s.nullLhs = true
+			return true, nil
+		}
+	}
+}
+
+func (s *NestedLoopJoinScan) markMatched() {
+	if s.joinType != FullOuterJoin {
+		return
+	}
+	for len(s.rhsMatched) <= s.rhsPos {
+		s.rhsMatched = append(s.rhsMatched, false)
+	}
+	s.rhsMatched[s.rhsPos] = true
+}
+
+func (s *NestedLoopJoinScan) GetInt(fieldName string) (int32, error) {
+	val, err := s.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (s *NestedLoopJoinScan) GetString(fieldName string) (string, error) {
+	val, err := s.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (s *NestedLoopJoinScan) GetVal(fieldName string) (*Constant, error) {
+	if s.lhs.HasField(fieldName) {
+		if s.nullLhs {
+			return NewNullConstant(), nil
+		}
+		return s.lhs.GetVal(fieldName)
+	}
+	if s.nullRhs {
+		return NewNullConstant(), nil
+	}
+	return s.rhs.GetVal(fieldName)
+}
+
+func (s *NestedLoopJoinScan) HasField(fieldName string) bool {
+	return s.lhs.HasField(fieldName) || s.rhs.HasField(fieldName)
+}
+
+func (s *NestedLoopJoinScan) Close() {
+	s.lhs.Close()
+	s.rhs.Close()
+}
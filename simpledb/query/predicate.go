@@ -3,6 +3,7 @@ package query
 import (
 	"math"
 	"simpledb/record"
+	"slices"
 	"strings"
 )
 
@@ -39,6 +40,85 @@ func (p *Predicate) IsSatisfied(scan Scan) (bool, error) {
 	return true, nil
 }
 
+// IsNotFalse 述語が偽でないか。CHECK 制約のように、NULL との比較を含む UNKNOWN な述語も満たすものとみなす
+func (p *Predicate) IsNotFalse(scan Scan) (bool, error) {
+	for _, term := range p.terms {
+		notFalse, err := term.isNotFalse(scan)
+		if err != nil {
+			return false, err
+		}
+		if !notFalse {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AppliesTo 述語の全ての項が schema の列だけで評価できるか
+func (p *Predicate) AppliesTo(schema *record.Schema) bool {
+	for _, term := range p.terms {
+		if !term.AppliesTo(schema) {
+			return false
+		}
+	}
+	return true
+}
+
+// RenameField 列 oldName を newName に置き換えた述語
+func (p *Predicate) RenameField(oldName, newName string) *Predicate {
+	return p.Substitute(oldName, NewExpressionWithField(newName))
+}
+
+// Substitute 列 fieldName を式 expr に置き換えた述語
+func (p *Predicate) Substitute(fieldName string, expr *Expression) *Predicate {
+	result := NewPredicate()
+	for _, term := range p.terms {
+		result.terms = append(result.terms, term.substitute(fieldName, expr))
+	}
+	return result
+}
+
+// FieldNames 述語が参照する列
+func (p *Predicate) FieldNames() []string {
+	var result []string
+	for _, term := range p.terms {
+		for _, e := range []*Expression{term.lhs, term.rhs} {
+			if e != nil && e.IsFieldName() && !slices.Contains(result, e.AsFieldName()) {
+				result = append(result, e.AsFieldName())
+			}
+		}
+	}
+	return result
+}
+
+// Terms 述語の項
+func (p *Predicate) Terms() []*Term {
+	return p.terms
+}
+
+// Subqueries 述語の項に含まれる副問合せ
+func (p *Predicate) Subqueries() []*Subquery {
+	var result []*Subquery
+	for _, term := range p.terms {
+		for _, e := range []*Expression{term.lhs, term.rhs} {
+			if e != nil && e.IsSubquery() {
+				result = append(result, e.AsSubquery())
+			}
+		}
+	}
+	return result
+}
+
+// Mentions 述語が列 fieldName を参照するか
+func (p *Predicate) Mentions(fieldName string) bool {
+	for _, term := range p.terms {
+		if term.mentions(fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Predicate) String() string {
 	var terms []string
 	for _, term := range p.terms {
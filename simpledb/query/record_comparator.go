@@ -6,14 +6,21 @@ import (
 
 type RecordComparator struct {
 	Fields []string
+	// Descending Fields の同じ位置の列を降順に比べるか。足りない分は昇順に比べる
+	Descending []bool
 }
 
 func NewRecordComparator(fields []string) *RecordComparator {
 	return &RecordComparator{Fields: fields}
 }
 
+// NewRecordComparatorWithOrder descending[i] が true の列 fields[i] を降順に比べる
+func NewRecordComparatorWithOrder(fields []string, descending []bool) *RecordComparator {
+	return &RecordComparator{Fields: fields, Descending: descending}
+}
+
 func (rc *RecordComparator) Compare(scan1, scan2 Scan) (int, error) {
-	for _, fieldName := range rc.Fields {
+	for i, fieldName := range rc.Fields {
 		val1, err := scan1.GetVal(fieldName)
 		if err != nil {
 			return 0, fmt.Errorf("scan1.GetVal(%s): %w", fieldName, err)
@@ -24,7 +31,11 @@ func (rc *RecordComparator) Compare(scan1, scan2 Scan) (int, error) {
 		}
 
 		if !val1.Equals(val2) {
-			return val1.CompareTo(val2)
+			cmp, err := val1.CompareTo(val2)
+			if err != nil {
+				return 0, err
+			}
+			return rc.order(i, cmp), nil
 		}
 	}
 
@@ -32,7 +43,7 @@ func (rc *RecordComparator) Compare(scan1, scan2 Scan) (int, error) {
 }
 
 func (rc *RecordComparator) CompareMap(vals1, vals2 map[string]*Constant) (int, error) {
-	for _, fieldName := range rc.Fields {
+	for i, fieldName := range rc.Fields {
 		val1, ok := vals1[fieldName]
 		if !ok {
 			return 0, fmt.Errorf("vals1 has no key %s", fieldName)
@@ -43,9 +54,21 @@ func (rc *RecordComparator) CompareMap(vals1, vals2 map[string]*Constant) (int,
 		}
 
 		if !val1.Equals(val2) {
-			return val1.CompareTo(val2)
+			cmp, err := val1.CompareTo(val2)
+			if err != nil {
+				return 0, err
+			}
+			return rc.order(i, cmp), nil
 		}
 	}
 
 	return 0, nil
 }
+
+// order i 番目の列の比較結果 cmp を、降順の列なら逆にする
+func (rc *RecordComparator) order(i int, cmp int) int {
+	if i < len(rc.Descending) && rc.Descending[i] {
+		return -cmp
+	}
+	return cmp
+}
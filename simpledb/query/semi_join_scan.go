@@ -0,0 +1,75 @@
+package query
+
+var _ Scan = (*SemiJoinScan)(nil)
+
+// SemiJoinScan scan のレコードのうち、列 fields の値が keys に含まれるものだけを返す
+// 複数の列で結合する場合、keys の要素は fields の順に値を並べた複合キー
+type SemiJoinScan struct {
+	scan   Scan
+	fields []string
+	keys   *ValueSet
+}
+
+func NewSemiJoinScan(scan Scan, fields []string, keys *ValueSet) *SemiJoinScan {
+	return &SemiJoinScan{
+		scan:   scan,
+		fields: fields,
+		keys:   keys,
+	}
+}
+
+// JoinKey 現在のレコードの列 fields の値。複数の列であれば複合キーにする
+func JoinKey(s Scan, fields []string) (*Constant, error) {
+	vals := make([]*Constant, 0, len(fields))
+	for _, fieldName := range fields {
+		val, err := s.GetVal(fieldName)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	if len(vals) == 1 {
+		return vals[0], nil
+	}
+	return NewConstantWithTuple(vals...), nil
+}
+
+func (ss *SemiJoinScan) BeforeFirst() error {
+	return ss.scan.BeforeFirst()
+}
+
+func (ss *SemiJoinScan) Next() (bool, error) {
+	for {
+		next, err := ss.scan.Next()
+		if err != nil || !next {
+			return false, err
+		}
+		key, err := JoinKey(ss.scan, ss.fields)
+		if err != nil {
+			return false, err
+		}
+		if !key.HasNull() && ss.keys.Contains(key) {
+			return true, nil
+		}
+	}
+}
+
+func (ss *SemiJoinScan) GetInt(fieldName string) (int32, error) {
+	return ss.scan.GetInt(fieldName)
+}
+
+func (ss *SemiJoinScan) GetString(fieldName string) (string, error) {
+	return ss.scan.GetString(fieldName)
+}
+
+func (ss *SemiJoinScan) GetVal(fieldName string) (*Constant, error) {
+	return ss.scan.GetVal(fieldName)
+}
+
+func (ss *SemiJoinScan) HasField(fieldName string) bool {
+	return ss.scan.HasField(fieldName)
+}
+
+func (ss *SemiJoinScan) Close() {
+	ss.scan.Close()
+}
@@ -0,0 +1,202 @@
+package query
+
+import "slices"
+
+// SetOp 重複を除く集合演算の種類
+type SetOp int
+
+const (
+	// Union 左右どちらかにあるレコード
+	Union SetOp = iota
+	// Intersect 左右の両方にあるレコード
+	Intersect
+	// Except 左側にあって右側にないレコード
+	Except
+)
+
+func (op SetOp) String() string {
+	switch op {
+	case Intersect:
+		return "intersect"
+	case Except:
+		return "except"
+	}
+	return "union"
+}
+
+var _ Scan = (*SetOpScan)(nil)
+
+// SetOpScan 全ての列でソートした左右のスキャンを併合して、集合演算 op の結果を重複なく返す
+// 左側の列 fields1 と右側の列 fields2 は位置で対応させ、列名は左側のものを使う
+type SetOpScan struct {
+	s1, s2           Scan
+	fields1, fields2 []string
+	op               SetOp
+
+	// has1, has2 左右のスキャンが現在のレコードを指している
+	has1, has2 bool
+	// key1, key2 左右の現在のレコードの値
+	key1, key2 *Constant
+	// current 最後に返したレコードの値
+	current *Constant
+}
+
+func NewSetOpScan(s1, s2 Scan, fields1, fields2 []string, op SetOp) (*SetOpScan, error) {
+	ss := &SetOpScan{
+		s1:      s1,
+		s2:      s2,
+		fields1: fields1,
+		fields2: fields2,
+		op:      op,
+	}
+	if err := ss.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+func (ss *SetOpScan) BeforeFirst() error {
+	if err := ss.s1.BeforeFirst(); err != nil {
+		return err
+	}
+	if err := ss.s2.BeforeFirst(); err != nil {
+		return err
+	}
+	ss.current = nil
+	if err := ss.advance1(); err != nil {
+		return err
+	}
+	return ss.advance2()
+}
+
+func (ss *SetOpScan) advance1() error {
+	var err error
+	ss.has1, ss.key1, err = nextKey(ss.s1, ss.fields1)
+	return err
+}
+
+func (ss *SetOpScan) advance2() error {
+	var err error
+	ss.has2, ss.key2, err = nextKey(ss.s2, ss.fields2)
+	return err
+}
+
+// nextKey スキャン s を次のレコードに進め、列 fields の値を並べた複合キーを返す
+func nextKey(s Scan, fields []string) (bool, *Constant, error) {
+	next, err := s.Next()
+	if err != nil || !next {
+		return false, nil, err
+	}
+	vals := make([]*Constant, 0, len(fields))
+	for _, fieldName := range fields {
+		val, err := s.GetVal(fieldName)
+		if err != nil {
+			return false, nil, err
+		}
+		vals = append(vals, val)
+	}
+	return true, NewConstantWithTuple(vals...), nil
+}
+
+func (ss *SetOpScan) Next() (bool, error) {
+	for {
+		key, ok, err := ss.nextCandidate()
+		if err != nil || !ok {
+			return false, err
+		}
+		// 入力はソートされているので、重複は直前に返したレコードと等しい
+		if ss.current != nil && ss.current.Equals(key) {
+			continue
+		}
+		ss.current = key
+		return true, nil
+	}
+}
+
+// nextCandidate 集合演算の結果になるレコードを、重複を除かずに1つ読む
+func (ss *SetOpScan) nextCandidate() (*Constant, bool, error) {
+	for {
+		cmp := 0
+		if ss.has1 && ss.has2 {
+			var err error
+			if cmp, err = ss.key1.CompareTo(ss.key2); err != nil {
+				return nil, false, err
+			}
+		}
+		switch ss.op {
+		case Union:
+			if ss.has1 && (!ss.has2 || cmp <= 0) {
+				key := ss.key1
+				return key, true, ss.advance1()
+			}
+			if ss.has2 {
+				key := ss.key2
+				return key, true, ss.advance2()
+			}
+			return nil, false, nil
+		case Intersect:
+			if !ss.has1 || !ss.has2 {
+				return nil, false, nil
+			}
+			if cmp == 0 {
+				key := ss.key1
+				return key, true, ss.advance1()
+			}
+		case Except:
+			if !ss.has1 {
+				return nil, false, nil
+			}
+			if !ss.has2 || cmp < 0 {
+				key := ss.key1
+				return key, true, ss.advance1()
+			}
+		}
+		// 小さい方を進める。等しければ左側を進め、右側は左側の重複のために残す
+		var err error
+		if cmp <= 0 {
+			err = ss.advance1()
+		} else {
+			err = ss.advance2()
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+func (ss *SetOpScan) GetInt(fieldName string) (int32, error) {
+	val, err := ss.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (ss *SetOpScan) GetString(fieldName string) (string, error) {
+	val, err := ss.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (ss *SetOpScan) GetVal(fieldName string) (*Constant, error) {
+	i := slices.Index(ss.fields1, fieldName)
+	if i < 0 || ss.current == nil {
+		return nil, ErrFieldNotFound
+	}
+	vals, err := ss.current.AsTuple()
+	if err != nil {
+		return nil, err
+	}
+	return vals[i], nil
+}
+
+func (ss *SetOpScan) HasField(fieldName string) bool {
+	return slices.Contains(ss.fields1, fieldName)
+}
+
+func (ss *SetOpScan) Close() {
+	ss.s1.Close()
+	ss.s2.Close()
+}
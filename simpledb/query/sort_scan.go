@@ -54,6 +54,7 @@ func NewSortScan(runs []*TempTable, comp *RecordComparator) (*SortScan, error) {
 
 func (ss *SortScan) BeforeFirst() error {
 	var err error
+	ss.currentScan = nil
 	if err = ss.s1.BeforeFirst(); err != nil {
 		return fmt.Errorf("ss.s1.BeforeFirst: %w", err)
 	}
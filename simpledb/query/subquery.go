@@ -0,0 +1,192 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSubqueryNotBound = errors.New("subquery is not planned")
+
+var ErrMultipleRows = errors.New("subquery returned more than one row")
+
+// Subquery 式や述語の中の副問合せ
+// Query は構文解析した問合せで、plan パッケージが計画を作成して Bind で設定するまでは評価できない
+type Subquery struct {
+	Query fmt.Stringer
+	plan  SubqueryPlan
+
+	// 相関のない副問合せの結果は、文の実行中は変わらないものとして一度だけ求める
+	cached bool
+	exists bool
+	scalar *Constant
+	values *ValueSet
+}
+
+// SubqueryPlan 副問合せの計画
+type SubqueryPlan interface {
+	// Open 外側の問合せの現在のレコード outer に対して副問合せを実行する
+	Open(outer Scan) (Scan, error)
+	// Field 副問合せが出力する列
+	Field() string
+	// OuterFields 副問合せが参照する外側の問合せの列。空であれば相関のない副問合せ
+	OuterFields() []string
+}
+
+func NewSubquery(q fmt.Stringer) *Subquery {
+	return &Subquery{Query: q}
+}
+
+// Bind 副問合せの計画を設定する
+func (sq *Subquery) Bind(p SubqueryPlan) {
+	sq.plan = p
+	sq.cached = false
+	sq.scalar = nil
+	sq.values = nil
+}
+
+// Plan Bind で設定した計画。設定されていなければ nil
+func (sq *Subquery) Plan() SubqueryPlan {
+	return sq.plan
+}
+
+// OuterFields 副問合せが参照する外側の問合せの列
+func (sq *Subquery) OuterFields() []string {
+	if sq.plan == nil {
+		return nil
+	}
+	return sq.plan.OuterFields()
+}
+
+func (sq *Subquery) String() string {
+	return fmt.Sprintf("(%s)", sq.Query)
+}
+
+func (sq *Subquery) correlated() bool {
+	return len(sq.OuterFields()) > 0
+}
+
+// evaluate 副問合せを実行し、出力する列の値を全て返す。stop が true を返すと打ち切る
+func (sq *Subquery) evaluate(outer Scan, stop func(*Constant) (bool, error)) error {
+	if sq.plan == nil {
+		return fmt.Errorf("%w: %s", ErrSubqueryNotBound, sq)
+	}
+	s, err := sq.plan.Open(outer)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for {
+		next, err := s.Next()
+		if err != nil {
+			return err
+		}
+		if !next {
+			return nil
+		}
+		val, err := s.GetVal(sq.plan.Field())
+		if err != nil {
+			return err
+		}
+		if done, err := stop(val); err != nil || done {
+			return err
+		}
+	}
+}
+
+// Exists 副問合せが1つ以上のレコードを返すか
+func (sq *Subquery) Exists(outer Scan) (bool, error) {
+	if sq.cached {
+		return sq.exists, nil
+	}
+	exists := false
+	err := sq.evaluate(outer, func(*Constant) (bool, error) {
+		exists = true
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if !sq.correlated() {
+		sq.cached, sq.exists = true, exists
+	}
+	return exists, nil
+}
+
+// Contains 副問合せが val を返すか。NULL はどの値とも一致しない
+func (sq *Subquery) Contains(outer Scan, val *Constant) (bool, error) {
+	if val.IsNull() {
+		return false, nil
+	}
+	if !sq.correlated() {
+		if sq.values == nil {
+			values := NewValueSet()
+			err := sq.evaluate(outer, func(v *Constant) (bool, error) {
+				values.Add(v)
+				return false, nil
+			})
+			if err != nil {
+				return false, err
+			}
+			sq.values = values
+		}
+		return sq.values.Contains(val), nil
+	}
+
+	found := false
+	err := sq.evaluate(outer, func(v *Constant) (bool, error) {
+		found = !v.IsNull() && v.Equals(val)
+		return found, nil
+	})
+	return found, err
+}
+
+// Scalar 副問合せが返す唯一の値。レコードを返さなければ NULL、2つ以上返せばエラー
+func (sq *Subquery) Scalar(outer Scan) (*Constant, error) {
+	if sq.cached {
+		return sq.scalar, nil
+	}
+	result := NewNullConstant()
+	n := 0
+	err := sq.evaluate(outer, func(v *Constant) (bool, error) {
+		n++
+		if n > 1 {
+			return true, fmt.Errorf("%w: %s", ErrMultipleRows, sq)
+		}
+		result = v
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !sq.correlated() {
+		sq.cached, sq.scalar = true, result
+	}
+	return result, nil
+}
+
+// ValueSet 値の集合。値は HashCode で振り分け、Equals で比較する
+type ValueSet struct {
+	buckets map[int32][]*Constant
+}
+
+func NewValueSet() *ValueSet {
+	return &ValueSet{buckets: make(map[int32][]*Constant)}
+}
+
+// Add 集合に val を加える。NULL はどの値とも一致しないので加えない
+func (vs *ValueSet) Add(val *Constant) {
+	if val.HasNull() || vs.Contains(val) {
+		return
+	}
+	h := val.HashCode()
+	vs.buckets[h] = append(vs.buckets[h], val)
+}
+
+func (vs *ValueSet) Contains(val *Constant) bool {
+	for _, v := range vs.buckets[val.HashCode()] {
+		if v.Equals(val) {
+			return true
+		}
+	}
+	return false
+}
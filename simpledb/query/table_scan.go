@@ -22,13 +22,24 @@ type TableScan struct {
 	filename    string
 	currentSlot int32
 	TotalBlkNum int32
+
+	// fwd, fwdSlot スロット形式で、現在のレコードを別のブロックに移していれば、移した先のページとスロット
+	fwd     *record.RecordPage
+	fwdSlot int32
+	// fsm 表の空き領域マップ。一時表では nil
+	fsm *record.FreeSpaceMap
 }
 
 func NewTableScan(tx *tx.Transaction, tableName string, layout *record.Layout) (*TableScan, error) {
+	return newTableScan(tx, tableName, layout, record.NewFreeSpaceMap(tx, tableName))
+}
+
+// newTableScan 空き領域マップ fsm を使うテーブルスキャン。fsm が nil なら、挿入する時は後ろのブロックだけを探す
+func newTableScan(tx *tx.Transaction, tableName string, layout *record.Layout, fsm *record.FreeSpaceMap) (*TableScan, error) {
 	logger := logger.New("query.TableScan", logger.Info)
 
 	filename := tableName + ".tbl"
-	tableScan := &TableScan{logger, tx, layout, nil, filename, -1, 0}
+	tableScan := &TableScan{logger: logger, tx: tx, layout: layout, filename: filename, currentSlot: -1, fsm: fsm}
 
 	logger.Debugf("(%q) NewTableScan(): tx.Size(%q)", filename, tableScan.filename)
 	size, err := tx.Size(tableScan.filename)
@@ -67,6 +78,9 @@ func (ts *TableScan) Next() (bool, error) {
 			return false, err
 		}
 		if ts.currentSlot >= 0 {
+			if err := ts.follow(); err != nil {
+				return false, err
+			}
 			break
 		}
 		atLastBlock, err := ts.AtLastBlock()
@@ -84,14 +98,22 @@ func (ts *TableScan) Next() (bool, error) {
 }
 
 func (ts *TableScan) GetInt(fieldName string) (int32, error) {
-	return ts.rp.GetInt(ts.currentSlot, fieldName)
+	rp, slot := ts.target()
+	return rp.GetInt(slot, fieldName)
 }
 
 func (ts *TableScan) GetString(fieldName string) (string, error) {
-	return ts.rp.GetString(ts.currentSlot, fieldName)
+	rp, slot := ts.target()
+	return rp.GetString(slot, fieldName)
 }
 
 func (ts *TableScan) GetVal(fieldName string) (*Constant, error) {
+	rp, slot := ts.target()
+	if null, err := rp.IsNull(slot, fieldName); err != nil {
+		return nil, err
+	} else if null {
+		return NewNullConstant(), nil
+	}
 	switch ts.layout.Schema().Type(fieldName) {
 	case record.INT:
 		val, err := ts.GetInt(fieldName)
@@ -115,6 +137,7 @@ func (ts *TableScan) HasField(fieldName string) bool {
 }
 
 func (ts *TableScan) Close() {
+	ts.closeForward()
 	if ts.rp != nil {
 		ts.logger.Debugf("(%q) Close(): Unpin(%+v)", ts.filename, ts.rp.Block())
 		ts.tx.Unpin(ts.rp.Block())
@@ -122,14 +145,29 @@ func (ts *TableScan) Close() {
 }
 
 func (ts *TableScan) SetInt(fieldName string, val int32) error {
-	return ts.rp.SetInt(ts.currentSlot, fieldName, val)
+	rp, slot := ts.target()
+	return rp.SetInt(slot, fieldName, val)
 }
 
+// SetString スロット形式で大きな文字列は、オーバーフローファイルに格納する
+// レコードが今のブロックに収まらなくなれば、空きのある別のブロックに移す
 func (ts *TableScan) SetString(fieldName string, val string) error {
-	return ts.rp.SetString(ts.currentSlot, fieldName, val)
+	rp, slot := ts.target()
+	if rp.NeedsOverflow(val) {
+		return rp.SetOverflowString(slot, fieldName, val)
+	}
+	err := rp.SetString(slot, fieldName, val)
+	if errors.Is(err, record.ErrPageFull) {
+		return ts.moveRecord(fieldName, val)
+	}
+	return err
 }
 
 func (ts *TableScan) SetVal(fieldName string, val *Constant) error {
+	if val.IsNull() {
+		rp, slot := ts.target()
+		return rp.SetNull(slot, fieldName)
+	}
 	switch ts.layout.Schema().Type(fieldName) {
 	case record.INT:
 		ival, err := val.AsInt()
@@ -162,42 +200,116 @@ func (ts *TableScan) CanInsertCurrentBlock() (bool, error) {
 	return newSlot >= 0, nil
 }
 
+// Insert 新しいレコードを挿入する。今のブロックに空きがなければ、空き領域マップで空きのあるブロックを探す
+// どのブロックにも空きがなければ、新しいブロックを追加する
 func (ts *TableScan) Insert() error {
-	nextSlot, err := ts.rp.InsertAfter(ts.currentSlot)
-	if err != nil {
-		return err
+	ts.closeForward()
+	// レコードの上になければ、空きがないと記録された今のブロックは試さず、他のトランザクションが削除しているブロックのロックを待たない
+	skip := false
+	if ts.currentSlot < 0 && ts.fsm != nil {
+		var err error
+		if skip, err = ts.fsm.IsFull(ts.rp.Block().Number); err != nil {
+			return err
+		}
+	}
+	nextSlot := int32(-1)
+	if !skip {
+		var err error
+		nextSlot, err = ts.rp.InsertAfter(ts.currentSlot)
+		if err == nil && nextSlot < 0 && ts.currentSlot >= 0 {
+			// 今のスロットより前の空いているスロットも探す
+			nextSlot, err = ts.rp.InsertAfter(-1)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	ts.logger.Tracef("(%q) Insert(): currentSlot=%d, nextSlot=%d", ts.filename, ts.currentSlot, nextSlot)
 	ts.currentSlot = nextSlot
+	// 一度試したブロックをもう一度返されたら、新しいブロックを追加する
+	tried := map[int32]bool{ts.rp.Block().Number: !skip}
 	for ts.currentSlot < 0 {
-		ts.logger.Debugf("(%q) Insert(): nextSlot=%d", ts.filename, nextSlot)
-		atLastBlock, err := ts.AtLastBlock()
+		blockNum, err := ts.freeBlock()
 		if err != nil {
 			return err
 		}
-		if atLastBlock {
-			ts.logger.Debugf("(%q) Insert(): atLastBlock=true, moveToNewBlock()", ts.filename)
+		if blockNum < 0 || tried[blockNum] {
+			ts.logger.Debugf("(%q) Insert(): no free block, moveToNewBlock()", ts.filename)
 			if err := ts.moveToNewBlock(); err != nil {
 				return err
 			}
-		} else {
-			ts.logger.Debugf("(%q) Insert(): atLastBlock=false, moveToBlock(%d)", ts.filename, ts.rp.Block().Number+1)
-			if err := ts.moveToBlock(ts.rp.Block().Number + 1); err != nil {
+			// 空のブロックにも収まらなければ、ブロックを追加し続けてしまう
+			if ts.currentSlot, err = ts.rp.InsertAfter(-1); err != nil {
 				return err
+			} else if ts.currentSlot < 0 {
+				return record.ErrRecordTooLarge
 			}
+			return nil
 		}
 
-		nextSlot, err = ts.rp.InsertAfter(ts.currentSlot)
-		if err != nil {
+		ts.logger.Debugf("(%q) Insert(): moveToBlock(%d)", ts.filename, blockNum)
+		tried[blockNum] = true
+		if err := ts.moveToBlock(blockNum); err != nil {
+			return err
+		}
+		if ts.currentSlot, err = ts.rp.InsertAfter(-1); err != nil {
 			return err
 		}
-		ts.currentSlot = nextSlot
 	}
 	return nil
 }
 
+// freeBlock 今のブロックに空きがない時に、次に挿入を試すブロック。なければ -1 を返す
+func (ts *TableScan) freeBlock() (int32, error) {
+	size, err := ts.tx.Size(ts.filename)
+	if err != nil {
+		return 0, err
+	}
+	// 一時表はレコードを削除しないので、後ろのブロックだけを探す
+	if ts.fsm == nil {
+		if next := ts.rp.Block().Number + 1; next < size {
+			return next, nil
+		}
+		return -1, nil
+	}
+	if err := ts.fsm.SetFull(ts.rp.Block().Number, true); err != nil {
+		return 0, err
+	}
+	return ts.fsm.FindFree(0, size)
+}
+
+// findFree start 以上 end 未満で、空き領域マップに空きがないと記録されていない最初のブロック。なければ -1 を返す
+func (ts *TableScan) findFree(start int32, end int32) (int32, error) {
+	if ts.fsm == nil {
+		if start < end {
+			return start, nil
+		}
+		return -1, nil
+	}
+	return ts.fsm.FindFree(start, end)
+}
+
+// markFree ブロック blockNum に空きができたことを、コミットした時に空き領域マップに記録する
+func (ts *TableScan) markFree(blockNum int32) {
+	if ts.fsm != nil {
+		ts.fsm.SetFreeOnCommit(blockNum)
+	}
+}
+
+// Delete 現在のレコードを削除する。別のブロックに移したレコードは、移した先も削除する
+// 空きのできたブロックは、空き領域マップにも記録する
 func (ts *TableScan) Delete() error {
-	return ts.rp.Delete(ts.currentSlot)
+	if ts.fwd != nil {
+		if err := ts.fwd.Delete(ts.fwdSlot); err != nil {
+			return err
+		}
+		ts.markFree(ts.fwd.Block().Number)
+	}
+	if err := ts.rp.Delete(ts.currentSlot); err != nil {
+		return err
+	}
+	ts.markFree(ts.rp.Block().Number)
+	return nil
 }
 
 func (ts *TableScan) MoveToRID(rid *record.RID) (err error) {
@@ -209,9 +321,125 @@ func (ts *TableScan) MoveToRID(rid *record.RID) (err error) {
 	}
 	ts.currentSlot = rid.Slot()
 
+	return ts.follow()
+}
+
+// target 現在のレコードを格納しているページとスロット。別のブロックに移したレコードでは移した先
+func (ts *TableScan) target() (*record.RecordPage, int32) {
+	if ts.fwd != nil {
+		return ts.fwd, ts.fwdSlot
+	}
+	return ts.rp, ts.currentSlot
+}
+
+// follow 現在のスロットのレコードを別のブロックに移していれば、移した先のページを開く
+func (ts *TableScan) follow() (err error) {
+	ts.closeForward()
+	rid, err := ts.rp.Forward(ts.currentSlot)
+	if err != nil || rid == nil {
+		return err
+	}
+	ts.fwd, err = record.NewRecordPage(ts.tx, file.NewBlockID(ts.filename, rid.BlockNumber()), ts.layout)
+	if err != nil {
+		return err
+	}
+	ts.fwdSlot = rid.Slot()
 	return nil
 }
 
+func (ts *TableScan) closeForward() {
+	if ts.fwd != nil {
+		ts.tx.Unpin(ts.fwd.Block())
+		ts.fwd = nil
+	}
+}
+
+// moveRecord スロット形式で、列 fieldName を val にすると今のブロックに収まらないレコードを、空きのある別のブロックに移す
+// 索引などが参照している RID が変わらないよう、元のスロットに移した先の RID を残す
+func (ts *TableScan) moveRecord(fieldName string, val string) error {
+	rp, slot := ts.target()
+	image, err := rp.RecordImage(slot, fieldName, val)
+	if err != nil {
+		return err
+	}
+	dest, destSlot, err := ts.insertImage(image, rp.Block().Number)
+	if err != nil {
+		return err
+	}
+	ts.logger.Debugf("(%q) moveRecord(): [%d, %d] -> [%d, %d]", ts.filename, rp.Block().Number, slot, dest.Block().Number, destSlot)
+
+	// 他の列のオーバーフローファイルの文字列は移した先のレコードが引き継ぎ、列 fieldName の元の文字列だけを解放する
+	if err := rp.FreeOverflow(slot, fieldName); err != nil {
+		ts.tx.Unpin(dest.Block())
+		return err
+	}
+	if ts.fwd != nil {
+		if err := ts.fwd.Vacate(ts.fwdSlot); err != nil {
+			ts.tx.Unpin(dest.Block())
+			return err
+		}
+		ts.closeForward()
+	}
+	ts.fwd, ts.fwdSlot = dest, destSlot
+	return ts.rp.SetForward(ts.currentSlot, record.NewRID(dest.Block().Number, destSlot))
+}
+
+// insertImage ブロック exclude 以外で image を挿入できるブロックを探して挿入し、そのページとスロットを返す
+// image は新しいレコードより大きいかもしれないので、収まらなくても空き領域マップは変えない
+// どのブロックにも収まらなければ、新しいブロックを追加する。返すページは pin されている
+func (ts *TableScan) insertImage(image []byte, exclude int32) (*record.RecordPage, int32, error) {
+	size, err := ts.tx.Size(ts.filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	for blockNum := int32(0); blockNum < size; blockNum++ {
+		// 空きがないと記録されたブロックは読み飛ばす
+		if blockNum, err = ts.findFree(blockNum, size); err != nil {
+			return nil, 0, err
+		} else if blockNum < 0 {
+			break
+		}
+		if blockNum == exclude {
+			continue
+		}
+		rp, err := record.NewRecordPage(ts.tx, file.NewBlockID(ts.filename, blockNum), ts.layout)
+		if err != nil {
+			return nil, 0, err
+		}
+		slot, err := rp.InsertImage(image, record.Moved)
+		if err == nil && slot >= 0 {
+			return rp, slot, nil
+		}
+		ts.tx.Unpin(rp.Block())
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	blk, err := ts.tx.Append(ts.filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	rp, err := record.NewRecordPage(ts.tx, blk, ts.layout)
+	if err != nil {
+		return nil, 0, err
+	}
+	ts.TotalBlkNum++
+	if err := rp.Format(); err != nil {
+		ts.tx.Unpin(rp.Block())
+		return nil, 0, err
+	}
+	slot, err := rp.InsertImage(image, record.Moved)
+	if err == nil && slot < 0 {
+		err = record.ErrRecordTooLarge
+	}
+	if err != nil {
+		ts.tx.Unpin(rp.Block())
+		return nil, 0, err
+	}
+	return rp, slot, nil
+}
+
 func (ts *TableScan) moveToBlock(blockNum int32) (err error) {
 	ts.Close()
 	block := file.NewBlockID(ts.filename, blockNum)
@@ -7,7 +7,11 @@ import (
 	"simpledb/query"
 	"simpledb/record"
 	"simpledb/server"
+	"simpledb/tx"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTableScan(t *testing.T) {
@@ -119,3 +123,674 @@ func TestTableScan(t *testing.T) {
 		t.Fatalf("failed to commit: %v", err)
 	}
 }
+
+func TestSlottedTableScan(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "slottedtabletest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 300)
+	layout := record.NewLayoutFromSchemaWithFormat(schema, record.SlottedFormat)
+
+	// scanAll 全てのレコードの A の値ごとの B の値
+	scanAll := func(tableScan *query.TableScan) map[int32]string {
+		t.Helper()
+		if err := tableScan.BeforeFirst(); err != nil {
+			t.Fatalf("failed to before first: %v", err)
+		}
+		result := make(map[int32]string)
+		for {
+			next, err := tableScan.Next()
+			if err != nil {
+				t.Fatalf("failed to get next: %v", err)
+			}
+			if !next {
+				return result
+			}
+			a, err := tableScan.GetInt("A")
+			if err != nil {
+				t.Fatalf("failed to get int: %v", err)
+			}
+			b, err := tableScan.GetString("B")
+			if err != nil {
+				t.Fatalf("failed to get string: %v", err)
+			}
+			result[a] = b
+		}
+	}
+
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err := query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	want := make(map[int32]string)
+	rids := make(map[int32]*record.RID)
+	for i := int32(0); i < 30; i++ {
+		if err := tableScan.Insert(); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		if err := tableScan.SetInt("A", i); err != nil {
+			t.Fatalf("failed to set int: %v", err)
+		}
+		want[i] = fmt.Sprintf("rec%d", i)
+		if err := tableScan.SetString("B", want[i]); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+		if rids[i], err = tableScan.GetRID(); err != nil {
+			t.Fatalf("failed to get rid: %v", err)
+		}
+	}
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// 伸ばしたレコードは別のブロックに移るが、RID は変わらない
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err = query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	long := strings.Repeat("x", 150)
+	for _, i := range []int32{0, 1, 2} {
+		if err := tableScan.MoveToRID(rids[i]); err != nil {
+			t.Fatalf("failed to move to rid: %v", err)
+		}
+		if err := tableScan.SetString("B", long); err != nil {
+			t.Fatalf("failed to set long string: %v", err)
+		}
+	}
+	for _, i := range []int32{0, 1, 2} {
+		if err := tableScan.MoveToRID(rids[i]); err != nil {
+			t.Fatalf("failed to move to rid: %v", err)
+		}
+		if b, err := tableScan.GetString("B"); err != nil || b != long {
+			t.Errorf("record %d: %q, %v", i, b, err)
+		}
+	}
+	got := scanAll(tableScan)
+	if len(got) != len(want) {
+		t.Errorf("%d records after update, want %d", len(got), len(want))
+	}
+	tableScan.Close()
+
+	// ロールバックすると元の値に戻る
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err = query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	got = scanAll(tableScan)
+	if len(got) != len(want) {
+		t.Errorf("%d records after rollback, want %d", len(got), len(want))
+	}
+	for a, b := range want {
+		if got[a] != b {
+			t.Errorf("record %d: %q, want %q", a, got[a], b)
+		}
+	}
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestTableScanFreeSpaceMap(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "fsmtest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err := query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	insert := func(a int32) *record.RID {
+		t.Helper()
+		if err := tableScan.Insert(); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		if err := tableScan.SetInt("A", a); err != nil {
+			t.Fatalf("failed to set int: %v", err)
+		}
+		if err := tableScan.SetString("B", fmt.Sprintf("rec%d", a)); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+		rid, err := tableScan.GetRID()
+		if err != nil {
+			t.Fatalf("failed to get rid: %v", err)
+		}
+		return rid
+	}
+	rids := make([]*record.RID, 0)
+	for i := int32(0); i < 100; i++ {
+		rids = append(rids, insert(i))
+	}
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	size, err := transaction.Size("T.tbl")
+	if err != nil {
+		t.Fatalf("failed to get size: %v", err)
+	}
+	fsm := record.NewFreeSpaceMap(transaction, "T")
+	isFull := func(blockNum int32) bool {
+		t.Helper()
+		full, err := fsm.IsFull(blockNum)
+		if err != nil {
+			t.Fatalf("failed to read free space map: %v", err)
+		}
+		return full
+	}
+	for blockNum := int32(0); blockNum < size-1; blockNum++ {
+		if !isFull(blockNum) {
+			t.Fatalf("block %d should be recorded as full", blockNum)
+		}
+	}
+
+	// 削除して空いたスロットに、ファイルを伸ばさずに挿入する
+	tableScan, err = query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	hole := rids[20]
+	if err := tableScan.MoveToRID(hole); err != nil {
+		t.Fatalf("failed to move to rid: %v", err)
+	}
+	if err := tableScan.Delete(); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	// 削除した空きはコミットするまで他のトランザクションには見せないが、同じ表スキャンの挿入では使う
+	if !isFull(hole.BlockNumber()) {
+		t.Fatalf("block %d should be recorded as full until commit", hole.BlockNumber())
+	}
+	if err := tableScan.MoveToRID(rids[len(rids)-1]); err != nil {
+		t.Fatalf("failed to move to rid: %v", err)
+	}
+	// 最後のブロックが埋まるまでは最後のブロックに入れる
+	for {
+		rid := insert(1000)
+		if rid.BlockNumber() == hole.BlockNumber() {
+			if !rid.Equals(hole) {
+				t.Fatalf("expected the record at %s, got %s", hole, rid)
+			}
+			break
+		}
+		if rid.BlockNumber() != size-1 {
+			t.Fatalf("expected the record in block %d or %d, got %s", hole.BlockNumber(), size-1, rid)
+		}
+	}
+	newSize, err := transaction.Size("T.tbl")
+	if err != nil {
+		t.Fatalf("failed to get size: %v", err)
+	}
+	if newSize != size {
+		t.Fatalf("expected %d blocks, got %d", size, newSize)
+	}
+	tableScan.Close()
+
+	// ロールバックすると空き領域マップも元に戻る
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	fsm = record.NewFreeSpaceMap(transaction, "T")
+	if !isFull(hole.BlockNumber()) || isFull(size-1) {
+		t.Fatalf("free space map is not restored after rollback")
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestTableScanFreeSpaceMapRefill(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "fsmrefill"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err := query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	insert := func(a int32) (*record.RID, error) {
+		if err := tableScan.Insert(); err != nil {
+			return nil, err
+		}
+		if err := tableScan.SetInt("A", a); err != nil {
+			return nil, err
+		}
+		return tableScan.GetRID()
+	}
+	rids := make([]*record.RID, 0)
+	for i := int32(0); i < 100; i++ {
+		rid, err := insert(i)
+		if err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		rids = append(rids, rid)
+	}
+
+	// 埋まったブロックから削除し、空いたスロットを埋めた後にもう一度挿入すると、そのブロックには戻らない
+	hole := rids[0]
+	if err := tableScan.MoveToRID(hole); err != nil {
+		t.Fatalf("failed to move to rid: %v", err)
+	}
+	if err := tableScan.Delete(); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	done := make(chan error, 1)
+	var refilled, next *record.RID
+	go func() {
+		var err error
+		if refilled, err = insert(1000); err == nil {
+			next, err = insert(1001)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("insert did not finish after refilling block %d", hole.BlockNumber())
+	}
+	if !refilled.Equals(hole) {
+		t.Fatalf("expected the record at %s, got %s", hole, refilled)
+	}
+	if next.BlockNumber() == hole.BlockNumber() {
+		t.Fatalf("expected the record outside block %d, got %s", hole.BlockNumber(), next)
+	}
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// 空きを使い切ったブロックは、コミットしても空きがないまま
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	full, err := record.NewFreeSpaceMap(transaction, "T").IsFull(hole.BlockNumber())
+	if err != nil {
+		t.Fatalf("failed to read free space map: %v", err)
+	}
+	if !full {
+		t.Fatalf("block %d should be recorded as full after commit", hole.BlockNumber())
+	}
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestTableScanFreeSpaceMapConcurrency(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "fsmconctest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	layout := record.NewLayoutFromSchema(schema)
+	// newTx ロックを待つとすぐに失敗するトランザクション
+	newTx := func() *tx.Transaction {
+		t.Helper()
+		transaction, err := tx.NewWithLockTimeout(simpleDB.FileManager(), simpleDB.LogManager(), simpleDB.BufferManager(), 500*time.Millisecond)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %v", err)
+		}
+		return transaction
+	}
+	insert := func(tableScan *query.TableScan, a int32) *record.RID {
+		t.Helper()
+		if err := tableScan.Insert(); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		if err := tableScan.SetInt("A", a); err != nil {
+			t.Fatalf("failed to set int: %v", err)
+		}
+		rid, err := tableScan.GetRID()
+		if err != nil {
+			t.Fatalf("failed to get rid: %v", err)
+		}
+		return rid
+	}
+	newTableScan := func(transaction *tx.Transaction) *query.TableScan {
+		t.Helper()
+		tableScan, err := query.NewTableScan(transaction, "fsmconc", layout)
+		if err != nil {
+			t.Fatalf("failed to create table scan: %v", err)
+		}
+		return tableScan
+	}
+
+	// 3 ブロック以上の表を作り、2 番目と最後のブロックに 1 つずつ空きを作る
+	transaction := newTx()
+	tableScan := newTableScan(transaction)
+	var rids []*record.RID
+	for i := range int32(150) {
+		rids = append(rids, insert(tableScan, i))
+	}
+	size, err := transaction.Size("fsmconc.tbl")
+	if err != nil {
+		t.Fatalf("failed to get size: %v", err)
+	}
+	if size < 3 {
+		t.Fatalf("expected at least 3 blocks, got %d", size)
+	}
+	for _, blockNum := range []int32{1, size - 1} {
+		i := slices.IndexFunc(rids, func(rid *record.RID) bool { return rid.BlockNumber() == blockNum })
+		if err := tableScan.MoveToRID(rids[i]); err != nil {
+			t.Fatalf("failed to move to rid: %v", err)
+		}
+		if err := tableScan.Delete(); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+	}
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// 削除したトランザクションがコミットするまで、他のトランザクションの挿入は削除したブロックのロックを待たずに、
+	// 空きのある他のブロックに入れ、空き領域マップも書き換える
+	first := rids[0]
+	deleter := newTx()
+	deleteScan := newTableScan(deleter)
+	if err := deleteScan.MoveToRID(first); err != nil {
+		t.Fatalf("failed to move to rid: %v", err)
+	}
+	if err := deleteScan.Delete(); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	inserter := newTx()
+	insertScan := newTableScan(inserter)
+	if rid := insert(insertScan, 1000); rid.BlockNumber() != 1 {
+		t.Fatalf("expected the record in block 1, got %s", rid)
+	}
+	if rid := insert(insertScan, 1001); rid.BlockNumber() != size-1 {
+		t.Fatalf("expected the record in block %d, got %s", size-1, rid)
+	}
+	insertScan.Close()
+	if err := inserter.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	deleteScan.Close()
+	if err := deleter.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// コミットした後は、削除した空きに挿入する
+	transaction = newTx()
+	fsm := record.NewFreeSpaceMap(transaction, "fsmconc")
+	for blockNum, want := range map[int32]bool{0: false, 1: true} {
+		full, err := fsm.IsFull(blockNum)
+		if err != nil {
+			t.Fatalf("failed to read free space map: %v", err)
+		}
+		if full != want {
+			t.Fatalf("block %d: full = %v, want %v", blockNum, full, want)
+		}
+	}
+	tableScan = newTableScan(transaction)
+	if rid := insert(tableScan, 2000); !rid.Equals(first) {
+		t.Fatalf("expected the record at %s, got %s", first, rid)
+	}
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestTableScanOverflow(t *testing.T) {
+	t.Parallel()
+	simpleDB, err := server.NewSimpleDB(path.Join(t.TempDir(), "overflowtest"), 400, 8)
+	if err != nil {
+		t.Fatalf("failed to create simpledb: %v", err)
+	}
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 1000)
+	schema.AddStringField("C", 50)
+	layout := record.NewLayoutFromSchemaWithFormat(schema, record.SlottedFormat)
+	big := func(i int32) string {
+		return strings.Repeat(string(rune('a'+i%26)), 500+int(i))
+	}
+
+	// check 全てのレコードの B と C が want と一致するか調べる
+	check := func(tableScan *query.TableScan, want map[int32][2]string) {
+		t.Helper()
+		if err := tableScan.BeforeFirst(); err != nil {
+			t.Fatalf("failed to before first: %v", err)
+		}
+		n := 0
+		for {
+			next, err := tableScan.Next()
+			if err != nil {
+				t.Fatalf("failed to get next: %v", err)
+			}
+			if !next {
+				break
+			}
+			n++
+			a, err := tableScan.GetInt("A")
+			if err != nil {
+				t.Fatalf("failed to get int: %v", err)
+			}
+			b, err := tableScan.GetString("B")
+			if err != nil {
+				t.Fatalf("failed to get string: %v", err)
+			}
+			c, err := tableScan.GetString("C")
+			if err != nil {
+				t.Fatalf("failed to get string: %v", err)
+			}
+			if w := want[a]; b != w[0] || c != w[1] {
+				t.Errorf("record %d: B has %d bytes, C = %q, want %d bytes and %q", a, len(b), c, len(w[0]), w[1])
+			}
+		}
+		if n != len(want) {
+			t.Errorf("%d records, want %d", n, len(want))
+		}
+	}
+	// find A の値が a のレコードに移動する
+	find := func(tableScan *query.TableScan, a int32) {
+		t.Helper()
+		if err := tableScan.BeforeFirst(); err != nil {
+			t.Fatalf("failed to before first: %v", err)
+		}
+		for {
+			next, err := tableScan.Next()
+			if err != nil || !next {
+				t.Fatalf("record %d not found: %v", a, err)
+			}
+			if v, err := tableScan.GetInt("A"); err != nil {
+				t.Fatalf("failed to get int: %v", err)
+			} else if v == a {
+				return
+			}
+		}
+	}
+	ovfSize := func(transaction *tx.Transaction) int32 {
+		t.Helper()
+		size, err := transaction.Size(record.OverflowFile("T"))
+		if err != nil {
+			t.Fatalf("failed to get size: %v", err)
+		}
+		return size
+	}
+
+	transaction, err := simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err := query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	want := make(map[int32][2]string)
+	for i := int32(0); i < 10; i++ {
+		if err := tableScan.Insert(); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		if err := tableScan.SetInt("A", i); err != nil {
+			t.Fatalf("failed to set int: %v", err)
+		}
+		if err := tableScan.SetString("B", big(i)); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+		if err := tableScan.SetString("C", fmt.Sprintf("c%d", i)); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+		want[i] = [2]string{big(i), fmt.Sprintf("c%d", i)}
+	}
+	// 大きな文字列はオーバーフローファイルに格納するので、レコードは1ブロックに収まる
+	if size, err := transaction.Size("T.tbl"); err != nil || size != 1 {
+		t.Errorf("T.tbl has %d blocks, want 1 (%v)", size, err)
+	}
+	check(tableScan, want)
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// 削除したレコードのブロックは、次に格納する文字列に使う
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	size := ovfSize(transaction)
+	tableScan, err = query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	for i := int32(0); i < 5; i++ {
+		find(tableScan, i)
+		if err := tableScan.Delete(); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+		delete(want, i)
+	}
+	for i := int32(10); i < 15; i++ {
+		if err := tableScan.Insert(); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		if err := tableScan.SetInt("A", i); err != nil {
+			t.Fatalf("failed to set int: %v", err)
+		}
+		if err := tableScan.SetString("B", big(i-10)); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+		want[i] = [2]string{big(i - 10), ""}
+	}
+	// 大きな文字列を小さな文字列にして、また大きな文字列に戻しても、ブロックは増えない
+	find(tableScan, 5)
+	if err := tableScan.SetString("B", "short"); err != nil {
+		t.Fatalf("failed to set string: %v", err)
+	}
+	if b, err := tableScan.GetString("B"); err != nil || b != "short" {
+		t.Errorf("B = %q, %v", b, err)
+	}
+	if err := tableScan.SetString("B", big(5)); err != nil {
+		t.Fatalf("failed to set string: %v", err)
+	}
+	if got := ovfSize(transaction); got != size {
+		t.Errorf("%s has %d blocks, want %d", record.OverflowFile("T"), got, size)
+	}
+	// 他の列を伸ばして別のブロックに移しても、大きな文字列は引き継ぐ
+	for a := range want {
+		find(tableScan, a)
+		c := strings.Repeat("z", 40)
+		if err := tableScan.SetString("C", c); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+		want[a] = [2]string{want[a][0], c}
+	}
+	check(tableScan, want)
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// ロールバックすると大きな文字列も元に戻る
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err = query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	for a := range want {
+		find(tableScan, a)
+		if err := tableScan.SetString("B", big(a+3)); err != nil {
+			t.Fatalf("failed to set string: %v", err)
+		}
+	}
+	find(tableScan, 7)
+	if err := tableScan.Delete(); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	tableScan.Close()
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	transaction, err = simpleDB.NewTx()
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	tableScan, err = query.NewTableScan(transaction, "T", layout)
+	if err != nil {
+		t.Fatalf("failed to create table scan: %v", err)
+	}
+	check(tableScan, want)
+	tableScan.Close()
+	if err := transaction.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
@@ -18,7 +18,11 @@ type TempTable struct {
 }
 
 func NewTempTable(tx *tx.Transaction, sch *record.Schema) *TempTable {
-	layout := record.NewLayoutFromSchema(sch)
+	layout := record.NewLayoutFromSchemaWithEncoding(sch, record.FixedFormat, tx.Encoding())
+	// 固定長のレコードが1ブロックに収まらなければ、スロット形式にする
+	if layout.SlotSize() > tx.BlockSize() {
+		layout = record.NewLayoutFromSchemaWithEncoding(sch, record.SlottedFormat, tx.Encoding())
+	}
 
 	return &TempTable{
 		tx:        tx,
@@ -28,7 +32,8 @@ func NewTempTable(tx *tx.Transaction, sch *record.Schema) *TempTable {
 }
 
 func (tt *TempTable) Open() (*TableScan, error) {
-	scan, err := NewTableScan(tt.tx, tt.TableName, tt.layout)
+	// 一時表のレコードは削除しないので、空き領域マップは使わない
+	scan, err := newTableScan(tt.tx, tt.TableName, tt.layout, nil)
 	if err != nil {
 		return nil, fmt.Errorf("tt.Open: %w", err)
 	}
@@ -6,16 +6,84 @@ import (
 	"simpledb/record"
 )
 
+// TermOp 項の種類
+type TermOp int
+
+const (
+	// OpEquals lhs = rhs
+	OpEquals TermOp = iota
+	// OpIn lhs IN (副問合せ)
+	OpIn
+	// OpExists EXISTS (副問合せ)。lhs は nil
+	OpExists
+)
+
 type Term struct {
+	op  TermOp
 	lhs *Expression
 	rhs *Expression
 }
 
 func NewTerm(lhs *Expression, rhs *Expression) *Term {
-	return &Term{lhs: lhs, rhs: rhs}
+	return &Term{op: OpEquals, lhs: lhs, rhs: rhs}
+}
+
+// NewInTerm lhs IN (sq)
+func NewInTerm(lhs *Expression, sq *Subquery) *Term {
+	return &Term{op: OpIn, lhs: lhs, rhs: NewExpressionWithSubquery(sq)}
+}
+
+// NewExistsTerm EXISTS (sq)
+func NewExistsTerm(sq *Subquery) *Term {
+	return &Term{op: OpExists, rhs: NewExpressionWithSubquery(sq)}
+}
+
+func (t *Term) Op() TermOp {
+	return t.op
+}
+
+// Lhs 左辺。EXISTS では nil
+func (t *Term) Lhs() *Expression {
+	return t.lhs
+}
+
+// Rhs 右辺。IN と EXISTS では副問合せ
+func (t *Term) Rhs() *Expression {
+	return t.rhs
 }
 
 func (t *Term) IsSatisfied(scan Scan) (bool, error) {
+	switch t.op {
+	case OpIn:
+		lhsVal, err := t.lhs.Evaluate(scan)
+		if err != nil {
+			return false, err
+		}
+		return t.rhs.AsSubquery().Contains(scan, lhsVal)
+	case OpExists:
+		return t.rhs.AsSubquery().Exists(scan)
+	}
+
+	lhsVal, err := t.lhs.Evaluate(scan)
+	if err != nil {
+		return false, err
+	}
+	rhsVal, err := t.rhs.Evaluate(scan)
+	if err != nil {
+		return false, err
+	}
+	// NULL との比較は成り立たない
+	if lhsVal.IsNull() || rhsVal.IsNull() {
+		return false, nil
+	}
+	return rhsVal.Equals(lhsVal), nil
+}
+
+// isNotFalse 項が偽でないか。NULL との比較は真でも偽でもない (UNKNOWN) ため true を返す
+func (t *Term) isNotFalse(scan Scan) (bool, error) {
+	if t.op != OpEquals {
+		return t.IsSatisfied(scan)
+	}
 	lhsVal, err := t.lhs.Evaluate(scan)
 	if err != nil {
 		return false, err
@@ -24,18 +92,42 @@ func (t *Term) IsSatisfied(scan Scan) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if lhsVal.IsNull() || rhsVal.IsNull() {
+		return true, nil
+	}
 	return rhsVal.Equals(lhsVal), nil
 }
 
 func (t *Term) AppliesTo(schema *record.Schema) bool {
-	return t.lhs.AppliesTo(schema) && t.rhs.AppliesTo(schema)
+	return (t.lhs == nil || t.lhs.AppliesTo(schema)) && t.rhs.AppliesTo(schema)
+}
+
+func (t *Term) substitute(fieldName string, expr *Expression) *Term {
+	if t.lhs == nil {
+		return t
+	}
+	return &Term{op: t.op, lhs: t.lhs.Substitute(fieldName, expr), rhs: t.rhs.Substitute(fieldName, expr)}
+}
+
+func (t *Term) mentions(fieldName string) bool {
+	return t.lhs != nil && t.lhs.mentions(fieldName) || t.rhs.mentions(fieldName)
 }
 
 func (t *Term) String() string {
+	switch t.op {
+	case OpIn:
+		return fmt.Sprintf("%s in %s", t.lhs, t.rhs)
+	case OpExists:
+		return fmt.Sprintf("exists %s", t.rhs)
+	}
 	return fmt.Sprintf("%s = %s", t.lhs, t.rhs)
 }
 
 func (t *Term) reductionFactor(p planLike) int32 {
+	// 副問合せを含む項がどれだけレコードを絞り込むかは見積もれないので、半分になるものとする
+	if t.op != OpEquals || t.lhs.IsSubquery() || t.rhs.IsSubquery() {
+		return 2
+	}
 	if t.lhs.IsFieldName() && t.rhs.IsFieldName() {
 		lhsName := t.lhs.AsFieldName()
 		rhsName := t.rhs.AsFieldName()
@@ -59,10 +151,17 @@ func (t *Term) reductionFactor(p planLike) int32 {
 // where F is the specified field and c is some constant.
 // If so, the method returns that constant.
 // If not, the method returns null.
+// F=NULL はどのレコードにも当てはまらないため、索引の検索には使わない
 func (t *Term) equatesWithConstant(fieldName string) *Constant {
-	if t.lhs.IsFieldName() && t.lhs.AsFieldName() == fieldName && !t.rhs.IsFieldName() {
+	if t.op != OpEquals || t.lhs.IsSubquery() || t.rhs.IsSubquery() {
+		return nil
+	}
+	if t.lhs.IsConstant() && t.lhs.AsConstant().IsNull() || t.rhs.IsConstant() && t.rhs.AsConstant().IsNull() {
+		return nil
+	}
+	if t.lhs.IsFieldName() && t.lhs.AsFieldName() == fieldName && t.rhs.IsConstant() {
 		return t.rhs.AsConstant()
-	} else if t.rhs.IsFieldName() && t.rhs.AsFieldName() == fieldName && !t.lhs.IsFieldName() {
+	} else if t.rhs.IsFieldName() && t.rhs.AsFieldName() == fieldName && t.lhs.IsConstant() {
 		return t.lhs.AsConstant()
 	} else {
 		return nil
@@ -74,6 +173,9 @@ func (t *Term) equatesWithConstant(fieldName string) *Constant {
 // If so, the method returns the name of that field.
 // If not, the method returns empty string.
 func (t *Term) equatesWithField(fieldName string) string {
+	if t.op != OpEquals {
+		return ""
+	}
 	if t.lhs.IsFieldName() && t.lhs.AsFieldName() == fieldName && t.rhs.IsFieldName() {
 		return t.rhs.AsFieldName()
 	} else if t.rhs.IsFieldName() && t.rhs.AsFieldName() == fieldName && t.lhs.IsFieldName() {
@@ -0,0 +1,158 @@
+package query
+
+import (
+	"container/heap"
+	"slices"
+)
+
+var _ Scan = (*TopNScan)(nil)
+
+// TopNScan scan のレコードを comp の順に並べた時の、先頭の n 件を順に返す
+// 全てをソートせずに、n 件を保持するヒープで最大のレコードを入れ替えながら読む
+type TopNScan struct {
+	scan   Scan
+	fields []string
+	rows   []map[string]*Constant
+	pos    int
+}
+
+// NewTopNScan scan の列 fields の値を読み込む
+func NewTopNScan(scan Scan, fields []string, comp *RecordComparator, n int32) (*TopNScan, error) {
+	h := &rowHeap{comp: comp}
+	if err := scan.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	for n > 0 {
+		next, err := scan.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			break
+		}
+		row := make(map[string]*Constant, len(fields))
+		for _, fieldName := range fields {
+			val, err := scan.GetVal(fieldName)
+			if err != nil {
+				return nil, err
+			}
+			row[fieldName] = val
+		}
+		if int32(h.Len()) < n {
+			heap.Push(h, row)
+			if h.err != nil {
+				return nil, h.err
+			}
+			continue
+		}
+		// ヒープの先頭は保持しているうちで最大のレコード
+		cmp, err := comp.CompareMap(row, h.rows[0])
+		if err != nil {
+			return nil, err
+		}
+		if cmp < 0 {
+			h.rows[0] = row
+			heap.Fix(h, 0)
+			if h.err != nil {
+				return nil, h.err
+			}
+		}
+	}
+
+	rows := make([]map[string]*Constant, h.Len())
+	for i := len(rows) - 1; i >= 0; i-- {
+		rows[i] = heap.Pop(h).(map[string]*Constant)
+	}
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &TopNScan{
+		scan:   scan,
+		fields: fields,
+		rows:   rows,
+		pos:    -1,
+	}, nil
+}
+
+func (ts *TopNScan) BeforeFirst() error {
+	ts.pos = -1
+	return nil
+}
+
+func (ts *TopNScan) Next() (bool, error) {
+	if ts.pos+1 >= len(ts.rows) {
+		ts.pos = len(ts.rows)
+		return false, nil
+	}
+	ts.pos++
+	return true, nil
+}
+
+func (ts *TopNScan) GetInt(fieldName string) (int32, error) {
+	val, err := ts.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (ts *TopNScan) GetString(fieldName string) (string, error) {
+	val, err := ts.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (ts *TopNScan) GetVal(fieldName string) (*Constant, error) {
+	if ts.pos < 0 || ts.pos >= len(ts.rows) {
+		return nil, ErrFieldNotFound
+	}
+	val, ok := ts.rows[ts.pos][fieldName]
+	if !ok {
+		return nil, ErrFieldNotFound
+	}
+	return val, nil
+}
+
+func (ts *TopNScan) HasField(fieldName string) bool {
+	return slices.Contains(ts.fields, fieldName)
+}
+
+func (ts *TopNScan) Close() {
+	ts.scan.Close()
+}
+
+// rowHeap comp の順で最大のレコードを先頭に置くヒープ
+// heap.Interface は比較の失敗を返せないので、最初に起きたエラーを err に記録する
+type rowHeap struct {
+	rows []map[string]*Constant
+	comp *RecordComparator
+	err  error
+}
+
+func (h *rowHeap) Len() int {
+	return len(h.rows)
+}
+
+func (h *rowHeap) Less(i, j int) bool {
+	cmp, err := h.comp.CompareMap(h.rows[i], h.rows[j])
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	return cmp > 0
+}
+
+func (h *rowHeap) Swap(i, j int) {
+	h.rows[i], h.rows[j] = h.rows[j], h.rows[i]
+}
+
+func (h *rowHeap) Push(x any) {
+	h.rows = append(h.rows, x.(map[string]*Constant))
+}
+
+func (h *rowHeap) Pop() any {
+	row := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return row
+}
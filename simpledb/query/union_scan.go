@@ -0,0 +1,87 @@
+package query
+
+import "slices"
+
+var _ Scan = (*UnionScan)(nil)
+
+// UnionScan 左側のレコードを全て返した後、右側のレコードを全て返す (UNION ALL)
+// 右側の列 fields2 は左側の列 fields1 と位置で対応させ、列名は左側のものを使う
+type UnionScan struct {
+	s1, s2           Scan
+	fields1, fields2 []string
+	// onRhs 右側のレコードを返している
+	onRhs bool
+}
+
+func NewUnionScan(s1, s2 Scan, fields1, fields2 []string) *UnionScan {
+	return &UnionScan{
+		s1:      s1,
+		s2:      s2,
+		fields1: fields1,
+		fields2: fields2,
+	}
+}
+
+func (us *UnionScan) BeforeFirst() error {
+	us.onRhs = false
+	if err := us.s1.BeforeFirst(); err != nil {
+		return err
+	}
+	return us.s2.BeforeFirst()
+}
+
+func (us *UnionScan) Next() (bool, error) {
+	if !us.onRhs {
+		next, err := us.s1.Next()
+		if err != nil || next {
+			return next, err
+		}
+		us.onRhs = true
+	}
+	return us.s2.Next()
+}
+
+// scanField 現在のレコードを返しているスキャンと、その中での列 fieldName の名前
+func (us *UnionScan) scanField(fieldName string) (Scan, string, error) {
+	i := slices.Index(us.fields1, fieldName)
+	if i < 0 {
+		return nil, "", ErrFieldNotFound
+	}
+	if us.onRhs {
+		return us.s2, us.fields2[i], nil
+	}
+	return us.s1, fieldName, nil
+}
+
+func (us *UnionScan) GetInt(fieldName string) (int32, error) {
+	s, name, err := us.scanField(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return s.GetInt(name)
+}
+
+func (us *UnionScan) GetString(fieldName string) (string, error) {
+	s, name, err := us.scanField(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return s.GetString(name)
+}
+
+func (us *UnionScan) GetVal(fieldName string) (*Constant, error) {
+	s, name, err := us.scanField(fieldName)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetVal(name)
+}
+
+func (us *UnionScan) HasField(fieldName string) bool {
+	return slices.Contains(us.fields1, fieldName)
+}
+
+func (us *UnionScan) Close() {
+	us.s1.Close()
+	us.s2.Close()
+}
@@ -0,0 +1,183 @@
+package query
+
+import "fmt"
+
+// ウィンドウ関数の名前
+const (
+	WindowRowNumber = "row_number"
+	WindowRank      = "rank"
+	WindowDenseRank = "dense_rank"
+	WindowLag       = "lag"
+	WindowLead      = "lead"
+	WindowSum       = "sum"
+	WindowCount     = "count"
+	WindowMin       = "min"
+	WindowMax       = "max"
+)
+
+// WindowFuncs ウィンドウ関数の名前と、引数に列を取るか
+var WindowFuncs = map[string]bool{
+	WindowRowNumber: false,
+	WindowRank:      false,
+	WindowDenseRank: false,
+	WindowLag:       true,
+	WindowLead:      true,
+	WindowSum:       true,
+	WindowCount:     true,
+	WindowMin:       true,
+	WindowMax:       true,
+}
+
+// WindowFn 区画の中で並べたレコードについて、ウィンドウ関数 name を計算して列 fieldName として出力する
+// 集約関数は区画の先頭から、現在のレコードと並びの値が等しいレコードまでを集約する。並びの列がなければ区画全体を集約する
+type WindowFn struct {
+	fieldName string
+	name      string
+	// field 引数の列。引数のない関数と count(*) では空
+	field string
+	// offset lag と lead で何件前か後のレコードの値を返すか
+	offset int32
+}
+
+func NewWindowFn(fieldName string, name string, field string, offset int32) *WindowFn {
+	return &WindowFn{
+		fieldName: fieldName,
+		name:      name,
+		field:     field,
+		offset:    offset,
+	}
+}
+
+func (wf *WindowFn) FieldName() string {
+	return wf.fieldName
+}
+
+// Field 引数の列。なければ空
+func (wf *WindowFn) Field() string {
+	return wf.field
+}
+
+// Name ウィンドウ関数の名前
+func (wf *WindowFn) Name() string {
+	return wf.name
+}
+
+// compute 区画のレコード rows について関数の値を計算する
+// peerStart[i], peerEnd[i] は rows[i] と並びの値が等しいレコードの最初と最後の位置
+func (wf *WindowFn) compute(rows []map[string]*Constant, peerStart, peerEnd []int) ([]*Constant, error) {
+	vals := make([]*Constant, len(rows))
+	switch wf.name {
+	case WindowRowNumber:
+		for i := range rows {
+			vals[i] = NewConstantWithInt(int32(i + 1))
+		}
+	case WindowRank:
+		for i := range rows {
+			vals[i] = NewConstantWithInt(int32(peerStart[i] + 1))
+		}
+	case WindowDenseRank:
+		rank := int32(0)
+		for i := range rows {
+			if peerStart[i] == i {
+				rank++
+			}
+			vals[i] = NewConstantWithInt(rank)
+		}
+	case WindowLag, WindowLead:
+		offset := int(wf.offset)
+		if wf.name == WindowLag {
+			offset = -offset
+		}
+		for i := range rows {
+			if j := i + offset; 0 <= j && j < len(rows) {
+				vals[i] = rows[j][wf.field]
+			} else {
+				vals[i] = NewNullConstant()
+			}
+		}
+	case WindowSum, WindowCount, WindowMin, WindowMax:
+		// 集約する範囲の終わりは後ろにしか動かないので、先頭から順に集約を進める
+		acc := newWindowAggregate(wf.name)
+		end := 0
+		for i := range rows {
+			for ; end <= peerEnd[i]; end++ {
+				val := NewConstantWithInt(0)
+				if wf.field != "" {
+					val = rows[end][wf.field]
+				}
+				if err := acc.add(val); err != nil {
+					return nil, fmt.Errorf("%s: %w", wf, err)
+				}
+			}
+			vals[i] = acc.value()
+		}
+	default:
+		return nil, fmt.Errorf("unknown window function: %s", wf.name)
+	}
+	return vals, nil
+}
+
+func (wf *WindowFn) String() string {
+	switch {
+	case !WindowFuncs[wf.name]:
+		return fmt.Sprintf("%s()", wf.name)
+	case wf.field == "":
+		return fmt.Sprintf("%s(*)", wf.name)
+	case (wf.name == WindowLag || wf.name == WindowLead) && wf.offset != 1:
+		return fmt.Sprintf("%s(%s, %d)", wf.name, wf.field, wf.offset)
+	}
+	return fmt.Sprintf("%s(%s)", wf.name, wf.field)
+}
+
+// windowAggregate 集約関数の途中の値。NULL は集約しない
+type windowAggregate struct {
+	name  string
+	count int32
+	val   *Constant
+}
+
+func newWindowAggregate(name string) *windowAggregate {
+	return &windowAggregate{name: name}
+}
+
+func (wa *windowAggregate) add(val *Constant) error {
+	if val.IsNull() {
+		return nil
+	}
+	wa.count++
+	if wa.val == nil {
+		wa.val = val
+		return nil
+	}
+	switch wa.name {
+	case WindowSum:
+		sum, err := wa.val.AsInt()
+		if err != nil {
+			return err
+		}
+		n, err := val.AsInt()
+		if err != nil {
+			return err
+		}
+		wa.val = NewConstantWithInt(sum + n)
+	case WindowMin, WindowMax:
+		cmp, err := val.CompareTo(wa.val)
+		if err != nil {
+			return err
+		}
+		if (wa.name == WindowMin && cmp < 0) || (wa.name == WindowMax && cmp > 0) {
+			wa.val = val
+		}
+	}
+	return nil
+}
+
+func (wa *windowAggregate) value() *Constant {
+	if wa.name == WindowCount {
+		return NewConstantWithInt(wa.count)
+	}
+	if wa.val == nil {
+		return NewNullConstant()
+	}
+	return wa.val
+}
@@ -0,0 +1,162 @@
+package query
+
+import "slices"
+
+var _ Scan = (*WindowScan)(nil)
+
+// WindowScan 区画の列 partitionBy と並びの列 orderBy でソートされた scan を区画ごとに読み、ウィンドウ関数 fns の列を加える
+// 1つの区画のレコードだけをメモリ上に保持する
+type WindowScan struct {
+	scan        Scan
+	fields      []string
+	partitionBy []string
+	orderBy     []string
+	fns         []*WindowFn
+
+	// rows 現在の区画のレコード。ウィンドウ関数の値も含む
+	rows []map[string]*Constant
+	pos  int
+	// hasMore scan が次の区画の先頭のレコードを指している
+	hasMore bool
+}
+
+// NewWindowScan fields は scan から読む列
+func NewWindowScan(scan Scan, fields []string, partitionBy []string, orderBy []string, fns []*WindowFn) (*WindowScan, error) {
+	ws := &WindowScan{
+		scan:        scan,
+		fields:      fields,
+		partitionBy: partitionBy,
+		orderBy:     orderBy,
+		fns:         fns,
+	}
+	if err := ws.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (ws *WindowScan) BeforeFirst() error {
+	if err := ws.scan.BeforeFirst(); err != nil {
+		return err
+	}
+	ws.rows = nil
+	ws.pos = 0
+	var err error
+	ws.hasMore, err = ws.scan.Next()
+	return err
+}
+
+func (ws *WindowScan) Next() (bool, error) {
+	if ws.pos+1 < len(ws.rows) {
+		ws.pos++
+		return true, nil
+	}
+	if !ws.hasMore {
+		ws.rows = nil
+		return false, nil
+	}
+	if err := ws.readPartition(); err != nil {
+		return false, err
+	}
+	ws.pos = 0
+	return true, nil
+}
+
+// readPartition 次の区画のレコードを読み、ウィンドウ関数を計算する
+func (ws *WindowScan) readPartition() error {
+	ws.rows = ws.rows[:0]
+	var partition *Constant
+	for ws.hasMore {
+		row := make(map[string]*Constant, len(ws.fields)+len(ws.fns))
+		for _, fieldName := range ws.fields {
+			val, err := ws.scan.GetVal(fieldName)
+			if err != nil {
+				return err
+			}
+			row[fieldName] = val
+		}
+		key := rowKey(row, ws.partitionBy)
+		if partition == nil {
+			partition = key
+		} else if !partition.Equals(key) {
+			break
+		}
+		ws.rows = append(ws.rows, row)
+
+		var err error
+		if ws.hasMore, err = ws.scan.Next(); err != nil {
+			return err
+		}
+	}
+
+	// 並びの値が等しいレコードの範囲
+	peerStart := make([]int, len(ws.rows))
+	peerEnd := make([]int, len(ws.rows))
+	for i := range ws.rows {
+		peerStart[i] = i
+		if i > 0 && rowKey(ws.rows[i-1], ws.orderBy).Equals(rowKey(ws.rows[i], ws.orderBy)) {
+			peerStart[i] = peerStart[i-1]
+		}
+	}
+	for i := len(ws.rows) - 1; i >= 0; i-- {
+		peerEnd[i] = i
+		if i+1 < len(ws.rows) && peerStart[i+1] == peerStart[i] {
+			peerEnd[i] = peerEnd[i+1]
+		}
+	}
+
+	for _, fn := range ws.fns {
+		vals, err := fn.compute(ws.rows, peerStart, peerEnd)
+		if err != nil {
+			return err
+		}
+		for i, val := range vals {
+			ws.rows[i][fn.fieldName] = val
+		}
+	}
+	return nil
+}
+
+// rowKey レコード row の列 fields の値を並べた複合キー
+func rowKey(row map[string]*Constant, fields []string) *Constant {
+	vals := make([]*Constant, 0, len(fields))
+	for _, fieldName := range fields {
+		vals = append(vals, row[fieldName])
+	}
+	return NewConstantWithTuple(vals...)
+}
+
+func (ws *WindowScan) GetInt(fieldName string) (int32, error) {
+	val, err := ws.GetVal(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt()
+}
+
+func (ws *WindowScan) GetString(fieldName string) (string, error) {
+	val, err := ws.GetVal(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString()
+}
+
+func (ws *WindowScan) GetVal(fieldName string) (*Constant, error) {
+	if ws.pos >= len(ws.rows) {
+		return nil, ErrFieldNotFound
+	}
+	val, ok := ws.rows[ws.pos][fieldName]
+	if !ok {
+		return nil, ErrFieldNotFound
+	}
+	return val, nil
+}
+
+func (ws *WindowScan) HasField(fieldName string) bool {
+	return slices.Contains(ws.fields, fieldName) || slices.ContainsFunc(ws.fns, func(fn *WindowFn) bool { return fn.fieldName == fieldName })
+}
+
+func (ws *WindowScan) Close() {
+	ws.scan.Close()
+}
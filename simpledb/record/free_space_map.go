@@ -0,0 +1,167 @@
+package record
+
+import (
+	"simpledb/file"
+	"simpledb/tx"
+)
+
+// bitsPerWord 空き領域マップの 1 ワード (int32) が表すブロックの数
+const bitsPerWord = 32
+
+// FreeSpaceMap 表のブロックごとに、新しいレコードを挿入する空きがないことを 1 ビットで記録する
+// ビットが 0 のブロックには空きがあるかもしれない。挿入に失敗した時に 1 にし、レコードを削除したトランザクションがコミットした時に 0 に戻す
+// 空き領域マップのファイルがないか短い場合はビットが全て 0 として扱うので、マップのない表もそのまま使える
+// マップは挿入するブロックを選ぶためのヒントで、選んだブロックに空きがあるかは挿入する時にブロック自体で確かめる
+// そのためビットはロックもログも使わずに書き換え、削除して他のトランザクションと競合しているブロックのビットを挿入が待たないようにする
+// ロールバックやリカバリでビットは元に戻らないが、食い違っても空きのあるブロックを使わないか、空きのないブロックを試すだけになる
+type FreeSpaceMap struct {
+	tx       *tx.Transaction
+	filename string
+	// freed レコードを削除して空きができたブロック。コミットした時にビットを 0 にする
+	freed map[int32]bool
+	// filled このマップで空きがないと記録したブロック。ロールバックすると空きが戻るので、ビットを 0 に戻す
+	filled map[int32]bool
+	// registered トランザクションが終わった時に freed と filled を記録する関数を登録したか
+	registered bool
+}
+
+// FreeSpaceMapFile 表 tableName の空き領域マップを格納するファイル
+func FreeSpaceMapFile(tableName string) string {
+	return tableName + ".fsm"
+}
+
+func NewFreeSpaceMap(tx *tx.Transaction, tableName string) *FreeSpaceMap {
+	return &FreeSpaceMap{tx: tx, filename: FreeSpaceMapFile(tableName)}
+}
+
+// bitsPerBlock マップの 1 ブロックが表す表のブロックの数
+func (fsm *FreeSpaceMap) bitsPerBlock() int32 {
+	return fsm.tx.BlockSize() / file.Int32Bytes * bitsPerWord
+}
+
+// locate 表のブロック blockNum のビットを含むマップのブロック、ワードの位置とビットのマスク
+func (fsm *FreeSpaceMap) locate(blockNum int32) (file.BlockID, int32, int32) {
+	bitsPerBlock := fsm.bitsPerBlock()
+	word := blockNum % bitsPerBlock / bitsPerWord
+	return file.NewBlockID(fsm.filename, blockNum/bitsPerBlock), word * file.Int32Bytes, 1 << (blockNum % bitsPerWord)
+}
+
+// IsFull 表のブロック blockNum に新しいレコードを挿入する空きがないと記録されているか
+func (fsm *FreeSpaceMap) IsFull(blockNum int32) (bool, error) {
+	blk, pos, mask := fsm.locate(blockNum)
+	size, err := fsm.tx.HintSize(fsm.filename)
+	if err != nil || blk.Number >= size {
+		return false, err
+	}
+	if err := fsm.tx.Pin(blk); err != nil {
+		return false, err
+	}
+	defer fsm.tx.Unpin(blk)
+	return fsm.tx.GetHint(blk, pos)&mask != 0, nil
+}
+
+// SetFull 表のブロック blockNum に空きがないかどうかをすぐに記録する
+// 空きがないと記録したブロックは、ロールバックした時に空きがあるものとして記録し直す
+// 削除してできた空きを使い切ったブロックは、コミットしても空きがあるものとして記録しない
+func (fsm *FreeSpaceMap) SetFull(blockNum int32, full bool) error {
+	if full {
+		delete(fsm.freed, blockNum)
+	}
+	changed, err := fsm.setBit(blockNum, full)
+	if err != nil || !changed || !full {
+		return err
+	}
+	if fsm.filled == nil {
+		fsm.filled = make(map[int32]bool)
+	}
+	fsm.filled[blockNum] = true
+	fsm.onEnd()
+	return nil
+}
+
+// SetFreeOnCommit レコードを削除したブロック blockNum に空きがあることを、コミットした時に記録する
+// コミットするまでは削除したレコードの領域を他のトランザクションが使えないので、それまでは同じマップの FindFree だけが空きとして扱う
+func (fsm *FreeSpaceMap) SetFreeOnCommit(blockNum int32) {
+	if fsm.freed == nil {
+		fsm.freed = make(map[int32]bool)
+	}
+	fsm.freed[blockNum] = true
+	fsm.onEnd()
+}
+
+// onEnd トランザクションが終わった時に、コミットしたら freed の、ロールバックしたら filled のブロックのビットを 0 にする関数を一度だけ登録する
+func (fsm *FreeSpaceMap) onEnd() {
+	if fsm.registered {
+		return
+	}
+	fsm.registered = true
+	fsm.tx.OnEnd(func(committed bool) error {
+		blocks := fsm.filled
+		if committed {
+			blocks = fsm.freed
+		}
+		fsm.freed, fsm.filled, fsm.registered = nil, nil, false
+		for blockNum := range blocks {
+			if _, err := fsm.setBit(blockNum, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setBit 表のブロック blockNum のビットを、full なら 1 に、そうでなければ 0 にする。ビットが変われば true を返す
+func (fsm *FreeSpaceMap) setBit(blockNum int32, full bool) (bool, error) {
+	blk, pos, mask := fsm.locate(blockNum)
+	size, err := fsm.tx.HintSize(fsm.filename)
+	if err != nil {
+		return false, err
+	}
+	if blk.Number >= size {
+		if !full {
+			return false, nil
+		}
+		if err := fsm.tx.ExtendHint(fsm.filename, blk.Number+1); err != nil {
+			return false, err
+		}
+	}
+
+	if err := fsm.tx.Pin(blk); err != nil {
+		return false, err
+	}
+	defer fsm.tx.Unpin(blk)
+	return fsm.tx.SetHintBits(blk, pos, mask, full), nil
+}
+
+// FindFree start 以上 end 未満のブロックのうち、空きがないと記録されていないか、SetFreeOnCommit で空きができた最初のブロック
+// なければ -1 を返す
+func (fsm *FreeSpaceMap) FindFree(start int32, end int32) (int32, error) {
+	size, err := fsm.tx.HintSize(fsm.filename)
+	if err != nil {
+		return 0, err
+	}
+	for blockNum := start; blockNum < end; {
+		blk, pos, _ := fsm.locate(blockNum)
+		if blk.Number >= size {
+			return blockNum, nil
+		}
+		if err := fsm.tx.Pin(blk); err != nil {
+			return 0, err
+		}
+		word := fsm.tx.GetHint(blk, pos)
+		fsm.tx.Unpin(blk)
+		for bit := blockNum % bitsPerWord; bit < bitsPerWord && blockNum < end; bit, blockNum = bit+1, blockNum+1 {
+			if word&(1<<bit) == 0 || fsm.freed[blockNum] {
+				return blockNum, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// TruncateOnCommit 表のファイルを先頭の numBlocks 個のブロックに切り詰める時に、コミットした時にマップも切り詰める
+// 切り詰めるブロックのビットは、コミットするまでに 0 にしておかなければならない
+func (fsm *FreeSpaceMap) TruncateOnCommit(numBlocks int32) error {
+	bitsPerBlock := fsm.bitsPerBlock()
+	return fsm.tx.TruncateOnCommit(fsm.filename, (numBlocks+bitsPerBlock-1)/bitsPerBlock)
+}
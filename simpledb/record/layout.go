@@ -1,28 +1,111 @@
 package record
 
 import (
+	"fmt"
 	"simpledb/file"
+	"slices"
 )
 
+// MaxNullableFields NULL を格納できる列の数の上限
+// NULL かどうかは empty/inuse フラグの残りのビットに記録する
+const MaxNullableFields = 31
+
+// Format 表のレコードをブロックに格納する形式
+type Format int32
+
+const (
+	// FixedFormat 全てのレコードを同じ大きさのスロットに格納する。VARCHAR には最大長の領域を確保する
+	FixedFormat Format = iota
+	// SlottedFormat ブロックの先頭のスロットの目録から、ブロックの末尾に詰めた可変長のレコードを指す
+	// VARCHAR には値の長さの領域だけを使う
+	SlottedFormat
+)
+
+func (f Format) String() string {
+	switch f {
+	case FixedFormat:
+		return "fixed"
+	case SlottedFormat:
+		return "slotted"
+	default:
+		return fmt.Sprintf("Format(%d)", int32(f))
+	}
+}
+
 type Layout struct {
 	schema   *Schema
 	offset   map[string]int32
 	slotSize int32
+	// nullBit 各列の NULL フラグのビット位置。オフセットの順に割り当てるため、カタログから読み直しても変わらない
+	nullBit map[string]int32
+	format  Format
 }
 
 func NewLayoutFromSchema(schema *Schema) *Layout {
+	return NewLayoutFromSchemaWithFormat(schema, FixedFormat)
+}
+
+// NewLayoutFromSchemaWithFormat 形式 format のレイアウト
+// スロット形式では VARCHAR の列の位置に、レコードの中の文字列の位置を格納する。slotSize は文字列を除いたレコードの大きさになる
+func NewLayoutFromSchemaWithFormat(schema *Schema, format Format) *Layout {
+	return NewLayoutFromSchemaWithEncoding(schema, format, file.UTF16)
+}
+
+// NewLayoutFromSchemaWithEncoding 文字列を encoding で格納するデータベースでの、形式 format のレイアウト
+func NewLayoutFromSchemaWithEncoding(schema *Schema, format Format, encoding file.Encoding) *Layout {
 	offsets := make(map[string]int32)
 	// empty/inuse flagのために整数分の領域(4byte)を確保
 	pos := file.Int32Bytes
 	for _, fieldName := range schema.Fields() {
 		offsets[fieldName] = pos
-		pos += lengthInBytes(schema, fieldName)
+		if format == SlottedFormat {
+			pos += file.Int32Bytes
+		} else {
+			pos += lengthInBytes(schema, fieldName, encoding)
+		}
 	}
-	return NewLayout(schema, offsets, pos)
+	return NewLayoutWithFormat(schema, offsets, pos, format)
 }
 
 func NewLayout(schema *Schema, offsets map[string]int32, slotSize int32) *Layout {
-	return &Layout{schema, offsets, slotSize}
+	return NewLayoutWithFormat(schema, offsets, slotSize, FixedFormat)
+}
+
+func NewLayoutWithFormat(schema *Schema, offsets map[string]int32, slotSize int32, format Format) *Layout {
+	fields := slices.Clone(schema.Fields())
+	slices.SortStableFunc(fields, func(a, b string) int {
+		return int(offsets[a] - offsets[b])
+	})
+	nullBit := make(map[string]int32, len(fields))
+	for i, fieldName := range fields {
+		if i < MaxNullableFields {
+			nullBit[fieldName] = int32(i) + 1
+		}
+	}
+	return &Layout{schema, offsets, slotSize, nullBit, format}
+}
+
+// Rename 列 names のキーの列を値の名前で読み書きするレイアウト。レコードの形式は変わらない
+// 同じ表を別名で複数回参照する時に、列名が衝突しないようにするために使う
+func (l *Layout) Rename(names map[string]string) *Layout {
+	newName := func(fieldName string) string {
+		if name, ok := names[fieldName]; ok {
+			return name
+		}
+		return fieldName
+	}
+	schema := NewSchema()
+	offset := make(map[string]int32, len(l.offset))
+	nullBit := make(map[string]int32, len(l.nullBit))
+	for _, fieldName := range l.schema.Fields() {
+		name := newName(fieldName)
+		schema.AddField(name, l.schema.Type(fieldName), l.schema.Length(fieldName))
+		offset[name] = l.offset[fieldName]
+		if bit, ok := l.nullBit[fieldName]; ok {
+			nullBit[name] = bit
+		}
+	}
+	return &Layout{schema, offset, l.slotSize, nullBit, l.format}
 }
 
 func (l *Layout) Schema() *Schema {
@@ -33,15 +116,43 @@ func (l *Layout) Offset(fieldName string) int32 {
 	return l.offset[fieldName]
 }
 
+// SlotSize スロットの大きさ。スロット形式では、文字列を除いたレコードの大きさ
 func (l *Layout) SlotSize() int32 {
 	return l.slotSize
 }
 
-func lengthInBytes(schema *Schema, fieldName string) int32 {
+func (l *Layout) Format() Format {
+	return l.format
+}
+
+// CheckFits 大きさ blockSize のブロックにレコードが収まるか調べる
+// 固定長形式ではスロット全体が、スロット形式では文字列を除いたレコードとスロットの目録が収まらなければならない
+// スロット形式の大きな文字列はオーバーフローファイルに格納するので、VARCHAR の長さは問わない
+func (l *Layout) CheckFits(blockSize int32) error {
+	size := l.slotSize
+	if l.format == SlottedFormat {
+		size += slotEntryPos(1)
+	}
+	if size > blockSize {
+		return fmt.Errorf("%w: %d bytes in %s format, but a block has %d bytes", ErrRecordTooLarge, size, l.format, blockSize)
+	}
+	return nil
+}
+
+// NullMask フラグのうち fieldName の NULL を表すビット。NULL を格納できない列では 0
+func (l *Layout) NullMask(fieldName string) int32 {
+	bit, ok := l.nullBit[fieldName]
+	if !ok {
+		return 0
+	}
+	return 1 << bit
+}
+
+func lengthInBytes(schema *Schema, fieldName string, encoding file.Encoding) int32 {
 	fieldType := schema.Type(fieldName)
 	if fieldType == INT {
 		return file.Int32Bytes
 	} else {
-		return file.MaxLength(schema.Length(fieldName))
+		return encoding.MaxLength(schema.Length(fieldName))
 	}
 }
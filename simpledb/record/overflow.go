@@ -0,0 +1,249 @@
+package record
+
+import (
+	"simpledb/file"
+	"simpledb/tx"
+	"strings"
+)
+
+// オーバーフローファイルの先頭のブロック (ヘッダ)
+//
+//	| freeHead | highWater |
+//
+// freeHead は空きブロックのリストの先頭 (なければ 0)、highWater は一度でも使ったブロックの数
+// 空きブロックは全て highWater より前にあるので、highWater 以降のブロックは切り詰められる
+//
+// 文字列を格納するブロック
+//
+//	| next | length | bytes ... |
+//
+// next は次のブロック (最後なら 0)、length はこのブロックに格納したバイト数
+// 文字列は Page.SetString と同じ形式のバイト列にして、ブロックの連鎖に分けて格納する
+const (
+	overflowFreeHeadPos  = 0
+	overflowHighWaterPos = file.Int32Bytes
+	overflowNextPos      = 0
+	overflowLengthPos    = file.Int32Bytes
+	overflowDataPos      = 2 * file.Int32Bytes
+)
+
+// Overflow スロット形式の表で、レコードに収めるには大きすぎる文字列を格納するオーバーフローファイル
+// レコードの VARCHAR の列には、文字列の位置の代わりに、連鎖の先頭のブロック番号を負にして格納する
+// ブロックは SetInt と SetBytes で書き込むので、ロールバックとリカバリでは表のブロックと一緒に元に戻る
+type Overflow struct {
+	tx       *tx.Transaction
+	filename string
+}
+
+// OverflowFile 表 tableName のオーバーフローファイル
+func OverflowFile(tableName string) string {
+	return tableName + ".ovf"
+}
+
+func NewOverflow(tx *tx.Transaction, tableName string) *Overflow {
+	return &Overflow{tx: tx, filename: OverflowFile(tableName)}
+}
+
+// overflowOf 表のファイル filename のブロックに格納したレコードの、オーバーフローファイル
+func overflowOf(tx *tx.Transaction, filename string) *Overflow {
+	return NewOverflow(tx, strings.TrimSuffix(filename, ".tbl"))
+}
+
+// Write 文字列 val をブロックの連鎖に格納し、先頭のブロック番号を返す
+func (o *Overflow) Write(val string) (int32, error) {
+	encoding := o.tx.Encoding()
+	data := make([]byte, encoding.StringBytes(val))
+	file.NewPageWithEncoding(data, encoding).SetString(0, val)
+
+	capacity := o.tx.BlockSize() - overflowDataPos
+	numBlocks := (int32(len(data)) + capacity - 1) / capacity
+	blocks := make([]file.BlockID, numBlocks)
+	for i := range blocks {
+		blk, err := o.allocate()
+		if err != nil {
+			return 0, err
+		}
+		blocks[i] = blk
+	}
+	for i, blk := range blocks {
+		chunk := data[int32(i)*capacity : min(int32(i+1)*capacity, int32(len(data)))]
+		var next int32
+		if i+1 < len(blocks) {
+			next = blocks[i+1].Number
+		}
+		if err := o.writeBlock(blk, next, chunk); err != nil {
+			return 0, err
+		}
+	}
+	return blocks[0].Number, nil
+}
+
+func (o *Overflow) writeBlock(blk file.BlockID, next int32, chunk []byte) error {
+	if err := o.tx.Pin(blk); err != nil {
+		return err
+	}
+	defer o.tx.Unpin(blk)
+	if err := o.tx.SetInt(blk, overflowNextPos, next, true); err != nil {
+		return err
+	}
+	if err := o.tx.SetInt(blk, overflowLengthPos, int32(len(chunk)), true); err != nil {
+		return err
+	}
+	return o.tx.SetBytes(blk, overflowDataPos, chunk, true)
+}
+
+// Read ブロック blockNum から始まる連鎖に格納した文字列
+func (o *Overflow) Read(blockNum int32) (string, error) {
+	var data []byte
+	for blockNum != 0 {
+		blk := file.NewBlockID(o.filename, blockNum)
+		if err := o.tx.Pin(blk); err != nil {
+			return "", err
+		}
+		next, err := o.tx.GetInt(blk, overflowNextPos)
+		if err == nil {
+			var length int32
+			if length, err = o.tx.GetInt(blk, overflowLengthPos); err == nil {
+				var chunk []byte
+				chunk, err = o.tx.GetBytes(blk, overflowDataPos, length)
+				data = append(data, chunk...)
+			}
+		}
+		o.tx.Unpin(blk)
+		if err != nil {
+			return "", err
+		}
+		blockNum = next
+	}
+	return file.NewPageWithEncoding(data, o.tx.Encoding()).GetString(0), nil
+}
+
+// Free ブロック blockNum から始まる連鎖を、空きブロックのリストに戻す
+func (o *Overflow) Free(blockNum int32) error {
+	// 連鎖の最後のブロックを、今の空きブロックのリストにつなぐ
+	last := file.NewBlockID(o.filename, blockNum)
+	for {
+		if err := o.tx.Pin(last); err != nil {
+			return err
+		}
+		next, err := o.tx.GetInt(last, overflowNextPos)
+		o.tx.Unpin(last)
+		if err != nil {
+			return err
+		}
+		if next == 0 {
+			break
+		}
+		last = file.NewBlockID(o.filename, next)
+	}
+
+	header := file.NewBlockID(o.filename, 0)
+	if err := o.tx.Pin(header); err != nil {
+		return err
+	}
+	defer o.tx.Unpin(header)
+	freeHead, err := o.tx.GetInt(header, overflowFreeHeadPos)
+	if err != nil {
+		return err
+	}
+	if err := o.tx.Pin(last); err != nil {
+		return err
+	}
+	err = o.tx.SetInt(last, overflowNextPos, freeHead, true)
+	o.tx.Unpin(last)
+	if err != nil {
+		return err
+	}
+	return o.tx.SetInt(header, overflowFreeHeadPos, blockNum, true)
+}
+
+// allocate 空きブロックのリストの先頭のブロックを返す。空きブロックがなければ highWater のブロックを使う
+func (o *Overflow) allocate() (file.BlockID, error) {
+	size, err := o.tx.Size(o.filename)
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	if size == 0 {
+		if _, err := o.tx.Append(o.filename); err != nil {
+			return file.BlockID{}, err
+		}
+		size = 1
+	}
+	header := file.NewBlockID(o.filename, 0)
+	if err := o.tx.Pin(header); err != nil {
+		return file.BlockID{}, err
+	}
+	defer o.tx.Unpin(header)
+
+	freeHead, err := o.tx.GetInt(header, overflowFreeHeadPos)
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	if freeHead != 0 {
+		blk := file.NewBlockID(o.filename, freeHead)
+		if err := o.tx.Pin(blk); err != nil {
+			return file.BlockID{}, err
+		}
+		next, err := o.tx.GetInt(blk, overflowNextPos)
+		o.tx.Unpin(blk)
+		if err != nil {
+			return file.BlockID{}, err
+		}
+		return blk, o.tx.SetInt(header, overflowFreeHeadPos, next, true)
+	}
+
+	highWater, err := o.highWater(header)
+	if err != nil {
+		return file.BlockID{}, err
+	}
+	// ロールバックで highWater が戻ったブロックは、ファイルに残っているのでそのまま使う
+	if highWater >= size {
+		blk, err := o.tx.Append(o.filename)
+		if err != nil {
+			return file.BlockID{}, err
+		}
+		highWater = blk.Number
+	}
+	return file.NewBlockID(o.filename, highWater), o.tx.SetInt(header, overflowHighWaterPos, highWater+1, true)
+}
+
+// highWater ヘッダに記録した highWater。ヘッダしかないファイルでは 1
+func (o *Overflow) highWater(header file.BlockID) (int32, error) {
+	highWater, err := o.tx.GetInt(header, overflowHighWaterPos)
+	return max(highWater, 1), err
+}
+
+// Reset 全てのブロックを空きにする。表の全てのレコードを書き直す時に、元のレコードの連鎖をまとめて回収する
+func (o *Overflow) Reset() error {
+	size, err := o.tx.Size(o.filename)
+	if err != nil || size == 0 {
+		return err
+	}
+	header := file.NewBlockID(o.filename, 0)
+	if err := o.tx.Pin(header); err != nil {
+		return err
+	}
+	defer o.tx.Unpin(header)
+	if err := o.tx.SetInt(header, overflowFreeHeadPos, 0, true); err != nil {
+		return err
+	}
+	return o.tx.SetInt(header, overflowHighWaterPos, 1, true)
+}
+
+// TruncateOnCommit コミットした時に、highWater 以降の使っていないブロックを切り詰める
+func (o *Overflow) TruncateOnCommit() error {
+	size, err := o.tx.Size(o.filename)
+	if err != nil || size == 0 {
+		return err
+	}
+	header := file.NewBlockID(o.filename, 0)
+	if err := o.tx.Pin(header); err != nil {
+		return err
+	}
+	highWater, err := o.highWater(header)
+	o.tx.Unpin(header)
+	if err != nil {
+		return err
+	}
+	return o.tx.TruncateOnCommit(o.filename, highWater)
+}
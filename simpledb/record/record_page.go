@@ -1,6 +1,8 @@
 package record
 
 import (
+	"errors"
+	"fmt"
 	"simpledb/file"
 	"simpledb/tx"
 	"simpledb/util/logger"
@@ -8,11 +10,22 @@ import (
 
 type InUseFlag int32
 
+// フラグの最下位ビットが empty/inuse を表し、残りのビットは各列が NULL かどうかを表す
+// スロット形式では、スロットの状態はスロットの目録に、NULL のビットはレコードの先頭に格納する
 const (
 	Empty InUseFlag = 0
 	Used  InUseFlag = 1
+	// Moved スロット形式で、別のブロックのスロットから移されたレコード。元のスロットから辿るので、走査では読み飛ばす
+	Moved InUseFlag = 2
+	// Forwarded スロット形式で、レコードを別のブロックに移したスロット。レコードの代わりに移した先の RID を格納する
+	Forwarded InUseFlag = 3
 )
 
+const inUseMask = 1
+
+// ErrStringTooLong 文字列が VARCHAR の列の長さを超える
+var ErrStringTooLong = errors.New("string is too long for the field")
+
 type RecordPage struct {
 	logger *logger.Logger
 
@@ -32,32 +45,141 @@ func NewRecordPage(tx *tx.Transaction, blk file.BlockID, layout *Layout) (*Recor
 }
 
 func (rp *RecordPage) GetInt(slot int32, fieldName string) (int32, error) {
-	fieldPos := rp.offset(slot) + rp.layout.Offset(fieldName)
-	return rp.tx.GetInt(rp.blk, fieldPos)
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return 0, err
+	}
+	return rp.tx.GetInt(rp.blk, pos+rp.layout.Offset(fieldName))
 }
 
 func (rp *RecordPage) GetString(slot int32, fieldName string) (string, error) {
-	fieldPos := rp.offset(slot) + rp.layout.Offset(fieldName)
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return "", err
+	}
+	fieldPos := pos + rp.layout.Offset(fieldName)
+	if rp.slotted() {
+		strPos, err := rp.tx.GetInt(rp.blk, fieldPos)
+		if err != nil || strPos == 0 {
+			return "", err
+		}
+		if strPos < 0 {
+			return overflowOf(rp.tx, rp.blk.FileName).Read(-strPos)
+		}
+		fieldPos = pos + strPos
+	}
 	return rp.tx.GetString(rp.blk, fieldPos)
 }
 
 func (rp *RecordPage) SetInt(slot int32, fieldName string, val int32) error {
-	fieldPos := rp.offset(slot) + rp.layout.Offset(fieldName)
-	return rp.tx.SetInt(rp.blk, fieldPos, val, true)
+	if err := rp.setNullFlag(slot, fieldName, false); err != nil {
+		return err
+	}
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return err
+	}
+	return rp.tx.SetInt(rp.blk, pos+rp.layout.Offset(fieldName), val, true)
 }
 
+// SetString スロット形式で、レコードがブロックの空き領域に収まらなければ ErrPageFull を返し、レコードは変更しない
+// VARCHAR(n) の列には、UTF-8 のデータベースでは n バイト、UTF-16 のデータベースでは n 符号単位までの文字列を格納でき、それより長ければ ErrStringTooLong を返す
 func (rp *RecordPage) SetString(slot int32, fieldName string, val string) error {
+	if err := rp.checkLength(fieldName, val); err != nil {
+		return err
+	}
+	if rp.slotted() {
+		return rp.setSlottedString(slot, fieldName, val, 0)
+	}
+	if err := rp.setNullFlag(slot, fieldName, false); err != nil {
+		return err
+	}
 	fieldPos := rp.offset(slot) + rp.layout.Offset(fieldName)
 	return rp.tx.SetString(rp.blk, fieldPos, val, true)
 }
 
+// checkLength val をデータベースの符号化方式で書き込んだ大きさが、VARCHAR の列に確保する大きさに収まるか調べる
+func (rp *RecordPage) checkLength(fieldName string, val string) error {
+	encoding := rp.tx.Encoding()
+	length := rp.layout.Schema().Length(fieldName)
+	if size, maxSize := encoding.StringBytes(val), encoding.MaxLength(length); size > maxSize {
+		return fmt.Errorf("%w: %q needs %d bytes in %s, but varchar(%d) holds %d bytes", ErrStringTooLong, val, size, encoding, length, maxSize)
+	}
+	return nil
+}
+
+func (rp *RecordPage) IsNull(slot int32, fieldName string) (bool, error) {
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return false, err
+	}
+	flag, err := rp.tx.GetInt(rp.blk, pos)
+	if err != nil {
+		return false, err
+	}
+	return flag&rp.layout.NullMask(fieldName) != 0, nil
+}
+
+// SetNull 列の値を NULL にする。格納されている値はそのまま残る
+func (rp *RecordPage) SetNull(slot int32, fieldName string) error {
+	if rp.layout.NullMask(fieldName) == 0 {
+		return fmt.Errorf("field %q cannot store NULL: a record can have at most %d nullable fields", fieldName, MaxNullableFields)
+	}
+	return rp.setNullFlag(slot, fieldName, true)
+}
+
+// setNullFlag 列の NULL のビットを設定する。値を書き込むたびに呼ばれるので、ビットが変わらなければフラグを書き直さず、ログも残さない
+func (rp *RecordPage) setNullFlag(slot int32, fieldName string, null bool) error {
+	mask := rp.layout.NullMask(fieldName)
+	if mask == 0 {
+		return nil
+	}
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return err
+	}
+	flag, err := rp.tx.GetInt(rp.blk, pos)
+	if err != nil {
+		return err
+	}
+	newFlag := flag &^ mask
+	if null {
+		newFlag |= mask
+	}
+	if newFlag == flag {
+		return nil
+	}
+	return rp.tx.SetInt(rp.blk, pos, newFlag, true)
+}
+
+// Delete レコードを削除する。スロット形式では、オーバーフローファイルに格納した文字列も解放する
 func (rp *RecordPage) Delete(slot int32) error {
+	if rp.slotted() {
+		if err := rp.freeOverflows(slot); err != nil {
+			return err
+		}
+	}
+	return rp.Vacate(slot)
+}
+
+// Vacate レコードを削除するが、オーバーフローファイルに格納した文字列は解放しない
+// レコードを別のスロットに移して、移した先のレコードが文字列を引き継ぐ時に使う
+func (rp *RecordPage) Vacate(slot int32) error {
+	if rp.slotted() {
+		return rp.setSlotFlag(slot, Empty)
+	}
 	return rp.setFlag(slot, Empty)
 }
 
 // Format 新しいブロックを作成する
 // ブロックを作成する時に書き込む値は無意味なため、logには書き込まないようにする
 func (rp *RecordPage) Format() error {
+	if rp.slotted() {
+		if err := rp.tx.SetInt(rp.blk, numSlotsPos, 0, false); err != nil {
+			return err
+		}
+		return rp.tx.SetInt(rp.blk, usedPos, 0, false)
+	}
 	var slot int32 = 0
 	for rp.isValidSlot(slot) {
 		err := rp.tx.SetInt(rp.blk, rp.offset(slot), int32(Empty), false)
@@ -81,12 +203,34 @@ func (rp *RecordPage) Format() error {
 	return nil
 }
 
+// ClearBlock ブロック全体をログを残して 0 で埋める
+// Format と異なりレイアウトに依存しないので、別のレイアウトのレコードが入っていたブロックも、ロールバックできる形で空にできる
+// ブロックは pin されていなければならない
+func ClearBlock(tx *tx.Transaction, blk file.BlockID) error {
+	for pos := int32(0); pos+file.Int32Bytes <= tx.BlockSize(); pos += file.Int32Bytes {
+		val, err := tx.GetInt(blk, pos)
+		if err != nil {
+			return err
+		}
+		if val == 0 {
+			continue
+		}
+		if err := tx.SetInt(blk, pos, 0, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (rp *RecordPage) NextAfter(slot int32) (int32, error) {
 	return rp.SearchAfter(slot, Used)
 }
 
 // InsertAfter 指定されたスロットの後に新しいレコードを挿入する(inuseフラグを立てる)
 func (rp *RecordPage) InsertAfter(slot int32) (int32, error) {
+	if rp.slotted() {
+		return rp.slottedInsertAfter(slot)
+	}
 	newSlot, err := rp.SearchAfter(slot, Empty)
 	if err != nil {
 		return 0, err
@@ -99,6 +243,16 @@ func (rp *RecordPage) InsertAfter(slot int32) (int32, error) {
 	return newSlot, nil
 }
 
+// IsEmpty ブロックにレコードが1つもないか。スロット形式では、移されたレコードと移したスロットもレコードとして数える
+func (rp *RecordPage) IsEmpty() (bool, error) {
+	slot, err := rp.SearchAfter(-1, Used)
+	if err != nil || slot >= 0 || !rp.slotted() {
+		return slot < 0, err
+	}
+	slot, err = rp.SearchAfter(-1, Moved)
+	return slot < 0, err
+}
+
 func (rp *RecordPage) Block() file.BlockID {
 	return rp.blk
 }
@@ -107,14 +261,19 @@ func (rp *RecordPage) setFlag(slot int32, flag InUseFlag) error {
 	return rp.tx.SetInt(rp.blk, rp.offset(slot), int32(flag), true)
 }
 
+// SearchAfter 指定されたスロットの後で、flag の状態のスロットを探す。なければ -1 を返す
+// スロット形式では、Used は別のブロックに移したレコードのスロットも含み、Empty は新しいレコードを挿入できるスロットを表す
 func (rp *RecordPage) SearchAfter(slot int32, flag InUseFlag) (int32, error) {
+	if rp.slotted() {
+		return rp.slottedSearchAfter(slot, flag)
+	}
 	slot++
 	for rp.isValidSlot(slot) {
 		slotFlag, err := rp.tx.GetInt(rp.blk, rp.offset(slot))
 		if err != nil {
 			return 0, err
 		}
-		if InUseFlag(slotFlag) == flag {
+		if InUseFlag(slotFlag&inUseMask) == flag {
 			return slot, nil
 		}
 		slot++
@@ -129,3 +288,12 @@ func (rp *RecordPage) isValidSlot(slot int32) bool {
 func (rp *RecordPage) offset(slot int32) int32 {
 	return slot * rp.layout.SlotSize()
 }
+
+// recordPos スロット slot のレコードの先頭の位置
+func (rp *RecordPage) recordPos(slot int32) (int32, error) {
+	if rp.slotted() {
+		pos, _, err := rp.slotRecord(slot)
+		return pos, err
+	}
+	return rp.offset(slot), nil
+}
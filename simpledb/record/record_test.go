@@ -1,11 +1,13 @@
 package record_test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"path"
 	"simpledb/record"
 	"simpledb/server"
+	"strings"
 	"testing"
 )
 
@@ -120,3 +122,259 @@ func TestRecord(t *testing.T) {
 		t.Fatalf("Failed to commit transaction: %v", err)
 	}
 }
+
+func TestRecordNull(t *testing.T) {
+	t.Parallel()
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "recordnulltest"), 400, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+	blk, err := tx.Append("nulltestfile")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	if err := tx.Pin(blk); err != nil {
+		t.Fatalf("Failed to pin block: %v", err)
+	}
+	recordPage, err := record.NewRecordPage(tx, blk, layout)
+	if err != nil {
+		t.Fatalf("Failed to create record page: %v", err)
+	}
+	if err = recordPage.Format(); err != nil {
+		t.Fatalf("Failed to format record page: %v", err)
+	}
+
+	slot, err := recordPage.InsertAfter(-1)
+	if err != nil {
+		t.Fatalf("Failed to insert record: %v", err)
+	}
+	if err := recordPage.SetInt(slot, "A", 1); err != nil {
+		t.Fatalf("Failed to set int: %v", err)
+	}
+	if err := recordPage.SetNull(slot, "B"); err != nil {
+		t.Fatalf("Failed to set null: %v", err)
+	}
+	if null, err := recordPage.IsNull(slot, "A"); err != nil || null {
+		t.Errorf("A is null: %t, %v", null, err)
+	}
+	if null, err := recordPage.IsNull(slot, "B"); err != nil || !null {
+		t.Errorf("B is not null: %t, %v", null, err)
+	}
+	// NULL フラグがあってもレコードは使用中のまま
+	if next, err := recordPage.NextAfter(-1); err != nil || next != slot {
+		t.Errorf("NextAfter(-1) = %d, %v", next, err)
+	}
+	// 値を設定すると NULL ではなくなる
+	if err := recordPage.SetString(slot, "B", "rec1"); err != nil {
+		t.Fatalf("Failed to set string: %v", err)
+	}
+	if null, err := recordPage.IsNull(slot, "B"); err != nil || null {
+		t.Errorf("B is null: %t, %v", null, err)
+	}
+	tx.Unpin(blk)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+}
+
+func TestSlottedRecordPage(t *testing.T) {
+	t.Parallel()
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "slottedtest"), 400, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 300)
+	layout := record.NewLayoutFromSchemaWithFormat(schema, record.SlottedFormat)
+	if layout.SlotSize() != 12 {
+		t.Errorf("slot size %d", layout.SlotSize())
+	}
+	blk, err := tx.Append("slottedfile")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	if err := tx.Pin(blk); err != nil {
+		t.Fatalf("Failed to pin block: %v", err)
+	}
+	recordPage, err := record.NewRecordPage(tx, blk, layout)
+	if err != nil {
+		t.Fatalf("Failed to create record page: %v", err)
+	}
+	if err = recordPage.Format(); err != nil {
+		t.Fatalf("Failed to format record page: %v", err)
+	}
+
+	// 短い文字列のレコードでブロックを埋める
+	want := make(map[int32]string)
+	slot, err := recordPage.InsertAfter(-1)
+	if err != nil {
+		t.Fatalf("Failed to insert record: %v", err)
+	}
+	for slot >= 0 {
+		if err := recordPage.SetInt(slot, "A", slot); err != nil {
+			t.Fatalf("Failed to set int: %v", err)
+		}
+		b := fmt.Sprintf("rec%d", slot)
+		// 挿入したレコードに文字列が収まらなければ、そこで止める
+		if err := recordPage.SetString(slot, "B", b); errors.Is(err, record.ErrPageFull) {
+			if err := recordPage.Delete(slot); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to set string: %v", err)
+		}
+		want[slot] = b
+		slot, err = recordPage.InsertAfter(slot)
+		if err != nil {
+			t.Fatalf("Failed to insert record: %v", err)
+		}
+	}
+	if len(want) < 10 {
+		t.Fatalf("only %d records fit in the block", len(want))
+	}
+
+	// 空き領域に収まらない文字列は設定できない
+	long := strings.Repeat("x", 60)
+	if err := recordPage.SetString(0, "B", long); !errors.Is(err, record.ErrPageFull) {
+		t.Fatalf("SetString() = %v, want ErrPageFull", err)
+	}
+	if err := recordPage.SetString(0, "B", strings.Repeat("x", 200)); !errors.Is(err, record.ErrRecordTooLarge) {
+		t.Fatalf("SetString() = %v, want ErrRecordTooLarge", err)
+	}
+
+	// 半分のレコードを削除すると、詰め直して長い文字列を格納できる
+	for s := range want {
+		if s%2 == 1 {
+			if err := recordPage.Delete(s); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+			delete(want, s)
+		}
+	}
+	if err := recordPage.SetString(0, "B", long); err != nil {
+		t.Fatalf("Failed to set long string: %v", err)
+	}
+	want[0] = long
+
+	count := 0
+	slot, err = recordPage.NextAfter(-1)
+	if err != nil {
+		t.Fatalf("Failed to get next slot: %v", err)
+	}
+	for slot >= 0 {
+		a, err := recordPage.GetInt(slot, "A")
+		if err != nil {
+			t.Fatalf("Failed to get int: %v", err)
+		}
+		b, err := recordPage.GetString(slot, "B")
+		if err != nil {
+			t.Fatalf("Failed to get string: %v", err)
+		}
+		if a != slot || b != want[slot] {
+			t.Errorf("slot %d: {%d, %s}", slot, a, b)
+		}
+		count++
+		slot, err = recordPage.NextAfter(slot)
+		if err != nil {
+			t.Fatalf("Failed to get next slot: %v", err)
+		}
+	}
+	if count != len(want) {
+		t.Errorf("%d records remain, want %d", count, len(want))
+	}
+	tx.Unpin(blk)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+}
+
+// TestRecordNullFlagLogging NULL のビットが変わらなければ、値の書き込みでフラグを書き直さない
+func TestRecordNullFlagLogging(t *testing.T) {
+	t.Parallel()
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "recordnulllogtest"), 400, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// logCount ログのレコードの数
+	logCount := func() int {
+		t.Helper()
+		iter, err := db.LogManager().Iterator()
+		if err != nil {
+			t.Fatalf("Failed to iterate log: %v", err)
+		}
+		n := 0
+		for iter.HasNext() {
+			if _, err := iter.Next(); err != nil {
+				t.Fatalf("Failed to read log: %v", err)
+			}
+			n++
+		}
+		return n
+	}
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+	blk, err := tx.Append("nulllogtestfile")
+	if err != nil {
+		t.Fatalf("Failed to append block: %v", err)
+	}
+	recordPage, err := record.NewRecordPage(tx, blk, layout)
+	if err != nil {
+		t.Fatalf("Failed to create record page: %v", err)
+	}
+	if err = recordPage.Format(); err != nil {
+		t.Fatalf("Failed to format record page: %v", err)
+	}
+	slot, err := recordPage.InsertAfter(-1)
+	if err != nil {
+		t.Fatalf("Failed to insert record: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		set  func() error
+		// want 書き込みで増えるログのレコードの数
+		want int
+	}{
+		{name: "int", set: func() error { return recordPage.SetInt(slot, "A", 1) }, want: 1},
+		{name: "string", set: func() error { return recordPage.SetString(slot, "B", "rec1") }, want: 1},
+		{name: "null", set: func() error { return recordPage.SetNull(slot, "B") }, want: 1},
+		{name: "null again", set: func() error { return recordPage.SetNull(slot, "B") }, want: 0},
+		{name: "string after null", set: func() error { return recordPage.SetString(slot, "B", "rec2") }, want: 2},
+		{name: "string again", set: func() error { return recordPage.SetString(slot, "B", "rec3") }, want: 1},
+	} {
+		before := logCount()
+		if err := tt.set(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := logCount() - before; got != tt.want {
+			t.Errorf("%s: wrote %d log records, want %d", tt.name, got, tt.want)
+		}
+	}
+	tx.Unpin(blk)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+}
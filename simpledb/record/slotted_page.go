@@ -0,0 +1,559 @@
+package record
+
+import (
+	"cmp"
+	"errors"
+	"simpledb/file"
+	"slices"
+)
+
+// スロット形式のブロック
+//
+//	| numSlots | used | slot 0 | slot 1 | ... | 空き領域 | record | ... | record |
+//
+// スロットは状態、レコードの位置、レコードの長さからなる。used はブロックの末尾からレコードが使っているバイト数
+// 全て 0 のブロックは空のブロックなので、ClearBlock で空にしたブロックもそのまま使える
+// レコードは NULL のビット、固定長の列、文字列の順に並ぶ。VARCHAR の列には文字列のレコードの中の位置を格納し、空文字列は 0 で表す
+// オーバーフローファイルに格納した文字列は、連鎖の先頭のブロック番号を負にして表す
+const (
+	numSlotsPos       = 0
+	usedPos           = file.Int32Bytes
+	slottedHeaderSize = 2 * file.Int32Bytes
+	slotEntrySize     = 3 * file.Int32Bytes
+	// minRecordSize 別のブロックに移したレコードの RID を格納できる大きさ
+	minRecordSize = 2 * file.Int32Bytes
+)
+
+var (
+	// ErrPageFull レコードがブロックの空き領域に収まらない
+	ErrPageFull = errors.New("record does not fit in the block")
+	// ErrRecordTooLarge レコードが空のブロックにも収まらない
+	ErrRecordTooLarge = errors.New("record is too large for a block")
+)
+
+func (rp *RecordPage) slotted() bool {
+	return rp.layout.Format() == SlottedFormat
+}
+
+func slotEntryPos(slot int32) int32 {
+	return slottedHeaderSize + slot*slotEntrySize
+}
+
+func (rp *RecordPage) numSlots() (int32, error) {
+	return rp.tx.GetInt(rp.blk, numSlotsPos)
+}
+
+// recordStart 最も前にあるレコードの位置。空き領域はスロットの目録の後からここまで
+func (rp *RecordPage) recordStart() (int32, error) {
+	used, err := rp.tx.GetInt(rp.blk, usedPos)
+	if err != nil {
+		return 0, err
+	}
+	return rp.tx.BlockSize() - used, nil
+}
+
+func (rp *RecordPage) slotFlag(slot int32) (InUseFlag, error) {
+	flag, err := rp.tx.GetInt(rp.blk, slotEntryPos(slot))
+	return InUseFlag(flag), err
+}
+
+func (rp *RecordPage) setSlotFlag(slot int32, flag InUseFlag) error {
+	return rp.tx.SetInt(rp.blk, slotEntryPos(slot), int32(flag), true)
+}
+
+// slotRecord スロット slot のレコードの位置と長さ
+func (rp *RecordPage) slotRecord(slot int32) (int32, int32, error) {
+	pos, err := rp.tx.GetInt(rp.blk, slotEntryPos(slot)+file.Int32Bytes)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := rp.tx.GetInt(rp.blk, slotEntryPos(slot)+2*file.Int32Bytes)
+	if err != nil {
+		return 0, 0, err
+	}
+	return pos, length, nil
+}
+
+func (rp *RecordPage) setSlot(slot int32, flag InUseFlag, pos int32, length int32) error {
+	if err := rp.setSlotFlag(slot, flag); err != nil {
+		return err
+	}
+	return rp.setSlotRecord(slot, pos, length)
+}
+
+func (rp *RecordPage) setSlotRecord(slot int32, pos int32, length int32) error {
+	if err := rp.tx.SetInt(rp.blk, slotEntryPos(slot)+file.Int32Bytes, pos, true); err != nil {
+		return err
+	}
+	return rp.tx.SetInt(rp.blk, slotEntryPos(slot)+2*file.Int32Bytes, length, true)
+}
+
+// maxRecordSize スロットが1つだけのブロックに格納できるレコードの大きさ
+func (rp *RecordPage) maxRecordSize() int32 {
+	return rp.tx.BlockSize() - slotEntryPos(1)
+}
+
+func (rp *RecordPage) slottedSearchAfter(slot int32, flag InUseFlag) (int32, error) {
+	if flag == Empty {
+		newSlot, appending, err := rp.emptySlot(slot)
+		if err != nil {
+			return 0, err
+		}
+		need := rp.layout.SlotSize()
+		if appending {
+			need += slotEntrySize
+		}
+		_, total, err := rp.freeSpace(-1)
+		if err != nil {
+			return 0, err
+		}
+		if total < need {
+			return -1, nil
+		}
+		return newSlot, nil
+	}
+
+	n, err := rp.numSlots()
+	if err != nil {
+		return 0, err
+	}
+	for s := slot + 1; s < n; s++ {
+		f, err := rp.slotFlag(s)
+		if err != nil {
+			return 0, err
+		}
+		if f == flag || (flag == Used && f == Forwarded) {
+			return s, nil
+		}
+	}
+	return -1, nil
+}
+
+// emptySlot スロット slot の後の空いているスロット。なければ目録に追加するスロットを返し、appending を true にする
+func (rp *RecordPage) emptySlot(slot int32) (newSlot int32, appending bool, err error) {
+	n, err := rp.numSlots()
+	if err != nil {
+		return 0, false, err
+	}
+	for s := slot + 1; s < n; s++ {
+		f, err := rp.slotFlag(s)
+		if err != nil {
+			return 0, false, err
+		}
+		if f == Empty {
+			return s, false, nil
+		}
+	}
+	return n, true, nil
+}
+
+// slottedInsertAfter 全ての列が 0 と空文字列のレコードを挿入する
+func (rp *RecordPage) slottedInsertAfter(slot int32) (int32, error) {
+	newSlot, appending, err := rp.emptySlot(slot)
+	if err != nil {
+		return 0, err
+	}
+	size := rp.layout.SlotSize()
+	pos, err := rp.allocate(size, appending, -1)
+	if err != nil || pos < 0 {
+		return -1, err
+	}
+	if err := rp.tx.SetBytes(rp.blk, pos, make([]byte, size), true); err != nil {
+		return 0, err
+	}
+	if err := rp.setSlot(newSlot, Used, pos, size); err != nil {
+		return 0, err
+	}
+	return newSlot, nil
+}
+
+// InsertImage スロット形式で、RecordImage で作ったレコード image を状態 flag で挿入する。ブロックに収まらなければ -1 を返す
+func (rp *RecordPage) InsertImage(image []byte, flag InUseFlag) (int32, error) {
+	slot, appending, err := rp.emptySlot(-1)
+	if err != nil {
+		return 0, err
+	}
+	pos, err := rp.allocate(int32(len(image)), appending, -1)
+	if err != nil || pos < 0 {
+		return -1, err
+	}
+	if err := rp.tx.SetBytes(rp.blk, pos, image, true); err != nil {
+		return 0, err
+	}
+	if err := rp.setSlot(slot, flag, pos, int32(len(image))); err != nil {
+		return 0, err
+	}
+	return slot, nil
+}
+
+// RecordImage スロット形式で、スロット slot のレコードの列 fieldName の値を文字列 val にしたレコードのバイト列
+// オーバーフローファイルに格納した他の列の文字列は、連鎖の先頭のブロック番号をそのまま引き継ぐ
+func (rp *RecordPage) RecordImage(slot int32, fieldName string, val string) ([]byte, error) {
+	return rp.recordImage(slot, fieldName, val, 0)
+}
+
+// recordImage overflow が 0 でなければ、列 fieldName にはオーバーフローファイルのブロック overflow から始まる連鎖を格納する
+func (rp *RecordPage) recordImage(slot int32, fieldName string, val string, overflow int32) ([]byte, error) {
+	pos, _, err := rp.slotRecord(slot)
+	if err != nil {
+		return nil, err
+	}
+	fixed, err := rp.tx.GetBytes(rp.blk, pos, rp.layout.SlotSize())
+	if err != nil {
+		return nil, err
+	}
+	fixedPage := file.NewPageWith(fixed)
+
+	schema := rp.layout.Schema()
+	encoding := rp.tx.Encoding()
+	strs := make(map[string]string)
+	size := rp.layout.SlotSize()
+	for _, f := range schema.Fields() {
+		if schema.Type(f) != VARCHAR {
+			continue
+		}
+		if f == fieldName && overflow != 0 {
+			continue
+		}
+		if f != fieldName && fixedPage.GetInt(rp.layout.Offset(f)) < 0 {
+			continue
+		}
+		s := val
+		if f != fieldName {
+			if s, err = rp.GetString(slot, f); err != nil {
+				return nil, err
+			}
+		}
+		strs[f] = s
+		if s != "" {
+			size += encoding.StringBytes(s)
+		}
+	}
+
+	image := make([]byte, size)
+	p := file.NewPageWithEncoding(image, encoding)
+	p.WriteBytes(0, fixed)
+	strPos := rp.layout.SlotSize()
+	for _, f := range schema.Fields() {
+		s, ok := strs[f]
+		if !ok {
+			continue
+		}
+		if s == "" {
+			p.SetInt(rp.layout.Offset(f), 0)
+			continue
+		}
+		p.SetInt(rp.layout.Offset(f), strPos)
+		p.SetString(strPos, s)
+		strPos += encoding.StringBytes(s)
+	}
+	if overflow != 0 {
+		p.SetInt(rp.layout.Offset(fieldName), -overflow)
+	}
+	p.SetInt(0, p.GetInt(0)&^rp.layout.NullMask(fieldName))
+	return image, nil
+}
+
+// setSlottedString overflow が 0 でなければ、列 fieldName にはオーバーフローファイルのブロック overflow から始まる連鎖を格納する
+// 列の元の文字列をオーバーフローファイルに格納していれば、書き換えた後に解放する
+func (rp *RecordPage) setSlottedString(slot int32, fieldName string, val string, overflow int32) error {
+	old, err := rp.overflowBlock(slot, fieldName)
+	if err != nil {
+		return err
+	}
+	image, err := rp.recordImage(slot, fieldName, val, overflow)
+	if err != nil {
+		return err
+	}
+	size := int32(len(image))
+	if size > rp.maxRecordSize() {
+		return ErrRecordTooLarge
+	}
+	pos, length, err := rp.slotRecord(slot)
+	if err != nil {
+		return err
+	}
+	// 今の領域に収まらなければ、空き領域に移す。元の領域は空き領域を詰める時に回収する
+	if size > length {
+		if pos, err = rp.allocate(size, false, slot); err != nil {
+			return err
+		}
+		if pos < 0 {
+			return ErrPageFull
+		}
+	}
+	if err := rp.tx.SetBytes(rp.blk, pos, image, true); err != nil {
+		return err
+	}
+	if err := rp.setSlotRecord(slot, pos, size); err != nil {
+		return err
+	}
+	if old == 0 {
+		return nil
+	}
+	return overflowOf(rp.tx, rp.blk.FileName).Free(old)
+}
+
+// NeedsOverflow スロット形式で、文字列 val をレコードではなくオーバーフローファイルに格納するか
+// 閾値以下の文字列だけをレコードに格納すれば、レコードは必ず1つのブロックに収まる
+func (rp *RecordPage) NeedsOverflow(val string) bool {
+	if !rp.slotted() || val == "" {
+		return false
+	}
+	return rp.tx.Encoding().StringBytes(val) > rp.overflowThreshold()
+}
+
+// overflowThreshold レコードに格納する文字列の大きさの上限。ブロックの 1/4 か、VARCHAR の列で空き領域を等分した大きさ
+func (rp *RecordPage) overflowThreshold() int32 {
+	schema := rp.layout.Schema()
+	var n int32
+	for _, f := range schema.Fields() {
+		if schema.Type(f) == VARCHAR {
+			n++
+		}
+	}
+	threshold := rp.tx.BlockSize() / 4
+	if n > 0 {
+		threshold = min(threshold, (rp.maxRecordSize()-rp.layout.SlotSize())/n)
+	}
+	return threshold
+}
+
+// SetOverflowString スロット形式で、列 fieldName の文字列 val をオーバーフローファイルに格納し、レコードには連鎖の先頭のブロック番号を格納する
+// レコードは元の大きさより小さくなるので、今の領域に収まる
+func (rp *RecordPage) SetOverflowString(slot int32, fieldName string, val string) error {
+	if err := rp.checkLength(fieldName, val); err != nil {
+		return err
+	}
+	if !rp.slotted() {
+		return rp.SetString(slot, fieldName, val)
+	}
+	overflow, err := overflowOf(rp.tx, rp.blk.FileName).Write(val)
+	if err != nil {
+		return err
+	}
+	return rp.setSlottedString(slot, fieldName, val, overflow)
+}
+
+// FreeOverflow スロット形式で、列 fieldName の文字列をオーバーフローファイルに格納していれば解放し、列を空文字列にする
+func (rp *RecordPage) FreeOverflow(slot int32, fieldName string) error {
+	old, err := rp.overflowBlock(slot, fieldName)
+	if err != nil || old == 0 {
+		return err
+	}
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return err
+	}
+	if err := rp.tx.SetInt(rp.blk, pos+rp.layout.Offset(fieldName), 0, true); err != nil {
+		return err
+	}
+	return overflowOf(rp.tx, rp.blk.FileName).Free(old)
+}
+
+// overflowBlock スロット形式で、列 fieldName の文字列を格納したオーバーフローファイルの連鎖の先頭のブロック。レコードに格納していれば 0
+func (rp *RecordPage) overflowBlock(slot int32, fieldName string) (int32, error) {
+	pos, err := rp.recordPos(slot)
+	if err != nil {
+		return 0, err
+	}
+	strPos, err := rp.tx.GetInt(rp.blk, pos+rp.layout.Offset(fieldName))
+	if err != nil || strPos >= 0 {
+		return 0, err
+	}
+	return -strPos, nil
+}
+
+// freeOverflows スロット形式で、レコードの文字列を格納したオーバーフローファイルの連鎖を全て解放する
+// 別のブロックに移したスロットはレコードを持たないので、何もしない
+func (rp *RecordPage) freeOverflows(slot int32) error {
+	flag, err := rp.slotFlag(slot)
+	if err != nil || (flag != Used && flag != Moved) {
+		return err
+	}
+	schema := rp.layout.Schema()
+	for _, f := range schema.Fields() {
+		if schema.Type(f) != VARCHAR {
+			continue
+		}
+		old, err := rp.overflowBlock(slot, f)
+		if err != nil {
+			return err
+		}
+		if old == 0 {
+			continue
+		}
+		if err := overflowOf(rp.tx, rp.blk.FileName).Free(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forward スロット形式で、スロット slot のレコードを移した先の RID。移していなければ nil
+func (rp *RecordPage) Forward(slot int32) (*RID, error) {
+	if !rp.slotted() {
+		return nil, nil
+	}
+	flag, err := rp.slotFlag(slot)
+	if err != nil || flag != Forwarded {
+		return nil, err
+	}
+	pos, _, err := rp.slotRecord(slot)
+	if err != nil {
+		return nil, err
+	}
+	blockNum, err := rp.tx.GetInt(rp.blk, pos)
+	if err != nil {
+		return nil, err
+	}
+	s, err := rp.tx.GetInt(rp.blk, pos+file.Int32Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewRID(blockNum, s), nil
+}
+
+// SetForward スロット形式で、スロット slot のレコードを RID rid に移したことを記録する
+// レコードは minRecordSize 以上の大きさがあるので、移した先の RID はレコードの領域に収まる
+func (rp *RecordPage) SetForward(slot int32, rid *RID) error {
+	pos, _, err := rp.slotRecord(slot)
+	if err != nil {
+		return err
+	}
+	if err := rp.tx.SetInt(rp.blk, pos, rid.BlockNumber(), true); err != nil {
+		return err
+	}
+	if err := rp.tx.SetInt(rp.blk, pos+file.Int32Bytes, rid.Slot(), true); err != nil {
+		return err
+	}
+	return rp.setSlot(slot, Forwarded, pos, minRecordSize)
+}
+
+// freeSpace スロットの目録の後の連続した空き領域の大きさ gap と、
+// スロット exclude 以外のレコードを詰めた時の空き領域の大きさ total
+func (rp *RecordPage) freeSpace(exclude int32) (gap int32, total int32, err error) {
+	n, err := rp.numSlots()
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := rp.recordStart()
+	if err != nil {
+		return 0, 0, err
+	}
+	total = rp.tx.BlockSize() - slotEntryPos(n)
+	for s := int32(0); s < n; s++ {
+		if s == exclude {
+			continue
+		}
+		flag, err := rp.slotFlag(s)
+		if err != nil {
+			return 0, 0, err
+		}
+		if flag == Empty {
+			continue
+		}
+		_, length, err := rp.slotRecord(s)
+		if err != nil {
+			return 0, 0, err
+		}
+		total -= length
+	}
+	return start - slotEntryPos(n), total, nil
+}
+
+// allocate 空き領域の末尾に size バイトを確保し、その位置を返す。appending なら目録に追加するスロットの分も確保する
+// 連続した空き領域が足りなければ、スロット exclude 以外のレコードを詰めてから確保する。それでも足りなければ -1 を返す
+func (rp *RecordPage) allocate(size int32, appending bool, exclude int32) (int32, error) {
+	need := size
+	if appending {
+		need += slotEntrySize
+	}
+	gap, total, err := rp.freeSpace(exclude)
+	if err != nil {
+		return 0, err
+	}
+	if total < need {
+		return -1, nil
+	}
+	if gap < need {
+		if err := rp.compact(exclude); err != nil {
+			return 0, err
+		}
+	}
+	start, err := rp.recordStart()
+	if err != nil {
+		return 0, err
+	}
+	pos := start - size
+	if err := rp.tx.SetInt(rp.blk, usedPos, rp.tx.BlockSize()-pos, true); err != nil {
+		return 0, err
+	}
+	if appending {
+		n, err := rp.numSlots()
+		if err != nil {
+			return 0, err
+		}
+		if err := rp.tx.SetInt(rp.blk, numSlotsPos, n+1, true); err != nil {
+			return 0, err
+		}
+	}
+	return pos, nil
+}
+
+// compact スロット exclude 以外の使われているレコードを、ブロックの末尾に隙間なく詰め直す
+func (rp *RecordPage) compact(exclude int32) error {
+	type record struct {
+		slot, pos, length int32
+	}
+	n, err := rp.numSlots()
+	if err != nil {
+		return err
+	}
+	var records []record
+	for s := int32(0); s < n; s++ {
+		flag, err := rp.slotFlag(s)
+		if err != nil {
+			return err
+		}
+		if s == exclude || flag == Empty {
+			continue
+		}
+		pos, length, err := rp.slotRecord(s)
+		if err != nil {
+			return err
+		}
+		records = append(records, record{s, pos, length})
+	}
+	// 後ろにあるレコードから順に末尾に詰める
+	slices.SortFunc(records, func(a, b record) int {
+		return cmp.Compare(b.pos, a.pos)
+	})
+
+	blockSize := rp.tx.BlockSize()
+	area := make([]byte, blockSize)
+	start := blockSize
+	moved := make(map[int32]int32)
+	for _, r := range records {
+		image, err := rp.tx.GetBytes(rp.blk, r.pos, r.length)
+		if err != nil {
+			return err
+		}
+		start -= r.length
+		copy(area[start:], image)
+		if start != r.pos {
+			moved[r.slot] = start
+		}
+	}
+	if err := rp.tx.SetBytes(rp.blk, start, area[start:], true); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if pos, ok := moved[r.slot]; ok {
+			if err := rp.setSlotRecord(r.slot, pos, r.length); err != nil {
+				return err
+			}
+		}
+	}
+	return rp.tx.SetInt(rp.blk, usedPos, blockSize-start, true)
+}
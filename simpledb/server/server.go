@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"time"
 
 	"simpledb/buffer"
 	"simpledb/file"
@@ -9,6 +10,7 @@ import (
 	"simpledb/metadata"
 	"simpledb/plan"
 	"simpledb/tx"
+	"simpledb/tx/concurrency"
 	"simpledb/util/logger"
 )
 
@@ -16,17 +18,45 @@ const BlockSize = 400
 const BufferSize = 8
 const logFile = "simpledb.log"
 
+// 問い合わせと更新の計画を立てる方式
+const (
+	// BasicPlanner BasicQueryPlanner と BasicUpdatePlanner
+	BasicPlanner = "basic"
+	// HeuristicPlanner HeuristicQueryPlanner と IndexUpdatePlanner
+	HeuristicPlanner = "heuristic"
+)
+
+// Options データベースを開く時の設定。0 の値の項目は既定値を使う
+type Options struct {
+	// BlockSize 既定値は、既存のデータベースではコントロールファイルに記録された大きさ、新しいデータベースでは BlockSize
+	BlockSize int32
+	// BufferSize 既定値は BufferSize
+	BufferSize int32
+	// Encoding 新しいデータベースの文字列の符号化方式。既存のデータベースでは無視する
+	Encoding file.Encoding
+	// Planner 既定値は BasicPlanner
+	Planner string
+	// LockTimeout 既定値は concurrency.DefaultLockTimeout
+	LockTimeout time.Duration
+}
+
 type SimpleDB struct {
 	fileManager     *file.Manager
 	logManager      *log.Manager
 	bufferManager   *buffer.Manager
 	metadataManager *metadata.Manager
 	planner         *plan.Planner
+	lockTimeout     time.Duration
 }
 
 // A constructor useful for debugging
 func NewSimpleDB(dbDir string, blockSize, bufferSize int32) (*SimpleDB, error) {
-	fileManager, err := file.NewManager(dbDir, blockSize)
+	return NewSimpleDBWithEncoding(dbDir, blockSize, bufferSize, file.UTF16)
+}
+
+// NewSimpleDBWithEncoding 新しいデータベースでは文字列を encoding で格納する。既存のデータベースではヘッダに記録された符号化方式を使う
+func NewSimpleDBWithEncoding(dbDir string, blockSize, bufferSize int32, encoding file.Encoding) (*SimpleDB, error) {
+	fileManager, err := file.NewManagerWithEncoding(dbDir, blockSize, encoding)
 	if err != nil {
 		return nil, fmt.Errorf("file.NewManager: %w", err)
 	}
@@ -41,24 +71,54 @@ func NewSimpleDB(dbDir string, blockSize, bufferSize int32) (*SimpleDB, error) {
 		fileManager:   fileManager,
 		logManager:    logManager,
 		bufferManager: bufferManager,
+		lockTimeout:   concurrency.DefaultLockTimeout,
 	}, nil
 }
 
 func NewSimpleDBWithMetadata(dirname string) (*SimpleDB, error) {
-	return newSimpleDBWithMetadata(dirname, true, BufferSize)
+	return NewSimpleDBWithOptions(dirname, Options{Planner: BasicPlanner})
 }
 
 func NewOptimizedSimpleDB(dirname string) (*SimpleDB, error) {
-	return newSimpleDBWithMetadata(dirname, false, 10000)
+	return NewOptimizedSimpleDBWithEncoding(dirname, file.UTF16)
+}
+
+// NewOptimizedSimpleDBWithEncoding NewOptimizedSimpleDB と同じだが、新しいデータベースでは文字列を encoding で格納する
+func NewOptimizedSimpleDBWithEncoding(dirname string, encoding file.Encoding) (*SimpleDB, error) {
+	return NewSimpleDBWithOptions(dirname, Options{BufferSize: 10000, Encoding: encoding, Planner: HeuristicPlanner})
 }
 
-func newSimpleDBWithMetadata(dirname string, useBasic bool, bufferSize int32) (*SimpleDB, error) {
+// NewSimpleDBWithOptions 設定 opts でデータベースを開く。既存のデータベースは回復してから開く
+func NewSimpleDBWithOptions(dirname string, opts Options) (*SimpleDB, error) {
 	logger := logger.New("server.SimpleDB", logger.Trace)
 
-	db, err := NewSimpleDB(dirname, BlockSize, bufferSize)
+	useBasic, err := useBasicPlanner(opts.Planner)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := opts.BlockSize
+	if blockSize == 0 {
+		control, err := file.ReadControl(dirname)
+		if err != nil {
+			return nil, fmt.Errorf("file.ReadControl: %w", err)
+		}
+		blockSize = control.BlockSize
+		if blockSize == 0 {
+			blockSize = BlockSize
+		}
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize == 0 {
+		bufferSize = BufferSize
+	}
+
+	db, err := NewSimpleDBWithEncoding(dirname, blockSize, bufferSize, opts.Encoding)
 	if err != nil {
 		return nil, fmt.Errorf("SimpleDB: %w", err)
 	}
+	if opts.LockTimeout != 0 {
+		db.lockTimeout = opts.LockTimeout
+	}
 	tx, err := db.NewTx()
 	if err != nil {
 		return nil, fmt.Errorf("db.NewTx: %w", err)
@@ -95,13 +155,26 @@ func newSimpleDBWithMetadata(dirname string, useBasic bool, bufferSize int32) (*
 }
 
 func (db *SimpleDB) NewTx() (*tx.Transaction, error) {
-	return tx.New(
+	return tx.NewWithLockTimeout(
 		db.fileManager,
 		db.logManager,
 		db.bufferManager,
+		db.lockTimeout,
 	)
 }
 
+// useBasicPlanner 方式 planner が BasicPlanner か
+func useBasicPlanner(planner string) (bool, error) {
+	switch planner {
+	case "", BasicPlanner:
+		return true, nil
+	case HeuristicPlanner:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown planner %q", planner)
+	}
+}
+
 func (db *SimpleDB) FileManager() *file.Manager {
 	return db.fileManager
 }
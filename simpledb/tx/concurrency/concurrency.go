@@ -1,16 +1,27 @@
 package concurrency
 
-import "simpledb/file"
+import (
+	"time"
+
+	"simpledb/file"
+)
 
 var lockTable = newLockTable()
 
 type Manager struct {
-	locks map[file.BlockID]string
+	locks   map[file.BlockID]string
+	timeout time.Duration
 }
 
 func New() *Manager {
+	return NewWithTimeout(DefaultLockTimeout)
+}
+
+// NewWithTimeout ロックを timeout まで待ち、取れなければ ErrTimeout を返す
+func NewWithTimeout(timeout time.Duration) *Manager {
 	return &Manager{
-		locks: make(map[file.BlockID]string),
+		locks:   make(map[file.BlockID]string),
+		timeout: timeout,
 	}
 }
 
@@ -19,7 +30,7 @@ func (m *Manager) SLock(blockID file.BlockID) error {
 		return nil
 	}
 
-	err := lockTable.SLock(blockID)
+	err := lockTable.SLock(blockID, m.timeout)
 	if err != nil {
 		return err
 	}
@@ -38,7 +49,7 @@ func (m *Manager) XLock(blockID file.BlockID) error {
 		return err
 	}
 
-	err = lockTable.XLock(blockID)
+	err = lockTable.XLock(blockID, m.timeout)
 	if err != nil {
 		return err
 	}
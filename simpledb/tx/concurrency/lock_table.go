@@ -8,7 +8,8 @@ import (
 	"simpledb/file"
 )
 
-const maxLockTime = 10 * time.Second
+// DefaultLockTimeout ロックを待つ時間の既定値
+const DefaultLockTimeout = 10 * time.Second
 
 var ErrTimeout = fmt.Errorf("timeout error")
 
@@ -24,36 +25,36 @@ func newLockTable() *LockTable {
 	}
 }
 
-func (l *LockTable) SLock(blockID file.BlockID) error {
+func (l *LockTable) SLock(blockID file.BlockID, timeout time.Duration) error {
 	l.cond.L.Lock()
 	defer l.cond.L.Unlock()
 
 	startTime := time.Now()
 	for {
-		if time.Since(startTime) > maxLockTime {
+		if time.Since(startTime) > timeout {
 			return ErrTimeout
 		} else if !l.hasXLock(blockID) {
 			break
 		}
-		l.waitWithTimeout(maxLockTime)
+		l.waitWithTimeout(timeout)
 	}
 
 	l.locks[blockID]++
 	return nil
 }
 
-func (l *LockTable) XLock(blockID file.BlockID) error {
+func (l *LockTable) XLock(blockID file.BlockID, timeout time.Duration) error {
 	l.cond.L.Lock()
 	defer l.cond.L.Unlock()
 
 	startTime := time.Now()
 	for {
-		if time.Since(startTime) > maxLockTime {
+		if time.Since(startTime) > timeout {
 			return ErrTimeout
 		} else if !l.hasOtherSLocks(blockID) {
 			break
 		}
-		l.waitWithTimeout(maxLockTime)
+		l.waitWithTimeout(timeout)
 	}
 
 	l.locks[blockID] = -1
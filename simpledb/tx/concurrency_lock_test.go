@@ -1,6 +1,7 @@
 package tx_test
 
 import (
+	"errors"
 	"path"
 	"sync"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"simpledb/file"
 	"simpledb/server"
 	"simpledb/tx"
+	"simpledb/tx/concurrency"
 )
 
 func TestConcurrencySLockTimeout(t *testing.T) {
@@ -164,3 +166,50 @@ func TestConcurrencyXLockTimeout(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestConcurrencyLockTimeoutOption(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "concurrencytest"), 400, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := db.FileManager()
+	lm := db.LogManager()
+	bm := db.BufferManager()
+
+	txA, err := tx.New(fm, lm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ロック表は全てのデータベースで共有するので、他のテストと異なるファイルを使う
+	blk1 := file.NewBlockID("locktimeoutfile", 1)
+	if err := txA.Pin(blk1); err != nil {
+		t.Fatal(err)
+	}
+	if err := txA.SetInt(blk1, 0, 0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// 既定の 10 秒ではなく、指定した時間だけ待つ
+	txB, err := tx.NewWithLockTimeout(fm, lm, bm, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txB.Pin(blk1); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := txB.GetInt(blk1, 0); !errors.Is(err, concurrency.ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %v", elapsed)
+	}
+	if err := txB.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := txA.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
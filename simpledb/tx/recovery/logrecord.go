@@ -2,6 +2,7 @@ package recovery
 
 import (
 	"fmt"
+	"slices"
 
 	"simpledb/file"
 	"simpledb/log"
@@ -16,6 +17,7 @@ const (
 	Rollback
 	SetInt
 	SetString
+	SetBytes
 )
 
 type LogRecord interface {
@@ -24,8 +26,9 @@ type LogRecord interface {
 	Undo(tx Transaction) error
 }
 
-func NewLogRecord(bytes []byte) (LogRecord, error) {
-	p := file.NewPageWith(bytes)
+// NewLogRecord ログのバイト列 bytes からログレコードを作る。文字列は encoding で読む
+func NewLogRecord(bytes []byte, encoding file.Encoding) (LogRecord, error) {
+	p := file.NewPageWithEncoding(bytes, encoding)
 	switch LogRecordType(p.GetInt(0)) {
 	case CheckPoint:
 		return newCheckPointRecord(), nil
@@ -39,6 +42,8 @@ func NewLogRecord(bytes []byte) (LogRecord, error) {
 		return newSetIntRecordFrom(p), nil
 	case SetString:
 		return newSetStringRecordFrom(p), nil
+	case SetBytes:
+		return newSetBytesRecordFrom(p), nil
 	default:
 		return nil, fmt.Errorf("Unknown LogRecordType: %v", p.GetInt(0))
 	}
@@ -220,7 +225,7 @@ func newSetIntRecordFrom(p *file.Page) *setIntRecord {
 
 	fpos := tpos + file.Int32Bytes
 	fileName := p.GetString(fpos)
-	bpos := fpos + file.MaxLength(int32(len(fileName)))
+	bpos := fpos + p.Encoding().MaxLength(int32(len(fileName)))
 	blkNum := p.GetInt(bpos)
 	blk := file.NewBlockID(fileName, blkNum)
 
@@ -258,15 +263,16 @@ func (r *setIntRecord) Undo(tx Transaction) error {
 }
 
 func (r *setIntRecord) WriteToLog(lm *log.Manager) (int32, error) {
+	enc := lm.Encoding()
 	tpos := file.Int32Bytes
 	fpos := tpos + file.Int32Bytes
-	bpos := fpos + file.MaxLength(int32(len(r.blk.FileName)))
+	bpos := fpos + enc.MaxLength(int32(len(r.blk.FileName)))
 	opos := bpos + file.Int32Bytes
 	vpos := opos + file.Int32Bytes
 
 	reclen := vpos + file.Int32Bytes
 	buf := make([]byte, reclen)
-	p := file.NewPageWith(buf)
+	p := file.NewPageWithEncoding(buf, enc)
 	p.SetInt(0, int32(SetInt))
 	p.SetInt(tpos, r.txnum)
 	p.SetString(fpos, r.blk.FileName)
@@ -299,7 +305,7 @@ func newSetStringRecordFrom(p *file.Page) *setStringRecord {
 
 	fpos := tpos + file.Int32Bytes
 	fileName := p.GetString(fpos)
-	bpos := fpos + file.MaxLength(int32(len(fileName)))
+	bpos := fpos + p.Encoding().MaxLength(int32(len(fileName)))
 	blkNum := p.GetInt(bpos)
 	blk := file.NewBlockID(fileName, blkNum)
 
@@ -337,15 +343,16 @@ func (r *setStringRecord) String() string {
 }
 
 func (r *setStringRecord) WriteToLog(lm *log.Manager) (int32, error) {
+	enc := lm.Encoding()
 	tpos := file.Int32Bytes
 	fpos := tpos + file.Int32Bytes
-	bpos := fpos + file.MaxLength(int32(len(r.blk.FileName)))
+	bpos := fpos + enc.MaxLength(int32(len(r.blk.FileName)))
 	opos := bpos + file.Int32Bytes
 	vpos := opos + file.Int32Bytes
 
-	reclen := vpos + file.MaxLength(int32(len(r.val)))
+	reclen := vpos + enc.MaxLength(int32(len(r.val)))
 	buf := make([]byte, reclen)
-	p := file.NewPageWith(buf)
+	p := file.NewPageWithEncoding(buf, enc)
 	p.SetInt(0, int32(SetString))
 	p.SetInt(tpos, r.txnum)
 	p.SetString(fpos, r.blk.FileName)
@@ -355,3 +362,84 @@ func (r *setStringRecord) WriteToLog(lm *log.Manager) (int32, error) {
 
 	return lm.Append(buf)
 }
+
+// setBytesRecord 書き込む前のバイト列をそのまま残す。スロット形式のページでレコードを移す時に使う
+type setBytesRecord struct {
+	txnum  int32
+	offset int32
+	val    []byte
+	blk    file.BlockID
+}
+
+func newSetBytesRecord(txnum int32, blk file.BlockID, offset int32, val []byte) *setBytesRecord {
+	return &setBytesRecord{
+		txnum:  txnum,
+		offset: offset,
+		val:    val,
+		blk:    blk,
+	}
+}
+
+func newSetBytesRecordFrom(p *file.Page) *setBytesRecord {
+	tpos := file.Int32Bytes
+	txNum := p.GetInt(tpos)
+
+	fpos := tpos + file.Int32Bytes
+	fileName := p.GetString(fpos)
+	bpos := fpos + p.Encoding().MaxLength(int32(len(fileName)))
+	blkNum := p.GetInt(bpos)
+	blk := file.NewBlockID(fileName, blkNum)
+
+	opos := bpos + file.Int32Bytes
+	offset := p.GetInt(opos)
+
+	vpos := opos + file.Int32Bytes
+	val := slices.Clone(p.GetBytes(vpos))
+
+	return newSetBytesRecord(txNum, blk, offset, val)
+}
+
+func (r *setBytesRecord) Op() LogRecordType {
+	return SetBytes
+}
+
+func (r *setBytesRecord) TxNumber() int32 {
+	return r.txnum
+}
+
+func (r *setBytesRecord) Undo(tx Transaction) error {
+	if err := tx.Pin(r.blk); err != nil {
+		return fmt.Errorf("Pin: %w", err)
+	}
+	if err := tx.SetBytes(r.blk, r.offset, r.val, false); err != nil {
+		return fmt.Errorf("SetBytes: %w", err)
+	}
+	tx.Unpin(r.blk)
+
+	return nil
+}
+
+func (r *setBytesRecord) String() string {
+	return fmt.Sprintf("<SETBYTES %d %v %d %d>", r.txnum, r.blk, r.offset, len(r.val))
+}
+
+func (r *setBytesRecord) WriteToLog(lm *log.Manager) (int32, error) {
+	enc := lm.Encoding()
+	tpos := file.Int32Bytes
+	fpos := tpos + file.Int32Bytes
+	bpos := fpos + enc.MaxLength(int32(len(r.blk.FileName)))
+	opos := bpos + file.Int32Bytes
+	vpos := opos + file.Int32Bytes
+
+	reclen := vpos + file.Int32Bytes + int32(len(r.val))
+	buf := make([]byte, reclen)
+	p := file.NewPageWithEncoding(buf, enc)
+	p.SetInt(0, int32(SetBytes))
+	p.SetInt(tpos, r.txnum)
+	p.SetString(fpos, r.blk.FileName)
+	p.SetInt(bpos, int32(r.blk.Number))
+	p.SetInt(opos, r.offset)
+	p.SetBytes(vpos, r.val)
+
+	return lm.Append(buf)
+}
@@ -12,6 +12,7 @@ type Transaction interface {
 	Pin(blockID file.BlockID) error
 	SetString(blockID file.BlockID, offset int32, val string, logRecord bool) error
 	SetInt(blockID file.BlockID, offset int32, val int32, logRecord bool) error
+	SetBytes(blockID file.BlockID, offset int32, val []byte, logRecord bool) error
 	Unpin(blockID file.BlockID)
 }
 
@@ -85,6 +86,12 @@ func (m *Manager) SetString(buf *buffer.Buffer, offset int32, newVal string) (in
 	return newSetStringRecord(m.txnum, blk, offset, oldVal).WriteToLog(m.logMgr)
 }
 
+func (m *Manager) SetBytes(buf *buffer.Buffer, offset int32, newVal []byte) (int32, error) {
+	oldVal := buf.Contents().ReadBytes(offset, int32(len(newVal)))
+	blk := buf.Block()
+	return newSetBytesRecord(m.txnum, blk, offset, oldVal).WriteToLog(m.logMgr)
+}
+
 func (m *Manager) doRollback() error {
 	it, err := m.logMgr.Iterator()
 	if err != nil {
@@ -95,7 +102,7 @@ func (m *Manager) doRollback() error {
 		if err != nil {
 			return fmt.Errorf("recovery.doRollback: %w", err)
 		}
-		rec, err := NewLogRecord(bytes)
+		rec, err := NewLogRecord(bytes, m.logMgr.Encoding())
 		if err != nil {
 			return fmt.Errorf("recovery.doRollback for %s: %w", string(bytes), err)
 		}
@@ -122,7 +129,7 @@ func (m *Manager) doRecover() error {
 		if err != nil {
 			return fmt.Errorf("recovery.doRecover: %w", err)
 		}
-		rec, err := NewLogRecord(bytes)
+		rec, err := NewLogRecord(bytes, m.logMgr.Encoding())
 		if err != nil {
 			return fmt.Errorf("recovery.doRecover for %s: %w", string(bytes), err)
 		}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"slices"
 	"sync"
+	"time"
 
 	"simpledb/buffer"
 	"simpledb/file"
@@ -18,6 +19,8 @@ const endOfFile = -1
 var (
 	txMutex         = &sync.Mutex{}
 	nextTxNum int32 = 0
+	// hintMutex ヒントのファイルを伸ばす時に、他のトランザクションと重ならないようにする
+	hintMutex = &sync.Mutex{}
 )
 
 type Transaction struct {
@@ -29,15 +32,26 @@ type Transaction struct {
 	fm          *file.Manager
 	txnum       int32
 	mybuffers   *BufferList
+	// removals コミットした後に削除するファイル
+	removals []string
+	// truncations コミットした後に切り詰めるファイルと、残すブロックの数
+	truncations map[string]int32
+	// endHooks コミットかロールバックした後、ロックを解放する前に呼ぶ関数
+	endHooks []func(committed bool) error
 
 	blocksAccessed int
 }
 
 func New(fileMgr *file.Manager, logMgr *log.Manager, bufferManager *buffer.Manager) (*Transaction, error) {
+	return NewWithLockTimeout(fileMgr, logMgr, bufferManager, concurrency.DefaultLockTimeout)
+}
+
+// NewWithLockTimeout ロックを lockTimeout まで待つトランザクション
+func NewWithLockTimeout(fileMgr *file.Manager, logMgr *log.Manager, bufferManager *buffer.Manager, lockTimeout time.Duration) (*Transaction, error) {
 	tx := &Transaction{
 		logger: logger.New("tx.Transaction", logger.Info),
 
-		concurMgr: concurrency.New(),
+		concurMgr: concurrency.NewWithTimeout(lockTimeout),
 		fm:        fileMgr,
 		bm:        bufferManager,
 		txnum:     nextTxNumber(),
@@ -57,8 +71,12 @@ func (tx *Transaction) Commit() error {
 	if err := tx.recoveryMgr.Commit(); err != nil {
 		return err
 	}
-	tx.concurMgr.Release()
 	tx.mybuffers.unpinAll()
+	tx.runEndHooks(true)
+	// ファイルはロックを解放する前に切り詰めて削除し、他のトランザクションから見えないようにする
+	tx.truncateFiles()
+	tx.removeFiles()
+	tx.concurMgr.Release()
 	tx.logger.Debugf("transaction %d committed\n", tx.txnum)
 
 	return nil
@@ -69,6 +87,9 @@ func (tx *Transaction) Rollback() error {
 	if err := tx.recoveryMgr.Rollback(); err != nil {
 		return err
 	}
+	tx.removals = nil
+	tx.truncations = nil
+	tx.runEndHooks(false)
 	tx.concurMgr.Release()
 	tx.mybuffers.unpinAll()
 	tx.logger.Debugf("transaction %d rolled back", tx.txnum)
@@ -163,6 +184,120 @@ func (tx *Transaction) SetString(blk file.BlockID, offset int32, val string, okT
 	return nil
 }
 
+// GetBytes offset から length バイトをそのまま読む
+func (tx *Transaction) GetBytes(blk file.BlockID, offset int32, length int32) ([]byte, error) {
+	err := tx.concurMgr.SLock(blk)
+	if err != nil {
+		return nil, err
+	}
+	buff := tx.mybuffers.buffers[blk]
+	return buff.Contents().ReadBytes(offset, length), nil
+}
+
+// SetBytes offset から val をそのまま書き込む。ログには上書きされるバイト列を残す
+// ログのレコードはログのブロックに収まらなければならないので、長いバイト列は分けて書き込む
+func (tx *Transaction) SetBytes(blk file.BlockID, offset int32, val []byte, okToLog bool) error {
+	chunk := int(tx.BlockSize() / 4)
+	for start := 0; start < len(val); start += chunk {
+		end := min(start+chunk, len(val))
+		if err := tx.setBytes(blk, offset+int32(start), val[start:end], okToLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *Transaction) setBytes(blk file.BlockID, offset int32, val []byte, okToLog bool) error {
+	err := tx.concurMgr.XLock(blk)
+	if err != nil {
+		return err
+	}
+	buff := tx.mybuffers.buffers[blk]
+	var lsn int32 = -1
+	if okToLog {
+		var err error
+		lsn, err = tx.recoveryMgr.SetBytes(buff, offset, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	p := buff.Contents()
+	p.WriteBytes(offset, val)
+	buff.SetModified(tx.txnum, lsn)
+	return nil
+}
+
+// GetHint ピンしたブロック blk の offset の整数を、ロックを取らずに読む
+// ヒントは空き領域マップのように、トランザクションの間で共有し、古くても正しさには影響しない値で、SetHintBits で書き換える
+func (tx *Transaction) GetHint(blk file.BlockID, offset int32) int32 {
+	buff := tx.mybuffers.buffers[blk]
+	var val int32
+	tx.bm.Latch(func() {
+		val = buff.Contents().GetInt(offset)
+	})
+	return val
+}
+
+// SetHintBits ピンしたブロック blk の offset の整数の mask のビットを、set なら 1 に、そうでなければ 0 にする。値が変われば true を返す
+// ロックもログも使わないので、他のトランザクションを待たせないが、ロールバックやリカバリでは元に戻らない
+func (tx *Transaction) SetHintBits(blk file.BlockID, offset int32, mask int32, set bool) bool {
+	buff := tx.mybuffers.buffers[blk]
+	changed := false
+	tx.bm.Latch(func() {
+		p := buff.Contents()
+		word := p.GetInt(offset)
+		newWord := word &^ mask
+		if set {
+			newWord = word | mask
+		}
+		if newWord != word {
+			p.SetInt(offset, newWord)
+			buff.SetModified(tx.txnum, -1)
+			changed = true
+		}
+	})
+	return changed
+}
+
+// HintSize ヒントのファイルのブロック数を、ロックを取らずに返す
+func (tx *Transaction) HintSize(filename string) (int32, error) {
+	return tx.fm.Length(filename)
+}
+
+// ExtendHint ヒントのファイルが numBlocks 個のブロックより短ければ、ロックを取らずにブロックを追加する
+func (tx *Transaction) ExtendHint(filename string, numBlocks int32) error {
+	hintMutex.Lock()
+	defer hintMutex.Unlock()
+
+	size, err := tx.fm.Length(filename)
+	if err != nil {
+		return err
+	}
+	for ; size < numBlocks; size++ {
+		if _, err := tx.fm.Append(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnEnd コミットかロールバックした後、ロックを解放する前に f を呼ぶ。committed はコミットしたか
+// トランザクションの結果は確定しているので、f が失敗しても警告を出すだけにする
+func (tx *Transaction) OnEnd(f func(committed bool) error) {
+	tx.endHooks = append(tx.endHooks, f)
+}
+
+func (tx *Transaction) runEndHooks(committed bool) {
+	hooks := tx.endHooks
+	tx.endHooks = nil
+	for _, f := range hooks {
+		if err := f(committed); err != nil {
+			tx.logger.Warningf("transaction %d: %v", tx.txnum, err)
+		}
+	}
+}
+
 func (tx *Transaction) Size(filename string) (int32, error) {
 	dummyblk := file.NewBlockID(filename, endOfFile)
 	if err := tx.concurMgr.SLock(dummyblk); err != nil {
@@ -188,10 +323,80 @@ func (tx *Transaction) Append(filename string) (file.BlockID, error) {
 	return blk, nil
 }
 
+// RemoveOnCommit コミットした時にファイルを削除する。ロールバックした場合は削除しない
+// 他のトランザクションがファイルを読み書きしていないよう、ファイルの末尾に排他ロックを取る
+func (tx *Transaction) RemoveOnCommit(filename string) error {
+	dummyblk := file.NewBlockID(filename, endOfFile)
+	if err := tx.concurMgr.XLock(dummyblk); err != nil {
+		return err
+	}
+	if !slices.Contains(tx.removals, filename) {
+		tx.removals = append(tx.removals, filename)
+	}
+	return nil
+}
+
+// IsRemovedOnCommit filename がコミットした時に削除されるか
+func (tx *Transaction) IsRemovedOnCommit(filename string) bool {
+	return slices.Contains(tx.removals, filename)
+}
+
+// removeFiles コミットした後に、削除するファイルのバッファを空にしてファイルを削除する
+// コミットは既に確定しているので、失敗しても警告を出して残りのファイルの削除を続ける
+func (tx *Transaction) removeFiles() {
+	removals := tx.removals
+	tx.removals = nil
+	for _, filename := range removals {
+		if err := tx.bm.Discard(filename); err != nil {
+			tx.logger.Warningf("transaction %d: failed to remove %s: %v", tx.txnum, filename, err)
+			continue
+		}
+		if err := tx.fm.Remove(filename); err != nil {
+			tx.logger.Warningf("transaction %d: failed to remove %s: %v", tx.txnum, filename, err)
+		}
+	}
+}
+
+// TruncateOnCommit コミットした時にファイルを先頭の numBlocks 個のブロックだけにする。ロールバックした場合は切り詰めない
+// 切り詰めるブロックは、コミットするまでに空にしておかなければならない。ファイルの末尾に排他ロックを取る
+func (tx *Transaction) TruncateOnCommit(filename string, numBlocks int32) error {
+	dummyblk := file.NewBlockID(filename, endOfFile)
+	if err := tx.concurMgr.XLock(dummyblk); err != nil {
+		return err
+	}
+	if tx.truncations == nil {
+		tx.truncations = make(map[string]int32)
+	}
+	tx.truncations[filename] = numBlocks
+	return nil
+}
+
+// truncateFiles コミットした後に、切り詰めるブロックのバッファを空にしてファイルを切り詰める
+// 空にしたブロックはコミットする時に書き出しているので、切り詰める前に異常終了しても空のブロックが残るだけになる
+// 同じ理由で、失敗しても警告を出して残りのファイルの切り詰めを続ける
+func (tx *Transaction) truncateFiles() {
+	truncations := tx.truncations
+	tx.truncations = nil
+	for filename, numBlocks := range truncations {
+		if err := tx.bm.DiscardFrom(filename, numBlocks); err != nil {
+			tx.logger.Warningf("transaction %d: failed to truncate %s: %v", tx.txnum, filename, err)
+			continue
+		}
+		if err := tx.fm.Truncate(filename, numBlocks); err != nil {
+			tx.logger.Warningf("transaction %d: failed to truncate %s: %v", tx.txnum, filename, err)
+		}
+	}
+}
+
 func (tx *Transaction) BlockSize() int32 {
 	return tx.fm.BlockSize()
 }
 
+// Encoding データベースの文字列の符号化方式
+func (tx *Transaction) Encoding() file.Encoding {
+	return tx.fm.Encoding()
+}
+
 func (tx *Transaction) AvailableBuffers() int32 {
 	return tx.bm.NumAvailable()
 }
@@ -1,6 +1,7 @@
 package tx_test
 
 import (
+	"os"
 	"path"
 	"testing"
 
@@ -133,3 +134,124 @@ func TestTransaction(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRemoveOnCommit(t *testing.T) {
+	dir := path.Join(t.TempDir(), "removetest")
+	db, err := server.NewSimpleDB(dir, 400, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := db.FileManager()
+	lm := db.LogManager()
+	bm := db.BufferManager()
+	exists := func(filename string) bool {
+		_, err := os.Stat(path.Join(dir, filename))
+		return err == nil
+	}
+
+	tx1, err := tx.New(fm, lm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{"pinned", "unpinned"} {
+		if _, err := tx1.Append(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 他でピンされたままのファイルは削除できないが、コミットは確定しているのでエラーにしない
+	buff, _, err := bm.Pin(file.NewBlockID("pinned", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2, err := tx.New(fm, lm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{"pinned", "unpinned"} {
+		if err := tx2.RemoveOnCommit(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	bm.Unpin(buff)
+	if !exists("pinned") {
+		t.Fatalf("pinned file was removed")
+	}
+	if exists("unpinned") {
+		t.Fatalf("unpinned file was not removed")
+	}
+
+	// ロックは解放されている
+	tx3, err := tx.New(fm, lm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx3.RemoveOnCommit("pinned"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx3.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if exists("pinned") {
+		t.Fatalf("pinned file was not removed")
+	}
+}
+
+func TestTruncateOnCommit(t *testing.T) {
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "truncatetest"), 400, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := db.FileManager()
+	lm := db.LogManager()
+	bm := db.BufferManager()
+
+	tx1, err := tx.New(fm, lm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{"pinned", "unpinned"} {
+		for range 3 {
+			if _, err := tx1.Append(filename); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 切り詰めるブロックが他でピンされていれば切り詰めないが、コミットは確定しているのでエラーにしない
+	buff, _, err := bm.Pin(file.NewBlockID("pinned", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2, err := tx.New(fm, lm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{"pinned", "unpinned"} {
+		if err := tx2.TruncateOnCommit(filename, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	bm.Unpin(buff)
+	for filename, want := range map[string]int32{"pinned": 3, "unpinned": 1} {
+		length, err := fm.Length(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length != want {
+			t.Fatalf("%s has %d blocks, want %d", filename, length, want)
+		}
+	}
+}
@@ -51,6 +51,10 @@ func (l *Logger) Infof(format string, v ...interface{}) {
 	l.logf(Info, format, v...)
 }
 
+func (l *Logger) Warningf(format string, v ...interface{}) {
+	l.logf(Warning, format, v...)
+}
+
 func (l *Logger) logf(level LogLevel, format string, v ...interface{}) {
 	if l.Level <= level {
 		lv := fmt.Sprintf("%-5s", logLevelNames[level])